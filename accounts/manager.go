@@ -0,0 +1,251 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+)
+
+// Account errors
+var (
+	ErrUnknownAccount = errors.New("unknown account")
+	ErrLocked         = errors.New("account is locked")
+	ErrAccountExists  = errors.New("account already exists")
+)
+
+// Account is a key file of the keystore
+type Account struct {
+	Address crypto.Address
+	Path    string
+}
+
+// unlockedKey is the decrypted key of an unlocked account
+type unlockedKey struct {
+	wallet *crypto.Wallet
+	timer  *time.Timer // locks the account again, nil if unlocked until Lock
+}
+
+// Manager holds the accounts of a keystore directory. Their keys stay
+// encrypted on disk and in memory until an account is unlocked with its
+// passphrase, signing with a locked account fails with ErrLocked.
+type Manager struct {
+	keystore string
+	scryptN  int
+	scryptP  int
+
+	mu       sync.Mutex
+	unlocked map[crypto.Address]*unlockedKey
+}
+
+// NewManager returns the manager of the key files in the keystore directory
+func NewManager(keystore string) *Manager {
+	return &Manager{
+		keystore: keystore,
+		scryptN:  crypto.StandardScryptN,
+		scryptP:  crypto.StandardScryptP,
+		unlocked: make(map[crypto.Address]*unlockedKey),
+	}
+}
+
+// SetLightKDF has new accounts derive their key with less memory and CPU,
+// for test accounts
+func (am *Manager) SetLightKDF(light bool) {
+	am.scryptN, am.scryptP = crypto.StandardScryptN, crypto.StandardScryptP
+	if light {
+		am.scryptN, am.scryptP = crypto.LightScryptN, crypto.LightScryptP
+	}
+}
+
+// Accounts returns the accounts of the keystore, oldest first. Key files
+// are read on every call, so files copied into the directory show up
+// without a restart. Files that are not key files are skipped.
+func (am *Manager) Accounts() []Account {
+	entries, err := os.ReadDir(am.keystore)
+	if err != nil {
+		return nil
+	}
+	// Key file names start with their creation time
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	accounts := make([]Account, 0, len(entries))
+	seen := make(map[crypto.Address]bool)
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || strings.HasSuffix(entry.Name(), "~") {
+			continue
+		}
+		path := filepath.Join(am.keystore, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var key struct {
+			Address string `json:"address"`
+		}
+		if err := json.Unmarshal(data, &key); err != nil || !crypto.IsHexAddress(key.Address) {
+			continue
+		}
+		addr := crypto.HexToAddress(key.Address)
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		accounts = append(accounts, Account{Address: addr, Path: path})
+	}
+	return accounts
+}
+
+// Addresses returns the addresses of the accounts, oldest first
+func (am *Manager) Addresses() []crypto.Address {
+	accounts := am.Accounts()
+	addrs := make([]crypto.Address, len(accounts))
+	for i, account := range accounts {
+		addrs[i] = account.Address
+	}
+	return addrs
+}
+
+// Find returns the account of addr
+func (am *Manager) Find(addr crypto.Address) (Account, error) {
+	for _, account := range am.Accounts() {
+		if account.Address == addr {
+			return account, nil
+		}
+	}
+	return Account{}, fmt.Errorf("%w %s", ErrUnknownAccount, addr.Hex())
+}
+
+// NewAccount creates an account with a new key encrypted with passphrase
+func (am *Manager) NewAccount(passphrase string) (Account, error) {
+	wallet, err := crypto.NewWallet()
+	if err != nil {
+		return Account{}, err
+	}
+	return am.Import(wallet, passphrase)
+}
+
+// Import stores the key of wallet encrypted with passphrase, failing with
+// ErrAccountExists if the keystore already holds it
+func (am *Manager) Import(wallet *crypto.Wallet, passphrase string) (Account, error) {
+	if account, err := am.Find(wallet.Address); err == nil {
+		return Account{}, fmt.Errorf("%w: %s in %s", ErrAccountExists, wallet.Address.Hex(), account.Path)
+	}
+	path, err := crypto.StoreKey(am.keystore, wallet, passphrase, am.scryptN, am.scryptP)
+	if err != nil {
+		return Account{}, err
+	}
+	return Account{Address: wallet.Address, Path: path}, nil
+}
+
+// Unlock decrypts the key of addr with passphrase and keeps it for
+// duration, until Lock if duration is 0. Unlocking an unlocked account
+// replaces its duration.
+func (am *Manager) Unlock(addr crypto.Address, passphrase string, duration time.Duration) error {
+	account, err := am.Find(addr)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(account.Path)
+	if err != nil {
+		return err
+	}
+	wallet, err := crypto.DecryptKey(data, passphrase)
+	if err != nil {
+		return err
+	}
+	if wallet.Address != addr {
+		return fmt.Errorf("key file %s holds the key of %s", account.Path, wallet.Address.Hex())
+	}
+
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	am.dropLocked(addr)
+	key := &unlockedKey{wallet: wallet}
+	if duration > 0 {
+		key.timer = time.AfterFunc(duration, func() {
+			am.mu.Lock()
+			defer am.mu.Unlock()
+			// A later unlock replaced this key
+			if am.unlocked[addr] == key {
+				am.dropLocked(addr)
+			}
+		})
+	}
+	am.unlocked[addr] = key
+	return nil
+}
+
+// Lock removes the decrypted key of addr
+func (am *Manager) Lock(addr crypto.Address) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	am.dropLocked(addr)
+}
+
+// LockAll removes the decrypted keys of every account
+func (am *Manager) LockAll() {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	for addr := range am.unlocked {
+		am.dropLocked(addr)
+	}
+}
+
+// Unlocked reports whether addr is unlocked
+func (am *Manager) Unlocked(addr crypto.Address) bool {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	return am.unlocked[addr] != nil
+}
+
+// SignHash signs hash with the key of addr, which must be unlocked
+func (am *Manager) SignHash(addr crypto.Address, hash crypto.Hash) ([]byte, error) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	key := am.unlocked[addr]
+	if key == nil {
+		return nil, fmt.Errorf("%w: %s", ErrLocked, addr.Hex())
+	}
+	return key.wallet.SignHash(hash)
+}
+
+// SignTx signs tx for the chain chainID with the key of addr, which must be
+// unlocked
+func (am *Manager) SignTx(addr crypto.Address, tx *core.Transaction, chainID *big.Int) error {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	key := am.unlocked[addr]
+	if key == nil {
+		return fmt.Errorf("%w: %s", ErrLocked, addr.Hex())
+	}
+	return core.SignTx(tx, chainID, key.wallet.PrivateKey)
+}
+
+// dropLocked stops the timer of the key of addr and wipes it. The caller
+// must hold am.mu.
+func (am *Manager) dropLocked(addr crypto.Address) {
+	key := am.unlocked[addr]
+	if key == nil {
+		return
+	}
+	if key.timer != nil {
+		key.timer.Stop()
+	}
+	key.wallet.PrivateKey.D.SetInt64(0)
+	delete(am.unlocked, addr)
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// progressInterval is how often export and import report their progress
+const progressInterval = 5 * time.Second
+
+// chainFile is a chain export file, gzip compressed when its name ends in .gz
+type chainFile struct {
+	io.Reader
+	io.Writer
+	file *os.File
+	gz   io.Closer
+}
+
+// openChainFile opens an export file for reading
+func openChainFile(path string) (*chainFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &chainFile{Reader: file, file: file}
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("invalid gzip file %s: %v", path, err)
+		}
+		f.Reader, f.gz = gz, gz
+	}
+	return f, nil
+}
+
+// createChainFile creates an export file for writing
+func createChainFile(path string) (*chainFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &chainFile{Writer: file, file: file}
+	if strings.HasSuffix(path, ".gz") {
+		gz := gzip.NewWriter(file)
+		f.Writer, f.gz = gz, gz
+	}
+	return f, nil
+}
+
+// Close flushes the compression and closes the file
+func (f *chainFile) Close() error {
+	var err error
+	if f.gz != nil {
+		err = f.gz.Close()
+	}
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// progress rate limits progress lines to one per progressInterval
+type progress struct {
+	start time.Time
+	last  time.Time
+}
+
+func newProgress() *progress {
+	now := time.Now()
+	return &progress{start: now, last: now}
+}
+
+// due reports whether the next progress line is due
+func (p *progress) due() bool {
+	if time.Since(p.last) < progressInterval {
+		return false
+	}
+	p.last = time.Now()
+	return true
+}
+
+// rate returns n per second since the start
+func (p *progress) rate(n uint64) float64 {
+	elapsed := time.Since(p.start).Seconds()
+	if elapsed == 0 {
+		return 0
+	}
+	return float64(n) / elapsed
+}
+
+// elapsed returns the time since the start
+func (p *progress) elapsed() time.Duration {
+	return time.Since(p.start).Round(time.Millisecond)
+}
@@ -0,0 +1,99 @@
+//go:build !windows
+
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"blockchain-node/config"
+)
+
+// daemonize runs the node command again in a new session, detached from
+// the terminal, and waits until the node reports that it is up the way it
+// reports it to systemd. The detached node writes its console output to
+// the log file of c. It returns the ID of the node process.
+func daemonize(c *config.Config) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("failed to find executable: %v", err)
+	}
+
+	// The node reports its readiness on a socket only this process reads
+	dir, err := os.MkdirTemp("", "lumina-daemon-")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create notification socket: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create notification socket: %v", err)
+	}
+	defer conn.Close()
+
+	logPath := c.Logging.FilePath
+	if logPath == "" {
+		logPath = "./logs/blockchain.log"
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create log directory: %v", err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open log file: %v", err)
+	}
+	defer logFile.Close()
+
+	child := exec.Command(exe, os.Args[1:]...)
+	child.Env = append(os.Environ(), daemonEnv+"=1", "NOTIFY_SOCKET="+socket)
+	child.Stdout = logFile
+	child.Stderr = logFile
+	child.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := child.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start node process: %v", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- child.Wait()
+	}()
+	ready := make(chan struct{})
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, _, err := conn.ReadFromUnix(buf)
+			if err != nil {
+				return
+			}
+			for _, line := range bytes.Split(buf[:n], []byte("\n")) {
+				if string(line) == "READY=1" {
+					close(ready)
+					return
+				}
+			}
+		}
+	}()
+
+	select {
+	case <-ready:
+		return child.Process.Pid, nil
+	case err := <-exited:
+		if err == nil {
+			err = errors.New("exit status 0")
+		}
+		return 0, fmt.Errorf("node exited while starting (%v), see %s", err, logPath)
+	}
+}
+
+// processAlive reports whether a process with the ID exists
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,23 @@
+package cli
+
+import (
+	"errors"
+	"os"
+
+	"blockchain-node/config"
+)
+
+// daemonize is not supported on Windows, run the node as a service instead
+func daemonize(c *config.Config) (int, error) {
+	return 0, errors.New("--daemon is not supported on Windows, run the node as a service instead")
+}
+
+// processAlive reports whether a process with the ID exists
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"blockchain-node/crypto"
+	"blockchain-node/node"
+	"blockchain-node/storage"
+)
+
+// openDataDir opens the database of the data directory for the db commands
+func openDataDir(readOnly bool) (storage.Database, *storage.Freezer, error) {
+	if cfg.DB.Type == storage.BackendMemory {
+		return nil, nil, fmt.Errorf("db.type %s has no data directory", storage.BackendMemory)
+	}
+	return node.OpenDatabase(&cfg.DB, readOnly)
+}
+
+// tableKey resolves the table name and key arguments of db get and delete
+func tableKey(db storage.Database, name, key string) (*storage.Table, []byte, error) {
+	table := storage.NewTables(db).ByName(name)
+	if table == nil {
+		return nil, nil, fmt.Errorf("unknown table %q, db inspect lists the tables", name)
+	}
+	data, err := parseKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return table, data, nil
+}
+
+// parseKey decodes a key argument. Keys with 0x prefix are hex, others are
+// taken as text, like the markers of the meta table.
+func parseKey(key string) ([]byte, error) {
+	if len(key) >= 2 && key[:2] == "0x" {
+		data, err := crypto.Decode(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex key %s: %v", key, err)
+		}
+		return data, nil
+	}
+	return []byte(key), nil
+}
+
+// formatValue returns value as text if it is printable, else as hex
+func formatValue(value []byte) string {
+	if len(value) > 0 && utf8.Valid(value) {
+		printable := true
+		for _, r := range string(value) {
+			if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+				printable = false
+				break
+			}
+		}
+		if printable {
+			return string(value)
+		}
+	}
+	return crypto.Encode(value)
+}
+
+// formatSize formats a byte count with a binary unit prefix
+func formatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.2f %s", value, units[i])
+}
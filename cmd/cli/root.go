@@ -2,12 +2,21 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"math/big"
 	"os"
+	"runtime"
+	"time"
 
+	"blockchain-node/accounts"
 	"blockchain-node/config"
+	"blockchain-node/consensus"
+	"blockchain-node/core"
+	"blockchain-node/crypto"
 	"blockchain-node/logger"
 	"blockchain-node/node"
+	"blockchain-node/storage"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -43,11 +52,23 @@ func init() {
 	
 	// Add subcommands
 	rootCmd.AddCommand(startNodeCmd)
+	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
 	rootCmd.AddCommand(createWalletCmd)
+	rootCmd.AddCommand(importWalletCmd)
 	rootCmd.AddCommand(getBalanceCmd)
 	rootCmd.AddCommand(sendCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(metricsCmd)
+	rootCmd.AddCommand(dumpStateCmd)
+	rootCmd.AddCommand(benchmarkCmd)
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbInspectCmd)
+	dbCmd.AddCommand(dbCompactCmd)
+	dbCmd.AddCommand(dbGetCmd)
+	dbCmd.AddCommand(dbDeleteCmd)
 }
 
 func initConfig() {
@@ -73,16 +94,23 @@ func initConfig() {
 	}
 
 	cfg = config.LoadConfig()
+	applyLogFlags(cfg)
+}
 
-	// Override config with command line flags
+// applyLogFlags overrides the logging configuration with command line flags
+func applyLogFlags(c *config.Config) {
 	if debugLevel != "" {
-		cfg.Logging.Level = debugLevel
+		c.Logging.Level = debugLevel
 	}
 	if logOutput != "" {
-		cfg.Logging.Output = logOutput
+		c.Logging.Output = logOutput
 	}
 	if logFile != "" {
-		cfg.Logging.FilePath = logFile
+		c.Logging.FilePath = logFile
+	}
+	// The console output of a detached node goes to the log file already
+	if detached() && c.Logging.Output == "both" {
+		c.Logging.Output = "file"
 	}
 }
 
@@ -92,6 +120,30 @@ var startNodeCmd = &cobra.Command{
 	Long:  `Start the blockchain node with all configured services including P2P, RPC, mining, and metrics.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Starting professional blockchain node...")
+		if cmd.Flags().Changed("mode") {
+			cfg.Sync.Mode, _ = cmd.Flags().GetString("mode")
+		}
+		applyDevFlags(cmd, cfg)
+
+		// Run the node in a detached process and return once it is up
+		if daemon, _ := cmd.Flags().GetBool("daemon"); daemon && !detached() {
+			pid, err := daemonize(cfg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to start node in the background: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Node running in the background with PID %d\n", pid)
+			return
+		}
+
+		pidFile, _ := cmd.Flags().GetString("pidfile")
+		if pidFile != "" {
+			if err := writePIDFile(pidFile); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			defer removePIDFile(pidFile)
+		}
 		
 		// Initialize early logger for startup
 		loggerConfig := logger.Config{
@@ -106,73 +158,373 @@ var startNodeCmd = &cobra.Command{
 
 		nodeInstance, err := node.NewNode(cfg)
 		if err != nil {
+			removePIDFile(pidFile)
 			logger.Fatal("Failed to create node: %v", err)
 		}
 
+		// SIGHUP and lumina_reloadConfig read the config file again
+		nodeInstance.SetConfigLoader(func() (*config.Config, error) {
+			reloaded, err := config.ReloadConfig()
+			if err != nil {
+				return nil, err
+			}
+			applyLogFlags(reloaded)
+			if cmd.Flags().Changed("mode") {
+				reloaded.Sync.Mode = cfg.Sync.Mode
+			}
+			applyDevFlags(cmd, reloaded)
+			return reloaded, nil
+		})
+
 		if err := nodeInstance.Start(); err != nil {
+			removePIDFile(pidFile)
 			logger.Fatal("Failed to start node: %v", err)
 		}
 	},
 }
 
+// applyDevFlags overrides the development chain configuration with the
+// startnode flags
+func applyDevFlags(cmd *cobra.Command, c *config.Config) {
+	if cmd.Flags().Changed("dev") {
+		c.Dev.Enabled, _ = cmd.Flags().GetBool("dev")
+	}
+	if cmd.Flags().Changed("dev.period") {
+		c.Dev.Period, _ = cmd.Flags().GetUint64("dev.period")
+	}
+	if cmd.Flags().Changed("dev.accounts") {
+		c.Dev.Accounts, _ = cmd.Flags().GetInt("dev.accounts")
+	}
+}
+
 var createWalletCmd = &cobra.Command{
 	Use:   "createwallet",
 	Short: "Create a new wallet",
-	Long:  `Generate a new cryptographic wallet with private/public key pair and address.`,
+	Long:  `Generate a new key pair and store the private key encrypted with a passphrase in a key file of the keystore directory (wallet.keystore). Key files use the Web3 Secret Storage format, so geth and most wallets can import them. With --mnemonic the key is derived from a new BIP-39 seed phrase that is printed once; the phrase restores the key with importwallet or any BIP-44 wallet.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Creating new wallet...")
-		// TODO: Implement wallet creation
-		fmt.Println("Wallet creation feature coming soon!")
+		keystore, _ := cmd.Flags().GetString("keystore")
+		passwordFile, _ := cmd.Flags().GetString("password")
+		lightKDF, _ := cmd.Flags().GetBool("lightkdf")
+		withMnemonic, _ := cmd.Flags().GetBool("mnemonic")
+		pathStr, _ := cmd.Flags().GetString("path")
+
+		path, err := crypto.ParseDerivationPath(pathStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		passphrase, err := readPassphrase(passwordFile, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
+		manager := accounts.NewManager(keystoreDir(keystore))
+		manager.SetLightKDF(lightKDF)
+		var (
+			account  accounts.Account
+			mnemonic string
+		)
+		if withMnemonic {
+			if mnemonic, err = crypto.NewMnemonic(crypto.DefaultMnemonicBits); err == nil {
+				var wallet *crypto.Wallet
+				if wallet, err = crypto.WalletFromMnemonic(mnemonic, "", path); err == nil {
+					account, err = manager.Import(wallet, passphrase)
+				}
+			}
+		} else {
+			account, err = manager.NewAccount(passphrase)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create wallet: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Address:  %s\n", account.Address.Hex())
+		fmt.Printf("Key file: %s\n", account.Path)
+		if mnemonic != "" {
+			fmt.Printf("Path:     %s\n", path)
+			fmt.Printf("Mnemonic: %s\n", mnemonic)
+			fmt.Println("Write the mnemonic down and keep it offline, anyone who has it controls the account.")
+			return
+		}
+		fmt.Println("Keep the passphrase safe, the key can not be recovered without it.")
+	},
+}
+
+var importWalletCmd = &cobra.Command{
+	Use:   "importwallet",
+	Short: "Import a wallet from a mnemonic",
+	Long:  `Derive the key of a BIP-39 seed phrase at a BIP-32/BIP-44 derivation path and store it encrypted in the keystore directory like createwallet. The default path m/44'/60'/0'/0/0 is the first account of most Ethereum wallets; --index picks a later one.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		keystore, _ := cmd.Flags().GetString("keystore")
+		passwordFile, _ := cmd.Flags().GetString("password")
+		lightKDF, _ := cmd.Flags().GetBool("lightkdf")
+		mnemonicFile, _ := cmd.Flags().GetString("mnemonic-file")
+		seedPassphrase, _ := cmd.Flags().GetString("seed-passphrase")
+		pathStr, _ := cmd.Flags().GetString("path")
+		index, _ := cmd.Flags().GetUint32("index")
+
+		path := append(crypto.DerivationPath{}, crypto.DefaultBaseDerivationPath...)
+		path = append(path, index)
+		if cmd.Flags().Changed("path") {
+			var err error
+			if path, err = crypto.ParseDerivationPath(pathStr); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		var mnemonic string
+		if mnemonicFile != "" {
+			data, err := os.ReadFile(mnemonicFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read mnemonic file: %v\n", err)
+				os.Exit(1)
+			}
+			mnemonic = string(data)
+		} else {
+			var err error
+			if mnemonic, err = prompt("Mnemonic: "); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		}
+		wallet, err := crypto.WalletFromMnemonic(mnemonic, seedPassphrase, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to derive key: %v\n", err)
+			os.Exit(1)
+		}
+
+		passphrase, err := readPassphrase(passwordFile, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		manager := accounts.NewManager(keystoreDir(keystore))
+		manager.SetLightKDF(lightKDF)
+		account, err := manager.Import(wallet, passphrase)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to import wallet: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Address:  %s\n", account.Address.Hex())
+		fmt.Printf("Path:     %s\n", path)
+		fmt.Printf("Key file: %s\n", account.Path)
 	},
 }
 
 var getBalanceCmd = &cobra.Command{
 	Use:   "getbalance [address]",
 	Short: "Get balance of an address",
-	Long:  `Query the blockchain for the balance of a specific address.`,
+	Long:  `Query the running node for the balance of an address with eth_getBalance, at the head block.`,
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		address := args[0]
-		fmt.Printf("Getting balance for address: %s\n", address)
-		// TODO: Implement balance query
-		fmt.Println("Balance query feature coming soon!")
+		endpoint, _ := cmd.Flags().GetString("rpc")
+		unitName, _ := cmd.Flags().GetString("unit")
+
+		if !crypto.IsHexAddress(args[0]) {
+			fmt.Fprintf(os.Stderr, "Invalid address: %s\n", args[0])
+			os.Exit(1)
+		}
+		unit, err := lookupUnit(unitName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
+		var result string
+		if err := callRPC(rpcURL(endpoint), "eth_getBalance", []interface{}{args[0], "latest"}, &result); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get balance: %v\n", err)
+			os.Exit(1)
+		}
+		balance, err := crypto.DecodeBig(result)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid balance %q: %v\n", result, err)
+			os.Exit(1)
+		}
+
+		fmt.Println(unit.format(balance))
 	},
 }
 
 var sendCmd = &cobra.Command{
 	Use:   "send",
 	Short: "Send a transaction",
-	Long:  `Create and broadcast a transaction to the network.`,
+	Long:  `Sign a transaction locally with a key from the keystore, or the one given with --privatekey, and submit it to the running node with eth_sendRawTransaction. The nonce, gas price and gas limit are fetched from the node unless given. Without --to the data is deployed as a contract.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		from, _ := cmd.Flags().GetString("from")
 		to, _ := cmd.Flags().GetString("to")
 		amount, _ := cmd.Flags().GetString("amount")
-		data, _ := cmd.Flags().GetString("data")
+		unitName, _ := cmd.Flags().GetString("unit")
+		dataStr, _ := cmd.Flags().GetString("data")
 		gasLimit, _ := cmd.Flags().GetUint64("gaslimit")
 		gasPrice, _ := cmd.Flags().GetUint64("gasprice")
+		keystore, _ := cmd.Flags().GetString("keystore")
+		passwordFile, _ := cmd.Flags().GetString("password")
+		privateKey, _ := cmd.Flags().GetString("privatekey")
+		endpoint, _ := cmd.Flags().GetString("rpc")
+		wait, _ := cmd.Flags().GetBool("wait")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		fail := func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, format+"\n", args...)
+			os.Exit(1)
+		}
+
+		if from != "" && !crypto.IsHexAddress(from) {
+			fail("Invalid sender address: %s", from)
+		}
+		tx := &core.Transaction{Type: core.LegacyTxType, GasLimit: gasLimit}
+		if to != "" {
+			if !crypto.IsHexAddress(to) {
+				fail("Invalid recipient address: %s", to)
+			}
+			recipient := crypto.HexToAddress(to)
+			tx.To = &recipient
+		}
+		unit, err := lookupUnit(unitName)
+		if err != nil {
+			fail("%v", err)
+		}
+		if tx.Value, err = unit.parse(amount); err != nil {
+			fail("%v", err)
+		}
+		if dataStr != "" {
+			if tx.Data, err = crypto.Decode(dataStr); err != nil {
+				fail("Invalid data: %v", err)
+			}
+		}
+		if tx.To == nil && len(tx.Data) == 0 {
+			fail("--to is required unless --data holds contract code")
+		}
+
+		wallet, err := senderWallet(privateKey, from, keystore, passwordFile)
+		if err != nil {
+			fail("Failed to load key: %v", err)
+		}
+		sender := wallet.Address.Hex()
+		url := rpcURL(endpoint)
+
+		chainID, err := callQuantity(url, "eth_chainId", nil)
+		if err != nil {
+			fail("Failed to get chain ID: %v", err)
+		}
+		nonce, err := callQuantity(url, "eth_getTransactionCount", []interface{}{sender, "pending"})
+		if err != nil {
+			fail("Failed to get nonce: %v", err)
+		}
+		tx.Nonce = nonce.Uint64()
+		if gasPrice != 0 {
+			tx.GasPrice = new(big.Int).SetUint64(gasPrice)
+		} else if tx.GasPrice, err = callQuantity(url, "eth_gasPrice", nil); err != nil {
+			fail("Failed to get gas price: %v", err)
+		}
+		if tx.GasLimit == 0 {
+			call := map[string]interface{}{
+				"from":  sender,
+				"value": crypto.EncodeBig(tx.Value),
+				"data":  crypto.Encode(tx.Data),
+			}
+			if tx.To != nil {
+				call["to"] = tx.To.Hex()
+			}
+			estimate, err := callQuantity(url, "eth_estimateGas", []interface{}{call})
+			if err != nil {
+				fail("Failed to estimate gas: %v", err)
+			}
+			tx.GasLimit = estimate.Uint64()
+		}
+
+		if err := core.SignTx(tx, chainID, wallet.PrivateKey); err != nil {
+			fail("Failed to sign transaction: %v", err)
+		}
+		var hash string
+		if err := callRPC(url, "eth_sendRawTransaction", []interface{}{crypto.Encode(tx.Encode())}, &hash); err != nil {
+			fail("Failed to send transaction: %v", err)
+		}
+
+		fmt.Printf("Transaction: %s\n", hash)
+		fmt.Printf("From:        %s (nonce %d)\n", sender, tx.Nonce)
+		fmt.Printf("Value:       %s\n", unit.format(tx.Value))
+		fmt.Printf("Gas:         %d at %s\n", tx.GasLimit, units["gwei"].format(tx.GasPrice))
+		if !wait {
+			return
+		}
 
-		fmt.Printf("Sending transaction from %s to %s, amount: %s\n", from, to, amount)
-		if data != "" {
-			fmt.Printf("Data: %s\n", data)
+		receipt, err := waitForReceipt(url, hash, timeout)
+		if err != nil {
+			fail("%v", err)
+		}
+		blockNumber, _ := crypto.DecodeBig(receipt.BlockNumber)
+		gasUsed, _ := crypto.DecodeUint64(receipt.GasUsed)
+		status, _ := crypto.DecodeUint64(receipt.Status)
+		fmt.Printf("Included in block %v (%s), gas used %d\n", blockNumber, receipt.BlockHash, gasUsed)
+		if receipt.ContractAddress != nil {
+			fmt.Printf("Contract:    %s\n", *receipt.ContractAddress)
+		}
+		if status != 1 {
+			fail("Transaction failed")
 		}
-		fmt.Printf("Gas Limit: %d, Gas Price: %d\n", gasLimit, gasPrice)
-		// TODO: Implement transaction sending
-		fmt.Println("Transaction sending feature coming soon!")
 	},
 }
 
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show node status",
-	Long:  `Display current status information about the running node.`,
+	Long:  `Query the running node over RPC and show its chain head, peers, sync state, mempool and mining status.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		endpoint, _ := cmd.Flags().GetString("rpc")
+		url := rpcURL(endpoint)
+
+		var stats nodeStats
+		if err := callRPC(url, "lumina_getStats", nil, &stats); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get node status: %v\n", err)
+			os.Exit(1)
+		}
+		chainID, err := callQuantity(url, "eth_chainId", nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get chain ID: %v\n", err)
+			os.Exit(1)
+		}
+		var head *headBlock
+		if err := callRPC(url, "eth_getBlockByNumber", []interface{}{"latest", false}, &head); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get head block: %v\n", err)
+			os.Exit(1)
+		}
+
 		fmt.Println("Node Status:")
 		fmt.Println("============")
-		// TODO: Implement status display
-		fmt.Println("Status display feature coming soon!")
-		fmt.Printf("Config file: %s\n", viper.ConfigFileUsed())
-		fmt.Printf("Log level: %s\n", cfg.Logging.Level)
-		fmt.Printf("Log output: %s\n", cfg.Logging.Output)
+		fmt.Printf("Endpoint: %s\n", url)
+		fmt.Printf("Chain ID: %v\n", chainID)
+		if head != nil {
+			fmt.Printf("Head:     #%d %s (%v ago)\n", stats.BlockHeight, head.Hash, head.age())
+		} else {
+			fmt.Printf("Head:     #%d\n", stats.BlockHeight)
+		}
+		if stats.PeerCount != nil {
+			fmt.Printf("Peers:    %d\n", *stats.PeerCount)
+		}
+		if stats.Syncing != nil {
+			sync := "synced"
+			if *stats.Syncing {
+				sync = "syncing"
+			}
+			fmt.Printf("Sync:     %s\n", sync)
+		}
+		mempool := fmt.Sprintf("%d pending, %d queued", stats.MempoolStats.PendingCount, stats.MempoolStats.QueuedCount)
+		if stats.MempoolStats.Paused {
+			mempool += " (paused)"
+		}
+		fmt.Printf("Mempool:  %s\n", mempool)
+		if stats.Mining != nil {
+			if *stats.Mining {
+				fmt.Printf("Mining:   yes, %s, rewards to %s\n", formatHashRate(stats.HashRate), stats.Coinbase)
+			} else {
+				fmt.Println("Mining:   no")
+			}
+		}
 	},
 }
 
@@ -188,20 +540,449 @@ var metricsCmd = &cobra.Command{
 	},
 }
 
+var initCmd = &cobra.Command{
+	Use:   "init [genesis.json]",
+	Short: "Initialize the data directory from a genesis file",
+	Long:  `Write the genesis block, the genesis state and the chain configuration of a genesis file to the data directory. The node then runs that chain and refuses to start on a data directory holding another genesis block. Running init again with the same file does nothing. The node must not be running.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		genesis, err := core.LoadGenesis(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load genesis: %v\n", err)
+			os.Exit(1)
+		}
+
+		block, err := node.InitGenesis(cfg, genesis)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to initialize %s: %v\n", cfg.DB.Path, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Initialized %s\n", cfg.DB.Path)
+		fmt.Printf("Genesis hash:   %s\n", block.Hash.Hex())
+		fmt.Printf("Chain ID:       %v\n", genesis.Config.ChainID)
+		fmt.Printf("Alloc accounts: %d\n", len(genesis.Alloc))
+		if genesis.Config.ChainID.Cmp(new(big.Int).SetUint64(cfg.EVM.ChainID)) != 0 {
+			fmt.Printf("Set evm.chain_id to %v before starting the node\n", genesis.Config.ChainID)
+		}
+	},
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "Export the chain to a file",
+	Long:  `Write the canonical blocks to a file, one JSON encoded block per line, for import into another data directory. Files ending in .gz are compressed. The node must not be running.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		from, _ := cmd.Flags().GetUint64("from")
+		to, _ := cmd.Flags().GetUint64("to")
+
+		chain, err := node.OpenChain(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open chain: %v\n", err)
+			os.Exit(1)
+		}
+		defer chain.Close()
+		if to == 0 {
+			to = chain.GetCurrentBlock().Header.Number.Uint64()
+		}
+		if from > to {
+			fmt.Fprintf(os.Stderr, "Invalid range: --from %d is above %d\n", from, to)
+			os.Exit(1)
+		}
+
+		file, err := createChainFile(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		fmt.Printf("Exporting blocks %d to %d\n", from, to)
+		p := newProgress()
+		count, err := chain.ExportChain(file, from, to, func(block *core.Block) {
+			if p.due() {
+				fmt.Printf("Exported block %v of %d (%.0f blocks/s)\n", block.Header.Number, to, p.rate(block.Header.Number.Uint64()-from+1))
+			}
+		})
+		if err == nil {
+			err = file.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Exported %d blocks to %s in %v\n", count, args[0], p.elapsed())
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import blocks from an export file",
+	Long:  `Add the blocks of a file written by export to the chain, validating and executing each like a block from the network. Blocks already in the chain are skipped, so an interrupted import can be run again. Files ending in .gz are decompressed. The node must not be running.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+		if cmd.Flags().Changed("batch-limit") {
+			cfg.DB.BatchLimit, _ = cmd.Flags().GetInt("batch-limit")
+		}
+
+		file, err := openChainFile(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		chain, err := node.OpenChain(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open chain: %v\n", err)
+			os.Exit(1)
+		}
+		defer chain.Close()
+
+		p := newProgress()
+		stats, err := chain.ImportChain(file, &core.ImportOptions{
+			BatchSize: batchSize,
+			Progress: func(stats core.ImportStats) {
+				if p.due() {
+					fmt.Printf("Imported %d blocks, skipped %d, at block %d (%.0f blocks/s)\n",
+						stats.Imported, stats.Skipped, stats.Last, p.rate(stats.Imported))
+				}
+			},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Import failed after %d blocks: %v\n", stats.Imported, err)
+			os.Exit(1)
+		}
+		head := chain.GetCurrentBlock()
+		fmt.Printf("Imported %d blocks, skipped %d known, in %v\n", stats.Imported, stats.Skipped, p.elapsed())
+		fmt.Printf("Head is block %v (%s)\n", head.Header.Number, head.Hash.Hex())
+	},
+}
+
+var dumpStateCmd = &cobra.Command{
+	Use:   "dumpstate",
+	Short: "Dump the world state as JSON",
+	Long:  `Write every account of the committed state with its balance, nonce, code and storage as JSON. The database is opened read-only, the node must not be running.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		db, err := storage.Open(cfg.DB.Type, cfg.DB.Path, &storage.Options{
+			CacheSize:    cfg.DB.CacheSize,
+			MaxOpenFiles: cfg.DB.MaxOpenFiles,
+			WriteBuffer:  cfg.DB.WriteBuffer,
+			ReadOnly:     true,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		out := os.Stdout
+		if output != "" {
+			file, err := os.Create(output)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", output, err)
+				os.Exit(1)
+			}
+			defer file.Close()
+			out = file
+		}
+
+		if err := core.OpenStateDB(db).Dump(out); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to dump state: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var benchmarkCmd = &cobra.Command{
+	Use:   "benchmark",
+	Short: "Benchmark the proof-of-work hash rate",
+	Long:  `Seal throwaway blocks for a fixed duration with each of the given thread counts and report the hash rate and the expected block time at the difficulty. No chain is touched.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		duration, _ := cmd.Flags().GetDuration("duration")
+		threadCounts, _ := cmd.Flags().GetIntSlice("threads")
+		difficulty, _ := cmd.Flags().GetUint64("difficulty")
+		if difficulty == 0 {
+			difficulty = cfg.Mining.Difficulty
+		}
+		if len(threadCounts) == 0 {
+			threadCounts = []int{1, runtime.NumCPU()}
+		}
+		if difficulty == 0 || difficulty > consensus.MaximumDifficulty {
+			fmt.Fprintf(os.Stderr, "Invalid difficulty: %d\n", difficulty)
+			os.Exit(1)
+		}
+
+		pow := consensus.NewProofOfWork(new(big.Int).SetUint64(difficulty))
+		fmt.Printf("Benchmarking proof-of-work at difficulty %d for %v per run\n\n", difficulty, duration)
+		fmt.Printf("%-8s %-14s %-16s %-8s %s\n", "Threads", "Hashes", "Hash rate", "Blocks", "Expected block time")
+		for _, threads := range threadCounts {
+			result := pow.Benchmark(threads, duration)
+			fmt.Printf("%-8d %-14d %-16s %-8d %v\n", result.Threads, result.Hashes,
+				fmt.Sprintf("%.2f H/s", result.HashRate()), result.Blocks, result.BlockTime(difficulty))
+		}
+	},
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup <dir>",
+	Short: "Back up the database",
+	Long:  `Write a consistent copy of the database to a new directory. With --online the running node takes the backup in the background through the lumina_backup admin RPC method, otherwise the database of the stopped node is opened read-only. The copy is a data directory for the same db.type.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := args[0]
+		online, _ := cmd.Flags().GetBool("online")
+		endpoint, _ := cmd.Flags().GetString("rpc")
+
+		if online || endpoint != "" {
+			if err := callRPC(rpcURL(endpoint), "lumina_backup", []interface{}{dir}, nil); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to start backup: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Backup to %s started, see the node log for its completion\n", dir)
+			return
+		}
+
+		db, err := storage.Open(cfg.DB.Type, cfg.DB.Path, &storage.Options{
+			CacheSize:    cfg.DB.CacheSize,
+			MaxOpenFiles: cfg.DB.MaxOpenFiles,
+			WriteBuffer:  cfg.DB.WriteBuffer,
+			ReadOnly:     true,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		snap, err := db.NewSnapshot()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to snapshot database: %v\n", err)
+			os.Exit(1)
+		}
+		defer snap.Release()
+
+		start := time.Now()
+		count, err := storage.Backup(context.Background(), snap, cfg.DB.Type, dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Backup failed: %v\n", err)
+			os.Exit(1)
+		}
+		if _, err := os.Stat(storage.FreezerDir(cfg.DB.Path)); err == nil {
+			freezer, err := storage.NewFreezer(storage.FreezerDir(cfg.DB.Path), storage.FreezerTables, true)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to open freezer: %v\n", err)
+				os.Exit(1)
+			}
+			defer freezer.Close()
+			if err := freezer.Backup(storage.FreezerDir(dir)); err != nil {
+				fmt.Fprintf(os.Stderr, "Backup failed: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		fmt.Printf("Backed up %d entries to %s in %v\n", count, dir, time.Since(start).Round(time.Millisecond))
+	},
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Inspect and maintain the database",
+	Long:  `Maintenance commands operating on the database of the data directory. The node must not be running.`,
+}
+
+var dbInspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "Show the entries and size of each table",
+	Long:  `Count the entries of every table of the database and their size in keys and values. The database is opened read-only and walked completely, which takes a while on large databases.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		db, freezer, err := openDataDir(true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		usage, err := storage.NewTables(db).Usage()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to inspect database: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%-12s %-16s %-12s %s\n", "Table", "Prefix", "Entries", "Size")
+		var entries int
+		var size int64
+		for _, table := range usage {
+			fmt.Printf("%-12s %-16q %-12d %s\n", table.Name, table.Prefix, table.Entries, formatSize(table.Size))
+			entries += table.Entries
+			size += table.Size
+		}
+		fmt.Printf("%-12s %-16s %-12d %s\n", "Total", "", entries, formatSize(size))
+		if freezer != nil {
+			fmt.Printf("\nFreezer: %d blocks in %s\n", freezer.Items(), storage.FreezerDir(cfg.DB.Path))
+		}
+	},
+}
+
+var dbCompactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Compact the database",
+	Long:  `Compact the whole database, reclaiming the disk space of deleted and overwritten entries, for example after pruning state. Compaction rewrites the database files and can take a long time on large databases.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		db, _, err := openDataDir(false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		fmt.Printf("Compacting %s database at %s\n", cfg.DB.Type, cfg.DB.Path)
+		start := time.Now()
+		if err := storage.Compact(db); err != nil {
+			fmt.Fprintf(os.Stderr, "Compaction failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Compacted database in %v\n", time.Since(start).Round(time.Millisecond))
+	},
+}
+
+var dbGetCmd = &cobra.Command{
+	Use:   "get <table> <key>",
+	Short: "Print an entry of the database",
+	Long:  `Print the value stored under a key of a table, as text if it is printable and as hex otherwise. Keys with 0x prefix are hex, others are text, like the current-block marker of the meta table. The database is opened read-only.`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		asHex, _ := cmd.Flags().GetBool("hex")
+
+		db, _, err := openDataDir(true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		table, key, err := tableKey(db, args[0], args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		value, err := table.Get(key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get %s from %s: %v\n", args[1], args[0], err)
+			os.Exit(1)
+		}
+		if asHex {
+			fmt.Println(crypto.Encode(value))
+		} else {
+			fmt.Println(formatValue(value))
+		}
+	},
+}
+
+var dbDeleteCmd = &cobra.Command{
+	Use:   "delete <table> <key>",
+	Short: "Delete an entry of the database",
+	Long:  `Delete the entry stored under a key of a table, with keys given like for db get. Deleting entries can leave the chain inconsistent, back up the database first. Without --force only the entry that would be deleted is shown.`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		force, _ := cmd.Flags().GetBool("force")
+
+		db, _, err := openDataDir(!force)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		table, key, err := tableKey(db, args[0], args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		value, err := table.Get(key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get %s from %s: %v\n", args[1], args[0], err)
+			os.Exit(1)
+		}
+		if !force {
+			fmt.Printf("Would delete %s from %s (%s), run again with --force to delete it\n", args[1], args[0], formatSize(int64(len(value))))
+			return
+		}
+		if err := table.Delete(key); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to delete %s from %s: %v\n", args[1], args[0], err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted %s from %s (%s)\n", args[1], args[0], formatSize(int64(len(value))))
+	},
+}
+
 func init() {
 	// Send command flags
-	sendCmd.Flags().StringP("from", "f", "", "Sender address")
-	sendCmd.Flags().StringP("to", "t", "", "Recipient address")
+	getBalanceCmd.Flags().String("rpc", "", "RPC endpoint of the node (default from rpc.host and rpc.port)")
+	getBalanceCmd.Flags().String("unit", "ether", "Unit of the balance: wei, gwei or ether")
+
+	createWalletCmd.Flags().String("keystore", "", "Keystore directory (default wallet.keystore)")
+	createWalletCmd.Flags().String("password", "", "File holding the passphrase (default prompt)")
+	createWalletCmd.Flags().Bool("lightkdf", false, "Derive the key with less memory and CPU, at the cost of security")
+	createWalletCmd.Flags().Bool("mnemonic", false, "Derive the key from a new BIP-39 mnemonic")
+	createWalletCmd.Flags().String("path", crypto.DefaultDerivationPath.String(), "Derivation path of the key with --mnemonic")
+
+	importWalletCmd.Flags().String("keystore", "", "Keystore directory (default wallet.keystore)")
+	importWalletCmd.Flags().String("password", "", "File holding the passphrase of the key file (default prompt)")
+	importWalletCmd.Flags().Bool("lightkdf", false, "Derive the key file key with less memory and CPU, at the cost of security")
+	importWalletCmd.Flags().String("mnemonic-file", "", "File holding the mnemonic (default prompt)")
+	importWalletCmd.Flags().String("seed-passphrase", "", "Optional BIP-39 passphrase protecting the seed")
+	importWalletCmd.Flags().String("path", crypto.DefaultDerivationPath.String(), "Derivation path of the key")
+	importWalletCmd.Flags().Uint32("index", 0, "Account index under m/44'/60'/0'/0, unless --path is given")
+
+	sendCmd.Flags().StringP("from", "f", "", "Sender address, an account of the keystore")
+	sendCmd.Flags().StringP("to", "t", "", "Recipient address, none to deploy a contract")
 	sendCmd.Flags().StringP("amount", "a", "0", "Amount to send")
+	sendCmd.Flags().String("unit", "ether", "Unit of the amount: wei, gwei or ether")
 	sendCmd.Flags().StringP("data", "d", "", "Transaction data (hex)")
-	sendCmd.Flags().Uint64P("gaslimit", "l", 21000, "Gas limit")
-	sendCmd.Flags().Uint64P("gasprice", "p", 1000000000, "Gas price (wei)")
-	
-	sendCmd.MarkFlagRequired("from")
-	sendCmd.MarkFlagRequired("to")
+	sendCmd.Flags().Uint64P("gaslimit", "l", 0, "Gas limit (default estimated by the node)")
+	sendCmd.Flags().Uint64P("gasprice", "p", 0, "Gas price in wei (default suggested by the node)")
+	sendCmd.Flags().String("keystore", "", "Keystore directory (default wallet.keystore)")
+	sendCmd.Flags().String("password", "", "File holding the passphrase of the key file (default prompt)")
+	sendCmd.Flags().String("privatekey", "", "Hex private key to sign with instead of a key file")
+	sendCmd.Flags().String("rpc", "", "RPC endpoint of the node (default from rpc.host and rpc.port)")
+	sendCmd.Flags().Bool("wait", false, "Wait until the transaction is included in a block")
+	sendCmd.Flags().Duration("timeout", 2*time.Minute, "How long to wait with --wait")
+
+	statusCmd.Flags().String("rpc", "", "RPC endpoint of the node (default from rpc.host and rpc.port)")
 
 	// Start node command flags
 	startNodeCmd.Flags().Bool("mining", false, "Enable mining")
 	startNodeCmd.Flags().Bool("rpc", true, "Enable RPC server")
 	startNodeCmd.Flags().Bool("metrics", false, "Enable metrics server")
+	startNodeCmd.Flags().String("mode", "", "Node mode: full, archive or light (default sync.mode)")
+	startNodeCmd.Flags().Bool("dev", false, "Run an in-memory development chain with instant mining and prefunded, unlocked accounts")
+	startNodeCmd.Flags().Uint64("dev.period", 0, "Seconds between development blocks, 0 to mine when transactions arrive (default dev.period)")
+	startNodeCmd.Flags().Int("dev.accounts", 0, "Number of prefunded development accounts (default dev.accounts)")
+	startNodeCmd.Flags().Bool("daemon", false, "Run the node in the background, detached from the terminal, once it is up")
+	startNodeCmd.Flags().String("pidfile", "", "File to write the process ID of the node to while it runs")
+
+	// Dump state command flags
+	dumpStateCmd.Flags().StringP("output", "o", "", "Output file (default stdout)")
+
+	// Export and import command flags
+	exportCmd.Flags().Uint64("from", 0, "First block to export")
+	exportCmd.Flags().Uint64("to", 0, "Last block to export (default the head)")
+	importCmd.Flags().Int("batch-size", core.DefaultImportBatchSize, "Blocks inserted per batch")
+	importCmd.Flags().Int("batch-limit", 0, "Size in MB state commits are written out at (default db.batch_limit)")
+
+	// Benchmark command flags
+	benchmarkCmd.Flags().Duration("duration", 10*time.Second, "Duration of each run")
+	benchmarkCmd.Flags().IntSlice("threads", nil, "Thread counts to benchmark (default 1 and the number of CPUs)")
+	benchmarkCmd.Flags().Uint64("difficulty", 0, "Difficulty in leading zero bits (default mining.difficulty)")
+
+	// Backup command flags
+	backupCmd.Flags().Bool("online", false, "Have the running node take the backup (requires rpc.admin)")
+	backupCmd.Flags().String("rpc", "", "RPC endpoint of the running node, implies --online (default from rpc.host and rpc.port)")
+
+	// Database maintenance command flags
+	dbGetCmd.Flags().Bool("hex", false, "Print the value as hex even if it is printable")
+	dbDeleteCmd.Flags().Bool("force", false, "Delete the entry instead of only showing it")
 }
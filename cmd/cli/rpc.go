@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"blockchain-node/rpc"
+)
+
+// rpcTimeout bounds a request to the node
+const rpcTimeout = 30 * time.Second
+
+// rpcURL returns the RPC endpoint of the node, the one given with --rpc or
+// the configured one
+func rpcURL(endpoint string) string {
+	if endpoint != "" {
+		return endpoint
+	}
+	return fmt.Sprintf("http://%s:%d", cfg.RPC.Host, cfg.RPC.Port)
+}
+
+// callRPC calls a JSON-RPC method of the node at url and decodes the result
+// into result
+func callRPC(url, method string, params []interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: rpcTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("node at %s unreachable: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpc.RPCError   `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("invalid response from %s: %v", url, err)
+	}
+	if response.Error != nil {
+		// Internal errors carry the reason in their data
+		if response.Error.Code == rpc.RPCErrorCodeInternalError && response.Error.Data != "" {
+			return fmt.Errorf("%s failed: %s", method, response.Error.Data)
+		}
+		return fmt.Errorf("%s failed: %s", method, response.Error.Message)
+	}
+	// A null result is left out of the response
+	if result == nil || len(response.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
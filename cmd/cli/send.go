@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"blockchain-node/accounts"
+	"blockchain-node/crypto"
+)
+
+// receiptPollInterval is how often send --wait asks for the receipt
+const receiptPollInterval = time.Second
+
+// receipt is the part of an eth_getTransactionReceipt result send prints
+type receipt struct {
+	BlockNumber     string  `json:"blockNumber"`
+	BlockHash       string  `json:"blockHash"`
+	GasUsed         string  `json:"gasUsed"`
+	Status          string  `json:"status"`
+	ContractAddress *string `json:"contractAddress"`
+}
+
+// senderWallet returns the wallet send signs with: the hex key given with
+// --privatekey, or else the key file of from in the keystore, decrypted
+// with its passphrase
+func senderWallet(privateKey, from, keystore, passwordFile string) (*crypto.Wallet, error) {
+	if privateKey != "" {
+		key, err := crypto.HexToECDSA(privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %v", err)
+		}
+		wallet := crypto.WalletFromPrivateKey(key)
+		if from != "" && crypto.HexToAddress(from) != wallet.Address {
+			return nil, fmt.Errorf("private key is the key of %s, not %s", wallet.Address.Hex(), from)
+		}
+		return wallet, nil
+	}
+
+	if from == "" {
+		return nil, fmt.Errorf("--from or --privatekey is required")
+	}
+	account, err := accounts.NewManager(keystoreDir(keystore)).Find(crypto.HexToAddress(from))
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(account.Path)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := readPassphrase(passwordFile, false)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.DecryptKey(data, passphrase)
+}
+
+// callQuantity calls a JSON-RPC method returning a hex quantity
+func callQuantity(url, method string, params []interface{}) (*big.Int, error) {
+	var result string
+	if err := callRPC(url, method, params, &result); err != nil {
+		return nil, err
+	}
+	value, err := crypto.DecodeBig(result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s result %q: %v", method, result, err)
+	}
+	return value, nil
+}
+
+// waitForReceipt polls the node until the transaction hash is included in
+// a block or timeout passes
+func waitForReceipt(url, hash string, timeout time.Duration) (*receipt, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var result *receipt
+		if err := callRPC(url, "eth_getTransactionReceipt", []interface{}{hash}, &result); err != nil {
+			return nil, err
+		}
+		if result != nil {
+			return result, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("transaction %s not included after %v", hash, timeout)
+		}
+		time.Sleep(receiptPollInterval)
+	}
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"blockchain-node/crypto"
+)
+
+// nodeStats is the part of the lumina_getStats result status prints. The
+// node status fields are missing on nodes that do not report them.
+type nodeStats struct {
+	BlockHeight  uint64 `json:"block_height"`
+	MempoolStats struct {
+		PendingCount int  `json:"pending_count"`
+		QueuedCount  int  `json:"queued_count"`
+		Paused       bool `json:"paused"`
+	} `json:"mempool_stats"`
+	PeerCount *int    `json:"peer_count"`
+	Syncing   *bool   `json:"syncing"`
+	Mining    *bool   `json:"mining"`
+	HashRate  float64 `json:"hash_rate"`
+	Coinbase  string  `json:"coinbase"`
+}
+
+// headBlock is the part of an eth_getBlockByNumber result status prints
+type headBlock struct {
+	Hash      string `json:"hash"`
+	Timestamp string `json:"timestamp"`
+}
+
+// age returns how long ago the block was sealed
+func (b *headBlock) age() time.Duration {
+	timestamp, err := crypto.DecodeUint64(b.Timestamp)
+	if err != nil {
+		return 0
+	}
+	return time.Since(time.Unix(int64(timestamp), 0)).Round(time.Second)
+}
+
+// formatHashRate formats hashes per second with a unit prefix
+func formatHashRate(rate float64) string {
+	units := []string{"H/s", "kH/s", "MH/s", "GH/s", "TH/s"}
+	i := 0
+	for rate >= 1000 && i < len(units)-1 {
+		rate /= 1000
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", rate, units[i])
+}
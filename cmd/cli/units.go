@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// unit is a denomination of amounts
+type unit struct {
+	decimals int // of the amount in wei
+	symbol   string
+}
+
+// units maps the names of units to them
+var units = map[string]unit{
+	"wei":   {0, "wei"},
+	"gwei":  {9, "gwei"},
+	"ether": {18, "ETH"},
+	"eth":   {18, "ETH"},
+}
+
+// lookupUnit returns the unit called name
+func lookupUnit(name string) (unit, error) {
+	u, ok := units[strings.ToLower(name)]
+	if !ok {
+		return unit{}, fmt.Errorf("unknown unit %q, want wei, gwei or ether", name)
+	}
+	return u, nil
+}
+
+// format formats wei as a decimal number of u followed by its symbol,
+// without trailing zeros
+func (u unit) format(wei *big.Int) string {
+	abs := new(big.Int).Abs(wei)
+	base := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(u.decimals)), nil)
+	whole, frac := new(big.Int).QuoRem(abs, base, new(big.Int))
+
+	result := whole.String()
+	if frac.Sign() != 0 {
+		digits := fmt.Sprintf("%0*s", u.decimals, frac.String())
+		result += "." + strings.TrimRight(digits, "0")
+	}
+	if wei.Sign() < 0 {
+		result = "-" + result
+	}
+	return result + " " + u.symbol
+}
+
+// parse parses a decimal amount of u, like 1.5 ether, into wei
+func (u unit) parse(amount string) (*big.Int, error) {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	if len(frac) > u.decimals {
+		return nil, fmt.Errorf("amount %s has more than %d decimals", amount, u.decimals)
+	}
+	digits := whole + frac + strings.Repeat("0", u.decimals-len(frac))
+	wei, ok := new(big.Int).SetString(digits, 10)
+	if !ok || whole+frac == "" || strings.ContainsAny(digits, "+-") {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	return wei, nil
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// stdin reads prompted input, shared so that buffered lines are not lost
+// between prompts
+var stdin = bufio.NewReader(os.Stdin)
+
+// keystoreDir returns the keystore directory given with --keystore or the
+// configured one
+func keystoreDir(dir string) string {
+	if dir != "" {
+		return dir
+	}
+	return cfg.Wallet.Keystore
+}
+
+// readPassphrase returns the first line of file, or prompts for the
+// passphrase, twice if confirm is set
+func readPassphrase(file string, confirm bool) (string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %v", err)
+		}
+		return strings.SplitN(strings.TrimRight(string(data), "\r\n"), "\n", 2)[0], nil
+	}
+
+	passphrase, err := prompt("Passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		again, err := prompt("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
+
+// prompt prints text and reads a line from stdin
+func prompt(text string) (string, error) {
+	fmt.Print(text)
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read input: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
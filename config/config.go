@@ -2,17 +2,28 @@ package config
 
 import (
 	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Network NetworkConfig `mapstructure:"network"`
-	RPC     RPCConfig     `mapstructure:"rpc"`
-	Mining  MiningConfig  `mapstructure:"mining"`
-	DB      DBConfig      `mapstructure:"db"`
-	EVM     EVMConfig     `mapstructure:"evm"`
-	Logging LoggingConfig `mapstructure:"logging"`
-	Metrics MetricsConfig `mapstructure:"metrics"`
+	Network  NetworkConfig  `mapstructure:"network"`
+	RPC      RPCConfig      `mapstructure:"rpc"`
+	Mining   MiningConfig   `mapstructure:"mining"`
+	Stratum  StratumConfig  `mapstructure:"stratum"`
+	Staking  StakingConfig  `mapstructure:"staking"`
+	Emission EmissionConfig `mapstructure:"emission"`
+	DB       DBConfig       `mapstructure:"db"`
+	EVM      EVMConfig      `mapstructure:"evm"`
+	Mempool  MempoolConfig  `mapstructure:"mempool"`
+	Logging  LoggingConfig  `mapstructure:"logging"`
+	Metrics  MetricsConfig  `mapstructure:"metrics"`
+	Sync     SyncConfig     `mapstructure:"sync"`
+	Wallet   WalletConfig   `mapstructure:"wallet"`
+	Dev      DevConfig      `mapstructure:"dev"`
 }
 
 type NetworkConfig struct {
@@ -21,6 +32,10 @@ type NetworkConfig struct {
 	MaxPeers   int      `mapstructure:"max_peers"`
 	ListenAddr string   `mapstructure:"listen_addr"`
 	Timeout    int      `mapstructure:"timeout"`
+
+	// LightServe answers the header and state proof requests of light
+	// nodes, at the cost of some bandwidth and disk reads
+	LightServe bool `mapstructure:"light_serve"`
 }
 
 type RPCConfig struct {
@@ -30,6 +45,14 @@ type RPCConfig struct {
 	CORSOrigins    []string `mapstructure:"cors_origins"`
 	MaxConnections int      `mapstructure:"max_connections"`
 	Timeout        int      `mapstructure:"timeout"`
+
+	// AllowUnprotectedTxs accepts legacy transactions signed without a
+	// chain ID, which can be replayed on other chains
+	AllowUnprotectedTxs bool `mapstructure:"allow_unprotected_txs"`
+
+	// Admin enables the methods that change the mempool, for endpoints
+	// only the node operator can reach
+	Admin bool `mapstructure:"admin"`
 }
 
 type MiningConfig struct {
@@ -37,6 +60,58 @@ type MiningConfig struct {
 	Address    string `mapstructure:"address"`
 	Threads    int    `mapstructure:"threads"`
 	Difficulty uint64 `mapstructure:"difficulty"`
+
+	// BlockTime is the target number of seconds between blocks the
+	// difficulty is retargeted toward, Difficulty being the minimum. Zero
+	// keeps the difficulty fixed.
+	BlockTime uint64 `mapstructure:"block_time"`
+
+	// MinPeers is the number of connected peers below which no blocks are
+	// mined or proposed, so that an isolated node does not build a fork
+	MinPeers int `mapstructure:"min_peers"`
+}
+
+type StratumConfig struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	Port           int    `mapstructure:"port"`
+	Host           string `mapstructure:"host"`
+	MaxConnections int    `mapstructure:"max_connections"`
+
+	// ShareDifficulty is the number of leading zero bits of the seal hash
+	// of a share, lower than the block difficulty so that miners report
+	// their progress
+	ShareDifficulty uint64 `mapstructure:"share_difficulty"`
+}
+
+type StakingConfig struct {
+	// Enabled runs the chain with proof-of-stake instead of proof-of-work,
+	// every node of the network must agree on it and on the validators
+	Enabled bool   `mapstructure:"enabled"`
+	Period  uint64 `mapstructure:"period"` // seconds per slot
+
+	// Validators maps validator addresses to their stake in wei (decimal)
+	Validators map[string]string `mapstructure:"validators"`
+
+	// ValidatorKey is the hex private key this node proposes blocks with,
+	// empty for nodes that only follow the chain
+	ValidatorKey string `mapstructure:"validator_key"`
+
+	// Signer is the URL or IPC socket path of an external signing service
+	// holding the key of ValidatorAddress, used instead of ValidatorKey.
+	// Without either, ValidatorAddress must be an account of the keystore
+	// unlocked with wallet.unlock.
+	Signer           string `mapstructure:"signer"`
+	ValidatorAddress string `mapstructure:"validator_address"`
+	SignerTimeout    int    `mapstructure:"signer_timeout"` // seconds
+}
+
+// EmissionConfig is the block reward schedule of the network, every node
+// must use the same one
+type EmissionConfig struct {
+	InitialReward     string `mapstructure:"initial_reward"`     // wei (decimal)
+	ReductionInterval uint64 `mapstructure:"reduction_interval"` // blocks, 0 keeps the reward constant
+	ReductionPercent  uint64 `mapstructure:"reduction_percent"`  // 50 halves the reward
+	TailReward        string `mapstructure:"tail_reward"`        // wei (decimal), the reward never drops below
 }
 
 type DBConfig struct {
@@ -45,12 +120,90 @@ type DBConfig struct {
 	CacheSize     int    `mapstructure:"cache_size"`
 	MaxOpenFiles  int    `mapstructure:"max_open_files"`
 	WriteBuffer   int    `mapstructure:"write_buffer"`
+
+	// StateRetention is the number of recent states whose tries are kept,
+	// older trie nodes are pruned. Zero keeps every state (archive).
+	StateRetention uint64 `mapstructure:"state_retention"`
+
+	// FreezerCutoff is the number of recent blocks kept in the database,
+	// older finalized blocks and their receipts move to the append-only
+	// freezer in the "ancient" directory under Path. Zero disables the
+	// freezer.
+	FreezerCutoff uint64 `mapstructure:"freezer_cutoff"`
+
+	// FreezerColdStore moves the completed data files of the freezer off
+	// the local disk, to a directory such as a network mount or to
+	// s3://bucket/prefix in the S3-compatible object store at
+	// FreezerColdEndpoint. The object store credentials are taken from the
+	// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+	FreezerColdStore    string `mapstructure:"freezer_cold_store"`
+	FreezerColdEndpoint string `mapstructure:"freezer_cold_endpoint"`
+	FreezerColdRegion   string `mapstructure:"freezer_cold_region"`
+
+	// BatchLimit is the size in MB a state commit batch is written out at,
+	// so that large commits do not pile up in memory. Commits written in
+	// parts are not atomic and are repaired on startup after a crash. Zero
+	// writes every commit at once.
+	BatchLimit int `mapstructure:"batch_limit"`
+
+	// PruneRate is the number of keys background pruning deletes per
+	// second at most, so that it does not starve block imports and RPC
+	// reads. Zero deletes as fast as possible.
+	PruneRate int `mapstructure:"prune_rate"`
+
+	// EncryptionKeyFile encrypts the stored values with AES-GCM under the
+	// hex encoded 32-byte key in this file. EncryptionPassphraseFile derives
+	// the key from the passphrase in this file instead. The keys of the
+	// database and the freezer stay unencrypted. Encryption is chosen when
+	// the database is created and can not be added to existing data.
+	EncryptionKeyFile        string `mapstructure:"encryption_key_file"`
+	EncryptionPassphraseFile string `mapstructure:"encryption_passphrase_file"`
 }
 
 type EVMConfig struct {
 	ChainID       uint64 `mapstructure:"chain_id"`
 	BlockGasLimit uint64 `mapstructure:"block_gas_limit"`
 	MinGasPrice   uint64 `mapstructure:"min_gas_price"`
+
+	// GasLimitTarget is the gas limit blocks move toward by at most 1/1024
+	// of their parent's per block, enforced on every imported block. Zero
+	// lets each node mine toward its own BlockGasLimit instead.
+	GasLimitTarget uint64 `mapstructure:"gas_limit_target"`
+
+	// RecordPreimages stores the preimages of KECCAK256 inputs and of the
+	// state trie keys, for debugging storage layouts
+	RecordPreimages bool `mapstructure:"record_preimages"`
+
+	// CoinbaseMaturity is the number of blocks after which block rewards
+	// can be spent, zero spends them right away
+	CoinbaseMaturity uint64 `mapstructure:"coinbase_maturity"`
+}
+
+type MempoolConfig struct {
+	MaxSize  int `mapstructure:"max_size"`
+	Lifetime int `mapstructure:"lifetime"` // seconds a transaction may stay pooled, 0 keeps it until mined
+
+	// PriceBump is the minimum increase of the fee cap and the tip, in
+	// percent, for a transaction to replace a pooled one with the same
+	// sender and nonce
+	PriceBump uint64 `mapstructure:"price_bump"`
+
+	// MaxBytes limits the total encoded size of the pooled transactions
+	// and AccountSlots the number of transactions of a single sender, zero
+	// disables either limit
+	MaxBytes     int `mapstructure:"max_bytes"`
+	AccountSlots int `mapstructure:"account_slots"`
+
+	// RebroadcastBlocks is the number of blocks after which unmined local
+	// transactions are announced to peers again, zero disables it
+	RebroadcastBlocks uint64 `mapstructure:"rebroadcast_blocks"`
+
+	// Journal is the file in the data directory the transactions of local
+	// senders are written to, so that they are pooled again after a
+	// restart or a crash. Empty disables it. Rejournal is the number of
+	// seconds between rewrites dropping mined transactions from the file.
+	Journal   string `mapstructure:"journal"`
+	Rejournal int    `mapstructure:"rejournal"`
 }
 
 type LoggingConfig struct {
@@ -67,12 +220,70 @@ type MetricsConfig struct {
 	Path       string `mapstructure:"path"`
 }
 
+// Node modes, see SyncConfig.Mode
+const (
+	ModeFull    = "full"
+	ModeArchive = "archive"
+	ModeLight   = "light"
+)
+
+type SyncConfig struct {
+	// Mode selects what the node keeps. A full node keeps all blocks and
+	// the recent states (db.state_retention), an archive node keeps every
+	// state and indexes every transaction, and a light node keeps only
+	// headers and fetches the accounts it is asked for from peers serving
+	// light nodes (network.light_serve).
+	Mode string `mapstructure:"mode"`
+
+	// TxIndexDepth is the number of recent blocks whose transactions can
+	// be looked up by hash, older transactions are removed from the index.
+	// Zero indexes every transaction.
+	TxIndexDepth uint64 `mapstructure:"tx_index_depth"`
+
+	// Checkpoints maps block numbers (decimal) to the block hash the
+	// canonical chain must contain at that height
+	Checkpoints map[string]string `mapstructure:"checkpoints"`
+
+	// SafeDepth and FinalizedDepth are the number of confirmations after
+	// which a block is reported as "safe" and "finalized". Finalized
+	// blocks are never reorganized away.
+	SafeDepth      uint64 `mapstructure:"safe_depth"`
+	FinalizedDepth uint64 `mapstructure:"finalized_depth"`
+}
+
+type WalletConfig struct {
+	// Keystore is the directory holding the encrypted key files of local
+	// accounts, in the format geth uses
+	Keystore string `mapstructure:"keystore"`
+
+	// Unlock lists the accounts unlocked when the node starts, for signing
+	// blocks and transactions without a passphrase. PasswordFile holds one
+	// passphrase per line in the same order, the last one is used for the
+	// remaining accounts.
+	Unlock       []string `mapstructure:"unlock"`
+	PasswordFile string   `mapstructure:"password_file"`
+}
+
+// DevConfig runs a throwaway development chain, see Config.ApplyDev
+type DevConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Period is the number of seconds between blocks. Zero mines a block
+	// as soon as transactions are pending.
+	Period uint64 `mapstructure:"period"`
+
+	// Accounts is the number of prefunded and unlocked accounts, derived
+	// from the mnemonic Hardhat and Anvil use
+	Accounts int `mapstructure:"accounts"`
+}
+
 func LoadConfig() *Config {
 	// Set default values
 	viper.SetDefault("network.port", 8080)
 	viper.SetDefault("network.max_peers", 50)
 	viper.SetDefault("network.listen_addr", "0.0.0.0")
 	viper.SetDefault("network.timeout", 30)
+	viper.SetDefault("network.light_serve", false)
 	
 	viper.SetDefault("rpc.enabled", true)
 	viper.SetDefault("rpc.port", 8545)
@@ -80,20 +291,57 @@ func LoadConfig() *Config {
 	viper.SetDefault("rpc.cors_origins", []string{"*"})
 	viper.SetDefault("rpc.max_connections", 100)
 	viper.SetDefault("rpc.timeout", 30)
+	viper.SetDefault("rpc.allow_unprotected_txs", false)
+	viper.SetDefault("rpc.admin", false)
 	
 	viper.SetDefault("mining.enabled", false)
 	viper.SetDefault("mining.threads", 1)
 	viper.SetDefault("mining.difficulty", 4)
+	viper.SetDefault("mining.block_time", 15)
+	viper.SetDefault("mining.min_peers", 0)
+	
+	viper.SetDefault("stratum.enabled", false)
+	viper.SetDefault("stratum.port", 3333)
+	viper.SetDefault("stratum.host", "0.0.0.0")
+	viper.SetDefault("stratum.max_connections", 100)
+	viper.SetDefault("stratum.share_difficulty", 1)
+	
+	viper.SetDefault("staking.enabled", false)
+	viper.SetDefault("staking.period", 5)
+	viper.SetDefault("staking.signer_timeout", 5)
+	
+	viper.SetDefault("emission.initial_reward", "2000000000000000000")
+	viper.SetDefault("emission.reduction_interval", 0)
+	viper.SetDefault("emission.reduction_percent", 50)
+	viper.SetDefault("emission.tail_reward", "0")
 	
 	viper.SetDefault("db.path", "./data")
 	viper.SetDefault("db.type", "leveldb")
 	viper.SetDefault("db.cache_size", 64)
 	viper.SetDefault("db.max_open_files", 1000)
 	viper.SetDefault("db.write_buffer", 4)
+	viper.SetDefault("db.state_retention", 128)
+	viper.SetDefault("db.freezer_cutoff", 0)
+	viper.SetDefault("db.freezer_cold_endpoint", "https://s3.amazonaws.com")
+	viper.SetDefault("db.freezer_cold_region", "us-east-1")
+	viper.SetDefault("db.batch_limit", 0)
+	viper.SetDefault("db.prune_rate", 10000)
 	
 	viper.SetDefault("evm.chain_id", 1337)
 	viper.SetDefault("evm.block_gas_limit", 8000000)
 	viper.SetDefault("evm.min_gas_price", 1000000000)
+	viper.SetDefault("evm.record_preimages", false)
+	viper.SetDefault("evm.coinbase_maturity", 100)
+	viper.SetDefault("evm.gas_limit_target", 0)
+	
+	viper.SetDefault("mempool.max_size", 1000)
+	viper.SetDefault("mempool.price_bump", 10)
+	viper.SetDefault("mempool.lifetime", 10800)
+	viper.SetDefault("mempool.max_bytes", 16*1024*1024)
+	viper.SetDefault("mempool.account_slots", 64)
+	viper.SetDefault("mempool.rebroadcast_blocks", 10)
+	viper.SetDefault("mempool.journal", "transactions.rlp")
+	viper.SetDefault("mempool.rejournal", 3600)
 	
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.output", "console")
@@ -105,6 +353,18 @@ func LoadConfig() *Config {
 	viper.SetDefault("metrics.port", 8080)
 	viper.SetDefault("metrics.path", "/metrics")
 
+	viper.SetDefault("sync.mode", ModeFull)
+	viper.SetDefault("sync.tx_index_depth", 0)
+	viper.SetDefault("sync.safe_depth", 6)
+	viper.SetDefault("sync.finalized_depth", 64)
+
+	viper.SetDefault("wallet.keystore", "./keystore")
+	viper.SetDefault("wallet.unlock", []string{})
+
+	viper.SetDefault("dev.enabled", false)
+	viper.SetDefault("dev.period", 0)
+	viper.SetDefault("dev.accounts", 10)
+
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
 		panic(err)
@@ -113,6 +373,54 @@ func LoadConfig() *Config {
 	return &config
 }
 
+// ReloadConfig reads the config file again, on top of the defaults set by
+// LoadConfig
+func ReloadConfig() (*Config, error) {
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	var config Config
+	if err := viper.Unmarshal(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	return &config, nil
+}
+
+// ApplyMode adjusts the settings the sync mode overrides: an archive node
+// keeps every state and indexes every transaction
+func (c *Config) ApplyMode() {
+	if c.Sync.Mode == ModeArchive {
+		c.DB.StateRetention = 0
+		c.Sync.TxIndexDepth = 0
+	}
+}
+
+// ApplyDev adjusts the settings of a development chain: the chain lives in
+// memory and keeps every state, blocks are mined at the lowest difficulty
+// without waiting for peers or for rewards to mature, and the node connects
+// to no other node. The accounts are set up by the node.
+func (c *Config) ApplyDev() {
+	if !c.Dev.Enabled {
+		return
+	}
+	c.DB.Type = "memory"
+	c.DB.FreezerCutoff = 0
+	c.DB.FreezerColdStore = ""
+	c.DB.EncryptionKeyFile = ""
+	c.DB.EncryptionPassphraseFile = ""
+	c.Sync.Mode = ModeArchive
+	c.Network.SeedNodes = nil
+	c.Network.LightServe = false
+	c.Mining.Enabled = true
+	c.Mining.Difficulty = 1
+	c.Mining.BlockTime = 0
+	c.Mining.MinPeers = 0
+	c.Staking = StakingConfig{}
+	c.Stratum.Enabled = false
+	c.EVM.CoinbaseMaturity = 0
+	c.Wallet.Unlock = nil
+}
+
 // Validate validates the configuration
 func (c *Config) Validate() error {
 	if c.Network.Port <= 0 || c.Network.Port > 65535 {
@@ -123,13 +431,105 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid RPC port: %d", c.RPC.Port)
 	}
 	
+	if c.Stratum.Enabled && (c.Stratum.Port <= 0 || c.Stratum.Port > 65535) {
+		return fmt.Errorf("invalid stratum port: %d", c.Stratum.Port)
+	}
+	
+	if c.Staking.Enabled {
+		if c.Staking.Period == 0 {
+			return fmt.Errorf("staking period cannot be zero")
+		}
+		if len(c.Staking.Validators) == 0 {
+			return fmt.Errorf("staking requires at least one validator")
+		}
+		for addr, stake := range c.Staking.Validators {
+			if len(strings.TrimPrefix(addr, "0x")) != 40 {
+				return fmt.Errorf("invalid validator address: %s", addr)
+			}
+			if amount, ok := new(big.Int).SetString(stake, 10); !ok || amount.Sign() <= 0 {
+				return fmt.Errorf("invalid stake for validator %s: %s", addr, stake)
+			}
+		}
+		if c.Staking.Signer != "" {
+			if c.Staking.ValidatorKey != "" {
+				return fmt.Errorf("validator key and remote signer cannot both be set")
+			}
+			if len(strings.TrimPrefix(c.Staking.ValidatorAddress, "0x")) != 40 {
+				return fmt.Errorf("remote signer requires a validator address: %q", c.Staking.ValidatorAddress)
+			}
+		}
+		if c.Mining.Enabled || c.Stratum.Enabled {
+			return fmt.Errorf("mining and stratum cannot be enabled with staking")
+		}
+	}
+	
+	for name, amount := range map[string]string{
+		"initial reward": c.Emission.InitialReward,
+		"tail reward":    c.Emission.TailReward,
+	} {
+		if value, ok := new(big.Int).SetString(amount, 10); !ok || value.Sign() < 0 {
+			return fmt.Errorf("invalid emission %s: %q", name, amount)
+		}
+	}
+	if c.Emission.ReductionPercent > 100 {
+		return fmt.Errorf("emission reduction percent above 100: %d", c.Emission.ReductionPercent)
+	}
+	
+	switch c.DB.Type {
+	case "leveldb", "pebble", "badger", "memory":
+	default:
+		return fmt.Errorf("invalid database type %q, want leveldb, pebble, badger or memory", c.DB.Type)
+	}
+	if c.DB.FreezerColdStore != "" && c.DB.FreezerCutoff == 0 {
+		return fmt.Errorf("freezer cold store requires a freezer cutoff")
+	}
+	if c.DB.EncryptionKeyFile != "" && c.DB.EncryptionPassphraseFile != "" {
+		return fmt.Errorf("database encryption key file and passphrase file cannot both be set")
+	}
+	
 	if c.Mining.Threads <= 0 {
 		return fmt.Errorf("mining threads must be positive: %d", c.Mining.Threads)
 	}
+	if c.Dev.Accounts < 0 {
+		return fmt.Errorf("dev accounts cannot be negative: %d", c.Dev.Accounts)
+	}
+	
+	if c.EVM.GasLimitTarget > 0 && c.EVM.GasLimitTarget < 5000 {
+		return fmt.Errorf("gas limit target below the minimum gas limit: %d", c.EVM.GasLimitTarget)
+	}
 	
 	if c.EVM.ChainID == 0 {
 		return fmt.Errorf("chain ID cannot be zero")
 	}
+
+	for number, hash := range c.Sync.Checkpoints {
+		if _, err := strconv.ParseUint(number, 10, 64); err != nil {
+			return fmt.Errorf("invalid checkpoint block number: %s", number)
+		}
+		if len(strings.TrimPrefix(hash, "0x")) != 64 {
+			return fmt.Errorf("invalid checkpoint hash for block %s: %s", number, hash)
+		}
+	}
+
+	if c.Sync.FinalizedDepth > 0 && c.Sync.SafeDepth > c.Sync.FinalizedDepth {
+		return fmt.Errorf("safe depth %d exceeds finalized depth %d", c.Sync.SafeDepth, c.Sync.FinalizedDepth)
+	}
+
+	switch c.Sync.Mode {
+	case ModeFull, ModeArchive:
+	case ModeLight:
+		if c.Mining.Enabled || c.Stratum.Enabled {
+			return fmt.Errorf("a light node cannot mine or run stratum")
+		}
+		if c.Staking.ValidatorKey != "" || c.Staking.ValidatorAddress != "" || c.Staking.Signer != "" {
+			return fmt.Errorf("a light node cannot be a validator")
+		}
+		if c.Network.LightServe {
+			return fmt.Errorf("a light node cannot serve light nodes")
+		}
+	default:
+		return fmt.Errorf("invalid sync mode %q, want full, archive or light", c.Sync.Mode)
+	}
 	
 	return nil
 }
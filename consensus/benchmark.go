@@ -0,0 +1,95 @@
+package consensus
+
+import (
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+)
+
+// BenchmarkResult is the outcome of sealing throwaway blocks for a while
+type BenchmarkResult struct {
+	Threads  int
+	Duration time.Duration
+	Hashes   uint64 // seal hashes computed
+	Blocks   uint64 // seals found at the engine difficulty
+}
+
+// HashRate returns the number of seal hashes per second
+func (r *BenchmarkResult) HashRate() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Hashes) / r.Duration.Seconds()
+}
+
+// BlockTime returns the expected time to seal a block at difficulty with
+// the measured hash rate, 0 if nothing was hashed
+func (r *BenchmarkResult) BlockTime(difficulty uint64) time.Duration {
+	rate := r.HashRate()
+	if rate == 0 {
+		return 0
+	}
+	hashes := new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), uint(difficulty)))
+	seconds, _ := new(big.Float).Quo(hashes, big.NewFloat(rate)).Float64()
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// Benchmark seals throwaway blocks at the engine difficulty with the given
+// number of threads for duration, without touching any chain. Each thread
+// grinds nonces on its own header and starts a new one after every seal.
+func (pow *ProofOfWork) Benchmark(threads int, duration time.Duration) *BenchmarkResult {
+	if threads < 1 {
+		threads = 1
+	}
+
+	var (
+		hashes, blocks uint64
+		stop           int32
+		wg             sync.WaitGroup
+	)
+	start := time.Now()
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func(thread int) {
+			defer wg.Done()
+
+			header := &core.BlockHeader{
+				Number:     big.NewInt(int64(thread)),
+				Timestamp:  uint64(start.Unix()),
+				Difficulty: pow.difficulty,
+			}
+			sealData := pow.SealData(header)
+			target := pow.Target(header)
+
+			count := uint64(0)
+			for nonce := uint64(0); ; nonce++ {
+				hash := SealHash(sealData, nonce)
+				count++
+				if new(big.Int).SetBytes(hash[:]).Cmp(target) < 0 {
+					atomic.AddUint64(&blocks, 1)
+					header.ExtraData = crypto.Keccak256(sealData)
+					sealData = pow.SealData(header)
+				}
+				if nonce%abortCheckInterval == 0 && atomic.LoadInt32(&stop) != 0 {
+					break
+				}
+			}
+			atomic.AddUint64(&hashes, count)
+		}(i)
+	}
+
+	time.Sleep(duration)
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+
+	return &BenchmarkResult{
+		Threads:  threads,
+		Duration: time.Since(start),
+		Hashes:   hashes,
+		Blocks:   blocks,
+	}
+}
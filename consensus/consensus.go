@@ -0,0 +1,120 @@
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"blockchain-node/core"
+)
+
+// Header validation limits
+const (
+	AllowedFutureBlockTime = 15 * time.Second   // Max time from current time allowed for blocks
+	MaximumExtraDataSize   = 32                 // Maximum size extra data may be after genesis
+	GasLimitBoundDivisor   = 1024               // Bound divisor of the gas limit change per block
+	MinGasLimit            = 5000               // Minimum the gas limit may ever be
+	MaxGasLimit            = 0x7fffffffffffffff // Maximum the gas limit may ever be
+	MaximumDifficulty      = 255                // Maximum difficulty in leading zero bits of the seal hash
+	MaxUncles              = core.MaxUncles     // Maximum number of uncles per block
+	MaxUncleDepth          = core.MaxUncleDepth // Maximum generations between a block and the parent of its uncles
+)
+
+var (
+	ErrUnknownAncestor   = errors.New("unknown ancestor")
+	ErrFutureBlock       = core.ErrFutureBlock // shared so the blockchain can tell transient failures apart
+	ErrInvalidNumber     = errors.New("invalid block number")
+	ErrInvalidTimestamp  = errors.New("invalid timestamp")
+	ErrInvalidDifficulty = errors.New("invalid difficulty")
+	ErrInvalidGasLimit   = errors.New("invalid gas limit")
+	ErrInvalidGasUsed    = errors.New("invalid gas used")
+	ErrExtraDataTooLong  = errors.New("extra data too long")
+	ErrInvalidPoW        = errors.New("invalid proof-of-work")
+	ErrTooManyUncles     = errors.New("too many uncles")
+	ErrDuplicateUncle    = errors.New("duplicate uncle")
+	ErrUncleIsAncestor   = errors.New("uncle is ancestor")
+	ErrDanglingUncle     = errors.New("uncle's parent is not ancestor")
+)
+
+// Engine is an algorithm agnostic consensus engine
+type Engine interface {
+	// VerifyHeader checks whether a header conforms to the consensus rules
+	VerifyHeader(chain core.ChainReader, header *core.BlockHeader) error
+
+	// VerifySeal checks whether the seal of a header is valid
+	VerifySeal(chain core.ChainReader, header *core.BlockHeader) error
+
+	// VerifyUncles checks whether the uncles of a block conform to the
+	// consensus rules
+	VerifyUncles(chain core.ChainReader, block *core.Block) error
+
+	// Prepare initializes the consensus fields of a header for sealing
+	Prepare(chain core.ChainReader, header *core.BlockHeader) error
+
+	// Finalize applies post-transaction state modifications (e.g. block
+	// rewards) to the state of a block
+	Finalize(chain core.ChainReader, header *core.BlockHeader, state *core.StateDB, txs []*core.Transaction, uncles []*core.BlockHeader) error
+}
+
+// VerifyGasLimit checks that the gas limit of a header stays within the
+// allowed bounds relative to its parent
+func VerifyGasLimit(parentGasLimit, headerGasLimit uint64) error {
+	if headerGasLimit > MaxGasLimit {
+		return fmt.Errorf("%w: have %d, max %d", ErrInvalidGasLimit, headerGasLimit, uint64(MaxGasLimit))
+	}
+	if headerGasLimit < MinGasLimit {
+		return fmt.Errorf("%w: have %d, min %d", ErrInvalidGasLimit, headerGasLimit, uint64(MinGasLimit))
+	}
+
+	diff := int64(parentGasLimit) - int64(headerGasLimit)
+	if diff < 0 {
+		diff *= -1
+	}
+	limit := parentGasLimit / GasLimitBoundDivisor
+	if uint64(diff) >= limit && diff != 0 {
+		return fmt.Errorf("%w: have %d, want %d +-= %d", ErrInvalidGasLimit, headerGasLimit, parentGasLimit, limit-1)
+	}
+	return nil
+}
+
+// verifyGasLimit checks the gas limit of a header against the bounds of its
+// parent and, if the chain has a gas limit target, that it is the step of
+// CalcGasLimit toward the target
+func verifyGasLimit(chain core.ChainReader, parent, header *core.BlockHeader) error {
+	if err := VerifyGasLimit(parent.GasLimit, header.GasLimit); err != nil {
+		return err
+	}
+	if config := chain.Config(); config != nil && config.GasLimitTarget > 0 {
+		if want := CalcGasLimit(parent.GasLimit, config.GasLimitTarget); header.GasLimit != want {
+			return fmt.Errorf("%w: have %d, want %d toward target %d", ErrInvalidGasLimit, header.GasLimit, want, config.GasLimitTarget)
+		}
+	}
+	return nil
+}
+
+// CalcGasLimit returns the gas limit of a block whose parent has
+// parentGasLimit, moving toward target by as much as VerifyGasLimit allows
+func CalcGasLimit(parentGasLimit, target uint64) uint64 {
+	if target < MinGasLimit {
+		target = MinGasLimit
+	}
+	if target > MaxGasLimit {
+		target = MaxGasLimit
+	}
+	delta := parentGasLimit/GasLimitBoundDivisor - 1
+
+	limit := parentGasLimit
+	switch {
+	case limit < target:
+		limit += delta
+		if limit > target {
+			limit = target
+		}
+	case limit > target:
+		limit -= delta
+		if limit < target {
+			limit = target
+		}
+	}
+	return limit
+}
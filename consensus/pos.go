@@ -0,0 +1,403 @@
+package consensus
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+)
+
+// StakingAddress is the system account whose storage tracks the validator
+// set of proof-of-stake chains
+var StakingAddress = crypto.HexToAddress("0x0000000000000000000000000000000000001000")
+
+const (
+	extraVanity = 32 // Bytes of extra data the proposer may fill freely
+	extraSeal   = 65 // Bytes of proposer signature at the end of the extra data
+)
+
+var (
+	ErrMissingSignature     = errors.New("extra data missing proposer signature")
+	ErrUnauthorizedProposer = errors.New("unauthorized proposer")
+	ErrWrongProposer        = errors.New("wrong proposer for slot")
+	ErrInvalidSlot          = errors.New("timestamp not at a slot boundary")
+	ErrInvalidEvidence      = errors.New("invalid slashing evidence")
+	ErrNoValidators         = errors.New("no active validators")
+)
+
+// StakeReader reads the validator set tracked in the state, both the head
+// state of a blockchain and the state of a block being processed provide it
+type StakeReader interface {
+	GetStorage(addr crypto.Address, key crypto.Hash) crypto.Hash
+}
+
+// ProofOfStake is a proof-of-stake consensus engine. Time is divided into
+// slots of a fixed period and each slot has a single proposer, picked from
+// the active validators with a probability proportional to their stake.
+// The proposer signs the block, and a validator that signs two blocks for
+// the same slot is slashed: blocks include the conflicting header as
+// evidence in their uncle list and the validator is deactivated for good.
+type ProofOfStake struct {
+	config     *core.PoSConfig
+	validators []crypto.Address // configured validators, sorted
+
+	signer crypto.Address
+	signFn SignerFn
+	mu     sync.RWMutex
+}
+
+// SignerFn signs the seal hash of a block with the key of a validator and
+// returns the 65-byte signature
+type SignerFn func(hash crypto.Hash) ([]byte, error)
+
+// KeySigner returns a SignerFn signing with a key held in process
+func KeySigner(key *ecdsa.PrivateKey) SignerFn {
+	return func(hash crypto.Hash) ([]byte, error) {
+		return crypto.Sign(hash.Bytes(), key)
+	}
+}
+
+var _ Engine = (*ProofOfStake)(nil)
+
+// NewProofOfStake creates a proof-of-stake engine for a chain configuration
+func NewProofOfStake(config *core.PoSConfig) *ProofOfStake {
+	validators := make([]crypto.Address, 0, len(config.Validators))
+	for addr := range config.Validators {
+		validators = append(validators, addr)
+	}
+	sort.Slice(validators, func(i, j int) bool {
+		return bytes.Compare(validators[i][:], validators[j][:]) < 0
+	})
+
+	return &ProofOfStake{
+		config:     config,
+		validators: validators,
+	}
+}
+
+// Authorize sets the validator blocks proposed by this node are signed by,
+// signFn may sign in process or forward to an external signer
+func (pos *ProofOfStake) Authorize(signer crypto.Address, signFn SignerFn) {
+	pos.mu.Lock()
+	defer pos.mu.Unlock()
+
+	pos.signer = signer
+	pos.signFn = signFn
+}
+
+// Signer returns the validator address of this node, the zero address
+// without a key
+func (pos *ProofOfStake) Signer() crypto.Address {
+	pos.mu.RLock()
+	defer pos.mu.RUnlock()
+	return pos.signer
+}
+
+// IsValidator reports whether addr is one of the configured validators
+func (pos *ProofOfStake) IsValidator(addr crypto.Address) bool {
+	_, ok := pos.config.Validators[addr]
+	return ok
+}
+
+// IsSlashed reports whether a validator was slashed in the given state
+func (pos *ProofOfStake) IsSlashed(state StakeReader, addr crypto.Address) bool {
+	return state.GetStorage(StakingAddress, slashedKey(addr)) != (crypto.Hash{})
+}
+
+// Proposer returns the validator that proposes the block of a slot, given
+// the state of its parent
+func (pos *ProofOfStake) Proposer(state StakeReader, slot uint64) (crypto.Address, error) {
+	var (
+		active []crypto.Address
+		total  = new(big.Int)
+	)
+	for _, addr := range pos.validators {
+		stake := pos.config.Validators[addr]
+		if stake == nil || stake.Sign() <= 0 || pos.IsSlashed(state, addr) {
+			continue
+		}
+		active = append(active, addr)
+		total.Add(total, stake)
+	}
+	if len(active) == 0 {
+		return crypto.Address{}, ErrNoValidators
+	}
+
+	// Walk the cumulative stakes up to a pseudo-random point of the slot
+	var enc [8]byte
+	for i := range enc {
+		enc[i] = byte(slot >> (56 - 8*i))
+	}
+	seed := crypto.Keccak256Hash([]byte("proposer"), enc[:])
+	point := new(big.Int).Mod(new(big.Int).SetBytes(seed[:]), total)
+	for _, addr := range active {
+		point.Sub(point, pos.config.Validators[addr])
+		if point.Sign() < 0 {
+			return addr, nil
+		}
+	}
+	return active[len(active)-1], nil
+}
+
+// Slot returns the slot of a block timestamp
+func (pos *ProofOfStake) Slot(chain core.ChainReader, timestamp uint64) (uint64, error) {
+	genesis := chain.GetHeaderByNumber(0)
+	if genesis == nil {
+		return 0, ErrUnknownAncestor
+	}
+	if timestamp < genesis.Timestamp || (timestamp-genesis.Timestamp)%pos.period() != 0 {
+		return 0, fmt.Errorf("%w: %d", ErrInvalidSlot, timestamp)
+	}
+	return (timestamp - genesis.Timestamp) / pos.period(), nil
+}
+
+// NextSlot returns the first slot after parent that does not start before
+// the given time, with its start time
+func (pos *ProofOfStake) NextSlot(chain core.ChainReader, parent *core.BlockHeader, now uint64) (uint64, uint64, error) {
+	genesis := chain.GetHeaderByNumber(0)
+	if genesis == nil {
+		return 0, 0, ErrUnknownAncestor
+	}
+	earliest := parent.Timestamp + 1
+	if now > earliest {
+		earliest = now
+	}
+	if earliest < genesis.Timestamp {
+		earliest = genesis.Timestamp
+	}
+	slot := (earliest - genesis.Timestamp + pos.period() - 1) / pos.period()
+	return slot, genesis.Timestamp + slot*pos.period(), nil
+}
+
+// VerifyHeader checks whether a header conforms to the consensus rules
+func (pos *ProofOfStake) VerifyHeader(chain core.ChainReader, header *core.BlockHeader) error {
+	parent := chain.GetHeader(header.PreviousHash)
+	if parent == nil {
+		return ErrUnknownAncestor
+	}
+
+	// Ensure the block number follows the parent
+	expectedNumber := new(big.Int).Add(parent.Number, big.NewInt(1))
+	if header.Number == nil || header.Number.Cmp(expectedNumber) != 0 {
+		return ErrInvalidNumber
+	}
+
+	// Ensure the extra data holds the proposer signature
+	if len(header.ExtraData) < extraSeal {
+		return ErrMissingSignature
+	}
+	if len(header.ExtraData)-extraSeal > MaximumExtraDataSize {
+		return fmt.Errorf("%w: %d > %d", ErrExtraDataTooLong, len(header.ExtraData)-extraSeal, MaximumExtraDataSize)
+	}
+
+	// Ensure the block starts a slot after the parent and not in the future
+	if header.Timestamp > uint64(time.Now().Add(AllowedFutureBlockTime).Unix()) {
+		return ErrFutureBlock
+	}
+	if header.Timestamp <= parent.Timestamp {
+		return fmt.Errorf("%w: %d <= parent %d", ErrInvalidTimestamp, header.Timestamp, parent.Timestamp)
+	}
+	if _, err := pos.Slot(chain, header.Timestamp); err != nil {
+		return err
+	}
+
+	// Every block weighs the same in the fork choice
+	if header.Difficulty == nil || header.Difficulty.Cmp(big.NewInt(1)) != 0 {
+		return fmt.Errorf("%w: have %v, want 1", ErrInvalidDifficulty, header.Difficulty)
+	}
+
+	// Ensure gas limit and gas used are within bounds
+	if err := verifyGasLimit(chain, parent, header); err != nil {
+		return err
+	}
+	if header.GasUsed > header.GasLimit {
+		return fmt.Errorf("%w: have %d, gas limit %d", ErrInvalidGasUsed, header.GasUsed, header.GasLimit)
+	}
+
+	if !pos.IsValidator(header.Coinbase) {
+		return fmt.Errorf("%w: %s", ErrUnauthorizedProposer, header.Coinbase.Hex())
+	}
+	return nil
+}
+
+// VerifySeal checks that a header is signed by its coinbase
+func (pos *ProofOfStake) VerifySeal(chain core.ChainReader, header *core.BlockHeader) error {
+	signer, err := pos.recoverSigner(header)
+	if err != nil {
+		return err
+	}
+	if signer != header.Coinbase {
+		return fmt.Errorf("%w: signed by %s, coinbase %s", ErrUnauthorizedProposer, signer.Hex(), header.Coinbase.Hex())
+	}
+	return nil
+}
+
+// VerifyUncles checks the slashing evidence of a block: each header must be
+// signed by a validator for the slot of one of the recent ancestors the
+// same validator signed, and must differ from that ancestor
+func (pos *ProofOfStake) VerifyUncles(chain core.ChainReader, block *core.Block) error {
+	if len(block.Uncles) == 0 {
+		return nil
+	}
+	if len(block.Uncles) > MaxUncles {
+		return fmt.Errorf("%w: have %d, max %d", ErrTooManyUncles, len(block.Uncles), MaxUncles)
+	}
+
+	ancestors, included := core.UncleAncestry(chain, block.Header.PreviousHash)
+	for _, evidence := range block.Uncles {
+		hash := evidence.Hash()
+		if included[hash] {
+			return fmt.Errorf("%w: %x", ErrDuplicateUncle, hash)
+		}
+		included[hash] = true
+
+		if ancestors[hash] != nil {
+			return fmt.Errorf("%w: %x", ErrUncleIsAncestor, hash)
+		}
+		if !pos.doubleSigned(evidence, ancestors) {
+			return fmt.Errorf("%w: %x", ErrInvalidEvidence, hash)
+		}
+	}
+	return nil
+}
+
+// Prepare makes a header the block of this node for the next slot
+func (pos *ProofOfStake) Prepare(chain core.ChainReader, header *core.BlockHeader) error {
+	parent := chain.GetHeader(header.PreviousHash)
+	if parent == nil {
+		return ErrUnknownAncestor
+	}
+
+	_, timestamp, err := pos.NextSlot(chain, parent, header.Timestamp)
+	if err != nil {
+		return err
+	}
+	header.Timestamp = timestamp
+	header.Difficulty = big.NewInt(1)
+	header.Coinbase = pos.Signer()
+
+	extra := header.ExtraData
+	if len(extra) > extraVanity {
+		extra = extra[:extraVanity]
+	}
+	header.ExtraData = append(append([]byte{}, extra...), make([]byte, extraSeal)...)
+	return nil
+}
+
+// Finalize checks that the coinbase is the proposer of the slot, slashes
+// the validators the block has evidence against and credits the block
+// reward to the coinbase
+func (pos *ProofOfStake) Finalize(chain core.ChainReader, header *core.BlockHeader, state *core.StateDB, txs []*core.Transaction, uncles []*core.BlockHeader) error {
+	slot, err := pos.Slot(chain, header.Timestamp)
+	if err != nil {
+		return err
+	}
+	proposer, err := pos.Proposer(state, slot)
+	if err != nil {
+		return err
+	}
+	if proposer != header.Coinbase {
+		return fmt.Errorf("%w %d: have %s, want %s", ErrWrongProposer, slot, header.Coinbase.Hex(), proposer.Hex())
+	}
+
+	for _, evidence := range uncles {
+		state.SetStorage(StakingAddress, slashedKey(evidence.Coinbase), crypto.BytesToHash([]byte{1}))
+	}
+
+	addBalance(state, header.Coinbase, blockReward(chain, header.Number))
+	return nil
+}
+
+// Seal signs a prepared block as the validator of this node
+func (pos *ProofOfStake) Seal(block *core.Block) error {
+	pos.mu.RLock()
+	signFn := pos.signFn
+	pos.mu.RUnlock()
+	if signFn == nil {
+		return fmt.Errorf("%w: no validator key", ErrUnauthorizedProposer)
+	}
+
+	header := block.Header
+	if len(header.ExtraData) < extraSeal {
+		return ErrMissingSignature
+	}
+	signature, err := signFn(pos.sealHash(header))
+	if err != nil {
+		return fmt.Errorf("failed to sign block: %v", err)
+	}
+	if len(signature) != extraSeal {
+		return fmt.Errorf("failed to sign block: signature of %d bytes", len(signature))
+	}
+	copy(header.ExtraData[len(header.ExtraData)-extraSeal:], signature)
+	block.Hash = block.CalculateHash()
+	return nil
+}
+
+// Evidence returns the candidate headers that a block on top of parent can
+// include as slashing evidence
+func (pos *ProofOfStake) Evidence(chain core.ChainReader, parent crypto.Hash, candidates []*core.BlockHeader) []*core.BlockHeader {
+	ancestors, _ := core.UncleAncestry(chain, parent)
+
+	var evidence []*core.BlockHeader
+	for _, candidate := range candidates {
+		if pos.doubleSigned(candidate, ancestors) {
+			evidence = append(evidence, candidate)
+		}
+	}
+	return evidence
+}
+
+// doubleSigned reports whether evidence is signed by its coinbase for the
+// slot of an ancestor with the same proposer
+func (pos *ProofOfStake) doubleSigned(evidence *core.BlockHeader, ancestors map[crypto.Hash]*core.BlockHeader) bool {
+	signer, err := pos.recoverSigner(evidence)
+	if err != nil || signer != evidence.Coinbase || !pos.IsValidator(signer) {
+		return false
+	}
+	for _, ancestor := range ancestors {
+		if ancestor.Timestamp == evidence.Timestamp && ancestor.Coinbase == signer {
+			return true
+		}
+	}
+	return false
+}
+
+// recoverSigner returns the address that signed a header
+func (pos *ProofOfStake) recoverSigner(header *core.BlockHeader) (crypto.Address, error) {
+	if len(header.ExtraData) < extraSeal {
+		return crypto.Address{}, ErrMissingSignature
+	}
+	signature := header.ExtraData[len(header.ExtraData)-extraSeal:]
+	signer, err := crypto.RecoverAddressFunc(pos.sealHash(header), signature)
+	if err != nil {
+		return crypto.Address{}, fmt.Errorf("%w: %v", ErrUnauthorizedProposer, err)
+	}
+	return signer, nil
+}
+
+// sealHash returns the hash a proposer signs: the Keccak-256 of all header
+// fields except the signature, nonce included
+func (pos *ProofOfStake) sealHash(header *core.BlockHeader) crypto.Hash {
+	extra := header.ExtraData[:len(header.ExtraData)-extraSeal]
+	return SealHash(encodeHeader(header, header.Difficulty, extra), header.Nonce)
+}
+
+// period returns the slot length in seconds
+func (pos *ProofOfStake) period() uint64 {
+	if pos.config.Period == 0 {
+		return 1
+	}
+	return pos.config.Period
+}
+
+// slashedKey returns the staking storage slot marking a validator slashed
+func slashedKey(addr crypto.Address) crypto.Hash {
+	return crypto.Keccak256Hash([]byte("slashed"), addr.Bytes())
+}
@@ -2,21 +2,38 @@
 package consensus
 
 import (
-	"crypto/sha256"
+	"context"
+	"encoding/binary"
 	"fmt"
 	"math/big"
 	"time"
 
 	"blockchain-node/core"
-
-	"github.com/ethereum/go-ethereum/common"
+	"blockchain-node/crypto"
+	"blockchain-node/rlp"
 )
 
+// BlockReward is the reward in wei credited to the coinbase of a sealed block
+// on chains without an emission schedule
+var BlockReward = new(big.Int).Mul(big.NewInt(2), big.NewInt(1e18))
+
+// blockReward returns the reward of block number under the emission
+// schedule of the chain
+func blockReward(chain core.ChainReader, number *big.Int) *big.Int {
+	if config := chain.Config(); config != nil && config.Emission != nil {
+		return config.Emission.Reward(number.Uint64())
+	}
+	return new(big.Int).Set(BlockReward)
+}
+
 // ProofOfWork represents the Proof of Work consensus engine
 type ProofOfWork struct {
-	difficulty *big.Int
+	difficulty *big.Int // minimum difficulty, and the fixed one without retargeting
+	blockTime  uint64   // target seconds between blocks, 0 disables retargeting
 }
 
+var _ Engine = (*ProofOfWork)(nil)
+
 // NewProofOfWork creates a new PoW instance
 func NewProofOfWork(difficulty *big.Int) *ProofOfWork {
 	return &ProofOfWork{
@@ -24,26 +41,37 @@ func NewProofOfWork(difficulty *big.Int) *ProofOfWork {
 	}
 }
 
+// abortCheckInterval is the number of nonces tried between checks whether
+// sealing was cancelled
+const abortCheckInterval = 1024
+
 // Mine mines a block using Proof of Work
 func (pow *ProofOfWork) Mine(block *core.Block) error {
-	fmt.Printf("Mining block with difficulty %s...\n", pow.difficulty.String())
+	return pow.MineContext(context.Background(), block)
+}
+
+// MineContext mines a block like Mine until ctx is cancelled, for example
+// because a new block arrived on top of the parent. It returns the error of
+// ctx in that case, leaving the nonces tried in the header.
+func (pow *ProofOfWork) MineContext(ctx context.Context, block *core.Block) error {
+	fmt.Printf("Mining block with difficulty %s...\n", pow.headerDifficulty(block.Header).String())
 	
 	start := time.Now()
 	nonce := uint64(0)
-	target := pow.calculateTarget()
+	target := pow.calculateTarget(pow.headerDifficulty(block.Header))
 	
 	for {
 		// Update nonce in block header
 		block.Header.Nonce = nonce
 		
 		// Calculate hash
-		hash := pow.calculateHash(block)
+		hash := pow.sealHash(block.Header)
 		hashInt := new(big.Int).SetBytes(hash[:])
 		
 		// Check if hash meets difficulty target
 		if hashInt.Cmp(target) == -1 {
-			// Found valid hash
-			block.Hash = hash
+			// Found valid seal, the block hash commits to the final nonce
+			block.Hash = block.CalculateHash()
 			elapsed := time.Since(start)
 			fmt.Printf("Block mined! Nonce: %d, Hash: %x, Time: %v\n", 
 				nonce, hash, elapsed)
@@ -52,6 +80,12 @@ func (pow *ProofOfWork) Mine(block *core.Block) error {
 		
 		nonce++
 		
+		if nonce%abortCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		
 		// Progress indicator
 		if nonce%100000 == 0 {
 			fmt.Printf("Mining... nonce: %d\n", nonce)
@@ -61,40 +95,242 @@ func (pow *ProofOfWork) Mine(block *core.Block) error {
 
 // ValidateBlock validates a block's proof of work
 func (pow *ProofOfWork) ValidateBlock(block *core.Block) bool {
-	target := pow.calculateTarget()
-	hash := pow.calculateHash(block)
-	hashInt := new(big.Int).SetBytes(hash[:])
-	
-	return hashInt.Cmp(target) == -1
+	return pow.verifySeal(block.Header) == nil
+}
+
+// VerifyHeader checks whether a header conforms to the consensus rules
+func (pow *ProofOfWork) VerifyHeader(chain core.ChainReader, header *core.BlockHeader) error {
+	parent := chain.GetHeader(header.PreviousHash)
+	if parent == nil {
+		return ErrUnknownAncestor
+	}
+
+	// Ensure the block number follows the parent
+	expectedNumber := new(big.Int).Add(parent.Number, big.NewInt(1))
+	if header.Number == nil || header.Number.Cmp(expectedNumber) != 0 {
+		return ErrInvalidNumber
+	}
+
+	// Ensure the extra data stays within bounds
+	if len(header.ExtraData) > MaximumExtraDataSize {
+		return fmt.Errorf("%w: %d > %d", ErrExtraDataTooLong, len(header.ExtraData), MaximumExtraDataSize)
+	}
+
+	// Ensure the timestamp is after the parent and not too far in the future
+	if header.Timestamp > uint64(time.Now().Add(AllowedFutureBlockTime).Unix()) {
+		return ErrFutureBlock
+	}
+	if header.Timestamp <= parent.Timestamp {
+		return fmt.Errorf("%w: %d <= parent %d", ErrInvalidTimestamp, header.Timestamp, parent.Timestamp)
+	}
+
+	// Ensure the difficulty matches the expected value
+	expected := pow.CalcDifficulty(chain, header.Timestamp, parent)
+	if header.Difficulty == nil || header.Difficulty.Cmp(expected) != 0 {
+		return fmt.Errorf("%w: have %v, want %v", ErrInvalidDifficulty, header.Difficulty, expected)
+	}
+
+	// Ensure gas limit and gas used are within bounds
+	if err := verifyGasLimit(chain, parent, header); err != nil {
+		return err
+	}
+	if header.GasUsed > header.GasLimit {
+		return fmt.Errorf("%w: have %d, gas limit %d", ErrInvalidGasUsed, header.GasUsed, header.GasLimit)
+	}
+
+	return nil
+}
+
+// VerifySeal checks whether the proof-of-work of a header satisfies its difficulty
+func (pow *ProofOfWork) VerifySeal(chain core.ChainReader, header *core.BlockHeader) error {
+	return pow.verifySeal(header)
+}
+
+// Prepare sets the difficulty and a valid timestamp on a header before sealing
+func (pow *ProofOfWork) Prepare(chain core.ChainReader, header *core.BlockHeader) error {
+	parent := chain.GetHeader(header.PreviousHash)
+	if parent == nil {
+		return ErrUnknownAncestor
+	}
+
+	if header.Timestamp <= parent.Timestamp {
+		header.Timestamp = parent.Timestamp + 1
+	}
+	header.Difficulty = pow.CalcDifficulty(chain, header.Timestamp, parent)
+	return nil
+}
+
+// VerifyUncles checks that a block includes at most MaxUncles uncles, each
+// a valid sealed header descending from one of the recent ancestors of the
+// block that is neither an ancestor itself nor included before
+func (pow *ProofOfWork) VerifyUncles(chain core.ChainReader, block *core.Block) error {
+	if len(block.Uncles) == 0 {
+		return nil
+	}
+	if len(block.Uncles) > MaxUncles {
+		return fmt.Errorf("%w: have %d, max %d", ErrTooManyUncles, len(block.Uncles), MaxUncles)
+	}
+
+	ancestors, included := core.UncleAncestry(chain, block.Header.PreviousHash)
+	for _, uncle := range block.Uncles {
+		hash := uncle.Hash()
+		if included[hash] {
+			return fmt.Errorf("%w: %x", ErrDuplicateUncle, hash)
+		}
+		included[hash] = true
+
+		if ancestors[hash] != nil {
+			return fmt.Errorf("%w: %x", ErrUncleIsAncestor, hash)
+		}
+		if ancestors[uncle.PreviousHash] == nil || uncle.PreviousHash == block.Header.PreviousHash {
+			return fmt.Errorf("%w: %x", ErrDanglingUncle, hash)
+		}
+		if err := pow.VerifyHeader(chain, uncle); err != nil {
+			return fmt.Errorf("invalid uncle %x: %w", hash, err)
+		}
+		if err := pow.verifySeal(uncle); err != nil {
+			return fmt.Errorf("invalid uncle %x: %w", hash, err)
+		}
+	}
+	return nil
+}
+
+// Finalize credits the block reward of the emission schedule to the
+// coinbase of the header. Each uncle earns its coinbase a reward reduced by
+// an eighth for every generation it is behind the block, and the block a
+// 1/32 bonus.
+func (pow *ProofOfWork) Finalize(chain core.ChainReader, header *core.BlockHeader, state *core.StateDB, txs []*core.Transaction, uncles []*core.BlockHeader) error {
+	base := blockReward(chain, header.Number)
+	reward := new(big.Int).Set(base)
+	for _, uncle := range uncles {
+		uncleReward := new(big.Int).Add(uncle.Number, big.NewInt(8))
+		uncleReward.Sub(uncleReward, header.Number)
+		uncleReward.Mul(uncleReward, base)
+		uncleReward.Div(uncleReward, big.NewInt(8))
+		addBalance(state, uncle.Coinbase, uncleReward)
+
+		reward.Add(reward, new(big.Int).Div(base, big.NewInt(32)))
+	}
+	addBalance(state, header.Coinbase, reward)
+	return nil
+}
+
+// addBalance credits amount to the balance of addr
+func addBalance(state *core.StateDB, addr crypto.Address, amount *big.Int) {
+	balance := state.GetBalance(addr)
+	state.SetBalance(addr, balance.Add(balance, amount))
+}
+
+// CalcDifficulty returns the difficulty a block created at time on top of
+// parent must have. With a target block time the difficulty of the parent
+// rises by one bit when the block follows it in less than half the target
+// time and drops by one bit when it takes more than twice as long, staying
+// between the engine difficulty and MaximumDifficulty.
+func (pow *ProofOfWork) CalcDifficulty(chain core.ChainReader, time uint64, parent *core.BlockHeader) *big.Int {
+	if pow.blockTime == 0 || parent.Difficulty == nil {
+		return new(big.Int).Set(pow.difficulty)
+	}
+
+	difficulty := new(big.Int).Set(parent.Difficulty)
+	elapsed := time - parent.Timestamp
+	switch {
+	case elapsed*2 < pow.blockTime:
+		difficulty.Add(difficulty, big.NewInt(1))
+	case elapsed > pow.blockTime*2:
+		difficulty.Sub(difficulty, big.NewInt(1))
+	}
+
+	if difficulty.Cmp(pow.difficulty) < 0 {
+		difficulty.Set(pow.difficulty)
+	}
+	if ceiling := big.NewInt(MaximumDifficulty); difficulty.Cmp(ceiling) > 0 {
+		difficulty.Set(ceiling)
+	}
+	return difficulty
+}
+
+// verifySeal checks the proof-of-work of a header
+func (pow *ProofOfWork) verifySeal(header *core.BlockHeader) error {
+	difficulty := pow.headerDifficulty(header)
+	if difficulty.Sign() <= 0 || difficulty.Cmp(big.NewInt(256)) > 0 {
+		return ErrInvalidDifficulty
+	}
+
+	hash := pow.sealHash(header)
+	if new(big.Int).SetBytes(hash[:]).Cmp(pow.calculateTarget(difficulty)) >= 0 {
+		return ErrInvalidPoW
+	}
+	return nil
+}
+
+// headerDifficulty returns the difficulty of a header, falling back to the
+// engine difficulty for headers that have not been prepared
+func (pow *ProofOfWork) headerDifficulty(header *core.BlockHeader) *big.Int {
+	if header.Difficulty == nil {
+		return pow.difficulty
+	}
+	return header.Difficulty
 }
 
 // calculateTarget calculates the target value for mining
-func (pow *ProofOfWork) calculateTarget() *big.Int {
+func (pow *ProofOfWork) calculateTarget(difficulty *big.Int) *big.Int {
 	target := big.NewInt(1)
-	target.Lsh(target, uint(256-pow.difficulty.Uint64()))
+	target.Lsh(target, uint(256-difficulty.Uint64()))
 	return target
 }
 
-// calculateHash calculates the hash for a block
-func (pow *ProofOfWork) calculateHash(block *core.Block) common.Hash {
-	// Combine header data for hashing
-	data := append(block.Header.PreviousHash.Bytes(), block.Header.StateRoot.Bytes()...)
-	data = append(data, block.Header.TransactionsRoot.Bytes()...)
-	data = append(data, block.Header.Number.Bytes()...)
-	data = append(data, big.NewInt(int64(block.Header.Timestamp)).Bytes()...)
-	data = append(data, big.NewInt(int64(block.Header.Nonce)).Bytes()...)
-	data = append(data, pow.difficulty.Bytes()...)
-	
-	hash := sha256.Sum256(data)
-	return common.BytesToHash(hash[:])
+// sealHash calculates the proof-of-work hash of a header
+func (pow *ProofOfWork) sealHash(header *core.BlockHeader) crypto.Hash {
+	return SealHash(pow.SealData(header), header.Nonce)
+}
+
+// SealHash calculates the proof-of-work hash of a nonce for the seal data
+// returned by SealData: the Keccak-256 of the seal data followed by the
+// nonce as 8 big-endian bytes
+func SealHash(sealData []byte, nonce uint64) crypto.Hash {
+	var enc [8]byte
+	binary.BigEndian.PutUint64(enc[:], nonce)
+	return crypto.Keccak256Hash(sealData, enc[:])
 }
 
-// SetDifficulty updates the mining difficulty
+// SealData returns the data the proof-of-work of a header commits to: the
+// RLP encoding of all header fields except the nonce
+func (pow *ProofOfWork) SealData(header *core.BlockHeader) []byte {
+	return encodeHeader(header, pow.headerDifficulty(header), header.ExtraData)
+}
+
+// encodeHeader returns the RLP encoding of all header fields except the
+// nonce, with the given difficulty and extra data
+func encodeHeader(header *core.BlockHeader, difficulty *big.Int, extra []byte) []byte {
+	return rlp.EncodeList(header.SealFields(difficulty, extra)...)
+}
+
+// WorkHash identifies the sealing work of a header: the Keccak-256 of its
+// seal data
+func (pow *ProofOfWork) WorkHash(header *core.BlockHeader) crypto.Hash {
+	return crypto.Keccak256Hash(pow.SealData(header))
+}
+
+// Target returns the value the seal hash of a header must stay below
+func (pow *ProofOfWork) Target(header *core.BlockHeader) *big.Int {
+	return pow.calculateTarget(pow.headerDifficulty(header))
+}
+
+// SetDifficulty updates the mining difficulty, the minimum one when
+// retargeting
 func (pow *ProofOfWork) SetDifficulty(difficulty *big.Int) {
 	pow.difficulty = difficulty
 }
 
-// GetDifficulty returns the current difficulty
+// GetDifficulty returns the configured difficulty, the minimum one when
+// retargeting
 func (pow *ProofOfWork) GetDifficulty() *big.Int {
 	return new(big.Int).Set(pow.difficulty)
 }
+
+// SetTargetBlockTime sets the number of seconds between blocks the
+// difficulty is retargeted toward, 0 keeps the difficulty fixed. All nodes
+// of a chain must use the same value.
+func (pow *ProofOfWork) SetTargetBlockTime(seconds uint64) {
+	pow.blockTime = seconds
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"time"
+
+	"blockchain-node/crypto"
+)
+
+// maxBadBlocks is the maximum number of rejected blocks remembered
+const maxBadBlocks = 128
+
+// BadBlock is a block that failed validation or processing
+type BadBlock struct {
+	Block  *Block    `json:"block"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// badBlockCache remembers recently rejected blocks so they are not processed
+// again. It is not safe for concurrent use, the blockchain guards it.
+type badBlockCache struct {
+	blocks map[crypto.Hash]*BadBlock
+	order  []crypto.Hash // insertion order, oldest first
+}
+
+// newBadBlockCache creates an empty bad block cache
+func newBadBlockCache() *badBlockCache {
+	return &badBlockCache{
+		blocks: make(map[crypto.Hash]*BadBlock),
+	}
+}
+
+// add records a rejected block, evicting the oldest entry when full
+func (cache *badBlockCache) add(block *Block, reason error) {
+	if _, exists := cache.blocks[block.Hash]; exists {
+		return
+	}
+
+	if len(cache.order) >= maxBadBlocks {
+		delete(cache.blocks, cache.order[0])
+		cache.order = cache.order[1:]
+	}
+
+	cache.blocks[block.Hash] = &BadBlock{
+		Block:  block,
+		Reason: reason.Error(),
+		Time:   time.Now(),
+	}
+	cache.order = append(cache.order, block.Hash)
+}
+
+// get returns the bad block with the given hash, nil if unknown
+func (cache *badBlockCache) get(hash crypto.Hash) *BadBlock {
+	return cache.blocks[hash]
+}
+
+// list returns all remembered bad blocks, most recent first
+func (cache *badBlockCache) list() []*BadBlock {
+	result := make([]*BadBlock, 0, len(cache.order))
+	for i := len(cache.order) - 1; i >= 0; i-- {
+		result = append(result, cache.blocks[cache.order[i]])
+	}
+	return result
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// BlockIterator walks the canonical chain over a range of block numbers,
+// loading one block at a time from storage. Each block is read under the
+// chain lock, but a reorg between two steps may switch the iterator over to
+// the new canonical chain.
+type BlockIterator struct {
+	bc    *Blockchain
+	next  uint64
+	last  uint64
+	done  bool
+	block *Block
+	err   error
+}
+
+// BlocksInRange returns an iterator over the canonical blocks from..to
+// (inclusive). The end of the range is capped at the current head.
+func (bc *Blockchain) BlocksInRange(from, to uint64) *BlockIterator {
+	it := &BlockIterator{bc: bc, next: from, last: to}
+	if head := bc.GetCurrentBlock(); head != nil && head.Header.Number.Uint64() < to {
+		it.last = head.Header.Number.Uint64()
+	}
+	it.done = from > it.last
+	return it
+}
+
+// Next advances the iterator to the next block. It returns false when the
+// range is exhausted or an error occurred, see Err.
+func (it *BlockIterator) Next() bool {
+	if it.done {
+		return false
+	}
+
+	block, err := it.bc.GetBlockByNumber(new(big.Int).SetUint64(it.next))
+	if err != nil {
+		it.err = fmt.Errorf("failed to read block %d: %w", it.next, err)
+		it.block = nil
+		it.done = true
+		return false
+	}
+	it.block = block
+
+	if it.next == it.last {
+		it.done = true
+	} else {
+		it.next++
+	}
+	return true
+}
+
+// Block returns the current block
+func (it *BlockIterator) Block() *Block {
+	return it.block
+}
+
+// Header returns the header of the current block
+func (it *BlockIterator) Header() *BlockHeader {
+	if it.block == nil {
+		return nil
+	}
+	return it.block.Header
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *BlockIterator) Err() error {
+	return it.err
+}
@@ -2,6 +2,7 @@
 package core
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
@@ -12,33 +13,99 @@ import (
 )
 
 var (
-	ErrBlockNotFound = errors.New("block not found")
-	ErrInvalidBlock  = errors.New("invalid block")
+	ErrBlockNotFound      = errors.New("block not found")
+	ErrInvalidBlock       = errors.New("invalid block")
+	ErrUnknownAncestor    = errors.New("unknown ancestor")
+	ErrCheckpointMismatch = errors.New("block does not match checkpoint")
+	ErrFutureBlock        = errors.New("block in the future")
+	ErrKnownBlock         = errors.New("block already known")
+	ErrKnownBadBlock      = errors.New("known bad block")
+	ErrInvalidStateRoot   = errors.New("invalid state root")
+	ErrInvalidGasUsed     = errors.New("invalid gas used")
+	ErrLegacyDatabase     = errors.New("incompatible database")
 )
 
+// headBlockKey is the key of the hash of the current head block in the
+// meta table
+var headBlockKey = []byte("current-block")
+
 // Blockchain represents the blockchain
 type Blockchain struct {
 	db           storage.Database
+	tables       *storage.Tables
+	config       *ChainConfig
 	currentBlock *Block
 	genesis      *Block
+	finalized    *Block
+	futureBlocks *futureBlockPool
+	badBlocks    *badBlockCache
+	callCache    *callCache
+	engine       ConsensusEngine
+	vm           VMFactory
+	stateDB      *StateDB
+	feed         chainFeed
+	headEvents   []ChainHeadEvent // head changes not sent yet, see sendHeadEvents
+	freezer      *storage.Freezer // nil unless set, see SetFreezer
+	freezeCutoff uint64           // blocks below the head kept in the database
+	txIndexDepth uint64           // recent blocks whose transactions are indexed, 0 indexes all
+
+	uncleCandidates map[crypto.Hash]*BlockHeader // recently imported headers, see UncleCandidates
 	mu           sync.RWMutex
 }
 
 // NewBlockchain creates a new blockchain
 func NewBlockchain(db storage.Database, genesis *Genesis) (*Blockchain, error) {
 	bc := &Blockchain{
-		db: db,
+		db:           db,
+		tables:       storage.NewTables(db),
+		config:       genesis.Config,
+		futureBlocks: newFutureBlockPool(),
+		badBlocks:    newBadBlockCache(),
+		callCache:    newCallCache(),
 	}
 
 	// Try to load existing blockchain
-	if currentBlock, err := bc.loadCurrentBlock(); err == nil {
-		bc.currentBlock = currentBlock
-		if genesisBlock, err := bc.GetBlockByNumber(big.NewInt(0)); err == nil {
-			bc.genesis = genesisBlock
+	if genesisBlock, err := bc.getBlockByNumber(big.NewInt(0)); err == nil {
+		if !genesisBlock.CalculateHash().Equal(genesisBlock.Hash) {
+			if genesisBlock.Header.legacyHash() == genesisBlock.Hash {
+				return nil, fmt.Errorf("%w: database uses the block hashes of an older version, remove it and sync again", ErrLegacyDatabase)
+			}
+			return nil, fmt.Errorf("%w: corrupted genesis block %x", storage.ErrCorrupted, genesisBlock.Hash)
+		}
+		bc.genesis = genesisBlock
+
+		// Recover from imports interrupted by a crash
+		if err := bc.repairChain(); err != nil {
+			return nil, fmt.Errorf("%w: consistency check failed: %v", storage.ErrCorrupted, err)
+		}
+		if err := bc.migrateTd(); err != nil {
+			return nil, fmt.Errorf("failed to migrate total difficulties: %v", err)
 		}
 	} else {
+		// A chain head without a readable genesis block means the block
+		// index is damaged, a new genesis block would hide the chain
+		if exists, _ := bc.tables.Meta.Has(headBlockKey); exists {
+			return nil, fmt.Errorf("%w: chain head present but genesis block unreadable: %v", storage.ErrCorrupted, err)
+		}
+
 		// Create genesis block
-		genesisBlock := NewGenesisBlock(genesis)
+		genesisBlock, err := genesis.ToBlock()
+		if err != nil {
+			return nil, err
+		}
+		if err := bc.writeTd(genesisBlock.Hash, BlockWork(genesisBlock.Header)); err != nil {
+			return nil, fmt.Errorf("failed to store genesis total difficulty: %v", err)
+		}
+		if err := bc.tables.Meta.Put(tdWorkKey, []byte{1}); err != nil {
+			return nil, fmt.Errorf("failed to store genesis total difficulty: %v", err)
+		}
+		if len(genesis.Alloc) > 0 {
+			if err := genesis.commitAlloc(db, genesisBlock); err != nil {
+				return nil, fmt.Errorf("failed to store genesis state: %v", err)
+			}
+		} else if err := bc.writeStateHead(genesisBlock.Hash); err != nil {
+			return nil, fmt.Errorf("failed to store state head: %v", err)
+		}
 		if err := bc.addBlock(genesisBlock); err != nil {
 			return nil, fmt.Errorf("failed to add genesis block: %v", err)
 		}
@@ -46,28 +113,232 @@ func NewBlockchain(db storage.Database, genesis *Genesis) (*Blockchain, error) {
 		bc.currentBlock = genesisBlock
 	}
 
+	bc.loadFinalized()
+
+	// Refuse to run on top of a chain that contradicts a trusted checkpoint
+	if err := bc.verifyCheckpoints(); err != nil {
+		return nil, err
+	}
+
+	// Repair state damaged by an unclean shutdown before it is used
+	if bc.currentBlock.Header.Number.Sign() > 0 {
+		if err := bc.healState(); err != nil {
+			return nil, fmt.Errorf("state recovery failed: %v", err)
+		}
+	}
+	if err := bc.markSnapshot(); err != nil {
+		return nil, err
+	}
+	bc.stateDB = NewStateDB(db, readStateRoot(bc.tables.Meta))
+
 	return bc, nil
 }
 
-// AddBlock adds a new block to the blockchain
+// SetEngine sets the consensus engine used to verify and finalize imported blocks
+func (bc *Blockchain) SetEngine(engine ConsensusEngine) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.engine = engine
+}
+
+// SetVM sets the interpreter used to execute contract code
+func (bc *Blockchain) SetVM(vm VMFactory) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.vm = vm
+}
+
+// AddBlock adds a new block to the blockchain. Blocks whose parent is not
+// known yet are buffered and imported once the parent arrives, in which case
+// an error wrapping ErrUnknownAncestor is returned.
 func (bc *Blockchain) AddBlock(block *Block) error {
+	defer bc.sendHeadEvents()
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
+	// Refuse to re-process blocks that are already known to be invalid
+	if bad := bc.badBlocks.get(block.Hash); bad != nil {
+		return fmt.Errorf("%w %x: %s", ErrKnownBadBlock, block.Hash, bad.Reason)
+	}
+
+	if err := bc.insertBlock(block); err != nil {
+		if errors.Is(err, ErrUnknownAncestor) {
+			if err := verifyIntegrity(block); err != nil {
+				return fmt.Errorf("block validation failed: %w", err)
+			}
+			bc.futureBlocks.add(block)
+		}
+		return err
+	}
+
+	// Retry blocks that were waiting for this one
+	bc.processFutureBlocks(block.Hash)
+	return nil
+}
+
+// insertBlock validates and stores a block. Blocks extending the head are
+// executed right away, side chain blocks are only stored until their total
+// difficulty exceeds the one of the canonical chain.
+func (bc *Blockchain) insertBlock(block *Block) error {
+	if bc.hasBlock(block.Hash) {
+		return ErrKnownBlock
+	}
+
+	// Blocks building on a parent we have not seen yet are buffered
+	parent := bc.getHeader(block.Header.PreviousHash)
+	if parent == nil {
+		return ErrUnknownAncestor
+	}
+	if bad := bc.badBlocks.get(block.Header.PreviousHash); bad != nil {
+		return fmt.Errorf("%w: parent %x: %s", ErrKnownBadBlock, block.Header.PreviousHash, bad.Reason)
+	}
+	parentTd := bc.getTd(block.Header.PreviousHash)
+	if parentTd == nil {
+		return fmt.Errorf("missing total difficulty of parent %x", block.Header.PreviousHash)
+	}
+
 	// Validate block
-	if err := bc.validateBlock(block); err != nil {
-		return fmt.Errorf("block validation failed: %v", err)
+	if err := bc.validateBlock(block, parent); err != nil {
+		bc.reportBadBlock(block, err)
+		return fmt.Errorf("block validation failed: %w", err)
 	}
+	td := new(big.Int).Add(parentTd, BlockWork(block.Header))
 
-	// Add to database
-	if err := bc.addBlock(block); err != nil {
+	if block.Header.PreviousHash.Equal(bc.currentBlock.Hash) {
+		return bc.extendChain(block, td)
+	}
+
+	// Side chain block, keep it around and switch over once it is heavier
+	if err := bc.checkFinality(parent.Number); err != nil {
+		return err
+	}
+	if err := bc.writeBlock(block); err != nil {
+		return fmt.Errorf("failed to add block to database: %v", err)
+	}
+	if err := bc.writeTd(block.Hash, td); err != nil {
+		return fmt.Errorf("failed to store total difficulty: %v", err)
+	}
+	bc.recordUncleCandidate(block.Header)
+	if td.Cmp(bc.getTd(bc.currentBlock.Hash)) > 0 {
+		return bc.reorg(block)
+	}
+	return nil
+}
+
+// extendChain executes a block on top of the current head and makes it the
+// new head
+func (bc *Blockchain) extendChain(block *Block, td *big.Int) error {
+	// Execute the block on a copy of the state so failures leave no trace
+	state := bc.stateDB.Copy()
+	receipts, err := bc.processBlock(block, state)
+	if err != nil {
+		bc.reportBadBlock(block, err)
+		return fmt.Errorf("block processing failed: %v", err)
+	}
+	undo := newStateUndo(bc.stateDB, state)
+
+	// Block data goes first, then the state and finally the head pointers,
+	// see repairChain for how an interrupted write is recovered
+	if err := bc.writeBlock(block); err != nil {
 		return fmt.Errorf("failed to add block to database: %v", err)
 	}
+	if err := bc.writeTd(block.Hash, td); err != nil {
+		return fmt.Errorf("failed to store total difficulty: %v", err)
+	}
+	if err := bc.writeReceipts(block.Hash, receipts); err != nil {
+		return fmt.Errorf("failed to store receipts: %v", err)
+	}
+	if err := bc.writeStateUndo(block.Hash, undo); err != nil {
+		return fmt.Errorf("failed to store state undo: %v", err)
+	}
+	if _, err := state.CommitBlock(block.Hash); err != nil {
+		return fmt.Errorf("failed to commit state: %v", err)
+	}
+	if err := bc.writeCanonicalHash(block); err != nil {
+		return fmt.Errorf("failed to update canonical chain: %v", err)
+	}
+	if err := bc.writeHeadHash(block.Hash); err != nil {
+		return fmt.Errorf("failed to update head: %v", err)
+	}
 
 	bc.currentBlock = block
+	bc.stateDB = state
+	bc.updateFinalized()
+	bc.freeze()
+	bc.unindexTxs()
+	bc.recordUncleCandidate(block.Header)
+	bc.queueHeadEvent(ChainHeadEvent{Head: block, Added: []*Block{block}})
 	return nil
 }
 
+// processFutureBlocks imports buffered blocks descending from parent
+func (bc *Blockchain) processFutureBlocks(parent crypto.Hash) {
+	queue := []crypto.Hash{parent}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+
+		for _, child := range bc.futureBlocks.take(hash) {
+			if err := bc.insertBlock(child); err != nil {
+				continue
+			}
+			queue = append(queue, child.Hash)
+		}
+	}
+}
+
+// reportBadBlock remembers a block that failed validation or processing.
+// Failures that may resolve later (missing parent, early timestamp) are not
+// considered bad.
+func (bc *Blockchain) reportBadBlock(block *Block, reason error) {
+	if errors.Is(reason, ErrUnknownAncestor) || errors.Is(reason, ErrFutureBlock) {
+		return
+	}
+	// A forged hash or body must not poison the cache for the genuine block
+	if verifyIntegrity(block) != nil {
+		return
+	}
+	bc.badBlocks.add(block, reason)
+}
+
+// verifyIntegrity checks that the hash of a block is the hash of its header
+// and that its transactions and uncles are the ones the header commits to.
+// Only such a block stands for the block with its hash: it may be cached as
+// bad, buffered or stored, and hides other blocks claiming the same hash.
+func verifyIntegrity(block *Block) error {
+	if hash := block.CalculateHash(); !hash.Equal(block.Hash) {
+		return fmt.Errorf("invalid block hash: expected %x, got %x", hash, block.Hash)
+	}
+	if root := DeriveTxRoot(block.Transactions); root != block.Header.TransactionsRoot {
+		return fmt.Errorf("%w: have %s, header has %s", ErrInvalidTxRoot, root.Hex(), block.Header.TransactionsRoot.Hex())
+	}
+	if CalcUncleHash(block.Uncles) != block.Header.UncleHash {
+		return ErrInvalidUncleHash
+	}
+	return nil
+}
+
+// GetBadBlocks returns the recently rejected blocks, most recent first
+func (bc *Blockchain) GetBadBlocks() []*BadBlock {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.badBlocks.list()
+}
+
+// IsBadBlock checks whether a block is known to be invalid
+func (bc *Blockchain) IsBadBlock(hash crypto.Hash) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.badBlocks.get(hash) != nil
+}
+
+// GetFutureBlockCount returns the number of blocks waiting for their parent
+func (bc *Blockchain) GetFutureBlockCount() int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.futureBlocks.len()
+}
+
 // GetCurrentBlock returns the current (latest) block
 func (bc *Blockchain) GetCurrentBlock() *Block {
 	bc.mu.RLock()
@@ -79,8 +350,19 @@ func (bc *Blockchain) GetCurrentBlock() *Block {
 func (bc *Blockchain) GetBlockByHash(hash crypto.Hash) (*Block, error) {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
+	return bc.getBlockByHash(hash)
+}
 
-	data, err := bc.db.Get(append([]byte("block-"), hash.Bytes()...))
+// GetBlockByNumber retrieves a block by its number
+func (bc *Blockchain) GetBlockByNumber(number *big.Int) (*Block, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.getBlockByNumber(number)
+}
+
+// getBlockByHash retrieves a block by hash, the caller must hold bc.mu
+func (bc *Blockchain) getBlockByHash(hash crypto.Hash) (*Block, error) {
+	data, err := bc.tables.Blocks.Get(hash.Bytes())
 	if err != nil {
 		return nil, ErrBlockNotFound
 	}
@@ -88,19 +370,61 @@ func (bc *Blockchain) GetBlockByHash(hash crypto.Hash) (*Block, error) {
 	return deserializeBlock(data)
 }
 
-// GetBlockByNumber retrieves a block by its number
-func (bc *Blockchain) GetBlockByNumber(number *big.Int) (*Block, error) {
-	bc.mu.RLock()
-	defer bc.mu.RUnlock()
-
+// getBlockByNumber retrieves a block by number, the caller must hold bc.mu
+func (bc *Blockchain) getBlockByNumber(number *big.Int) (*Block, error) {
 	// First get the hash from number index
-	hashData, err := bc.db.Get(append([]byte("block-number-"), number.Bytes()...))
+	hashData, err := bc.tables.Canonical.Get(number.Bytes())
 	if err != nil {
 		return nil, ErrBlockNotFound
 	}
 
 	hash := crypto.BytesToHash(hashData)
-	return bc.GetBlockByHash(hash)
+	return bc.getBlockByHash(hash)
+}
+
+// GetReceipts retrieves the transaction receipts of a block
+func (bc *Blockchain) GetReceipts(hash crypto.Hash) ([]*TransactionReceipt, error) {
+	data, err := bc.tables.Receipts.Get(hash.Bytes())
+	if err != nil {
+		return nil, ErrBlockNotFound
+	}
+
+	var receipts []*TransactionReceipt
+	if err := json.Unmarshal(data, &receipts); err != nil {
+		return nil, fmt.Errorf("failed to decode receipts: %v", err)
+	}
+	return receipts, nil
+}
+
+// GetTransactionReceipt returns the receipt of a transaction included in
+// the canonical chain, nil if there is none
+func (bc *Blockchain) GetTransactionReceipt(txHash crypto.Hash) *TransactionReceipt {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	hashData, err := bc.tables.TxLookup.Get(txHash.Bytes())
+	if err != nil {
+		return nil
+	}
+	blockHash := crypto.BytesToHash(hashData)
+	header := bc.getHeader(blockHash)
+	if header == nil {
+		return nil
+	}
+	if canonical, ok := bc.getCanonicalHash(header.Number); !ok || !canonical.Equal(blockHash) {
+		return nil
+	}
+
+	receipts, err := bc.GetReceipts(blockHash)
+	if err != nil {
+		return nil
+	}
+	for _, receipt := range receipts {
+		if receipt.TransactionHash.Equal(txHash) {
+			return receipt
+		}
+	}
+	return nil
 }
 
 // GetBlockNumber returns the current block number
@@ -114,87 +438,187 @@ func (bc *Blockchain) GetBlockNumber() *big.Int {
 	return bc.currentBlock.Header.Number
 }
 
-// validateBlock validates a block
-func (bc *Blockchain) validateBlock(block *Block) error {
+// NewSnapshot returns a read-only view of the database taken between two
+// blocks, so that it holds a consistent chain while blocks keep arriving
+func (bc *Blockchain) NewSnapshot() (storage.Snapshot, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	return bc.db.NewSnapshot()
+}
+
+// validateBlock validates a block against its parent
+func (bc *Blockchain) validateBlock(block *Block, parent *BlockHeader) error {
 	// Basic validation
-	if block.Header.Number.Cmp(big.NewInt(0)) <= 0 && bc.currentBlock != nil {
+	if block.Header.Number == nil || block.Header.Difficulty == nil {
 		return ErrInvalidBlock
 	}
+	if err := verifyIntegrity(block); err != nil {
+		return err
+	}
 
-	// Check if previous hash matches current block hash
-	if bc.currentBlock != nil {
-		expectedPrevHash := bc.currentBlock.Hash
-		if !block.Header.PreviousHash.Equal(expectedPrevHash) {
-			return fmt.Errorf("invalid previous hash: expected %x, got %x", 
-				expectedPrevHash, block.Header.PreviousHash)
+	// Check block number sequence
+	expectedNumber := new(big.Int).Add(parent.Number, big.NewInt(1))
+	if block.Header.Number.Cmp(expectedNumber) != 0 {
+		return fmt.Errorf("invalid block number: expected %s, got %s", 
+			expectedNumber.String(), block.Header.Number.String())
+	}
+
+	// Check the EIP-1559 base fee
+	if err := VerifyBaseFee(parent, block.Header); err != nil {
+		return err
+	}
+
+	// Check difficulty, timestamp, gas limit and seal against consensus rules
+	if bc.engine != nil {
+		chain := lockedChain{bc}
+		if err := bc.engine.VerifyHeader(chain, block.Header); err != nil {
+			return err
+		}
+		if err := bc.engine.VerifySeal(chain, block.Header); err != nil {
+			return err
 		}
+	}
 
-		// Check block number sequence
-		expectedNumber := new(big.Int).Add(bc.currentBlock.Header.Number, big.NewInt(1))
-		if block.Header.Number.Cmp(expectedNumber) != 0 {
-			return fmt.Errorf("invalid block number: expected %s, got %s", 
-				expectedNumber.String(), block.Header.Number.String())
+	// Check the uncles against the consensus rules
+	if bc.engine != nil {
+		if err := bc.engine.VerifyUncles(lockedChain{bc}, block); err != nil {
+			return err
 		}
 	}
 
-	// Validate block hash
-	calculatedHash := block.CalculateHash()
-	if !calculatedHash.Equal(block.Hash) {
-		return fmt.Errorf("invalid block hash: expected %x, got %x", 
-			calculatedHash, block.Hash)
+	// Imported chains must pass through every configured checkpoint
+	if checkpoint, ok := bc.Checkpoint(block.Header.Number.Uint64()); ok && !checkpoint.Equal(block.Hash) {
+		return fmt.Errorf("%w: block %s, expected %x, got %x", ErrCheckpointMismatch,
+			block.Header.Number.String(), checkpoint, block.Hash)
 	}
 
 	return nil
 }
 
-// addBlock adds a block to the database
-func (bc *Blockchain) addBlock(block *Block) error {
-	// Serialize and store block
-	data, err := serializeBlock(block)
-	if err != nil {
-		return err
+// Checkpoint returns the trusted hash configured for a block number
+func (bc *Blockchain) Checkpoint(number uint64) (crypto.Hash, bool) {
+	if bc.config == nil || bc.config.Checkpoints == nil {
+		return crypto.Hash{}, false
+	}
+	hash, ok := bc.config.Checkpoints[number]
+	return hash, ok
+}
+
+// verifyCheckpoints checks the stored chain against the configured checkpoints
+func (bc *Blockchain) verifyCheckpoints() error {
+	if bc.config == nil || bc.currentBlock == nil {
+		return nil
 	}
 
+	head := bc.currentBlock.Header.Number.Uint64()
+	for number, checkpoint := range bc.config.Checkpoints {
+		if number > head {
+			continue
+		}
+		hashData, err := bc.tables.Canonical.Get(new(big.Int).SetUint64(number).Bytes())
+		if err != nil {
+			return fmt.Errorf("missing block %d required by checkpoint", number)
+		}
+		if hash := crypto.BytesToHash(hashData); !hash.Equal(checkpoint) {
+			return fmt.Errorf("%w: block %d, expected %x, got %x", ErrCheckpointMismatch,
+				number, checkpoint, hash)
+		}
+	}
+	return nil
+}
+
+// addBlock adds a block to the database as the new canonical head
+func (bc *Blockchain) addBlock(block *Block) error {
 	// Store block by hash
-	if err := bc.db.Put(append([]byte("block-"), block.Hash.Bytes()...), data); err != nil {
+	if err := bc.writeBlock(block); err != nil {
 		return err
 	}
 
 	// Store block number index
-	if err := bc.db.Put(append([]byte("block-number-"), block.Header.Number.Bytes()...), 
-		block.Hash.Bytes()); err != nil {
+	if err := bc.writeCanonicalHash(block); err != nil {
 		return err
 	}
 
 	// Update current block pointer
-	if err := bc.db.Put([]byte("current-block"), block.Hash.Bytes()); err != nil {
+	return bc.writeHeadHash(block.Hash)
+}
+
+// writeBlock stores a block by hash without touching the canonical chain
+func (bc *Blockchain) writeBlock(block *Block) error {
+	data, err := serializeBlock(block)
+	if err != nil {
 		return err
 	}
+	return bc.tables.Blocks.Put(block.Hash.Bytes(), data)
+}
+
+// writeCanonicalHash maps the number of a block to its hash
+func (bc *Blockchain) writeCanonicalHash(block *Block) error {
+	return bc.tables.Canonical.Put(block.Header.Number.Bytes(), block.Hash.Bytes())
+}
 
+// deleteCanonicalHash removes the canonical hash of a block number
+func (bc *Blockchain) deleteCanonicalHash(number *big.Int) error {
+	return bc.tables.Canonical.Delete(number.Bytes())
+}
+
+// writeHeadHash stores the hash of the current head block
+func (bc *Blockchain) writeHeadHash(hash crypto.Hash) error {
+	return bc.tables.Meta.Put(headBlockKey, hash.Bytes())
+}
+
+// writeReceipts stores the receipts of a block and indexes its
+// transactions by hash. Index entries of blocks that left the canonical
+// chain are not removed, lookups check that the block is still canonical.
+func (bc *Blockchain) writeReceipts(hash crypto.Hash, receipts []*TransactionReceipt) error {
+	data, err := json.Marshal(receipts)
+	if err != nil {
+		return err
+	}
+	if err := bc.tables.Receipts.Put(hash.Bytes(), data); err != nil {
+		return err
+	}
+	for _, receipt := range receipts {
+		if err := bc.tables.TxLookup.Put(receipt.TransactionHash.Bytes(), hash.Bytes()); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// hasBlock checks whether a block is stored in the database. Blocks are
+// only stored after verifyIntegrity, so another block claiming the hash is
+// a forgery.
+func (bc *Blockchain) hasBlock(hash crypto.Hash) bool {
+	exists, err := bc.tables.Blocks.Has(hash.Bytes())
+	return err == nil && exists
+}
+
 // loadCurrentBlock loads the current block from database
 func (bc *Blockchain) loadCurrentBlock() (*Block, error) {
-	hashData, err := bc.db.Get([]byte("current-block"))
+	hashData, err := bc.tables.Meta.Get(headBlockKey)
 	if err != nil {
 		return nil, err
 	}
 
 	hash := crypto.BytesToHash(hashData)
-	return bc.GetBlockByHash(hash)
+	return bc.getBlockByHash(hash)
 }
 
-// serializeBlock serializes a block (placeholder implementation)
+// serializeBlock serializes a block for storage
 func serializeBlock(block *Block) ([]byte, error) {
-	// TODO: Implement proper serialization (JSON/RLP)
-	// For now, this is a placeholder
-	return []byte(fmt.Sprintf("%+v", block)), nil
+	return json.Marshal(block)
 }
 
-// deserializeBlock deserializes a block (placeholder implementation)
+// deserializeBlock deserializes a stored block
 func deserializeBlock(data []byte) (*Block, error) {
-	// TODO: Implement proper deserialization
-	// For now, this is a placeholder
-	return &Block{}, nil
+	var block Block
+	if err := json.Unmarshal(data, &block); err != nil {
+		return nil, fmt.Errorf("failed to decode block: %v", err)
+	}
+	if block.Header == nil {
+		return nil, fmt.Errorf("failed to decode block: missing header")
+	}
+	return &block, nil
 }
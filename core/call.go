@@ -0,0 +1,104 @@
+package core
+
+import (
+	"math/big"
+
+	"blockchain-node/crypto"
+)
+
+// Call executes msg on top of the current head without changing the state
+// and returns the output. msg does not have to be signed. overrides may be
+// nil. Results without overrides are cached until the head changes.
+func (bc *Blockchain) Call(msg *Transaction, overrides StateOverride) ([]byte, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	head := bc.currentBlock
+	if len(overrides) > 0 {
+		return bc.simulator().Call(msg, head.Header, overrides)
+	}
+
+	key := callCacheKey(callKindCall, msg)
+	if cached := bc.callCache.get(head.Hash, key); cached != nil {
+		return append([]byte(nil), cached.ret...), cached.err
+	}
+	ret, err := bc.simulator().Call(msg, head.Header, nil)
+	bc.callCache.add(head.Hash, &callResult{key: key, ret: append([]byte(nil), ret...), err: err})
+	return ret, err
+}
+
+// EstimateGas estimates the gas needed to execute msg on top of the current
+// head. msg does not have to be signed. overrides may be nil. Results
+// without overrides are cached until the head changes.
+func (bc *Blockchain) EstimateGas(msg *Transaction, overrides StateOverride) (uint64, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	head := bc.currentBlock
+	if len(overrides) > 0 {
+		return bc.simulator().EstimateGas(msg, head.Header, overrides)
+	}
+
+	key := callCacheKey(callKindEstimate, msg)
+	if cached := bc.callCache.get(head.Hash, key); cached != nil {
+		return cached.gas, cached.err
+	}
+	gas, err := bc.simulator().EstimateGas(msg, head.Header, nil)
+	bc.callCache.add(head.Hash, &callResult{key: key, gas: gas, err: err})
+	return gas, err
+}
+
+// GetCode returns the code deployed at addr in the head state
+func (bc *Blockchain) GetCode(addr crypto.Address) []byte {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return bc.stateDB.GetCode(addr)
+}
+
+// GetBalance returns the balance of addr in the head state
+func (bc *Blockchain) GetBalance(addr crypto.Address) *big.Int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return bc.stateDB.GetBalance(addr)
+}
+
+// GetNonce returns the nonce of addr in the head state
+func (bc *Blockchain) GetNonce(addr crypto.Address) uint64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return bc.stateDB.GetNonce(addr)
+}
+
+// GetSpendableBalance returns the balance of addr in the head state without
+// its immature block rewards
+func (bc *Blockchain) GetSpendableBalance(addr crypto.Address) *big.Int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return SpendableBalance(bc.stateDB, addr)
+}
+
+// GetStorage returns the value of a storage slot of addr in the head state
+func (bc *Blockchain) GetStorage(addr crypto.Address, key crypto.Hash) crypto.Hash {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return bc.stateDB.GetStorage(addr, key)
+}
+
+// simulator returns an execution engine on the head state for simulated
+// calls. The caller must hold bc.mu.
+func (bc *Blockchain) simulator() *ExecutionEngine {
+	header := bc.currentBlock.Header
+	return NewExecutionEngine(bc.stateDB, &ExecutionConfig{
+		ChainID:          bc.chainID(),
+		BlockGasLimit:    header.GasLimit,
+		MinGasPrice:      big.NewInt(0),
+		VM:               bc.vm,
+		GetHash:          bc.getHashFn(header),
+		CoinbaseMaturity: bc.coinbaseMaturity(),
+	})
+}
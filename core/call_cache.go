@@ -0,0 +1,106 @@
+package core
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"blockchain-node/crypto"
+)
+
+// Simulation result cache parameters
+const (
+	callCacheSize = 1024            // Maximum number of cached results
+	callCacheTTL  = 5 * time.Second // Lifetime of a cached result
+)
+
+// Kinds of simulations sharing the call cache
+const (
+	callKindCall byte = iota
+	callKindEstimate
+)
+
+// callResult is a cached eth_call or eth_estimateGas outcome
+type callResult struct {
+	key     crypto.Hash
+	ret     []byte
+	gas     uint64
+	err     error
+	expires time.Time
+}
+
+// callCache is an LRU of simulation results on the current head. All entries
+// are dropped when the head changes. Simulations run under the blockchain
+// read lock, so the cache has its own lock.
+type callCache struct {
+	mu      sync.Mutex
+	head    crypto.Hash
+	entries map[crypto.Hash]*list.Element
+	order   *list.List // most recently used first
+}
+
+// newCallCache creates an empty simulation result cache
+func newCallCache() *callCache {
+	return &callCache{
+		entries: make(map[crypto.Hash]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// callCacheKey identifies a simulation of msg. Messages are unsigned, so the
+// sender is part of the key.
+func callCacheKey(kind byte, msg *Transaction) crypto.Hash {
+	signingHash := msg.SigningHash()
+	return crypto.Keccak256Hash([]byte{kind, msg.Type}, msg.From.Bytes(), signingHash[:])
+}
+
+// get returns the result cached for key on head, nil if there is none
+func (cache *callCache) get(head, key crypto.Hash) *callResult {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.setHead(head)
+	elem, ok := cache.entries[key]
+	if !ok {
+		return nil
+	}
+	result := elem.Value.(*callResult)
+	if time.Now().After(result.expires) {
+		cache.order.Remove(elem)
+		delete(cache.entries, key)
+		return nil
+	}
+	cache.order.MoveToFront(elem)
+	return result
+}
+
+// add caches a result computed on head, evicting the least recently used
+// entry when full
+func (cache *callCache) add(head crypto.Hash, result *callResult) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.setHead(head)
+	result.expires = time.Now().Add(callCacheTTL)
+	if elem, ok := cache.entries[result.key]; ok {
+		elem.Value = result
+		cache.order.MoveToFront(elem)
+		return
+	}
+	if cache.order.Len() >= callCacheSize {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*callResult).key)
+	}
+	cache.entries[result.key] = cache.order.PushFront(result)
+}
+
+// setHead drops all entries if the head changed. The caller must hold cache.mu.
+func (cache *callCache) setHead(head crypto.Hash) {
+	if head == cache.head {
+		return
+	}
+	cache.head = head
+	cache.entries = make(map[crypto.Hash]*list.Element)
+	cache.order.Init()
+}
@@ -0,0 +1,83 @@
+package core
+
+import "sync"
+
+// ChainHeadEvent describes a change of the canonical head
+type ChainHeadEvent struct {
+	Head    *Block
+	Added   []*Block // blocks that became canonical, oldest first
+	Removed []*Block // blocks that left the canonical chain in a reorg, newest first
+}
+
+// chainFeed delivers head events to the subscribers of a blockchain
+type chainFeed struct {
+	mu     sync.Mutex
+	subs   []chainSub // in subscription order
+	nextID int
+
+	// sendMu keeps events in order when blocks are added concurrently. It is
+	// taken before bc.mu, never while holding it.
+	sendMu sync.Mutex
+}
+
+// chainSub is a subscriber of a chainFeed
+type chainSub struct {
+	id int
+	fn func(ChainHeadEvent)
+}
+
+// SubscribeChainHead registers fn to be called with every head change, in
+// order, after the subscribers registered before it. fn runs once the
+// change is written, without the blockchain lock held, so it may query the
+// blockchain but must not add blocks. The returned function cancels the
+// subscription.
+func (bc *Blockchain) SubscribeChainHead(fn func(ChainHeadEvent)) (unsubscribe func()) {
+	bc.feed.mu.Lock()
+	defer bc.feed.mu.Unlock()
+
+	id := bc.feed.nextID
+	bc.feed.nextID++
+	bc.feed.subs = append(bc.feed.subs, chainSub{id, fn})
+
+	return func() {
+		bc.feed.mu.Lock()
+		defer bc.feed.mu.Unlock()
+		for i, sub := range bc.feed.subs {
+			if sub.id == id {
+				bc.feed.subs = append(bc.feed.subs[:i:i], bc.feed.subs[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// queueHeadEvent records a head change to be sent by sendHeadEvents. The
+// caller must hold bc.mu.
+func (bc *Blockchain) queueHeadEvent(ev ChainHeadEvent) {
+	bc.headEvents = append(bc.headEvents, ev)
+}
+
+// sendHeadEvents delivers the queued head changes to the subscribers. It
+// must be called without holding bc.mu.
+func (bc *Blockchain) sendHeadEvents() {
+	bc.feed.sendMu.Lock()
+	defer bc.feed.sendMu.Unlock()
+
+	bc.mu.Lock()
+	events := bc.headEvents
+	bc.headEvents = nil
+	bc.mu.Unlock()
+	if len(events) == 0 {
+		return
+	}
+
+	bc.feed.mu.Lock()
+	subs := bc.feed.subs
+	bc.feed.mu.Unlock()
+
+	for _, ev := range events {
+		for _, sub := range subs {
+			sub.fn(ev)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultImportBatchSize is the number of blocks ImportChain inserts per
+// batch when ImportOptions leave it unset
+const DefaultImportBatchSize = 256
+
+// ImportOptions tunes ImportChain
+type ImportOptions struct {
+	BatchSize int               // Blocks inserted under one chain lock, head events are sent once per batch
+	Progress  func(ImportStats) // Called after every batch, may be nil
+}
+
+// ImportStats counts the blocks read by ImportChain
+type ImportStats struct {
+	Imported uint64 // Blocks added to the chain
+	Skipped  uint64 // Blocks the chain already had
+	Last     uint64 // Number of the last block read
+}
+
+// ExportChain writes the canonical blocks from..to (inclusive, capped at the
+// head) to w, one JSON encoded block per line in the storage format. progress
+// is called after each block and may be nil. It returns the number of blocks
+// written.
+func (bc *Blockchain) ExportChain(w io.Writer, from, to uint64, progress func(*Block)) (uint64, error) {
+	out := bufio.NewWriter(w)
+	it := bc.BlocksInRange(from, to)
+	written := uint64(0)
+	for it.Next() {
+		data, err := serializeBlock(it.Block())
+		if err != nil {
+			return written, fmt.Errorf("failed to encode block %v: %v", it.Header().Number, err)
+		}
+		data = append(data, '\n')
+		if _, err := out.Write(data); err != nil {
+			return written, err
+		}
+		written++
+		if progress != nil {
+			progress(it.Block())
+		}
+	}
+	if err := it.Err(); err != nil {
+		return written, err
+	}
+	return written, out.Flush()
+}
+
+// ImportChain reads blocks written by ExportChain from r and adds them to
+// the chain, validating and executing each like a block from the network.
+// Blocks the chain already has are skipped, so an interrupted import can be
+// run again. Blocks must come after their parent; the first block that can
+// not be added stops the import.
+func (bc *Blockchain) ImportChain(r io.Reader, opts *ImportOptions) (ImportStats, error) {
+	var stats ImportStats
+	batchSize := DefaultImportBatchSize
+	if opts != nil && opts.BatchSize > 0 {
+		batchSize = opts.BatchSize
+	}
+
+	in := bufio.NewReader(r)
+	batch := make([]*Block, 0, batchSize)
+	for eof := false; !eof; {
+		line, err := in.ReadBytes('\n')
+		if err == io.EOF {
+			eof = true
+		} else if err != nil {
+			return stats, err
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			block, err := deserializeBlock(line)
+			if err != nil {
+				return stats, fmt.Errorf("block %d of the file: %v", stats.Imported+stats.Skipped+uint64(len(batch))+1, err)
+			}
+			batch = append(batch, block)
+		}
+		if len(batch) == batchSize || (eof && len(batch) > 0) {
+			if err := bc.importBatch(batch, &stats); err != nil {
+				return stats, err
+			}
+			batch = batch[:0]
+			if opts != nil && opts.Progress != nil {
+				opts.Progress(stats)
+			}
+		}
+	}
+	return stats, nil
+}
+
+// InsertChain adds blocks received from peers to the chain under one chain
+// lock, like ImportChain does for a batch read from a file. Blocks the chain
+// already has are skipped; the first block that can not be added stops the
+// insert.
+func (bc *Blockchain) InsertChain(blocks []*Block) (ImportStats, error) {
+	var stats ImportStats
+	err := bc.importBatch(blocks, &stats)
+	return stats, err
+}
+
+// importBatch inserts blocks under one chain lock
+func (bc *Blockchain) importBatch(blocks []*Block, stats *ImportStats) error {
+	defer bc.sendHeadEvents()
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	for _, block := range blocks {
+		number := block.Header.Number.Uint64()
+		stats.Last = number
+		if number == 0 {
+			if !block.Hash.Equal(bc.genesis.Hash) {
+				return fmt.Errorf("%w: have %s, file has %s", ErrGenesisMismatch, bc.genesis.Hash.Hex(), block.Hash.Hex())
+			}
+			stats.Skipped++
+			continue
+		}
+		if bad := bc.badBlocks.get(block.Hash); bad != nil {
+			return fmt.Errorf("block %d: %w %s: %s", number, ErrKnownBadBlock, block.Hash.Hex(), bad.Reason)
+		}
+		err := bc.insertBlock(block)
+		switch {
+		case err == nil:
+			stats.Imported++
+		case errors.Is(err, ErrKnownBlock):
+			stats.Skipped++
+		default:
+			return fmt.Errorf("block %d: %w", number, err)
+		}
+	}
+	return nil
+}
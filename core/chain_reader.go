@@ -0,0 +1,141 @@
+package core
+
+import (
+	"math/big"
+
+	"blockchain-node/crypto"
+)
+
+// ChainReader defines the read-only access to the local chain that consensus
+// engines need during header verification and block preparation
+type ChainReader interface {
+	// Config returns the chain configuration
+	Config() *ChainConfig
+
+	// CurrentHeader returns the header of the current chain head
+	CurrentHeader() *BlockHeader
+
+	// GetHeader retrieves a block header by hash, nil if unknown
+	GetHeader(hash crypto.Hash) *BlockHeader
+
+	// GetHeaderByNumber retrieves a canonical block header by number, nil if unknown
+	GetHeaderByNumber(number uint64) *BlockHeader
+
+	// GetBlock retrieves a block by hash, nil if unknown
+	GetBlock(hash crypto.Hash) *Block
+}
+
+// ConsensusEngine is the part of consensus.Engine the blockchain drives while
+// importing blocks. It is declared here because package consensus depends on
+// core, every consensus.Engine satisfies it.
+type ConsensusEngine interface {
+	// VerifyHeader checks a header against the consensus rules
+	VerifyHeader(chain ChainReader, header *BlockHeader) error
+
+	// VerifySeal checks the header seal (e.g. the proof-of-work)
+	VerifySeal(chain ChainReader, header *BlockHeader) error
+
+	// VerifyUncles checks the uncles included by a block
+	VerifyUncles(chain ChainReader, block *Block) error
+
+	// Finalize applies post-transaction state changes such as block rewards
+	Finalize(chain ChainReader, header *BlockHeader, state *StateDB, txs []*Transaction, uncles []*BlockHeader) error
+}
+
+// Config returns the chain configuration
+func (bc *Blockchain) Config() *ChainConfig {
+	return bc.config
+}
+
+// ChainID returns the chain ID transactions have to be signed for
+func (bc *Blockchain) ChainID() *big.Int {
+	return new(big.Int).Set(bc.chainID())
+}
+
+// CurrentHeader returns the header of the current chain head
+func (bc *Blockchain) CurrentHeader() *BlockHeader {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.currentHeader()
+}
+
+// GetHeader retrieves a block header by hash
+func (bc *Blockchain) GetHeader(hash crypto.Hash) *BlockHeader {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.getHeader(hash)
+}
+
+// GetHeaderByNumber retrieves a canonical block header by number
+func (bc *Blockchain) GetHeaderByNumber(number uint64) *BlockHeader {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.getHeaderByNumber(number)
+}
+
+// GetBlock retrieves a block by hash
+func (bc *Blockchain) GetBlock(hash crypto.Hash) *Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	block, err := bc.getBlockByHash(hash)
+	if err != nil {
+		return nil
+	}
+	return block
+}
+
+// currentHeader returns the head header, the caller must hold bc.mu
+func (bc *Blockchain) currentHeader() *BlockHeader {
+	if bc.currentBlock == nil {
+		return nil
+	}
+	return bc.currentBlock.Header
+}
+
+// getHeader retrieves a header by hash, the caller must hold bc.mu
+func (bc *Blockchain) getHeader(hash crypto.Hash) *BlockHeader {
+	block, err := bc.getBlockByHash(hash)
+	if err != nil {
+		return nil
+	}
+	return block.Header
+}
+
+// getHeaderByNumber retrieves a header by number, the caller must hold bc.mu
+func (bc *Blockchain) getHeaderByNumber(number uint64) *BlockHeader {
+	block, err := bc.getBlockByNumber(new(big.Int).SetUint64(number))
+	if err != nil {
+		return nil
+	}
+	return block.Header
+}
+
+// lockedChain exposes the blockchain to consensus engines while bc.mu is
+// already held by the import path, avoiding recursive locking
+type lockedChain struct {
+	bc *Blockchain
+}
+
+func (lc lockedChain) Config() *ChainConfig {
+	return lc.bc.config
+}
+
+func (lc lockedChain) CurrentHeader() *BlockHeader {
+	return lc.bc.currentHeader()
+}
+
+func (lc lockedChain) GetHeader(hash crypto.Hash) *BlockHeader {
+	return lc.bc.getHeader(hash)
+}
+
+func (lc lockedChain) GetHeaderByNumber(number uint64) *BlockHeader {
+	return lc.bc.getHeaderByNumber(number)
+}
+
+func (lc lockedChain) GetBlock(hash crypto.Hash) *Block {
+	block, err := lc.bc.getBlockByHash(hash)
+	if err != nil {
+		return nil
+	}
+	return block
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+
+	"blockchain-node/crypto"
+	"blockchain-node/logger"
+)
+
+// repairCheckDepth is the number of blocks below the head whose index entry
+// and body are verified on startup
+const repairCheckDepth = 128
+
+// stateHeadKey stores the hash of the block the committed state belongs to
+var stateHeadKey = []byte("state-head")
+
+// repairChain checks the stored chain on startup and recovers from imports
+// that were interrupted by a crash. Imports write the block data first, then
+// the state together with the "state-head" marker and finally the number
+// index and head pointer. The marker therefore always names the block the
+// state belongs to, and the index and head pointer are rebuilt from it.
+func (bc *Blockchain) repairChain() error {
+	head, err := bc.loadStateHead()
+	if err != nil {
+		return err
+	}
+
+	if current, err := bc.loadCurrentBlock(); err != nil || !current.Hash.Equal(head.Hash) {
+		logger.Warning("Head pointer does not match committed state, repairing",
+			"state", head.Hash.Hex(), "number", head.Header.Number.String())
+	}
+
+	if bc.getTd(head.Hash) == nil {
+		return fmt.Errorf("missing total difficulty of head block %x", head.Hash)
+	}
+
+	repaired, err := bc.writeCanonicalChain(head)
+	if err != nil {
+		return err
+	}
+	if repaired > 0 {
+		logger.Warning("Repaired canonical block index", "entries", repaired)
+	}
+	if err := bc.writeHeadHash(head.Hash); err != nil {
+		return err
+	}
+
+	if err := bc.verifyCanonicalChain(head, repairCheckDepth); err != nil {
+		return err
+	}
+
+	bc.currentBlock = head
+	return nil
+}
+
+// loadStateHead loads the block the committed state belongs to. Databases
+// written before the marker existed fall back to the head pointer.
+func (bc *Blockchain) loadStateHead() (*Block, error) {
+	hashData, err := bc.tables.Meta.Get(stateHeadKey)
+	if err != nil {
+		head, err := bc.loadCurrentBlock()
+		if err != nil {
+			return nil, fmt.Errorf("no head block found: %v", err)
+		}
+		return head, bc.writeStateHead(head.Hash)
+	}
+
+	hash := crypto.BytesToHash(hashData)
+	head, err := bc.getBlockByHash(hash)
+	if err != nil {
+		return nil, fmt.Errorf("state committed for unreadable block %x: %v", hash, err)
+	}
+	return head, nil
+}
+
+// writeStateHead records the block whose state has been committed
+func (bc *Blockchain) writeStateHead(hash crypto.Hash) error {
+	return bc.tables.Meta.Put(stateHeadKey, hash.Bytes())
+}
+
+// writeCanonicalChain points the number index at the chain ending in head.
+// Entries are rewritten back to the first block that is already canonical
+// and entries above head are removed. It returns the number of entries that
+// were changed.
+func (bc *Blockchain) writeCanonicalChain(head *Block) (int, error) {
+	changed := 0
+
+	block := head
+	for {
+		if hash, ok := bc.getCanonicalHash(block.Header.Number); ok && hash.Equal(block.Hash) {
+			break
+		}
+		if err := bc.writeCanonicalHash(block); err != nil {
+			return changed, err
+		}
+		changed++
+
+		if block.Header.Number.Sign() == 0 {
+			break
+		}
+		parent, err := bc.getBlockByHash(block.Header.PreviousHash)
+		if err != nil {
+			return changed, fmt.Errorf("missing ancestor %x of block %s", block.Header.PreviousHash,
+				block.Header.Number.String())
+		}
+		block = parent
+	}
+
+	// Remove entries of a longer chain left above the head
+	number := new(big.Int).Add(head.Header.Number, big.NewInt(1))
+	for ; ; number.Add(number, big.NewInt(1)) {
+		if _, ok := bc.getCanonicalHash(number); !ok {
+			break
+		}
+		if err := bc.deleteCanonicalHash(number); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+
+	return changed, nil
+}
+
+// verifyCanonicalChain checks that the index entries and bodies of up to
+// depth blocks below head agree with each other
+func (bc *Blockchain) verifyCanonicalChain(head *Block, depth int) error {
+	block := head
+	for i := 0; i < depth && block.Header.Number.Sign() > 0; i++ {
+		parent, err := bc.getBlockByNumber(new(big.Int).Sub(block.Header.Number, big.NewInt(1)))
+		if err != nil {
+			return fmt.Errorf("unreadable canonical block %d: %v", block.Header.Number.Uint64()-1, err)
+		}
+		if !parent.Hash.Equal(block.Header.PreviousHash) {
+			return fmt.Errorf("canonical block %s does not link to its parent", block.Header.Number.String())
+		}
+		if !parent.CalculateHash().Equal(parent.Hash) {
+			return fmt.Errorf("corrupted body of block %x", parent.Hash)
+		}
+		block = parent
+	}
+	return nil
+}
+
+// getCanonicalHash returns the canonical hash of a block number
+func (bc *Blockchain) getCanonicalHash(number *big.Int) (crypto.Hash, bool) {
+	hashData, err := bc.tables.Canonical.Get(number.Bytes())
+	if err != nil {
+		return crypto.Hash{}, false
+	}
+	return crypto.BytesToHash(hashData), true
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"blockchain-node/logger"
+	"blockchain-node/storage"
+)
+
+// uncleanCheckDepth is the number of blocks below the head verified after
+// an unclean shutdown, instead of repairCheckDepth
+const uncleanCheckDepth = 1024
+
+// runningKey is present while a node runs on the database, it holds the
+// time the node started
+var runningKey = []byte("running")
+
+// MarkRunning records that a node runs on the chain until Close. It reports
+// whether the previous run ended without Close, killed or crashed. The
+// chain and state are repaired when the chain is opened, after an unclean
+// shutdown the recent blocks are also verified more deeply.
+func (bc *Blockchain) MarkRunning() (unclean bool, err error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if started, err := bc.tables.Meta.Get(runningKey); err == nil {
+		unclean = true
+		logger.Warning("Previous run did not shut down cleanly, verifying recent blocks",
+			"started", string(started), "depth", uncleanCheckDepth)
+		if err := bc.verifyCanonicalChain(bc.currentBlock, uncleanCheckDepth); err != nil {
+			return true, fmt.Errorf("%w: consistency check failed: %v", storage.ErrCorrupted, err)
+		}
+	}
+	if err := bc.tables.Meta.Put(runningKey, []byte(time.Now().UTC().Format(time.RFC3339))); err != nil {
+		return unclean, fmt.Errorf("failed to mark chain as running: %v", err)
+	}
+	return unclean, nil
+}
+
+// Close waits for a running import to complete and records that the node
+// shut down cleanly. Every imported block is committed together with its
+// state, so nothing else is left to write. The chain must not be changed
+// after Close.
+func (bc *Blockchain) Close() error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.freezer != nil {
+		if err := bc.freezer.Sync(); err != nil {
+			return fmt.Errorf("failed to sync freezer: %v", err)
+		}
+	}
+	if err := bc.tables.Meta.Delete(runningKey); err != nil {
+		return fmt.Errorf("failed to mark clean shutdown: %v", err)
+	}
+	return nil
+}
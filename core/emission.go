@@ -0,0 +1,46 @@
+package core
+
+import "math/big"
+
+// EmissionConfig is the monetary policy of a chain: the reward of the
+// first block, reduced by ReductionPercent every ReductionInterval blocks
+// but never below TailReward
+type EmissionConfig struct {
+	InitialReward     *big.Int `json:"initialReward"`               // Reward in wei of the blocks before the first reduction
+	ReductionInterval uint64   `json:"reductionInterval,omitempty"` // Blocks between reductions, 0 keeps the reward constant
+	ReductionPercent  uint64   `json:"reductionPercent,omitempty"`  // Percent the reward drops by at each reduction, 50 halves it
+	TailReward        *big.Int `json:"tailReward,omitempty"`        // Reward in wei the reductions stop at, nil stops at zero
+}
+
+// Reward returns the block reward of block number
+func (e *EmissionConfig) Reward(number uint64) *big.Int {
+	reward := new(big.Int)
+	if e.InitialReward != nil {
+		reward.Set(e.InitialReward)
+	}
+	if e.ReductionInterval == 0 || e.ReductionPercent == 0 {
+		return reward
+	}
+
+	tail := new(big.Int)
+	if e.TailReward != nil {
+		tail.Set(e.TailReward)
+	}
+	percent := e.ReductionPercent
+	if percent > 100 {
+		percent = 100
+	}
+	keep := big.NewInt(int64(100 - percent))
+	hundred := big.NewInt(100)
+
+	// The reward decays geometrically, so it reaches the tail after a few
+	// thousand reductions at most
+	for era := number / e.ReductionInterval; era > 0 && reward.Cmp(tail) > 0; era-- {
+		reward.Mul(reward, keep)
+		reward.Div(reward, hundred)
+	}
+	if reward.Cmp(tail) < 0 {
+		reward.Set(tail)
+	}
+	return reward
+}
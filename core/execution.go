@@ -2,8 +2,10 @@
 package core
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
 
 	"blockchain-node/crypto"
@@ -14,12 +16,33 @@ var (
 	ErrInvalidNonce        = errors.New("invalid nonce")
 	ErrGasLimitExceeded    = errors.New("gas limit exceeded")
 	ErrInvalidSignature    = errors.New("invalid signature")
+	ErrIntrinsicGas        = errors.New("intrinsic gas too low")
+	ErrGasUintOverflow     = errors.New("gas uint64 overflow")
+	ErrMaxInitCodeSize     = errors.New("max initcode size exceeded")
+	ErrNoVM                = errors.New("contract execution not available")
+	ErrExecutionReverted   = errors.New("execution reverted")
+)
+
+// revertSelector is the selector of Error(string), the ABI encoding used by
+// Solidity for revert reasons
+var revertSelector = crypto.Keccak256([]byte("Error(string)"))[:4]
+
+// Transaction gas costs
+const (
+	TxGas                 = 21000 // Base cost of every transaction
+	TxGasContractCreation = 32000 // Extra cost of contract creation transactions
+	TxDataZeroGas         = 4     // Per zero byte of transaction data
+	TxDataNonZeroGas      = 16    // Per non-zero byte of transaction data (EIP-2028)
+	InitCodeWordGas       = 2     // Per 32 byte word of init code (EIP-3860)
+	MaxInitCodeSize       = 49152 // Maximum init code of a contract creation (EIP-3860)
+	MaxRefundQuotient     = 5     // Max refund is gasUsed / MaxRefundQuotient (EIP-3529)
 )
 
 // ExecutionEngine represents the custom transaction execution environment
 type ExecutionEngine struct {
-	stateDB *StateDB
-	config  *ExecutionConfig
+	stateDB  *StateDB
+	config   *ExecutionConfig
+	simulate bool // Skip signature, nonce and base fee checks for eth_call style messages
 }
 
 // ExecutionConfig holds configuration for the execution engine
@@ -27,17 +50,77 @@ type ExecutionConfig struct {
 	ChainID       *big.Int
 	BlockGasLimit uint64
 	MinGasPrice   *big.Int
+	VM            VMFactory                       // Contract interpreter, without it only transfers execute
+	GetHash       func(number uint64) crypto.Hash // Ancestor hashes for the BLOCKHASH opcode
+	Tracer        Tracer                          // Receives execution events, may be nil
+
+	// CoinbaseMaturity is the number of blocks after which block rewards
+	// can be spent, senders must pay with their other funds before
+	CoinbaseMaturity uint64
 }
 
 // ExecutionResult contains the result of transaction execution
 type ExecutionResult struct {
-	GasUsed         uint64
+	GasUsed         uint64 // Gas charged after refunds, the whole limit unless the execution succeeded or reverted
 	Status          uint64 // 1 for success, 0 for failure
 	Logs            []*Log
 	ContractAddress *crypto.Address // For contract creation
+	BurnedFee       *big.Int        // Base fee burned for the gas used
+	ReturnData      []byte          // Output of the call, or the revert payload
 	Error           error
 }
 
+// Revert returns the revert payload if the execution was reverted
+func (result *ExecutionResult) Revert() []byte {
+	if result.Error != ErrExecutionReverted {
+		return nil
+	}
+	return result.ReturnData
+}
+
+// RevertError is returned by simulated calls that revert. Reason holds the
+// decoded Error(string) message if the payload has that form.
+type RevertError struct {
+	Reason string
+	Data   []byte
+}
+
+// newRevertError creates a RevertError from the revert payload of result
+func newRevertError(result *ExecutionResult) *RevertError {
+	data := result.Revert()
+	reason, _ := UnpackRevert(data)
+	return &RevertError{Reason: reason, Data: data}
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason == "" {
+		return ErrExecutionReverted.Error()
+	}
+	return fmt.Sprintf("%v: %s", ErrExecutionReverted, e.Reason)
+}
+
+// UnpackRevert decodes the message of an Error(string) revert payload
+func UnpackRevert(data []byte) (string, error) {
+	if len(data) < 4 || !bytes.Equal(data[:4], revertSelector) {
+		return "", errors.New("invalid revert data")
+	}
+	data = data[4:]
+	if len(data) < 64 {
+		return "", errors.New("invalid revert data")
+	}
+
+	offset := new(big.Int).SetBytes(data[:32])
+	if !offset.IsUint64() || offset.Uint64() > uint64(len(data))-32 {
+		return "", errors.New("invalid revert data offset")
+	}
+	start := offset.Uint64()
+	length := new(big.Int).SetBytes(data[start : start+32])
+	if !length.IsUint64() || length.Uint64() > uint64(len(data))-start-32 {
+		return "", errors.New("invalid revert data length")
+	}
+	return string(data[start+32 : start+32+length.Uint64()]), nil
+}
+
 // NewExecutionEngine creates a new execution engine
 func NewExecutionEngine(stateDB *StateDB, config *ExecutionConfig) *ExecutionEngine {
 	return &ExecutionEngine{
@@ -48,11 +131,19 @@ func NewExecutionEngine(stateDB *StateDB, config *ExecutionConfig) *ExecutionEng
 
 // ExecuteTransaction executes a transaction in the custom environment
 func (ee *ExecutionEngine) ExecuteTransaction(tx *Transaction, header *BlockHeader) (*ExecutionResult, error) {
-	// Validate transaction signature
-	if err := ee.validateSignature(tx); err != nil {
+	if err := ee.validateType(tx); err != nil {
 		return &ExecutionResult{Status: 0, Error: err}, err
 	}
 
+	// Validate transaction signature, simulated messages are not signed
+	if !ee.simulate {
+		if err := ee.validateSignature(tx); err != nil {
+			return &ExecutionResult{Status: 0, Error: err}, err
+		}
+	}
+
+	ee.stateDB.PrepareTransaction()
+
 	// Get sender account
 	senderAccount := ee.stateDB.GetAccount(tx.From)
 	if senderAccount == nil {
@@ -63,283 +154,374 @@ func (ee *ExecutionEngine) ExecuteTransaction(tx *Transaction, header *BlockHead
 	}
 
 	// Validate nonce
-	if senderAccount.Nonce != tx.Nonce {
+	if ee.simulate {
+		tx.Nonce = senderAccount.Nonce
+	} else if senderAccount.Nonce != tx.Nonce {
 		return &ExecutionResult{Status: 0, Error: ErrInvalidNonce}, ErrInvalidNonce
 	}
 
-	// Calculate total cost (value + gas)
-	gasCost := new(big.Int).Mul(tx.GasPrice, big.NewInt(int64(tx.GasLimit)))
-	totalCost := new(big.Int).Add(tx.Value, gasCost)
+	// Reject transactions that cannot pay the block base fee
+	if tx.TipCap().Cmp(tx.FeeCap()) > 0 {
+		return &ExecutionResult{Status: 0, Error: ErrTipAboveFeeCap}, ErrTipAboveFeeCap
+	}
+	var baseFee *big.Int
+	if header != nil {
+		baseFee = header.BaseFee
+	}
+	if !ee.simulate && baseFee != nil && tx.FeeCap().Cmp(baseFee) < 0 {
+		return &ExecutionResult{Status: 0, Error: ErrFeeCapTooLow}, ErrFeeCapTooLow
+	}
+
+	// The balance has to cover the value and gas at the fee cap, while gas
+	// is bought at the effective price
+	gasPrice := tx.EffectiveGasPrice(baseFee)
+	gasCost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(tx.GasLimit))
+	maxGasCost := new(big.Int).Mul(tx.FeeCap(), new(big.Int).SetUint64(tx.GasLimit))
+	totalCost := new(big.Int).Add(tx.Value, maxGasCost)
 
 	// Check balance
 	if senderAccount.Balance.Cmp(totalCost) < 0 {
 		return &ExecutionResult{Status: 0, Error: ErrInsufficientBalance}, ErrInsufficientBalance
 	}
+	if ee.config.CoinbaseMaturity > 0 && SpendableBalance(ee.stateDB, tx.From).Cmp(totalCost) < 0 {
+		return &ExecutionResult{Status: 0, Error: ErrImmatureBalance}, ErrImmatureBalance
+	}
 
-	// Start execution
-	gasUsed := uint64(21000) // Base gas cost
-	logs := []*Log{}
-	var contractAddress *crypto.Address
+	// The gas limit has to cover the intrinsic cost of the transaction
+	if tx.IsContractCreation() && len(tx.Data) > MaxInitCodeSize {
+		return &ExecutionResult{Status: 0, Error: ErrMaxInitCodeSize}, ErrMaxInitCodeSize
+	}
+	intrinsicGas, err := IntrinsicGas(tx.Data, tx.AccessList, tx.IsContractCreation())
+	if err != nil {
+		return &ExecutionResult{Status: 0, Error: err}, err
+	}
+	if tx.GasLimit < intrinsicGas {
+		return &ExecutionResult{Status: 0, Error: ErrIntrinsicGas}, ErrIntrinsicGas
+	}
 
-	// Deduct gas cost from sender
-	senderAccount.Balance.Sub(senderAccount.Balance, gasCost)
-	senderAccount.Nonce++
+	tracer := ee.config.Tracer
+	if tracer != nil {
+		tracer.CaptureTxStart(tx)
+		ee.stateDB.SetTracer(tracer)
+		defer ee.stateDB.SetTracer(nil)
+	}
 
-	if tx.IsContractCreation() {
-		// Contract creation
-		contractAddr := ee.generateContractAddress(tx.From, tx.Nonce-1)
-		contractAddress = &contractAddr
-
-		// Execute contract creation logic
-		if len(tx.Data) > 0 {
-			result, err := ee.executeContractCreation(tx, contractAddr, &gasUsed)
-			if err != nil {
-				// Refund remaining gas
-				remainingGas := tx.GasLimit - gasUsed
-				refund := new(big.Int).Mul(tx.GasPrice, big.NewInt(int64(remainingGas)))
-				senderAccount.Balance.Add(senderAccount.Balance, refund)
-				
-				ee.stateDB.SetAccount(tx.From, senderAccount)
-				return &ExecutionResult{
-					GasUsed:         gasUsed,
-					Status:          0,
-					Logs:            logs,
-					ContractAddress: contractAddress,
-					Error:           err,
-				}, nil
-			}
-			logs = append(logs, result.logs...)
+	// Buy gas, contract creations bump the nonce inside the VM
+	ee.stateDB.SetBalance(tx.From, new(big.Int).Sub(senderAccount.Balance, gasCost))
+	if !tx.IsContractCreation() {
+		ee.stateDB.SetNonce(tx.From, tx.Nonce+1)
+	}
+
+	ee.stateDB.AddAddressToAccessList(tx.From)
+	if tx.To != nil {
+		ee.stateDB.AddAddressToAccessList(*tx.To)
+	}
+	if header != nil {
+		ee.stateDB.AddAddressToAccessList(header.Coinbase)
+	}
+	for _, tuple := range tx.AccessList {
+		ee.stateDB.AddAddressToAccessList(tuple.Address)
+		for _, key := range tuple.StorageKeys {
+			ee.stateDB.AddSlotToAccessList(tuple.Address, key)
 		}
+	}
+	logStart := len(ee.stateDB.GetLogs())
+
+	// Everything after buying gas is reverted if the execution fails
+	snapshot := ee.stateDB.Snapshot()
 
-		// Create contract account
-		contractAccount := &Account{
-			Nonce:   1,
-			Balance: new(big.Int).Set(tx.Value),
+	var (
+		gas             = tx.GasLimit - intrinsicGas
+		contractAddress *crypto.Address
+		returnData      []byte
+		vmErr           error
+	)
+	vm := ee.newVM(tx, header, gasPrice)
+
+	if tracer != nil {
+		to := CreateAddress(tx.From, tx.Nonce)
+		if tx.To != nil {
+			to = *tx.To
 		}
-		ee.stateDB.SetAccount(*contractAddress, contractAccount)
+		tracer.CaptureStart(tx.From, to, tx.IsContractCreation(), tx.Data, gas, tx.Value)
+	}
+	startGas := gas
+
+	if tx.IsContractCreation() {
+		if vm == nil {
+			gas, vmErr = 0, ErrNoVM
+		} else {
+			var contractAddr crypto.Address
+			returnData, contractAddr, gas, vmErr = vm.Create(tx.From, tx.Data, gas, tx.Value)
+			contractAddress = &contractAddr
+		}
+	} else if vm == nil {
+		// Without an interpreter only plain value transfers are supported
+		sender := ee.stateDB.GetBalance(tx.From)
+		ee.stateDB.SetBalance(tx.From, sender.Sub(sender, tx.Value))
+		receiver := ee.stateDB.GetBalance(*tx.To)
+		ee.stateDB.SetBalance(*tx.To, receiver.Add(receiver, tx.Value))
 	} else {
-		// Regular transfer or contract call
-		if tx.To != nil {
-			receiverAccount := ee.stateDB.GetAccount(*tx.To)
-			if receiverAccount == nil {
-				receiverAccount = &Account{
-					Nonce:   0,
-					Balance: big.NewInt(0),
-				}
-			}
-
-			// Transfer value
-			receiverAccount.Balance.Add(receiverAccount.Balance, tx.Value)
-			ee.stateDB.SetAccount(*tx.To, receiverAccount)
-
-			// Execute contract call if data is present
-			if len(tx.Data) > 0 {
-				result, err := ee.executeContractCall(tx, *tx.To, &gasUsed)
-				if err != nil {
-					// Contract call failed, but transaction succeeds
-					// This is similar to Ethereum behavior
-				}
-				if result != nil {
-					logs = append(logs, result.logs...)
-				}
-			}
+		returnData, gas, vmErr = vm.Call(tx.From, *tx.To, tx.Data, gas, tx.Value)
+	}
+	// Only REVERT hands the remaining gas back, every other failure (out of
+	// gas, invalid opcode, stack errors...) consumes all of it
+	if vmErr != nil && vmErr != ErrExecutionReverted {
+		gas = 0
+	}
+	if tracer != nil {
+		tracer.CaptureEnd(returnData, startGas-gas, vmErr)
+	}
+
+	// A failed execution leaves no trace besides the gas it paid for and the
+	// nonce, which contract creations bump inside the VM
+	if vmErr != nil {
+		ee.stateDB.RevertToSnapshot(snapshot)
+		if tx.IsContractCreation() {
+			ee.stateDB.SetNonce(tx.From, tx.Nonce+1)
 		}
 	}
 
-	// Deduct value from sender
-	senderAccount.Balance.Sub(senderAccount.Balance, tx.Value)
+	// Apply the refund counter, capped at a fifth of the gas used (EIP-3529)
+	gasUsed := tx.GasLimit - gas
+	refund := ee.stateDB.GetRefund()
+	if refund > gasUsed/MaxRefundQuotient {
+		refund = gasUsed / MaxRefundQuotient
+	}
+	gasUsed -= refund
 
-	// Refund remaining gas
-	remainingGas := tx.GasLimit - gasUsed
-	if remainingGas > 0 {
-		refund := new(big.Int).Mul(tx.GasPrice, big.NewInt(int64(remainingGas)))
-		senderAccount.Balance.Add(senderAccount.Balance, refund)
+	// Return the remaining gas to the sender
+	if remainingGas := tx.GasLimit - gasUsed; remainingGas > 0 {
+		balance := ee.stateDB.GetBalance(tx.From)
+		refundAmount := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(remainingGas))
+		ee.stateDB.SetBalance(tx.From, balance.Add(balance, refundAmount))
 	}
 
-	// Update sender account
-	ee.stateDB.SetAccount(tx.From, senderAccount)
+	// Pay the priority fee to the block producer, the base fee is burned
+	burnedFee := ee.payFees(gasPrice, header, gasUsed)
+
+	logs := ee.stateDB.GetLogs()[logStart:]
+	for _, log := range logs {
+		log.TxHash = tx.Hash
+		if header != nil {
+			log.BlockNumber = header.Number.Uint64()
+		}
+	}
+	ee.stateDB.FinaliseTransaction()
+
+	status := uint64(1)
+	if vmErr != nil {
+		status = 0
+	}
 
-	return &ExecutionResult{
+	result := &ExecutionResult{
 		GasUsed:         gasUsed,
-		Status:          1,
+		Status:          status,
 		Logs:            logs,
 		ContractAddress: contractAddress,
-		Error:           nil,
-	}, nil
+		BurnedFee:       burnedFee,
+		ReturnData:      returnData,
+		Error:           vmErr,
+	}
+	if tracer != nil {
+		tracer.CaptureTxEnd(result)
+	}
+	return result, nil
 }
 
-// validateSignature validates the transaction signature
-func (ee *ExecutionEngine) validateSignature(tx *Transaction) error {
-	// Recreate transaction hash for signature verification
-	hash := tx.CalculateHash()
-	
-	// Combine V, R, S into signature
-	signature := make([]byte, 65)
-	copy(signature[:32], tx.R.Bytes())
-	copy(signature[32:64], tx.S.Bytes())
-	signature[64] = byte(tx.V.Uint64())
-
-	// Recover address from signature
-	recoveredAddr, err := crypto.RecoverAddressFunc(hash, signature)
-	if err != nil {
-		return ErrInvalidSignature
+// IntrinsicGas computes the gas a transaction costs before any code runs:
+// the base cost, the cost of the data bytes and the access list, and for
+// contract creations the creation surcharge and the init code word cost
+func IntrinsicGas(data []byte, accessList AccessList, isContractCreation bool) (uint64, error) {
+	gas := uint64(TxGas)
+	if isContractCreation {
+		gas = TxGas + TxGasContractCreation
+	}
+	if len(accessList) > 0 {
+		gas += uint64(len(accessList)) * TxAccessListAddressGas
+		gas += uint64(accessList.StorageKeys()) * TxAccessListStorageKeyGas
+	}
+	if len(data) == 0 {
+		return gas, nil
 	}
 
-	// Check if recovered address matches the from address
-	if !recoveredAddr.Equal(tx.From) {
-		return ErrInvalidSignature
+	nonZero := uint64(0)
+	for _, b := range data {
+		if b != 0 {
+			nonZero++
+		}
 	}
+	zero := uint64(len(data)) - nonZero
 
-	return nil
-}
+	if (math.MaxUint64-gas)/TxDataNonZeroGas < nonZero {
+		return 0, ErrGasUintOverflow
+	}
+	gas += nonZero * TxDataNonZeroGas
 
-// generateContractAddress generates a contract address from sender and nonce
-func (ee *ExecutionEngine) generateContractAddress(sender crypto.Address, nonce uint64) crypto.Address {
-	// Simple implementation: hash(sender + nonce)
-	data := append(sender.Bytes(), big.NewInt(int64(nonce)).Bytes()...)
-	hash := crypto.BytesToHash(crypto.Keccak256(data))
-	var addr crypto.Address
-	copy(addr[:], hash[12:])
-	return addr
-}
+	if (math.MaxUint64-gas)/TxDataZeroGas < zero {
+		return 0, ErrGasUintOverflow
+	}
+	gas += zero * TxDataZeroGas
 
-// contractExecutionResult represents the result of contract execution
-type contractExecutionResult struct {
-	logs []*Log
+	if isContractCreation {
+		words := (uint64(len(data)) + 31) / 32
+		if (math.MaxUint64-gas)/InitCodeWordGas < words {
+			return 0, ErrGasUintOverflow
+		}
+		gas += words * InitCodeWordGas
+	}
+	return gas, nil
 }
 
-// executeContractCreation executes contract creation logic
-func (ee *ExecutionEngine) executeContractCreation(tx *Transaction, contractAddr crypto.Address, gasUsed *uint64) (*contractExecutionResult, error) {
-	// Custom contract creation logic
-	// For this implementation, we'll use a simple interpretation of the data field
-	
-	// Add base contract creation gas cost
-	*gasUsed += 32000
-
-	if *gasUsed > tx.GasLimit {
-		return nil, ErrGasLimitExceeded
+// newVM creates the contract interpreter for a transaction, nil if none is
+// configured
+func (ee *ExecutionEngine) newVM(tx *Transaction, header *BlockHeader, gasPrice *big.Int) VM {
+	if ee.config.VM == nil {
+		return nil
 	}
 
-	// Create a log for contract creation
-	log := &Log{
-		Address: contractAddr,
-		Topics:  []crypto.Hash{crypto.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000001")}, // Contract created
-		Data:    tx.Data,
+	block := BlockContext{
+		ChainID: ee.config.ChainID,
+		GetHash: ee.config.GetHash,
+	}
+	if header != nil {
+		block.Coinbase = header.Coinbase
+		block.Number = header.Number
+		block.Time = header.Timestamp
+		block.Difficulty = header.Difficulty
+		block.GasLimit = header.GasLimit
+		block.BaseFee = header.BaseFee
 	}
 
-	return &contractExecutionResult{
-		logs: []*Log{log},
-	}, nil
+	return ee.config.VM(ee.stateDB, block, TxContext{
+		Origin:   tx.From,
+		GasPrice: gasPrice,
+		Tracer:   ee.config.Tracer,
+	})
 }
 
-// executeContractCall executes contract call logic
-func (ee *ExecutionEngine) executeContractCall(tx *Transaction, contractAddr crypto.Address, gasUsed *uint64) (*contractExecutionResult, error) {
-	// Custom contract call logic
-	// For this implementation, we'll use a simple interpretation system
-	
-	// Add base contract call gas cost
-	*gasUsed += 700
-
-	if *gasUsed > tx.GasLimit {
-		return nil, ErrGasLimitExceeded
-	}
-
-	// Simple contract execution based on data field
-	if len(tx.Data) >= 4 {
-		// Extract function selector (first 4 bytes)
-		selector := tx.Data[:4]
-		
-		// Simple function implementations
-		switch crypto.BytesToHash(selector).Hex() {
-		case "0xa9059cbb": // transfer(address,uint256)
-			return ee.executeTransfer(tx, contractAddr, gasUsed)
-		case "0x70a08231": // balanceOf(address)
-			return ee.executeBalanceOf(tx, contractAddr, gasUsed)
-		default:
-			// Unknown function, just create a generic log
-			log := &Log{
-				Address: contractAddr,
-				Topics:  []crypto.Hash{crypto.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000002")}, // Function called
-				Data:    tx.Data,
-			}
-			return &contractExecutionResult{logs: []*Log{log}}, nil
-		}
+// payFees credits the block coinbase with the priority fee for the gas used
+// at the effective gas price and returns the amount of base fee burned
+func (ee *ExecutionEngine) payFees(gasPrice *big.Int, header *BlockHeader, gasUsed uint64) *big.Int {
+	burned := big.NewInt(0)
+	if header == nil {
+		return burned
 	}
 
-	return &contractExecutionResult{logs: []*Log{}}, nil
-}
-
-// executeTransfer executes a token transfer function
-func (ee *ExecutionEngine) executeTransfer(tx *Transaction, contractAddr crypto.Address, gasUsed *uint64) (*contractExecutionResult, error) {
-	*gasUsed += 5000
+	gas := new(big.Int).SetUint64(gasUsed)
+	reward := new(big.Int).Mul(EffectiveTip(gasPrice, header.BaseFee), gas)
+	if reward.Sign() > 0 {
+		balance := ee.stateDB.GetBalance(header.Coinbase)
+		ee.stateDB.SetBalance(header.Coinbase, balance.Add(balance, reward))
+	}
 
-	if *gasUsed > tx.GasLimit {
-		return nil, ErrGasLimitExceeded
+	if header.BaseFee != nil {
+		burned.Mul(header.BaseFee, gas)
 	}
+	return burned
+}
 
-	// Create transfer event log
-	log := &Log{
-		Address: contractAddr,
-		Topics: []crypto.Hash{
-			crypto.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"), // Transfer event
-			crypto.BytesToHash(tx.From.Bytes()),                                                    // from
-		},
-		Data: tx.Data[4:], // Parameters
+// validateType rejects unknown transaction types and transactions signed
+// for another chain
+func (ee *ExecutionEngine) validateType(tx *Transaction) error {
+	switch tx.Type {
+	case LegacyTxType, AccessListTxType, DynamicFeeTxType:
+	default:
+		return ErrTxTypeNotSupported
+	}
+	if ee.simulate {
+		return nil
 	}
 
-	return &contractExecutionResult{logs: []*Log{log}}, nil
+	// Legacy transactions without replay protection carry no chain id
+	chainID := tx.ChainIDOf()
+	if chainID == nil && tx.Type == LegacyTxType {
+		return nil
+	}
+	if chainID == nil || chainID.Cmp(ee.config.ChainID) != 0 {
+		return ErrInvalidChainID
+	}
+	return nil
 }
 
-// executeBalanceOf executes a balance query function
-func (ee *ExecutionEngine) executeBalanceOf(tx *Transaction, contractAddr crypto.Address, gasUsed *uint64) (*contractExecutionResult, error) {
-	*gasUsed += 400
+// validateSignature validates the transaction signature
+func (ee *ExecutionEngine) validateSignature(tx *Transaction) error {
+	// Recover address from signature, usually already cached by the
+	// parallel recovery that runs ahead of block execution
+	recoveredAddr, err := senderCacher.sender(tx)
+	if err != nil {
+		return ErrInvalidSignature
+	}
 
-	if *gasUsed > tx.GasLimit {
-		return nil, ErrGasLimitExceeded
+	// Check if recovered address matches the from address
+	if !recoveredAddr.Equal(tx.From) {
+		return ErrInvalidSignature
 	}
 
-	// BalanceOf doesn't generate logs, just consumes gas
-	return &contractExecutionResult{logs: []*Log{}}, nil
+	return nil
 }
 
-// EstimateGas estimates gas for a transaction
-func (ee *ExecutionEngine) EstimateGas(tx *Transaction, header *BlockHeader) (uint64, error) {
-	// Create a copy of the state for simulation
-	stateDBCopy := ee.stateDB.Copy()
-	engineCopy := &ExecutionEngine{
-		stateDB: stateDBCopy,
-		config:  ee.config,
-	}
-
-	// Simulate execution
-	result, err := engineCopy.ExecuteTransaction(tx, header)
+// EstimateGas estimates gas for a transaction, with overrides applied to
+// the state first. A reverting transaction returns a RevertError carrying
+// the revert reason.
+func (ee *ExecutionEngine) EstimateGas(tx *Transaction, header *BlockHeader, overrides StateOverride) (uint64, error) {
+	result, err := ee.simulateTransaction(tx, header, overrides)
 	if err != nil {
 		return 0, err
 	}
+	if result.Error == ErrExecutionReverted {
+		return 0, newRevertError(result)
+	}
+	if result.Error != nil {
+		return 0, result.Error
+	}
 
 	// Add 10% buffer to the gas used
 	estimatedGas := result.GasUsed * 11 / 10
 	return estimatedGas, nil
 }
 
-// Call simulates a transaction call without state changes
-func (ee *ExecutionEngine) Call(tx *Transaction, header *BlockHeader) ([]byte, error) {
-	// Create a copy of the state for simulation
-	stateDBCopy := ee.stateDB.Copy()
-	engineCopy := &ExecutionEngine{
-		stateDB: stateDBCopy,
-		config:  ee.config,
-	}
-
-	// Simulate execution
-	_, err := engineCopy.ExecuteTransaction(tx, header)
+// Call simulates a transaction call without state changes, with overrides
+// applied to the state first, and returns the output of the call. A
+// reverting call returns a RevertError carrying the revert reason.
+func (ee *ExecutionEngine) Call(tx *Transaction, header *BlockHeader, overrides StateOverride) ([]byte, error) {
+	result, err := ee.simulateTransaction(tx, header, overrides)
 	if err != nil {
 		return nil, err
 	}
+	if result.Error == ErrExecutionReverted {
+		return nil, newRevertError(result)
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return result.ReturnData, nil
+}
+
+// simulateTransaction executes an unsigned message on a copy of the state.
+// Missing gas price and value default to zero, a missing gas limit to the
+// block gas limit.
+func (ee *ExecutionEngine) simulateTransaction(tx *Transaction, header *BlockHeader, overrides StateOverride) (*ExecutionResult, error) {
+	msg := *tx
+	if msg.GasPrice == nil {
+		msg.GasPrice = big.NewInt(0)
+	}
+	if msg.Value == nil {
+		msg.Value = big.NewInt(0)
+	}
+	if msg.GasLimit == 0 {
+		msg.GasLimit = ee.config.BlockGasLimit
+	}
 
-	// For this simple implementation, return empty data
-	// In a real implementation, this would return the contract's return data
-	return []byte{}, nil
+	engineCopy := &ExecutionEngine{
+		stateDB:  ee.stateDB.Copy(),
+		config:   ee.config,
+		simulate: true,
+	}
+	if err := overrides.Apply(engineCopy.stateDB); err != nil {
+		return nil, err
+	}
+	return engineCopy.ExecuteTransaction(&msg, header)
 }
 
 // GetGasPrice returns the minimum gas price
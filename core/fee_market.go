@@ -0,0 +1,82 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// EIP-1559 fee market parameters
+const (
+	InitialBaseFee           = 1000000000 // Base fee of the genesis block (1 Gwei)
+	BaseFeeChangeDenominator = 8          // Bounds the base fee change per block to 12.5%
+	ElasticityMultiplier     = 2          // Bounds the maximum gas limit relative to the gas target
+)
+
+var (
+	ErrFeeCapTooLow = errors.New("gas price below block base fee")
+)
+
+// CalcBaseFee calculates the base fee of the block following parent
+func CalcBaseFee(parent *BlockHeader) *big.Int {
+	// Blocks created before the fee market start from the initial base fee
+	if parent.BaseFee == nil {
+		return big.NewInt(InitialBaseFee)
+	}
+
+	parentGasTarget := parent.GasLimit / ElasticityMultiplier
+	if parentGasTarget == 0 || parent.GasUsed == parentGasTarget {
+		return new(big.Int).Set(parent.BaseFee)
+	}
+
+	if parent.GasUsed > parentGasTarget {
+		// Block was more than half full, increase the base fee
+		gasUsedDelta := new(big.Int).SetUint64(parent.GasUsed - parentGasTarget)
+		delta := new(big.Int).Mul(parent.BaseFee, gasUsedDelta)
+		delta.Div(delta, new(big.Int).SetUint64(parentGasTarget))
+		delta.Div(delta, big.NewInt(BaseFeeChangeDenominator))
+		if delta.Sign() == 0 {
+			delta.SetUint64(1)
+		}
+		return delta.Add(delta, parent.BaseFee)
+	}
+
+	// Block was less than half full, decrease the base fee
+	gasUsedDelta := new(big.Int).SetUint64(parentGasTarget - parent.GasUsed)
+	delta := new(big.Int).Mul(parent.BaseFee, gasUsedDelta)
+	delta.Div(delta, new(big.Int).SetUint64(parentGasTarget))
+	delta.Div(delta, big.NewInt(BaseFeeChangeDenominator))
+
+	baseFee := new(big.Int).Sub(parent.BaseFee, delta)
+	if baseFee.Sign() < 0 {
+		baseFee.SetUint64(0)
+	}
+	return baseFee
+}
+
+// VerifyBaseFee checks that the base fee of header follows from its parent
+func VerifyBaseFee(parent, header *BlockHeader) error {
+	if header.BaseFee == nil {
+		return fmt.Errorf("header is missing base fee")
+	}
+
+	expected := CalcBaseFee(parent)
+	if header.BaseFee.Cmp(expected) != 0 {
+		return fmt.Errorf("invalid base fee: expected %s, got %s",
+			expected.String(), header.BaseFee.String())
+	}
+	return nil
+}
+
+// EffectiveTip returns the part of the gas price paid to the block producer
+// once the base fee has been burned
+func EffectiveTip(gasPrice, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return new(big.Int).Set(gasPrice)
+	}
+	tip := new(big.Int).Sub(gasPrice, baseFee)
+	if tip.Sign() < 0 {
+		tip.SetUint64(0)
+	}
+	return tip
+}
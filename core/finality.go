@@ -0,0 +1,109 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"blockchain-node/crypto"
+	"blockchain-node/logger"
+)
+
+// ErrReorgBelowFinalized is returned for side chains that fork off below the
+// finalized block
+var ErrReorgBelowFinalized = errors.New("fork below finalized block")
+
+// finalizedBlockKey is the key of the hash of the finalized block in the
+// meta table
+var finalizedBlockKey = []byte("finalized-block")
+
+// SafeBlock returns the latest block with at least SafeDepth confirmations.
+// It is never older than the finalized block.
+func (bc *Blockchain) SafeBlock() *Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	var depth uint64
+	if bc.config != nil {
+		depth = bc.config.SafeDepth
+	}
+	block, err := bc.getBlockByNumber(bc.confirmedNumber(depth))
+	if err != nil || (bc.finalized != nil && block.Header.Number.Cmp(bc.finalized.Header.Number) < 0) {
+		return bc.finalized
+	}
+	return block
+}
+
+// FinalizedBlock returns the latest block that can no longer be reorganized
+// away, the genesis block while finality is disabled
+func (bc *Blockchain) FinalizedBlock() *Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.finalized
+}
+
+// confirmedNumber returns the number of the canonical block with the given
+// number of confirmations on top of it, the caller must hold bc.mu
+func (bc *Blockchain) confirmedNumber(depth uint64) *big.Int {
+	head := bc.currentBlock.Header.Number.Uint64()
+	if head < depth {
+		return big.NewInt(0)
+	}
+	return new(big.Int).SetUint64(head - depth)
+}
+
+// loadFinalized restores the finalized block marker on startup
+func (bc *Blockchain) loadFinalized() {
+	bc.finalized = bc.genesis
+	if hashData, err := bc.tables.Meta.Get(finalizedBlockKey); err == nil {
+		if block, err := bc.getBlockByHash(crypto.BytesToHash(hashData)); err == nil {
+			bc.finalized = block
+		}
+	}
+	bc.updateFinalized()
+}
+
+// updateFinalized advances the finalized block after the head changed. Undo
+// records of finalized blocks are no longer needed and are dropped. The
+// caller must hold bc.mu.
+func (bc *Blockchain) updateFinalized() {
+	if bc.config == nil || bc.config.FinalityDepth == 0 {
+		return
+	}
+
+	number := bc.confirmedNumber(bc.config.FinalityDepth)
+	if bc.finalized != nil && number.Cmp(bc.finalized.Header.Number) <= 0 {
+		return
+	}
+	block, err := bc.getBlockByNumber(number)
+	if err != nil {
+		logger.Error("Failed to load finalized block", "number", number.String(), "error", err)
+		return
+	}
+	if err := bc.tables.Meta.Put(finalizedBlockKey, block.Hash.Bytes()); err != nil {
+		logger.Error("Failed to store finalized block", "number", number.String(), "error", err)
+		return
+	}
+
+	from := big.NewInt(1)
+	if bc.finalized != nil {
+		from = new(big.Int).Add(bc.finalized.Header.Number, big.NewInt(1))
+	}
+	for n := from; n.Cmp(number) <= 0; n.Add(n, big.NewInt(1)) {
+		if hash, ok := bc.getCanonicalHash(n); ok {
+			bc.tables.Undo.Delete(hash.Bytes())
+		}
+	}
+
+	bc.finalized = block
+}
+
+// checkFinality rejects blocks that would reorganize finalized blocks away.
+// The caller must hold bc.mu.
+func (bc *Blockchain) checkFinality(forkNumber *big.Int) error {
+	if bc.finalized == nil || forkNumber.Cmp(bc.finalized.Header.Number) >= 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: fork at %s, finalized %s", ErrReorgBelowFinalized,
+		forkNumber.String(), bc.finalized.Header.Number.String())
+}
@@ -0,0 +1,215 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+
+	"blockchain-node/crypto"
+)
+
+// tdWorkKey marks databases whose total difficulties are sums of block work,
+// older ones stored sums of difficulties
+var tdWorkKey = []byte("td-work")
+
+// BlockWork returns the work proven by a header. Its difficulty counts the
+// leading zero bits of the seal hash, so finding a seal takes 2^difficulty
+// hashes on average. Proof-of-stake headers all have difficulty 1 and weigh
+// the same.
+func BlockWork(header *BlockHeader) *big.Int {
+	bits := uint(0)
+	if d := header.Difficulty; d != nil && d.Sign() > 0 {
+		bits = 256
+		if d.IsUint64() && d.Uint64() < 256 {
+			bits = uint(d.Uint64())
+		}
+	}
+	return new(big.Int).Lsh(big.NewInt(1), bits)
+}
+
+// GetTotalDifficulty returns the total difficulty of the chain ending at the
+// given block, nil if the block is unknown
+func (bc *Blockchain) GetTotalDifficulty(hash crypto.Hash) *big.Int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.getTd(hash)
+}
+
+// getTd loads the total difficulty of a block, the caller must hold bc.mu
+func (bc *Blockchain) getTd(hash crypto.Hash) *big.Int {
+	data, err := bc.tables.Difficulty.Get(hash.Bytes())
+	if err != nil {
+		return nil
+	}
+	return new(big.Int).SetBytes(data)
+}
+
+// writeTd stores the total difficulty of a block
+func (bc *Blockchain) writeTd(hash crypto.Hash, td *big.Int) error {
+	return bc.tables.Difficulty.Put(hash.Bytes(), td.Bytes())
+}
+
+// migrateTd recomputes the total difficulties of a database from before
+// they were sums of block work. Blocks whose ancestry is incomplete keep
+// their old value, they cannot become the head anyway.
+func (bc *Blockchain) migrateTd() error {
+	if done, _ := bc.tables.Meta.Has(tdWorkKey); done {
+		return nil
+	}
+
+	var hashes []crypto.Hash
+	it := bc.tables.Difficulty.NewIterator(nil, nil)
+	for it.Next() {
+		if len(it.Key()) == crypto.HashLength {
+			hashes = append(hashes, crypto.BytesToHash(it.Key()))
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return fmt.Errorf("failed to read total difficulties: %v", err)
+	}
+
+	tds := make(map[crypto.Hash]*big.Int, len(hashes))
+	batch := bc.tables.Difficulty.NewBatch()
+	for _, hash := range hashes {
+		// Walk back to a block with a known total, then sum forward
+		var path []crypto.Hash
+		var headers []*BlockHeader
+		td := new(big.Int)
+		for current := hash; tds[current] == nil; {
+			header := bc.getHeader(current)
+			if header == nil {
+				td = nil
+				break
+			}
+			path, headers = append(path, current), append(headers, header)
+			if header.Number.Sign() == 0 {
+				break
+			}
+			current = header.PreviousHash
+			if tds[current] != nil {
+				td.Set(tds[current])
+			}
+		}
+		if td == nil {
+			continue
+		}
+		for i := len(path) - 1; i >= 0; i-- {
+			td = new(big.Int).Add(td, BlockWork(headers[i]))
+			tds[path[i]] = td
+			if err := batch.Put(path[i].Bytes(), td.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("failed to store total difficulties: %v", err)
+	}
+	return bc.tables.Meta.Put(tdWorkKey, []byte{1})
+}
+
+// reorg makes newHead the head of the canonical chain. The state is rewound
+// to the common ancestor using the undo records of the old blocks and the
+// new blocks are executed on top of it. Nothing is written unless every new
+// block executes successfully.
+func (bc *Blockchain) reorg(newHead *Block) error {
+	oldHead := bc.currentBlock
+	oldChain, newChain, err := bc.forkChains(oldHead, newHead)
+	if err != nil {
+		return fmt.Errorf("reorg failed: %v", err)
+	}
+	forkNumber := new(big.Int).Sub(newChain[len(newChain)-1].Header.Number, big.NewInt(1))
+	if err := bc.checkFinality(forkNumber); err != nil {
+		return err
+	}
+
+	// Rewind the state to the common ancestor, newest block first
+	state := bc.stateDB.Copy()
+	for _, block := range oldChain {
+		undo, err := bc.readStateUndo(block.Hash)
+		if err != nil {
+			return fmt.Errorf("reorg failed: %v", err)
+		}
+		undo.apply(state)
+	}
+
+	// Execute the new chain, oldest block first
+	receipts := make([][]*TransactionReceipt, len(newChain))
+	undos := make([]*stateUndo, len(newChain))
+	for i := len(newChain) - 1; i >= 0; i-- {
+		block := newChain[i]
+		blockState := state.Copy()
+		blockReceipts, err := bc.processBlock(block, blockState)
+		if err != nil {
+			bc.reportBadBlock(block, err)
+			return fmt.Errorf("reorg failed: block %x: %v", block.Hash, err)
+		}
+		receipts[i] = blockReceipts
+		undos[i] = newStateUndo(state, blockState)
+		state = blockState
+	}
+
+	for i, block := range newChain {
+		if err := bc.writeReceipts(block.Hash, receipts[i]); err != nil {
+			return fmt.Errorf("failed to store receipts: %v", err)
+		}
+		if err := bc.writeStateUndo(block.Hash, undos[i]); err != nil {
+			return fmt.Errorf("failed to store state undo: %v", err)
+		}
+	}
+	if _, err := state.CommitBlock(newHead.Hash); err != nil {
+		return fmt.Errorf("failed to commit state: %v", err)
+	}
+	if _, err := bc.writeCanonicalChain(newHead); err != nil {
+		return fmt.Errorf("failed to update canonical chain: %v", err)
+	}
+	if err := bc.writeHeadHash(newHead.Hash); err != nil {
+		return fmt.Errorf("failed to update head: %v", err)
+	}
+
+	bc.currentBlock = newHead
+	bc.stateDB = state
+	bc.updateFinalized()
+	bc.freeze()
+	bc.unindexTxs()
+
+	added := make([]*Block, len(newChain))
+	for i, block := range newChain {
+		added[len(newChain)-1-i] = block
+	}
+	bc.queueHeadEvent(ChainHeadEvent{Head: newHead, Added: added, Removed: oldChain})
+	return nil
+}
+
+// forkChains walks back from both heads to their common ancestor and returns
+// the blocks of each branch above it, newest first
+func (bc *Blockchain) forkChains(oldHead, newHead *Block) ([]*Block, []*Block, error) {
+	var (
+		oldChain, newChain []*Block
+		oldBlock, newBlock = oldHead, newHead
+		err                error
+	)
+
+	for oldBlock.Header.Number.Cmp(newBlock.Header.Number) > 0 {
+		oldChain = append(oldChain, oldBlock)
+		if oldBlock, err = bc.getBlockByHash(oldBlock.Header.PreviousHash); err != nil {
+			return nil, nil, fmt.Errorf("invalid old chain: %v", err)
+		}
+	}
+	for newBlock.Header.Number.Cmp(oldBlock.Header.Number) > 0 {
+		newChain = append(newChain, newBlock)
+		if newBlock, err = bc.getBlockByHash(newBlock.Header.PreviousHash); err != nil {
+			return nil, nil, fmt.Errorf("invalid new chain: %v", err)
+		}
+	}
+	for !oldBlock.Hash.Equal(newBlock.Hash) {
+		oldChain = append(oldChain, oldBlock)
+		newChain = append(newChain, newBlock)
+		if oldBlock, err = bc.getBlockByHash(oldBlock.Header.PreviousHash); err != nil {
+			return nil, nil, fmt.Errorf("invalid old chain: %v", err)
+		}
+		if newBlock, err = bc.getBlockByHash(newBlock.Header.PreviousHash); err != nil {
+			return nil, nil, fmt.Errorf("invalid new chain: %v", err)
+		}
+	}
+	return oldChain, newChain, nil
+}
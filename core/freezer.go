@@ -0,0 +1,159 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"blockchain-node/crypto"
+	"blockchain-node/logger"
+	"blockchain-node/storage"
+)
+
+// frozenItemsKey is the key of the number of freezer items whose blocks
+// have been removed from the block and receipt tables, in the meta table
+var frozenItemsKey = []byte("frozen-items")
+
+// freezeBatchLimit caps the blocks moved per head change, so that enabling
+// the freezer on a long chain does not stall block imports
+const freezeBatchLimit = 1000
+
+// SetFreezer makes the chain move canonical blocks and their receipts more
+// than cutoff blocks below the head, and never above the finalized block,
+// to freezer. The database of the chain must read through to the freezer,
+// see storage.NewFreezerDB. Freezer item n holds block number n.
+func (bc *Blockchain) SetFreezer(freezer *storage.Freezer, cutoff uint64) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.freezer = freezer
+	bc.freezeCutoff = cutoff
+	bc.freeze()
+}
+
+// freeze moves the blocks that passed the cutoff to the freezer. Failures
+// are logged, the blocks stay in the database and are moved after the next
+// head change. The caller must hold bc.mu.
+func (bc *Blockchain) freeze() {
+	if bc.freezer == nil {
+		return
+	}
+	if err := bc.freezeBlocks(); err != nil {
+		logger.Error("Failed to move blocks to the freezer", "error", err)
+	}
+}
+
+// freezeBlocks appends the blocks below the cutoff to the freezer, syncs
+// it and only then removes them from the database. Blocks appended before
+// a crash interrupted the removal are removed on the next call.
+func (bc *Blockchain) freezeBlocks() error {
+	head := bc.currentBlock.Header.Number.Uint64()
+	if head <= bc.freezeCutoff {
+		return nil
+	}
+	limit := head - bc.freezeCutoff
+	if bc.config != nil && bc.config.FinalityDepth > 0 && bc.finalized != nil {
+		if finalized := bc.finalized.Header.Number.Uint64(); finalized < limit {
+			limit = finalized
+		}
+	}
+
+	done, err := bc.frozenItems()
+	if err != nil {
+		return err
+	}
+	items := bc.freezer.Items()
+	if items < done {
+		return fmt.Errorf("%w: freezer holds %d blocks, %d were frozen", storage.ErrCorrupted, items, done)
+	}
+	if limit > done+freezeBatchLimit {
+		limit = done + freezeBatchLimit
+	}
+	if limit <= done {
+		return nil
+	}
+
+	hashes := make([]crypto.Hash, 0, limit-done)
+	for number := done; number < limit; number++ {
+		if number < items {
+			// Frozen before a crash, the freezer has the block
+			data, err := bc.freezer.Retrieve(storage.FreezerBlocks, number)
+			if err != nil {
+				return err
+			}
+			block, err := deserializeBlock(data)
+			if err != nil {
+				return fmt.Errorf("frozen block %d: %v", number, err)
+			}
+			hashes = append(hashes, block.Hash)
+			continue
+		}
+
+		hash, ok := bc.getCanonicalHash(new(big.Int).SetUint64(number))
+		if !ok {
+			return fmt.Errorf("missing canonical block %d", number)
+		}
+		block, err := bc.tables.Blocks.Get(hash.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to read block %d: %v", number, err)
+		}
+		receipts, err := bc.tables.Receipts.Get(hash.Bytes())
+		if err != nil && !errors.Is(err, storage.ErrKeyNotFound) {
+			return fmt.Errorf("failed to read receipts of block %d: %v", number, err)
+		}
+		if err := bc.freezer.Append(number, map[string][]byte{
+			storage.FreezerBlocks:   block,
+			storage.FreezerReceipts: receipts,
+		}); err != nil {
+			return err
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := bc.freezer.Sync(); err != nil {
+		return err
+	}
+
+	batch := bc.db.NewBatch()
+	frozen := bc.tables.Frozen.Batch(batch)
+	blocks := bc.tables.Blocks.Batch(batch)
+	receipts := bc.tables.Receipts.Batch(batch)
+	for i, hash := range hashes {
+		var enc [8]byte
+		binary.BigEndian.PutUint64(enc[:], done+uint64(i))
+		if err := frozen.Put(hash.Bytes(), enc[:]); err != nil {
+			return err
+		}
+		if err := blocks.Delete(hash.Bytes()); err != nil {
+			return err
+		}
+		if err := receipts.Delete(hash.Bytes()); err != nil {
+			return err
+		}
+	}
+	var enc [8]byte
+	binary.BigEndian.PutUint64(enc[:], limit)
+	if err := bc.tables.Meta.Batch(batch).Put(frozenItemsKey, enc[:]); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("failed to remove frozen blocks: %v", err)
+	}
+	logger.Debug("Moved blocks to the freezer", "from", done, "to", limit-1)
+	return nil
+}
+
+// frozenItems returns the number of blocks removed from the database after
+// they were frozen
+func (bc *Blockchain) frozenItems() (uint64, error) {
+	enc, err := bc.tables.Meta.Get(frozenItemsKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if len(enc) != 8 {
+		return 0, fmt.Errorf("%w: invalid frozen block count", storage.ErrCorrupted)
+	}
+	return binary.BigEndian.Uint64(enc), nil
+}
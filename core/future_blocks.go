@@ -0,0 +1,104 @@
+package core
+
+import (
+	"blockchain-node/crypto"
+)
+
+// maxFutureBlocks is the maximum number of blocks buffered while waiting for
+// their parent to be imported
+const maxFutureBlocks = 256
+
+// futureBlockPool buffers blocks that arrived before their parent, keyed by
+// the hash of the missing parent. It is not safe for concurrent use, the
+// blockchain guards it with its own lock.
+type futureBlockPool struct {
+	byParent map[crypto.Hash][]*Block
+	parentOf map[crypto.Hash]crypto.Hash // block hash -> parent hash
+	order    []crypto.Hash               // insertion order, oldest first
+}
+
+// newFutureBlockPool creates an empty future block pool
+func newFutureBlockPool() *futureBlockPool {
+	return &futureBlockPool{
+		byParent: make(map[crypto.Hash][]*Block),
+		parentOf: make(map[crypto.Hash]crypto.Hash),
+	}
+}
+
+// add buffers a block until its parent arrives, evicting the oldest buffered
+// block when the pool is full. It returns false if the block was known.
+func (fp *futureBlockPool) add(block *Block) bool {
+	if fp.has(block.Hash) {
+		return false
+	}
+
+	for len(fp.parentOf) >= maxFutureBlocks && len(fp.order) > 0 {
+		fp.evictOldest()
+	}
+
+	parent := block.Header.PreviousHash
+	fp.byParent[parent] = append(fp.byParent[parent], block)
+	fp.parentOf[block.Hash] = parent
+	fp.order = append(fp.order, block.Hash)
+	return true
+}
+
+// has checks whether a block is buffered in the pool
+func (fp *futureBlockPool) has(hash crypto.Hash) bool {
+	_, exists := fp.parentOf[hash]
+	return exists
+}
+
+// take removes and returns all blocks waiting for the given parent
+func (fp *futureBlockPool) take(parent crypto.Hash) []*Block {
+	blocks := fp.byParent[parent]
+	delete(fp.byParent, parent)
+
+	for _, block := range blocks {
+		delete(fp.parentOf, block.Hash)
+	}
+	fp.compactOrder()
+
+	return blocks
+}
+
+// len returns the number of buffered blocks
+func (fp *futureBlockPool) len() int {
+	return len(fp.parentOf)
+}
+
+// evictOldest drops the block that has been buffered the longest
+func (fp *futureBlockPool) evictOldest() {
+	hash := fp.order[0]
+	fp.order = fp.order[1:]
+
+	parent, exists := fp.parentOf[hash]
+	if !exists {
+		return
+	}
+	delete(fp.parentOf, hash)
+
+	siblings := fp.byParent[parent]
+	for i, block := range siblings {
+		if block.Hash == hash {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(fp.byParent, parent)
+	} else {
+		fp.byParent[parent] = siblings
+	}
+}
+
+// compactOrder drops hashes of blocks that have already left the pool
+func (fp *futureBlockPool) compactOrder() {
+	order := fp.order[:0]
+	for _, hash := range fp.order {
+		if _, exists := fp.parentOf[hash]; exists {
+			order = append(order, hash)
+		}
+	}
+	fp.order = order
+}
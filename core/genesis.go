@@ -0,0 +1,376 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"blockchain-node/crypto"
+	"blockchain-node/storage"
+)
+
+// ErrGenesisMismatch is returned when a database holds the chain of another
+// genesis block
+var ErrGenesisMismatch = errors.New("database holds a different genesis block")
+
+// chainConfigKey is the key of the chain configuration written by
+// SetupGenesis in the meta table
+var chainConfigKey = []byte("chain-config")
+
+// GenesisAccount is an account of the genesis state
+type GenesisAccount struct {
+	Balance *big.Int
+	Nonce   uint64
+	Code    []byte
+	Storage map[crypto.Hash]crypto.Hash
+}
+
+// genesisJSON is the format of genesis files. Alloc entries have the
+// format of state dumps, so the accounts of a dump can seed a new chain.
+type genesisJSON struct {
+	Config     *chainConfigJSON              `json:"config"`
+	Nonce      *jsonBig                      `json:"nonce,omitempty"`
+	Timestamp  *jsonBig                      `json:"timestamp,omitempty"`
+	ExtraData  string                        `json:"extraData,omitempty"`
+	GasLimit   *jsonBig                      `json:"gasLimit,omitempty"`
+	Difficulty *jsonBig                      `json:"difficulty,omitempty"`
+	Coinbase   string                        `json:"coinbase,omitempty"`
+	BaseFee    *jsonBig                      `json:"baseFeePerGas,omitempty"`
+	Alloc      map[string]genesisAccountJSON `json:"alloc,omitempty"`
+}
+
+// genesisAccountJSON is an alloc entry of a genesis file
+type genesisAccountJSON struct {
+	Balance *jsonBig          `json:"balance"`
+	Nonce   *jsonBig          `json:"nonce,omitempty"`
+	Code    string            `json:"code,omitempty"`
+	Storage map[string]string `json:"storage,omitempty"`
+}
+
+// chainConfigJSON is a ChainConfig as found in genesis files and stored by
+// SetupGenesis. Checkpoints and the safe and finality depths are settings
+// of the node rather than the chain and are left out.
+type chainConfigJSON struct {
+	ChainID          *jsonBig      `json:"chainId"`
+	CoinbaseMaturity uint64        `json:"coinbaseMaturity,omitempty"`
+	GasLimitTarget   uint64        `json:"gasLimitTarget,omitempty"`
+	StateRootBlock   uint64        `json:"stateRootBlock,omitempty"`
+	Emission         *emissionJSON `json:"emission,omitempty"`
+	PoS              *posJSON      `json:"pos,omitempty"`
+}
+
+type emissionJSON struct {
+	InitialReward     *jsonBig `json:"initialReward"`
+	ReductionInterval uint64   `json:"reductionInterval,omitempty"`
+	ReductionPercent  uint64   `json:"reductionPercent,omitempty"`
+	TailReward        *jsonBig `json:"tailReward,omitempty"`
+}
+
+type posJSON struct {
+	Period     uint64              `json:"period"`
+	Validators map[string]*jsonBig `json:"validators"`
+}
+
+// jsonBig is a non-negative integer read from a JSON number or a decimal or
+// 0x prefixed hex string, and written as a decimal string
+type jsonBig big.Int
+
+// UnmarshalJSON implements json.Unmarshaler
+func (b *jsonBig) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	var value *big.Int
+	var ok bool
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		value, ok = new(big.Int).SetString(s[2:], 16)
+	} else {
+		value, ok = new(big.Int).SetString(s, 10)
+	}
+	if !ok || value.Sign() < 0 {
+		return fmt.Errorf("invalid quantity %s", data)
+	}
+	*b = jsonBig(*value)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (b *jsonBig) MarshalJSON() ([]byte, error) {
+	return json.Marshal((*big.Int)(b).String())
+}
+
+// toBig returns a copy of b, nil if b is nil
+func (b *jsonBig) toBig() *big.Int {
+	if b == nil {
+		return nil
+	}
+	return new(big.Int).Set((*big.Int)(b))
+}
+
+// toUint64 returns b, def if b is nil
+func (b *jsonBig) toUint64(name string, def uint64) (uint64, error) {
+	if b == nil {
+		return def, nil
+	}
+	if !(*big.Int)(b).IsUint64() {
+		return 0, fmt.Errorf("%s out of range: %s", name, (*big.Int)(b))
+	}
+	return (*big.Int)(b).Uint64(), nil
+}
+
+// fromBig returns x as a jsonBig, nil if x is nil
+func fromBig(x *big.Int) *jsonBig {
+	if x == nil {
+		return nil
+	}
+	return (*jsonBig)(new(big.Int).Set(x))
+}
+
+// LoadGenesis reads a genesis file. Only the chain ID is required, missing
+// header fields take the values of DefaultGenesis, except the timestamp and
+// extra data which default to zero so the genesis block is reproducible.
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file genesisJSON
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid genesis file %s: %v", path, err)
+	}
+	if file.Config == nil || file.Config.ChainID == nil {
+		return nil, fmt.Errorf("genesis file %s has no config.chainId", path)
+	}
+
+	genesis := DefaultGenesis()
+	genesis.Timestamp = 0
+	genesis.ExtraData = nil
+	if genesis.Config, err = file.Config.toChainConfig(); err != nil {
+		return nil, err
+	}
+	if genesis.Nonce, err = file.Nonce.toUint64("nonce", 0); err != nil {
+		return nil, err
+	}
+	if genesis.Timestamp, err = file.Timestamp.toUint64("timestamp", 0); err != nil {
+		return nil, err
+	}
+	if genesis.GasLimit, err = file.GasLimit.toUint64("gasLimit", genesis.GasLimit); err != nil {
+		return nil, err
+	}
+	if file.ExtraData != "" {
+		if genesis.ExtraData, err = crypto.Decode(file.ExtraData); err != nil {
+			return nil, fmt.Errorf("invalid extraData: %v", err)
+		}
+	}
+	if file.Difficulty != nil {
+		genesis.Difficulty = file.Difficulty.toBig()
+	}
+	if file.Coinbase != "" {
+		if !crypto.IsHexAddress(file.Coinbase) {
+			return nil, fmt.Errorf("invalid coinbase %q", file.Coinbase)
+		}
+		genesis.Coinbase = crypto.HexToAddress(file.Coinbase)
+	}
+	if file.BaseFee != nil {
+		genesis.BaseFee = file.BaseFee.toBig()
+	}
+
+	for addr, entry := range file.Alloc {
+		if !crypto.IsHexAddress(addr) {
+			return nil, fmt.Errorf("invalid alloc address %q", addr)
+		}
+		account, err := entry.toGenesisAccount()
+		if err != nil {
+			return nil, fmt.Errorf("invalid alloc account %s: %v", addr, err)
+		}
+		genesis.Alloc[crypto.HexToAddress(addr)] = account
+	}
+	return genesis, nil
+}
+
+// toGenesisAccount converts an alloc entry
+func (a *genesisAccountJSON) toGenesisAccount() (GenesisAccount, error) {
+	account := GenesisAccount{Balance: a.Balance.toBig()}
+	if account.Balance == nil {
+		account.Balance = new(big.Int)
+	}
+	var err error
+	if account.Nonce, err = a.Nonce.toUint64("nonce", 0); err != nil {
+		return account, err
+	}
+	if a.Code != "" {
+		if account.Code, err = crypto.Decode(a.Code); err != nil {
+			return account, fmt.Errorf("invalid code: %v", err)
+		}
+	}
+	if len(a.Storage) > 0 {
+		account.Storage = make(map[crypto.Hash]crypto.Hash, len(a.Storage))
+		for key, value := range a.Storage {
+			account.Storage[crypto.HexToHash(key)] = crypto.HexToHash(value)
+		}
+	}
+	return account, nil
+}
+
+// toChainConfig converts the chain configuration of a genesis file
+func (c *chainConfigJSON) toChainConfig() (*ChainConfig, error) {
+	config := &ChainConfig{
+		ChainID:          c.ChainID.toBig(),
+		CoinbaseMaturity: c.CoinbaseMaturity,
+		GasLimitTarget:   c.GasLimitTarget,
+		StateRootBlock:   c.StateRootBlock,
+	}
+	if c.Emission != nil {
+		if c.Emission.InitialReward == nil {
+			return nil, fmt.Errorf("config.emission has no initialReward")
+		}
+		config.Emission = &EmissionConfig{
+			InitialReward:     c.Emission.InitialReward.toBig(),
+			ReductionInterval: c.Emission.ReductionInterval,
+			ReductionPercent:  c.Emission.ReductionPercent,
+			TailReward:        c.Emission.TailReward.toBig(),
+		}
+	}
+	if c.PoS != nil {
+		config.PoS = &PoSConfig{
+			Period:     c.PoS.Period,
+			Validators: make(map[crypto.Address]*big.Int, len(c.PoS.Validators)),
+		}
+		for addr, stake := range c.PoS.Validators {
+			if !crypto.IsHexAddress(addr) || stake == nil {
+				return nil, fmt.Errorf("invalid validator %q in config.pos", addr)
+			}
+			config.PoS.Validators[crypto.HexToAddress(addr)] = stake.toBig()
+		}
+	}
+	return config, nil
+}
+
+// toChainConfigJSON converts config for storage
+func toChainConfigJSON(config *ChainConfig) *chainConfigJSON {
+	c := &chainConfigJSON{
+		ChainID:          fromBig(config.ChainID),
+		CoinbaseMaturity: config.CoinbaseMaturity,
+		GasLimitTarget:   config.GasLimitTarget,
+		StateRootBlock:   config.StateRootBlock,
+	}
+	if config.Emission != nil {
+		c.Emission = &emissionJSON{
+			InitialReward:     fromBig(config.Emission.InitialReward),
+			ReductionInterval: config.Emission.ReductionInterval,
+			ReductionPercent:  config.Emission.ReductionPercent,
+			TailReward:        fromBig(config.Emission.TailReward),
+		}
+	}
+	if config.PoS != nil {
+		c.PoS = &posJSON{
+			Period:     config.PoS.Period,
+			Validators: make(map[string]*jsonBig, len(config.PoS.Validators)),
+		}
+		for addr, stake := range config.PoS.Validators {
+			c.PoS.Validators[addr.Hex()] = fromBig(stake)
+		}
+	}
+	return c
+}
+
+// ToBlock returns the genesis block. Its state root commits to the
+// allocated accounts, without any it stays empty like on chains created
+// before allocations were applied.
+func (g *Genesis) ToBlock() (*Block, error) {
+	block := NewGenesisBlock(g)
+	if len(g.Alloc) == 0 {
+		return block, nil
+	}
+	state := NewStateDB(storage.NewMemoryDB(), crypto.Hash{})
+	g.applyAlloc(state)
+	root, err := state.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute genesis state root: %v", err)
+	}
+	block.Header.StateRoot = root
+	block.Hash = block.CalculateHash()
+	return block, nil
+}
+
+// applyAlloc writes the allocated accounts to state
+func (g *Genesis) applyAlloc(state *StateDB) {
+	for addr, account := range g.Alloc {
+		if account.Balance != nil {
+			state.SetBalance(addr, account.Balance)
+		}
+		if account.Nonce > 0 {
+			state.SetNonce(addr, account.Nonce)
+		}
+		if len(account.Code) > 0 {
+			state.SetCode(addr, account.Code)
+		}
+		for key, value := range account.Storage {
+			state.SetStorage(addr, key, value)
+		}
+	}
+}
+
+// commitAlloc writes the allocated accounts to db as the state of block
+func (g *Genesis) commitAlloc(db storage.Database, block *Block) error {
+	state := NewStateDB(db, crypto.Hash{})
+	g.applyAlloc(state)
+	root, err := state.CommitBlock(block.Hash)
+	if err != nil {
+		return err
+	}
+	if root != block.Header.StateRoot {
+		return fmt.Errorf("genesis state root %s does not match block state root %s", root.Hex(), block.Header.StateRoot.Hex())
+	}
+	return nil
+}
+
+// SetupGenesis writes the genesis block, its state and the chain
+// configuration of genesis to db. A database already holding the same
+// genesis block only gets the configuration, one holding another genesis
+// block fails with ErrGenesisMismatch.
+func SetupGenesis(db storage.Database, genesis *Genesis) (*Block, error) {
+	block, err := genesis.ToBlock()
+	if err != nil {
+		return nil, err
+	}
+	tables := storage.NewTables(db)
+	if hashData, err := tables.Canonical.Get(big.NewInt(0).Bytes()); err == nil {
+		if stored := crypto.BytesToHash(hashData); !stored.Equal(block.Hash) {
+			return nil, fmt.Errorf("%w: have %s, genesis file has %s", ErrGenesisMismatch, stored.Hex(), block.Hash.Hex())
+		}
+	} else if !errors.Is(err, storage.ErrKeyNotFound) {
+		return nil, fmt.Errorf("failed to read genesis hash: %v", err)
+	} else if _, err := NewBlockchain(db, genesis); err != nil {
+		return nil, err
+	}
+
+	// Written last, so an interrupted setup is simply run again
+	data, err := json.Marshal(toChainConfigJSON(genesis.Config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal chain config: %v", err)
+	}
+	if err := tables.Meta.Put(chainConfigKey, data); err != nil {
+		return nil, fmt.Errorf("failed to store chain config: %v", err)
+	}
+	return block, nil
+}
+
+// ReadChainConfig returns the chain configuration stored by SetupGenesis.
+// The error wraps storage.ErrKeyNotFound for databases that were not set up
+// from a genesis file.
+func ReadChainConfig(db storage.Database) (*ChainConfig, error) {
+	data, err := storage.NewTables(db).Meta.Get(chainConfigKey)
+	if err != nil {
+		return nil, err
+	}
+	var config chainConfigJSON
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%w: invalid chain config: %v", storage.ErrCorrupted, err)
+	}
+	if config.ChainID == nil {
+		return nil, fmt.Errorf("%w: chain config without chain ID", storage.ErrCorrupted)
+	}
+	return config.toChainConfig()
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"blockchain-node/crypto"
+)
+
+// RewardLockAddress is the system account whose storage tracks the block
+// rewards that are not mature yet. Keeping them in the state makes them
+// follow reorganizations like balances do.
+var RewardLockAddress = crypto.HexToAddress("0x0000000000000000000000000000000000001001")
+
+// ErrImmatureBalance is returned for transactions that can only be paid by
+// spending block rewards that are not mature yet
+var ErrImmatureBalance = errors.New("insufficient mature balance")
+
+// LockedBalance returns the part of the balance of addr made of block
+// rewards that are not mature yet
+func LockedBalance(state *StateDB, addr crypto.Address) *big.Int {
+	return new(big.Int).SetBytes(state.GetStorage(RewardLockAddress, lockedKey(addr)).Bytes())
+}
+
+// SpendableBalance returns the balance of addr minus its immature rewards
+func SpendableBalance(state *StateDB, addr crypto.Address) *big.Int {
+	balance := state.GetBalance(addr)
+	if locked := LockedBalance(state, addr); locked.Sign() > 0 {
+		balance.Sub(balance, locked)
+		if balance.Sign() < 0 {
+			balance.SetInt64(0)
+		}
+	}
+	return balance
+}
+
+// rewardBalance is the balance of an account the consensus engine may
+// reward, before finalization
+type rewardBalance struct {
+	addr    crypto.Address
+	balance *big.Int
+}
+
+// lockRewards records the balance increases of the given accounts since
+// before as the immature rewards of block number
+func lockRewards(state *StateDB, number uint64, before []rewardBalance) {
+	count := uint64(0)
+	for _, prev := range before {
+		addr := prev.addr
+		reward := new(big.Int).Sub(state.GetBalance(addr), prev.balance)
+		if reward.Sign() <= 0 {
+			continue
+		}
+		locked := LockedBalance(state, addr)
+		state.SetStorage(RewardLockAddress, lockedKey(addr), crypto.BytesToHash(locked.Add(locked, reward).Bytes()))
+		state.SetStorage(RewardLockAddress, rewardKey(number, count), crypto.BytesToHash(addr.Bytes()))
+		state.SetStorage(RewardLockAddress, rewardAmountKey(number, count), crypto.BytesToHash(reward.Bytes()))
+		count++
+	}
+	if count > 0 {
+		state.SetStorage(RewardLockAddress, rewardCountKey(number), crypto.BytesToHash(new(big.Int).SetUint64(count).Bytes()))
+	}
+}
+
+// releaseRewards makes the rewards of block number spendable
+func releaseRewards(state *StateDB, number uint64) {
+	count := new(big.Int).SetBytes(state.GetStorage(RewardLockAddress, rewardCountKey(number)).Bytes()).Uint64()
+	for i := uint64(0); i < count; i++ {
+		addr := crypto.BytesToAddress(state.GetStorage(RewardLockAddress, rewardKey(number, i)).Bytes())
+		reward := new(big.Int).SetBytes(state.GetStorage(RewardLockAddress, rewardAmountKey(number, i)).Bytes())
+
+		locked := LockedBalance(state, addr)
+		if locked.Sub(locked, reward).Sign() < 0 {
+			locked.SetInt64(0)
+		}
+		state.SetStorage(RewardLockAddress, lockedKey(addr), crypto.BytesToHash(locked.Bytes()))
+		state.SetStorage(RewardLockAddress, rewardKey(number, i), crypto.Hash{})
+		state.SetStorage(RewardLockAddress, rewardAmountKey(number, i), crypto.Hash{})
+	}
+	if count > 0 {
+		state.SetStorage(RewardLockAddress, rewardCountKey(number), crypto.Hash{})
+	}
+}
+
+// rewardRecipients returns the balances of the coinbases of a block and of
+// its uncles, each account once and in order
+func rewardRecipients(state *StateDB, header *BlockHeader, uncles []*BlockHeader) []rewardBalance {
+	before := []rewardBalance{{header.Coinbase, state.GetBalance(header.Coinbase)}}
+	seen := map[crypto.Address]bool{header.Coinbase: true}
+	for _, uncle := range uncles {
+		if !seen[uncle.Coinbase] {
+			seen[uncle.Coinbase] = true
+			before = append(before, rewardBalance{uncle.Coinbase, state.GetBalance(uncle.Coinbase)})
+		}
+	}
+	return before
+}
+
+// coinbaseMaturity returns the number of blocks after which rewards can be
+// spent, 0 if they can be spent right away
+func (bc *Blockchain) coinbaseMaturity() uint64 {
+	if bc.config == nil {
+		return 0
+	}
+	return bc.config.CoinbaseMaturity
+}
+
+// lockedKey returns the slot of the immature rewards of addr
+func lockedKey(addr crypto.Address) crypto.Hash {
+	return crypto.Keccak256Hash([]byte("locked"), addr.Bytes())
+}
+
+// rewardCountKey returns the slot of the number of accounts rewarded by
+// block number
+func rewardCountKey(number uint64) crypto.Hash {
+	return rewardSlot("rewards", number, 0)
+}
+
+// rewardKey and rewardAmountKey return the slots of the account and the
+// amount of the index-th reward of block number
+func rewardKey(number, index uint64) crypto.Hash {
+	return rewardSlot("reward", number, index)
+}
+
+func rewardAmountKey(number, index uint64) crypto.Hash {
+	return rewardSlot("amount", number, index)
+}
+
+func rewardSlot(prefix string, number, index uint64) crypto.Hash {
+	var enc [16]byte
+	binary.BigEndian.PutUint64(enc[:8], number)
+	binary.BigEndian.PutUint64(enc[8:], index)
+	return crypto.Keccak256Hash([]byte(prefix), enc[:])
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"errors"
+
+	"blockchain-node/crypto"
+	"blockchain-node/rlp"
+	"blockchain-node/trie"
+)
+
+var (
+	// ErrInvalidTxRoot is returned for blocks whose transactions do not
+	// match the transactions root of their header
+	ErrInvalidTxRoot = errors.New("invalid transactions root")
+
+	// ErrInvalidReceiptsRoot is returned for blocks whose receipts do not
+	// match the receipts root of their header
+	ErrInvalidReceiptsRoot = errors.New("invalid receipts root")
+)
+
+// DeriveTxRoot returns the commitment of a header to its transactions: the
+// root of a trie mapping the RLP encoded index of each transaction to its
+// consensus encoding, the zero hash without transactions
+func DeriveTxRoot(txs []*Transaction) crypto.Hash {
+	values := make([][]byte, len(txs))
+	for i, tx := range txs {
+		values[i] = tx.Encode()
+	}
+	return deriveRoot(values)
+}
+
+// DeriveReceiptsRoot returns the commitment of a header to the receipts of
+// its transactions, like DeriveTxRoot with the consensus encoding of the
+// receipts
+func DeriveReceiptsRoot(receipts []*TransactionReceipt) crypto.Hash {
+	values := make([][]byte, len(receipts))
+	for i, receipt := range receipts {
+		values[i] = encodeReceipt(receipt)
+	}
+	return deriveRoot(values)
+}
+
+// deriveRoot returns the root of a trie holding values under their RLP
+// encoded index, the zero hash without values
+func deriveRoot(values [][]byte) crypto.Hash {
+	if len(values) == 0 {
+		return crypto.Hash{}
+	}
+	// The trie is only hashed, it never reads from or writes to a database
+	t, _ := trie.New(crypto.Hash{}, nil)
+	for i, value := range values {
+		t.Update(rlp.EncodeUint64(uint64(i)), value)
+	}
+	return t.Hash()
+}
+
+// encodeReceipt returns the consensus encoding of a receipt, the RLP list
+// of its status, cumulative gas used and logs. The other fields are derived
+// from the block and the transaction.
+func encodeReceipt(receipt *TransactionReceipt) []byte {
+	logs := make([][]byte, len(receipt.Logs))
+	for i, log := range receipt.Logs {
+		topics := make([][]byte, len(log.Topics))
+		for j, topic := range log.Topics {
+			topics[j] = rlp.EncodeBytes(topic.Bytes())
+		}
+		logs[i] = rlp.EncodeList(
+			rlp.EncodeBytes(log.Address.Bytes()),
+			rlp.EncodeList(topics...),
+			rlp.EncodeBytes(log.Data),
+		)
+	}
+	return rlp.EncodeList(
+		rlp.EncodeUint64(receipt.Status),
+		rlp.EncodeUint64(receipt.CumulativeGasUsed),
+		rlp.EncodeList(logs...),
+	)
+}
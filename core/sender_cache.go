@@ -0,0 +1,128 @@
+package core
+
+import (
+	"runtime"
+	"sync"
+
+	"blockchain-node/crypto"
+)
+
+// senderCacheSize is the maximum number of recovered senders remembered
+const senderCacheSize = 16384
+
+// senderCacher is shared by every execution engine so senders recovered
+// ahead of block execution (or during mempool admission) are not recovered
+// again
+var senderCacher = newSenderCache(senderCacheSize)
+
+// senderKey identifies a signature over a transaction. The claimed tx.Hash
+// cannot be trusted, so the signing hash and the signature itself are used.
+type senderKey struct {
+	hash crypto.Hash
+	sig  [65]byte
+}
+
+// senderCache remembers the addresses recovered from transaction signatures.
+// Signature recovery dominates the CPU cost of importing full blocks.
+type senderCache struct {
+	entries map[senderKey]crypto.Address
+	order   []senderKey // insertion order, oldest first
+	limit   int
+	mu      sync.Mutex
+}
+
+// newSenderCache creates a sender cache holding at most limit entries
+func newSenderCache(limit int) *senderCache {
+	return &senderCache{
+		entries: make(map[senderKey]crypto.Address),
+		limit:   limit,
+	}
+}
+
+// sender returns the address that signed the transaction, recovering and
+// caching it if it is not known yet
+func (sc *senderCache) sender(tx *Transaction) (crypto.Address, error) {
+	sig, err := txSignature(tx)
+	if err != nil {
+		return crypto.Address{}, err
+	}
+	key := senderKey{hash: tx.SigningHash(), sig: sig}
+
+	sc.mu.Lock()
+	addr, exists := sc.entries[key]
+	sc.mu.Unlock()
+	if exists {
+		return addr, nil
+	}
+
+	addr, err = crypto.RecoverAddressFunc(key.hash, key.sig[:])
+	if err != nil {
+		return crypto.Address{}, err
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if _, exists := sc.entries[key]; !exists {
+		if len(sc.order) >= sc.limit {
+			delete(sc.entries, sc.order[0])
+			sc.order = sc.order[1:]
+		}
+		sc.entries[key] = addr
+		sc.order = append(sc.order, key)
+	}
+	return addr, nil
+}
+
+// recover recovers the senders of all transactions in parallel, filling the
+// cache ahead of sequential execution. Invalid signatures are left for the
+// execution engine to report.
+func (sc *senderCache) recover(txs []*Transaction) {
+	workers := runtime.NumCPU()
+	if workers > len(txs) {
+		workers = len(txs)
+	}
+	if workers <= 1 {
+		for _, tx := range txs {
+			sc.sender(tx)
+		}
+		return
+	}
+
+	jobs := make(chan *Transaction)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tx := range jobs {
+				sc.sender(tx)
+			}
+		}()
+	}
+	for _, tx := range txs {
+		jobs <- tx
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// txSignature combines R, S and the recovery id derived from V into a 65
+// byte signature
+func txSignature(tx *Transaction) ([65]byte, error) {
+	var signature [65]byte
+	if tx.R == nil || tx.S == nil || tx.R.BitLen() > 256 || tx.S.BitLen() > 256 {
+		return signature, ErrInvalidSignature
+	}
+	recoveryID, err := tx.recoveryID()
+	if err != nil {
+		return signature, err
+	}
+	// Reject high s values, they make signatures malleable (EIP-2)
+	if !crypto.ValidateSignatureValues(recoveryID, tx.R, tx.S, true) {
+		return signature, ErrInvalidSignature
+	}
+	tx.R.FillBytes(signature[:32])
+	tx.S.FillBytes(signature[32:64])
+	signature[64] = recoveryID
+	return signature, nil
+}
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"blockchain-node/crypto"
+	"blockchain-node/storage"
+	"blockchain-node/trie"
+)
+
+// snapshotRootKey stores the root of the state held by the flat account and
+// storage tables. Commits, including those of a reorg, write it in the same
+// batch as the flat entries and the state root. It is removed while a
+// commit is written in parts, so the flat tables are only read for a state
+// they are known to hold.
+var snapshotRootKey = []byte("snapshot-root")
+
+// readSnapshotRoot returns the root of the state held by the flat tables,
+// false if they may hold a partly written state. An empty database holds
+// the empty state.
+func readSnapshotRoot(meta *storage.Table) (crypto.Hash, bool) {
+	data, err := meta.Get(snapshotRootKey)
+	if err == nil {
+		return crypto.BytesToHash(data), true
+	}
+	if _, err := meta.Get(stateRootKey); err != nil {
+		return crypto.Hash{}, true
+	}
+	return crypto.Hash{}, false
+}
+
+// markSnapshot records that the flat tables hold the committed state. It
+// runs on startup once healState has repaired the entries an unclean
+// shutdown may have left behind, and marks databases written before the
+// snapshot root was recorded.
+func (bc *Blockchain) markSnapshot() error {
+	root := readStateRoot(bc.tables.Meta)
+	if current, ok := readSnapshotRoot(bc.tables.Meta); ok && current == root {
+		return nil
+	}
+	if err := bc.tables.Meta.Put(snapshotRootKey, root.Bytes()); err != nil {
+		return fmt.Errorf("failed to put snapshot root: %v", err)
+	}
+	return nil
+}
+
+// loadFlatAccount reads an account from the flat account table
+func (sdb *StateDB) loadFlatAccount(addr crypto.Address) *Account {
+	data, err := sdb.tables.Accounts.Get(addr.Bytes())
+	if err != nil {
+		return nil
+	}
+
+	var account Account
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil
+	}
+	return &account
+}
+
+// loadFlatStorage reads a storage slot from the flat storage table
+func (sdb *StateDB) loadFlatStorage(addr crypto.Address, key crypto.Hash) crypto.Hash {
+	data, err := sdb.tables.Storage.Get(append(addr.Bytes(), key.Bytes()...))
+	if err != nil {
+		return crypto.Hash{}
+	}
+	return crypto.BytesToHash(data)
+}
+
+// loadTrieAccount reads an account from the state trie in the form the flat
+// tables store it, nil if it is missing or can not be read
+func (sdb *StateDB) loadTrieAccount(addr crypto.Address) *Account {
+	accountTrie, err := trie.New(sdb.stateRoot, sdb.db)
+	if err != nil {
+		return nil
+	}
+	enc, err := accountTrie.Get(crypto.Keccak256(addr.Bytes()))
+	if err != nil || enc == nil {
+		return nil
+	}
+	account, err := flatAccount(enc)
+	if err != nil {
+		return nil
+	}
+	return account
+}
+
+// loadTrieStorage reads a storage slot from the storage trie of the
+// committed account. The caller must hold sdb.mu, a read lock is enough.
+func (sdb *StateDB) loadTrieStorage(addr crypto.Address, key crypto.Hash) crypto.Hash {
+	account := sdb.committedAccount(addr)
+	if account == nil || account.StorageRoot.IsZero() {
+		return crypto.Hash{}
+	}
+	value, err := sdb.trieStorage(account.StorageRoot, key)
+	if err != nil {
+		return crypto.Hash{}
+	}
+	return value
+}
+
+// flatAccount decodes an account from the state trie into the form the
+// flat tables store, which uses zero hashes for no storage and no code
+func flatAccount(enc []byte) (*Account, error) {
+	account, err := decodeAccount(enc)
+	if err != nil {
+		return nil, err
+	}
+	if account.StorageRoot == trie.EmptyRoot {
+		account.StorageRoot = crypto.Hash{}
+	}
+	if account.CodeHash == emptyCodeHash {
+		account.CodeHash = crypto.Hash{}
+	}
+	return account, nil
+}
@@ -0,0 +1,201 @@
+package core
+
+import (
+	"container/list"
+	"sync"
+
+	"blockchain-node/crypto"
+)
+
+// State cache limits
+const (
+	maxCachedAccounts = 16384            // Clean accounts kept in memory
+	maxCachedSlots    = 65536            // Clean storage slots kept in memory, over all accounts
+	stateCacheShards  = 16               // Independently locked parts of the cache
+	maxCachedCode     = 16 * 1024 * 1024 // Bytes of contract code kept in memory
+)
+
+// stateCache holds accounts and storage slots read from the database. It is
+// shared by a StateDB and all its copies, entries always hold committed
+// values: Commit updates them, uncommitted changes are kept by each StateDB.
+// The cache is split into shards by address, each with its own lock, so
+// that concurrent readers of different accounts do not wait for each other.
+type stateCache struct {
+	shards [stateCacheShards]*stateCacheShard
+
+	codeMu sync.Mutex
+	code   *lruCache[crypto.Hash, []byte] // by code hash, costs the code size
+
+	stats stateStats // activity counters, see StateDB.Stats
+}
+
+// stateCacheShard holds the cached entries of a part of the addresses
+type stateCacheShard struct {
+	mu       sync.Mutex
+	accounts *lruCache[crypto.Address, *Account]
+	storage  *lruCache[crypto.Address, map[crypto.Hash]crypto.Hash] // costs one per slot
+}
+
+// newStateCache creates an empty state cache
+func newStateCache() *stateCache {
+	c := &stateCache{
+		code: newLRUCache[crypto.Hash, []byte](maxCachedCode),
+	}
+	for i := range c.shards {
+		c.shards[i] = &stateCacheShard{
+			accounts: newLRUCache[crypto.Address, *Account](maxCachedAccounts / stateCacheShards),
+			storage:  newLRUCache[crypto.Address, map[crypto.Hash]crypto.Hash](maxCachedSlots / stateCacheShards),
+		}
+	}
+	return c
+}
+
+// shard returns the shard holding the entries of an address
+func (c *stateCache) shard(addr crypto.Address) *stateCacheShard {
+	return c.shards[addr[len(addr)-1]%stateCacheShards]
+}
+
+// account returns a copy of the cached account
+func (c *stateCache) account(addr crypto.Address) (*Account, bool) {
+	shard := c.shard(addr)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	account, ok := shard.accounts.get(addr)
+	return copyAccount(account), ok
+}
+
+// setAccount caches the committed value of an account, nil removes it
+func (c *stateCache) setAccount(addr crypto.Address, account *Account) {
+	shard := c.shard(addr)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if account == nil {
+		shard.accounts.remove(addr)
+		return
+	}
+	shard.accounts.add(addr, copyAccount(account), 1)
+}
+
+// slot returns the cached value of a storage slot
+func (c *stateCache) slot(addr crypto.Address, key crypto.Hash) (crypto.Hash, bool) {
+	shard := c.shard(addr)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	slots, ok := shard.storage.get(addr)
+	if !ok {
+		return crypto.Hash{}, false
+	}
+	value, ok := slots[key]
+	return value, ok
+}
+
+// setSlots caches the committed values of storage slots of an account
+func (c *stateCache) setSlots(addr crypto.Address, values map[crypto.Hash]crypto.Hash) {
+	shard := c.shard(addr)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	slots, ok := shard.storage.get(addr)
+	if !ok {
+		slots = make(map[crypto.Hash]crypto.Hash, len(values))
+	}
+	for key, value := range values {
+		slots[key] = value
+	}
+	shard.storage.add(addr, slots, len(slots))
+}
+
+// removeSlots drops all cached storage slots of an account
+func (c *stateCache) removeSlots(addr crypto.Address) {
+	shard := c.shard(addr)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.storage.remove(addr)
+}
+
+// contractCode returns the cached code with the given hash. Code is never
+// modified, the returned slice is shared.
+func (c *stateCache) contractCode(codeHash crypto.Hash) ([]byte, bool) {
+	c.codeMu.Lock()
+	defer c.codeMu.Unlock()
+	return c.code.get(codeHash)
+}
+
+// setContractCode caches committed code by its hash
+func (c *stateCache) setContractCode(codeHash crypto.Hash, code []byte) {
+	c.codeMu.Lock()
+	defer c.codeMu.Unlock()
+	c.code.add(codeHash, code, len(code))
+}
+
+// lruCache is a least recently used cache bounded by the total cost of its
+// entries. It is not safe for concurrent use.
+type lruCache[K comparable, V any] struct {
+	capacity int
+	cost     int
+	items    map[K]*list.Element
+	order    *list.List // most recently used first
+}
+
+// lruEntry is an element of an lruCache
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+	cost  int
+}
+
+// newLRUCache creates an empty cache holding entries up to a total cost of
+// capacity
+func newLRUCache[K comparable, V any](capacity int) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		capacity: capacity,
+		items:    make(map[K]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns the value cached for key and marks it as recently used
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry[K, V]).value, true
+}
+
+// add caches value under key with the given cost, replacing any previous
+// value, and evicts the least recently used entries while over capacity
+func (c *lruCache[K, V]) add(key K, value V, cost int) {
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*lruEntry[K, V])
+		c.cost += cost - entry.cost
+		entry.value, entry.cost = value, cost
+		c.order.MoveToFront(elem)
+	} else {
+		c.items[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value, cost: cost})
+		c.cost += cost
+	}
+	for c.cost > c.capacity && c.order.Len() > 0 {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// remove drops the entry cached for key
+func (c *lruCache[K, V]) remove(key K) {
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// removeElement drops an entry from the cache
+func (c *lruCache[K, V]) removeElement(elem *list.Element) {
+	entry := c.order.Remove(elem).(*lruEntry[K, V])
+	delete(c.items, entry.key)
+	c.cost -= entry.cost
+}
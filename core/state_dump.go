@@ -0,0 +1,93 @@
+package core
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"blockchain-node/crypto"
+	"blockchain-node/storage"
+)
+
+// DumpAccount is an account as written by Dump
+type DumpAccount struct {
+	Balance     string            `json:"balance"`
+	Nonce       uint64            `json:"nonce"`
+	CodeHash    string            `json:"codeHash"`
+	StorageRoot string            `json:"storageRoot"`
+	Code        string            `json:"code,omitempty"`
+	Storage     map[string]string `json:"storage,omitempty"`
+}
+
+// OpenStateDB opens the state last committed to db
+func OpenStateDB(db storage.Database) *StateDB {
+	return NewStateDB(db, readStateRoot(storage.NewTables(db).Meta))
+}
+
+// Dump writes the state as a JSON object holding the state root and every
+// account by address, with its code and non-zero storage slots. Accounts
+// are written one at a time, so the state never has to fit in memory.
+// Changes that are not committed yet are included, so the root only
+// matches the accounts right after a commit.
+func (sdb *StateDB) Dump(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "{\n  \"root\": %q,\n  \"accounts\": {", sdb.GetStateRoot().Hex())
+
+	it := sdb.NewAccountIterator()
+	defer it.Release()
+
+	first := true
+	for it.Next() {
+		addr := it.Address()
+		entry, err := sdb.dumpAccount(addr, it.Account())
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to marshal account %s: %v", addr.Hex(), err)
+		}
+
+		if !first {
+			out.WriteString(",")
+		}
+		first = false
+		fmt.Fprintf(out, "\n    %q: %s", addr.Hex(), data)
+	}
+	if err := it.Error(); err != nil {
+		return fmt.Errorf("failed to iterate accounts: %v", err)
+	}
+
+	out.WriteString("\n  }\n}\n")
+	return out.Flush()
+}
+
+// dumpAccount loads the code and storage of an account
+func (sdb *StateDB) dumpAccount(addr crypto.Address, account *Account) (*DumpAccount, error) {
+	entry := &DumpAccount{
+		Balance:     "0",
+		Nonce:       account.Nonce,
+		CodeHash:    account.CodeHash.Hex(),
+		StorageRoot: account.StorageRoot.Hex(),
+	}
+	if account.Balance != nil {
+		entry.Balance = account.Balance.String()
+	}
+	if code := sdb.GetCode(addr); len(code) > 0 {
+		entry.Code = "0x" + hex.EncodeToString(code)
+	}
+
+	err := sdb.ForEachStorage(addr, func(key, value crypto.Hash) bool {
+		if entry.Storage == nil {
+			entry.Storage = make(map[string]string)
+		}
+		entry.Storage[key.Hex()] = value.Hex()
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate storage of %s: %v", addr.Hex(), err)
+	}
+	return entry, nil
+}
@@ -0,0 +1,40 @@
+package core
+
+import "blockchain-node/crypto"
+
+// stateCommitKey stores the hash of the block whose state is being
+// committed in parts, until the commit is complete
+var stateCommitKey = []byte("state-commit")
+
+// SetBatchLimit makes commits write their batch out each time it reaches
+// limit bytes instead of holding the whole state change in memory. A commit
+// written in parts is no longer atomic: if it is cut short, the flat state
+// of its block is repaired from the state trie on the next startup, see
+// healState. Zero writes every commit at once.
+func (sdb *StateDB) SetBatchLimit(limit int) {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+	sdb.flushSize = limit
+}
+
+// SetStateBatchLimit sets the size state commits are written out at, see
+// StateDB.SetBatchLimit
+func (bc *Blockchain) SetStateBatchLimit(limit int) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.stateDB.SetBatchLimit(limit)
+}
+
+// pendingStateCommit returns the block of a commit written in parts that
+// did not complete, nil if there is none
+func (bc *Blockchain) pendingStateCommit() *Block {
+	hash, err := bc.tables.Meta.Get(stateCommitKey)
+	if err != nil {
+		return nil
+	}
+	block, err := bc.getBlockByHash(crypto.BytesToHash(hash))
+	if err != nil {
+		return nil
+	}
+	return block
+}
@@ -0,0 +1,222 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"blockchain-node/crypto"
+	"blockchain-node/logger"
+	"blockchain-node/storage"
+	"blockchain-node/trie"
+)
+
+// stateHealDepth is the number of blocks below the head whose state changes
+// are checked against the state trie on startup
+const stateHealDepth = 16
+
+// healState checks the flat state left by the last run against the state
+// trie of the recorded state root, for the accounts and slots changed by the
+// most recent blocks, which are the ones an unclean shutdown can damage.
+// Flat entries that disagree are rewritten from the trie. If the trie
+// itself is damaged, it is re-derived from the flat state.
+func (bc *Blockchain) healState() error {
+	root := readStateRoot(bc.tables.Meta)
+	accountTrie, err := trie.New(root, bc.db)
+	if err != nil {
+		logger.Warning("State trie unreadable, re-deriving it from the flat state", "root", root.Hex(), "error", err)
+		return bc.rebuildStateTrie()
+	}
+
+	addrs, slots := bc.recentStateChanges(stateHealDepth)
+	batch := bc.db.NewBatch()
+	state := NewStateDB(bc.db, root)
+	repaired := 0
+
+	for _, addr := range addrs {
+		enc, err := accountTrie.Get(crypto.Keccak256(addr.Bytes()))
+		if err != nil {
+			logger.Warning("State trie damaged, re-deriving it from the flat state", "root", root.Hex(), "error", err)
+			return bc.rebuildStateTrie()
+		}
+		flat := state.loadFlatAccount(addr)
+		if (flat == nil && enc == nil) || (flat != nil && bytes.Equal(encodeAccount(flat), enc)) {
+			continue
+		}
+		if err := healAccount(bc.tables.Accounts.Batch(batch), addr, enc); err != nil {
+			return err
+		}
+		repaired++
+	}
+
+	for addr, keys := range slots {
+		account, err := state.trieAccount(root, addr)
+		if err != nil {
+			logger.Warning("State trie damaged, re-deriving it from the flat state", "root", root.Hex(), "error", err)
+			return bc.rebuildStateTrie()
+		}
+		for _, key := range keys {
+			value, err := state.trieStorage(account.StorageRoot, key)
+			if err != nil {
+				logger.Warning("Storage trie damaged, re-deriving the state trie from the flat state",
+					"address", addr.Hex(), "error", err)
+				return bc.rebuildStateTrie()
+			}
+			if state.loadFlatStorage(addr, key) == value {
+				continue
+			}
+			dbKey := append(addr.Bytes(), key.Bytes()...)
+			if err := bc.tables.Storage.Batch(batch).Put(dbKey, value.Bytes()); err != nil {
+				return fmt.Errorf("failed to put storage: %v", err)
+			}
+			repaired++
+		}
+	}
+
+	if repaired == 0 {
+		return nil
+	}
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("failed to write healed state: %v", err)
+	}
+	logger.Warning("Healed flat state entries inconsistent with the state root", "entries", repaired, "root", root.Hex())
+	return nil
+}
+
+// recentStateChanges returns the accounts and storage slots changed by up
+// to depth blocks ending at the head, and at the block of an unfinished
+// commit, as recorded in their state undo
+func (bc *Blockchain) recentStateChanges(depth int) ([]crypto.Address, map[crypto.Address][]crypto.Hash) {
+	var addrs []crypto.Address
+	slots := make(map[crypto.Address][]crypto.Hash)
+	seenAddrs := make(map[crypto.Address]bool)
+	seenSlots := make(map[crypto.Address]map[crypto.Hash]bool)
+
+	starts := []*Block{bc.currentBlock}
+	// A commit written in parts may have been cut short, its blocks changed
+	// the flat state without becoming the head
+	if pending := bc.pendingStateCommit(); pending != nil {
+		starts = append(starts, pending)
+	}
+	for _, block := range starts {
+		for i := 0; i < depth && block != nil && block.Header.Number.Sign() > 0; i++ {
+			undo, err := bc.readStateUndo(block.Hash)
+			if err != nil {
+				break
+			}
+			for _, entry := range undo.Accounts {
+				if !seenAddrs[entry.Address] {
+					seenAddrs[entry.Address] = true
+					addrs = append(addrs, entry.Address)
+				}
+			}
+			for _, slot := range undo.Storage {
+				if seenSlots[slot.Address] == nil {
+					seenSlots[slot.Address] = make(map[crypto.Hash]bool)
+				}
+				if !seenSlots[slot.Address][slot.Key] {
+					seenSlots[slot.Address][slot.Key] = true
+					slots[slot.Address] = append(slots[slot.Address], slot.Key)
+				}
+			}
+
+			parent, err := bc.getBlockByHash(block.Header.PreviousHash)
+			if err != nil {
+				break
+			}
+			block = parent
+		}
+	}
+	return addrs, slots
+}
+
+// healAccount rewrites the flat entry of an account from its encoding in
+// the state trie, nil deletes it. batch writes to the account table.
+func healAccount(batch storage.Batch, addr crypto.Address, enc []byte) error {
+	key := addr.Bytes()
+	if enc == nil {
+		if err := batch.Delete(key); err != nil {
+			return fmt.Errorf("failed to delete account: %v", err)
+		}
+		return nil
+	}
+
+	account, err := flatAccount(enc)
+	if err != nil {
+		return fmt.Errorf("invalid account %s in state trie: %v", addr.Hex(), err)
+	}
+	data, err := json.Marshal(account)
+	if err != nil {
+		return fmt.Errorf("failed to marshal account: %v", err)
+	}
+	if err := batch.Put(key, data); err != nil {
+		return fmt.Errorf("failed to put account: %v", err)
+	}
+	return nil
+}
+
+// rebuildStateTrie re-derives the account and storage tries from the flat
+// state and records the new state root. The history of retained roots is
+// dropped since older tries may be damaged too.
+func (bc *Blockchain) rebuildStateTrie() error {
+	state := NewStateDB(bc.db, crypto.Hash{})
+	batch := bc.db.NewBatch()
+	accountTrie, err := trie.New(crypto.Hash{}, bc.db)
+	if err != nil {
+		return err
+	}
+
+	accounts := 0
+	it := state.NewAccountIterator()
+	defer it.Release()
+	for it.Next() {
+		addr, account := it.Address(), it.Account()
+
+		slots := make(map[crypto.Hash]crypto.Hash)
+		err := state.ForEachStorage(addr, func(key, value crypto.Hash) bool {
+			slots[key] = value
+			return true
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read storage of %s: %v", addr.Hex(), err)
+		}
+		if account.StorageRoot, _, err = commitStorageTrie(bc.db, batch, nil, crypto.Hash{}, slots); err != nil {
+			return fmt.Errorf("failed to rebuild storage trie of %s: %v", addr.Hex(), err)
+		}
+		if account.StorageRoot == trie.EmptyRoot {
+			account.StorageRoot = crypto.Hash{}
+		}
+
+		data, err := json.Marshal(account)
+		if err != nil {
+			return fmt.Errorf("failed to marshal account: %v", err)
+		}
+		if err := bc.tables.Accounts.Batch(batch).Put(addr.Bytes(), data); err != nil {
+			return fmt.Errorf("failed to put account: %v", err)
+		}
+		if err := accountTrie.Update(crypto.Keccak256(addr.Bytes()), encodeAccount(account)); err != nil {
+			return fmt.Errorf("failed to rebuild state trie: %v", err)
+		}
+		accounts++
+	}
+	if err := it.Error(); err != nil {
+		return fmt.Errorf("failed to iterate accounts: %v", err)
+	}
+
+	root, err := accountTrie.Commit(batch, nil)
+	if err != nil {
+		return fmt.Errorf("failed to commit state trie: %v", err)
+	}
+	meta := bc.tables.Meta.Batch(batch)
+	if err := meta.Put(stateRootKey, root.Bytes()); err != nil {
+		return fmt.Errorf("failed to put state root: %v", err)
+	}
+	if err := meta.Delete(stateHistoryKey); err != nil {
+		return fmt.Errorf("failed to reset state history: %v", err)
+	}
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("failed to write rebuilt state trie: %v", err)
+	}
+	logger.Warning("Re-derived state trie from the flat state", "accounts", accounts, "root", root.Hex())
+	return nil
+}
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"blockchain-node/crypto"
+	"blockchain-node/storage"
+)
+
+// AccountIterator walks over all accounts of a state in address order.
+// Changes made to the state after the iterator was created are not seen.
+type AccountIterator struct {
+	overlayIterator[*Account]
+}
+
+// NewAccountIterator returns an iterator over the committed accounts merged
+// with the changes since the last commit
+func (sdb *StateDB) NewAccountIterator() *AccountIterator {
+	sdb.mu.RLock()
+	defer sdb.mu.RUnlock()
+
+	it := &AccountIterator{overlayIterator[*Account]{
+		db: sdb.tables.Accounts.NewIterator(nil, nil),
+		decode: func(data []byte) (*Account, error) {
+			var account Account
+			err := json.Unmarshal(data, &account)
+			return &account, err
+		},
+		skip: func(account *Account) bool { return account == nil },
+	}}
+	for addr, account := range sdb.accounts {
+		it.add(addr.Bytes(), copyAccount(account))
+	}
+	it.sortChanges()
+	return it
+}
+
+// Next moves to the next account, it returns false when the iteration is
+// over or failed
+func (it *AccountIterator) Next() bool { return it.next() }
+
+// Address returns the address of the current account
+func (it *AccountIterator) Address() crypto.Address { return crypto.BytesToAddress(it.key) }
+
+// Account returns a copy of the current account
+func (it *AccountIterator) Account() *Account { return copyAccount(it.value) }
+
+// Error returns the error that stopped the iteration, if any
+func (it *AccountIterator) Error() error { return it.err }
+
+// Release frees the database resources of the iterator
+func (it *AccountIterator) Release() { it.release() }
+
+// StorageIterator walks over the non-zero storage slots of an account in
+// slot order. Changes made to the state after the iterator was created are
+// not seen.
+type StorageIterator struct {
+	overlayIterator[crypto.Hash]
+}
+
+// NewStorageIterator returns an iterator over the committed storage of an
+// account merged with the changes since the last commit
+func (sdb *StateDB) NewStorageIterator(addr crypto.Address) *StorageIterator {
+	sdb.mu.RLock()
+	defer sdb.mu.RUnlock()
+
+	prefix := addr.Bytes()
+	it := &StorageIterator{overlayIterator[crypto.Hash]{
+		prefix: len(prefix),
+		decode: func(data []byte) (crypto.Hash, error) { return crypto.BytesToHash(data), nil },
+		skip:   func(value crypto.Hash) bool { return value.IsZero() },
+	}}
+	// The stored slots of replaced storage and destroyed accounts are hidden
+	if !sdb.replaced[addr] && !sdb.destroyed[addr] {
+		it.db = sdb.tables.Storage.NewIterator(prefix, nil)
+	}
+	for key, value := range sdb.storage[addr] {
+		it.add(key.Bytes(), value)
+	}
+	it.sortChanges()
+	return it
+}
+
+// Next moves to the next slot, it returns false when the iteration is over
+// or failed
+func (it *StorageIterator) Next() bool { return it.next() }
+
+// Key returns the current slot
+func (it *StorageIterator) Key() crypto.Hash { return crypto.BytesToHash(it.key) }
+
+// Value returns the value of the current slot
+func (it *StorageIterator) Value() crypto.Hash { return it.value }
+
+// Error returns the error that stopped the iteration, if any
+func (it *StorageIterator) Error() error { return it.err }
+
+// Release frees the database resources of the iterator
+func (it *StorageIterator) Release() { it.release() }
+
+// ForEachStorage calls cb for every non-zero storage slot of an account in
+// slot order, until cb returns false
+func (sdb *StateDB) ForEachStorage(addr crypto.Address, cb func(key, value crypto.Hash) bool) error {
+	it := sdb.NewStorageIterator(addr)
+	defer it.Release()
+
+	for it.Next() {
+		if !cb(it.Key(), it.Value()) {
+			break
+		}
+	}
+	return it.Error()
+}
+
+// overlayIterator merges the entries of a database prefix with in memory
+// changes, both in key order. A change replaces the stored entry with the
+// same key and entries matching skip are left out.
+type overlayIterator[V any] struct {
+	db     storage.Iterator // nil once exhausted, or if stored entries are hidden
+	prefix int              // length of the table key prefix
+	dbKey  []byte           // key of the stored entry not returned yet
+
+	keys    [][]byte // changed keys in order
+	changes []V
+
+	decode func([]byte) (V, error)
+	skip   func(V) bool
+
+	key   []byte
+	value V
+	err   error
+}
+
+// add records a change, sortChanges must be called once all are added
+func (it *overlayIterator[V]) add(key []byte, value V) {
+	it.keys = append(it.keys, key)
+	it.changes = append(it.changes, value)
+}
+
+// sortChanges orders the changes by key
+func (it *overlayIterator[V]) sortChanges() {
+	sort.Sort(changesByKey[V]{it})
+}
+
+// next moves to the next entry that is not skipped
+func (it *overlayIterator[V]) next() bool {
+	for it.err == nil {
+		if it.dbKey == nil && it.db != nil {
+			if it.db.Next() {
+				it.dbKey = append([]byte{}, it.db.Key()[it.prefix:]...)
+			} else {
+				it.err = it.db.Error()
+				it.release()
+			}
+		}
+
+		var cmp int
+		switch {
+		case it.dbKey == nil && len(it.keys) == 0:
+			return false
+		case it.dbKey == nil:
+			cmp = 1
+		case len(it.keys) == 0:
+			cmp = -1
+		default:
+			cmp = bytes.Compare(it.dbKey, it.keys[0])
+		}
+
+		if cmp < 0 {
+			it.key = it.dbKey
+			it.value, it.err = it.decode(it.db.Value())
+			it.dbKey = nil
+		} else {
+			// A change hides the stored entry with the same key
+			if cmp == 0 {
+				it.dbKey = nil
+			}
+			it.key, it.value = it.keys[0], it.changes[0]
+			it.keys, it.changes = it.keys[1:], it.changes[1:]
+		}
+		if it.err == nil && !it.skip(it.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// release frees the database iterator
+func (it *overlayIterator[V]) release() {
+	if it.db != nil {
+		it.db.Release()
+		it.db = nil
+	}
+}
+
+// changesByKey sorts the changes of an overlayIterator
+type changesByKey[V any] struct {
+	it *overlayIterator[V]
+}
+
+func (c changesByKey[V]) Len() int           { return len(c.it.keys) }
+func (c changesByKey[V]) Less(i, j int) bool { return bytes.Compare(c.it.keys[i], c.it.keys[j]) < 0 }
+func (c changesByKey[V]) Swap(i, j int) {
+	c.it.keys[i], c.it.keys[j] = c.it.keys[j], c.it.keys[i]
+	c.it.changes[i], c.it.changes[j] = c.it.changes[j], c.it.changes[i]
+}
@@ -0,0 +1,346 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"blockchain-node/crypto"
+)
+
+// txState holds state that only lives for the duration of one transaction:
+// the gas refund counter, the EIP-2929 access list, EIP-1153 transient
+// storage and the bookkeeping needed for SSTORE gas and SELFDESTRUCT
+type txState struct {
+	refund        uint64
+	accessAddrs   map[crypto.Address]bool
+	accessSlots   map[crypto.Address]map[crypto.Hash]bool
+	transient     map[crypto.Address]map[crypto.Hash]crypto.Hash
+	originStorage map[crypto.Address]map[crypto.Hash]crypto.Hash // values at transaction start
+	created       map[crypto.Address]bool                        // contracts created in this transaction
+	suicided      map[crypto.Address]bool
+}
+
+// revision marks a position in the journal that can be reverted to
+type revision struct {
+	id           int
+	journalIndex int
+}
+
+// newTxState creates an empty transaction scoped state
+func newTxState() *txState {
+	return &txState{
+		accessAddrs:   make(map[crypto.Address]bool),
+		accessSlots:   make(map[crypto.Address]map[crypto.Hash]bool),
+		transient:     make(map[crypto.Address]map[crypto.Hash]crypto.Hash),
+		originStorage: make(map[crypto.Address]map[crypto.Hash]crypto.Hash),
+		created:       make(map[crypto.Address]bool),
+		suicided:      make(map[crypto.Address]bool),
+	}
+}
+
+// PrepareTransaction resets the transaction scoped state before a new
+// transaction is executed
+func (sdb *StateDB) PrepareTransaction() {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+
+	sdb.resetJournal()
+	sdb.tx = newTxState()
+}
+
+// FinaliseTransaction removes the accounts destroyed by the transaction
+func (sdb *StateDB) FinaliseTransaction() {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+
+	// The storage of a destroyed account reads as empty from now on, the
+	// stored slots are deleted by Commit
+	for addr := range sdb.tx.suicided {
+		sdb.accounts[addr] = nil
+		delete(sdb.storage, addr)
+		sdb.destroyed[addr] = true
+	}
+	sdb.resetJournal()
+	sdb.tx = newTxState()
+}
+
+// Snapshot returns an identifier for the current revision of the state.
+// Identifiers stay valid until the state is reverted past them or the
+// transaction ends.
+func (sdb *StateDB) Snapshot() int {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+
+	id := sdb.nextRevID
+	sdb.nextRevID++
+	sdb.revisions = append(sdb.revisions, revision{id: id, journalIndex: len(sdb.journal)})
+	return id
+}
+
+// RevertToSnapshot undoes all changes made since the given snapshot. It
+// panics if the snapshot is not valid, which is a bug in the caller.
+func (sdb *StateDB) RevertToSnapshot(id int) {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+
+	idx := sort.Search(len(sdb.revisions), func(i int) bool {
+		return sdb.revisions[i].id >= id
+	})
+	if idx == len(sdb.revisions) || sdb.revisions[idx].id != id {
+		panic(fmt.Errorf("revision id %v cannot be reverted", id))
+	}
+	journalIndex := sdb.revisions[idx].journalIndex
+
+	for len(sdb.journal) > journalIndex {
+		last := len(sdb.journal) - 1
+		sdb.journal[last]()
+		sdb.journal = sdb.journal[:last]
+	}
+	sdb.revisions = sdb.revisions[:idx]
+}
+
+// resetJournal drops the journal and all snapshots, the caller must hold
+// sdb.mu
+func (sdb *StateDB) resetJournal() {
+	sdb.journal = nil
+	sdb.revisions = sdb.revisions[:0]
+}
+
+// journalAccount records how to restore the cached account, the caller
+// must hold sdb.mu
+func (sdb *StateDB) journalAccount(addr crypto.Address) {
+	prev, cached := sdb.accounts[addr]
+	sdb.journal = append(sdb.journal, func() {
+		if cached {
+			sdb.accounts[addr] = prev
+		} else {
+			delete(sdb.accounts, addr)
+		}
+	})
+}
+
+// journalCode records how to drop code buffered for deployment, the caller
+// must hold sdb.mu
+func (sdb *StateDB) journalCode(codeHash crypto.Hash) {
+	if _, pending := sdb.code[codeHash]; pending {
+		return
+	}
+	sdb.journal = append(sdb.journal, func() { delete(sdb.code, codeHash) })
+}
+
+// journalStorage records how to restore a cached storage slot and remembers
+// its value at transaction start, the caller must hold sdb.mu
+func (sdb *StateDB) journalStorage(addr crypto.Address, key crypto.Hash) {
+	prev, cached := sdb.storage[addr][key]
+
+	if _, exists := sdb.tx.originStorage[addr][key]; !exists {
+		origin := prev
+		if !cached {
+			origin = sdb.committedStorage(addr, key)
+		}
+		if sdb.tx.originStorage[addr] == nil {
+			sdb.tx.originStorage[addr] = make(map[crypto.Hash]crypto.Hash)
+		}
+		sdb.tx.originStorage[addr][key] = origin
+	}
+
+	sdb.journal = append(sdb.journal, func() {
+		if cached {
+			sdb.storage[addr][key] = prev
+		} else {
+			delete(sdb.storage[addr], key)
+		}
+	})
+}
+
+// committedStorage returns the committed value of a storage slot, going
+// through the shared cache. The caller must hold sdb.mu, a read lock is
+// enough.
+func (sdb *StateDB) committedStorage(addr crypto.Address, key crypto.Hash) crypto.Hash {
+	// Replaced storage only exists in this StateDB, it must not reach the
+	// cache. The stored slots of destroyed accounts are about to be deleted.
+	if sdb.replaced[addr] || sdb.destroyed[addr] {
+		return crypto.Hash{}
+	}
+	value, cached := sdb.cache.slot(addr, key)
+	cacheLookup(&sdb.cache.stats.storageCacheHits, &sdb.cache.stats.storageCacheMisses, cached)
+	if cached {
+		return value
+	}
+
+	value = sdb.loadStorage(addr, key)
+	sdb.cache.setSlots(addr, map[crypto.Hash]crypto.Hash{key: value})
+	return value
+}
+
+// loadStorage reads a storage slot from the database, bypassing the cache.
+// The snapshot serves it if it holds this state, the storage trie otherwise.
+func (sdb *StateDB) loadStorage(addr crypto.Address, key crypto.Hash) crypto.Hash {
+	sdb.cache.stats.storageReads.Add(1)
+	if !sdb.snapshot {
+		return sdb.loadTrieStorage(addr, key)
+	}
+	return sdb.loadFlatStorage(addr, key)
+}
+
+// GetCommittedStorage returns the value a storage slot had at the start of
+// the current transaction
+func (sdb *StateDB) GetCommittedStorage(addr crypto.Address, key crypto.Hash) crypto.Hash {
+	sdb.mu.RLock()
+	if origin, exists := sdb.tx.originStorage[addr][key]; exists {
+		sdb.mu.RUnlock()
+		return origin
+	}
+	sdb.mu.RUnlock()
+
+	return sdb.GetStorage(addr, key)
+}
+
+// AddRefund adds gas to the refund counter
+func (sdb *StateDB) AddRefund(gas uint64) {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+
+	prev := sdb.tx.refund
+	sdb.journal = append(sdb.journal, func() { sdb.tx.refund = prev })
+	sdb.tx.refund += gas
+}
+
+// SubRefund removes gas from the refund counter
+func (sdb *StateDB) SubRefund(gas uint64) {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+
+	prev := sdb.tx.refund
+	sdb.journal = append(sdb.journal, func() { sdb.tx.refund = prev })
+	if gas > sdb.tx.refund {
+		sdb.tx.refund = 0
+		return
+	}
+	sdb.tx.refund -= gas
+}
+
+// GetRefund returns the current value of the refund counter
+func (sdb *StateDB) GetRefund() uint64 {
+	sdb.mu.RLock()
+	defer sdb.mu.RUnlock()
+	return sdb.tx.refund
+}
+
+// AddressInAccessList checks whether an address was accessed in the
+// current transaction
+func (sdb *StateDB) AddressInAccessList(addr crypto.Address) bool {
+	sdb.mu.RLock()
+	defer sdb.mu.RUnlock()
+	return sdb.tx.accessAddrs[addr]
+}
+
+// SlotInAccessList checks whether an address and one of its storage slots
+// were accessed in the current transaction
+func (sdb *StateDB) SlotInAccessList(addr crypto.Address, slot crypto.Hash) (addressOk bool, slotOk bool) {
+	sdb.mu.RLock()
+	defer sdb.mu.RUnlock()
+	return sdb.tx.accessAddrs[addr], sdb.tx.accessSlots[addr][slot]
+}
+
+// AddAddressToAccessList marks an address as accessed
+func (sdb *StateDB) AddAddressToAccessList(addr crypto.Address) {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+	sdb.addAddressToAccessList(addr)
+}
+
+// AddSlotToAccessList marks an address and one of its storage slots as
+// accessed
+func (sdb *StateDB) AddSlotToAccessList(addr crypto.Address, slot crypto.Hash) {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+
+	sdb.addAddressToAccessList(addr)
+	if sdb.tx.accessSlots[addr][slot] {
+		return
+	}
+	if sdb.tx.accessSlots[addr] == nil {
+		sdb.tx.accessSlots[addr] = make(map[crypto.Hash]bool)
+	}
+	sdb.tx.accessSlots[addr][slot] = true
+	sdb.journal = append(sdb.journal, func() { delete(sdb.tx.accessSlots[addr], slot) })
+}
+
+// addAddressToAccessList marks an address as accessed, the caller must hold
+// sdb.mu
+func (sdb *StateDB) addAddressToAccessList(addr crypto.Address) {
+	if sdb.tx.accessAddrs[addr] {
+		return
+	}
+	sdb.tx.accessAddrs[addr] = true
+	sdb.journal = append(sdb.journal, func() { delete(sdb.tx.accessAddrs, addr) })
+}
+
+// GetTransientState returns a transient storage value (EIP-1153)
+func (sdb *StateDB) GetTransientState(addr crypto.Address, key crypto.Hash) crypto.Hash {
+	sdb.mu.RLock()
+	defer sdb.mu.RUnlock()
+	return sdb.tx.transient[addr][key]
+}
+
+// SetTransientState updates a transient storage value (EIP-1153)
+func (sdb *StateDB) SetTransientState(addr crypto.Address, key, value crypto.Hash) {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+
+	prev := sdb.tx.transient[addr][key]
+	if sdb.tx.transient[addr] == nil {
+		sdb.tx.transient[addr] = make(map[crypto.Hash]crypto.Hash)
+	}
+	sdb.tx.transient[addr][key] = value
+	sdb.journal = append(sdb.journal, func() { sdb.tx.transient[addr][key] = prev })
+}
+
+// CreateContract records that a contract is deployed at addr in the current
+// transaction
+func (sdb *StateDB) CreateContract(addr crypto.Address) {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+
+	if sdb.tx.created[addr] {
+		return
+	}
+	sdb.tx.created[addr] = true
+	sdb.journal = append(sdb.journal, func() { delete(sdb.tx.created, addr) })
+}
+
+// IsNewContract checks whether the contract at addr was deployed in the
+// current transaction
+func (sdb *StateDB) IsNewContract(addr crypto.Address) bool {
+	sdb.mu.RLock()
+	defer sdb.mu.RUnlock()
+	return sdb.tx.created[addr]
+}
+
+// Suicide marks an account for deletion at the end of the transaction and
+// clears its balance
+func (sdb *StateDB) Suicide(addr crypto.Address) bool {
+	if !sdb.Exist(addr) {
+		return false
+	}
+	sdb.SetBalance(addr, big.NewInt(0))
+
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+
+	if !sdb.tx.suicided[addr] {
+		sdb.tx.suicided[addr] = true
+		sdb.journal = append(sdb.journal, func() { delete(sdb.tx.suicided, addr) })
+	}
+	return true
+}
+
+// HasSuicided checks whether an account was destroyed in the current
+// transaction
+func (sdb *StateDB) HasSuicided(addr crypto.Address) bool {
+	sdb.mu.RLock()
+	defer sdb.mu.RUnlock()
+	return sdb.tx.suicided[addr]
+}
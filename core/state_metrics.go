@@ -0,0 +1,101 @@
+package core
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// StateStats are counters of state database activity, totals since the
+// node started
+type StateStats struct {
+	AccountCacheHits   uint64
+	AccountCacheMisses uint64
+	StorageCacheHits   uint64
+	StorageCacheMisses uint64
+	CodeCacheHits      uint64
+	CodeCacheMisses    uint64
+
+	AccountReads  uint64 // accounts read from the database
+	StorageReads  uint64 // storage slots read from the database
+	AccountWrites uint64 // accounts written or deleted by commits
+	StorageWrites uint64 // storage slots written by commits
+
+	Commits        uint64
+	CommitTime     time.Duration // total time spent in commits
+	LastCommitTime time.Duration
+
+	TrieNodesCommitted uint64 // trie nodes stored by commits
+	TrieNodesPruned    uint64 // trie nodes deleted as unreachable
+}
+
+// stateStats collects StateStats. It is shared through the state cache by a
+// StateDB and all its copies.
+type stateStats struct {
+	accountCacheHits   atomic.Uint64
+	accountCacheMisses atomic.Uint64
+	storageCacheHits   atomic.Uint64
+	storageCacheMisses atomic.Uint64
+	codeCacheHits      atomic.Uint64
+	codeCacheMisses    atomic.Uint64
+
+	accountReads  atomic.Uint64
+	storageReads  atomic.Uint64
+	accountWrites atomic.Uint64
+	storageWrites atomic.Uint64
+
+	commits        atomic.Uint64
+	commitTime     atomic.Int64
+	lastCommitTime atomic.Int64
+
+	trieNodesCommitted atomic.Uint64
+	trieNodesPruned    atomic.Uint64
+}
+
+// cacheLookup counts a hit or a miss
+func cacheLookup(hits, misses *atomic.Uint64, hit bool) {
+	if hit {
+		hits.Add(1)
+	} else {
+		misses.Add(1)
+	}
+}
+
+// commitDone records the duration of a successful commit
+func (s *stateStats) commitDone(elapsed time.Duration) {
+	s.commits.Add(1)
+	s.commitTime.Add(int64(elapsed))
+	s.lastCommitTime.Store(int64(elapsed))
+}
+
+// snapshot returns the current counters
+func (s *stateStats) snapshot() StateStats {
+	return StateStats{
+		AccountCacheHits:   s.accountCacheHits.Load(),
+		AccountCacheMisses: s.accountCacheMisses.Load(),
+		StorageCacheHits:   s.storageCacheHits.Load(),
+		StorageCacheMisses: s.storageCacheMisses.Load(),
+		CodeCacheHits:      s.codeCacheHits.Load(),
+		CodeCacheMisses:    s.codeCacheMisses.Load(),
+		AccountReads:       s.accountReads.Load(),
+		StorageReads:       s.storageReads.Load(),
+		AccountWrites:      s.accountWrites.Load(),
+		StorageWrites:      s.storageWrites.Load(),
+		Commits:            s.commits.Load(),
+		CommitTime:         time.Duration(s.commitTime.Load()),
+		LastCommitTime:     time.Duration(s.lastCommitTime.Load()),
+		TrieNodesCommitted: s.trieNodesCommitted.Load(),
+		TrieNodesPruned:    s.trieNodesPruned.Load(),
+	}
+}
+
+// Stats returns the activity counters of the state and its copies
+func (sdb *StateDB) Stats() StateStats {
+	return sdb.cache.stats.snapshot()
+}
+
+// StateStats returns the activity counters of the state database
+func (bc *Blockchain) StateStats() StateStats {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.stateDB.Stats()
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+
+	"blockchain-node/crypto"
+)
+
+// OverrideAccount holds the fields of an account replaced for the duration
+// of a simulated call. Nil fields keep their current value.
+type OverrideAccount struct {
+	Nonce     *uint64
+	Code      *[]byte
+	Balance   *big.Int
+	State     map[crypto.Hash]crypto.Hash // Replaces the whole storage
+	StateDiff map[crypto.Hash]crypto.Hash // Replaces the listed slots only
+}
+
+// StateOverride maps accounts to the overrides applied before a simulated
+// call, as accepted by eth_call and eth_estimateGas
+type StateOverride map[crypto.Address]OverrideAccount
+
+// Apply writes the overrides into state, which must be a copy that is
+// discarded after the simulation
+func (so StateOverride) Apply(state *StateDB) error {
+	for addr, account := range so {
+		if account.State != nil && account.StateDiff != nil {
+			return fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
+		}
+
+		if account.Nonce != nil {
+			state.SetNonce(addr, *account.Nonce)
+		}
+		if account.Code != nil {
+			state.SetCode(addr, *account.Code)
+		}
+		if account.Balance != nil {
+			if account.Balance.Sign() < 0 {
+				return fmt.Errorf("account %s has a negative balance override", addr.Hex())
+			}
+			state.SetBalance(addr, account.Balance)
+		}
+		if account.State != nil {
+			state.ReplaceStorage(addr, account.State)
+		}
+		for key, value := range account.StateDiff {
+			state.SetStorage(addr, key, value)
+		}
+	}
+	return nil
+}
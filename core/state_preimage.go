@@ -0,0 +1,105 @@
+package core
+
+import (
+	"fmt"
+
+	"blockchain-node/crypto"
+	"blockchain-node/storage"
+)
+
+// SetPreimageRecording enables or disables recording of hash preimages:
+// the inputs of KECCAK256 in contract code and the addresses and storage
+// slots behind the keys of the state tries. Recorded preimages are
+// persisted on commit.
+func (sdb *StateDB) SetPreimageRecording(enabled bool) {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+	sdb.record = enabled
+}
+
+// AddPreimage records the preimage of a hash if recording is enabled
+func (sdb *StateDB) AddPreimage(hash crypto.Hash, preimage []byte) {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+
+	if !sdb.record {
+		return
+	}
+	if _, exists := sdb.preimages[hash]; exists {
+		return
+	}
+	sdb.preimages[hash] = append([]byte{}, preimage...)
+	sdb.journal = append(sdb.journal, func() { delete(sdb.preimages, hash) })
+}
+
+// Preimage returns the recorded preimage of a hash, nil if it is unknown
+func (sdb *StateDB) Preimage(hash crypto.Hash) []byte {
+	sdb.mu.RLock()
+	preimage, pending := sdb.preimages[hash]
+	sdb.mu.RUnlock()
+	if pending {
+		return append([]byte{}, preimage...)
+	}
+
+	data, err := sdb.tables.Preimages.Get(hash.Bytes())
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// writePreimages adds the recorded preimages and those of the trie keys
+// changed since the last commit to batch. The caller must hold sdb.mu.
+func (sdb *StateDB) writePreimages(batch storage.Batch) error {
+	if !sdb.record {
+		return nil
+	}
+	put := func(preimage []byte) error {
+		return sdb.putPreimage(batch, crypto.Keccak256Hash(preimage), preimage)
+	}
+
+	for hash, preimage := range sdb.preimages {
+		if err := sdb.putPreimage(batch, hash, preimage); err != nil {
+			return err
+		}
+	}
+	for addr := range sdb.accounts {
+		if err := put(addr.Bytes()); err != nil {
+			return err
+		}
+	}
+	for addr, addrStorage := range sdb.storage {
+		if err := put(addr.Bytes()); err != nil {
+			return err
+		}
+		for key := range addrStorage {
+			if err := put(key.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// putPreimage adds a preimage to batch
+func (sdb *StateDB) putPreimage(batch storage.Batch, hash crypto.Hash, preimage []byte) error {
+	if err := sdb.tables.Preimages.Batch(batch).Put(hash.Bytes(), preimage); err != nil {
+		return fmt.Errorf("failed to put preimage: %v", err)
+	}
+	return nil
+}
+
+// SetPreimageRecording enables or disables recording of hash preimages,
+// see StateDB.SetPreimageRecording
+func (bc *Blockchain) SetPreimageRecording(enabled bool) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.stateDB.SetPreimageRecording(enabled)
+}
+
+// GetPreimage returns the recorded preimage of a hash, nil if it is unknown
+func (bc *Blockchain) GetPreimage(hash crypto.Hash) []byte {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.stateDB.Preimage(hash)
+}
@@ -0,0 +1,268 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+
+	"blockchain-node/crypto"
+)
+
+// processBlock executes the transactions of a block on top of the given state
+// like applyBlock and checks the result against the header. The caller must
+// hold bc.mu.
+func (bc *Blockchain) processBlock(block *Block, state *StateDB) ([]*TransactionReceipt, error) {
+	receipts, err := bc.applyBlock(block, state)
+	if err != nil {
+		return nil, err
+	}
+
+	if gasUsed := cumulativeGasUsed(receipts); block.Header.GasUsed != gasUsed {
+		return nil, fmt.Errorf("%w: have %d, header has %d", ErrInvalidGasUsed, gasUsed, block.Header.GasUsed)
+	}
+	if root := DeriveReceiptsRoot(receipts); root != block.Header.ReceiptsRoot {
+		return nil, fmt.Errorf("%w: have %s, header has %s", ErrInvalidReceiptsRoot, root.Hex(), block.Header.ReceiptsRoot.Hex())
+	}
+
+	// Blocks of chains from before state roots were added to headers may
+	// have none below the configured fork block, their state is still
+	// checked by executing them
+	want := block.Header.StateRoot
+	if want.IsZero() && block.Header.Number.Uint64() < bc.stateRootBlock() {
+		return receipts, nil
+	}
+	root, err := state.IntermediateRoot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute state root: %v", err)
+	}
+	if root != want {
+		return nil, fmt.Errorf("%w: have %s, header has %s", ErrInvalidStateRoot, root.Hex(), want.Hex())
+	}
+
+	return receipts, nil
+}
+
+// applyBlock executes the transactions of a block on top of the given state
+// and lets the consensus engine finalize it. The caller must hold bc.mu.
+func (bc *Blockchain) applyBlock(block *Block, state *StateDB) ([]*TransactionReceipt, error) {
+	processor := bc.newBlockProcessor(block, state)
+
+	// Recover all senders in parallel, execution then hits the cache
+	senderCacher.recover(block.Transactions)
+
+	for i, tx := range block.Transactions {
+		if err := processor.apply(tx); err != nil {
+			return nil, fmt.Errorf("could not apply tx %d [%x]: %v", i, tx.Hash, err)
+		}
+	}
+	if err := processor.finalize(block.Transactions); err != nil {
+		return nil, err
+	}
+	return processor.receipts, nil
+}
+
+// blockProcessor executes the transactions of a block one at a time
+type blockProcessor struct {
+	bc       *Blockchain
+	block    *Block
+	state    *StateDB
+	executor *ExecutionEngine
+	receipts []*TransactionReceipt
+	gasUsed  uint64
+	logIndex uint
+}
+
+// newBlockProcessor prepares state for executing the transactions of block.
+// The caller must hold bc.mu.
+func (bc *Blockchain) newBlockProcessor(block *Block, state *StateDB) *blockProcessor {
+	executor := NewExecutionEngine(state, &ExecutionConfig{
+		ChainID:          bc.chainID(),
+		BlockGasLimit:    block.Header.GasLimit,
+		MinGasPrice:      big.NewInt(0),
+		VM:               bc.vm,
+		GetHash:          bc.getHashFn(block.Header),
+		CoinbaseMaturity: bc.coinbaseMaturity(),
+	})
+
+	// Rewards of the block maturity blocks back become spendable
+	maturity := bc.coinbaseMaturity()
+	if number := block.Header.Number.Uint64(); maturity > 0 && number >= maturity {
+		releaseRewards(state, number-maturity)
+	}
+
+	return &blockProcessor{
+		bc:       bc,
+		block:    block,
+		state:    state,
+		executor: executor,
+	}
+}
+
+// apply executes tx as the next transaction of the block and records its
+// receipt. A transaction the execution engine rejects leaves the state as it
+// was.
+func (p *blockProcessor) apply(tx *Transaction) error {
+	header := p.block.Header
+	result, err := p.executor.ExecuteTransaction(tx, header)
+	if err != nil {
+		return err
+	}
+
+	p.gasUsed += result.GasUsed
+	if p.gasUsed > header.GasLimit {
+		return fmt.Errorf("block gas limit exceeded: %d > %d", p.gasUsed, header.GasLimit)
+	}
+
+	index := len(p.receipts)
+	for _, log := range result.Logs {
+		log.BlockHash = p.block.Hash
+		log.TxIndex = uint(index)
+		log.Index = p.logIndex
+		p.logIndex++
+	}
+
+	p.receipts = append(p.receipts, &TransactionReceipt{
+		TransactionHash:   tx.Hash,
+		TransactionIndex:  uint64(index),
+		BlockHash:         p.block.Hash,
+		BlockNumber:       new(big.Int).Set(header.Number),
+		From:              tx.From,
+		To:                tx.To,
+		GasUsed:           result.GasUsed,
+		CumulativeGasUsed: p.gasUsed,
+		ContractAddress:   result.ContractAddress,
+		Logs:              result.Logs,
+		Status:            result.Status,
+	})
+	return nil
+}
+
+// finalize applies the block rewards and other consensus specific state
+// changes after the transactions txs of the block
+func (p *blockProcessor) finalize(txs []*Transaction) error {
+	bc, block, state := p.bc, p.block, p.state
+	if bc.engine == nil {
+		return nil
+	}
+
+	maturity := bc.coinbaseMaturity()
+	var before []rewardBalance
+	if maturity > 0 {
+		before = rewardRecipients(state, block.Header, block.Uncles)
+	}
+	if err := bc.engine.Finalize(lockedChain{bc}, block.Header, state, txs, block.Uncles); err != nil {
+		return fmt.Errorf("failed to finalize block: %v", err)
+	}
+	if maturity > 0 {
+		lockRewards(state, block.Header.Number.Uint64(), before)
+	}
+	return nil
+}
+
+// cumulativeGasUsed returns the gas used by all transactions of a block
+func cumulativeGasUsed(receipts []*TransactionReceipt) uint64 {
+	if len(receipts) == 0 {
+		return 0
+	}
+	return receipts[len(receipts)-1].CumulativeGasUsed
+}
+
+// FillBlock executes the transactions of a block template on top of the
+// head one at a time. A transaction that fails is left out together with
+// the later transactions of its sender, and so is one that no longer fits
+// into the gas limit; the block keeps the others. FillBlock then fills in
+// the fields of the header that commit to the result: the gas used and the
+// transactions, receipts and state roots. It returns why each transaction
+// that failed was left out. Block producers call it before sealing.
+func (bc *Blockchain) FillBlock(block *Block) (map[crypto.Hash]error, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if !block.Header.PreviousHash.Equal(bc.currentBlock.Hash) {
+		return nil, fmt.Errorf("%w: parent %s is not the head", ErrUnknownAncestor, block.Header.PreviousHash.Hex())
+	}
+	state := bc.stateDB.Copy()
+	processor := bc.newBlockProcessor(block, state)
+	senderCacher.recover(block.Transactions)
+
+	failed := make(map[crypto.Hash]error)
+	skipped := make(map[crypto.Address]bool)
+	included := make([]*Transaction, 0, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		if skipped[tx.From] {
+			continue
+		}
+		if tx.GasLimit > block.Header.GasLimit-processor.gasUsed {
+			skipped[tx.From] = true
+			continue
+		}
+		if err := processor.apply(tx); err != nil {
+			failed[tx.Hash] = err
+			skipped[tx.From] = true
+			continue
+		}
+		included = append(included, tx)
+	}
+	block.Transactions = included
+	if err := processor.finalize(included); err != nil {
+		return nil, err
+	}
+	receipts := processor.receipts
+
+	root, err := state.IntermediateRoot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute state root: %v", err)
+	}
+	block.Header.GasUsed = cumulativeGasUsed(receipts)
+	block.Header.TransactionsRoot = DeriveTxRoot(block.Transactions)
+	block.Header.ReceiptsRoot = DeriveReceiptsRoot(receipts)
+	block.Header.StateRoot = root
+	return failed, nil
+}
+
+// getHashFn returns a BLOCKHASH lookup walking the ancestors of header, so
+// it also works for blocks on a side chain. Only the last BlockHashWindow
+// ancestors are visible. The caller must hold bc.mu.
+func (bc *Blockchain) getHashFn(header *BlockHeader) func(uint64) crypto.Hash {
+	// ancestors[i] is the hash of block number header.Number-1-i
+	var ancestors []crypto.Hash
+
+	return func(number uint64) crypto.Hash {
+		current := header.Number.Uint64()
+		if number >= current || current-number > BlockHashWindow {
+			return crypto.Hash{}
+		}
+		if len(ancestors) == 0 {
+			ancestors = append(ancestors, header.PreviousHash)
+		}
+
+		index := current - 1 - number
+		for uint64(len(ancestors)) <= index {
+			block, err := bc.getBlockByHash(ancestors[len(ancestors)-1])
+			if err != nil {
+				return crypto.Hash{}
+			}
+			ancestors = append(ancestors, block.Header.PreviousHash)
+		}
+		return ancestors[index]
+	}
+}
+
+// BlockHashWindow is the number of ancestor hashes available to the
+// BLOCKHASH opcode
+const BlockHashWindow = 256
+
+// stateRootBlock returns the first block that must commit to its state root
+func (bc *Blockchain) stateRootBlock() uint64 {
+	if bc.config == nil {
+		return 0
+	}
+	return bc.config.StateRootBlock
+}
+
+// chainID returns the configured chain ID
+func (bc *Blockchain) chainID() *big.Int {
+	if bc.config == nil || bc.config.ChainID == nil {
+		return big.NewInt(0)
+	}
+	return bc.config.ChainID
+}
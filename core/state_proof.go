@@ -0,0 +1,155 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+
+	"blockchain-node/crypto"
+	"blockchain-node/trie"
+)
+
+// AccountProof is an account together with the Merkle proofs of the
+// account and some of its storage slots, as returned by eth_getProof
+type AccountProof struct {
+	Address      crypto.Address
+	AccountProof [][]byte
+	Balance      *big.Int
+	CodeHash     crypto.Hash
+	Nonce        uint64
+	StorageHash  crypto.Hash
+	StorageProof []StorageProof
+}
+
+// StorageProof is a storage slot together with its Merkle proof
+type StorageProof struct {
+	Key   crypto.Hash
+	Value crypto.Hash
+	Proof [][]byte
+}
+
+// GetProof returns the Merkle proof of an account in the state trie with
+// the given root
+func (sdb *StateDB) GetProof(root crypto.Hash, addr crypto.Address) ([][]byte, error) {
+	accountTrie, err := trie.New(root, sdb.db)
+	if err != nil {
+		return nil, err
+	}
+	return accountTrie.Prove(crypto.Keccak256(addr.Bytes()))
+}
+
+// GetStorageProof returns the Merkle proof of a storage slot of an account
+// in the state with the given root
+func (sdb *StateDB) GetStorageProof(root crypto.Hash, addr crypto.Address, key crypto.Hash) ([][]byte, error) {
+	account, err := sdb.trieAccount(root, addr)
+	if err != nil {
+		return nil, err
+	}
+	storageTrie, err := trie.New(account.StorageRoot, sdb.db)
+	if err != nil {
+		return nil, err
+	}
+	return storageTrie.Prove(crypto.Keccak256(key.Bytes()))
+}
+
+// trieAccount reads an account from the state trie with the given root. A
+// missing account is returned as an empty one.
+func (sdb *StateDB) trieAccount(root crypto.Hash, addr crypto.Address) (*Account, error) {
+	accountTrie, err := trie.New(root, sdb.db)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := accountTrie.Get(crypto.Keccak256(addr.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	if enc == nil {
+		return &Account{Balance: new(big.Int), CodeHash: emptyCodeHash, StorageRoot: trie.EmptyRoot}, nil
+	}
+	return decodeAccount(enc)
+}
+
+// trieStorage reads a storage slot from the storage trie with the given root
+func (sdb *StateDB) trieStorage(root crypto.Hash, key crypto.Hash) (crypto.Hash, error) {
+	storageTrie, err := trie.New(root, sdb.db)
+	if err != nil {
+		return crypto.Hash{}, err
+	}
+	enc, err := storageTrie.Get(crypto.Keccak256(key.Bytes()))
+	if err != nil || enc == nil {
+		return crypto.Hash{}, err
+	}
+	value, err := decodeStorageValue(enc)
+	if err != nil {
+		return crypto.Hash{}, fmt.Errorf("invalid storage value of slot %s: %v", key.Hex(), err)
+	}
+	return value, nil
+}
+
+// GetProof returns the proofs of an account and some of its storage slots
+// in the head state
+func (bc *Blockchain) GetProof(addr crypto.Address, keys []crypto.Hash) (*AccountProof, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	state := bc.stateDB
+	root := state.GetStateRoot()
+
+	account, err := state.trieAccount(root, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account: %v", err)
+	}
+	accountProof, err := state.GetProof(root, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prove account: %v", err)
+	}
+
+	result := &AccountProof{
+		Address:      addr,
+		AccountProof: accountProof,
+		Balance:      account.Balance,
+		CodeHash:     account.CodeHash,
+		Nonce:        account.Nonce,
+		StorageHash:  account.StorageRoot,
+		StorageProof: make([]StorageProof, 0, len(keys)),
+	}
+	for _, key := range keys {
+		value, err := state.trieStorage(account.StorageRoot, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read storage: %v", err)
+		}
+		proof, err := state.GetStorageProof(root, addr, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prove storage: %v", err)
+		}
+		result.StorageProof = append(result.StorageProof, StorageProof{Key: key, Value: value, Proof: proof})
+	}
+	return result, nil
+}
+
+// GetHeadAccountProof returns the Merkle proof of an account in the head
+// state together with the head header it proves against
+func (bc *Blockchain) GetHeadAccountProof(addr crypto.Address) (*BlockHeader, [][]byte, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	header := bc.currentHeader()
+	proof, err := bc.stateDB.GetProof(header.StateRoot, addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to prove account: %v", err)
+	}
+	return header, proof, nil
+}
+
+// VerifyAccountProof checks the Merkle proof of an account against a state
+// root and returns the account, an empty one if the proof shows that the
+// account does not exist
+func VerifyAccountProof(root crypto.Hash, addr crypto.Address, proof [][]byte) (*Account, error) {
+	enc, err := trie.VerifyProof(root, crypto.Keccak256(addr.Bytes()), proof)
+	if err != nil {
+		return nil, err
+	}
+	if enc == nil {
+		return &Account{Balance: new(big.Int), CodeHash: emptyCodeHash, StorageRoot: trie.EmptyRoot}, nil
+	}
+	return decodeAccount(enc)
+}
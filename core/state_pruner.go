@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"blockchain-node/crypto"
+	"blockchain-node/storage"
+	"blockchain-node/trie"
+)
+
+// stateHistoryKey stores the retained state roots, oldest first
+var stateHistoryKey = []byte("state-history")
+
+// SetRetention sets how many of the most recently committed state roots
+// stay readable, the trie nodes only reachable from older roots are deleted
+// on commit. Zero keeps every state and disables node reference counting.
+func (sdb *StateDB) SetRetention(retain uint64) {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+	sdb.retain = retain
+}
+
+// retainRoot references a newly committed state root and dereferences the
+// roots that fall out of the retention window. The caller must hold sdb.mu.
+func (sdb *StateDB) retainRoot(refs *trie.References, batch storage.Batch, root crypto.Hash) error {
+	if err := refs.Reference(root, accountLeafRefs); err != nil {
+		return fmt.Errorf("failed to reference state root: %v", err)
+	}
+
+	history := append(readStateHistory(sdb.tables.Meta), root)
+	for uint64(len(history)) > sdb.retain {
+		if err := refs.Dereference(history[0], accountLeafRefs); err != nil {
+			return fmt.Errorf("failed to prune state %s: %v", history[0].Hex(), err)
+		}
+		history = history[1:]
+	}
+	sdb.cache.stats.trieNodesPruned.Add(uint64(refs.Deletions()))
+
+	enc := make([]byte, 0, len(history)*crypto.HashLength)
+	for _, root := range history {
+		enc = append(enc, root.Bytes()...)
+	}
+	if err := sdb.tables.Meta.Batch(batch).Put(stateHistoryKey, enc); err != nil {
+		return fmt.Errorf("failed to put state history: %v", err)
+	}
+	return refs.Flush(batch)
+}
+
+// readStateHistory returns the retained state roots, oldest first
+func readStateHistory(meta *storage.Table) []crypto.Hash {
+	enc, err := meta.Get(stateHistoryKey)
+	if err != nil {
+		return nil
+	}
+	history := make([]crypto.Hash, 0, len(enc)/crypto.HashLength)
+	for len(enc) >= crypto.HashLength {
+		history = append(history, crypto.BytesToHash(enc[:crypto.HashLength]))
+		enc = enc[crypto.HashLength:]
+	}
+	return history
+}
+
+// accountLeafRefs returns the storage root referenced by an account in the
+// state trie
+func accountLeafRefs(value []byte) []crypto.Hash {
+	account, err := decodeAccount(value)
+	if err != nil {
+		return nil
+	}
+	return []crypto.Hash{account.StorageRoot}
+}
+
+// SetStateRetention sets how many recent states are kept, see
+// StateDB.SetRetention
+func (bc *Blockchain) SetStateRetention(retain uint64) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.stateDB.SetRetention(retain)
+}
+
+// DropStateReferences deletes the state history and the trie node reference
+// counts left by an earlier run with state retention. An archive node stops
+// counting, so they only go stale; without them a later pruned run treats
+// every node as uncounted and never deletes one that is still in use. The
+// nodes are kept. Counts are deleted at most rate per second in the
+// background of block imports, the number deleted is returned.
+func (bc *Blockchain) DropStateReferences(ctx context.Context, rate int) (int, error) {
+	bc.mu.RLock()
+	bc.stateDB.mu.RLock()
+	retain := bc.stateDB.retain
+	bc.stateDB.mu.RUnlock()
+	bc.mu.RUnlock()
+	if retain > 0 {
+		return 0, errors.New("state retention is enabled")
+	}
+
+	if err := bc.tables.Meta.Delete(stateHistoryKey); err != nil {
+		return 0, fmt.Errorf("failed to delete state history: %v", err)
+	}
+	return bc.tables.TrieRefs.DeletePrefix(ctx, nil, rate)
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"blockchain-node/crypto"
+)
+
+// accountUndo holds the value an account had before a block was applied, a
+// nil Account means the account did not exist
+type accountUndo struct {
+	Address crypto.Address `json:"address"`
+	Account *Account       `json:"account"`
+}
+
+// storageUndo holds the value a storage slot had before a block was applied
+type storageUndo struct {
+	Address crypto.Address `json:"address"`
+	Key     crypto.Hash    `json:"key"`
+	Value   crypto.Hash    `json:"value"`
+}
+
+// stateUndo records everything a block changed in the state so the change
+// can be reverted when the block leaves the canonical chain. The state is
+// stored flat (latest values only), so this is the only way to get back to
+// the state of an ancestor during a reorg.
+type stateUndo struct {
+	Accounts []accountUndo `json:"accounts"`
+	Storage  []storageUndo `json:"storage"`
+}
+
+// newStateUndo collects the previous values of everything cached in state,
+// which must be a modified copy of parent
+func newStateUndo(parent, state *StateDB) *stateUndo {
+	state.mu.RLock()
+	addrs := make([]crypto.Address, 0, len(state.accounts))
+	for addr := range state.accounts {
+		addrs = append(addrs, addr)
+	}
+	var slots []storageUndo
+	for addr, addrStorage := range state.storage {
+		for key := range addrStorage {
+			slots = append(slots, storageUndo{Address: addr, Key: key})
+		}
+	}
+	state.mu.RUnlock()
+
+	undo := &stateUndo{
+		Accounts: make([]accountUndo, 0, len(addrs)),
+		Storage:  make([]storageUndo, 0, len(slots)),
+	}
+	for _, addr := range addrs {
+		undo.Accounts = append(undo.Accounts, accountUndo{
+			Address: addr,
+			Account: copyAccount(parent.GetAccount(addr)),
+		})
+	}
+	for _, slot := range slots {
+		slot.Value = parent.GetStorage(slot.Address, slot.Key)
+		undo.Storage = append(undo.Storage, slot)
+	}
+	return undo
+}
+
+// apply reverts the recorded changes on state
+func (undo *stateUndo) apply(state *StateDB) {
+	for _, entry := range undo.Accounts {
+		if entry.Account == nil {
+			state.removeAccount(entry.Address)
+			continue
+		}
+		state.SetAccount(entry.Address, copyAccount(entry.Account))
+	}
+	for _, slot := range undo.Storage {
+		state.SetStorage(slot.Address, slot.Key, slot.Value)
+	}
+}
+
+// copyAccount returns a deep copy of an account, nil stays nil
+func copyAccount(account *Account) *Account {
+	if account == nil {
+		return nil
+	}
+	balance := new(big.Int)
+	if account.Balance != nil {
+		balance.Set(account.Balance)
+	}
+	return &Account{
+		Nonce:       account.Nonce,
+		Balance:     balance,
+		CodeHash:    account.CodeHash,
+		StorageRoot: account.StorageRoot,
+	}
+}
+
+// writeStateUndo stores the undo record of a block
+func (bc *Blockchain) writeStateUndo(hash crypto.Hash, undo *stateUndo) error {
+	data, err := json.Marshal(undo)
+	if err != nil {
+		return fmt.Errorf("failed to encode state undo: %v", err)
+	}
+	return bc.tables.Undo.Put(hash.Bytes(), data)
+}
+
+// readStateUndo loads the undo record of a block
+func (bc *Blockchain) readStateUndo(hash crypto.Hash) (*stateUndo, error) {
+	data, err := bc.tables.Undo.Get(hash.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("missing state undo for block %x", hash)
+	}
+
+	var undo stateUndo
+	if err := json.Unmarshal(data, &undo); err != nil {
+		return nil, fmt.Errorf("failed to decode state undo: %v", err)
+	}
+	return &undo, nil
+}
@@ -2,70 +2,163 @@
 package core
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"sync"
+	"time"
 
 	"blockchain-node/crypto"
+	"blockchain-node/rlp"
 	"blockchain-node/storage"
+	"blockchain-node/trie"
 )
 
-// StateDB manages the world state using Patricia Merkle Trie structure
+var (
+	// stateRootKey stores the root of the committed state trie
+	stateRootKey = []byte("state-root")
+
+	// emptyCodeHash is the hash of empty code
+	emptyCodeHash = crypto.Keccak256Hash(nil)
+)
+
+// StateDB manages the world state. The state root comes from the account
+// and storage tries that Commit maintains. Next to them the account and
+// storage tables hold the latest committed state as flat key/value pairs
+// (address, and address+slot), a snapshot that serves reads in O(1) instead
+// of trie traversals. States the snapshot does not hold are read from the
+// tries, see readSnapshotRoot.
 type StateDB struct {
 	db       storage.Database
+	tables    *storage.Tables
 	stateRoot crypto.Hash
-	accounts  map[crypto.Address]*Account // In-memory cache
-	storage   map[crypto.Address]map[crypto.Hash]crypto.Hash // Contract storage
+	snapshot  bool        // Whether the flat tables hold this state, see readSnapshotRoot
+	cache     *stateCache // Committed accounts and slots, shared with copies
+	accounts  map[crypto.Address]*Account // Accounts changed since the last commit, nil if removed
+	storage   map[crypto.Address]map[crypto.Hash]crypto.Hash // Storage slots changed since the last commit
+	code      map[crypto.Hash][]byte // Code deployed since the last commit, by hash
+	replaced  map[crypto.Address]bool // Accounts whose stored slots are hidden, see ReplaceStorage
+	destroyed map[crypto.Address]bool // Accounts destroyed since the last commit, see FinaliseTransaction
+	retain    uint64                  // Committed states kept readable, 0 keeps all, see SetRetention
+	preimages map[crypto.Hash][]byte  // Preimages recorded since the last commit
+	record    bool                    // Whether preimages are recorded, see SetPreimageRecording
+	flushSize int                     // Commit batch bytes written out early, 0 writes commits at once, see SetBatchLimit
 	logs      []*Log
+	journal   []func()   // revert actions of the current transaction
+	revisions []revision // snapshots that can be reverted to, by increasing id
+	nextRevID int        // id of the next snapshot
+	tx        *txState   // transaction scoped state, see PrepareTransaction
+	tracer    Tracer     // notified of account and storage changes, may be nil
 	mu        sync.RWMutex
 }
 
 // NewStateDB creates a new StateDB instance
 func NewStateDB(db storage.Database, stateRoot crypto.Hash) *StateDB {
+	tables := storage.NewTables(db)
+	snapshotRoot, ok := readSnapshotRoot(tables.Meta)
 	return &StateDB{
 		db:        db,
+		tables:    tables,
 		stateRoot: stateRoot,
+		snapshot:  ok && snapshotRoot == stateRoot,
+		cache:     newStateCache(),
 		accounts:  make(map[crypto.Address]*Account),
 		storage:   make(map[crypto.Address]map[crypto.Hash]crypto.Hash),
+		code:      make(map[crypto.Hash][]byte),
+		destroyed: make(map[crypto.Address]bool),
+		preimages: make(map[crypto.Hash][]byte),
 		logs:      []*Log{},
+		tx:        newTxState(),
 	}
 }
 
-// GetAccount retrieves an account from the state
+// GetAccount retrieves a copy of an account from the state, changes must be
+// written back with SetAccount
 func (sdb *StateDB) GetAccount(addr crypto.Address) *Account {
 	sdb.mu.RLock()
 	defer sdb.mu.RUnlock()
 
-	// Check cache first
+	// Changes since the last commit come first
 	if account, exists := sdb.accounts[addr]; exists {
-		return account
+		return copyAccount(account)
 	}
+	return sdb.committedAccount(addr)
+}
 
-	// Load from database
-	key := append([]byte("account-"), addr.Bytes()...)
-	data, err := sdb.db.Get(key)
-	if err != nil {
-		return nil
+// committedAccount returns a copy of the committed account, going through
+// the shared cache. The caller must hold sdb.mu, a read lock is enough.
+func (sdb *StateDB) committedAccount(addr crypto.Address) *Account {
+	account, cached := sdb.cache.account(addr)
+	cacheLookup(&sdb.cache.stats.accountCacheHits, &sdb.cache.stats.accountCacheMisses, cached)
+	if cached {
+		return account
 	}
 
-	var account Account
-	if err := json.Unmarshal(data, &account); err != nil {
+	account = sdb.loadAccount(addr)
+	if account == nil {
 		return nil
 	}
+	sdb.cache.setAccount(addr, account)
+	return account
+}
 
-	// Cache the account
-	sdb.accounts[addr] = &account
-	return &account
+// loadAccount reads an account from the database, bypassing the cache.
+// The snapshot serves it if it holds this state, the state trie otherwise.
+func (sdb *StateDB) loadAccount(addr crypto.Address) *Account {
+	sdb.cache.stats.accountReads.Add(1)
+	if !sdb.snapshot {
+		return sdb.loadTrieAccount(addr)
+	}
+	return sdb.loadFlatAccount(addr)
 }
 
 // SetAccount updates an account in the state
 func (sdb *StateDB) SetAccount(addr crypto.Address, account *Account) {
+	if sdb.tracer != nil {
+		defer sdb.captureAccountChange(addr, sdb.GetAccount(addr), copyAccount(account))
+	}
+
 	sdb.mu.Lock()
 	defer sdb.mu.Unlock()
 
+	sdb.journalAccount(addr)
+
 	// Update cache
-	sdb.accounts[addr] = account
+	sdb.accounts[addr] = copyAccount(account)
+}
+
+// removeAccount marks an account as non-existent, it is deleted from the
+// database on the next commit
+func (sdb *StateDB) removeAccount(addr crypto.Address) {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+
+	sdb.journalAccount(addr)
+	sdb.accounts[addr] = nil
+}
+
+// SetTracer sets the tracer notified of state changes, nil disables it
+func (sdb *StateDB) SetTracer(tracer Tracer) {
+	sdb.tracer = tracer
+}
+
+// captureAccountChange reports the differences between two versions of an
+// account to the tracer
+func (sdb *StateDB) captureAccountChange(addr crypto.Address, prev, current *Account) {
+	if prev == nil {
+		prev = &Account{Balance: big.NewInt(0)}
+	}
+	if prev.Balance.Cmp(current.Balance) != 0 {
+		sdb.tracer.CaptureBalanceChange(addr, prev.Balance, current.Balance)
+	}
+	if prev.Nonce != current.Nonce {
+		sdb.tracer.CaptureNonceChange(addr, prev.Nonce, current.Nonce)
+	}
+	if prev.CodeHash != current.CodeHash {
+		sdb.tracer.CaptureCodeChange(addr, prev.CodeHash, current.CodeHash)
+	}
 }
 
 // GetBalance returns the balance of an account
@@ -123,12 +216,26 @@ func (sdb *StateDB) GetCode(addr crypto.Address) []byte {
 		return nil
 	}
 
+	// Code deployed since the last commit is not in the database yet
+	sdb.mu.RLock()
+	code, pending := sdb.code[account.CodeHash]
+	sdb.mu.RUnlock()
+	if pending {
+		return code
+	}
+
+	code, cached := sdb.cache.contractCode(account.CodeHash)
+	cacheLookup(&sdb.cache.stats.codeCacheHits, &sdb.cache.stats.codeCacheMisses, cached)
+	if cached {
+		return code
+	}
+
 	// Load code from database
-	key := append([]byte("code-"), account.CodeHash.Bytes()...)
-	data, err := sdb.db.Get(key)
+	data, err := sdb.tables.Code.Get(account.CodeHash.Bytes())
 	if err != nil {
 		return nil
 	}
+	sdb.cache.setContractCode(account.CodeHash, data)
 
 	return data
 }
@@ -147,9 +254,12 @@ func (sdb *StateDB) SetCode(addr crypto.Address, code []byte) {
 	codeHash := crypto.Keccak256Hash(code)
 	account.CodeHash = codeHash
 
-	// Store code in database
-	key := append([]byte("code-"), codeHash.Bytes()...)
-	sdb.db.Put(key, code)
+	// The code is written to the database on commit, so code deployed by
+	// reverted or simulated executions never reaches it
+	sdb.mu.Lock()
+	sdb.journalCode(codeHash)
+	sdb.code[codeHash] = append([]byte{}, code...)
+	sdb.mu.Unlock()
 
 	sdb.SetAccount(addr, account)
 }
@@ -159,43 +269,48 @@ func (sdb *StateDB) GetStorage(addr crypto.Address, key crypto.Hash) crypto.Hash
 	sdb.mu.RLock()
 	defer sdb.mu.RUnlock()
 
-	// Check cache first
-	if addrStorage, exists := sdb.storage[addr]; exists {
-		if value, exists := addrStorage[key]; exists {
-			return value
-		}
+	// Changes since the last commit come first
+	if value, exists := sdb.storage[addr][key]; exists {
+		return value
 	}
+	return sdb.committedStorage(addr, key)
+}
 
-	// Load from database
-	dbKey := append([]byte("storage-"), addr.Bytes()...)
-	dbKey = append(dbKey, key.Bytes()...)
-	
-	data, err := sdb.db.Get(dbKey)
-	if err != nil {
-		return crypto.Hash{}
+// SetStorage updates a storage value for a contract
+func (sdb *StateDB) SetStorage(addr crypto.Address, key crypto.Hash, value crypto.Hash) {
+	if sdb.tracer != nil {
+		defer sdb.tracer.CaptureStorageChange(addr, key, sdb.GetStorage(addr, key), value)
 	}
 
-	value := crypto.BytesToHash(data)
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+
+	sdb.journalStorage(addr, key)
 
-	// Cache the value
+	// Update cache
 	if sdb.storage[addr] == nil {
 		sdb.storage[addr] = make(map[crypto.Hash]crypto.Hash)
 	}
 	sdb.storage[addr][key] = value
-
-	return value
 }
 
-// SetStorage updates a storage value for a contract
-func (sdb *StateDB) SetStorage(addr crypto.Address, key crypto.Hash, value crypto.Hash) {
+// ReplaceStorage discards the storage of an account and replaces it with
+// the given slots, all other slots read as zero. It is meant for simulations
+// on a copy of the state: the change is not journaled and slots that are
+// not listed are not deleted from the database on commit.
+func (sdb *StateDB) ReplaceStorage(addr crypto.Address, storage map[crypto.Hash]crypto.Hash) {
 	sdb.mu.Lock()
 	defer sdb.mu.Unlock()
 
-	// Update cache
-	if sdb.storage[addr] == nil {
-		sdb.storage[addr] = make(map[crypto.Hash]crypto.Hash)
+	if sdb.replaced == nil {
+		sdb.replaced = make(map[crypto.Address]bool)
+	}
+	sdb.replaced[addr] = true
+
+	sdb.storage[addr] = make(map[crypto.Hash]crypto.Hash, len(storage))
+	for key, value := range storage {
+		sdb.storage[addr][key] = value
 	}
-	sdb.storage[addr][key] = value
 }
 
 // AddLog adds a log to the state
@@ -203,6 +318,10 @@ func (sdb *StateDB) AddLog(log *Log) {
 	sdb.mu.Lock()
 	defer sdb.mu.Unlock()
 	
+	prevLen := len(sdb.logs)
+	sdb.journal = append(sdb.journal, func() {
+		sdb.logs = sdb.logs[:prevLen]
+	})
 	sdb.logs = append(sdb.logs, log)
 }
 
@@ -216,83 +335,402 @@ func (sdb *StateDB) GetLogs() []*Log {
 
 // Commit commits all changes to the database and returns the new state root
 func (sdb *StateDB) Commit() (crypto.Hash, error) {
-	sdb.mu.Lock()
-	defer sdb.mu.Unlock()
+	return sdb.commit(nil)
+}
 
-	// Create a batch for atomic writes
-	batch := sdb.db.NewBatch()
+// CommitBlock commits like Commit and records in the same write that the
+// state belongs to the given block, so that the two can not disagree after
+// a crash, see repairChain
+func (sdb *StateDB) CommitBlock(hash crypto.Hash) (crypto.Hash, error) {
+	sdb.mu.RLock()
+	flushes := sdb.flushSize > 0
+	sdb.mu.RUnlock()
+	if flushes {
+		if err := sdb.tables.Meta.Put(stateCommitKey, hash.Bytes()); err != nil {
+			return crypto.Hash{}, fmt.Errorf("failed to put state commit marker: %v", err)
+		}
+	}
+	return sdb.commit(func(batch storage.Batch) error {
+		meta := sdb.tables.Meta.Batch(batch)
+		if err := meta.Delete(stateCommitKey); err != nil {
+			return err
+		}
+		return meta.Put(stateHeadKey, hash.Bytes())
+	})
+}
 
-	// Commit all account changes
-	for addr, account := range sdb.accounts {
-		data, err := json.Marshal(account)
-		if err != nil {
-			return crypto.Hash{}, fmt.Errorf("failed to marshal account: %v", err)
+// commit writes all changes and whatever extra adds in one batch
+func (sdb *StateDB) commit(extra func(storage.Batch) error) (crypto.Hash, error) {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+	start := time.Now()
+
+	// Create a batch for atomic writes, with a view of it per table. With a
+	// batch limit it is written in parts, the state root and head markers
+	// always go last.
+	// Only a state the snapshot holds is written to it. A commit written in
+	// parts leaves the snapshot matching no root until it completes.
+	flat := sdb.snapshot
+	if !flat && extra != nil {
+		return crypto.Hash{}, fmt.Errorf("state %x is not held by the snapshot", sdb.stateRoot)
+	}
+	if flat && sdb.flushSize > 0 {
+		if err := sdb.tables.Meta.Delete(snapshotRootKey); err != nil {
+			return crypto.Hash{}, fmt.Errorf("failed to delete snapshot root: %v", err)
 		}
+	}
+	batch := storage.NewFlushingBatch(sdb.db.NewBatch(), sdb.flushSize)
+	accountBatch := sdb.tables.Accounts.Batch(batch)
+	storageBatch := sdb.tables.Storage.Batch(batch)
 
-		key := append([]byte("account-"), addr.Bytes()...)
-		if err := batch.Put(key, data); err != nil {
-			return crypto.Hash{}, fmt.Errorf("failed to put account: %v", err)
+	accountTrie, err := trie.New(sdb.stateRoot, sdb.db)
+	if err != nil {
+		return crypto.Hash{}, fmt.Errorf("failed to open state trie: %v", err)
+	}
+	// Nodes are only reference counted when old states are pruned
+	var refs *trie.References
+	if sdb.retain > 0 {
+		refs = trie.NewReferences(sdb.db)
+	}
+
+	// Destroyed accounts lose all their stored slots, the storage trie goes
+	// away with the account. Code is kept since other accounts may share it.
+	if flat {
+		for addr := range sdb.destroyed {
+			it := sdb.tables.Storage.NewIterator(addr.Bytes(), nil)
+			for it.Next() {
+				if err := storageBatch.Delete(append([]byte{}, it.Key()...)); err != nil {
+					it.Release()
+					return crypto.Hash{}, fmt.Errorf("failed to delete storage: %v", err)
+				}
+			}
+			err := it.Error()
+			it.Release()
+			if err != nil {
+				return crypto.Hash{}, fmt.Errorf("failed to iterate storage of %s: %v", addr.Hex(), err)
+			}
 		}
 	}
 
-	// Commit all storage changes
+	// Commit all storage changes, the new storage roots go into the accounts.
+	// Slots written back with their committed value are skipped.
+	storageWrites, accountWrites := 0, 0
 	for addr, addrStorage := range sdb.storage {
+		changedSlots := make(map[crypto.Hash]crypto.Hash, len(addrStorage))
 		for key, value := range addrStorage {
-			dbKey := append([]byte("storage-"), addr.Bytes()...)
-			dbKey = append(dbKey, key.Bytes()...)
-			
-			if err := batch.Put(dbKey, value.Bytes()); err != nil {
+			if value == sdb.committedStorage(addr, key) {
+				continue
+			}
+			changedSlots[key] = value
+			if !flat {
+				continue
+			}
+
+			dbKey := append(addr.Bytes(), key.Bytes()...)
+			if err := storageBatch.Put(dbKey, value.Bytes()); err != nil {
 				return crypto.Hash{}, fmt.Errorf("failed to put storage: %v", err)
 			}
 		}
+		if len(changedSlots) == 0 {
+			continue
+		}
+		storageWrites += len(changedSlots)
+
+		account, changed := sdb.accounts[addr]
+		if !changed {
+			account = sdb.committedAccount(addr)
+		}
+		if account == nil {
+			continue
+		}
+		storageRoot, nodes, err := commitStorageTrie(sdb.db, batch, refs, account.StorageRoot, changedSlots)
+		if err != nil {
+			return crypto.Hash{}, fmt.Errorf("failed to commit storage of %s: %v", addr.Hex(), err)
+		}
+		sdb.cache.stats.trieNodesCommitted.Add(uint64(nodes))
+		account.StorageRoot = storageRoot
+		sdb.accounts[addr] = account
+	}
+
+	// Commit all account changes, skipping accounts that end up unchanged
+	for addr, account := range sdb.accounts {
+		if accountsEqual(account, sdb.committedAccount(addr)) {
+			continue
+		}
+		key := addr.Bytes()
+		trieKey := crypto.Keccak256(addr.Bytes())
+		accountWrites++
+
+		// Accounts removed by a chain rewind are deleted from the database
+		if account == nil {
+			if flat {
+				if err := accountBatch.Delete(key); err != nil {
+					return crypto.Hash{}, fmt.Errorf("failed to delete account: %v", err)
+				}
+			}
+			if err := accountTrie.Delete(trieKey); err != nil {
+				return crypto.Hash{}, fmt.Errorf("failed to delete account from trie: %v", err)
+			}
+			continue
+		}
+
+		if flat {
+			data, err := json.Marshal(account)
+			if err != nil {
+				return crypto.Hash{}, fmt.Errorf("failed to marshal account: %v", err)
+			}
+			if err := accountBatch.Put(key, data); err != nil {
+				return crypto.Hash{}, fmt.Errorf("failed to put account: %v", err)
+			}
+		}
+		if err := accountTrie.Update(trieKey, encodeAccount(account)); err != nil {
+			return crypto.Hash{}, fmt.Errorf("failed to update account in trie: %v", err)
+		}
+	}
+
+	// Commit deployed code
+	for codeHash, code := range sdb.code {
+		if err := sdb.tables.Code.Batch(batch).Put(codeHash.Bytes(), code); err != nil {
+			return crypto.Hash{}, fmt.Errorf("failed to put code: %v", err)
+		}
+	}
+
+	newStateRoot, err := accountTrie.Commit(batch, refs)
+	if err != nil {
+		return crypto.Hash{}, fmt.Errorf("failed to commit state trie: %v", err)
+	}
+	if refs != nil {
+		if err := sdb.retainRoot(refs, batch, newStateRoot); err != nil {
+			return crypto.Hash{}, err
+		}
+	}
+	// Only a state the snapshot holds becomes the state of the database,
+	// others just persist their tries
+	if flat {
+		meta := sdb.tables.Meta.Batch(batch)
+		if err := meta.Put(stateRootKey, newStateRoot.Bytes()); err != nil {
+			return crypto.Hash{}, fmt.Errorf("failed to put state root: %v", err)
+		}
+		if err := meta.Put(snapshotRootKey, newStateRoot.Bytes()); err != nil {
+			return crypto.Hash{}, fmt.Errorf("failed to put snapshot root: %v", err)
+		}
+	}
+	if err := sdb.writePreimages(batch); err != nil {
+		return crypto.Hash{}, err
+	}
+	if extra != nil {
+		if err := extra(batch); err != nil {
+			return crypto.Hash{}, err
+		}
 	}
 
 	// Write the batch
 	if err := batch.Write(); err != nil {
 		return crypto.Hash{}, fmt.Errorf("failed to write batch: %v", err)
 	}
-
-	// Calculate new state root
-	newStateRoot := sdb.calculateStateRoot()
 	sdb.stateRoot = newStateRoot
 
-	// Clear caches
+	sdb.cache.stats.accountWrites.Add(uint64(accountWrites))
+	sdb.cache.stats.storageWrites.Add(uint64(storageWrites))
+	sdb.cache.stats.trieNodesCommitted.Add(uint64(accountTrie.Committed()))
+	sdb.cache.stats.commitDone(time.Since(start))
+
+	// The committed values replace the cached ones
+	for addr := range sdb.destroyed {
+		sdb.cache.removeSlots(addr)
+	}
+	for addr, account := range sdb.accounts {
+		sdb.cache.setAccount(addr, account)
+	}
+	for addr, addrStorage := range sdb.storage {
+		sdb.cache.setSlots(addr, addrStorage)
+	}
+	for codeHash, code := range sdb.code {
+		sdb.cache.setContractCode(codeHash, code)
+	}
+
+	// Clear the changes
 	sdb.accounts = make(map[crypto.Address]*Account)
 	sdb.storage = make(map[crypto.Address]map[crypto.Hash]crypto.Hash)
+	sdb.code = make(map[crypto.Hash][]byte)
+	sdb.destroyed = make(map[crypto.Address]bool)
+	sdb.preimages = make(map[crypto.Hash][]byte)
 	sdb.logs = []*Log{}
+	sdb.resetJournal()
 
 	return newStateRoot, nil
 }
 
-// calculateStateRoot calculates the state root using a simple merkle tree
-func (sdb *StateDB) calculateStateRoot() crypto.Hash {
-	// Simple implementation: hash all account addresses and balances
-	// In a real implementation, this would be a proper Patricia Merkle Trie
-	
-	var data []byte
-	
-	// Add accounts to hash calculation
-	for addr, account := range sdb.accounts {
-		data = append(data, addr.Bytes()...)
-		data = append(data, account.Balance.Bytes()...)
-		data = append(data, big.NewInt(int64(account.Nonce)).Bytes()...)
-		data = append(data, account.CodeHash.Bytes()...)
+// IntermediateRoot returns the state root the changes since the last commit
+// would produce, without writing anything
+func (sdb *StateDB) IntermediateRoot() (crypto.Hash, error) {
+	sdb.mu.RLock()
+	defer sdb.mu.RUnlock()
+
+	accountTrie, err := trie.New(sdb.stateRoot, sdb.db)
+	if err != nil {
+		return crypto.Hash{}, fmt.Errorf("failed to open state trie: %v", err)
 	}
 
-	// Add storage to hash calculation
+	// New storage roots go into copies of the accounts, like in commit
+	accounts := make(map[crypto.Address]*Account, len(sdb.accounts))
+	for addr, account := range sdb.accounts {
+		accounts[addr] = account
+	}
 	for addr, addrStorage := range sdb.storage {
-		data = append(data, addr.Bytes()...)
+		account, changed := accounts[addr]
+		if !changed {
+			account = sdb.committedAccount(addr)
+		}
+		if account == nil {
+			continue
+		}
+		storageTrie, err := trie.New(account.StorageRoot, sdb.db)
+		if err != nil {
+			return crypto.Hash{}, fmt.Errorf("failed to open storage trie of %s: %v", addr.Hex(), err)
+		}
+		updated := false
 		for key, value := range addrStorage {
-			data = append(data, key.Bytes()...)
-			data = append(data, value.Bytes()...)
+			if value == sdb.committedStorage(addr, key) {
+				continue
+			}
+			var enc []byte
+			if !value.IsZero() {
+				enc = rlp.EncodeBytes(bytes.TrimLeft(value.Bytes(), "\x00"))
+			}
+			if err := storageTrie.Update(crypto.Keccak256(key.Bytes()), enc); err != nil {
+				return crypto.Hash{}, err
+			}
+			updated = true
+		}
+		if !updated {
+			continue
 		}
+		account = copyAccount(account)
+		account.StorageRoot = storageTrie.Hash()
+		accounts[addr] = account
 	}
 
-	if len(data) == 0 {
-		return crypto.Hash{}
+	for addr, account := range accounts {
+		if accountsEqual(account, sdb.committedAccount(addr)) {
+			continue
+		}
+		trieKey := crypto.Keccak256(addr.Bytes())
+		if account == nil {
+			err = accountTrie.Delete(trieKey)
+		} else {
+			err = accountTrie.Update(trieKey, encodeAccount(account))
+		}
+		if err != nil {
+			return crypto.Hash{}, fmt.Errorf("failed to update account in trie: %v", err)
+		}
+	}
+	return accountTrie.Hash(), nil
+}
+
+// accountsEqual reports whether two versions of an account are identical,
+// nil meaning that the account does not exist
+func accountsEqual(a, b *Account) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
+	return a.Nonce == b.Nonce &&
+		a.Balance.Cmp(b.Balance) == 0 &&
+		a.CodeHash == b.CodeHash &&
+		a.StorageRoot == b.StorageRoot
+}
 
-	return crypto.Keccak256Hash(data)
+// commitStorageTrie applies changed storage slots to the storage trie with
+// the given root and returns the new root and the number of stored nodes
+func commitStorageTrie(db storage.Database, batch storage.Batch, refs *trie.References, root crypto.Hash, slots map[crypto.Hash]crypto.Hash) (crypto.Hash, int, error) {
+	storageTrie, err := trie.New(root, db)
+	if err != nil {
+		return crypto.Hash{}, 0, err
+	}
+	for key, value := range slots {
+		// Zero slots are removed, others hold their value without leading zeros
+		var enc []byte
+		if !value.IsZero() {
+			enc = rlp.EncodeBytes(bytes.TrimLeft(value.Bytes(), "\x00"))
+		}
+		if err := storageTrie.Update(crypto.Keccak256(key.Bytes()), enc); err != nil {
+			return crypto.Hash{}, 0, err
+		}
+	}
+	newRoot, err := storageTrie.Commit(batch, refs)
+	return newRoot, storageTrie.Committed(), err
+}
+
+// encodeAccount returns the RLP encoding of an account in the state trie.
+// Accounts without storage or code use the hashes of the empty trie and of
+// empty code, as in Ethereum.
+func encodeAccount(account *Account) []byte {
+	storageRoot := account.StorageRoot
+	if storageRoot.IsZero() {
+		storageRoot = trie.EmptyRoot
+	}
+	codeHash := account.CodeHash
+	if codeHash.IsZero() {
+		codeHash = emptyCodeHash
+	}
+	return rlp.EncodeList(
+		rlp.EncodeUint64(account.Nonce),
+		rlp.EncodeBig(account.Balance),
+		rlp.EncodeBytes(storageRoot.Bytes()),
+		rlp.EncodeBytes(codeHash.Bytes()),
+	)
+}
+
+// decodeAccount parses an account encoded by encodeAccount
+func decodeAccount(enc []byte) (*Account, error) {
+	fields, _, err := rlp.SplitList(enc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid account: %v", err)
+	}
+
+	var items [4][]byte
+	for i := range items {
+		if items[i], fields, err = rlp.SplitString(fields); err != nil {
+			return nil, fmt.Errorf("invalid account field %d: %v", i, err)
+		}
+	}
+	if len(fields) > 0 {
+		return nil, errors.New("invalid account: trailing fields")
+	}
+
+	nonce, err := rlp.DecodeUint64(items[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid account nonce: %v", err)
+	}
+	balance, err := rlp.DecodeBig(items[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid account balance: %v", err)
+	}
+	return &Account{
+		Nonce:       nonce,
+		Balance:     balance,
+		StorageRoot: crypto.BytesToHash(items[2]),
+		CodeHash:    crypto.BytesToHash(items[3]),
+	}, nil
+}
+
+// decodeStorageValue parses a storage slot value stored in a storage trie
+func decodeStorageValue(enc []byte) (crypto.Hash, error) {
+	content, _, err := rlp.SplitString(enc)
+	if err != nil {
+		return crypto.Hash{}, err
+	}
+	return crypto.BytesToHash(content), nil
+}
+
+// readStateRoot returns the root of the committed state trie, the zero hash
+// (an empty trie) if no state has been committed
+func readStateRoot(meta *storage.Table) crypto.Hash {
+	data, err := meta.Get(stateRootKey)
+	if err != nil {
+		return crypto.Hash{}
+	}
+	return crypto.BytesToHash(data)
 }
 
 // Copy creates a deep copy of the StateDB
@@ -302,14 +740,28 @@ func (sdb *StateDB) Copy() *StateDB {
 
 	copy := &StateDB{
 		db:        sdb.db,
+		tables:    sdb.tables,
 		stateRoot: sdb.stateRoot,
+		snapshot:  sdb.snapshot,
+		cache:     sdb.cache,
 		accounts:  make(map[crypto.Address]*Account),
 		storage:   make(map[crypto.Address]map[crypto.Hash]crypto.Hash),
+		code:      make(map[crypto.Hash][]byte, len(sdb.code)),
+		destroyed: make(map[crypto.Address]bool, len(sdb.destroyed)),
+		retain:    sdb.retain,
+		preimages: make(map[crypto.Hash][]byte, len(sdb.preimages)),
+		record:    sdb.record,
+		flushSize: sdb.flushSize,
 		logs:      make([]*Log, len(sdb.logs)),
+		tx:        newTxState(),
 	}
 
 	// Copy accounts
 	for addr, account := range sdb.accounts {
+		if account == nil {
+			copy.accounts[addr] = nil
+			continue
+		}
 		copy.accounts[addr] = &Account{
 			Nonce:       account.Nonce,
 			Balance:     new(big.Int).Set(account.Balance),
@@ -326,6 +778,23 @@ func (sdb *StateDB) Copy() *StateDB {
 		}
 	}
 
+	// Deployed code is never modified, it can be shared
+	for codeHash, code := range sdb.code {
+		copy.code[codeHash] = code
+	}
+	for addr := range sdb.destroyed {
+		copy.destroyed[addr] = true
+	}
+	for hash, preimage := range sdb.preimages {
+		copy.preimages[hash] = preimage
+	}
+	for addr := range sdb.replaced {
+		if copy.replaced == nil {
+			copy.replaced = make(map[crypto.Address]bool)
+		}
+		copy.replaced[addr] = true
+	}
+
 	// Copy logs
 	for i, log := range sdb.logs {
 		copy.logs[i] = &Log{
@@ -368,7 +837,8 @@ func (sdb *StateDB) Exist(addr crypto.Address) bool {
 	return sdb.GetAccount(addr) != nil
 }
 
-// GetAccountsCount returns the number of accounts in the cache
+// GetAccountsCount returns the number of accounts changed since the last
+// commit
 func (sdb *StateDB) GetAccountsCount() int {
 	sdb.mu.RLock()
 	defer sdb.mu.RUnlock()
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"math/big"
+
+	"blockchain-node/crypto"
+)
+
+// CallType identifies the kind of a call frame reported to a Tracer
+type CallType string
+
+// Call frame types
+const (
+	CallTypeCall         CallType = "CALL"
+	CallTypeCallCode     CallType = "CALLCODE"
+	CallTypeDelegateCall CallType = "DELEGATECALL"
+	CallTypeStaticCall   CallType = "STATICCALL"
+	CallTypeCreate       CallType = "CREATE"
+	CallTypeCreate2      CallType = "CREATE2"
+	CallTypeSelfDestruct CallType = "SELFDESTRUCT"
+)
+
+// ScopeContext exposes the call frame executing an opcode to a Tracer. The
+// returned values must not be modified.
+type ScopeContext interface {
+	MemoryData() []byte
+	StackData() []*big.Int
+	Caller() crypto.Address
+	Address() crypto.Address
+	CallValue() *big.Int
+	CallInput() []byte
+}
+
+// Tracer receives the events of transaction execution. It is set in the
+// ExecutionConfig and called synchronously, implementations must not modify
+// the state. Debug tracing, gas profiling and analytics are built on it.
+type Tracer interface {
+	// CaptureTxStart is called once a transaction passed validation, before
+	// gas is bought
+	CaptureTxStart(tx *Transaction)
+	// CaptureTxEnd is called with the result once the transaction executed
+	CaptureTxEnd(result *ExecutionResult)
+
+	// CaptureStart is called when the top level call frame is entered. to is
+	// the contract address for contract creations.
+	CaptureStart(from, to crypto.Address, create bool, input []byte, gas uint64, value *big.Int)
+	// CaptureEnd is called when the top level call frame returns
+	CaptureEnd(output []byte, gasUsed uint64, err error)
+
+	// CaptureEnter is called when a nested call frame is entered
+	CaptureEnter(typ CallType, from, to crypto.Address, input []byte, gas uint64, value *big.Int)
+	// CaptureExit is called when a nested call frame returns
+	CaptureExit(output []byte, gasUsed uint64, err error)
+
+	// CaptureState is called before every opcode is executed. cost is the
+	// gas charged for the opcode, gas the gas available before charging it.
+	CaptureState(pc uint64, op byte, gas, cost uint64, scope ScopeContext, depth int, err error)
+	// CaptureFault is called when an opcode fails to execute
+	CaptureFault(pc uint64, op byte, gas, cost uint64, scope ScopeContext, depth int, err error)
+
+	// CaptureBalanceChange is called when the balance of an account changes
+	CaptureBalanceChange(addr crypto.Address, prev, current *big.Int)
+	// CaptureNonceChange is called when the nonce of an account changes
+	CaptureNonceChange(addr crypto.Address, prev, current uint64)
+	// CaptureCodeChange is called when code is deployed to an account
+	CaptureCodeChange(addr crypto.Address, prevHash, codeHash crypto.Hash)
+	// CaptureStorageChange is called when a storage slot is written
+	CaptureStorageChange(addr crypto.Address, key, prev, current crypto.Hash)
+}
+
+// NoopTracer implements Tracer with empty hooks. Tracers interested in a
+// few events embed it and override only those.
+type NoopTracer struct{}
+
+func (NoopTracer) CaptureTxStart(*Transaction)                                                     {}
+func (NoopTracer) CaptureTxEnd(*ExecutionResult)                                                   {}
+func (NoopTracer) CaptureStart(crypto.Address, crypto.Address, bool, []byte, uint64, *big.Int)     {}
+func (NoopTracer) CaptureEnd([]byte, uint64, error)                                                {}
+func (NoopTracer) CaptureEnter(CallType, crypto.Address, crypto.Address, []byte, uint64, *big.Int) {}
+func (NoopTracer) CaptureExit([]byte, uint64, error)                                               {}
+func (NoopTracer) CaptureState(uint64, byte, uint64, uint64, ScopeContext, int, error)             {}
+func (NoopTracer) CaptureFault(uint64, byte, uint64, uint64, ScopeContext, int, error)             {}
+func (NoopTracer) CaptureBalanceChange(crypto.Address, *big.Int, *big.Int)                         {}
+func (NoopTracer) CaptureNonceChange(crypto.Address, uint64, uint64)                               {}
+func (NoopTracer) CaptureCodeChange(crypto.Address, crypto.Hash, crypto.Hash)                      {}
+func (NoopTracer) CaptureStorageChange(crypto.Address, crypto.Hash, crypto.Hash, crypto.Hash)      {}
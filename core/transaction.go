@@ -0,0 +1,377 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"blockchain-node/crypto"
+	"blockchain-node/rlp"
+)
+
+// Transaction types
+const (
+	LegacyTxType     = 0x00
+	AccessListTxType = 0x01 // EIP-2930
+	DynamicFeeTxType = 0x02 // EIP-1559
+)
+
+var (
+	ErrTxTypeNotSupported  = errors.New("transaction type not supported")
+	ErrInvalidChainID      = errors.New("invalid chain id")
+	ErrTipAboveFeeCap      = errors.New("max priority fee per gas higher than max fee per gas")
+	ErrInvalidSignatureV   = errors.New("invalid signature v value")
+	ErrInvalidTxEncoding   = errors.New("invalid transaction encoding")
+	ErrTrailingTxRLPFields = errors.New("trailing data after transaction fields")
+)
+
+// Intrinsic gas of access lists (EIP-2930)
+const (
+	TxAccessListAddressGas    = 2400 // Per address in the access list
+	TxAccessListStorageKeyGas = 1900 // Per storage key in the access list
+)
+
+// AccessTuple is an address together with the storage slots a transaction
+// plans to access
+type AccessTuple struct {
+	Address     crypto.Address `json:"address"`
+	StorageKeys []crypto.Hash  `json:"storageKeys"`
+}
+
+// AccessList is the EIP-2930 access list of a transaction
+type AccessList []AccessTuple
+
+// StorageKeys returns the total number of storage keys in the list
+func (al AccessList) StorageKeys() int {
+	count := 0
+	for _, tuple := range al {
+		count += len(tuple.StorageKeys)
+	}
+	return count
+}
+
+// FeeCap returns the maximum price per gas the sender pays. This is the gas
+// price for legacy and access list transactions.
+func (tx *Transaction) FeeCap() *big.Int {
+	return tx.GasPrice
+}
+
+// TipCap returns the maximum priority fee per gas paid to the block
+// producer. This is the gas price for legacy and access list transactions.
+func (tx *Transaction) TipCap() *big.Int {
+	if tx.Type == DynamicFeeTxType && tx.GasTipCap != nil {
+		return tx.GasTipCap
+	}
+	return tx.GasPrice
+}
+
+// EffectiveGasPrice returns the price per gas paid in a block with the given
+// base fee: the base fee plus the tip, capped at the fee cap
+func (tx *Transaction) EffectiveGasPrice(baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return new(big.Int).Set(tx.FeeCap())
+	}
+	price := new(big.Int).Add(baseFee, tx.TipCap())
+	if price.Cmp(tx.FeeCap()) > 0 {
+		price.Set(tx.FeeCap())
+	}
+	return price
+}
+
+// ChainIDOf returns the chain the transaction is signed for, nil for legacy
+// transactions signed without replay protection
+func (tx *Transaction) ChainIDOf() *big.Int {
+	if tx.Type != LegacyTxType {
+		return tx.ChainID
+	}
+	if tx.V == nil || tx.V.Cmp(big.NewInt(35)) < 0 {
+		return nil
+	}
+	// v = chainID*2 + 35 + yParity (EIP-155)
+	chainID := new(big.Int).Sub(tx.V, big.NewInt(35))
+	return chainID.Rsh(chainID, 1)
+}
+
+// Sender recovers the address that signed the transaction
+func Sender(tx *Transaction) (crypto.Address, error) {
+	return senderCacher.sender(tx)
+}
+
+// SignTx signs tx with key for the chain chainID and sets its signature,
+// hash and sender. Legacy transactions are signed with replay protection
+// (EIP-155).
+func SignTx(tx *Transaction, chainID *big.Int, key *ecdsa.PrivateKey) error {
+	if tx.Type == LegacyTxType {
+		// v = chainID*2 + 35 + yParity (EIP-155), the hash commits to it
+		tx.V = new(big.Int).Add(new(big.Int).Lsh(chainID, 1), big.NewInt(35))
+	} else {
+		tx.ChainID = new(big.Int).Set(chainID)
+	}
+	sig, err := crypto.Sign(tx.SigningHash().Bytes(), key)
+	if err != nil {
+		return err
+	}
+	tx.R = new(big.Int).SetBytes(sig[:32])
+	tx.S = new(big.Int).SetBytes(sig[32:64])
+	if tx.Type == LegacyTxType {
+		tx.V.Add(tx.V, big.NewInt(int64(sig[64])))
+	} else {
+		tx.V = big.NewInt(int64(sig[64]))
+	}
+	tx.Hash = crypto.Keccak256Hash(tx.Encode())
+	tx.From = crypto.PubkeyToAddress(crypto.FromECDSAPub(&key.PublicKey))
+	return nil
+}
+
+// Protected reports whether the signature commits to a chain ID, which
+// prevents the transaction from being replayed on other chains (EIP-155)
+func (tx *Transaction) Protected() bool {
+	return tx.ChainIDOf() != nil
+}
+
+// recoveryID returns the recovery id (y parity) of the signature
+func (tx *Transaction) recoveryID() (byte, error) {
+	if tx.V == nil || !tx.V.IsUint64() {
+		return 0, ErrInvalidSignatureV
+	}
+	v := tx.V.Uint64()
+
+	if tx.Type != LegacyTxType {
+		if v > 1 {
+			return 0, ErrInvalidSignatureV
+		}
+		return byte(v), nil
+	}
+
+	switch {
+	case v == 27 || v == 28:
+		return byte(v - 27), nil
+	case v >= 35:
+		return byte((v - 35) % 2), nil
+	}
+	return 0, ErrInvalidSignatureV
+}
+
+// SigningHash returns the hash the sender signs. Legacy transactions use
+// EIP-155 replay protection when their V value carries a chain id.
+func (tx *Transaction) SigningHash() crypto.Hash {
+	fields := tx.payloadFields()
+	if tx.Type == LegacyTxType {
+		if chainID := tx.ChainIDOf(); chainID != nil {
+			fields = append(fields, rlp.EncodeBig(chainID), rlp.EncodeUint64(0), rlp.EncodeUint64(0))
+		}
+		return crypto.Keccak256Hash(rlp.EncodeList(fields...))
+	}
+	return crypto.Keccak256Hash([]byte{tx.Type}, rlp.EncodeList(fields...))
+}
+
+// Encode returns the consensus encoding of the signed transaction: the RLP
+// list for legacy transactions, the type byte followed by the RLP list for
+// typed transactions (EIP-2718)
+func (tx *Transaction) Encode() []byte {
+	fields := append(tx.payloadFields(), rlp.EncodeBig(tx.V), rlp.EncodeBig(tx.R), rlp.EncodeBig(tx.S))
+	if tx.Type == LegacyTxType {
+		return rlp.EncodeList(fields...)
+	}
+	return append([]byte{tx.Type}, rlp.EncodeList(fields...)...)
+}
+
+// payloadFields returns the encoded fields of the transaction without the
+// signature
+func (tx *Transaction) payloadFields() [][]byte {
+	to := rlp.EncodeBytes(nil)
+	if tx.To != nil {
+		to = rlp.EncodeBytes(tx.To.Bytes())
+	}
+
+	switch tx.Type {
+	case AccessListTxType:
+		return [][]byte{
+			rlp.EncodeBig(tx.ChainID),
+			rlp.EncodeUint64(tx.Nonce),
+			rlp.EncodeBig(tx.GasPrice),
+			rlp.EncodeUint64(tx.GasLimit),
+			to,
+			rlp.EncodeBig(tx.Value),
+			rlp.EncodeBytes(tx.Data),
+			encodeAccessList(tx.AccessList),
+		}
+	case DynamicFeeTxType:
+		return [][]byte{
+			rlp.EncodeBig(tx.ChainID),
+			rlp.EncodeUint64(tx.Nonce),
+			rlp.EncodeBig(tx.GasTipCap),
+			rlp.EncodeBig(tx.GasPrice),
+			rlp.EncodeUint64(tx.GasLimit),
+			to,
+			rlp.EncodeBig(tx.Value),
+			rlp.EncodeBytes(tx.Data),
+			encodeAccessList(tx.AccessList),
+		}
+	}
+	return [][]byte{
+		rlp.EncodeUint64(tx.Nonce),
+		rlp.EncodeBig(tx.GasPrice),
+		rlp.EncodeUint64(tx.GasLimit),
+		to,
+		rlp.EncodeBig(tx.Value),
+		rlp.EncodeBytes(tx.Data),
+	}
+}
+
+// encodeAccessList encodes an access list as a list of [address, [keys]]
+func encodeAccessList(al AccessList) []byte {
+	tuples := make([][]byte, 0, len(al))
+	for _, tuple := range al {
+		keys := make([][]byte, 0, len(tuple.StorageKeys))
+		for _, key := range tuple.StorageKeys {
+			keys = append(keys, rlp.EncodeBytes(key.Bytes()))
+		}
+		tuples = append(tuples, rlp.EncodeList(rlp.EncodeBytes(tuple.Address.Bytes()), rlp.EncodeList(keys...)))
+	}
+	return rlp.EncodeList(tuples...)
+}
+
+// DecodeTransaction decodes a transaction from its consensus encoding as
+// produced by Encode. The hash is set, the sender is not recovered.
+func DecodeTransaction(data []byte) (*Transaction, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidTxEncoding
+	}
+
+	tx := &Transaction{}
+	payload := data
+	if data[0] < 0x80 {
+		// Typed transaction envelope
+		tx.Type = data[0]
+		if tx.Type != AccessListTxType && tx.Type != DynamicFeeTxType {
+			return nil, ErrTxTypeNotSupported
+		}
+		payload = data[1:]
+	}
+
+	content, rest, err := rlp.SplitList(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTxEncoding, err)
+	}
+	if len(rest) != 0 {
+		return nil, ErrTrailingTxRLPFields
+	}
+
+	d := &txDecoder{data: content}
+	if tx.Type != LegacyTxType {
+		tx.ChainID = d.big()
+	}
+	tx.Nonce = d.uint64()
+	if tx.Type == DynamicFeeTxType {
+		tx.GasTipCap = d.big()
+	}
+	tx.GasPrice = d.big()
+	tx.GasLimit = d.uint64()
+	if to := d.bytes(); len(to) > 0 {
+		if len(to) != len(crypto.Address{}) {
+			return nil, fmt.Errorf("%w: invalid recipient", ErrInvalidTxEncoding)
+		}
+		addr := crypto.BytesToAddress(to)
+		tx.To = &addr
+	}
+	tx.Value = d.big()
+	tx.Data = d.bytes()
+	if tx.Type != LegacyTxType {
+		tx.AccessList = d.accessList()
+	}
+	tx.V = d.big()
+	tx.R = d.big()
+	tx.S = d.big()
+
+	if d.err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTxEncoding, d.err)
+	}
+	if len(d.data) != 0 {
+		return nil, ErrTrailingTxRLPFields
+	}
+
+	tx.Hash = crypto.Keccak256Hash(data)
+	return tx, nil
+}
+
+// txDecoder reads the fields of a transaction one by one, the first error
+// is kept and stops further decoding
+type txDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *txDecoder) bytes() []byte {
+	if d.err != nil {
+		return nil
+	}
+	var content []byte
+	content, d.data, d.err = rlp.SplitString(d.data)
+	return content
+}
+
+func (d *txDecoder) uint64() uint64 {
+	content := d.bytes()
+	if d.err != nil {
+		return 0
+	}
+	var i uint64
+	i, d.err = rlp.DecodeUint64(content)
+	return i
+}
+
+func (d *txDecoder) big() *big.Int {
+	content := d.bytes()
+	if d.err != nil {
+		return new(big.Int)
+	}
+	var i *big.Int
+	if i, d.err = rlp.DecodeBig(content); d.err != nil {
+		return new(big.Int)
+	}
+	return i
+}
+
+func (d *txDecoder) accessList() AccessList {
+	if d.err != nil {
+		return nil
+	}
+	var tuples []byte
+	if tuples, d.data, d.err = rlp.SplitList(d.data); d.err != nil {
+		return nil
+	}
+
+	al := AccessList{}
+	for len(tuples) > 0 {
+		var tuple, keys []byte
+		if tuple, tuples, d.err = rlp.SplitList(tuples); d.err != nil {
+			return nil
+		}
+		tupleDecoder := &txDecoder{data: tuple}
+		address := tupleDecoder.bytes()
+		if tupleDecoder.err == nil {
+			keys, tupleDecoder.data, tupleDecoder.err = rlp.SplitList(tupleDecoder.data)
+		}
+		if tupleDecoder.err != nil || len(address) != len(crypto.Address{}) || len(tupleDecoder.data) != 0 {
+			d.err = errors.New("invalid access list entry")
+			return nil
+		}
+
+		entry := AccessTuple{Address: crypto.BytesToAddress(address), StorageKeys: []crypto.Hash{}}
+		for len(keys) > 0 {
+			var key []byte
+			if key, keys, d.err = rlp.SplitString(keys); d.err != nil {
+				return nil
+			}
+			if len(key) != len(crypto.Hash{}) {
+				d.err = errors.New("invalid access list storage key")
+				return nil
+			}
+			entry.StorageKeys = append(entry.StorageKeys, crypto.BytesToHash(key))
+		}
+		al = append(al, entry)
+	}
+	return al
+}
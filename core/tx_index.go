@@ -0,0 +1,109 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"blockchain-node/crypto"
+	"blockchain-node/logger"
+	"blockchain-node/storage"
+)
+
+// txIndexTailKey is the key of the number of the oldest block whose
+// transactions may still be indexed, in the meta table
+var txIndexTailKey = []byte("tx-index-tail")
+
+// unindexBatchLimit caps the blocks unindexed per head change, so that
+// limiting the index of a long chain does not stall block imports
+const unindexBatchLimit = 1000
+
+// SetTxIndexDepth limits the transaction index to the transactions of the
+// most recent depth canonical blocks, older transactions can no longer be
+// looked up by hash. Zero indexes every transaction. Transactions removed
+// from the index are not indexed again when the depth grows.
+func (bc *Blockchain) SetTxIndexDepth(depth uint64) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.txIndexDepth = depth
+	bc.unindexTxs()
+}
+
+// unindexTxs removes the lookups of the transactions that fell out of the
+// index depth. Failures are logged, the lookups are removed after the next
+// head change. The caller must hold bc.mu.
+func (bc *Blockchain) unindexTxs() {
+	if bc.txIndexDepth == 0 {
+		return
+	}
+	if err := bc.unindexBlocks(); err != nil {
+		logger.Error("Failed to unindex transactions", "error", err)
+	}
+}
+
+// unindexBlocks removes the lookups of the transactions of the canonical
+// blocks from the index tail up to the depth below the head
+func (bc *Blockchain) unindexBlocks() error {
+	head := bc.currentBlock.Header.Number.Uint64()
+	if head < bc.txIndexDepth {
+		return nil
+	}
+	limit := head - bc.txIndexDepth + 1
+
+	tail, err := bc.txIndexTail()
+	if err != nil {
+		return err
+	}
+	if limit > tail+unindexBatchLimit {
+		limit = tail + unindexBatchLimit
+	}
+	if limit <= tail {
+		return nil
+	}
+
+	batch := bc.db.NewBatch()
+	lookups := bc.tables.TxLookup.Batch(batch)
+	for number := tail; number < limit; number++ {
+		block, err := bc.getBlockByNumber(new(big.Int).SetUint64(number))
+		if err != nil {
+			return fmt.Errorf("failed to read block %d: %v", number, err)
+		}
+		for _, tx := range block.Transactions {
+			// A transaction included again after a reorg keeps its newer lookup
+			hash, err := bc.tables.TxLookup.Get(tx.Hash.Bytes())
+			if err != nil || !block.Hash.Equal(crypto.BytesToHash(hash)) {
+				continue
+			}
+			if err := lookups.Delete(tx.Hash.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+	var enc [8]byte
+	binary.BigEndian.PutUint64(enc[:], limit)
+	if err := bc.tables.Meta.Batch(batch).Put(txIndexTailKey, enc[:]); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("failed to remove transaction lookups: %v", err)
+	}
+	logger.Debug("Unindexed transactions", "from", tail, "to", limit-1)
+	return nil
+}
+
+// txIndexTail returns the number of the oldest block whose transactions may
+// still be indexed
+func (bc *Blockchain) txIndexTail() (uint64, error) {
+	enc, err := bc.tables.Meta.Get(txIndexTailKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if len(enc) != 8 {
+		return 0, fmt.Errorf("%w: invalid transaction index tail", storage.ErrCorrupted)
+	}
+	return binary.BigEndian.Uint64(enc), nil
+}
@@ -6,18 +6,21 @@ import (
 	"time"
 
 	"blockchain-node/crypto"
+	"blockchain-node/rlp"
 )
 
 // Block represents a block in the blockchain
 type Block struct {
 	Header       *BlockHeader   `json:"header"`
 	Transactions []*Transaction `json:"transactions"`
+	Uncles       []*BlockHeader `json:"uncles,omitempty"`
 	Hash         crypto.Hash    `json:"hash"`
 }
 
 // BlockHeader represents the header of a block
 type BlockHeader struct {
 	PreviousHash     crypto.Hash    `json:"previousHash"`
+	UncleHash        crypto.Hash    `json:"sha3Uncles"` // zero without uncles
 	StateRoot        crypto.Hash    `json:"stateRoot"`
 	TransactionsRoot crypto.Hash    `json:"transactionsRoot"`
 	ReceiptsRoot     crypto.Hash    `json:"receiptsRoot"`
@@ -30,21 +33,27 @@ type BlockHeader struct {
 	Difficulty       *big.Int       `json:"difficulty"`
 	Coinbase         crypto.Address `json:"coinbase"`
 	ExtraData        []byte         `json:"extraData"`
+	BaseFee          *big.Int       `json:"baseFeePerGas"` // EIP-1559 base fee per gas
 }
 
-// Transaction represents a transaction
+// Transaction represents a transaction. For dynamic fee transactions
+// GasPrice holds the max fee per gas and GasTipCap the max priority fee.
 type Transaction struct {
-	Nonce    uint64          `json:"nonce"`
-	GasPrice *big.Int        `json:"gasPrice"`
-	GasLimit uint64          `json:"gasLimit"`
-	To       *crypto.Address `json:"to"` // nil means contract creation
-	Value    *big.Int        `json:"value"`
-	Data     []byte          `json:"data"`
-	V        *big.Int        `json:"v"`
-	R        *big.Int        `json:"r"`
-	S        *big.Int        `json:"s"`
-	Hash     crypto.Hash     `json:"hash"`
-	From     crypto.Address  `json:"from"`
+	Type       uint8           `json:"type"`
+	ChainID    *big.Int        `json:"chainId,omitempty"` // Typed transactions only
+	Nonce      uint64          `json:"nonce"`
+	GasPrice   *big.Int        `json:"gasPrice"`
+	GasTipCap  *big.Int        `json:"maxPriorityFeePerGas,omitempty"`
+	GasLimit   uint64          `json:"gasLimit"`
+	To         *crypto.Address `json:"to"` // nil means contract creation
+	Value      *big.Int        `json:"value"`
+	Data       []byte          `json:"data"`
+	AccessList AccessList      `json:"accessList,omitempty"`
+	V          *big.Int        `json:"v"`
+	R          *big.Int        `json:"r"`
+	S          *big.Int        `json:"s"`
+	Hash       crypto.Hash     `json:"hash"`
+	From       crypto.Address  `json:"from"`
 }
 
 // TransactionReceipt represents the receipt of a transaction
@@ -85,19 +94,34 @@ type Account struct {
 
 // Genesis represents the genesis block configuration
 type Genesis struct {
-	Config      *ChainConfig                    `json:"config"`
-	Nonce       uint64                          `json:"nonce"`
-	Timestamp   uint64                          `json:"timestamp"`
-	ExtraData   []byte                          `json:"extraData"`
-	GasLimit    uint64                          `json:"gasLimit"`
-	Difficulty  *big.Int                        `json:"difficulty"`
-	Coinbase    crypto.Address                  `json:"coinbase"`
-	Alloc       map[crypto.Address]Account      `json:"alloc"`
+	Config      *ChainConfig                      `json:"config"`
+	Nonce       uint64                            `json:"nonce"`
+	Timestamp   uint64                            `json:"timestamp"`
+	ExtraData   []byte                            `json:"extraData"`
+	GasLimit    uint64                            `json:"gasLimit"`
+	Difficulty  *big.Int                          `json:"difficulty"`
+	Coinbase    crypto.Address                    `json:"coinbase"`
+	BaseFee     *big.Int                          `json:"baseFeePerGas"`
+	Alloc       map[crypto.Address]GenesisAccount `json:"alloc"`
 }
 
 // ChainConfig represents the chain configuration
 type ChainConfig struct {
-	ChainID *big.Int `json:"chainId"`
+	ChainID          *big.Int               `json:"chainId"`
+	Checkpoints      map[uint64]crypto.Hash `json:"checkpoints,omitempty"`      // Trusted block number -> hash
+	SafeDepth        uint64                 `json:"safeDepth,omitempty"`        // Confirmations before a block is safe
+	FinalityDepth    uint64                 `json:"finalityDepth,omitempty"`    // Confirmations before a block is final, 0 disables finality
+	CoinbaseMaturity uint64                 `json:"coinbaseMaturity,omitempty"` // Blocks before rewards can be spent, 0 spends them right away
+	GasLimitTarget   uint64                 `json:"gasLimitTarget,omitempty"`   // Gas limit every block moves toward, 0 leaves it to the block producer
+	StateRootBlock   uint64                 `json:"stateRootBlock,omitempty"`   // First block that must commit to its state root, earlier ones may have none
+	Emission         *EmissionConfig        `json:"emission,omitempty"`         // Block reward schedule, nil pays a constant reward
+	PoS              *PoSConfig             `json:"pos,omitempty"`              // Proof-of-stake parameters, nil runs proof-of-work
+}
+
+// PoSConfig holds the parameters of a proof-of-stake chain
+type PoSConfig struct {
+	Period     uint64                      `json:"period"`     // Seconds per slot
+	Validators map[crypto.Address]*big.Int `json:"validators"` // Stake of each validator
 }
 
 // NewBlock creates a new block
@@ -110,22 +134,59 @@ func NewBlock(header *BlockHeader, txs []*Transaction) *Block {
 	return block
 }
 
-// CalculateHash calculates the hash of the block
+// CalculateHash calculates the hash of the block, the hash of its header
 func (b *Block) CalculateHash() crypto.Hash {
-	// Serialize header and calculate hash
-	data := b.Header.Serialize()
-	return crypto.Keccak256Hash(data)
+	return b.Header.Hash()
+}
+
+// SealFields returns the RLP encoded fields of the header except the nonce,
+// with the given difficulty and extra data. Consensus engines seal headers
+// over them.
+func (h *BlockHeader) SealFields(difficulty *big.Int, extra []byte) [][]byte {
+	fields := [][]byte{
+		rlp.EncodeBytes(h.PreviousHash.Bytes()),
+		rlp.EncodeBytes(h.UncleHash.Bytes()),
+		rlp.EncodeBytes(h.StateRoot.Bytes()),
+		rlp.EncodeBytes(h.TransactionsRoot.Bytes()),
+		rlp.EncodeBytes(h.ReceiptsRoot.Bytes()),
+		rlp.EncodeBytes(h.LogsBloom[:]),
+		rlp.EncodeBig(h.Number),
+		rlp.EncodeUint64(h.GasLimit),
+		rlp.EncodeUint64(h.GasUsed),
+		rlp.EncodeUint64(h.Timestamp),
+		rlp.EncodeBig(difficulty),
+		rlp.EncodeBytes(h.Coinbase.Bytes()),
+		rlp.EncodeBytes(extra),
+	}
+	// Headers from before EIP-1559 have no base fee field
+	if h.BaseFee != nil {
+		fields = append(fields, rlp.EncodeBig(h.BaseFee))
+	}
+	return fields
+}
+
+// Encode returns the RLP encoding of all fields of the header, the nonce
+// last
+func (h *BlockHeader) Encode() []byte {
+	fields := h.SealFields(h.Difficulty, h.ExtraData)
+	return rlp.EncodeList(append(fields, rlp.EncodeUint64(h.Nonce))...)
 }
 
-// Serialize serializes the block header
-func (h *BlockHeader) Serialize() []byte {
-	// Simple serialization - in production, use more robust encoding
+// legacyHash returns the block hash of a header as computed before it
+// covered all fields, to recognize databases written by older versions
+func (h *BlockHeader) legacyHash() crypto.Hash {
 	data := append(h.PreviousHash.Bytes(), h.StateRoot.Bytes()...)
 	data = append(data, h.TransactionsRoot.Bytes()...)
 	data = append(data, h.Number.Bytes()...)
 	data = append(data, big.NewInt(int64(h.Timestamp)).Bytes()...)
 	data = append(data, big.NewInt(int64(h.Nonce)).Bytes()...)
-	return data
+	if h.BaseFee != nil {
+		data = append(data, h.BaseFee.Bytes()...)
+	}
+	if h.UncleHash != (crypto.Hash{}) {
+		data = append(data, h.UncleHash.Bytes()...)
+	}
+	return crypto.Keccak256Hash(data)
 }
 
 // NewTransaction creates a new transaction
@@ -142,15 +203,7 @@ func NewTransaction(nonce uint64, to *crypto.Address, amount *big.Int, gasLimit
 
 // CalculateHash calculates the hash of the transaction
 func (tx *Transaction) CalculateHash() crypto.Hash {
-	// Simple serialization for hash calculation
-	data := append(big.NewInt(int64(tx.Nonce)).Bytes(), tx.GasPrice.Bytes()...)
-	data = append(data, big.NewInt(int64(tx.GasLimit)).Bytes()...)
-	if tx.To != nil {
-		data = append(data, tx.To.Bytes()...)
-	}
-	data = append(data, tx.Value.Bytes()...)
-	data = append(data, tx.Data...)
-	return crypto.Keccak256Hash(data)
+	return crypto.Keccak256Hash(tx.Encode())
 }
 
 // IsContractCreation returns whether the transaction is a contract creation
@@ -160,6 +213,11 @@ func (tx *Transaction) IsContractCreation() bool {
 
 // NewGenesisBlock creates a new genesis block
 func NewGenesisBlock(genesis *Genesis) *Block {
+	baseFee := genesis.BaseFee
+	if baseFee == nil {
+		baseFee = big.NewInt(InitialBaseFee)
+	}
+
 	header := &BlockHeader{
 		PreviousHash: crypto.Hash{},
 		Number:       big.NewInt(0),
@@ -170,6 +228,7 @@ func NewGenesisBlock(genesis *Genesis) *Block {
 		Difficulty:   genesis.Difficulty,
 		Coinbase:     genesis.Coinbase,
 		ExtraData:    genesis.ExtraData,
+		BaseFee:      new(big.Int).Set(baseFee),
 	}
 
 	return NewBlock(header, []*Transaction{})
@@ -187,6 +246,7 @@ func DefaultGenesis() *Genesis {
 		GasLimit:   8000000,
 		Difficulty: big.NewInt(4),
 		Coinbase:   crypto.Address{},
-		Alloc:      make(map[crypto.Address]Account),
+		BaseFee:    big.NewInt(InitialBaseFee),
+		Alloc:      make(map[crypto.Address]GenesisAccount),
 	}
 }
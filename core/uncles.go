@@ -0,0 +1,120 @@
+package core
+
+import (
+	"errors"
+	"sort"
+
+	"blockchain-node/crypto"
+)
+
+const (
+	// MaxUncles is the number of uncles a block may include
+	MaxUncles = 2
+
+	// MaxUncleDepth is the number of generations the parent of an uncle may
+	// be above the block including it
+	MaxUncleDepth = 7
+)
+
+// ErrInvalidUncleHash is returned for blocks whose uncles do not match the
+// uncle hash of their header
+var ErrInvalidUncleHash = errors.New("invalid uncle hash")
+
+// Hash returns the hash of a header, which is the hash of its block: the
+// Keccak-256 of its full RLP encoding, so it commits to every field
+func (h *BlockHeader) Hash() crypto.Hash {
+	return crypto.Keccak256Hash(h.Encode())
+}
+
+// CalcUncleHash returns the commitment of a header to its uncles: the
+// Keccak-256 of their hashes, the zero hash without uncles
+func CalcUncleHash(uncles []*BlockHeader) crypto.Hash {
+	if len(uncles) == 0 {
+		return crypto.Hash{}
+	}
+	data := make([][]byte, len(uncles))
+	for i, uncle := range uncles {
+		data[i] = uncle.Hash().Bytes()
+	}
+	return crypto.Keccak256Hash(data...)
+}
+
+// NewBlockWithUncles creates a new block including uncles, setting the
+// uncle hash of header
+func NewBlockWithUncles(header *BlockHeader, txs []*Transaction, uncles []*BlockHeader) *Block {
+	header.UncleHash = CalcUncleHash(uncles)
+	block := NewBlock(header, txs)
+	block.Uncles = uncles
+	return block
+}
+
+// UncleAncestry returns the up to MaxUncleDepth+1 ancestors of a block with
+// the given parent, the parent included, and the uncles they included. An
+// uncle of the block must descend from one of these ancestors other than
+// the parent, and be neither an ancestor nor included before.
+func UncleAncestry(chain ChainReader, parent crypto.Hash) (map[crypto.Hash]*BlockHeader, map[crypto.Hash]bool) {
+	ancestors := make(map[crypto.Hash]*BlockHeader)
+	included := make(map[crypto.Hash]bool)
+
+	hash := parent
+	for i := 0; i <= MaxUncleDepth; i++ {
+		block := chain.GetBlock(hash)
+		if block == nil {
+			break
+		}
+		ancestors[hash] = block.Header
+		for _, uncle := range block.Uncles {
+			included[uncle.Hash()] = true
+		}
+		if block.Header.Number.Sign() == 0 {
+			break
+		}
+		hash = block.Header.PreviousHash
+	}
+	return ancestors, included
+}
+
+// recordUncleCandidate remembers the header of an imported block, which can
+// be included as an uncle once a competing block is canonical. Headers too
+// old to be included are forgotten. The caller must hold bc.mu.
+func (bc *Blockchain) recordUncleCandidate(header *BlockHeader) {
+	if bc.uncleCandidates == nil {
+		bc.uncleCandidates = make(map[crypto.Hash]*BlockHeader)
+	}
+	bc.uncleCandidates[header.Hash()] = header
+
+	head := bc.currentBlock.Header.Number.Uint64()
+	for hash, candidate := range bc.uncleCandidates {
+		if candidate.Number.Uint64()+MaxUncleDepth < head {
+			delete(bc.uncleCandidates, hash)
+		}
+	}
+}
+
+// UncleCandidates returns up to MaxUncles recently imported blocks that a
+// new block on top of parent can include as uncles, the most recent first
+func (bc *Blockchain) UncleCandidates(parent crypto.Hash) []*BlockHeader {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	ancestors, included := UncleAncestry(lockedChain{bc}, parent)
+
+	var uncles []*BlockHeader
+	for hash, candidate := range bc.uncleCandidates {
+		if ancestors[hash] != nil || included[hash] {
+			continue
+		}
+		if ancestors[candidate.PreviousHash] == nil || candidate.PreviousHash == parent {
+			continue
+		}
+		uncles = append(uncles, candidate)
+	}
+
+	sort.Slice(uncles, func(i, j int) bool {
+		return uncles[i].Number.Cmp(uncles[j].Number) > 0
+	})
+	if len(uncles) > MaxUncles {
+		uncles = uncles[:MaxUncles]
+	}
+	return uncles
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"math/big"
+
+	"blockchain-node/crypto"
+	"blockchain-node/rlp"
+)
+
+// BlockContext provides the virtual machine with information about the
+// block a transaction is executed in
+type BlockContext struct {
+	Coinbase   crypto.Address
+	Number     *big.Int
+	Time       uint64
+	Difficulty *big.Int
+	GasLimit   uint64
+	BaseFee    *big.Int
+	ChainID    *big.Int
+	GetHash    func(number uint64) crypto.Hash // hash of an ancestor, zero if unknown
+}
+
+// TxContext provides the virtual machine with information about the
+// transaction being executed
+type TxContext struct {
+	Origin   crypto.Address
+	GasPrice *big.Int
+	Tracer   Tracer // Receives opcode and call frame events, may be nil
+}
+
+// VM executes contract code on top of a StateDB. Value transfers happen
+// inside the VM so that they are reverted together with a failing call.
+type VM interface {
+	// Call executes the code at addr with the given input
+	Call(caller, addr crypto.Address, input []byte, gas uint64, value *big.Int) (ret []byte, leftOverGas uint64, err error)
+
+	// Create deploys a contract using code as init code
+	Create(caller crypto.Address, code []byte, gas uint64, value *big.Int) (ret []byte, contractAddr crypto.Address, leftOverGas uint64, err error)
+}
+
+// VMFactory creates a VM for a single transaction. It is declared here
+// because package evm depends on core, evm.New satisfies it.
+type VMFactory func(state *StateDB, block BlockContext, tx TxContext) VM
+
+// CreateAddress derives the address of a contract deployed by sender with
+// the given nonce, keccak256(rlp([sender, nonce]))[12:]
+func CreateAddress(sender crypto.Address, nonce uint64) crypto.Address {
+	data := rlp.EncodeList(rlp.EncodeBytes(sender.Bytes()), rlp.EncodeUint64(nonce))
+	return crypto.BytesToAddress(crypto.Keccak256(data)[12:])
+}
+
+// CreateAddress2 derives the address of a contract deployed with CREATE2,
+// keccak256(0xff ++ sender ++ salt ++ keccak256(initCode))[12:] (EIP-1014)
+func CreateAddress2(sender crypto.Address, salt crypto.Hash, initHash []byte) crypto.Address {
+	hash := crypto.Keccak256([]byte{0xff}, sender.Bytes(), salt.Bytes(), initHash)
+	return crypto.BytesToAddress(hash[12:])
+}
@@ -0,0 +1,172 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidChildKey is returned for the about 1 in 2^127 indexes that do
+// not derive a valid key, the next index should be used instead
+var ErrInvalidChildKey = errors.New("invalid child key")
+
+// HardenedKeyStart is the first index of hardened child keys (BIP-32)
+const HardenedKeyStart = 0x80000000
+
+// DerivationPath is a BIP-32 path of child indexes from the master key
+type DerivationPath []uint32
+
+// DefaultBaseDerivationPath is the BIP-44 path of Ethereum accounts without
+// the account index, the one of most wallets
+var DefaultBaseDerivationPath = DerivationPath{HardenedKeyStart + 44, HardenedKeyStart + 60, HardenedKeyStart + 0, 0}
+
+// DefaultDerivationPath is the path of the first account, m/44'/60'/0'/0/0
+var DefaultDerivationPath = DerivationPath{HardenedKeyStart + 44, HardenedKeyStart + 60, HardenedKeyStart + 0, 0, 0}
+
+// ParseDerivationPath parses a path like m/44'/60'/0'/0/0. Hardened
+// indexes end in ' or h.
+func ParseDerivationPath(path string) (DerivationPath, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if len(parts) < 2 || parts[0] != "m" {
+		return nil, fmt.Errorf("invalid derivation path %q, want m/...", path)
+	}
+
+	result := make(DerivationPath, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || index >= HardenedKeyStart {
+			return nil, fmt.Errorf("invalid derivation path component %q", part)
+		}
+		if hardened {
+			index += HardenedKeyStart
+		}
+		result = append(result, uint32(index))
+	}
+	return result, nil
+}
+
+// String returns the path in the form ParseDerivationPath reads
+func (p DerivationPath) String() string {
+	var b strings.Builder
+	b.WriteString("m")
+	for _, index := range p {
+		if index >= HardenedKeyStart {
+			fmt.Fprintf(&b, "/%d'", index-HardenedKeyStart)
+		} else {
+			fmt.Fprintf(&b, "/%d", index)
+		}
+	}
+	return b.String()
+}
+
+// ExtendedKey is a private key of a BIP-32 key tree with the chain code
+// its children are derived with
+type ExtendedKey struct {
+	key       []byte // 32 byte private key
+	chainCode []byte
+}
+
+// NewMasterKey returns the root key of the tree of seed, usually a BIP-39
+// seed
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("invalid seed length %d", len(seed))
+	}
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	key := new(big.Int).SetBytes(sum[:32])
+	if key.Sign() == 0 || key.Cmp(secp256k1N) >= 0 {
+		return nil, ErrInvalidChildKey
+	}
+	return &ExtendedKey{key: sum[:32], chainCode: sum[32:]}, nil
+}
+
+// Child derives the child key at index, hardened from HardenedKeyStart on
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	data := make([]byte, 0, 37)
+	if index >= HardenedKeyStart {
+		data = append(append(data, 0), k.key...)
+	} else {
+		privateKey, err := ToECDSA(k.key)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, compressPubkey(privateKey.X, privateKey.Y)...)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(secp256k1N) >= 0 {
+		return nil, ErrInvalidChildKey
+	}
+	child := tweak.Add(tweak, new(big.Int).SetBytes(k.key))
+	child.Mod(child, secp256k1N)
+	if child.Sign() == 0 {
+		return nil, ErrInvalidChildKey
+	}
+	return &ExtendedKey{key: child.FillBytes(make([]byte, 32)), chainCode: sum[32:]}, nil
+}
+
+// Derive derives the key at path below k
+func (k *ExtendedKey) Derive(path DerivationPath) (*ExtendedKey, error) {
+	key := k
+	for _, index := range path {
+		var err error
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Wallet returns the wallet of the private key
+func (k *ExtendedKey) Wallet() (*Wallet, error) {
+	privateKey, err := ToECDSA(k.key)
+	if err != nil {
+		return nil, err
+	}
+	return WalletFromPrivateKey(privateKey), nil
+}
+
+// WalletFromMnemonic returns the wallet of the key at path in the tree of
+// the seed of mnemonic and passphrase
+func WalletFromMnemonic(mnemonic, passphrase string, path DerivationPath) (*Wallet, error) {
+	seed, err := MnemonicToSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	key, err := master.Derive(path)
+	if err != nil {
+		return nil, err
+	}
+	return key.Wallet()
+}
+
+// compressPubkey encodes a public key as its x coordinate prefixed with
+// the parity of y
+func compressPubkey(x, y *big.Int) []byte {
+	prefix := byte(0x02)
+	if y.Bit(0) == 1 {
+		prefix = 0x03
+	}
+	return append([]byte{prefix}, x.FillBytes(make([]byte, 32))...)
+}
@@ -0,0 +1,234 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrDecrypt is returned when a key file does not open with a passphrase
+var ErrDecrypt = errors.New("could not decrypt key with given passphrase")
+
+// scrypt parameters of new key files, the ones of geth. The light ones use
+// 4MB of memory instead of 256MB.
+const (
+	StandardScryptN = 1 << 18
+	StandardScryptP = 1
+	LightScryptN    = 1 << 12
+	LightScryptP    = 6
+
+	scryptR     = 8
+	scryptDKLen = 32
+)
+
+// keyFileVersion is the Web3 Secret Storage version written and read
+const keyFileVersion = 3
+
+// keyFile is a key encrypted in the Web3 Secret Storage format, which geth,
+// clef and most wallets import
+type keyFile struct {
+	Address string     `json:"address"`
+	Crypto  cryptoJSON `json:"crypto"`
+	ID      string     `json:"id"`
+	Version int        `json:"version"`
+}
+
+type cryptoJSON struct {
+	Cipher       string           `json:"cipher"`
+	CipherText   string           `json:"ciphertext"`
+	CipherParams cipherParamsJSON `json:"cipherparams"`
+	KDF          string           `json:"kdf"`
+	KDFParams    scryptParamsJSON `json:"kdfparams"`
+	MAC          string           `json:"mac"`
+}
+
+type cipherParamsJSON struct {
+	IV string `json:"iv"`
+}
+
+type scryptParamsJSON struct {
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	DKLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+}
+
+// EncryptKey encrypts the private key of wallet with passphrase into a key
+// file, deriving the key with scrypt at cost scryptN and scryptP and
+// encrypting with AES-128-CTR
+func EncryptKey(wallet *Wallet, passphrase string, scryptN, scryptP int) ([]byte, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	derived, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptDKLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	ciphertext, err := aesCTR(derived[:16], iv, FromECDSA(wallet.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	mac := Keccak256(derived[16:32], ciphertext)
+
+	id, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(keyFile{
+		Address: hex.EncodeToString(wallet.Address.Bytes()),
+		Crypto: cryptoJSON{
+			Cipher:       "aes-128-ctr",
+			CipherText:   hex.EncodeToString(ciphertext),
+			CipherParams: cipherParamsJSON{IV: hex.EncodeToString(iv)},
+			KDF:          "scrypt",
+			KDFParams: scryptParamsJSON{
+				N:     scryptN,
+				R:     scryptR,
+				P:     scryptP,
+				DKLen: scryptDKLen,
+				Salt:  hex.EncodeToString(salt),
+			},
+			MAC: hex.EncodeToString(mac),
+		},
+		ID:      id,
+		Version: keyFileVersion,
+	})
+}
+
+// DecryptKey opens a key file with passphrase, ErrDecrypt if it is wrong
+func DecryptKey(data []byte, passphrase string) (*Wallet, error) {
+	var key keyFile
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("invalid key file: %v", err)
+	}
+	if key.Version != keyFileVersion {
+		return nil, fmt.Errorf("unsupported key file version %d", key.Version)
+	}
+	if key.Crypto.Cipher != "aes-128-ctr" {
+		return nil, fmt.Errorf("unsupported cipher %q", key.Crypto.Cipher)
+	}
+	if key.Crypto.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation %q", key.Crypto.KDF)
+	}
+
+	params := key.Crypto.KDFParams
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %v", err)
+	}
+	ciphertext, err := hex.DecodeString(key.Crypto.CipherText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext: %v", err)
+	}
+	iv, err := hex.DecodeString(key.Crypto.CipherParams.IV)
+	if err != nil {
+		return nil, fmt.Errorf("invalid iv: %v", err)
+	}
+	mac, err := hex.DecodeString(key.Crypto.MAC)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mac: %v", err)
+	}
+	if params.DKLen < 32 {
+		return nil, fmt.Errorf("invalid derived key length %d", params.DKLen)
+	}
+
+	derived, err := scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, params.DKLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+	if !bytes.Equal(Keccak256(derived[16:32], ciphertext), mac) {
+		return nil, ErrDecrypt
+	}
+	plain, err := aesCTR(derived[:16], iv, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := ToECDSA(plain)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+
+	wallet := WalletFromPrivateKey(privateKey)
+	if key.Address != "" && !strings.EqualFold(key.Address, hex.EncodeToString(wallet.Address.Bytes())) {
+		return nil, fmt.Errorf("key file address %s does not match key", key.Address)
+	}
+	return wallet, nil
+}
+
+// KeyFileName returns the name of the key file of address created at t,
+// the one geth gives it
+func KeyFileName(address Address, t time.Time) string {
+	ts := t.UTC()
+	return fmt.Sprintf("UTC--%s.%09dZ--%s", ts.Format("2006-01-02T15-04-05"), ts.Nanosecond(), hex.EncodeToString(address.Bytes()))
+}
+
+// StoreKey encrypts the key of wallet into a new key file in dir, creating
+// the directory if needed, and returns the path of the file
+func StoreKey(dir string, wallet *Wallet, passphrase string, scryptN, scryptP int) (string, error) {
+	data, err := EncryptKey(wallet, passphrase, scryptN, scryptP)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create keystore directory: %v", err)
+	}
+	path := filepath.Join(dir, KeyFileName(wallet.Address, time.Now()))
+
+	// Write under a temporary name, a key file is never seen half written
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// aesCTR encrypts or decrypts data with AES-128-CTR
+func aesCTR(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	cipher.NewCTR(block, iv).XORKeyStream(out, data)
+	return out, nil
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() (string, error) {
+	u := make([]byte, 16)
+	if _, err := rand.Read(u); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
@@ -21,6 +21,10 @@ func Sign(hash []byte, prv *ecdsa.PrivateKey) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Only low s values are valid in transactions (EIP-2)
+	if s.Cmp(secp256k1halfN) > 0 {
+		s.Sub(secp256k1N, s)
+	}
 	
 	// Recovery ID calculation for Ethereum-style signatures
 	recoveryId := 0
@@ -218,10 +222,7 @@ func recoverPublicKey(hash []byte, r, s *big.Int, recoveryId int) (*ecdsa.Public
 	sR_x, sR_y := curve.ScalarMult(x, y, s.Bytes())
 	eG_x, eG_y := curve.ScalarBaseMult(e.Bytes())
 	
-	// Subtract eG from sR
-	eG_y.Neg(eG_y)
-	eG_y.Mod(eG_y, curve.Params().P)
-	
+	// e is already negated, adding eG subtracts hash*G from sR
 	Q_x, Q_y := curve.Add(sR_x, sR_y, eG_x, eG_y)
 	
 	// Multiply by r^-1
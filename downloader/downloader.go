@@ -0,0 +1,334 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"blockchain-node/core"
+	"blockchain-node/event"
+	"blockchain-node/logger"
+	"blockchain-node/p2p"
+)
+
+const (
+	// requestTimeout is how long a peer has to answer a request
+	requestTimeout = 5 * time.Second
+
+	// syncInterval is how often the node checks whether a peer is ahead
+	syncInterval = 10 * time.Second
+
+	// minSyncGap is how many blocks a peer has to be ahead of a node that
+	// already caught up for it to report that it syncs again. Smaller gaps
+	// are closed without pausing the miner for every new block.
+	minSyncGap = 8
+
+	// reorgDepth is how far below the local head the blocks of a peer on
+	// another fork are requested first, the distance doubles until the
+	// common ancestor is found
+	reorgDepth = 32
+)
+
+// announcePrefix starts the payload of a new block announcement
+var announcePrefix = []byte("NEW_BLOCK:")
+
+// Progress is the state of a sync in block numbers: the local head when the
+// sync started, the local head now and the head of the peer synced with
+type Progress struct {
+	StartingBlock uint64
+	CurrentBlock  uint64
+	HighestBlock  uint64
+}
+
+// Downloader keeps the chain in sync with the peers and serves the blocks
+// of the local chain to them
+type Downloader struct {
+	chain   *core.Blockchain
+	p2p     *p2p.Server
+	events  *event.Bus
+	logger  *logger.Logger
+	trigger chan struct{} // starts a sync round when a block is announced
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan []byte // response payloads by request ID
+
+	statusMu sync.RWMutex
+	syncing  bool
+	progress Progress
+}
+
+// New registers the block sync protocol handlers with the p2p server. The
+// downloader reports the node as syncing until Run caught up with the peers.
+func New(chain *core.Blockchain, p2pServer *p2p.Server, events *event.Bus) *Downloader {
+	d := &Downloader{
+		chain:   chain,
+		p2p:     p2pServer,
+		events:  events,
+		logger:  logger.NewLogger("downloader"),
+		trigger: make(chan struct{}, 1),
+		pending: make(map[uint64]chan []byte),
+		syncing: true,
+	}
+	p2pServer.RegisterMessageHandler(p2p.MessageTypeGetStatus, d.handleGetStatus)
+	p2pServer.RegisterMessageHandler(p2p.MessageTypeGetBlocks, d.handleGetBlocks)
+	p2pServer.RegisterMessageHandler(p2p.MessageTypeStatus, d.handleResponse)
+	p2pServer.RegisterMessageHandler(p2p.MessageTypeBlocks, d.handleResponse)
+	p2pServer.RegisterMessageHandler(p2p.MessageTypeBlock, d.handleAnnouncement)
+	return d
+}
+
+// Syncing reports whether the node is catching up with its peers
+func (d *Downloader) Syncing() bool {
+	d.statusMu.RLock()
+	defer d.statusMu.RUnlock()
+	return d.syncing
+}
+
+// Progress returns the progress of the current sync, or of the last one if
+// the node is not syncing
+func (d *Downloader) Progress() Progress {
+	d.statusMu.RLock()
+	progress := d.progress
+	d.statusMu.RUnlock()
+
+	progress.CurrentBlock = d.chain.GetBlockNumber().Uint64()
+	if progress.HighestBlock < progress.CurrentBlock {
+		progress.HighestBlock = progress.CurrentBlock
+	}
+	return progress
+}
+
+// Run syncs with the peers until ctx is done. A starting node that finds no
+// peer keeps reporting that it syncs for up to peerWait, so that it does not
+// mine on its own chain while it connects to the network.
+func (d *Downloader) Run(ctx context.Context, peerWait time.Duration) {
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	d.events.Sync.Send(event.SyncEvent{Syncing: true})
+	deadline := time.Now().Add(peerWait)
+	for {
+		err := d.Sync(ctx)
+		switch {
+		case errors.Is(err, ErrNoPeers):
+			if d.Syncing() && !time.Now().Before(deadline) {
+				d.logger.Info("No peers to sync with, continuing with the local chain")
+				d.finish(d.chain.GetBlockNumber().Uint64())
+			}
+		case err != nil && ctx.Err() == nil:
+			d.logger.Warning("Sync failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.trigger:
+		}
+	}
+}
+
+// Sync catches up with the peer with the heaviest chain, if it is ahead of
+// the local chain
+func (d *Downloader) Sync(ctx context.Context) error {
+	peerID, status, err := d.bestPeer()
+	if err != nil {
+		return err
+	}
+	head := d.chain.GetCurrentBlock()
+	number := head.Header.Number.Uint64()
+	if td := d.chain.GetTotalDifficulty(head.Hash); td != nil && status.TD.Cmp(td) <= 0 {
+		if d.Syncing() {
+			d.finish(status.Number)
+		}
+		return nil
+	}
+
+	if d.Syncing() || status.Number > number+minSyncGap {
+		d.start(number, status.Number, peerID)
+	}
+	if err := d.syncPeer(ctx, peerID); err != nil {
+		return fmt.Errorf("peer %s: %w", peerID, err)
+	}
+	if d.Syncing() {
+		d.finish(status.Number)
+	}
+	return nil
+}
+
+// bestPeer asks the connected peers for their head and returns the one with
+// the highest total difficulty
+func (d *Downloader) bestPeer() (string, *statusResponse, error) {
+	var (
+		bestID string
+		best   *statusResponse
+	)
+	for _, peer := range d.p2p.GetPeers() {
+		var status statusResponse
+		if err := d.request(peer.ID, p2p.MessageTypeGetStatus, &getStatusRequest{}, &status); err != nil {
+			d.logger.Debug("Failed to request status", "peerID", peer.ID, "error", err)
+			continue
+		}
+		if status.TD == nil {
+			continue
+		}
+		if best == nil || status.TD.Cmp(best.TD) > 0 {
+			bestID, best = peer.ID, &status
+		}
+	}
+	if best == nil {
+		return "", nil, ErrNoPeers
+	}
+	return bestID, best, nil
+}
+
+// syncPeer downloads the blocks of a peer beyond the local head, starting
+// at the common ancestor of the chains
+func (d *Downloader) syncPeer(ctx context.Context, peerID string) error {
+	head := d.chain.GetBlockNumber().Uint64()
+	from, back := head+1, uint64(0)
+	for ctx.Err() == nil {
+		var resp blocksResponse
+		if err := d.request(peerID, p2p.MessageTypeGetBlocks, &getBlocksRequest{From: from, Amount: MaxBlocks}, &resp); err != nil {
+			return err
+		}
+		if len(resp.Blocks) == 0 {
+			return nil
+		}
+		for i, block := range resp.Blocks {
+			if block == nil || block.Header == nil || block.Header.Number == nil ||
+				block.Header.Number.Cmp(new(big.Int).SetUint64(from+uint64(i))) != 0 {
+				return fmt.Errorf("invalid blocks response from block %d", from)
+			}
+		}
+
+		stats, err := d.chain.InsertChain(resp.Blocks)
+		if errors.Is(err, core.ErrUnknownAncestor) && stats.Imported+stats.Skipped == 0 && from > 1 {
+			// The peer is on another fork, look for the common ancestor
+			// further back
+			if back == 0 {
+				back = reorgDepth
+			} else {
+				back *= 2
+			}
+			from = 1
+			if head > back {
+				from = head - back
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if stats.Imported > 0 {
+			d.logger.Info("Imported blocks", "count", stats.Imported, "number", stats.Last)
+		}
+		if len(resp.Blocks) < MaxBlocks {
+			return nil
+		}
+		from += uint64(len(resp.Blocks))
+	}
+	return ctx.Err()
+}
+
+// start marks the node as syncing from block current to the head highest
+// of a peer
+func (d *Downloader) start(current, highest uint64, peerID string) {
+	d.statusMu.Lock()
+	wasSyncing := d.syncing
+	d.syncing = true
+	d.progress = Progress{StartingBlock: current, HighestBlock: highest}
+	d.statusMu.Unlock()
+
+	d.logger.Info("Sync started", "peerID", peerID, "from", current, "to", highest)
+	if !wasSyncing {
+		d.events.Sync.Send(event.SyncEvent{Syncing: true, Highest: highest})
+	}
+}
+
+// finish marks the node as caught up with its peers
+func (d *Downloader) finish(highest uint64) {
+	d.statusMu.Lock()
+	d.syncing = false
+	d.progress.HighestBlock = highest
+	d.statusMu.Unlock()
+
+	d.logger.Info("Sync completed", "number", d.chain.GetBlockNumber())
+	d.events.Sync.Send(event.SyncEvent{Syncing: false, Highest: highest})
+}
+
+// handleAnnouncement starts a sync round when a peer announces a new block
+func (d *Downloader) handleAnnouncement(peer *p2p.Peer, message *p2p.Message) error {
+	if !bytes.HasPrefix(message.Payload, announcePrefix) {
+		return nil
+	}
+	select {
+	case d.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// request sends req to a peer and decodes its response into resp. The ID of
+// req is set to a new request ID.
+func (d *Downloader) request(peerID string, messageType p2p.MessageType, req interface{}, resp interface{}) error {
+	d.mu.Lock()
+	d.nextID++
+	id := d.nextID
+	ch := make(chan []byte, 1)
+	d.pending[id] = ch
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, id)
+		d.mu.Unlock()
+	}()
+
+	switch req := req.(type) {
+	case *getStatusRequest:
+		req.ID = id
+	case *getBlocksRequest:
+		req.ID = id
+	}
+	if err := d.send(peerID, messageType, req); err != nil {
+		return err
+	}
+
+	select {
+	case data := <-ch:
+		if err := json.Unmarshal(data, resp); err != nil {
+			return fmt.Errorf("invalid response: %v", err)
+		}
+		return nil
+	case <-time.After(requestTimeout):
+		return fmt.Errorf("request %d timed out", id)
+	}
+}
+
+// handleResponse hands a response to the request waiting for it
+func (d *Downloader) handleResponse(peer *p2p.Peer, message *p2p.Message) error {
+	var resp struct {
+		ID uint64 `json:"id"`
+	}
+	if err := json.Unmarshal(message.Payload, &resp); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	d.mu.Lock()
+	ch := d.pending[resp.ID]
+	d.mu.Unlock()
+	if ch == nil {
+		d.logger.Debug("Dropping unrequested response", "peerID", peer.ID, "type", message.Type, "id", resp.ID)
+		return nil
+	}
+	select {
+	case ch <- message.Payload:
+	default:
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+// Package downloader implements the block sync protocol: nodes tell their
+// peers about their head and serve canonical blocks, and a node behind its
+// peers downloads the blocks it misses from the best of them.
+package downloader
+
+import (
+	"errors"
+	"math/big"
+
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+)
+
+// MaxBlocks is the number of blocks served per request
+const MaxBlocks = 64
+
+// ErrNoPeers is returned when no peer answered a status request
+var ErrNoPeers = errors.New("no peer to sync with")
+
+// getStatusRequest asks for the head of a peer
+type getStatusRequest struct {
+	ID uint64 `json:"id"`
+}
+
+// statusResponse answers a getStatusRequest with the head block of the
+// canonical chain and its total difficulty
+type statusResponse struct {
+	ID     uint64      `json:"id"`
+	Number uint64      `json:"number"`
+	Hash   crypto.Hash `json:"hash"`
+	TD     *big.Int    `json:"td"`
+}
+
+// getBlocksRequest asks for up to Amount canonical blocks from block From
+type getBlocksRequest struct {
+	ID     uint64 `json:"id"`
+	From   uint64 `json:"from"`
+	Amount uint64 `json:"amount"`
+}
+
+// blocksResponse answers a getBlocksRequest, the blocks are consecutive
+type blocksResponse struct {
+	ID     uint64        `json:"id"`
+	Blocks []*core.Block `json:"blocks"`
+}
@@ -0,0 +1,64 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"blockchain-node/p2p"
+)
+
+// handleGetStatus sends the head of the local chain
+func (d *Downloader) handleGetStatus(peer *p2p.Peer, message *p2p.Message) error {
+	var req getStatusRequest
+	if err := json.Unmarshal(message.Payload, &req); err != nil {
+		return fmt.Errorf("invalid status request: %v", err)
+	}
+	head := d.chain.GetCurrentBlock()
+	resp := statusResponse{
+		ID:     req.ID,
+		Number: head.Header.Number.Uint64(),
+		Hash:   head.Hash,
+		TD:     d.chain.GetTotalDifficulty(head.Hash),
+	}
+	if resp.TD == nil {
+		resp.TD = new(big.Int)
+	}
+	return d.send(peer.ID, p2p.MessageTypeStatus, resp)
+}
+
+// handleGetBlocks sends the requested canonical blocks, as many as the
+// chain has up to MaxBlocks
+func (d *Downloader) handleGetBlocks(peer *p2p.Peer, message *p2p.Message) error {
+	var req getBlocksRequest
+	if err := json.Unmarshal(message.Payload, &req); err != nil {
+		return fmt.Errorf("invalid blocks request: %v", err)
+	}
+	amount := req.Amount
+	if amount > MaxBlocks {
+		amount = MaxBlocks
+	}
+
+	resp := blocksResponse{ID: req.ID}
+	if amount == 0 {
+		return d.send(peer.ID, p2p.MessageTypeBlocks, resp)
+	}
+	it := d.chain.BlocksInRange(req.From, req.From+amount-1)
+	for it.Next() {
+		resp.Blocks = append(resp.Blocks, it.Block())
+	}
+	if err := it.Err(); err != nil {
+		d.logger.Debug("Failed to read requested blocks", "peerID", peer.ID, "from", req.From, "error", err)
+	}
+	d.logger.Debug("Serving blocks", "peerID", peer.ID, "from", req.From, "count", len(resp.Blocks))
+	return d.send(peer.ID, p2p.MessageTypeBlocks, resp)
+}
+
+// send encodes and sends a message to a peer
+func (d *Downloader) send(peerID string, messageType p2p.MessageType, msg interface{}) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return d.p2p.SendToPeer(peerID, messageType, payload)
+}
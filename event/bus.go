@@ -0,0 +1,35 @@
+package event
+
+import (
+	"blockchain-node/core"
+	"blockchain-node/mempool"
+)
+
+// MinedBlockEvent reports a block produced by this node, sealed by the
+// local miner or an external one or proposed as a validator, once it was
+// added to the chain
+type MinedBlockEvent struct {
+	Block *core.Block
+}
+
+// SyncEvent reports that the node started or finished catching up with
+// its peers
+type SyncEvent struct {
+	Syncing bool
+	Highest uint64 // head block number of the peer synced with
+}
+
+// Bus holds the feeds the subsystems of the node communicate through. The
+// chain, the mempool and the block producers publish to it; the relay to
+// peers, the metrics and added subsystems such as indexers subscribe.
+type Bus struct {
+	ChainHead Feed[core.ChainHeadEvent] // head changes of the chain
+	Tx        Feed[mempool.TxEvent]     // changes of the pooled transactions
+	Mined     Feed[MinedBlockEvent]     // blocks produced by this node
+	Sync      Feed[SyncEvent]           // start and end of catching up
+}
+
+// NewBus returns a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{}
+}
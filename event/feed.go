@@ -0,0 +1,61 @@
+// Package event delivers events between the subsystems of the node, so that
+// the subsystem producing an event does not need to know who consumes it
+package event
+
+import "sync"
+
+// Feed delivers events of one type to its subscribers. The zero value is
+// ready to use.
+type Feed[T any] struct {
+	mu     sync.Mutex
+	subs   []subscription[T] // in subscription order
+	nextID int
+
+	// sendMu keeps events in order when they are sent concurrently
+	sendMu sync.Mutex
+}
+
+// subscription is a subscriber of a Feed
+type subscription[T any] struct {
+	id int
+	fn func(T)
+}
+
+// Subscribe registers fn to be called with every event sent after it
+// subscribed, in order, after the subscribers registered before it. fn runs
+// on the goroutine sending the event, so it should hand slow work to a
+// goroutine of its own, and must not send on the same feed. The returned
+// function cancels the subscription.
+func (f *Feed[T]) Subscribe(fn func(T)) (unsubscribe func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := f.nextID
+	f.nextID++
+	f.subs = append(f.subs, subscription[T]{id, fn})
+
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for i, sub := range f.subs {
+			if sub.id == id {
+				f.subs = append(f.subs[:i:i], f.subs[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Send delivers ev to the subscribers and returns once all of them ran
+func (f *Feed[T]) Send(ev T) {
+	f.sendMu.Lock()
+	defer f.sendMu.Unlock()
+
+	f.mu.Lock()
+	subs := f.subs
+	f.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.fn(ev)
+	}
+}
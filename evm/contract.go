@@ -0,0 +1,97 @@
+package evm
+
+import (
+	"math/big"
+
+	"blockchain-node/crypto"
+)
+
+// Contract is the code executed in a call frame together with its context
+type Contract struct {
+	CallerAddress crypto.Address
+	Address       crypto.Address // Account whose storage and balance the code operates on
+	Code          []byte
+	CodeHash      crypto.Hash
+	Input         []byte
+	Gas           uint64
+	Value         *big.Int
+
+	analysis bitvec // Positions of code (as opposed to push data) in Code
+}
+
+// newContract creates a call frame for caller invoking address
+func newContract(caller, address crypto.Address, value *big.Int, gas uint64) *Contract {
+	if value == nil {
+		value = new(big.Int)
+	}
+	return &Contract{
+		CallerAddress: caller,
+		Address:       address,
+		Value:         value,
+		Gas:           gas,
+	}
+}
+
+// setCode sets the code executed by the contract
+func (c *Contract) setCode(hash crypto.Hash, code []byte) {
+	c.Code = code
+	c.CodeHash = hash
+}
+
+// getOp returns the opcode at position n, STOP past the end of the code
+func (c *Contract) getOp(n uint64) OpCode {
+	if n < uint64(len(c.Code)) {
+		return OpCode(c.Code[n])
+	}
+	return STOP
+}
+
+// useGas deducts gas, returning false if not enough gas is left
+func (c *Contract) useGas(gas uint64) bool {
+	if c.Gas < gas {
+		return false
+	}
+	c.Gas -= gas
+	return true
+}
+
+// validJumpdest checks whether dest is a JUMPDEST instruction that is not
+// part of push data
+func (c *Contract) validJumpdest(dest *big.Int) bool {
+	if !dest.IsUint64() || dest.Uint64() >= uint64(len(c.Code)) {
+		return false
+	}
+	udest := dest.Uint64()
+	if OpCode(c.Code[udest]) != JUMPDEST {
+		return false
+	}
+	if c.analysis == nil {
+		c.analysis = codeBitmap(c.Code)
+	}
+	return c.analysis.isCode(udest)
+}
+
+// bitvec marks push data bytes in code, a set bit means data
+type bitvec []byte
+
+// isCode checks whether the byte at pos is an instruction
+func (bits bitvec) isCode(pos uint64) bool {
+	return bits[pos/8]&(1<<(pos%8)) == 0
+}
+
+// codeBitmap marks every push data byte of code
+func codeBitmap(code []byte) bitvec {
+	bits := make(bitvec, len(code)/8+1)
+	for pc := uint64(0); pc < uint64(len(code)); {
+		op := OpCode(code[pc])
+		pc++
+		if !op.IsPush() {
+			continue
+		}
+		for n := uint64(op-PUSH1) + 1; n > 0 && pc < uint64(len(code)); n-- {
+			bits[pc/8] |= 1 << (pc % 8)
+			pc++
+		}
+	}
+	return bits
+}
@@ -0,0 +1,342 @@
+package evm
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+)
+
+var (
+	ErrOutOfGas                 = errors.New("out of gas")
+	ErrCodeStoreOutOfGas        = errors.New("contract creation code storage out of gas")
+	ErrDepth                    = errors.New("max call depth exceeded")
+	ErrInsufficientBalance      = errors.New("insufficient balance for transfer")
+	ErrContractAddressCollision = errors.New("contract address collision")
+	ErrExecutionReverted        = core.ErrExecutionReverted
+	ErrMaxCodeSizeExceeded      = errors.New("max code size exceeded")
+	ErrMaxInitCodeSizeExceeded  = errors.New("max initcode size exceeded")
+	ErrInvalidJump              = errors.New("invalid jump destination")
+	ErrWriteProtection          = errors.New("write protection")
+	ErrReturnDataOutOfBounds    = errors.New("return data out of bounds")
+	ErrGasUintOverflow          = errors.New("gas uint64 overflow")
+	ErrInvalidCode              = errors.New("invalid code: must not begin with 0xef")
+	ErrNonceUintOverflow        = errors.New("nonce uint64 overflow")
+)
+
+// ErrStackUnderflow wraps an evm error when the items on the stack are less
+// than the minimal requirement
+type ErrStackUnderflow struct {
+	stackLen int
+	required int
+}
+
+func (e *ErrStackUnderflow) Error() string {
+	return fmt.Sprintf("stack underflow (%d <=> %d)", e.stackLen, e.required)
+}
+
+// ErrStackOverflow wraps an evm error when the items on the stack exceed
+// the maximum allowance
+type ErrStackOverflow struct {
+	stackLen int
+	limit    int
+}
+
+func (e *ErrStackOverflow) Error() string {
+	return fmt.Sprintf("stack limit reached %d (%d)", e.stackLen, e.limit)
+}
+
+// ErrInvalidOpCode wraps an evm error when an invalid opcode is encountered
+type ErrInvalidOpCode struct {
+	opcode OpCode
+}
+
+func (e *ErrInvalidOpCode) Error() string {
+	return fmt.Sprintf("invalid opcode: %s", e.opcode)
+}
+
+// EVM executes contract code for a single transaction
+type EVM struct {
+	Context   core.BlockContext
+	TxContext core.TxContext
+	StateDB   *StateDBAdapter
+
+	table      *JumpTable // Instruction set, kept here to avoid an initialization cycle
+	depth      int        // Current call depth
+	readOnly   bool       // Whether state modifications are forbidden (STATICCALL)
+	returnData []byte     // Return data of the last call, for RETURNDATA*
+
+	// callGasTemp holds the gas available for the current call, it is
+	// computed by the dynamic gas function and used by the CALL opcodes
+	callGasTemp uint64
+}
+
+// New creates an EVM executing on top of state. It satisfies core.VMFactory.
+func New(state *core.StateDB, block core.BlockContext, tx core.TxContext) core.VM {
+	evm := &EVM{
+		Context:   block,
+		TxContext: tx,
+		StateDB:   NewStateDBAdapter(state),
+		table:     &instructionSet,
+	}
+	// Precompiles are always warm (EIP-2929)
+	for addr := range precompiledContracts {
+		evm.StateDB.AddAddressToAccessList(addr)
+	}
+	return evm
+}
+
+// precompile returns the precompiled contract at addr, if any
+func (evm *EVM) precompile(addr crypto.Address) (PrecompiledContract, bool) {
+	p, ok := precompiledContracts[addr]
+	return p, ok
+}
+
+// Call executes the contract at addr with input as parameters, transferring
+// value from caller. State changes are reverted on error, and all gas is
+// consumed unless the error is a revert.
+func (evm *EVM) Call(caller, addr crypto.Address, input []byte, gas uint64, value *big.Int) (ret []byte, leftOverGas uint64, err error) {
+	if value == nil {
+		value = new(big.Int)
+	}
+	if tracer := evm.frameTracer(); tracer != nil {
+		tracer.CaptureEnter(core.CallTypeCall, caller, addr, input, gas, value)
+		defer func(startGas uint64) { tracer.CaptureExit(ret, startGas-leftOverGas, err) }(gas)
+	}
+	if evm.depth > CallCreateDepth {
+		return nil, gas, ErrDepth
+	}
+	if value.Sign() != 0 && !evm.canTransfer(caller, value) {
+		return nil, gas, ErrInsufficientBalance
+	}
+	snapshot := evm.StateDB.Snapshot()
+	p, isPrecompile := evm.precompile(addr)
+
+	if !evm.StateDB.Exist(addr) {
+		if !isPrecompile && value.Sign() == 0 {
+			// Calling a non-existing account without value is a no-op
+			return nil, gas, nil
+		}
+		evm.StateDB.CreateAccount(addr)
+	}
+	evm.transfer(caller, addr, value)
+
+	if isPrecompile {
+		ret, gas, err = runPrecompiledContract(p, input, gas)
+	} else {
+		code := evm.StateDB.GetCode(addr)
+		if len(code) == 0 {
+			ret, err = nil, nil // gas is unchanged
+		} else {
+			contract := newContract(caller, addr, value, gas)
+			contract.setCode(evm.StateDB.GetCodeHash(addr), code)
+			ret, err = evm.run(contract, input, false)
+			gas = contract.Gas
+		}
+	}
+	if err != nil {
+		evm.StateDB.RevertToSnapshot(snapshot)
+		if err != ErrExecutionReverted {
+			gas = 0
+		}
+	}
+	return ret, gas, err
+}
+
+// CallCode executes the code at addr in the context of caller
+func (evm *EVM) CallCode(caller, addr crypto.Address, input []byte, gas uint64, value *big.Int) (ret []byte, leftOverGas uint64, err error) {
+	if tracer := evm.frameTracer(); tracer != nil {
+		tracer.CaptureEnter(core.CallTypeCallCode, caller, addr, input, gas, value)
+		defer func(startGas uint64) { tracer.CaptureExit(ret, startGas-leftOverGas, err) }(gas)
+	}
+	if evm.depth > CallCreateDepth {
+		return nil, gas, ErrDepth
+	}
+	// Only the balance is checked, the value stays with the caller
+	if !evm.canTransfer(caller, value) {
+		return nil, gas, ErrInsufficientBalance
+	}
+	snapshot := evm.StateDB.Snapshot()
+
+	if p, isPrecompile := evm.precompile(addr); isPrecompile {
+		ret, gas, err = runPrecompiledContract(p, input, gas)
+	} else {
+		contract := newContract(caller, caller, value, gas)
+		contract.setCode(evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
+		ret, err = evm.run(contract, input, false)
+		gas = contract.Gas
+	}
+	if err != nil {
+		evm.StateDB.RevertToSnapshot(snapshot)
+		if err != ErrExecutionReverted {
+			gas = 0
+		}
+	}
+	return ret, gas, err
+}
+
+// DelegateCall executes the code at addr in the context of parent, keeping
+// the caller and value of the parent frame
+func (evm *EVM) DelegateCall(parent *Contract, addr crypto.Address, input []byte, gas uint64) (ret []byte, leftOverGas uint64, err error) {
+	if tracer := evm.frameTracer(); tracer != nil {
+		tracer.CaptureEnter(core.CallTypeDelegateCall, parent.Address, addr, input, gas, parent.Value)
+		defer func(startGas uint64) { tracer.CaptureExit(ret, startGas-leftOverGas, err) }(gas)
+	}
+	if evm.depth > CallCreateDepth {
+		return nil, gas, ErrDepth
+	}
+	snapshot := evm.StateDB.Snapshot()
+
+	if p, isPrecompile := evm.precompile(addr); isPrecompile {
+		ret, gas, err = runPrecompiledContract(p, input, gas)
+	} else {
+		contract := newContract(parent.CallerAddress, parent.Address, parent.Value, gas)
+		contract.setCode(evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
+		ret, err = evm.run(contract, input, false)
+		gas = contract.Gas
+	}
+	if err != nil {
+		evm.StateDB.RevertToSnapshot(snapshot)
+		if err != ErrExecutionReverted {
+			gas = 0
+		}
+	}
+	return ret, gas, err
+}
+
+// StaticCall executes the contract at addr without allowing any state
+// modifications
+func (evm *EVM) StaticCall(caller, addr crypto.Address, input []byte, gas uint64) (ret []byte, leftOverGas uint64, err error) {
+	if tracer := evm.frameTracer(); tracer != nil {
+		tracer.CaptureEnter(core.CallTypeStaticCall, caller, addr, input, gas, nil)
+		defer func(startGas uint64) { tracer.CaptureExit(ret, startGas-leftOverGas, err) }(gas)
+	}
+	if evm.depth > CallCreateDepth {
+		return nil, gas, ErrDepth
+	}
+	snapshot := evm.StateDB.Snapshot()
+
+	if p, isPrecompile := evm.precompile(addr); isPrecompile {
+		ret, gas, err = runPrecompiledContract(p, input, gas)
+	} else {
+		contract := newContract(caller, addr, new(big.Int), gas)
+		contract.setCode(evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
+		ret, err = evm.run(contract, input, true)
+		gas = contract.Gas
+	}
+	if err != nil {
+		evm.StateDB.RevertToSnapshot(snapshot)
+		if err != ErrExecutionReverted {
+			gas = 0
+		}
+	}
+	return ret, gas, err
+}
+
+// Create deploys a contract at the address derived from caller's nonce
+func (evm *EVM) Create(caller crypto.Address, code []byte, gas uint64, value *big.Int) (ret []byte, contractAddr crypto.Address, leftOverGas uint64, err error) {
+	contractAddr = core.CreateAddress(caller, evm.StateDB.GetNonce(caller))
+	return evm.create(core.CallTypeCreate, caller, code, gas, value, contractAddr)
+}
+
+// Create2 deploys a contract at the address derived from caller, salt and
+// the init code hash (EIP-1014)
+func (evm *EVM) Create2(caller crypto.Address, code []byte, gas uint64, value *big.Int, salt crypto.Hash) (ret []byte, contractAddr crypto.Address, leftOverGas uint64, err error) {
+	contractAddr = core.CreateAddress2(caller, salt, crypto.Keccak256(code))
+	return evm.create(core.CallTypeCreate2, caller, code, gas, value, contractAddr)
+}
+
+// create runs the init code and stores the returned code at address
+func (evm *EVM) create(typ core.CallType, caller crypto.Address, code []byte, gas uint64, value *big.Int, address crypto.Address) (ret []byte, contractAddr crypto.Address, leftOverGas uint64, err error) {
+	if value == nil {
+		value = new(big.Int)
+	}
+	if tracer := evm.frameTracer(); tracer != nil {
+		tracer.CaptureEnter(typ, caller, address, code, gas, value)
+		defer func(startGas uint64) { tracer.CaptureExit(ret, startGas-leftOverGas, err) }(gas)
+	}
+	if evm.depth > CallCreateDepth {
+		return nil, crypto.Address{}, gas, ErrDepth
+	}
+	if !evm.canTransfer(caller, value) {
+		return nil, crypto.Address{}, gas, ErrInsufficientBalance
+	}
+	nonce := evm.StateDB.GetNonce(caller)
+	if nonce+1 < nonce {
+		return nil, crypto.Address{}, gas, ErrNonceUintOverflow
+	}
+	evm.StateDB.SetNonce(caller, nonce+1)
+
+	// The address is warm even if the creation fails (EIP-2929)
+	evm.StateDB.AddAddressToAccessList(address)
+
+	// Refuse to deploy over an existing contract
+	codeHash := evm.StateDB.GetCodeHash(address)
+	if evm.StateDB.GetNonce(address) != 0 || (!codeHash.IsZero() && codeHash != emptyCodeHash) {
+		return nil, crypto.Address{}, 0, ErrContractAddressCollision
+	}
+
+	snapshot := evm.StateDB.Snapshot()
+	evm.StateDB.CreateAccount(address)
+	evm.StateDB.CreateContract(address)
+	evm.StateDB.SetNonce(address, 1)
+	evm.transfer(caller, address, value)
+
+	contract := newContract(caller, address, value, gas)
+	contract.setCode(crypto.Keccak256Hash(code), code)
+
+	ret, err = evm.run(contract, nil, false)
+
+	if err == nil && len(ret) > MaxCodeSize {
+		err = ErrMaxCodeSizeExceeded
+	}
+	// Reject code starting with 0xEF (EIP-3541)
+	if err == nil && len(ret) >= 1 && ret[0] == 0xEF {
+		err = ErrInvalidCode
+	}
+	if err == nil {
+		createDataGas := uint64(len(ret)) * CreateDataGas
+		if contract.useGas(createDataGas) {
+			if len(ret) > 0 {
+				evm.StateDB.SetCode(address, ret)
+			}
+		} else {
+			err = ErrCodeStoreOutOfGas
+		}
+	}
+
+	if err != nil {
+		evm.StateDB.RevertToSnapshot(snapshot)
+		if err != ErrExecutionReverted {
+			contract.Gas = 0
+		}
+	}
+	return ret, address, contract.Gas, err
+}
+
+// frameTracer returns the tracer to notify of a call frame. The top level
+// frame is reported by the execution engine, only nested frames are
+// reported here.
+func (evm *EVM) frameTracer() core.Tracer {
+	if evm.depth == 0 {
+		return nil
+	}
+	return evm.TxContext.Tracer
+}
+
+// canTransfer checks whether addr has enough balance to send amount.
+// Block rewards that are not mature yet can not be sent.
+func (evm *EVM) canTransfer(addr crypto.Address, amount *big.Int) bool {
+	return evm.StateDB.GetSpendableBalance(addr).Cmp(amount) >= 0
+}
+
+// transfer moves amount from sender to recipient
+func (evm *EVM) transfer(sender, recipient crypto.Address, amount *big.Int) {
+	if amount.Sign() == 0 {
+		return
+	}
+	evm.StateDB.SubBalance(sender, amount)
+	evm.StateDB.AddBalance(recipient, amount)
+}
@@ -0,0 +1,456 @@
+package evm
+
+import (
+	"math"
+	"math/big"
+	"math/bits"
+
+	"blockchain-node/crypto"
+)
+
+type (
+	// gasFunc calculates the dynamic gas of an operation
+	gasFunc func(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error)
+
+	// memorySizeFunc returns the memory size an operation needs
+	memorySizeFunc func(stack *Stack) (size uint64, overflow bool)
+)
+
+// toWordSize returns the number of 32 byte words needed for size bytes
+func toWordSize(size uint64) uint64 {
+	if size > math.MaxUint64-31 {
+		return math.MaxUint64/32 + 1
+	}
+	return (size + 31) / 32
+}
+
+// safeAdd returns x+y and whether it overflowed
+func safeAdd(x, y uint64) (uint64, bool) {
+	sum, carry := bits.Add64(x, y, 0)
+	return sum, carry != 0
+}
+
+// safeMul returns x*y and whether it overflowed
+func safeMul(x, y uint64) (uint64, bool) {
+	hi, lo := bits.Mul64(x, y)
+	return lo, hi != 0
+}
+
+// calcMemSize returns offset+length, zero if length is zero
+func calcMemSize(offset, length *big.Int) (uint64, bool) {
+	if length.Sign() == 0 {
+		return 0, false
+	}
+	if !offset.IsUint64() || !length.IsUint64() {
+		return 0, true
+	}
+	return safeAdd(offset.Uint64(), length.Uint64())
+}
+
+// memoryGasCost calculates the gas for expanding the memory to newMemSize.
+// Only the expansion is charged, the memory remembers what was paid.
+func memoryGasCost(mem *Memory, newMemSize uint64) (uint64, error) {
+	if newMemSize == 0 {
+		return 0, nil
+	}
+	// The maximum that fits in a uint64 without overflowing the quadratic
+	// term, anything larger would run out of gas anyway
+	if newMemSize > 0x1FFFFFFFE0 {
+		return 0, ErrGasUintOverflow
+	}
+	newMemSizeWords := toWordSize(newMemSize)
+	newMemSize = newMemSizeWords * 32
+
+	if newMemSize > uint64(mem.len()) {
+		square := newMemSizeWords * newMemSizeWords
+		linCoef := newMemSizeWords * MemoryGas
+		quadCoef := square / QuadCoeffDiv
+		newTotalFee := linCoef + quadCoef
+
+		fee := newTotalFee - mem.lastGasCost
+		mem.lastGasCost = newTotalFee
+		return fee, nil
+	}
+	return 0, nil
+}
+
+// Memory size functions
+
+func memoryKeccak256(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), stack.back(1))
+}
+
+func memoryCallDataCopy(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), stack.back(2))
+}
+
+func memoryReturnDataCopy(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), stack.back(2))
+}
+
+func memoryCodeCopy(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), stack.back(2))
+}
+
+func memoryExtCodeCopy(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(1), stack.back(3))
+}
+
+func memoryMLoad(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), big.NewInt(32))
+}
+
+func memoryMStore8(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), big.NewInt(1))
+}
+
+func memoryMStore(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), big.NewInt(32))
+}
+
+func memoryMCopy(stack *Stack) (uint64, bool) {
+	dst, overflow := calcMemSize(stack.back(0), stack.back(2))
+	if overflow {
+		return 0, true
+	}
+	src, overflow := calcMemSize(stack.back(1), stack.back(2))
+	if overflow {
+		return 0, true
+	}
+	if dst > src {
+		return dst, false
+	}
+	return src, false
+}
+
+func memoryCreate(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(1), stack.back(2))
+}
+
+func memoryCall(stack *Stack) (uint64, bool) {
+	x, overflow := calcMemSize(stack.back(5), stack.back(6))
+	if overflow {
+		return 0, true
+	}
+	y, overflow := calcMemSize(stack.back(3), stack.back(4))
+	if overflow {
+		return 0, true
+	}
+	if x > y {
+		return x, false
+	}
+	return y, false
+}
+
+func memoryDelegateCall(stack *Stack) (uint64, bool) {
+	x, overflow := calcMemSize(stack.back(4), stack.back(5))
+	if overflow {
+		return 0, true
+	}
+	y, overflow := calcMemSize(stack.back(2), stack.back(3))
+	if overflow {
+		return 0, true
+	}
+	if x > y {
+		return x, false
+	}
+	return y, false
+}
+
+func memoryReturn(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), stack.back(1))
+}
+
+func memoryLog(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), stack.back(1))
+}
+
+// Dynamic gas functions
+
+// pureMemoryGascost charges only for memory expansion
+func pureMemoryGascost(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return memoryGasCost(mem, memorySize)
+}
+
+// memoryCopierGas charges memory expansion plus CopyGas per word of the
+// length found at stack position stackpos
+func memoryCopierGas(stackpos int) gasFunc {
+	return func(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+		gas, err := memoryGasCost(mem, memorySize)
+		if err != nil {
+			return 0, err
+		}
+		length := stack.back(stackpos)
+		if !length.IsUint64() {
+			return 0, ErrGasUintOverflow
+		}
+		words, overflow := safeMul(toWordSize(length.Uint64()), CopyGas)
+		if overflow {
+			return 0, ErrGasUintOverflow
+		}
+		if gas, overflow = safeAdd(gas, words); overflow {
+			return 0, ErrGasUintOverflow
+		}
+		return gas, nil
+	}
+}
+
+var (
+	gasCallDataCopy   = memoryCopierGas(2)
+	gasCodeCopy       = memoryCopierGas(2)
+	gasReturnDataCopy = memoryCopierGas(2)
+	gasMCopy          = memoryCopierGas(2)
+	gasExtCodeCopyRaw = memoryCopierGas(3)
+)
+
+func gasExp(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	expByteLen := uint64((stack.back(1).BitLen() + 7) / 8)
+	return expByteLen * ExpByteGas, nil
+}
+
+func gasKeccak256(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	gas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	length := stack.back(1)
+	if !length.IsUint64() {
+		return 0, ErrGasUintOverflow
+	}
+	wordGas, overflow := safeMul(toWordSize(length.Uint64()), Keccak256WordGas)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	if gas, overflow = safeAdd(gas, wordGas); overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return gas, nil
+}
+
+// makeGasLog charges for a LOG operation with n topics
+func makeGasLog(n uint64) gasFunc {
+	return func(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+		requestedSize := stack.back(1)
+		if !requestedSize.IsUint64() {
+			return 0, ErrGasUintOverflow
+		}
+
+		gas, err := memoryGasCost(mem, memorySize)
+		if err != nil {
+			return 0, err
+		}
+
+		var overflow bool
+		if gas, overflow = safeAdd(gas, LogGas); overflow {
+			return 0, ErrGasUintOverflow
+		}
+		if gas, overflow = safeAdd(gas, n*LogTopicGas); overflow {
+			return 0, ErrGasUintOverflow
+		}
+		dataGas, overflow := safeMul(requestedSize.Uint64(), LogDataGas)
+		if overflow {
+			return 0, ErrGasUintOverflow
+		}
+		if gas, overflow = safeAdd(gas, dataGas); overflow {
+			return 0, ErrGasUintOverflow
+		}
+		return gas, nil
+	}
+}
+
+// gasAccountAccess charges the EIP-2929 cold surcharge for the account at
+// stack position 0 (BALANCE, EXTCODESIZE, EXTCODEHASH)
+func gasAccountAccess(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	addr := bigToAddress(stack.peek())
+	if !evm.StateDB.AddressInAccessList(addr) {
+		evm.StateDB.AddAddressToAccessList(addr)
+		return ColdAccountAccessCost - WarmStorageReadCost, nil
+	}
+	return 0, nil
+}
+
+func gasExtCodeCopy(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	gas, err := gasExtCodeCopyRaw(evm, contract, stack, mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	addr := bigToAddress(stack.peek())
+	if !evm.StateDB.AddressInAccessList(addr) {
+		evm.StateDB.AddAddressToAccessList(addr)
+		var overflow bool
+		if gas, overflow = safeAdd(gas, ColdAccountAccessCost-WarmStorageReadCost); overflow {
+			return 0, ErrGasUintOverflow
+		}
+	}
+	return gas, nil
+}
+
+func gasSLoad(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	slot := bigToHash(stack.peek())
+	if _, slotPresent := evm.StateDB.SlotInAccessList(contract.Address, slot); !slotPresent {
+		evm.StateDB.AddSlotToAccessList(contract.Address, slot)
+		return ColdSloadCost, nil
+	}
+	return WarmStorageReadCost, nil
+}
+
+// gasSStore implements the SSTORE gas schedule of EIP-2200 with the access
+// list costs of EIP-2929 and the reduced refunds of EIP-3529
+func gasSStore(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	// If we fail the minimum gas availability invariant, fail (0)
+	if contract.Gas <= SstoreSentryGas {
+		return 0, ErrOutOfGas
+	}
+
+	var (
+		slot  = bigToHash(stack.back(0))
+		value = bigToHash(stack.back(1))
+		cost  = uint64(0)
+	)
+	if _, slotPresent := evm.StateDB.SlotInAccessList(contract.Address, slot); !slotPresent {
+		cost = ColdSloadCost
+		evm.StateDB.AddSlotToAccessList(contract.Address, slot)
+	}
+
+	current := evm.StateDB.GetState(contract.Address, slot)
+	if current == value { // noop
+		return cost + WarmStorageReadCost, nil
+	}
+
+	original := evm.StateDB.GetCommittedState(contract.Address, slot)
+	if original == current {
+		if original == (crypto.Hash{}) { // create slot
+			return cost + SstoreSetGas, nil
+		}
+		if value == (crypto.Hash{}) { // delete slot
+			evm.StateDB.AddRefund(SstoreClearsRefund)
+		}
+		return cost + (SstoreResetGas - ColdSloadCost), nil // write existing slot
+	}
+
+	// Dirty update
+	if original != (crypto.Hash{}) {
+		if current == (crypto.Hash{}) { // recreate slot
+			evm.StateDB.SubRefund(SstoreClearsRefund)
+		} else if value == (crypto.Hash{}) { // delete slot
+			evm.StateDB.AddRefund(SstoreClearsRefund)
+		}
+	}
+	if original == value {
+		if original == (crypto.Hash{}) { // reset to original inexistent slot
+			evm.StateDB.AddRefund(SstoreSetGas - WarmStorageReadCost)
+		} else { // reset to original existing slot
+			evm.StateDB.AddRefund((SstoreResetGas - ColdSloadCost) - WarmStorageReadCost)
+		}
+	}
+	return cost + WarmStorageReadCost, nil
+}
+
+// gasCreate charges memory expansion and the EIP-3860 init code word cost
+func gasCreate(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return createGas(mem, memorySize, stack.back(2), InitCodeWordGas)
+}
+
+// gasCreate2 additionally charges for hashing the init code
+func gasCreate2(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return createGas(mem, memorySize, stack.back(2), InitCodeWordGas+Keccak256WordGas)
+}
+
+func createGas(mem *Memory, memorySize uint64, size *big.Int, wordGas uint64) (uint64, error) {
+	gas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	if !size.IsUint64() || size.Uint64() > MaxInitCodeSize {
+		return 0, ErrMaxInitCodeSizeExceeded
+	}
+	moreGas := toWordSize(size.Uint64()) * wordGas
+	var overflow bool
+	if gas, overflow = safeAdd(gas, moreGas); overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return gas, nil
+}
+
+// callGas returns the gas a call may forward, all but one 64th of the gas
+// left after paying base (EIP-150)
+func callGas(availableGas, base uint64, callCost *big.Int) (uint64, error) {
+	if availableGas < base {
+		return 0, ErrOutOfGas
+	}
+	availableGas = availableGas - base
+	gas := availableGas - availableGas/64
+	if !callCost.IsUint64() || gas < callCost.Uint64() {
+		return gas, nil
+	}
+	return callCost.Uint64(), nil
+}
+
+// makeCallGas builds the gas function of the call variants. The EIP-2929
+// cold surcharge is deducted first so the 63/64 rule applies to what is
+// left afterwards.
+func makeCallGas(transfersValue, createsAccount bool) gasFunc {
+	return func(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+		addr := bigToAddress(stack.back(1))
+		coldCost := uint64(0)
+		if !evm.StateDB.AddressInAccessList(addr) {
+			evm.StateDB.AddAddressToAccessList(addr)
+			coldCost = ColdAccountAccessCost - WarmStorageReadCost
+			if !contract.useGas(coldCost) {
+				return 0, ErrOutOfGas
+			}
+		}
+
+		var gas uint64
+		if transfersValue && stack.back(2).Sign() != 0 {
+			gas += CallValueTransferGas
+			if createsAccount && evm.StateDB.Empty(addr) {
+				gas += CallNewAccountGas
+			}
+		}
+		memoryGas, err := memoryGasCost(mem, memorySize)
+		if err != nil {
+			return 0, err
+		}
+		var overflow bool
+		if gas, overflow = safeAdd(gas, memoryGas); overflow {
+			return 0, ErrGasUintOverflow
+		}
+
+		evm.callGasTemp, err = callGas(contract.Gas, gas, stack.back(0))
+		if err != nil {
+			return 0, err
+		}
+		if gas, overflow = safeAdd(gas, evm.callGasTemp); overflow {
+			return 0, ErrGasUintOverflow
+		}
+
+		// The cold cost was already deducted, give it back so the caller
+		// can charge the total in one go
+		contract.Gas += coldCost
+		if gas, overflow = safeAdd(gas, coldCost); overflow {
+			return 0, ErrGasUintOverflow
+		}
+		return gas, nil
+	}
+}
+
+var (
+	gasCall         = makeCallGas(true, true)
+	gasCallCode     = makeCallGas(true, false)
+	gasDelegateCall = makeCallGas(false, false)
+	gasStaticCall   = makeCallGas(false, false)
+)
+
+func gasSelfdestruct(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	var gas uint64
+	beneficiary := bigToAddress(stack.peek())
+	if !evm.StateDB.AddressInAccessList(beneficiary) {
+		evm.StateDB.AddAddressToAccessList(beneficiary)
+		gas = ColdAccountAccessCost
+	}
+	if evm.StateDB.Empty(beneficiary) && evm.StateDB.GetSpendableBalance(contract.Address).Sign() != 0 {
+		gas += CreateBySelfdestructGas
+	}
+	return gas, nil
+}
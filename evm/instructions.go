@@ -0,0 +1,836 @@
+package evm
+
+import (
+	"math/big"
+
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+)
+
+var (
+	tt255   = new(big.Int).Lsh(big.NewInt(1), 255)
+	tt256   = new(big.Int).Lsh(big.NewInt(1), 256)
+	tt256m1 = new(big.Int).Sub(tt256, big.NewInt(1))
+	big0    = big.NewInt(0)
+	big1    = big.NewInt(1)
+	big32   = big.NewInt(32)
+	big256  = big.NewInt(256)
+)
+
+// emptyCodeHash is the keccak256 hash of empty code
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
+// executionFunc executes an operation. Operations that jump update pc
+// themselves.
+type executionFunc func(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error)
+
+// scopeContext holds the state of the call frame being executed. It
+// implements core.ScopeContext for tracers.
+type scopeContext struct {
+	Memory   *Memory
+	Stack    *Stack
+	Contract *Contract
+}
+
+func (s *scopeContext) MemoryData() []byte      { return s.Memory.store }
+func (s *scopeContext) StackData() []*big.Int   { return s.Stack.data }
+func (s *scopeContext) Caller() crypto.Address  { return s.Contract.CallerAddress }
+func (s *scopeContext) Address() crypto.Address { return s.Contract.Address }
+func (s *scopeContext) CallValue() *big.Int     { return s.Contract.Value }
+func (s *scopeContext) CallInput() []byte       { return s.Contract.Input }
+
+// u256 wraps x into the range [0, 2^256)
+func u256(x *big.Int) *big.Int {
+	return x.And(x, tt256m1)
+}
+
+// s256 interprets x as a two's complement signed integer
+func s256(x *big.Int) *big.Int {
+	if x.Cmp(tt255) < 0 {
+		return x
+	}
+	return new(big.Int).Sub(x, tt256)
+}
+
+// bigToAddress converts the low 20 bytes of a stack value to an address
+func bigToAddress(x *big.Int) crypto.Address {
+	return crypto.BytesToAddress(bigToHash(x).Bytes()[12:])
+}
+
+// bigToHash converts a stack value to a 32 byte word
+func bigToHash(x *big.Int) crypto.Hash {
+	var h crypto.Hash
+	x.FillBytes(h[:])
+	return h
+}
+
+// getData returns size bytes of data starting at start, zero padded
+func getData(data []byte, start, size uint64) []byte {
+	length := uint64(len(data))
+	if start > length {
+		start = length
+	}
+	end := start + size
+	if end > length || end < start {
+		end = length
+	}
+	padded := make([]byte, size)
+	copy(padded, data[start:end])
+	return padded
+}
+
+// uint64OrMax returns x as uint64, saturating at the maximum
+func uint64OrMax(x *big.Int) uint64 {
+	if x.IsUint64() {
+		return x.Uint64()
+	}
+	return ^uint64(0)
+}
+
+func opAdd(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := scope.Stack.pop(), scope.Stack.peek()
+	u256(y.Add(x, y))
+	return nil, nil
+}
+
+func opSub(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := scope.Stack.pop(), scope.Stack.peek()
+	u256(y.Sub(x, y))
+	return nil, nil
+}
+
+func opMul(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := scope.Stack.pop(), scope.Stack.peek()
+	u256(y.Mul(x, y))
+	return nil, nil
+}
+
+func opDiv(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := scope.Stack.pop(), scope.Stack.peek()
+	if y.Sign() != 0 {
+		y.Div(x, y)
+	}
+	return nil, nil
+}
+
+func opSdiv(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := s256(scope.Stack.pop()), s256(scope.Stack.pop())
+	res := new(big.Int)
+	if y.Sign() != 0 {
+		// Quo truncates towards zero as required
+		res.Quo(x, y)
+	}
+	scope.Stack.push(u256(res))
+	return nil, nil
+}
+
+func opMod(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := scope.Stack.pop(), scope.Stack.peek()
+	if y.Sign() == 0 {
+		y.SetUint64(0)
+	} else {
+		y.Mod(x, y)
+	}
+	return nil, nil
+}
+
+func opSmod(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := s256(scope.Stack.pop()), s256(scope.Stack.pop())
+	res := new(big.Int)
+	if y.Sign() != 0 {
+		// Rem takes the sign of the dividend as required
+		res.Rem(x, y)
+	}
+	scope.Stack.push(u256(res))
+	return nil, nil
+}
+
+func opExp(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	base, exponent := scope.Stack.pop(), scope.Stack.peek()
+	exponent.Exp(base, exponent, tt256)
+	return nil, nil
+}
+
+func opSignExtend(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	back, num := scope.Stack.pop(), scope.Stack.peek()
+	if back.Cmp(big.NewInt(31)) < 0 {
+		bit := uint(back.Uint64()*8 + 7)
+		mask := new(big.Int).Lsh(big1, bit)
+		mask.Sub(mask, big1)
+		if num.Bit(int(bit)) > 0 {
+			num.Or(num, new(big.Int).Not(mask))
+		} else {
+			num.And(num, mask)
+		}
+		u256(num)
+	}
+	return nil, nil
+}
+
+func opNot(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x := scope.Stack.peek()
+	u256(x.Not(x))
+	return nil, nil
+}
+
+// pushBool replaces the top of the stack with 1 or 0
+func setBool(x *big.Int, value bool) {
+	if value {
+		x.SetUint64(1)
+	} else {
+		x.SetUint64(0)
+	}
+}
+
+func opLt(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := scope.Stack.pop(), scope.Stack.peek()
+	setBool(y, x.Cmp(y) < 0)
+	return nil, nil
+}
+
+func opGt(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := scope.Stack.pop(), scope.Stack.peek()
+	setBool(y, x.Cmp(y) > 0)
+	return nil, nil
+}
+
+func opSlt(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := scope.Stack.pop(), scope.Stack.peek()
+	setBool(y, s256(x).Cmp(s256(new(big.Int).Set(y))) < 0)
+	return nil, nil
+}
+
+func opSgt(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := scope.Stack.pop(), scope.Stack.peek()
+	setBool(y, s256(x).Cmp(s256(new(big.Int).Set(y))) > 0)
+	return nil, nil
+}
+
+func opEq(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := scope.Stack.pop(), scope.Stack.peek()
+	setBool(y, x.Cmp(y) == 0)
+	return nil, nil
+}
+
+func opIszero(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x := scope.Stack.peek()
+	setBool(x, x.Sign() == 0)
+	return nil, nil
+}
+
+func opAnd(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := scope.Stack.pop(), scope.Stack.peek()
+	y.And(x, y)
+	return nil, nil
+}
+
+func opOr(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := scope.Stack.pop(), scope.Stack.peek()
+	y.Or(x, y)
+	return nil, nil
+}
+
+func opXor(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y := scope.Stack.pop(), scope.Stack.peek()
+	y.Xor(x, y)
+	return nil, nil
+}
+
+func opByte(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	th, val := scope.Stack.pop(), scope.Stack.peek()
+	if th.Cmp(big32) < 0 {
+		word := bigToHash(val)
+		val.SetUint64(uint64(word[th.Uint64()]))
+	} else {
+		val.SetUint64(0)
+	}
+	return nil, nil
+}
+
+func opAddmod(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y, z := scope.Stack.pop(), scope.Stack.pop(), scope.Stack.peek()
+	if z.Sign() == 0 {
+		return nil, nil
+	}
+	sum := new(big.Int).Add(x, y)
+	z.Mod(sum, z)
+	return nil, nil
+}
+
+func opMulmod(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x, y, z := scope.Stack.pop(), scope.Stack.pop(), scope.Stack.peek()
+	if z.Sign() == 0 {
+		return nil, nil
+	}
+	product := new(big.Int).Mul(x, y)
+	z.Mod(product, z)
+	return nil, nil
+}
+
+func opSHL(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	shift, value := scope.Stack.pop(), scope.Stack.peek()
+	if shift.Cmp(big256) >= 0 {
+		value.SetUint64(0)
+		return nil, nil
+	}
+	u256(value.Lsh(value, uint(shift.Uint64())))
+	return nil, nil
+}
+
+func opSHR(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	shift, value := scope.Stack.pop(), scope.Stack.peek()
+	if shift.Cmp(big256) >= 0 {
+		value.SetUint64(0)
+		return nil, nil
+	}
+	value.Rsh(value, uint(shift.Uint64()))
+	return nil, nil
+}
+
+func opSAR(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	shift, value := scope.Stack.pop(), scope.Stack.pop()
+	signed := s256(value)
+	if shift.Cmp(big256) >= 0 {
+		if signed.Sign() >= 0 {
+			scope.Stack.push(new(big.Int))
+		} else {
+			scope.Stack.push(new(big.Int).Set(tt256m1))
+		}
+		return nil, nil
+	}
+	// Rsh on a negative big.Int rounds towards negative infinity
+	result := new(big.Int).Rsh(signed, uint(shift.Uint64()))
+	scope.Stack.push(u256(result))
+	return nil, nil
+}
+
+func opKeccak256(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	offset, size := scope.Stack.pop(), scope.Stack.peek()
+	data := scope.Memory.getPtr(int64(offset.Uint64()), int64(size.Uint64()))
+	hash := crypto.Keccak256(data)
+	evm.StateDB.AddPreimage(crypto.BytesToHash(hash), data)
+	size.SetBytes(hash)
+	return nil, nil
+}
+
+func opAddress(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(new(big.Int).SetBytes(scope.Contract.Address.Bytes()))
+	return nil, nil
+}
+
+func opBalance(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	slot := scope.Stack.peek()
+	slot.Set(evm.StateDB.GetBalance(bigToAddress(slot)))
+	return nil, nil
+}
+
+func opOrigin(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(new(big.Int).SetBytes(evm.TxContext.Origin.Bytes()))
+	return nil, nil
+}
+
+func opCaller(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(new(big.Int).SetBytes(scope.Contract.CallerAddress.Bytes()))
+	return nil, nil
+}
+
+func opCallValue(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(new(big.Int).Set(scope.Contract.Value))
+	return nil, nil
+}
+
+func opCallDataLoad(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	x := scope.Stack.peek()
+	if !x.IsUint64() {
+		x.SetUint64(0)
+		return nil, nil
+	}
+	x.SetBytes(getData(scope.Contract.Input, x.Uint64(), 32))
+	return nil, nil
+}
+
+func opCallDataSize(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(new(big.Int).SetUint64(uint64(len(scope.Contract.Input))))
+	return nil, nil
+}
+
+func opCallDataCopy(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	var (
+		memOffset  = scope.Stack.pop()
+		dataOffset = scope.Stack.pop()
+		length     = scope.Stack.pop()
+	)
+	scope.Memory.set(memOffset.Uint64(), length.Uint64(),
+		getData(scope.Contract.Input, uint64OrMax(dataOffset), length.Uint64()))
+	return nil, nil
+}
+
+func opReturnDataSize(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(new(big.Int).SetUint64(uint64(len(evm.returnData))))
+	return nil, nil
+}
+
+func opReturnDataCopy(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	var (
+		memOffset  = scope.Stack.pop()
+		dataOffset = scope.Stack.pop()
+		length     = scope.Stack.pop()
+	)
+	if !dataOffset.IsUint64() {
+		return nil, ErrReturnDataOutOfBounds
+	}
+	end, overflow := safeAdd(dataOffset.Uint64(), length.Uint64())
+	if overflow || uint64(len(evm.returnData)) < end {
+		return nil, ErrReturnDataOutOfBounds
+	}
+	scope.Memory.set(memOffset.Uint64(), length.Uint64(), evm.returnData[dataOffset.Uint64():end])
+	return nil, nil
+}
+
+func opExtCodeSize(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	slot := scope.Stack.peek()
+	slot.SetUint64(uint64(evm.StateDB.GetCodeSize(bigToAddress(slot))))
+	return nil, nil
+}
+
+func opCodeSize(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(new(big.Int).SetUint64(uint64(len(scope.Contract.Code))))
+	return nil, nil
+}
+
+func opCodeCopy(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	var (
+		memOffset  = scope.Stack.pop()
+		codeOffset = scope.Stack.pop()
+		length     = scope.Stack.pop()
+	)
+	codeCopy := getData(scope.Contract.Code, uint64OrMax(codeOffset), length.Uint64())
+	scope.Memory.set(memOffset.Uint64(), length.Uint64(), codeCopy)
+	return nil, nil
+}
+
+func opExtCodeCopy(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	var (
+		addr       = bigToAddress(scope.Stack.pop())
+		memOffset  = scope.Stack.pop()
+		codeOffset = scope.Stack.pop()
+		length     = scope.Stack.pop()
+	)
+	codeCopy := getData(evm.StateDB.GetCode(addr), uint64OrMax(codeOffset), length.Uint64())
+	scope.Memory.set(memOffset.Uint64(), length.Uint64(), codeCopy)
+	return nil, nil
+}
+
+// opExtCodeHash returns zero for non-existent or empty accounts and the
+// hash of the empty code for accounts without code (EIP-1052)
+func opExtCodeHash(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	slot := scope.Stack.peek()
+	addr := bigToAddress(slot)
+	if evm.StateDB.Empty(addr) {
+		slot.SetUint64(0)
+		return nil, nil
+	}
+	codeHash := evm.StateDB.GetCodeHash(addr)
+	if codeHash.IsZero() {
+		codeHash = emptyCodeHash
+	}
+	slot.SetBytes(codeHash.Bytes())
+	return nil, nil
+}
+
+func opGasprice(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(bigOrZero(evm.TxContext.GasPrice))
+	return nil, nil
+}
+
+func opBlockhash(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	num := scope.Stack.peek()
+	if !num.IsUint64() || evm.Context.GetHash == nil {
+		num.SetUint64(0)
+		return nil, nil
+	}
+
+	var upper, lower uint64
+	upper = bigOrZero(evm.Context.Number).Uint64()
+	if upper > core.BlockHashWindow {
+		lower = upper - core.BlockHashWindow
+	}
+	if n := num.Uint64(); n >= lower && n < upper {
+		num.SetBytes(evm.Context.GetHash(n).Bytes())
+	} else {
+		num.SetUint64(0)
+	}
+	return nil, nil
+}
+
+func opCoinbase(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(new(big.Int).SetBytes(evm.Context.Coinbase.Bytes()))
+	return nil, nil
+}
+
+func opTimestamp(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(new(big.Int).SetUint64(evm.Context.Time))
+	return nil, nil
+}
+
+func opNumber(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(bigOrZero(evm.Context.Number))
+	return nil, nil
+}
+
+func opDifficulty(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(bigOrZero(evm.Context.Difficulty))
+	return nil, nil
+}
+
+func opGasLimit(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(new(big.Int).SetUint64(evm.Context.GasLimit))
+	return nil, nil
+}
+
+func opChainID(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(bigOrZero(evm.Context.ChainID))
+	return nil, nil
+}
+
+func opSelfBalance(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(evm.StateDB.GetBalance(scope.Contract.Address))
+	return nil, nil
+}
+
+func opBaseFee(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(bigOrZero(evm.Context.BaseFee))
+	return nil, nil
+}
+
+func opPop(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.pop()
+	return nil, nil
+}
+
+func opMload(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	v := scope.Stack.peek()
+	offset := int64(v.Uint64())
+	v.SetBytes(scope.Memory.getPtr(offset, 32))
+	return nil, nil
+}
+
+func opMstore(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	mStart, val := scope.Stack.pop(), scope.Stack.pop()
+	scope.Memory.set32(mStart.Uint64(), val)
+	return nil, nil
+}
+
+func opMstore8(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	off, val := scope.Stack.pop(), scope.Stack.pop()
+	scope.Memory.store[off.Uint64()] = byte(val.Uint64() & 0xff)
+	return nil, nil
+}
+
+func opMcopy(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	var (
+		dst    = scope.Stack.pop()
+		src    = scope.Stack.pop()
+		length = scope.Stack.pop()
+	)
+	scope.Memory.copyWithin(dst.Uint64(), src.Uint64(), length.Uint64())
+	return nil, nil
+}
+
+func opSload(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	loc := scope.Stack.peek()
+	value := evm.StateDB.GetState(scope.Contract.Address, bigToHash(loc))
+	loc.SetBytes(value.Bytes())
+	return nil, nil
+}
+
+func opSstore(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	loc, val := scope.Stack.pop(), scope.Stack.pop()
+	evm.StateDB.SetState(scope.Contract.Address, bigToHash(loc), bigToHash(val))
+	return nil, nil
+}
+
+func opTload(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	loc := scope.Stack.peek()
+	value := evm.StateDB.GetTransientState(scope.Contract.Address, bigToHash(loc))
+	loc.SetBytes(value.Bytes())
+	return nil, nil
+}
+
+func opTstore(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	loc, val := scope.Stack.pop(), scope.Stack.pop()
+	evm.StateDB.SetTransientState(scope.Contract.Address, bigToHash(loc), bigToHash(val))
+	return nil, nil
+}
+
+func opJump(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	pos := scope.Stack.pop()
+	if !scope.Contract.validJumpdest(pos) {
+		return nil, ErrInvalidJump
+	}
+	*pc = pos.Uint64()
+	return nil, nil
+}
+
+func opJumpi(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	pos, cond := scope.Stack.pop(), scope.Stack.pop()
+	if cond.Sign() == 0 {
+		*pc++
+		return nil, nil
+	}
+	if !scope.Contract.validJumpdest(pos) {
+		return nil, ErrInvalidJump
+	}
+	*pc = pos.Uint64()
+	return nil, nil
+}
+
+func opJumpdest(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	return nil, nil
+}
+
+func opPc(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(new(big.Int).SetUint64(*pc))
+	return nil, nil
+}
+
+func opMsize(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(new(big.Int).SetUint64(uint64(scope.Memory.len())))
+	return nil, nil
+}
+
+func opGas(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(new(big.Int).SetUint64(scope.Contract.Gas))
+	return nil, nil
+}
+
+func opPush0(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	scope.Stack.push(new(big.Int))
+	return nil, nil
+}
+
+// makePush creates the PUSH1 to PUSH32 operations
+func makePush(size uint64) executionFunc {
+	return func(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+		start := *pc + 1
+		scope.Stack.push(new(big.Int).SetBytes(getData(scope.Contract.Code, start, size)))
+		*pc += size
+		return nil, nil
+	}
+}
+
+// makeDup creates the DUP1 to DUP16 operations
+func makeDup(size int) executionFunc {
+	return func(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+		scope.Stack.dup(size)
+		return nil, nil
+	}
+}
+
+// makeSwap creates the SWAP1 to SWAP16 operations
+func makeSwap(size int) executionFunc {
+	return func(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+		scope.Stack.swap(size)
+		return nil, nil
+	}
+}
+
+// makeLog creates the LOG0 to LOG4 operations
+func makeLog(size int) executionFunc {
+	return func(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+		topics := make([]crypto.Hash, size)
+		mStart, mSize := scope.Stack.pop(), scope.Stack.pop()
+		for i := 0; i < size; i++ {
+			topics[i] = bigToHash(scope.Stack.pop())
+		}
+
+		evm.StateDB.AddLog(&core.Log{
+			Address: scope.Contract.Address,
+			Topics:  topics,
+			Data:    scope.Memory.getCopy(int64(mStart.Uint64()), int64(mSize.Uint64())),
+		})
+		return nil, nil
+	}
+}
+
+func opCreate(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	var (
+		value        = scope.Stack.pop()
+		offset, size = scope.Stack.pop(), scope.Stack.pop()
+		input        = scope.Memory.getCopy(int64(offset.Uint64()), int64(size.Uint64()))
+		gas          = scope.Contract.Gas
+	)
+	// All but one 64th of the remaining gas is passed on (EIP-150)
+	gas -= gas / 64
+	scope.Contract.useGas(gas)
+
+	res, addr, returnGas, suberr := evm.Create(scope.Contract.Address, input, gas, value)
+	if suberr != nil {
+		scope.Stack.push(new(big.Int))
+	} else {
+		scope.Stack.push(new(big.Int).SetBytes(addr.Bytes()))
+	}
+	scope.Contract.Gas += returnGas
+
+	if suberr == ErrExecutionReverted {
+		evm.returnData = res // set REVERT data to return data buffer
+		return res, nil
+	}
+	evm.returnData = nil // clear dirty return data buffer
+	return nil, nil
+}
+
+func opCreate2(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	var (
+		endowment    = scope.Stack.pop()
+		offset, size = scope.Stack.pop(), scope.Stack.pop()
+		salt         = scope.Stack.pop()
+		input        = scope.Memory.getCopy(int64(offset.Uint64()), int64(size.Uint64()))
+		gas          = scope.Contract.Gas
+	)
+	// All but one 64th of the remaining gas is passed on (EIP-150)
+	gas -= gas / 64
+	scope.Contract.useGas(gas)
+
+	res, addr, returnGas, suberr := evm.Create2(scope.Contract.Address, input, gas, endowment, bigToHash(salt))
+	if suberr != nil {
+		scope.Stack.push(new(big.Int))
+	} else {
+		scope.Stack.push(new(big.Int).SetBytes(addr.Bytes()))
+	}
+	scope.Contract.Gas += returnGas
+
+	if suberr == ErrExecutionReverted {
+		evm.returnData = res // set REVERT data to return data buffer
+		return res, nil
+	}
+	evm.returnData = nil // clear dirty return data buffer
+	return nil, nil
+}
+
+// finishCall pushes the call result, copies the return data into memory and
+// refunds the unused gas of a call
+func finishCall(evm *EVM, scope *scopeContext, retOffset, retSize *big.Int, ret []byte, returnGas uint64, err error) ([]byte, error) {
+	if err != nil {
+		scope.Stack.push(new(big.Int))
+	} else {
+		scope.Stack.push(big.NewInt(1))
+	}
+	if err == nil || err == ErrExecutionReverted {
+		scope.Memory.set(retOffset.Uint64(), retSize.Uint64(), ret)
+	}
+	scope.Contract.Gas += returnGas
+
+	evm.returnData = ret
+	return ret, nil
+}
+
+func opCall(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	stack := scope.Stack
+	// Pop gas. The actual gas is in evm.callGasTemp
+	stack.pop()
+	gas := evm.callGasTemp
+	addr, value, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
+	toAddr := bigToAddress(addr)
+	args := scope.Memory.getCopy(int64(inOffset.Uint64()), int64(inSize.Uint64()))
+
+	if evm.readOnly && value.Sign() != 0 {
+		return nil, ErrWriteProtection
+	}
+	if value.Sign() != 0 {
+		gas += CallStipend
+	}
+
+	ret, returnGas, err := evm.Call(scope.Contract.Address, toAddr, args, gas, value)
+	return finishCall(evm, scope, retOffset, retSize, ret, returnGas, err)
+}
+
+func opCallCode(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	stack := scope.Stack
+	// Pop gas. The actual gas is in evm.callGasTemp
+	stack.pop()
+	gas := evm.callGasTemp
+	addr, value, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
+	toAddr := bigToAddress(addr)
+	args := scope.Memory.getCopy(int64(inOffset.Uint64()), int64(inSize.Uint64()))
+
+	if value.Sign() != 0 {
+		gas += CallStipend
+	}
+
+	ret, returnGas, err := evm.CallCode(scope.Contract.Address, toAddr, args, gas, value)
+	return finishCall(evm, scope, retOffset, retSize, ret, returnGas, err)
+}
+
+func opDelegateCall(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	stack := scope.Stack
+	// Pop gas. The actual gas is in evm.callGasTemp
+	stack.pop()
+	gas := evm.callGasTemp
+	addr, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
+	toAddr := bigToAddress(addr)
+	args := scope.Memory.getCopy(int64(inOffset.Uint64()), int64(inSize.Uint64()))
+
+	ret, returnGas, err := evm.DelegateCall(scope.Contract, toAddr, args, gas)
+	return finishCall(evm, scope, retOffset, retSize, ret, returnGas, err)
+}
+
+func opStaticCall(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	stack := scope.Stack
+	// Pop gas. The actual gas is in evm.callGasTemp
+	stack.pop()
+	gas := evm.callGasTemp
+	addr, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
+	toAddr := bigToAddress(addr)
+	args := scope.Memory.getCopy(int64(inOffset.Uint64()), int64(inSize.Uint64()))
+
+	ret, returnGas, err := evm.StaticCall(scope.Contract.Address, toAddr, args, gas)
+	return finishCall(evm, scope, retOffset, retSize, ret, returnGas, err)
+}
+
+func opReturn(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	offset, size := scope.Stack.pop(), scope.Stack.pop()
+	return scope.Memory.getCopy(int64(offset.Uint64()), int64(size.Uint64())), nil
+}
+
+func opRevert(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	offset, size := scope.Stack.pop(), scope.Stack.pop()
+	ret := scope.Memory.getCopy(int64(offset.Uint64()), int64(size.Uint64()))
+	evm.returnData = ret
+	return ret, nil
+}
+
+func opUndefined(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	return nil, &ErrInvalidOpCode{opcode: OpCode(scope.Contract.Code[*pc])}
+}
+
+func opStop(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	return nil, nil
+}
+
+// opSelfdestruct sends the balance to the beneficiary. Only contracts
+// created in the same transaction are deleted (EIP-6780), at the end of the
+// transaction. There is no refund for it since EIP-3529. Block rewards that
+// are not mature yet stay behind, and are lost if the contract is deleted.
+func opSelfdestruct(pc *uint64, evm *EVM, scope *scopeContext) ([]byte, error) {
+	beneficiary := bigToAddress(scope.Stack.pop())
+	balance := evm.StateDB.GetSpendableBalance(scope.Contract.Address)
+	evm.StateDB.SubBalance(scope.Contract.Address, balance)
+	evm.StateDB.AddBalance(beneficiary, balance)
+	if evm.StateDB.IsNewContract(scope.Contract.Address) {
+		evm.StateDB.Suicide(scope.Contract.Address)
+	}
+	if tracer := evm.TxContext.Tracer; tracer != nil {
+		tracer.CaptureEnter(core.CallTypeSelfDestruct, scope.Contract.Address, beneficiary, nil, 0, balance)
+		tracer.CaptureExit(nil, 0, nil)
+	}
+	return nil, nil
+}
+
+// bigOrZero returns a copy of x, zero if x is nil
+func bigOrZero(x *big.Int) *big.Int {
+	if x == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(x)
+}
@@ -0,0 +1,114 @@
+package evm
+
+// run executes the code of contract with input as call data. readOnly makes
+// the frame and all frames below it static.
+func (evm *EVM) run(contract *Contract, input []byte, readOnly bool) (ret []byte, err error) {
+	evm.depth++
+	defer func() { evm.depth-- }()
+
+	if readOnly && !evm.readOnly {
+		evm.readOnly = true
+		defer func() { evm.readOnly = false }()
+	}
+
+	// The return data of a previous call is not visible to a new frame
+	evm.returnData = nil
+
+	if len(contract.Code) == 0 {
+		return nil, nil
+	}
+	contract.Input = input
+
+	var (
+		mem   = newMemory()
+		stack = newStack()
+		scope = &scopeContext{
+			Memory:   mem,
+			Stack:    stack,
+			Contract: contract,
+		}
+		pc  = uint64(0)
+		res []byte
+
+		// Tracer state, the opcode is reported once its cost is known
+		tracer  = evm.TxContext.Tracer
+		op      OpCode
+		gasCopy uint64
+		cost    uint64
+		logged  bool
+	)
+	if tracer != nil {
+		defer func() {
+			if err == nil {
+				return
+			}
+			if !logged {
+				tracer.CaptureState(pc, byte(op), gasCopy, cost, scope, evm.depth, err)
+			} else {
+				tracer.CaptureFault(pc, byte(op), gasCopy, cost, scope, evm.depth, err)
+			}
+		}()
+	}
+
+	for {
+		if tracer != nil {
+			gasCopy, logged = contract.Gas, false
+		}
+		op = contract.getOp(pc)
+		operation := evm.table[op]
+		cost = operation.constantGas
+
+		if sLen := stack.len(); sLen < operation.minStack {
+			return nil, &ErrStackUnderflow{stackLen: sLen, required: operation.minStack}
+		} else if sLen > operation.maxStack {
+			return nil, &ErrStackOverflow{stackLen: sLen, limit: operation.maxStack}
+		}
+		if evm.readOnly && operation.writes {
+			return nil, ErrWriteProtection
+		}
+		if !contract.useGas(operation.constantGas) {
+			return nil, ErrOutOfGas
+		}
+
+		if operation.dynamicGas != nil {
+			// Memory is expanded in words of 32 bytes and charged by the
+			// dynamic gas function before it is resized
+			var memorySize uint64
+			if operation.memorySize != nil {
+				memSize, overflow := operation.memorySize(stack)
+				if overflow {
+					return nil, ErrGasUintOverflow
+				}
+				if memorySize, overflow = safeMul(toWordSize(memSize), 32); overflow {
+					return nil, ErrGasUintOverflow
+				}
+			}
+			dynamicCost, err := operation.dynamicGas(evm, contract, stack, mem, memorySize)
+			cost += dynamicCost
+			if err != nil || !contract.useGas(dynamicCost) {
+				return nil, ErrOutOfGas
+			}
+			if memorySize > 0 {
+				mem.resize(memorySize)
+			}
+		}
+
+		if tracer != nil {
+			tracer.CaptureState(pc, byte(op), gasCopy, cost, scope, evm.depth, nil)
+			logged = true
+		}
+
+		res, err = operation.execute(&pc, evm, scope)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case operation.reverts:
+			return res, ErrExecutionReverted
+		case operation.halts:
+			return res, nil
+		case !operation.jumps:
+			pc++
+		}
+	}
+}
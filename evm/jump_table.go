@@ -0,0 +1,167 @@
+package evm
+
+// operation describes how an opcode is executed and charged
+type operation struct {
+	execute     executionFunc
+	constantGas uint64
+	dynamicGas  gasFunc
+	minStack    int            // Items required on the stack
+	maxStack    int            // Maximum stack size before the operation, to catch overflows
+	memorySize  memorySizeFunc // Memory the operation needs, nil if none
+
+	halts   bool // Whether the operation stops further execution
+	jumps   bool // Whether the operation sets the program counter itself
+	writes  bool // Whether the operation modifies state, forbidden in static calls
+	reverts bool // Whether the operation reverts state (REVERT)
+}
+
+// JumpTable maps every opcode to its operation
+type JumpTable [256]*operation
+
+// instructionSet is the Cancun instruction set, without blob opcodes
+var instructionSet = newInstructionSet()
+
+func newInstructionSet() JumpTable {
+	tbl := JumpTable{
+		STOP:       {execute: opStop, halts: true},
+		ADD:        {execute: opAdd, constantGas: GasFastestStep},
+		MUL:        {execute: opMul, constantGas: GasFastStep},
+		SUB:        {execute: opSub, constantGas: GasFastestStep},
+		DIV:        {execute: opDiv, constantGas: GasFastStep},
+		SDIV:       {execute: opSdiv, constantGas: GasFastStep},
+		MOD:        {execute: opMod, constantGas: GasFastStep},
+		SMOD:       {execute: opSmod, constantGas: GasFastStep},
+		ADDMOD:     {execute: opAddmod, constantGas: GasMidStep},
+		MULMOD:     {execute: opMulmod, constantGas: GasMidStep},
+		EXP:        {execute: opExp, constantGas: ExpGas, dynamicGas: gasExp},
+		SIGNEXTEND: {execute: opSignExtend, constantGas: GasFastStep},
+
+		LT:     {execute: opLt, constantGas: GasFastestStep},
+		GT:     {execute: opGt, constantGas: GasFastestStep},
+		SLT:    {execute: opSlt, constantGas: GasFastestStep},
+		SGT:    {execute: opSgt, constantGas: GasFastestStep},
+		EQ:     {execute: opEq, constantGas: GasFastestStep},
+		ISZERO: {execute: opIszero, constantGas: GasFastestStep},
+		AND:    {execute: opAnd, constantGas: GasFastestStep},
+		OR:     {execute: opOr, constantGas: GasFastestStep},
+		XOR:    {execute: opXor, constantGas: GasFastestStep},
+		NOT:    {execute: opNot, constantGas: GasFastestStep},
+		BYTE:   {execute: opByte, constantGas: GasFastestStep},
+		SHL:    {execute: opSHL, constantGas: GasFastestStep},
+		SHR:    {execute: opSHR, constantGas: GasFastestStep},
+		SAR:    {execute: opSAR, constantGas: GasFastestStep},
+
+		KECCAK256: {execute: opKeccak256, constantGas: Keccak256Gas, dynamicGas: gasKeccak256, memorySize: memoryKeccak256},
+
+		ADDRESS:        {execute: opAddress, constantGas: GasQuickStep},
+		BALANCE:        {execute: opBalance, constantGas: WarmStorageReadCost, dynamicGas: gasAccountAccess},
+		ORIGIN:         {execute: opOrigin, constantGas: GasQuickStep},
+		CALLER:         {execute: opCaller, constantGas: GasQuickStep},
+		CALLVALUE:      {execute: opCallValue, constantGas: GasQuickStep},
+		CALLDATALOAD:   {execute: opCallDataLoad, constantGas: GasFastestStep},
+		CALLDATASIZE:   {execute: opCallDataSize, constantGas: GasQuickStep},
+		CALLDATACOPY:   {execute: opCallDataCopy, constantGas: GasFastestStep, dynamicGas: gasCallDataCopy, memorySize: memoryCallDataCopy},
+		CODESIZE:       {execute: opCodeSize, constantGas: GasQuickStep},
+		CODECOPY:       {execute: opCodeCopy, constantGas: GasFastestStep, dynamicGas: gasCodeCopy, memorySize: memoryCodeCopy},
+		GASPRICE:       {execute: opGasprice, constantGas: GasQuickStep},
+		EXTCODESIZE:    {execute: opExtCodeSize, constantGas: WarmStorageReadCost, dynamicGas: gasAccountAccess},
+		EXTCODECOPY:    {execute: opExtCodeCopy, constantGas: WarmStorageReadCost, dynamicGas: gasExtCodeCopy, memorySize: memoryExtCodeCopy},
+		RETURNDATASIZE: {execute: opReturnDataSize, constantGas: GasQuickStep},
+		RETURNDATACOPY: {execute: opReturnDataCopy, constantGas: GasFastestStep, dynamicGas: gasReturnDataCopy, memorySize: memoryReturnDataCopy},
+		EXTCODEHASH:    {execute: opExtCodeHash, constantGas: WarmStorageReadCost, dynamicGas: gasAccountAccess},
+
+		BLOCKHASH:   {execute: opBlockhash, constantGas: GasExtStep},
+		COINBASE:    {execute: opCoinbase, constantGas: GasQuickStep},
+		TIMESTAMP:   {execute: opTimestamp, constantGas: GasQuickStep},
+		NUMBER:      {execute: opNumber, constantGas: GasQuickStep},
+		DIFFICULTY:  {execute: opDifficulty, constantGas: GasQuickStep},
+		GASLIMIT:    {execute: opGasLimit, constantGas: GasQuickStep},
+		CHAINID:     {execute: opChainID, constantGas: GasQuickStep},
+		SELFBALANCE: {execute: opSelfBalance, constantGas: GasFastStep},
+		BASEFEE:     {execute: opBaseFee, constantGas: GasQuickStep},
+
+		POP:      {execute: opPop, constantGas: GasQuickStep},
+		MLOAD:    {execute: opMload, constantGas: GasFastestStep, dynamicGas: pureMemoryGascost, memorySize: memoryMLoad},
+		MSTORE:   {execute: opMstore, constantGas: GasFastestStep, dynamicGas: pureMemoryGascost, memorySize: memoryMStore},
+		MSTORE8:  {execute: opMstore8, constantGas: GasFastestStep, dynamicGas: pureMemoryGascost, memorySize: memoryMStore8},
+		SLOAD:    {execute: opSload, dynamicGas: gasSLoad},
+		SSTORE:   {execute: opSstore, dynamicGas: gasSStore, writes: true},
+		JUMP:     {execute: opJump, constantGas: GasMidStep, jumps: true},
+		JUMPI:    {execute: opJumpi, constantGas: GasSlowStep, jumps: true},
+		PC:       {execute: opPc, constantGas: GasQuickStep},
+		MSIZE:    {execute: opMsize, constantGas: GasQuickStep},
+		GAS:      {execute: opGas, constantGas: GasQuickStep},
+		JUMPDEST: {execute: opJumpdest, constantGas: JumpdestGas},
+		TLOAD:    {execute: opTload, constantGas: TransientStorageGas},
+		TSTORE:   {execute: opTstore, constantGas: TransientStorageGas, writes: true},
+		MCOPY:    {execute: opMcopy, constantGas: GasFastestStep, dynamicGas: gasMCopy, memorySize: memoryMCopy},
+		PUSH0:    {execute: opPush0, constantGas: GasQuickStep},
+
+		LOG0: {execute: makeLog(0), dynamicGas: makeGasLog(0), memorySize: memoryLog, writes: true},
+		LOG1: {execute: makeLog(1), dynamicGas: makeGasLog(1), memorySize: memoryLog, writes: true},
+		LOG2: {execute: makeLog(2), dynamicGas: makeGasLog(2), memorySize: memoryLog, writes: true},
+		LOG3: {execute: makeLog(3), dynamicGas: makeGasLog(3), memorySize: memoryLog, writes: true},
+		LOG4: {execute: makeLog(4), dynamicGas: makeGasLog(4), memorySize: memoryLog, writes: true},
+
+		CREATE:       {execute: opCreate, constantGas: CreateGas, dynamicGas: gasCreate, memorySize: memoryCreate, writes: true},
+		CALL:         {execute: opCall, constantGas: WarmStorageReadCost, dynamicGas: gasCall, memorySize: memoryCall},
+		CALLCODE:     {execute: opCallCode, constantGas: WarmStorageReadCost, dynamicGas: gasCallCode, memorySize: memoryCall},
+		RETURN:       {execute: opReturn, dynamicGas: pureMemoryGascost, memorySize: memoryReturn, halts: true},
+		DELEGATECALL: {execute: opDelegateCall, constantGas: WarmStorageReadCost, dynamicGas: gasDelegateCall, memorySize: memoryDelegateCall},
+		CREATE2:      {execute: opCreate2, constantGas: CreateGas, dynamicGas: gasCreate2, memorySize: memoryCreate, writes: true},
+		STATICCALL:   {execute: opStaticCall, constantGas: WarmStorageReadCost, dynamicGas: gasStaticCall, memorySize: memoryDelegateCall},
+		REVERT:       {execute: opRevert, dynamicGas: pureMemoryGascost, memorySize: memoryReturn, reverts: true},
+		SELFDESTRUCT: {execute: opSelfdestruct, constantGas: SelfdestructGas, dynamicGas: gasSelfdestruct, halts: true, writes: true},
+	}
+
+	for i := 0; i < 32; i++ {
+		tbl[PUSH1+OpCode(i)] = &operation{execute: makePush(uint64(i + 1)), constantGas: GasFastestStep}
+	}
+	for i := 0; i < 16; i++ {
+		tbl[DUP1+OpCode(i)] = &operation{execute: makeDup(i + 1), constantGas: GasFastestStep}
+		tbl[SWAP1+OpCode(i)] = &operation{execute: makeSwap(i + 1), constantGas: GasFastestStep}
+	}
+
+	// Stack requirements, as (pops, pushes)
+	stackIO := map[OpCode][2]int{
+		ADD: {2, 1}, MUL: {2, 1}, SUB: {2, 1}, DIV: {2, 1}, SDIV: {2, 1}, MOD: {2, 1},
+		SMOD: {2, 1}, ADDMOD: {3, 1}, MULMOD: {3, 1}, EXP: {2, 1}, SIGNEXTEND: {2, 1},
+		LT: {2, 1}, GT: {2, 1}, SLT: {2, 1}, SGT: {2, 1}, EQ: {2, 1}, ISZERO: {1, 1},
+		AND: {2, 1}, OR: {2, 1}, XOR: {2, 1}, NOT: {1, 1}, BYTE: {2, 1}, SHL: {2, 1},
+		SHR: {2, 1}, SAR: {2, 1}, KECCAK256: {2, 1},
+		ADDRESS: {0, 1}, BALANCE: {1, 1}, ORIGIN: {0, 1}, CALLER: {0, 1}, CALLVALUE: {0, 1},
+		CALLDATALOAD: {1, 1}, CALLDATASIZE: {0, 1}, CALLDATACOPY: {3, 0}, CODESIZE: {0, 1},
+		CODECOPY: {3, 0}, GASPRICE: {0, 1}, EXTCODESIZE: {1, 1}, EXTCODECOPY: {4, 0},
+		RETURNDATASIZE: {0, 1}, RETURNDATACOPY: {3, 0}, EXTCODEHASH: {1, 1},
+		BLOCKHASH: {1, 1}, COINBASE: {0, 1}, TIMESTAMP: {0, 1}, NUMBER: {0, 1},
+		DIFFICULTY: {0, 1}, GASLIMIT: {0, 1}, CHAINID: {0, 1}, SELFBALANCE: {0, 1}, BASEFEE: {0, 1},
+		POP: {1, 0}, MLOAD: {1, 1}, MSTORE: {2, 0}, MSTORE8: {2, 0}, SLOAD: {1, 1},
+		SSTORE: {2, 0}, JUMP: {1, 0}, JUMPI: {2, 0}, PC: {0, 1}, MSIZE: {0, 1}, GAS: {0, 1},
+		TLOAD: {1, 1}, TSTORE: {2, 0}, MCOPY: {3, 0}, PUSH0: {0, 1},
+		LOG0: {2, 0}, LOG1: {3, 0}, LOG2: {4, 0}, LOG3: {5, 0}, LOG4: {6, 0},
+		CREATE: {3, 1}, CALL: {7, 1}, CALLCODE: {7, 1}, RETURN: {2, 0}, DELEGATECALL: {6, 1},
+		CREATE2: {4, 1}, STATICCALL: {6, 1}, REVERT: {2, 0}, SELFDESTRUCT: {1, 0},
+	}
+	for op := 0; op < 256; op++ {
+		entry := tbl[op]
+		if entry == nil {
+			tbl[op] = &operation{execute: opUndefined, maxStack: StackLimit, halts: true}
+			continue
+		}
+		pops, push := 0, 0
+		switch {
+		case OpCode(op).IsPush():
+			push = 1
+		case OpCode(op) >= DUP1 && OpCode(op) <= DUP16:
+			pops, push = op-int(DUP1)+1, op-int(DUP1)+2
+		case OpCode(op) >= SWAP1 && OpCode(op) <= SWAP16:
+			pops, push = op-int(SWAP1)+2, op-int(SWAP1)+2
+		default:
+			io := stackIO[OpCode(op)]
+			pops, push = io[0], io[1]
+		}
+		entry.minStack = pops
+		entry.maxStack = StackLimit + pops - push
+	}
+	return tbl
+}
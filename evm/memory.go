@@ -0,0 +1,72 @@
+package evm
+
+import (
+	"math/big"
+)
+
+// Memory is the byte addressable, word aligned memory of a call frame
+type Memory struct {
+	store       []byte
+	lastGasCost uint64
+}
+
+// newMemory creates an empty memory
+func newMemory() *Memory {
+	return &Memory{}
+}
+
+// set copies value into memory at offset, at most size bytes are written.
+// The memory must have been resized beforehand.
+func (m *Memory) set(offset, size uint64, value []byte) {
+	if size == 0 {
+		return
+	}
+	copy(m.store[offset:offset+size], value)
+}
+
+// set32 writes a 32 byte big endian word at offset
+func (m *Memory) set32(offset uint64, value *big.Int) {
+	word := m.store[offset : offset+32]
+	for i := range word {
+		word[i] = 0
+	}
+	value.FillBytes(word)
+}
+
+// resize grows the memory to size bytes
+func (m *Memory) resize(size uint64) {
+	if uint64(len(m.store)) < size {
+		m.store = append(m.store, make([]byte, size-uint64(len(m.store)))...)
+	}
+}
+
+// getCopy returns a copy of size bytes at offset
+func (m *Memory) getCopy(offset, size int64) []byte {
+	if size == 0 {
+		return nil
+	}
+	cpy := make([]byte, size)
+	copy(cpy, m.store[offset:offset+size])
+	return cpy
+}
+
+// getPtr returns a slice of memory without copying
+func (m *Memory) getPtr(offset, size int64) []byte {
+	if size == 0 {
+		return nil
+	}
+	return m.store[offset : offset+size]
+}
+
+// copyWithin moves size bytes from src to dst, the regions may overlap
+func (m *Memory) copyWithin(dst, src, size uint64) {
+	if size == 0 {
+		return
+	}
+	copy(m.store[dst:], m.store[src:src+size])
+}
+
+// len returns the current size of the memory
+func (m *Memory) len() int {
+	return len(m.store)
+}
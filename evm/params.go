@@ -0,0 +1,51 @@
+package evm
+
+// Gas costs and limits of the virtual machine (Cancun rules, without blob
+// transactions)
+const (
+	GasQuickStep   uint64 = 2
+	GasFastestStep uint64 = 3
+	GasFastStep    uint64 = 5
+	GasMidStep     uint64 = 8
+	GasSlowStep    uint64 = 10
+	GasExtStep     uint64 = 20
+
+	Keccak256Gas     uint64 = 30 // Once per KECCAK256 operation
+	Keccak256WordGas uint64 = 6  // Once per word of the KECCAK256 operation's data
+	CopyGas          uint64 = 3  // Per word of data copied
+	ExpGas           uint64 = 10 // Once per EXP instruction
+	ExpByteGas       uint64 = 50 // Per byte of the EXP exponent
+	MemoryGas        uint64 = 3  // Per word of memory, the quadratic part is words^2/QuadCoeffDiv
+	QuadCoeffDiv     uint64 = 512
+	JumpdestGas      uint64 = 1
+
+	LogGas      uint64 = 375 // Per LOG* operation
+	LogTopicGas uint64 = 375 // Per LOG topic
+	LogDataGas  uint64 = 8   // Per byte in a LOG* operation's data
+
+	CreateGas       uint64 = 32000 // Once per CREATE and CREATE2 operation
+	CreateDataGas   uint64 = 200   // Per byte of deployed code
+	InitCodeWordGas uint64 = 2     // Per word of init code (EIP-3860)
+
+	CallValueTransferGas    uint64 = 9000  // Paid for CALL when the value transfer is non-zero
+	CallNewAccountGas       uint64 = 25000 // Paid for CALL when the destination address didn't exist prior
+	CallStipend             uint64 = 2300  // Free gas given at beginning of call
+	SelfdestructGas         uint64 = 5000
+	CreateBySelfdestructGas uint64 = 25000
+
+	WarmStorageReadCost   uint64 = 100  // EIP-2929
+	ColdSloadCost         uint64 = 2100 // EIP-2929
+	ColdAccountAccessCost uint64 = 2600 // EIP-2929
+
+	SstoreSetGas       uint64 = 20000                                 // Once per SSTORE operation from clean zero to non-zero
+	SstoreResetGas     uint64 = 5000                                  // Once per SSTORE operation from clean non-zero to something else
+	SstoreSentryGas    uint64 = 2300                                  // Minimum gas required for SSTORE (EIP-2200)
+	SstoreClearsRefund uint64 = SstoreResetGas - ColdSloadCost + 1900 // EIP-3529
+
+	TransientStorageGas uint64 = 100 // TLOAD and TSTORE (EIP-1153)
+
+	MaxCodeSize     = 24576           // Maximum bytecode to permit for a contract
+	MaxInitCodeSize = 2 * MaxCodeSize // Maximum init code to permit in a creation
+	CallCreateDepth = 1024            // Maximum depth of call/create stack
+	StackLimit      = 1024            // Maximum size of the stack
+)
@@ -0,0 +1,54 @@
+package evm
+
+import (
+	"math/big"
+)
+
+// Stack is the EVM operand stack. All values are kept in the range
+// [0, 2^256).
+type Stack struct {
+	data []*big.Int
+}
+
+// newStack creates an empty stack
+func newStack() *Stack {
+	return &Stack{data: make([]*big.Int, 0, 16)}
+}
+
+// push places a value on top of the stack
+func (st *Stack) push(value *big.Int) {
+	st.data = append(st.data, value)
+}
+
+// pop removes and returns the top value
+func (st *Stack) pop() *big.Int {
+	value := st.data[len(st.data)-1]
+	st.data = st.data[:len(st.data)-1]
+	return value
+}
+
+// peek returns the top value without removing it
+func (st *Stack) peek() *big.Int {
+	return st.data[len(st.data)-1]
+}
+
+// back returns the n'th value from the top, back(0) is the top
+func (st *Stack) back(n int) *big.Int {
+	return st.data[len(st.data)-n-1]
+}
+
+// dup pushes a copy of the n'th value from the top, dup(1) copies the top
+func (st *Stack) dup(n int) {
+	st.push(new(big.Int).Set(st.data[len(st.data)-n]))
+}
+
+// swap exchanges the top value with the n'th value below it
+func (st *Stack) swap(n int) {
+	top := len(st.data) - 1
+	st.data[top], st.data[top-n] = st.data[top-n], st.data[top]
+}
+
+// len returns the number of values on the stack
+func (st *Stack) len() int {
+	return len(st.data)
+}
@@ -20,11 +20,12 @@ func NewStateDBAdapter(stateDB *core.StateDB) *StateDBAdapter {
 	}
 }
 
-// CreateAccount creates a new account
+// CreateAccount creates a new account, a balance sent to the address
+// beforehand is kept
 func (s *StateDBAdapter) CreateAccount(addr crypto.Address) {
 	account := &core.Account{
 		Nonce:   0,
-		Balance: big.NewInt(0),
+		Balance: new(big.Int).Set(s.stateDB.GetBalance(addr)),
 	}
 	s.stateDB.SetAccount(addr, account)
 }
@@ -48,6 +49,12 @@ func (s *StateDBAdapter) GetBalance(addr crypto.Address) *big.Int {
 	return s.stateDB.GetBalance(addr)
 }
 
+// GetSpendableBalance returns the account balance without the block
+// rewards that are not mature yet
+func (s *StateDBAdapter) GetSpendableBalance(addr crypto.Address) *big.Int {
+	return core.SpendableBalance(s.stateDB, addr)
+}
+
 // GetNonce returns the account nonce
 func (s *StateDBAdapter) GetNonce(addr crypto.Address) uint64 {
 	return s.stateDB.GetNonce(addr)
@@ -84,23 +91,22 @@ func (s *StateDBAdapter) GetCodeSize(addr crypto.Address) int {
 
 // AddRefund adds to the refund counter
 func (s *StateDBAdapter) AddRefund(gas uint64) {
-	// Not implemented in our simple version
+	s.stateDB.AddRefund(gas)
 }
 
 // SubRefund subtracts from the refund counter
 func (s *StateDBAdapter) SubRefund(gas uint64) {
-	// Not implemented in our simple version
+	s.stateDB.SubRefund(gas)
 }
 
 // GetRefund returns the current refund counter
 func (s *StateDBAdapter) GetRefund() uint64 {
-	// Not implemented in our simple version
-	return 0
+	return s.stateDB.GetRefund()
 }
 
-// GetCommittedState returns the committed state value
+// GetCommittedState returns the state value at the start of the transaction
 func (s *StateDBAdapter) GetCommittedState(addr crypto.Address, key crypto.Hash) crypto.Hash {
-	return s.stateDB.GetStorage(addr, key)
+	return s.stateDB.GetCommittedStorage(addr, key)
 }
 
 // GetState returns the current state value
@@ -113,17 +119,36 @@ func (s *StateDBAdapter) SetState(addr crypto.Address, key, value crypto.Hash) {
 	s.stateDB.SetStorage(addr, key, value)
 }
 
+// GetTransientState returns a transient storage value (EIP-1153)
+func (s *StateDBAdapter) GetTransientState(addr crypto.Address, key crypto.Hash) crypto.Hash {
+	return s.stateDB.GetTransientState(addr, key)
+}
+
+// SetTransientState sets a transient storage value (EIP-1153)
+func (s *StateDBAdapter) SetTransientState(addr crypto.Address, key, value crypto.Hash) {
+	s.stateDB.SetTransientState(addr, key, value)
+}
+
 // Suicide marks an account for deletion
 func (s *StateDBAdapter) Suicide(addr crypto.Address) bool {
-	// Simple implementation: just zero the balance
-	s.stateDB.SetBalance(addr, big.NewInt(0))
-	return true
+	return s.stateDB.Suicide(addr)
 }
 
 // HasSuicided returns whether an account has been marked for deletion
 func (s *StateDBAdapter) HasSuicided(addr crypto.Address) bool {
-	// Simple implementation: check if balance is zero
-	return s.stateDB.GetBalance(addr).Sign() == 0
+	return s.stateDB.HasSuicided(addr)
+}
+
+// CreateContract records that a contract is deployed at addr in the
+// current transaction
+func (s *StateDBAdapter) CreateContract(addr crypto.Address) {
+	s.stateDB.CreateContract(addr)
+}
+
+// IsNewContract returns whether the contract at addr was deployed in the
+// current transaction
+func (s *StateDBAdapter) IsNewContract(addr crypto.Address) bool {
+	return s.stateDB.IsNewContract(addr)
 }
 
 // Exist checks if an account exists
@@ -138,13 +163,32 @@ func (s *StateDBAdapter) Empty(addr crypto.Address) bool {
 
 // RevertToSnapshot reverts state to a snapshot
 func (s *StateDBAdapter) RevertToSnapshot(id int) {
-	// Not implemented in our simple version
+	s.stateDB.RevertToSnapshot(id)
 }
 
 // Snapshot creates a state snapshot
 func (s *StateDBAdapter) Snapshot() int {
-	// Not implemented in our simple version
-	return 0
+	return s.stateDB.Snapshot()
+}
+
+// AddressInAccessList checks whether an address is warm (EIP-2929)
+func (s *StateDBAdapter) AddressInAccessList(addr crypto.Address) bool {
+	return s.stateDB.AddressInAccessList(addr)
+}
+
+// SlotInAccessList checks whether an address and a storage slot are warm
+func (s *StateDBAdapter) SlotInAccessList(addr crypto.Address, slot crypto.Hash) (addressOk bool, slotOk bool) {
+	return s.stateDB.SlotInAccessList(addr, slot)
+}
+
+// AddAddressToAccessList marks an address as warm
+func (s *StateDBAdapter) AddAddressToAccessList(addr crypto.Address) {
+	s.stateDB.AddAddressToAccessList(addr)
+}
+
+// AddSlotToAccessList marks an address and a storage slot as warm
+func (s *StateDBAdapter) AddSlotToAccessList(addr crypto.Address, slot crypto.Hash) {
+	s.stateDB.AddSlotToAccessList(addr, slot)
 }
 
 // AddLog adds a log entry
@@ -152,13 +196,12 @@ func (s *StateDBAdapter) AddLog(log *core.Log) {
 	s.stateDB.AddLog(log)
 }
 
-// AddPreimage adds a preimage to the cache
+// AddPreimage records the preimage of a hash if the state records them
 func (s *StateDBAdapter) AddPreimage(hash crypto.Hash, preimage []byte) {
-	// Not implemented in our simple version
+	s.stateDB.AddPreimage(hash, preimage)
 }
 
-// ForEachStorage iterates over storage entries
+// ForEachStorage iterates over the non-zero storage slots of an account
 func (s *StateDBAdapter) ForEachStorage(addr crypto.Address, cb func(key, value crypto.Hash) bool) error {
-	// Not implemented in our simple version
-	return nil
+	return s.stateDB.ForEachStorage(addr, cb)
 }
@@ -0,0 +1,224 @@
+package gasprice
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+	"blockchain-node/logger"
+	"blockchain-node/mempool"
+)
+
+// sampleNumber is the number of cheapest transactions sampled per block
+const sampleNumber = 3
+
+var (
+	DefaultMaxPrice    = big.NewInt(500000000000) // 500 Gwei
+	DefaultIgnorePrice = big.NewInt(2)            // 2 wei
+	DefaultTip         = big.NewInt(1000000000)   // 1 Gwei
+)
+
+// Config holds the gas price oracle configuration
+type Config struct {
+	Blocks      int      // Number of recent blocks sampled
+	Percentile  int      // Percentile of the sampled tips that is suggested
+	Default     *big.Int // Tip suggested before any transaction has been sampled
+	MinPrice    *big.Int // Lowest gas price suggested, the mempool minimum
+	MaxPrice    *big.Int // Highest tip suggested
+	IgnorePrice *big.Int // Tips below this price are not sampled
+}
+
+// DefaultConfig returns the default oracle configuration
+func DefaultConfig() Config {
+	return Config{
+		Blocks:      20,
+		Percentile:  60,
+		Default:     DefaultTip,
+		MaxPrice:    DefaultMaxPrice,
+		IgnorePrice: DefaultIgnorePrice,
+	}
+}
+
+// Oracle suggests gas prices from the tips paid in recent blocks and the
+// congestion of the mempool
+type Oracle struct {
+	chain  *core.Blockchain
+	pool   *mempool.Mempool
+	config Config
+	logger *logger.Logger
+
+	mu       sync.Mutex
+	lastHead crypto.Hash
+	lastTip  *big.Int
+}
+
+// NewOracle creates a gas price oracle, invalid settings fall back to the defaults
+func NewOracle(chain *core.Blockchain, pool *mempool.Mempool, config Config) *Oracle {
+	log := logger.NewLogger("gasprice")
+	defaults := DefaultConfig()
+
+	if config.Blocks < 1 {
+		log.Warning("Sanitizing invalid gasprice oracle sample blocks", "provided", config.Blocks, "updated", defaults.Blocks)
+		config.Blocks = defaults.Blocks
+	}
+	if config.Percentile < 0 || config.Percentile > 100 {
+		log.Warning("Sanitizing invalid gasprice oracle percentile", "provided", config.Percentile, "updated", defaults.Percentile)
+		config.Percentile = defaults.Percentile
+	}
+	if config.Default == nil || config.Default.Sign() <= 0 {
+		config.Default = defaults.Default
+	}
+	if config.MaxPrice == nil || config.MaxPrice.Sign() <= 0 {
+		config.MaxPrice = defaults.MaxPrice
+	}
+	if config.IgnorePrice == nil || config.IgnorePrice.Sign() < 0 {
+		config.IgnorePrice = defaults.IgnorePrice
+	}
+	if config.MinPrice == nil {
+		config.MinPrice = new(big.Int)
+	}
+
+	return &Oracle{
+		chain:   chain,
+		pool:    pool,
+		config:  config,
+		logger:  log,
+		lastTip: new(big.Int).Set(config.Default),
+	}
+}
+
+// SuggestTipCap returns a priority fee that should get a transaction
+// included in one of the next blocks
+func (o *Oracle) SuggestTipCap() *big.Int {
+	head := o.chain.GetCurrentBlock()
+	if head == nil {
+		return new(big.Int).Set(o.config.Default)
+	}
+
+	tip := o.blockTip(head)
+	if poolTip := o.poolTip(head.Header); poolTip != nil && poolTip.Cmp(tip) > 0 {
+		tip = poolTip
+	}
+	if tip.Cmp(o.config.MaxPrice) > 0 {
+		tip = new(big.Int).Set(o.config.MaxPrice)
+	}
+	return tip
+}
+
+// SuggestGasPrice returns a legacy gas price, the suggested tip on top of
+// the base fee of the next block
+func (o *Oracle) SuggestGasPrice() *big.Int {
+	price := o.SuggestTipCap()
+	if head := o.chain.GetCurrentBlock(); head != nil {
+		price.Add(price, core.CalcBaseFee(head.Header))
+	}
+	if price.Cmp(o.config.MinPrice) < 0 {
+		price.Set(o.config.MinPrice)
+	}
+	return price
+}
+
+// blockTip returns the configured percentile of the tips sampled from the
+// recent blocks. The result is cached until the head changes.
+func (o *Oracle) blockTip(head *core.Block) *big.Int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if head.Hash == o.lastHead {
+		return new(big.Int).Set(o.lastTip)
+	}
+
+	var tips []*big.Int
+	number := new(big.Int).Set(head.Header.Number)
+	for i := 0; i < o.config.Blocks && number.Sign() >= 0; i++ {
+		block, err := o.chain.GetBlockByNumber(number)
+		if err != nil {
+			o.logger.Debug("Failed to sample block", "number", number, "error", err)
+			break
+		}
+		tips = append(tips, o.sampleBlock(block)...)
+		number.Sub(number, big.NewInt(1))
+	}
+
+	// Keep the previous suggestion while the recent blocks are empty
+	if len(tips) > 0 {
+		sortTips(tips)
+		o.lastTip = tips[(len(tips)-1)*o.config.Percentile/100]
+	}
+	o.lastHead = head.Hash
+	return new(big.Int).Set(o.lastTip)
+}
+
+// sampleBlock returns the cheapest tips paid in a block, ignoring
+// transactions sent by the block producer
+func (o *Oracle) sampleBlock(block *core.Block) []*big.Int {
+	baseFee := block.Header.BaseFee
+
+	var tips []*big.Int
+	for _, tx := range block.Transactions {
+		if tx.From == block.Header.Coinbase {
+			continue
+		}
+		tip := core.EffectiveTip(tx.EffectiveGasPrice(baseFee), baseFee)
+		if tip.Cmp(o.config.IgnorePrice) < 0 {
+			continue
+		}
+		tips = append(tips, tip)
+	}
+
+	sortTips(tips)
+	if len(tips) > sampleNumber {
+		tips = tips[:sampleNumber]
+	}
+	return tips
+}
+
+// poolTip returns the tip needed to outbid the pending transactions that
+// fill the next block, nil if they all fit in it
+func (o *Oracle) poolTip(head *core.BlockHeader) *big.Int {
+	if o.pool == nil {
+		return nil
+	}
+	pending := o.pool.GetPendingTransactions()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	baseFee := core.CalcBaseFee(head)
+	type pendingTip struct {
+		tip *big.Int
+		gas uint64
+	}
+	offers := make([]pendingTip, 0, len(pending))
+	for _, tx := range pending {
+		// Transactions below the next base fee can not be included yet
+		if tx.FeeCap().Cmp(baseFee) < 0 {
+			continue
+		}
+		offers = append(offers, pendingTip{
+			tip: core.EffectiveTip(tx.EffectiveGasPrice(baseFee), baseFee),
+			gas: tx.GasLimit,
+		})
+	}
+	sort.Slice(offers, func(i, j int) bool {
+		return offers[i].tip.Cmp(offers[j].tip) > 0
+	})
+
+	var gas uint64
+	for _, offer := range offers {
+		gas += offer.gas
+		if gas >= head.GasLimit {
+			return new(big.Int).Add(offer.tip, big.NewInt(1))
+		}
+	}
+	return nil
+}
+
+// sortTips sorts tips in ascending order
+func sortTips(tips []*big.Int) {
+	sort.Slice(tips, func(i, j int) bool {
+		return tips[i].Cmp(tips[j]) < 0
+	})
+}
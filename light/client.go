@@ -0,0 +1,214 @@
+package light
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+	"blockchain-node/logger"
+	"blockchain-node/p2p"
+)
+
+const (
+	// requestTimeout is how long a peer has to answer a request
+	requestTimeout = 5 * time.Second
+
+	// syncInterval is how often the header chain is synced with the peers
+	syncInterval = 10 * time.Second
+
+	// reorgDepth is how far below the head headers are requested again, so
+	// that reorganizations of the servers are followed
+	reorgDepth = 32
+
+	// maxProofPeers is the number of peers asked for an account proof
+	// before giving up
+	maxProofPeers = 3
+)
+
+// Client keeps the header chain of a light node in sync with the peers
+// serving light nodes and reads accounts through proofs against it
+type Client struct {
+	chain  *HeaderChain
+	p2p    *p2p.Server
+	logger *logger.Logger
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan []byte // response payloads by request ID
+}
+
+// NewClient registers the light protocol response handlers with the p2p
+// server
+func NewClient(chain *HeaderChain, p2pServer *p2p.Server) *Client {
+	c := &Client{
+		chain:   chain,
+		p2p:     p2pServer,
+		logger:  logger.NewLogger("light"),
+		pending: make(map[uint64]chan []byte),
+	}
+	p2pServer.RegisterMessageHandler(p2p.MessageTypeHeaders, c.handleResponse)
+	p2pServer.RegisterMessageHandler(p2p.MessageTypeProof, c.handleResponse)
+	return c
+}
+
+// Chain returns the header chain
+func (c *Client) Chain() *HeaderChain {
+	return c.chain
+}
+
+// CurrentHeader returns the head of the header chain
+func (c *Client) CurrentHeader() *core.BlockHeader {
+	return c.chain.CurrentHeader()
+}
+
+// Run syncs the header chain with the peers until ctx is done
+func (c *Client) Run(ctx context.Context) {
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		c.Sync()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync fetches the headers the connected peers have beyond the local head
+func (c *Client) Sync() {
+	before := c.chain.CurrentHeader().Number.Uint64()
+	for _, peer := range c.p2p.GetPeers() {
+		if err := c.syncPeer(peer.ID); err != nil {
+			c.logger.Debug("Failed to sync headers", "peerID", peer.ID, "error", err)
+		}
+	}
+	if head := c.chain.CurrentHeader(); head.Number.Uint64() != before {
+		c.logger.Info("Synced headers", "number", head.Number, "hash", headerHash(head).Hex())
+	}
+}
+
+// syncPeer requests headers from peer until it has no more
+func (c *Client) syncPeer(peerID string) error {
+	for {
+		from := uint64(1)
+		if head := c.chain.CurrentHeader().Number.Uint64(); head > reorgDepth {
+			from = head - reorgDepth
+		}
+		var resp headersResponse
+		if err := c.request(peerID, p2p.MessageTypeGetHeaders, &getHeadersRequest{From: from, Amount: MaxHeaders}, &resp); err != nil {
+			return err
+		}
+		inserted, err := c.chain.InsertHeaders(resp.Headers)
+		if err != nil {
+			return err
+		}
+		if inserted == 0 || len(resp.Headers) < MaxHeaders {
+			return nil
+		}
+	}
+}
+
+// GetAccount returns an account in the head state of a peer, verified
+// against the header chain
+func (c *Client) GetAccount(addr crypto.Address) (*core.Account, error) {
+	peers := c.p2p.GetPeers()
+	if len(peers) > maxProofPeers {
+		peers = peers[:maxProofPeers]
+	}
+	for _, peer := range peers {
+		var resp proofResponse
+		if err := c.request(peer.ID, p2p.MessageTypeGetProof, &getProofRequest{Address: addr}, &resp); err != nil {
+			c.logger.Debug("Failed to request proof", "peerID", peer.ID, "error", err)
+			continue
+		}
+		if resp.Error != "" || resp.Header == nil {
+			c.logger.Debug("Peer failed to prove account", "peerID", peer.ID, "error", resp.Error)
+			continue
+		}
+
+		// A server ahead of the local head proves against a header the
+		// client first has to sync
+		hash := headerHash(resp.Header)
+		if !c.chain.IsCanonical(hash) {
+			if err := c.syncPeer(peer.ID); err != nil || !c.chain.IsCanonical(hash) {
+				c.logger.Debug("Proof is not for a canonical header", "peerID", peer.ID, "hash", hash.Hex())
+				continue
+			}
+		}
+		account, err := core.VerifyAccountProof(c.chain.GetHeader(hash).StateRoot, addr, resp.Proof)
+		if err != nil {
+			c.logger.Warning("Peer sent an invalid proof", "peerID", peer.ID, "error", err)
+			continue
+		}
+		return account, nil
+	}
+	return nil, ErrNoPeers
+}
+
+// request sends req to a peer and decodes its response into resp. The ID of
+// req is set to a new request ID.
+func (c *Client) request(peerID string, messageType p2p.MessageType, req interface{}, resp interface{}) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	ch := make(chan []byte, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	switch req := req.(type) {
+	case *getHeadersRequest:
+		req.ID = id
+	case *getProofRequest:
+		req.ID = id
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if err := c.p2p.SendToPeer(peerID, messageType, payload); err != nil {
+		return err
+	}
+
+	select {
+	case data := <-ch:
+		if err := json.Unmarshal(data, resp); err != nil {
+			return fmt.Errorf("invalid response: %v", err)
+		}
+		return nil
+	case <-time.After(requestTimeout):
+		return fmt.Errorf("request %d timed out", id)
+	}
+}
+
+// handleResponse hands a response to the request waiting for it
+func (c *Client) handleResponse(peer *p2p.Peer, message *p2p.Message) error {
+	var resp struct {
+		ID uint64 `json:"id"`
+	}
+	if err := json.Unmarshal(message.Payload, &resp); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	c.mu.Lock()
+	ch := c.pending[resp.ID]
+	c.mu.Unlock()
+	if ch == nil {
+		c.logger.Debug("Dropping unrequested response", "peerID", peer.ID, "type", message.Type, "id", resp.ID)
+		return nil
+	}
+	select {
+	case ch <- message.Payload:
+	default:
+	}
+	return nil
+}
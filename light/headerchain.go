@@ -0,0 +1,150 @@
+package light
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+)
+
+// HeaderChain is the verified header chain of a light node, kept in memory.
+// It implements core.ChainReader for the consensus engine; block bodies are
+// never downloaded, so GetBlock always returns nil.
+type HeaderChain struct {
+	config *core.ChainConfig
+	engine core.ConsensusEngine
+
+	insertMu  sync.Mutex // serializes InsertHeaders
+	mu        sync.RWMutex
+	headers   map[crypto.Hash]*core.BlockHeader
+	td        map[crypto.Hash]*big.Int // total difficulty of each header
+	canonical []crypto.Hash            // canonical hashes by number
+}
+
+// NewHeaderChain returns a header chain holding only the genesis header
+func NewHeaderChain(config *core.ChainConfig, genesis *core.BlockHeader, engine core.ConsensusEngine) *HeaderChain {
+	hash := headerHash(genesis)
+	return &HeaderChain{
+		config:    config,
+		engine:    engine,
+		headers:   map[crypto.Hash]*core.BlockHeader{hash: genesis},
+		td:        map[crypto.Hash]*big.Int{hash: core.BlockWork(genesis)},
+		canonical: []crypto.Hash{hash},
+	}
+}
+
+// Config returns the chain configuration
+func (hc *HeaderChain) Config() *core.ChainConfig {
+	return hc.config
+}
+
+// CurrentHeader returns the head of the canonical header chain
+func (hc *HeaderChain) CurrentHeader() *core.BlockHeader {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	return hc.headers[hc.canonical[len(hc.canonical)-1]]
+}
+
+// GetHeader retrieves a header by hash, nil if unknown
+func (hc *HeaderChain) GetHeader(hash crypto.Hash) *core.BlockHeader {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	return hc.headers[hash]
+}
+
+// GetHeaderByNumber retrieves a canonical header by number, nil if unknown
+func (hc *HeaderChain) GetHeaderByNumber(number uint64) *core.BlockHeader {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	if number >= uint64(len(hc.canonical)) {
+		return nil
+	}
+	return hc.headers[hc.canonical[number]]
+}
+
+// GetBlock returns nil, a light node has no block bodies
+func (hc *HeaderChain) GetBlock(hash crypto.Hash) *core.Block {
+	return nil
+}
+
+// IsCanonical reports whether hash is the canonical header at its height
+func (hc *HeaderChain) IsCanonical(hash crypto.Hash) bool {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	header := hc.headers[hash]
+	if header == nil {
+		return false
+	}
+	number := header.Number.Uint64()
+	return number < uint64(len(hc.canonical)) && hc.canonical[number] == hash
+}
+
+// InsertHeaders verifies consecutive headers against the consensus rules and
+// the checkpoints of the chain and adds them. The head moves to the last
+// header if it has more total difficulty than the current head. It returns
+// the number of headers that were not known yet.
+func (hc *HeaderChain) InsertHeaders(headers []*core.BlockHeader) (int, error) {
+	hc.insertMu.Lock()
+	defer hc.insertMu.Unlock()
+
+	inserted := 0
+	var last crypto.Hash
+	for _, header := range headers {
+		if header == nil || header.Number == nil {
+			return inserted, fmt.Errorf("invalid header")
+		}
+		hash := headerHash(header)
+		last = hash
+		if hc.GetHeader(hash) != nil {
+			continue
+		}
+		number := header.Number.Uint64()
+		if checkpoint, ok := hc.config.Checkpoints[number]; ok && checkpoint != hash {
+			return inserted, fmt.Errorf("header %d: %w: have %s, want %s", number, core.ErrCheckpointMismatch, hash.Hex(), checkpoint.Hex())
+		}
+		if err := hc.engine.VerifyHeader(hc, header); err != nil {
+			return inserted, fmt.Errorf("header %d: %w", number, err)
+		}
+		if err := hc.engine.VerifySeal(hc, header); err != nil {
+			return inserted, fmt.Errorf("header %d: %w", number, err)
+		}
+
+		hc.mu.Lock()
+		hc.headers[hash] = header
+		hc.td[hash] = new(big.Int).Add(hc.td[header.PreviousHash], core.BlockWork(header))
+		hc.mu.Unlock()
+		inserted++
+	}
+	if inserted > 0 {
+		hc.setHead(last)
+	}
+	return inserted, nil
+}
+
+// setHead makes hash the head if it has more total difficulty than the
+// current head and rewrites the canonical hashes down to the common ancestor
+func (hc *HeaderChain) setHead(hash crypto.Hash) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	head := hc.canonical[len(hc.canonical)-1]
+	if hc.td[hash].Cmp(hc.td[head]) <= 0 {
+		return
+	}
+	header := hc.headers[hash]
+	number := header.Number.Uint64()
+	if number+1 < uint64(len(hc.canonical)) {
+		hc.canonical = hc.canonical[:number+1]
+	}
+	for uint64(len(hc.canonical)) <= number {
+		hc.canonical = append(hc.canonical, crypto.Hash{})
+	}
+	for hc.canonical[number] != hash {
+		hc.canonical[number] = hash
+		hash = header.PreviousHash
+		header = hc.headers[hash]
+		number--
+	}
+}
@@ -0,0 +1,57 @@
+// Package light implements the light protocol: full nodes serving light
+// nodes answer header and account proof requests, light nodes keep only the
+// verified header chain and read accounts through proofs against it.
+package light
+
+import (
+	"errors"
+
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+)
+
+// MaxHeaders is the number of headers served per request
+const MaxHeaders = 192
+
+var (
+	// ErrNoPeers is returned when no peer answered a request
+	ErrNoPeers = errors.New("no light server answered")
+
+	// ErrInvalidProof is returned for a proof that does not match the header
+	// chain of the light node
+	ErrInvalidProof = errors.New("invalid proof")
+)
+
+// getHeadersRequest asks for up to Amount canonical headers from block From
+type getHeadersRequest struct {
+	ID     uint64 `json:"id"`
+	From   uint64 `json:"from"`
+	Amount uint64 `json:"amount"`
+}
+
+// headersResponse answers a getHeadersRequest, the headers are consecutive
+type headersResponse struct {
+	ID      uint64              `json:"id"`
+	Headers []*core.BlockHeader `json:"headers"`
+}
+
+// getProofRequest asks for the proof of an account in the head state
+type getProofRequest struct {
+	ID      uint64         `json:"id"`
+	Address crypto.Address `json:"address"`
+}
+
+// proofResponse answers a getProofRequest with the proof and the head header
+// whose state root it proves against. Error is set if the server could not
+// create the proof.
+type proofResponse struct {
+	ID     uint64            `json:"id"`
+	Header *core.BlockHeader `json:"header,omitempty"`
+	Proof  [][]byte          `json:"proof,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// headerHash returns the block hash of a header
+func headerHash(header *core.BlockHeader) crypto.Hash {
+	return header.Hash()
+}
@@ -0,0 +1,79 @@
+package light
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"blockchain-node/core"
+	"blockchain-node/logger"
+	"blockchain-node/p2p"
+)
+
+// Server answers the requests of light nodes from the local chain
+type Server struct {
+	chain  *core.Blockchain
+	p2p    *p2p.Server
+	logger *logger.Logger
+}
+
+// NewServer registers the light protocol request handlers with the p2p server
+func NewServer(chain *core.Blockchain, p2pServer *p2p.Server) *Server {
+	s := &Server{
+		chain:  chain,
+		p2p:    p2pServer,
+		logger: logger.NewLogger("light"),
+	}
+	p2pServer.RegisterMessageHandler(p2p.MessageTypeGetHeaders, s.handleGetHeaders)
+	p2pServer.RegisterMessageHandler(p2p.MessageTypeGetProof, s.handleGetProof)
+	return s
+}
+
+// handleGetHeaders sends the requested canonical headers, as many as the
+// chain has up to MaxHeaders
+func (s *Server) handleGetHeaders(peer *p2p.Peer, message *p2p.Message) error {
+	var req getHeadersRequest
+	if err := json.Unmarshal(message.Payload, &req); err != nil {
+		return fmt.Errorf("invalid headers request: %v", err)
+	}
+	amount := req.Amount
+	if amount > MaxHeaders {
+		amount = MaxHeaders
+	}
+
+	resp := headersResponse{ID: req.ID, Headers: make([]*core.BlockHeader, 0, amount)}
+	for i := uint64(0); i < amount; i++ {
+		header := s.chain.GetHeaderByNumber(req.From + i)
+		if header == nil {
+			break
+		}
+		resp.Headers = append(resp.Headers, header)
+	}
+	s.logger.Debug("Serving headers", "peerID", peer.ID, "from", req.From, "count", len(resp.Headers))
+	return s.send(peer, p2p.MessageTypeHeaders, resp)
+}
+
+// handleGetProof sends the proof of an account in the head state
+func (s *Server) handleGetProof(peer *p2p.Peer, message *p2p.Message) error {
+	var req getProofRequest
+	if err := json.Unmarshal(message.Payload, &req); err != nil {
+		return fmt.Errorf("invalid proof request: %v", err)
+	}
+
+	resp := proofResponse{ID: req.ID}
+	header, proof, err := s.chain.GetHeadAccountProof(req.Address)
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Header, resp.Proof = header, proof
+	}
+	return s.send(peer, p2p.MessageTypeProof, resp)
+}
+
+// send encodes and sends a response to peer
+func (s *Server) send(peer *p2p.Peer, messageType p2p.MessageType, resp interface{}) error {
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return s.p2p.SendToPeer(peer.ID, messageType, payload)
+}
@@ -0,0 +1,113 @@
+package mempool
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrAdmissionPaused is returned for transactions submitted while admission
+// is paused
+var ErrAdmissionPaused = errors.New("mempool admission paused")
+
+// Evict removes a transaction on request of the node operator and reports
+// whether it was pooled. Later transactions of its sender are queued.
+func (mp *Mempool) Evict(hash common.Hash) bool {
+	defer mp.sendEvents()
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	tx, exists := mp.all[hash]
+	if !exists {
+		return false
+	}
+	mp.removeTx(tx)
+	mp.dropEvent(tx, DropAdmin)
+	mp.reorganize(tx.From)
+
+	mp.logger.Info("Transaction evicted by operator", "hash", hash.Hex(), "from", tx.From.Hex())
+	return true
+}
+
+// FlushSender removes all pooled transactions of a sender on request of the
+// node operator and returns how many there were
+func (mp *Mempool) FlushSender(from common.Address) int {
+	defer mp.sendEvents()
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	txs := mp.senderTxs(from)
+	for _, tx := range txs {
+		mp.removeTx(tx)
+		mp.dropEvent(tx, DropAdmin)
+	}
+
+	if len(txs) > 0 {
+		mp.logger.Info("Sender flushed by operator", "from", from.Hex(), "transactions", len(txs))
+	}
+	return len(txs)
+}
+
+// Pause stops admitting new transactions, AddTransaction and
+// AddLocalTransaction fail with ErrAdmissionPaused until Resume. Pooled
+// transactions stay minable and those of blocks removed by a reorg are
+// still added back.
+func (mp *Mempool) Pause() {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if !mp.paused {
+		mp.paused = true
+		mp.logger.Info("Mempool admission paused")
+	}
+}
+
+// Resume admits new transactions again after Pause
+func (mp *Mempool) Resume() {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if mp.paused {
+		mp.paused = false
+		mp.logger.Info("Mempool admission resumed")
+	}
+}
+
+// Paused reports whether admission of new transactions is paused
+func (mp *Mempool) Paused() bool {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	return mp.paused
+}
+
+// SetMinGasPrice changes the minimum gas price of remote transactions.
+// Pooled remote transactions below a raised minimum are dropped.
+func (mp *Mempool) SetMinGasPrice(price uint64) {
+	defer mp.sendEvents()
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	old := mp.config.MinGasPrice
+	mp.config.MinGasPrice = price
+
+	dropped := 0
+	if price > old {
+		floor := new(big.Int).SetUint64(price)
+		senders := make(map[common.Address]bool)
+		for _, tx := range mp.all {
+			if mp.locals[tx.From] || tx.GasPrice.Cmp(floor) >= 0 {
+				continue
+			}
+			mp.removeTx(tx)
+			mp.dropEvent(tx, DropUnderpriced)
+			senders[tx.From] = true
+			dropped++
+		}
+		for from := range senders {
+			mp.reorganize(from)
+		}
+	}
+
+	mp.logger.Info("Minimum gas price changed", "old", old, "new", price, "dropped", dropped)
+}
@@ -0,0 +1,115 @@
+package mempool
+
+import (
+	"sync"
+
+	"blockchain-node/core"
+)
+
+// TxEventKind is the kind of change a TxEvent reports
+type TxEventKind string
+
+const (
+	TxAdded    TxEventKind = "added"    // a transaction entered the pool
+	TxReplaced TxEventKind = "replaced" // Tx replaced Old, which is also reported as dropped
+	TxDropped  TxEventKind = "dropped"  // Tx left the pool without being mined
+)
+
+// DropReason tells why a transaction left the mempool without being mined
+type DropReason string
+
+const (
+	DropExpired  DropReason = "expired"  // pooled for longer than Config.Timeout
+	DropStale    DropReason = "stale"    // nonce already used by the account
+	DropEvicted  DropReason = "evicted"  // pushed out of a full pool by a new transaction
+	DropReplaced DropReason = "replaced" // replaced by a transaction with the same nonce
+	DropInvalid  DropReason = "invalid"  // the sender can no longer pay for it
+
+	DropAdmin       DropReason = "admin"       // removed by the node operator
+	DropUnderpriced DropReason = "underpriced" // below a raised minimum gas price
+)
+
+// TxEvent reports a change of the pooled transactions. Transactions leaving
+// the pool because they were mined are not reported, see
+// Blockchain.SubscribeChainHead.
+type TxEvent struct {
+	Kind   TxEventKind
+	Tx     *core.Transaction
+	Old    *core.Transaction // replaced transaction, for TxReplaced
+	Reason DropReason        // for TxDropped
+}
+
+// txFeed delivers transaction events to the subscribers of a pool
+type txFeed struct {
+	mu     sync.Mutex
+	subs   []txSub // in subscription order
+	nextID int
+
+	// sendMu keeps events in order when the pool is changed concurrently.
+	// It is taken before mp.mu, never while holding it.
+	sendMu sync.Mutex
+}
+
+// txSub is a subscriber of a txFeed
+type txSub struct {
+	id int
+	fn func(TxEvent)
+}
+
+// SubscribeTxEvents registers fn to be called with every change of the
+// pooled transactions, in order, after the subscribers registered before
+// it. fn runs without the pool locked, so it may query the pool but must
+// not change it. The returned function cancels the subscription.
+func (mp *Mempool) SubscribeTxEvents(fn func(TxEvent)) (unsubscribe func()) {
+	mp.feed.mu.Lock()
+	defer mp.feed.mu.Unlock()
+
+	id := mp.feed.nextID
+	mp.feed.nextID++
+	mp.feed.subs = append(mp.feed.subs, txSub{id, fn})
+
+	return func() {
+		mp.feed.mu.Lock()
+		defer mp.feed.mu.Unlock()
+		for i, sub := range mp.feed.subs {
+			if sub.id == id {
+				mp.feed.subs = append(mp.feed.subs[:i:i], mp.feed.subs[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// dropEvent records that a transaction was dropped. The caller must hold
+// mp.mu.
+func (mp *Mempool) dropEvent(tx *core.Transaction, reason DropReason) {
+	mp.events = append(mp.events, TxEvent{Kind: TxDropped, Tx: tx, Reason: reason})
+}
+
+// sendEvents delivers the recorded events to the subscribers. It must be
+// called without holding mp.mu.
+func (mp *Mempool) sendEvents() {
+	mp.feed.sendMu.Lock()
+	defer mp.feed.sendMu.Unlock()
+
+	mp.mu.Lock()
+	events := mp.events
+	mp.events = nil
+	mp.mu.Unlock()
+	if len(events) == 0 {
+		return
+	}
+
+	mp.feed.mu.Lock()
+	subs := mp.feed.subs
+	mp.feed.mu.Unlock()
+
+	for _, ev := range events {
+		if ev.Kind == TxDropped && ev.Reason == DropExpired {
+			mp.logger.Debug("Transaction expired", "hash", ev.Tx.Hash.Hex(), "from", ev.Tx.From.Hex())
+		}
+		for _, sub := range subs {
+			sub.fn(ev)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package mempool
+
+import (
+	"container/heap"
+
+	"blockchain-node/core"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Kinds of eviction candidates, queued transactions are evicted first
+const (
+	evictQueued = iota
+	evictTail
+)
+
+// evictionIndex orders the transactions the pool may evict by gas price, so
+// that the cheapest one is found without walking the pool. Candidates are
+// the queued transactions of remote senders and the last pending
+// transaction of each remote sender, reorganize updates them per sender.
+// Heap entries of former candidates are dropped once they reach the top.
+type evictionIndex struct {
+	heaps    [2]priceHeap
+	entries  map[common.Hash]*evictEntry
+	bySender map[common.Address][]common.Hash
+}
+
+// evictEntry is a current eviction candidate
+type evictEntry struct {
+	tx     *core.Transaction
+	kind   int
+	stored [2]bool // whether a heap holds an entry for tx
+}
+
+// newEvictionIndex creates an empty index
+func newEvictionIndex() *evictionIndex {
+	return &evictionIndex{
+		entries:  make(map[common.Hash]*evictEntry),
+		bySender: make(map[common.Address][]common.Hash),
+	}
+}
+
+// set replaces the candidates of a sender with its queued transactions and
+// its last pending transaction, tail may be nil
+func (ix *evictionIndex) set(from common.Address, queued []*core.Transaction, tail *core.Transaction) {
+	for _, hash := range ix.bySender[from] {
+		if entry := ix.entries[hash]; entry != nil {
+			entry.kind = -1
+		}
+	}
+
+	hashes := make([]common.Hash, 0, len(queued)+1)
+	add := func(tx *core.Transaction, kind int) {
+		entry := ix.entries[tx.Hash]
+		if entry == nil {
+			entry = &evictEntry{tx: tx}
+			ix.entries[tx.Hash] = entry
+		}
+		entry.kind = kind
+		if !entry.stored[kind] {
+			entry.stored[kind] = true
+			heap.Push(&ix.heaps[kind], tx)
+		}
+		hashes = append(hashes, tx.Hash)
+	}
+	for _, tx := range queued {
+		add(tx, evictQueued)
+	}
+	if tail != nil {
+		add(tail, evictTail)
+	}
+
+	// Former candidates stay in the heaps until they reach the top, their
+	// entries only as long as they are stored
+	for _, hash := range ix.bySender[from] {
+		if entry := ix.entries[hash]; entry != nil && entry.kind < 0 {
+			ix.forget(hash, entry)
+		}
+	}
+	if len(hashes) == 0 {
+		delete(ix.bySender, from)
+	} else {
+		ix.bySender[from] = hashes
+	}
+	ix.compact()
+}
+
+// remove drops a transaction that left the pool
+func (ix *evictionIndex) remove(hash common.Hash) {
+	if entry := ix.entries[hash]; entry != nil {
+		entry.kind = -1
+		ix.forget(hash, entry)
+	}
+}
+
+// forget deletes the entry of a former candidate that no heap holds
+func (ix *evictionIndex) forget(hash common.Hash, entry *evictEntry) {
+	if !entry.stored[evictQueued] && !entry.stored[evictTail] {
+		delete(ix.entries, hash)
+	}
+}
+
+// lowest returns the cheapest queued candidate, or without one the
+// cheapest pending tail, nil if there is no candidate
+func (ix *evictionIndex) lowest() *core.Transaction {
+	for kind := range ix.heaps {
+		h := &ix.heaps[kind]
+		for h.Len() > 0 {
+			tx := (*h)[0]
+			entry := ix.entries[tx.Hash]
+			if entry != nil && entry.kind == kind {
+				return tx
+			}
+			heap.Pop(h)
+			if entry != nil {
+				entry.stored[kind] = false
+				if entry.kind < 0 {
+					ix.forget(tx.Hash, entry)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// compact rebuilds a heap once most of its entries are former candidates
+func (ix *evictionIndex) compact() {
+	for kind := range ix.heaps {
+		if len(ix.heaps[kind]) < 2*len(ix.entries)+64 {
+			continue
+		}
+		live := make(priceHeap, 0, len(ix.entries))
+		for hash, entry := range ix.entries {
+			entry.stored[kind] = entry.kind == kind
+			if entry.stored[kind] {
+				live = append(live, entry.tx)
+			} else if entry.kind < 0 {
+				ix.forget(hash, entry)
+			}
+		}
+		heap.Init(&live)
+		ix.heaps[kind] = live
+	}
+}
+
+// priceHeap is a min-heap of transactions by gas price
+type priceHeap []*core.Transaction
+
+func (h priceHeap) Len() int           { return len(h) }
+func (h priceHeap) Less(i, j int) bool { return h[i].GasPrice.Cmp(h[j].GasPrice) < 0 }
+func (h priceHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *priceHeap) Push(x interface{}) {
+	*h = append(*h, x.(*core.Transaction))
+}
+
+func (h *priceHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	tx := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return tx
+}
+
+// indexEvictable updates the eviction candidates of a sender after its
+// transactions changed. Transactions of local senders are never evicted.
+// The caller must hold mp.mu.
+func (mp *Mempool) indexEvictable(from common.Address) {
+	var queued []*core.Transaction
+	var tail *core.Transaction
+	if !mp.locals[from] {
+		if list := mp.queued[from]; list != nil {
+			queued = list.flatten()
+		}
+		if list := mp.pending[from]; list != nil {
+			txs := list.flatten()
+			tail = txs[len(txs)-1]
+		}
+	}
+	mp.evictable.set(from, queued, tail)
+}
@@ -0,0 +1,52 @@
+package mempool
+
+import "math/big"
+
+const (
+	// floorPressure is the fill level of the pool, in percent of MaxSize,
+	// below which a raised fee floor decays
+	floorPressure = 90
+
+	// floorDecay is the fraction of the fee floor, 1/floorDecay, it drops
+	// by with every new head once the pool is below floorPressure
+	floorDecay = 8
+)
+
+// minGasPrice returns the lowest gas price remote transactions must pay:
+// the configured minimum or the fee floor of a full pool, whichever is
+// higher. The caller must hold mp.mu.
+func (mp *Mempool) minGasPrice() *big.Int {
+	minPrice := new(big.Int).SetUint64(mp.config.MinGasPrice)
+	if mp.floor != nil && mp.floor.Cmp(minPrice) > 0 {
+		minPrice.Set(mp.floor)
+	}
+	return minPrice
+}
+
+// raiseFloor raises the fee floor to the price of the cheapest transaction
+// that could be evicted next. Called after evicting for a new transaction,
+// it turns away cheaper ones without evicting for each. The caller must
+// hold mp.mu.
+func (mp *Mempool) raiseFloor() {
+	cheapest := mp.lowestEvictable()
+	if cheapest == nil || (mp.floor != nil && cheapest.GasPrice.Cmp(mp.floor) <= 0) {
+		return
+	}
+	mp.floor = new(big.Int).Set(cheapest.GasPrice)
+	mp.logger.Debug("Mempool fee floor raised", "floor", mp.floor.String(), "mempoolSize", len(mp.all))
+}
+
+// decayFloor lowers a raised fee floor once the pool is no longer under
+// pressure, until it falls to the configured minimum gas price. The caller
+// must hold mp.mu.
+func (mp *Mempool) decayFloor() {
+	if mp.floor == nil || len(mp.all)*100 >= mp.config.MaxSize*floorPressure {
+		return
+	}
+	step := new(big.Int).Div(mp.floor, big.NewInt(floorDecay))
+	mp.floor.Sub(mp.floor, step)
+	if step.Sign() == 0 || mp.floor.Cmp(new(big.Int).SetUint64(mp.config.MinGasPrice)) <= 0 {
+		mp.floor = nil
+		mp.logger.Debug("Mempool fee floor lifted")
+	}
+}
@@ -0,0 +1,183 @@
+package mempool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"blockchain-node/core"
+	"blockchain-node/rlp"
+)
+
+// txJournal keeps the transactions of local senders in a file, so that they
+// survive a restart of the node. Each transaction is appended to the file as
+// an RLP string holding its consensus encoding. The file is rewritten with
+// the pooled local transactions from time to time, dropping those that were
+// mined or replaced since.
+type txJournal struct {
+	path   string
+	writer *os.File // appends added transactions, nil until rotate
+}
+
+// load reads the journaled transactions. A transaction cut short by a
+// crash ends the file, the transactions before it are returned.
+func (j *txJournal) load() ([]*core.Transaction, error) {
+	data, err := os.ReadFile(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transaction journal: %v", err)
+	}
+
+	var txs []*core.Transaction
+	for len(data) > 0 {
+		content, rest, err := rlp.SplitString(data)
+		if err != nil {
+			return txs, fmt.Errorf("truncated transaction journal: %v", err)
+		}
+		data = rest
+
+		tx, err := core.DecodeTransaction(content)
+		if err != nil {
+			return txs, fmt.Errorf("invalid journaled transaction: %v", err)
+		}
+		if tx.From, err = core.Sender(tx); err != nil {
+			return txs, fmt.Errorf("invalid journaled transaction %s: %v", tx.Hash.Hex(), err)
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// insert appends a transaction to the journal
+func (j *txJournal) insert(tx *core.Transaction) error {
+	if j.writer == nil {
+		return nil
+	}
+	if _, err := j.writer.Write(rlp.EncodeBytes(tx.Encode())); err != nil {
+		return fmt.Errorf("failed to journal transaction: %v", err)
+	}
+	return nil
+}
+
+// rotate replaces the journal with txs. The new file is written under a
+// temporary name first, so that a crash leaves either journal complete.
+func (j *txJournal) rotate(txs []*core.Transaction) error {
+	if j.writer != nil {
+		j.writer.Close()
+		j.writer = nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create transaction journal: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	for _, tx := range txs {
+		if _, err := tmp.Write(rlp.EncodeBytes(tx.Encode())); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write transaction journal: %v", err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write transaction journal: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write transaction journal: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return fmt.Errorf("failed to replace transaction journal: %v", err)
+	}
+
+	writer, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open transaction journal: %v", err)
+	}
+	j.writer = writer
+	return nil
+}
+
+// close syncs and closes the journal
+func (j *txJournal) close() error {
+	if j.writer == nil {
+		return nil
+	}
+	err := j.writer.Sync()
+	if cerr := j.writer.Close(); err == nil {
+		err = cerr
+	}
+	j.writer = nil
+	return err
+}
+
+// localTransactions returns the pooled transactions of local senders,
+// pending and queued, in nonce order per sender. The caller must hold
+// mp.mu.
+func (mp *Mempool) localTransactions() []*core.Transaction {
+	var txs []*core.Transaction
+	for from := range mp.locals {
+		txs = append(txs, mp.senderTxs(from)...)
+	}
+	return txs
+}
+
+// loadJournal adds the journaled transactions to the pool as local ones.
+// Transactions mined while the node was down are rejected for their nonce.
+func (mp *Mempool) loadJournal() {
+	txs, err := mp.journal.load()
+	if err != nil {
+		mp.logger.Warning("Transaction journal damaged, loading the transactions before the damage", "error", err)
+	}
+	if len(txs) == 0 {
+		return
+	}
+
+	defer mp.sendEvents()
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	var fresh []*core.Transaction
+	for _, tx := range txs {
+		if _, exists := mp.all[tx.Hash]; exists {
+			continue
+		}
+		fresh = append(fresh, tx)
+	}
+	loaded := 0
+	for i, err := range mp.addBatch(fresh, true) {
+		if err != nil {
+			mp.logger.Debug("Dropping journaled transaction", "hash", fresh[i].Hash.Hex(), "error", err)
+			continue
+		}
+		loaded++
+	}
+	mp.logger.Info("Loaded local transactions from journal", "transactions", loaded, "dropped", len(txs)-loaded)
+}
+
+// rotateJournal rewrites the journal with the pooled local transactions
+func (mp *Mempool) rotateJournal() {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	txs := mp.localTransactions()
+	if err := mp.journal.rotate(txs); err != nil {
+		mp.logger.Warning("Failed to rotate transaction journal", "error", err)
+		return
+	}
+	mp.logger.Debug("Rotated transaction journal", "transactions", len(txs))
+}
+
+// journalAdded appends a local transaction to the journal. The caller must
+// hold mp.mu.
+func (mp *Mempool) journalAdded(tx *core.Transaction) {
+	if mp.journal == nil {
+		return
+	}
+	if err := mp.journal.insert(tx); err != nil {
+		mp.logger.Warning("Failed to journal local transaction", "hash", tx.Hash.Hex(), "error", err)
+	}
+}
@@ -0,0 +1,74 @@
+package mempool
+
+import (
+	"sort"
+
+	"blockchain-node/core"
+)
+
+// txList holds the transactions of one sender, at most one per nonce. The
+// nonce order is kept up to date on every change, so adding and removing a
+// transaction never re-sorts the list.
+type txList struct {
+	txs    map[uint64]*core.Transaction
+	sorted []*core.Transaction // txs in nonce order
+}
+
+// newTxList creates an empty list
+func newTxList() *txList {
+	return &txList{txs: make(map[uint64]*core.Transaction)}
+}
+
+// len returns the number of transactions in the list
+func (l *txList) len() int {
+	return len(l.txs)
+}
+
+// get returns the transaction with the given nonce, nil if there is none
+func (l *txList) get(nonce uint64) *core.Transaction {
+	return l.txs[nonce]
+}
+
+// put adds a transaction, replacing the one with the same nonce
+func (l *txList) put(tx *core.Transaction) {
+	i := l.search(tx.Nonce)
+	rest := l.sorted[i:]
+	if _, exists := l.txs[tx.Nonce]; exists {
+		rest = rest[1:]
+	}
+	l.txs[tx.Nonce] = tx
+
+	// Slices returned by flatten are never written to, only appending past
+	// their end reuses the array
+	if i == len(l.sorted) {
+		l.sorted = append(l.sorted, tx)
+		return
+	}
+	l.sorted = append(append(l.sorted[:i:i], tx), rest...)
+}
+
+// remove deletes the transaction with the given nonce and reports whether
+// there was one
+func (l *txList) remove(nonce uint64) bool {
+	if _, exists := l.txs[nonce]; !exists {
+		return false
+	}
+	delete(l.txs, nonce)
+	if i := l.search(nonce); i == 0 {
+		l.sorted = l.sorted[1:]
+	} else {
+		l.sorted = append(l.sorted[:i:i], l.sorted[i+1:]...)
+	}
+	return true
+}
+
+// flatten returns the transactions in nonce order. The slice is shared and
+// must not be modified.
+func (l *txList) flatten() []*core.Transaction {
+	return l.sorted
+}
+
+// search returns the position of nonce in the nonce order
+func (l *txList) search(nonce uint64) int {
+	return sort.Search(len(l.sorted), func(i int) bool { return l.sorted[i].Nonce >= nonce })
+}
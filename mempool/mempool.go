@@ -3,11 +3,13 @@ package mempool
 
 import (
 	"container/heap"
+	"errors"
 	"fmt"
 	"math/big"
 	"sync"
 	"time"
 
+	"blockchain-node/consensus"
 	"blockchain-node/core"
 	"blockchain-node/logger"
 
@@ -17,19 +19,73 @@ import (
 // Config holds mempool configuration
 type Config struct {
 	MaxSize     int      // Maximum number of transactions
+	MaxBytes    int      // Maximum encoded size of all transactions, 0 for no limit
+	AccountSlots int     // Maximum transactions per sender, 0 for no limit
 	MinGasPrice uint64   // Minimum gas price (wei)
 	MaxTxSize   int      // Maximum transaction size in bytes
-	Timeout     duration // Transaction timeout
+	GasLimitTarget uint64 // Gas limit blocks move toward, 0 keeps the gas limit of the head
+	Timeout     time.Duration // Time a transaction may stay in the pool, 0 keeps it until mined
+	PriceBump   uint64        // Minimum fee increase in percent to replace a transaction
+	Journal     string        // File the transactions of local senders are kept in across restarts, empty disables it
+	Rejournal   time.Duration // Time between rewrites of the journal, 0 rewrites it only on start and stop
 }
 
-type duration time.Duration
+// janitorInterval is how often expired transactions are looked for
+const janitorInterval = time.Minute
 
-// Mempool manages pending transactions
+// ErrReplaceUnderpriced is returned when a transaction with the nonce of a
+// pooled one from the same sender does not pay enough more to replace it
+var ErrReplaceUnderpriced = errors.New("replacement transaction underpriced")
+
+// ErrAccountLimit is returned when a sender already has the maximum number
+// of pooled transactions
+var ErrAccountLimit = errors.New("account transaction limit reached")
+
+// ErrMempoolFull is returned when a transaction does not fit into the pool
+// even after evicting every transaction that may be evicted
+var ErrMempoolFull = errors.New("mempool is full")
+
+// ErrUnderpriced is returned when a remote transaction does not fit into the
+// full pool and pays no more than the cheapest transaction it would evict
+var ErrUnderpriced = errors.New("transaction underpriced")
+
+// ErrGasPriceTooLow is returned for remote transactions priced below the
+// minimum gas price
+var ErrGasPriceTooLow = errors.New("gas price too low")
+
+// StateReader provides the head of the chain and its state
+type StateReader interface {
+	GetNonce(addr common.Address) uint64
+	GetSpendableBalance(addr common.Address) *big.Int // balance without immature block rewards
+	CurrentHeader() *core.BlockHeader
+}
+
+// Mempool manages pooled transactions. The transactions of each sender are
+// kept in nonce order: those with nonces contiguous from the account nonce
+// can be executed and are pending, those behind a nonce gap are queued
+// until the gap closes.
 type Mempool struct {
 	config      *Config
-	pending     map[common.Hash]*core.Transaction
-	queue       TransactionQueue
-	byFrom      map[common.Address][]*core.Transaction
+	all         map[common.Hash]*core.Transaction // every pooled transaction by hash
+	added       map[common.Hash]time.Time          // time each transaction entered the pool
+	sizes       map[common.Hash]int                // encoded size of each transaction
+	announced   map[common.Hash]uint64             // head number each transaction was last announced at
+	pending     map[common.Address]*txList         // executable transactions by sender
+	queued      map[common.Address]*txList         // gapped transactions by sender
+	bytes       int                                // encoded size of all transactions
+	locals      map[common.Address]bool            // senders of transactions submitted to this node
+	baseFee     *big.Int                           // base fee of the next block, nil if unknown
+	head        uint64                             // number of the head block
+	rejected    *rejectCache                       // recently rejected invalid transactions
+	paused      bool                               // new transactions are not admitted
+	floor       *big.Int                           // raised minimum gas price of a full pool, nil if not raised
+	state       StateReader                        // account nonces, nil if unknown
+	evictable   *evictionIndex                     // transactions that may be evicted by gas price
+	feed        txFeed
+	events      []TxEvent  // events not sent yet, see sendEvents
+	journal     *txJournal // nil unless Config.Journal is set
+	quit        chan struct{}
+	wg          sync.WaitGroup
 	logger      *logger.Logger
 	mu          sync.RWMutex
 }
@@ -37,7 +93,7 @@ type Mempool struct {
 // TransactionPriorityItem represents a transaction with priority for the heap
 type TransactionPriorityItem struct {
 	Tx       *core.Transaction
-	Priority *big.Int // Gas price for priority
+	Priority *big.Int // Effective tip for priority
 	Index    int
 }
 
@@ -77,91 +133,313 @@ func (pq *TransactionQueue) Pop() interface{} {
 // NewMempool creates a new mempool instance
 func NewMempool(config *Config) *Mempool {
 	return &Mempool{
-		config:  config,
-		pending: make(map[common.Hash]*core.Transaction),
-		queue:   make(TransactionQueue, 0),
-		byFrom:  make(map[common.Address][]*core.Transaction),
-		logger:  logger.NewLogger("mempool"),
+		config:    config,
+		all:       make(map[common.Hash]*core.Transaction),
+		added:     make(map[common.Hash]time.Time),
+		sizes:     make(map[common.Hash]int),
+		announced: make(map[common.Hash]uint64),
+		pending:   make(map[common.Address]*txList),
+		queued:    make(map[common.Address]*txList),
+		locals:    make(map[common.Address]bool),
+		rejected:  newRejectCache(rejectedCacheSize),
+		evictable: newEvictionIndex(),
+		logger:    logger.NewLogger("mempool"),
+	}
+}
+
+// SetStateReader sets the source of account nonces, balances and base fees.
+// Without it transactions are only checked for their own fields and the
+// lowest pooled nonce of each sender is taken as its account nonce.
+func (mp *Mempool) SetStateReader(state StateReader) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.state = state
+	if head := state.CurrentHeader(); head != nil {
+		mp.baseFee = core.CalcBaseFee(head)
+		mp.head = head.Number.Uint64()
+	}
+}
+
+// Start loads the local transactions of the journal, if one is configured,
+// and runs the janitor that evicts expired transactions and rewrites the
+// journal
+func (mp *Mempool) Start() {
+	if mp.config.Journal != "" {
+		mp.journal = &txJournal{path: mp.config.Journal}
+		mp.loadJournal()
+		mp.rotateJournal()
+	}
+	if mp.config.Timeout <= 0 && (mp.journal == nil || mp.config.Rejournal <= 0) {
+		return
+	}
+	mp.quit = make(chan struct{})
+	mp.wg.Add(1)
+	go mp.janitor()
+}
+
+// Stop stops the janitor and writes the pooled local transactions to the
+// journal
+func (mp *Mempool) Stop() {
+	if mp.quit != nil {
+		close(mp.quit)
+		mp.wg.Wait()
+		mp.quit = nil
+	}
+	if mp.journal != nil {
+		mp.rotateJournal()
+		if err := mp.journal.close(); err != nil {
+			mp.logger.Warning("Failed to close transaction journal", "error", err)
+		}
+	}
+}
+
+// janitor periodically evicts expired transactions and rewrites the
+// journal until Stop
+func (mp *Mempool) janitor() {
+	defer mp.wg.Done()
+
+	var expire, rejournal <-chan time.Time
+	if mp.config.Timeout > 0 {
+		ticker := time.NewTicker(min(mp.config.Timeout, janitorInterval))
+		defer ticker.Stop()
+		expire = ticker.C
+	}
+	if mp.journal != nil && mp.config.Rejournal > 0 {
+		ticker := time.NewTicker(mp.config.Rejournal)
+		defer ticker.Stop()
+		rejournal = ticker.C
+	}
+
+	for {
+		select {
+		case <-mp.quit:
+			return
+		case <-expire:
+			mp.Clean()
+		case <-rejournal:
+			mp.rotateJournal()
+		}
 	}
 }
 
 // AddTransaction adds a transaction to the mempool
 func (mp *Mempool) AddTransaction(tx *core.Transaction) error {
+	defer mp.sendEvents()
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if mp.paused {
+		return ErrAdmissionPaused
+	}
+	return mp.add(tx, false)
+}
+
+// AddTransactions adds a batch of remote transactions under a single
+// acquisition of the pool lock, like AddTransaction. The returned errors
+// line up with txs, nil for each transaction that was added.
+func (mp *Mempool) AddTransactions(txs []*core.Transaction) []error {
+	defer mp.sendEvents()
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	// Validate transaction
-	if err := mp.validateTransaction(tx); err != nil {
+	if mp.paused {
+		errs := make([]error, len(txs))
+		for i := range errs {
+			errs[i] = ErrAdmissionPaused
+		}
+		return errs
+	}
+	return mp.addBatch(txs, false)
+}
+
+// AddLocalTransaction adds a transaction submitted to this node through RPC
+// or the CLI and marks its sender as local. Transactions of local senders
+// are exempt from the minimum gas price, are never evicted or expired and
+// are included in blocks before remote ones.
+func (mp *Mempool) AddLocalTransaction(tx *core.Transaction) error {
+	defer mp.sendEvents()
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if mp.paused {
+		return ErrAdmissionPaused
+	}
+	if err := mp.add(tx, true); err != nil {
+		return err
+	}
+	mp.journalAdded(tx)
+	return nil
+}
+
+// IsLocal reports whether transactions of a sender are treated as local
+func (mp *Mempool) IsLocal(from common.Address) bool {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	return mp.locals[from]
+}
+
+// add validates a transaction and adds it to the pool. A local transaction
+// marks its sender as local once it is added. The caller must hold mp.mu.
+func (mp *Mempool) add(tx *core.Transaction, local bool) error {
+	if err := mp.insert(tx, local); err != nil {
+		return err
+	}
+	mp.reorganize(tx.From)
+	return nil
+}
+
+// addBatch adds transactions like add, but promotes each sender once after
+// the whole batch is in rather than after every transaction. The returned
+// errors line up with txs. The caller must hold mp.mu.
+func (mp *Mempool) addBatch(txs []*core.Transaction, local bool) []error {
+	errs := make([]error, len(txs))
+	senders := make(map[common.Address]bool)
+	for i, tx := range txs {
+		if errs[i] = mp.insert(tx, local); errs[i] == nil {
+			senders[tx.From] = true
+		}
+	}
+	for from := range senders {
+		mp.reorganize(from)
+	}
+	return errs
+}
+
+// insert validates a transaction and puts it into the pool without
+// promoting it, see reorganize. The caller must hold mp.mu.
+func (mp *Mempool) insert(tx *core.Transaction, local bool) error {
+	if err := mp.rejectedErr(tx.Hash); err != nil {
+		return err
+	}
+	local = local || mp.locals[tx.From]
+
+	// Validate transaction. Only the price depends on the pool settings and
+	// the sender, any other failure is final and remembered.
+	if err := mp.validateTransaction(tx, local); err != nil {
 		mp.logger.Warning("Transaction validation failed", "hash", tx.Hash.Hex(), "error", err)
+		if !errors.Is(err, ErrGasPriceTooLow) {
+			mp.rejected.add(tx.Hash, err)
+		}
 		return err
 	}
 
 	// Check if transaction already exists
-	if _, exists := mp.pending[tx.Hash]; exists {
+	if _, exists := mp.all[tx.Hash]; exists {
 		return fmt.Errorf("transaction already exists in mempool")
 	}
 
-	// Check mempool size limit
-	if len(mp.pending) >= mp.config.MaxSize {
-		// Remove lowest priority transaction
-		mp.removeLowPriorityTransaction()
+	if mp.state != nil {
+		if err := mp.validateState(tx); err != nil {
+			mp.logger.Debug("Transaction rejected by state", "hash", tx.Hash.Hex(), "error", err)
+			return err
+		}
 	}
 
-	// Add to pending transactions
-	mp.pending[tx.Hash] = tx
+	// A transaction with a pooled nonce replaces the pooled one if it pays
+	// enough more, it takes the same place in pending or queued
+	if old := mp.lookup(tx.From, tx.Nonce); old != nil {
+		if err := mp.checkReplacement(old, tx); err != nil {
+			return err
+		}
+		if local {
+			mp.locals[tx.From] = true
+		}
+		mp.listOf(tx.From, tx.Nonce).put(tx)
+		mp.untrack(old)
+		mp.track(tx, txSize(tx))
+		mp.indexEvictable(tx.From)
+		mp.events = append(mp.events,
+			TxEvent{Kind: TxReplaced, Tx: tx, Old: old},
+			TxEvent{Kind: TxDropped, Tx: old, Reason: DropReplaced})
+
+		mp.logger.Debug("Transaction replaced in mempool",
+			"old", old.Hash.Hex(),
+			"new", tx.Hash.Hex(),
+			"from", tx.From.Hex(),
+			"nonce", tx.Nonce)
+		return nil
+	}
 
-	// Add to priority queue
-	item := &TransactionPriorityItem{
-		Tx:       tx,
-		Priority: tx.GasPrice,
+	// One sender cannot take up more than its share of the pool
+	if mp.config.AccountSlots > 0 {
+		if count := mp.countFrom(tx.From); count >= mp.config.AccountSlots {
+			return fmt.Errorf("%w: %s has %d transactions", ErrAccountLimit, tx.From.Hex(), count)
+		}
 	}
-	heap.Push(&mp.queue, item)
 
-	// Add to by-from index
-	mp.byFrom[tx.From] = append(mp.byFrom[tx.From], tx)
+	// Make room by count and by size, evicting the lowest priority
+	// transactions as long as remote ones outbid them
+	size := txSize(tx)
+	evicted := false
+	for mp.full(size) {
+		lowest := mp.lowestEvictable()
+		if lowest == nil {
+			return fmt.Errorf("%w: %d transactions, %d bytes", ErrMempoolFull, len(mp.all), mp.bytes)
+		}
+		if !local && tx.GasPrice.Cmp(lowest.GasPrice) <= 0 {
+			return fmt.Errorf("%w: gas price %s, cheapest evictable %s", ErrUnderpriced, tx.GasPrice, lowest.GasPrice)
+		}
+		mp.removeLowPriorityTransaction()
+		evicted = true
+	}
+
+	// New transactions are queued, promotion moves them to pending once
+	// their nonce is next in line
+	if local {
+		mp.locals[tx.From] = true
+	}
+	mp.track(tx, size)
+	listFor(mp.queued, tx.From).put(tx)
+	mp.indexEvictable(tx.From)
+	mp.events = append(mp.events, TxEvent{Kind: TxAdded, Tx: tx})
+	if evicted {
+		mp.raiseFloor()
+	}
 
 	mp.logger.Debug("Transaction added to mempool", 
 		"hash", tx.Hash.Hex(), 
 		"from", tx.From.Hex(), 
+		"nonce", tx.Nonce,
 		"gasPrice", tx.GasPrice.String(),
-		"mempoolSize", len(mp.pending))
+		"mempoolSize", len(mp.all),
+		"mempoolBytes", mp.bytes)
 
 	return nil
 }
 
-// RemoveTransaction removes a transaction from the mempool
+// RemoveTransaction removes a transaction from the mempool, transactions of
+// the same sender that it left behind a nonce gap are queued
 func (mp *Mempool) RemoveTransaction(hash common.Hash) {
+	mp.RemoveTransactions([]common.Hash{hash})
+}
+
+// RemoveTransactions removes a batch of transactions from the mempool, like
+// RemoveTransaction. The transactions of each affected sender are sorted
+// into pending and queued once for the whole batch.
+func (mp *Mempool) RemoveTransactions(hashes []common.Hash) {
+	defer mp.sendEvents()
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	tx, exists := mp.pending[hash]
-	if !exists {
-		return
-	}
-
-	// Remove from pending
-	delete(mp.pending, hash)
-
-	// Remove from by-from index
-	fromTxs := mp.byFrom[tx.From]
-	for i, fromTx := range fromTxs {
-		if fromTx.Hash == hash {
-			mp.byFrom[tx.From] = append(fromTxs[:i], fromTxs[i+1:]...)
-			break
+	affected := make(map[common.Address]bool)
+	for _, hash := range hashes {
+		tx, exists := mp.all[hash]
+		if !exists {
+			continue
 		}
+		mp.removeTx(tx)
+		affected[tx.From] = true
 	}
-
-	// Remove empty slice
-	if len(mp.byFrom[tx.From]) == 0 {
-		delete(mp.byFrom, tx.From)
+	for from := range affected {
+		mp.reorganize(from)
 	}
 
-	// Rebuild priority queue (inefficient but simple)
-	mp.rebuildQueue()
-
-	mp.logger.Debug("Transaction removed from mempool", 
-		"hash", hash.Hex(), 
-		"mempoolSize", len(mp.pending))
+	if len(affected) > 0 {
+		mp.logger.Debug("Transactions removed from mempool",
+			"requested", len(hashes),
+			"senders", len(affected),
+			"mempoolSize", len(mp.all))
+	}
 }
 
 // GetTransaction retrieves a transaction by hash
@@ -169,61 +447,134 @@ func (mp *Mempool) GetTransaction(hash common.Hash) *core.Transaction {
 	mp.mu.RLock()
 	defer mp.mu.RUnlock()
 
-	return mp.pending[hash]
+	return mp.all[hash]
 }
 
-// GetPendingTransactions returns all pending transactions
+// GetPendingTransactions returns all executable transactions
 func (mp *Mempool) GetPendingTransactions() []*core.Transaction {
 	mp.mu.RLock()
 	defer mp.mu.RUnlock()
 
-	txs := make([]*core.Transaction, 0, len(mp.pending))
-	for _, tx := range mp.pending {
-		txs = append(txs, tx)
-	}
-
-	return txs
+	return flattenAll(mp.pending)
 }
 
-// GetPendingTransactionsForMining returns transactions ready for mining
-func (mp *Mempool) GetPendingTransactionsForMining(maxCount int) []*core.Transaction {
+// Pending returns the executable transactions grouped by sender, each
+// sender's in nonce order
+func (mp *Mempool) Pending() map[common.Address][]*core.Transaction {
 	mp.mu.RLock()
 	defer mp.mu.RUnlock()
 
-	if len(mp.queue) == 0 {
-		return []*core.Transaction{}
+	pending := make(map[common.Address][]*core.Transaction, len(mp.pending))
+	for addr, list := range mp.pending {
+		pending[addr] = append([]*core.Transaction{}, list.flatten()...)
 	}
+	return pending
+}
 
-	// Create a copy of the queue for processing
-	queueCopy := make(TransactionQueue, len(mp.queue))
-	copy(queueCopy, mp.queue)
-	heap.Init(&queueCopy)
+// GetQueuedTransactions returns all transactions waiting for a nonce gap to
+// close
+func (mp *Mempool) GetQueuedTransactions() []*core.Transaction {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	return flattenAll(mp.queued)
+}
 
+// GetPendingTransactionsForMining returns up to maxCount executable
+// transactions whose gas limits add up to at most gasLimit, by decreasing
+// effective tip at the base fee of the next block, those of local senders
+// ahead of all remote ones. Transactions whose fee cap is below the base
+// fee or whose gas limit no longer fits into the block are skipped together
+// with the later transactions of their sender. The transactions of a sender keep their nonce order, so a
+// sender's later transaction can only follow its earlier ones.
+func (mp *Mempool) GetPendingTransactionsForMining(maxCount int, gasLimit uint64) []*core.Transaction {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	var locals, remotes []*txList
+	for addr, list := range mp.pending {
+		if mp.locals[addr] {
+			locals = append(locals, list)
+		} else {
+			remotes = append(remotes, list)
+		}
+	}
 	txs := make([]*core.Transaction, 0, maxCount)
-	count := 0
+	txs, gasLimit = fillByTip(txs, locals, mp.baseFee, maxCount, gasLimit)
+	txs, _ = fillByTip(txs, remotes, mp.baseFee, maxCount, gasLimit)
+	return txs
+}
 
-	for len(queueCopy) > 0 && count < maxCount {
-		item := heap.Pop(&queueCopy).(*TransactionPriorityItem)
+// fillByTip appends transactions of the pending lists to txs, up to
+// maxCount in total, always taking the next transaction of any sender that
+// pays the highest effective tip at baseFee. It returns the gas left of
+// the gasLimit budget.
+func fillByTip(txs []*core.Transaction, lists []*txList, baseFee *big.Int, maxCount int, gasLimit uint64) ([]*core.Transaction, uint64) {
+	// The heap holds the next includable transaction of every sender
+	heads := make(TransactionQueue, 0, len(lists))
+	rest := make(map[common.Address][]*core.Transaction, len(lists))
+	for _, list := range lists {
+		pending := list.flatten()
+		if !paysBaseFee(pending[0], baseFee) {
+			continue
+		}
+		heads = append(heads, &TransactionPriorityItem{Tx: pending[0], Priority: effectiveTip(pending[0], baseFee)})
+		rest[pending[0].From] = pending[1:]
+	}
+	heap.Init(&heads)
+
+	for len(heads) > 0 && len(txs) < maxCount && gasLimit >= core.TxGas {
+		item := heads[0]
+		if item.Tx.GasLimit > gasLimit {
+			heap.Pop(&heads)
+			continue
+		}
 		txs = append(txs, item.Tx)
-		count++
+		gasLimit -= item.Tx.GasLimit
+
+		from := item.Tx.From
+		if next := rest[from]; len(next) > 0 && paysBaseFee(next[0], baseFee) {
+			item.Tx, item.Priority = next[0], effectiveTip(next[0], baseFee)
+			rest[from] = next[1:]
+			heap.Fix(&heads, 0)
+		} else {
+			heap.Pop(&heads)
+		}
 	}
 
-	return txs
+	return txs, gasLimit
+}
+
+// effectiveTip returns the priority fee per gas a transaction pays the block
+// producer at baseFee
+func effectiveTip(tx *core.Transaction, baseFee *big.Int) *big.Int {
+	return core.EffectiveTip(tx.EffectiveGasPrice(baseFee), baseFee)
+}
+
+// paysBaseFee reports whether the fee cap of a transaction covers baseFee
+func paysBaseFee(tx *core.Transaction, baseFee *big.Int) bool {
+	return baseFee == nil || tx.FeeCap().Cmp(baseFee) >= 0
 }
 
-// GetTransactionsByFrom returns transactions from a specific address
+// GetTransactionsByFrom returns the pending and queued transactions from a
+// specific address in nonce order
 func (mp *Mempool) GetTransactionsByFrom(from common.Address) []*core.Transaction {
 	mp.mu.RLock()
 	defer mp.mu.RUnlock()
 
-	txs := mp.byFrom[from]
-	if txs == nil {
-		return []*core.Transaction{}
-	}
+	return mp.senderTxs(from)
+}
 
-	// Return a copy
-	result := make([]*core.Transaction, len(txs))
-	copy(result, txs)
+// senderTxs returns the pending and queued transactions of a sender in
+// nonce order. The caller must hold mp.mu.
+func (mp *Mempool) senderTxs(from common.Address) []*core.Transaction {
+	result := []*core.Transaction{}
+	if list := mp.pending[from]; list != nil {
+		result = append(result, list.flatten()...)
+	}
+	if list := mp.queued[from]; list != nil {
+		result = append(result, list.flatten()...)
+	}
 	return result
 }
 
@@ -232,15 +583,26 @@ func (mp *Mempool) Size() int {
 	mp.mu.RLock()
 	defer mp.mu.RUnlock()
 
-	return len(mp.pending)
+	return len(mp.all)
 }
 
 // validateTransaction validates a transaction before adding to mempool
-func (mp *Mempool) validateTransaction(tx *core.Transaction) error {
-	// Check minimum gas price
-	if tx.GasPrice.Cmp(big.NewInt(int64(mp.config.MinGasPrice))) < 0 {
-		return fmt.Errorf("gas price too low: got %s, minimum %d", 
-			tx.GasPrice.String(), mp.config.MinGasPrice)
+func (mp *Mempool) validateTransaction(tx *core.Transaction, local bool) error {
+	switch tx.Type {
+	case core.LegacyTxType, core.AccessListTxType, core.DynamicFeeTxType:
+	default:
+		return core.ErrTxTypeNotSupported
+	}
+
+	// The priority fee cannot exceed the fee cap (EIP-1559)
+	if tx.TipCap().Cmp(tx.FeeCap()) > 0 {
+		return fmt.Errorf("%w: tip %s, fee cap %s", core.ErrTipAboveFeeCap, tx.TipCap(), tx.FeeCap())
+	}
+
+	// Check minimum gas price, local transactions are exempt
+	if minPrice := mp.minGasPrice(); !local && tx.GasPrice.Cmp(minPrice) < 0 {
+		return fmt.Errorf("%w: got %s, minimum %s", 
+			ErrGasPriceTooLow, tx.GasPrice.String(), minPrice)
 	}
 
 	// Check gas limit
@@ -248,16 +610,19 @@ func (mp *Mempool) validateTransaction(tx *core.Transaction) error {
 		return fmt.Errorf("gas limit cannot be zero")
 	}
 
-	if tx.GasLimit > 8000000 { // Max block gas limit
-		return fmt.Errorf("gas limit too high: %d", tx.GasLimit)
+	// The gas limit has to cover the intrinsic cost
+	intrinsicGas, err := core.IntrinsicGas(tx.Data, tx.AccessList, tx.IsContractCreation())
+	if err != nil {
+		return err
+	}
+	if tx.GasLimit < intrinsicGas {
+		return fmt.Errorf("%w: have %d, want %d", core.ErrIntrinsicGas, tx.GasLimit, intrinsicGas)
 	}
 
-	// Check transaction size
+	// Check the size of the canonical encoding
 	if mp.config.MaxTxSize > 0 {
-		// Estimate transaction size (simplified)
-		txSize := 32 + 32 + 8 + 8 + 32 + len(tx.Data) + 32 + 32 + 32 // Basic fields + data + signature
-		if txSize > mp.config.MaxTxSize {
-			return fmt.Errorf("transaction too large: %d bytes", txSize)
+		if size := txSize(tx); size > mp.config.MaxTxSize {
+			return fmt.Errorf("transaction too large: %d bytes, maximum %d", size, mp.config.MaxTxSize)
 		}
 	}
 
@@ -278,71 +643,335 @@ func (mp *Mempool) validateTransaction(tx *core.Transaction) error {
 	return nil
 }
 
-// removeLowPriorityTransaction removes the transaction with lowest priority
-func (mp *Mempool) removeLowPriorityTransaction() {
-	if len(mp.queue) == 0 {
-		return
+// validateState checks a transaction against the head state: its nonce must
+// not be used yet, the sender must be able to pay its maximum cost after
+// the pooled transactions before it, and its fee cap must cover the base fee
+// and its gas limit fit into the gas limit of the next block. The caller
+// must hold mp.mu.
+func (mp *Mempool) validateState(tx *core.Transaction) error {
+	nonce := mp.state.GetNonce(tx.From)
+	if tx.Nonce < nonce {
+		return fmt.Errorf("%w: nonce too low, got %d, account nonce %d", core.ErrInvalidNonce, tx.Nonce, nonce)
 	}
 
-	// Find transaction with lowest gas price
-	var lowestTx *core.Transaction
-	lowestGasPrice := new(big.Int)
+	cost := txCost(tx)
+	pooled := mp.pooledCost(tx.From, nonce, tx.Nonce)
+	if balance := mp.state.GetSpendableBalance(tx.From); balance.Cmp(new(big.Int).Add(pooled, cost)) < 0 {
+		return fmt.Errorf("%w: balance %s, cost %s, pooled before %s", core.ErrInsufficientBalance, balance, cost, pooled)
+	}
 
-	for _, tx := range mp.pending {
-		if lowestTx == nil || tx.GasPrice.Cmp(lowestGasPrice) < 0 {
-			lowestTx = tx
-			lowestGasPrice = tx.GasPrice
+	if head := mp.state.CurrentHeader(); head != nil {
+		if baseFee := core.CalcBaseFee(head); tx.FeeCap().Cmp(baseFee) < 0 {
+			return fmt.Errorf("%w: fee cap %s, base fee %s", core.ErrFeeCapTooLow, tx.FeeCap(), baseFee)
+		}
+		if limit := mp.blockGasLimit(head); tx.GasLimit > limit {
+			return fmt.Errorf("%w: gas limit %d, block gas limit %d", core.ErrGasLimitExceeded, tx.GasLimit, limit)
 		}
 	}
+	return nil
+}
+
+// blockGasLimit returns the gas limit of the block after head
+func (mp *Mempool) blockGasLimit(head *core.BlockHeader) uint64 {
+	if mp.config.GasLimitTarget == 0 {
+		return head.GasLimit
+	}
+	return consensus.CalcGasLimit(head.GasLimit, mp.config.GasLimitTarget)
+}
+
+// txCost returns the most a transaction can cost its sender: its value and
+// its gas limit at the fee cap
+func txCost(tx *core.Transaction) *big.Int {
+	cost := new(big.Int).Mul(tx.FeeCap(), new(big.Int).SetUint64(tx.GasLimit))
+	return cost.Add(cost, tx.Value)
+}
 
-	if lowestTx != nil {
-		mp.logger.Debug("Removing low priority transaction", 
-			"hash", lowestTx.Hash.Hex(), 
-			"gasPrice", lowestTx.GasPrice.String())
-		
-		// Remove without locking (already locked)
-		delete(mp.pending, lowestTx.Hash)
-		
-		// Remove from by-from index
-		fromTxs := mp.byFrom[lowestTx.From]
-		for i, fromTx := range fromTxs {
-			if fromTx.Hash == lowestTx.Hash {
-				mp.byFrom[lowestTx.From] = append(fromTxs[:i], fromTxs[i+1:]...)
+// pooledCost returns the summed cost of the pooled transactions of from with
+// a nonce from first up to before nonce. The caller must hold mp.mu.
+func (mp *Mempool) pooledCost(from common.Address, first, nonce uint64) *big.Int {
+	total := new(big.Int)
+	for _, lists := range []map[common.Address]*txList{mp.pending, mp.queued} {
+		list := lists[from]
+		if list == nil {
+			continue
+		}
+		for _, tx := range list.flatten() {
+			if tx.Nonce >= nonce {
 				break
 			}
+			if tx.Nonce >= first {
+				total.Add(total, txCost(tx))
+			}
 		}
+	}
+	return total
+}
+
+// removeLowPriorityTransaction removes the transaction with lowest priority.
+// Queued transactions go first. Among pending ones only the last of each
+// sender is considered, so that no nonce gap is created. Transactions of
+// local senders are never evicted.
+func (mp *Mempool) removeLowPriorityTransaction() bool {
+	lowestTx := mp.lowestEvictable()
+	if lowestTx == nil {
+		return false
+	}
 
-		if len(mp.byFrom[lowestTx.From]) == 0 {
-			delete(mp.byFrom, lowestTx.From)
+	mp.logger.Debug("Removing low priority transaction", 
+		"hash", lowestTx.Hash.Hex(), 
+		"gasPrice", lowestTx.GasPrice.String())
+
+	mp.removeTx(lowestTx)
+	mp.dropEvent(lowestTx, DropEvicted)
+	mp.reorganize(lowestTx.From)
+	return true
+}
+
+// lowestEvictable returns the transaction removeLowPriorityTransaction
+// would evict, nil if no transaction may be evicted
+func (mp *Mempool) lowestEvictable() *core.Transaction {
+	for {
+		tx := mp.evictable.lowest()
+		if tx == nil || !mp.locals[tx.From] {
+			return tx
 		}
+		// The sender became local after its transactions were indexed
+		mp.indexEvictable(tx.From)
+	}
+}
 
-		mp.rebuildQueue()
+// full reports whether adding a transaction of the given encoded size would
+// exceed the count or size limit of the pool
+func (mp *Mempool) full(size int) bool {
+	if len(mp.all) >= mp.config.MaxSize {
+		return true
 	}
+	return mp.config.MaxBytes > 0 && mp.bytes+size > mp.config.MaxBytes
 }
 
-// rebuildQueue rebuilds the priority queue
-func (mp *Mempool) rebuildQueue() {
-	mp.queue = make(TransactionQueue, 0, len(mp.pending))
-	
-	for _, tx := range mp.pending {
-		item := &TransactionPriorityItem{
-			Tx:       tx,
-			Priority: tx.GasPrice,
+// countFrom returns the number of pooled transactions of a sender
+func (mp *Mempool) countFrom(from common.Address) int {
+	count := 0
+	if list := mp.pending[from]; list != nil {
+		count += list.len()
+	}
+	if list := mp.queued[from]; list != nil {
+		count += list.len()
+	}
+	return count
+}
+
+// txSize returns the encoded size of a transaction
+func txSize(tx *core.Transaction) int {
+	return len(tx.Encode())
+}
+
+// track records a transaction of the given encoded size as pooled, the
+// caller adds it to a list
+func (mp *Mempool) track(tx *core.Transaction, size int) {
+	mp.all[tx.Hash] = tx
+	mp.added[tx.Hash] = time.Now()
+	mp.sizes[tx.Hash] = size
+	mp.announced[tx.Hash] = mp.head
+	mp.bytes += size
+}
+
+// untrack forgets a pooled transaction, the caller removes it from its list
+func (mp *Mempool) untrack(tx *core.Transaction) {
+	mp.evictable.remove(tx.Hash)
+	mp.bytes -= mp.sizes[tx.Hash]
+	delete(mp.all, tx.Hash)
+	delete(mp.added, tx.Hash)
+	delete(mp.sizes, tx.Hash)
+	delete(mp.announced, tx.Hash)
+}
+
+// listBytes returns the encoded size of the transactions in lists
+func (mp *Mempool) listBytes(lists map[common.Address]*txList) int {
+	total := 0
+	for _, list := range lists {
+		for _, tx := range list.flatten() {
+			total += mp.sizes[tx.Hash]
 		}
-		mp.queue = append(mp.queue, item)
 	}
+	return total
+}
 
-	heap.Init(&mp.queue)
+// checkReplacement checks that tx raises both the fee cap and the tip of
+// old by at least the configured price bump
+func (mp *Mempool) checkReplacement(old, tx *core.Transaction) error {
+	bump := func(price *big.Int) *big.Int {
+		threshold := new(big.Int).Mul(price, big.NewInt(int64(100+mp.config.PriceBump)))
+		return threshold.Div(threshold, big.NewInt(100))
+	}
+	if tx.FeeCap().Cmp(old.FeeCap()) <= 0 || tx.FeeCap().Cmp(bump(old.FeeCap())) < 0 ||
+		tx.TipCap().Cmp(old.TipCap()) <= 0 || tx.TipCap().Cmp(bump(old.TipCap())) < 0 {
+		return fmt.Errorf("%w: fee cap %s and tip %s must be %d%% above %s and %s",
+			ErrReplaceUnderpriced, tx.FeeCap(), tx.TipCap(), mp.config.PriceBump, old.FeeCap(), old.TipCap())
+	}
+	return nil
 }
 
-// Clean removes expired transactions from mempool
+// lookup returns the pooled transaction of a sender with the given nonce
+func (mp *Mempool) lookup(from common.Address, nonce uint64) *core.Transaction {
+	if list := mp.pending[from]; list != nil {
+		if tx := list.get(nonce); tx != nil {
+			return tx
+		}
+	}
+	if list := mp.queued[from]; list != nil {
+		return list.get(nonce)
+	}
+	return nil
+}
+
+// listOf returns the pending or queued list holding a sender's nonce
+func (mp *Mempool) listOf(from common.Address, nonce uint64) *txList {
+	if list := mp.pending[from]; list != nil && list.get(nonce) != nil {
+		return list
+	}
+	return mp.queued[from]
+}
+
+// removeTx deletes a transaction from the pool without re-sorting the
+// remaining transactions of its sender
+func (mp *Mempool) removeTx(tx *core.Transaction) {
+	mp.untrack(tx)
+	for _, lists := range []map[common.Address]*txList{mp.pending, mp.queued} {
+		if list := lists[tx.From]; list != nil && list.get(tx.Nonce) == tx {
+			list.remove(tx.Nonce)
+			if list.len() == 0 {
+				delete(lists, tx.From)
+			}
+		}
+	}
+}
+
+// reorganize sorts the transactions of a sender into pending and queued.
+// Nonces below the account nonce are stale and dropped, the run of
+// contiguous nonces starting at the account nonce is pending, everything
+// after the first gap is queued.
+func (mp *Mempool) reorganize(from common.Address) {
+	defer mp.indexEvictable(from)
+
+	var pending, queued []*core.Transaction
+	if list := mp.pending[from]; list != nil {
+		pending = list.flatten()
+		delete(mp.pending, from)
+	}
+	if list := mp.queued[from]; list != nil {
+		queued = list.flatten()
+		delete(mp.queued, from)
+	}
+	txs := mergeByNonce(pending, queued)
+	if len(txs) == 0 {
+		return
+	}
+
+	next := txs[0].Nonce
+	if mp.state != nil {
+		next = mp.state.GetNonce(from)
+	}
+	for _, tx := range txs {
+		switch {
+		case tx.Nonce < next:
+			mp.untrack(tx)
+			mp.dropEvent(tx, DropStale)
+			mp.logger.Debug("Dropping stale transaction", "hash", tx.Hash.Hex(), "nonce", tx.Nonce)
+		case tx.Nonce == next:
+			listFor(mp.pending, from).put(tx)
+			next++
+		default:
+			listFor(mp.queued, from).put(tx)
+		}
+	}
+}
+
+// mergeByNonce merges two transaction lists that are in nonce order
+func mergeByNonce(a, b []*core.Transaction) []*core.Transaction {
+	merged := make([]*core.Transaction, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if a[0].Nonce <= b[0].Nonce {
+			merged, a = append(merged, a[0]), a[1:]
+		} else {
+			merged, b = append(merged, b[0]), b[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
+
+// senders returns the number of senders with pooled transactions
+func (mp *Mempool) senders() int {
+	n := len(mp.pending)
+	for from := range mp.queued {
+		if _, exists := mp.pending[from]; !exists {
+			n++
+		}
+	}
+	return n
+}
+
+// countAll returns the number of transactions in all lists
+func countAll(lists map[common.Address]*txList) int {
+	n := 0
+	for _, list := range lists {
+		n += list.len()
+	}
+	return n
+}
+
+// listFor returns the list of a sender, creating it if needed
+func listFor(lists map[common.Address]*txList, from common.Address) *txList {
+	list := lists[from]
+	if list == nil {
+		list = newTxList()
+		lists[from] = list
+	}
+	return list
+}
+
+// flattenAll returns the transactions of all lists, each sender's in nonce
+// order
+func flattenAll(lists map[common.Address]*txList) []*core.Transaction {
+	var txs []*core.Transaction
+	for _, list := range lists {
+		txs = append(txs, list.flatten()...)
+	}
+	return txs
+}
+
+// Clean removes transactions that have been pooled for longer than the
+// configured timeout. Later transactions of their senders are queued.
+// Transactions of local senders do not expire.
 func (mp *Mempool) Clean() {
+	defer mp.sendEvents()
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	// For now, we don't implement timeout-based cleaning
-	// This could be added based on transaction timestamp vs current time
-	mp.logger.Debug("Mempool cleanup completed", "size", len(mp.pending))
+	if mp.config.Timeout <= 0 {
+		return
+	}
+
+	deadline := time.Now().Add(-mp.config.Timeout)
+	senders := make(map[common.Address]bool)
+	for hash, added := range mp.added {
+		if !added.Before(deadline) {
+			continue
+		}
+		tx := mp.all[hash]
+		if mp.locals[tx.From] {
+			continue
+		}
+		mp.removeTx(tx)
+		mp.dropEvent(tx, DropExpired)
+		senders[tx.From] = true
+	}
+	for from := range senders {
+		mp.reorganize(from)
+	}
+
+	mp.logger.Debug("Mempool cleanup completed", "size", len(mp.all))
 }
 
 // GetStats returns mempool statistics
@@ -351,20 +980,29 @@ func (mp *Mempool) GetStats() map[string]interface{} {
 	defer mp.mu.RUnlock()
 
 	stats := map[string]interface{}{
-		"pending_count":  len(mp.pending),
-		"queue_length":   len(mp.queue),
-		"unique_senders": len(mp.byFrom),
-		"max_size":       mp.config.MaxSize,
-		"min_gas_price":  mp.config.MinGasPrice,
+		"pending_count":   countAll(mp.pending),
+		"queued_count":    countAll(mp.queued),
+		"unique_senders":  mp.senders(),
+		"local_senders":   len(mp.locals),
+		"rejected_cached": mp.rejected.len(),
+		"max_size":        mp.config.MaxSize,
+		"size_bytes":      mp.bytes,
+		"pending_bytes":   mp.listBytes(mp.pending),
+		"queued_bytes":    mp.listBytes(mp.queued),
+		"max_bytes":       mp.config.MaxBytes,
+		"account_slots":   mp.config.AccountSlots,
+		"min_gas_price":   mp.config.MinGasPrice,
+		"fee_floor":       mp.minGasPrice().String(),
+		"paused":          mp.paused,
 	}
 
 	// Calculate average gas price
-	if len(mp.pending) > 0 {
+	if len(mp.all) > 0 {
 		totalGasPrice := big.NewInt(0)
-		for _, tx := range mp.pending {
+		for _, tx := range mp.all {
 			totalGasPrice.Add(totalGasPrice, tx.GasPrice)
 		}
-		avgGasPrice := new(big.Int).Div(totalGasPrice, big.NewInt(int64(len(mp.pending))))
+		avgGasPrice := new(big.Int).Div(totalGasPrice, big.NewInt(int64(len(mp.all))))
 		stats["avg_gas_price"] = avgGasPrice.String()
 	}
 
@@ -376,8 +1014,8 @@ func (mp *Mempool) GetTransactionHashes() []common.Hash {
 	mp.mu.RLock()
 	defer mp.mu.RUnlock()
 
-	hashes := make([]common.Hash, 0, len(mp.pending))
-	for hash := range mp.pending {
+	hashes := make([]common.Hash, 0, len(mp.all))
+	for hash := range mp.all {
 		hashes = append(hashes, hash)
 	}
 
@@ -389,18 +1027,21 @@ func (mp *Mempool) HasTransaction(hash common.Hash) bool {
 	mp.mu.RLock()
 	defer mp.mu.RUnlock()
 
-	_, exists := mp.pending[hash]
+	_, exists := mp.all[hash]
 	return exists
 }
 
-// GetHighestGasPriceTransaction returns the transaction with highest gas price
+// GetHighestGasPriceTransaction returns the executable transaction with
+// highest gas price, the first one mining picks
 func (mp *Mempool) GetHighestGasPriceTransaction() *core.Transaction {
 	mp.mu.RLock()
 	defer mp.mu.RUnlock()
 
-	if len(mp.queue) == 0 {
-		return nil
+	var best *core.Transaction
+	for _, list := range mp.pending {
+		if tx := list.flatten()[0]; best == nil || tx.GasPrice.Cmp(best.GasPrice) > 0 {
+			best = tx
+		}
 	}
-
-	return mp.queue[0].Tx
+	return best
 }
@@ -0,0 +1,27 @@
+package mempool
+
+import "blockchain-node/core"
+
+// Rebroadcast returns the pending transactions of local senders that were
+// last announced to peers at least interval blocks ago, and records them as
+// announced at the current head. Announcing them again lets transactions
+// submitted while the node had few peers still spread.
+func (mp *Mempool) Rebroadcast(interval uint64) []*core.Transaction {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	var txs []*core.Transaction
+	for from, list := range mp.pending {
+		if !mp.locals[from] {
+			continue
+		}
+		for _, tx := range list.flatten() {
+			if mp.head < mp.announced[tx.Hash]+interval {
+				continue
+			}
+			mp.announced[tx.Hash] = mp.head
+			txs = append(txs, tx)
+		}
+	}
+	return txs
+}
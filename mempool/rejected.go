@@ -0,0 +1,85 @@
+package mempool
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// rejectedCacheSize is the number of recently rejected transactions that
+// are remembered
+const rejectedCacheSize = 4096
+
+// ErrRecentlyRejected is returned for a transaction that was rejected as
+// invalid before, without validating it again
+var ErrRecentlyRejected = errors.New("transaction recently rejected")
+
+// rejectCache remembers why recently rejected transactions were invalid,
+// forgetting the oldest once full. It is not safe for concurrent use.
+type rejectCache struct {
+	reasons map[common.Hash]error
+	order   []common.Hash // ring of cached hashes, the oldest at next once full
+	next    int
+}
+
+// newRejectCache creates an empty cache for up to size transactions
+func newRejectCache(size int) *rejectCache {
+	return &rejectCache{
+		reasons: make(map[common.Hash]error, size),
+		order:   make([]common.Hash, 0, size),
+	}
+}
+
+// add records the reason a transaction was rejected for
+func (c *rejectCache) add(hash common.Hash, reason error) {
+	if _, exists := c.reasons[hash]; exists {
+		c.reasons[hash] = reason
+		return
+	}
+	if len(c.order) < cap(c.order) {
+		c.order = append(c.order, hash)
+	} else {
+		delete(c.reasons, c.order[c.next])
+		c.order[c.next] = hash
+		c.next = (c.next + 1) % len(c.order)
+	}
+	c.reasons[hash] = reason
+}
+
+// get returns the reason a transaction was rejected for, nil if it was not
+func (c *rejectCache) get(hash common.Hash) error {
+	return c.reasons[hash]
+}
+
+// len returns the number of cached transactions
+func (c *rejectCache) len() int {
+	return len(c.reasons)
+}
+
+// Rejected returns an error wrapping ErrRecentlyRejected if the transaction
+// with the given hash was rejected as invalid recently, nil otherwise.
+// Callers can check it before the costly validation of a resubmitted
+// transaction, like recovering its sender.
+func (mp *Mempool) Rejected(hash common.Hash) error {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	return mp.rejectedErr(hash)
+}
+
+// MarkRejected records a transaction that was found invalid outside the
+// pool, for example because its signature is invalid, see Rejected
+func (mp *Mempool) MarkRejected(hash common.Hash, reason error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.rejected.add(hash, reason)
+}
+
+// rejectedErr returns the error for a recently rejected transaction, nil if
+// it is not cached. The caller must hold mp.mu.
+func (mp *Mempool) rejectedErr(hash common.Hash) error {
+	if reason := mp.rejected.get(hash); reason != nil {
+		return fmt.Errorf("%w: %v", ErrRecentlyRejected, reason)
+	}
+	return nil
+}
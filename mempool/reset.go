@@ -0,0 +1,118 @@
+package mempool
+
+import (
+	"math/big"
+
+	"blockchain-node/core"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// HandleChainHead updates the pool after the canonical head changed.
+// The base fee of the next block, by which transactions are ordered for
+// mining, is updated and a raised fee floor decays. Transactions included in the new blocks are removed. Those of blocks
+// that a reorg removed from the chain, and that the new chain does not
+// include, are added back. Finally every pooled transaction is checked
+// against the new head state: stale nonces and transactions the sender can
+// no longer pay for are dropped.
+func (mp *Mempool) HandleChainHead(ev core.ChainHeadEvent) {
+	defer mp.sendEvents()
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	mp.baseFee = core.CalcBaseFee(ev.Head.Header)
+	mp.head = ev.Head.Header.Number.Uint64()
+	mp.decayFloor()
+
+	included := make(map[common.Hash]bool)
+	for _, block := range ev.Added {
+		for _, tx := range block.Transactions {
+			included[tx.Hash] = true
+			if pooled, exists := mp.all[tx.Hash]; exists {
+				mp.removeTx(pooled)
+			}
+		}
+	}
+
+	var orphaned []*core.Transaction
+	for _, block := range ev.Removed {
+		for _, tx := range block.Transactions {
+			if included[tx.Hash] {
+				continue
+			}
+			from, err := core.Sender(tx)
+			if err != nil {
+				continue
+			}
+			tx.From = from
+			orphaned = append(orphaned, tx)
+		}
+	}
+	reinjected := 0
+	for _, err := range mp.addBatch(orphaned, false) {
+		if err == nil {
+			reinjected++
+		}
+	}
+
+	size := len(mp.all)
+	for _, from := range mp.senderList() {
+		mp.demoteUnpayable(from)
+		mp.reorganize(from)
+	}
+
+	if len(ev.Removed) > 0 || len(mp.all) < size {
+		mp.logger.Debug("Mempool updated for new head",
+			"number", ev.Head.Header.Number.String(),
+			"removedBlocks", len(ev.Removed),
+			"reinjected", reinjected,
+			"dropped", size-len(mp.all),
+			"mempoolSize", len(mp.all))
+	}
+}
+
+// demoteUnpayable drops the pooled transactions of a sender that no longer
+// fit into the next block, or that the sender's balance in the head state
+// cannot pay for after the kept transactions with lower nonces. The caller
+// must hold mp.mu and reorganize the sender afterwards.
+func (mp *Mempool) demoteUnpayable(from common.Address) {
+	if mp.state == nil {
+		return
+	}
+	gasLimit := uint64(0)
+	if head := mp.state.CurrentHeader(); head != nil {
+		gasLimit = mp.blockGasLimit(head)
+	}
+	balance := mp.state.GetSpendableBalance(from)
+	spent := new(big.Int)
+	// Pending transactions come before the queued ones in nonce order
+	for _, lists := range []map[common.Address]*txList{mp.pending, mp.queued} {
+		list := lists[from]
+		if list == nil {
+			continue
+		}
+		for _, tx := range list.flatten() {
+			cost := txCost(tx)
+			if (gasLimit > 0 && tx.GasLimit > gasLimit) || balance.Cmp(new(big.Int).Add(spent, cost)) < 0 {
+				mp.removeTx(tx)
+				mp.dropEvent(tx, DropInvalid)
+				continue
+			}
+			spent.Add(spent, cost)
+		}
+	}
+}
+
+// senderList returns every sender with pooled transactions
+func (mp *Mempool) senderList() []common.Address {
+	senders := make([]common.Address, 0, len(mp.pending)+len(mp.queued))
+	for from := range mp.pending {
+		senders = append(senders, from)
+	}
+	for from := range mp.queued {
+		if _, exists := mp.pending[from]; !exists {
+			senders = append(senders, from)
+		}
+	}
+	return senders
+}
@@ -26,6 +26,10 @@ type Metrics struct {
 	TotalTransactions uint64    `json:"total_transactions"`
 	MempoolSize       int       `json:"mempool_size"`
 	PeerCount         int       `json:"peer_count"`
+
+	// Sync metrics
+	Syncing          bool   `json:"syncing"`
+	SyncHighestBlock uint64 `json:"sync_highest_block"`
 	
 	// Mining metrics
 	HashRate          float64   `json:"hash_rate"`
@@ -49,10 +53,81 @@ type Metrics struct {
 	MemoryUsage       uint64    `json:"memory_usage_bytes"`
 	CPUUsage          float64   `json:"cpu_usage_percent"`
 	
+	// State database metrics
+	State StateMetrics `json:"state"`
+
+	// Database operation metrics
+	Database DatabaseMetrics `json:"database"`
+	
 	// Custom metrics
 	CustomMetrics map[string]interface{} `json:"custom_metrics"`
 }
 
+// StateMetrics holds the state database counters, totals since the node
+// started
+type StateMetrics struct {
+	AccountCacheHits   uint64 `json:"account_cache_hits"`
+	AccountCacheMisses uint64 `json:"account_cache_misses"`
+	StorageCacheHits   uint64 `json:"storage_cache_hits"`
+	StorageCacheMisses uint64 `json:"storage_cache_misses"`
+	CodeCacheHits      uint64 `json:"code_cache_hits"`
+	CodeCacheMisses    uint64 `json:"code_cache_misses"`
+
+	AccountReads  uint64 `json:"account_reads"`
+	StorageReads  uint64 `json:"storage_reads"`
+	AccountWrites uint64 `json:"account_writes"`
+	StorageWrites uint64 `json:"storage_writes"`
+
+	Commits        uint64        `json:"commits"`
+	CommitTime     time.Duration `json:"commit_time_ns"`
+	LastCommitTime time.Duration `json:"last_commit_time_ns"`
+
+	TrieNodesCommitted uint64 `json:"trie_nodes_committed"`
+	TrieNodesPruned    uint64 `json:"trie_nodes_pruned"`
+}
+
+// DatabaseMetrics holds the database operation counters, totals since the
+// node started, and the compaction statistics of backends that report them
+type DatabaseMetrics struct {
+	Get        DatabaseOpMetrics `json:"get"`
+	Put        DatabaseOpMetrics `json:"put"`
+	Delete     DatabaseOpMetrics `json:"delete"`
+	BatchWrite DatabaseOpMetrics `json:"batch_write"`
+
+	Compactions     uint64        `json:"compactions"`
+	CompactionTime  time.Duration `json:"compaction_time_ns"`
+	CompactionRead  int64         `json:"compaction_read_bytes"`
+	CompactionWrite int64         `json:"compaction_write_bytes"`
+	WriteDelays     uint64        `json:"write_delays"`
+	WriteDelayTime  time.Duration `json:"write_delay_time_ns"`
+	LevelSizes      []int64       `json:"level_sizes_bytes,omitempty"`
+}
+
+// DatabaseOpMetrics holds the counters of one kind of database operation
+type DatabaseOpMetrics struct {
+	Count   uint64    `json:"count"`
+	Entries uint64    `json:"entries"`
+	Bytes   uint64    `json:"bytes"`
+	Latency Histogram `json:"latency"`
+}
+
+// Histogram counts observations by bucket, Buckets[i] counts those up to
+// Bounds[i]
+type Histogram struct {
+	Bounds  []time.Duration `json:"bounds_ns"`
+	Buckets []uint64        `json:"buckets"`
+	Count   uint64          `json:"count"`
+	Sum     time.Duration   `json:"sum_ns"`
+}
+
+// hitRatio returns the share of lookups served by a cache, 0 without lookups
+func hitRatio(hits, misses uint64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
 // Init initializes the metrics system
 func Init(config *config.MetricsConfig) *Metrics {
 	metrics := &Metrics{
@@ -155,6 +230,18 @@ func (m *Metrics) handlePrometheusMetrics(w http.ResponseWriter, r *http.Request
 	fmt.Fprintf(w, "# TYPE lumina_peer_count gauge\n")
 	fmt.Fprintf(w, "lumina_peer_count %d\n", m.PeerCount)
 
+	syncing := 0
+	if m.Syncing {
+		syncing = 1
+	}
+	fmt.Fprintf(w, "# HELP lumina_syncing Whether the node is catching up with its peers\n")
+	fmt.Fprintf(w, "# TYPE lumina_syncing gauge\n")
+	fmt.Fprintf(w, "lumina_syncing %d\n", syncing)
+
+	fmt.Fprintf(w, "# HELP lumina_sync_highest_block Head block number of the peer last synced with\n")
+	fmt.Fprintf(w, "# TYPE lumina_sync_highest_block gauge\n")
+	fmt.Fprintf(w, "lumina_sync_highest_block %d\n", m.SyncHighestBlock)
+
 	fmt.Fprintf(w, "# HELP lumina_hash_rate Current mining hash rate\n")
 	fmt.Fprintf(w, "# TYPE lumina_hash_rate gauge\n")
 	fmt.Fprintf(w, "lumina_hash_rate %f\n", m.HashRate)
@@ -178,6 +265,134 @@ func (m *Metrics) handlePrometheusMetrics(w http.ResponseWriter, r *http.Request
 	fmt.Fprintf(w, "# HELP lumina_messages_received_total Total messages received from peers\n")
 	fmt.Fprintf(w, "# TYPE lumina_messages_received_total counter\n")
 	fmt.Fprintf(w, "lumina_messages_received_total %d\n", m.MessagesReceived)
+
+	m.writePrometheusState(w)
+	m.writePrometheusDatabase(w)
+}
+
+// writePrometheusState writes the state database metrics. The caller must
+// hold m.mu.
+func (m *Metrics) writePrometheusState(w http.ResponseWriter) {
+	s := m.State
+
+	fmt.Fprintf(w, "# HELP lumina_state_cache_hits_total State cache lookups served from memory\n")
+	fmt.Fprintf(w, "# TYPE lumina_state_cache_hits_total counter\n")
+	fmt.Fprintf(w, "lumina_state_cache_hits_total{cache=\"account\"} %d\n", s.AccountCacheHits)
+	fmt.Fprintf(w, "lumina_state_cache_hits_total{cache=\"storage\"} %d\n", s.StorageCacheHits)
+	fmt.Fprintf(w, "lumina_state_cache_hits_total{cache=\"code\"} %d\n", s.CodeCacheHits)
+
+	fmt.Fprintf(w, "# HELP lumina_state_cache_misses_total State cache lookups that went to the database\n")
+	fmt.Fprintf(w, "# TYPE lumina_state_cache_misses_total counter\n")
+	fmt.Fprintf(w, "lumina_state_cache_misses_total{cache=\"account\"} %d\n", s.AccountCacheMisses)
+	fmt.Fprintf(w, "lumina_state_cache_misses_total{cache=\"storage\"} %d\n", s.StorageCacheMisses)
+	fmt.Fprintf(w, "lumina_state_cache_misses_total{cache=\"code\"} %d\n", s.CodeCacheMisses)
+
+	fmt.Fprintf(w, "# HELP lumina_state_cache_hit_ratio Share of state cache lookups served from memory\n")
+	fmt.Fprintf(w, "# TYPE lumina_state_cache_hit_ratio gauge\n")
+	fmt.Fprintf(w, "lumina_state_cache_hit_ratio{cache=\"account\"} %f\n", hitRatio(s.AccountCacheHits, s.AccountCacheMisses))
+	fmt.Fprintf(w, "lumina_state_cache_hit_ratio{cache=\"storage\"} %f\n", hitRatio(s.StorageCacheHits, s.StorageCacheMisses))
+	fmt.Fprintf(w, "lumina_state_cache_hit_ratio{cache=\"code\"} %f\n", hitRatio(s.CodeCacheHits, s.CodeCacheMisses))
+
+	fmt.Fprintf(w, "# HELP lumina_state_reads_total State entries read from the database\n")
+	fmt.Fprintf(w, "# TYPE lumina_state_reads_total counter\n")
+	fmt.Fprintf(w, "lumina_state_reads_total{kind=\"account\"} %d\n", s.AccountReads)
+	fmt.Fprintf(w, "lumina_state_reads_total{kind=\"storage\"} %d\n", s.StorageReads)
+
+	fmt.Fprintf(w, "# HELP lumina_state_writes_total State entries written by commits\n")
+	fmt.Fprintf(w, "# TYPE lumina_state_writes_total counter\n")
+	fmt.Fprintf(w, "lumina_state_writes_total{kind=\"account\"} %d\n", s.AccountWrites)
+	fmt.Fprintf(w, "lumina_state_writes_total{kind=\"storage\"} %d\n", s.StorageWrites)
+
+	fmt.Fprintf(w, "# HELP lumina_state_commits_total State commits\n")
+	fmt.Fprintf(w, "# TYPE lumina_state_commits_total counter\n")
+	fmt.Fprintf(w, "lumina_state_commits_total %d\n", s.Commits)
+
+	fmt.Fprintf(w, "# HELP lumina_state_commit_seconds_total Time spent committing state\n")
+	fmt.Fprintf(w, "# TYPE lumina_state_commit_seconds_total counter\n")
+	fmt.Fprintf(w, "lumina_state_commit_seconds_total %f\n", s.CommitTime.Seconds())
+
+	fmt.Fprintf(w, "# HELP lumina_state_last_commit_seconds Duration of the last state commit\n")
+	fmt.Fprintf(w, "# TYPE lumina_state_last_commit_seconds gauge\n")
+	fmt.Fprintf(w, "lumina_state_last_commit_seconds %f\n", s.LastCommitTime.Seconds())
+
+	fmt.Fprintf(w, "# HELP lumina_state_trie_nodes_committed_total Trie nodes stored by state commits\n")
+	fmt.Fprintf(w, "# TYPE lumina_state_trie_nodes_committed_total counter\n")
+	fmt.Fprintf(w, "lumina_state_trie_nodes_committed_total %d\n", s.TrieNodesCommitted)
+
+	fmt.Fprintf(w, "# HELP lumina_state_trie_nodes_pruned_total Unreachable trie nodes deleted\n")
+	fmt.Fprintf(w, "# TYPE lumina_state_trie_nodes_pruned_total counter\n")
+	fmt.Fprintf(w, "lumina_state_trie_nodes_pruned_total %d\n", s.TrieNodesPruned)
+}
+
+// writePrometheusDatabase writes the database metrics. The caller must hold
+// m.mu.
+func (m *Metrics) writePrometheusDatabase(w http.ResponseWriter) {
+	d := m.Database
+	ops := []struct {
+		name string
+		op   DatabaseOpMetrics
+	}{{"get", d.Get}, {"put", d.Put}, {"delete", d.Delete}, {"batch_write", d.BatchWrite}}
+
+	fmt.Fprintf(w, "# HELP lumina_db_operations_total Database operations\n")
+	fmt.Fprintf(w, "# TYPE lumina_db_operations_total counter\n")
+	for _, o := range ops {
+		fmt.Fprintf(w, "lumina_db_operations_total{op=\"%s\"} %d\n", o.name, o.op.Count)
+	}
+
+	fmt.Fprintf(w, "# HELP lumina_db_entries_total Database entries read or written, batch writes count every entry\n")
+	fmt.Fprintf(w, "# TYPE lumina_db_entries_total counter\n")
+	for _, o := range ops {
+		fmt.Fprintf(w, "lumina_db_entries_total{op=\"%s\"} %d\n", o.name, o.op.Entries)
+	}
+
+	fmt.Fprintf(w, "# HELP lumina_db_bytes_total Bytes of keys and values read or written\n")
+	fmt.Fprintf(w, "# TYPE lumina_db_bytes_total counter\n")
+	for _, o := range ops {
+		fmt.Fprintf(w, "lumina_db_bytes_total{op=\"%s\"} %d\n", o.name, o.op.Bytes)
+	}
+
+	fmt.Fprintf(w, "# HELP lumina_db_operation_duration_seconds Duration of database operations\n")
+	fmt.Fprintf(w, "# TYPE lumina_db_operation_duration_seconds histogram\n")
+	for _, o := range ops {
+		h := o.op.Latency
+		for i, bound := range h.Bounds {
+			fmt.Fprintf(w, "lumina_db_operation_duration_seconds_bucket{op=\"%s\",le=\"%g\"} %d\n", o.name, bound.Seconds(), h.Buckets[i])
+		}
+		fmt.Fprintf(w, "lumina_db_operation_duration_seconds_bucket{op=\"%s\",le=\"+Inf\"} %d\n", o.name, h.Count)
+		fmt.Fprintf(w, "lumina_db_operation_duration_seconds_sum{op=\"%s\"} %f\n", o.name, h.Sum.Seconds())
+		fmt.Fprintf(w, "lumina_db_operation_duration_seconds_count{op=\"%s\"} %d\n", o.name, h.Count)
+	}
+
+	fmt.Fprintf(w, "# HELP lumina_db_size_bytes Size of the database files\n")
+	fmt.Fprintf(w, "# TYPE lumina_db_size_bytes gauge\n")
+	fmt.Fprintf(w, "lumina_db_size_bytes %d\n", m.DatabaseSize)
+
+	fmt.Fprintf(w, "# HELP lumina_db_level_size_bytes Size of the table files per level\n")
+	fmt.Fprintf(w, "# TYPE lumina_db_level_size_bytes gauge\n")
+	for level, size := range d.LevelSizes {
+		fmt.Fprintf(w, "lumina_db_level_size_bytes{level=\"%d\"} %d\n", level, size)
+	}
+
+	fmt.Fprintf(w, "# HELP lumina_db_compactions_total Database compactions\n")
+	fmt.Fprintf(w, "# TYPE lumina_db_compactions_total counter\n")
+	fmt.Fprintf(w, "lumina_db_compactions_total %d\n", d.Compactions)
+
+	fmt.Fprintf(w, "# HELP lumina_db_compaction_seconds_total Time spent compacting\n")
+	fmt.Fprintf(w, "# TYPE lumina_db_compaction_seconds_total counter\n")
+	fmt.Fprintf(w, "lumina_db_compaction_seconds_total %f\n", d.CompactionTime.Seconds())
+
+	fmt.Fprintf(w, "# HELP lumina_db_compaction_bytes_total Bytes read and written by compactions\n")
+	fmt.Fprintf(w, "# TYPE lumina_db_compaction_bytes_total counter\n")
+	fmt.Fprintf(w, "lumina_db_compaction_bytes_total{kind=\"read\"} %d\n", d.CompactionRead)
+	fmt.Fprintf(w, "lumina_db_compaction_bytes_total{kind=\"write\"} %d\n", d.CompactionWrite)
+
+	fmt.Fprintf(w, "# HELP lumina_db_write_delays_total Writes delayed by compactions\n")
+	fmt.Fprintf(w, "# TYPE lumina_db_write_delays_total counter\n")
+	fmt.Fprintf(w, "lumina_db_write_delays_total %d\n", d.WriteDelays)
+
+	fmt.Fprintf(w, "# HELP lumina_db_write_delay_seconds_total Time writes were delayed by compactions\n")
+	fmt.Fprintf(w, "# TYPE lumina_db_write_delay_seconds_total counter\n")
+	fmt.Fprintf(w, "lumina_db_write_delay_seconds_total %f\n", d.WriteDelayTime.Seconds())
 }
 
 // handleHealth handles health check requests
@@ -219,6 +434,13 @@ func (m *Metrics) UpdatePeerCount(count int) {
 	m.PeerCount = count
 }
 
+func (m *Metrics) UpdateSyncStatus(syncing bool, highest uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Syncing = syncing
+	m.SyncHighestBlock = highest
+}
+
 func (m *Metrics) UpdateMiningHashRate(hashRate float64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -286,6 +508,18 @@ func (m *Metrics) UpdateCPUUsage(usage float64) {
 	m.CPUUsage = usage
 }
 
+func (m *Metrics) UpdateStateMetrics(state StateMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.State = state
+}
+
+func (m *Metrics) UpdateDatabaseMetrics(database DatabaseMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Database = database
+}
+
 func (m *Metrics) SetCustomMetric(key string, value interface{}) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -325,6 +559,8 @@ func (m *Metrics) Reset() {
 	m.TotalTransactions = 0
 	m.MempoolSize = 0
 	m.PeerCount = 0
+	m.Syncing = false
+	m.SyncHighestBlock = 0
 	m.HashRate = 0
 	m.BlocksMinedCount = 0
 	m.MiningDifficulty = 0
@@ -338,6 +574,8 @@ func (m *Metrics) Reset() {
 	m.StartTime = time.Now()
 	m.MemoryUsage = 0
 	m.CPUUsage = 0
+	m.State = StateMetrics{}
+	m.Database = DatabaseMetrics{}
 	m.CustomMetrics = make(map[string]interface{})
 
 	m.logger.Info("Metrics reset")
@@ -0,0 +1,478 @@
+package miner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"blockchain-node/consensus"
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+	"blockchain-node/logger"
+	"blockchain-node/mempool"
+)
+
+const (
+	// DefaultRecommit is how long a block template is reused at most before
+	// a new one picks up the current time and pending transactions
+	DefaultRecommit = 5 * time.Second
+
+	// maxTemplateTxs is the number of transactions a template takes from
+	// the mempool at most
+	maxTemplateTxs = 1000
+
+	// retryDelay is how long the sealing loop waits after failing to
+	// prepare a template
+	retryDelay = time.Second
+)
+
+var (
+	// ErrNotProofOfWork is returned by Start for engines that are not
+	// sealed by grinding nonces
+	ErrNotProofOfWork = errors.New("sealing requires the proof-of-work engine")
+
+	// ErrSyncing is returned by Ready while the node is behind its peers
+	ErrSyncing = errors.New("node is syncing")
+
+	// ErrTooFewPeers is returned by Ready while the node has fewer peers
+	// than configured
+	ErrTooFewPeers = errors.New("too few peers")
+)
+
+// Config holds the settings of the miner
+type Config struct {
+	Coinbase       crypto.Address // address the block rewards are paid to
+	GasLimitTarget uint64         // gas limit new blocks move toward
+	Recommit       time.Duration  // maximum age of a cached template, DefaultRecommit if zero
+	MinPeers       int            // peers needed to produce blocks, 0 to produce blocks alone
+	Dev            bool           // seal blocks only when due, see DevPeriod
+	DevPeriod      time.Duration  // interval of development blocks, 0 to seal as soon as transactions are pending
+}
+
+// SyncStatus reports whether the node is caught up with the network
+type SyncStatus interface {
+	// Syncing reports whether the node is behind its peers
+	Syncing() bool
+
+	// PeerCount returns the number of connected peers
+	PeerCount() int
+}
+
+// Miner builds block templates on top of the chain head and seals them
+// with the proof-of-work engine. The current template is cached until the
+// head or the pending transactions change, so that external miners polling
+// for work and the local sealing loop share it.
+type Miner struct {
+	config *Config
+	chain  *core.Blockchain
+	pool   *mempool.Mempool
+	engine consensus.Engine
+	pow    *consensus.ProofOfWork  // nil unless sealing is possible
+	pos    *consensus.ProofOfStake // nil unless uncles are slashing evidence
+	status SyncStatus              // nil if blocks are always produced
+	logger *logger.Logger
+
+	mu       sync.Mutex
+	coinbase crypto.Address
+	pending  *core.Block   // cached template, nil if none
+	created  time.Time     // creation time of pending
+	dirty    bool          // pending transactions changed since pending was built
+	wake     chan struct{} // signalled when the pending transactions change
+
+	// Sealing, aborted when the head moves away from sealParent
+	sealMu     sync.Mutex
+	sealParent crypto.Hash
+	sealCancel context.CancelFunc
+
+	runMu    sync.Mutex
+	cancel   context.CancelFunc // stops the sealing loop, nil if not running
+	done     chan struct{}      // closed when the sealing loop returned
+	hashRate float64
+
+	sealedMu sync.Mutex
+	sealed   []func(*core.Block)
+}
+
+// New creates a miner building blocks on chain with the transactions of
+// pool, and keeps its template in sync with both
+func New(config *Config, chain *core.Blockchain, pool *mempool.Mempool, engine consensus.Engine) *Miner {
+	if config.Recommit <= 0 {
+		config.Recommit = DefaultRecommit
+	}
+
+	m := &Miner{
+		config:   config,
+		chain:    chain,
+		pool:     pool,
+		engine:   engine,
+		logger:   logger.NewLogger("miner"),
+		coinbase: config.Coinbase,
+		wake:     make(chan struct{}, 1),
+	}
+	m.pow, _ = engine.(*consensus.ProofOfWork)
+	m.pos, _ = engine.(*consensus.ProofOfStake)
+
+	chain.SubscribeChainHead(m.handleChainHead)
+	pool.SubscribeTxEvents(func(mempool.TxEvent) {
+		m.mu.Lock()
+		m.dirty = true
+		m.mu.Unlock()
+		select {
+		case m.wake <- struct{}{}:
+		default:
+		}
+	})
+	return m
+}
+
+// Start starts sealing blocks in the background
+func (m *Miner) Start() error {
+	if m.pow == nil {
+		return ErrNotProofOfWork
+	}
+
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	if m.cancel != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel, m.done = cancel, make(chan struct{})
+	go m.loop(ctx, m.done)
+
+	m.logger.Info("Mining started", "coinbase", m.Coinbase().Hex(), "difficulty", m.pow.GetDifficulty().String())
+	return nil
+}
+
+// Stop stops sealing and waits for the block being sealed to be abandoned
+func (m *Miner) Stop() {
+	m.runMu.Lock()
+	cancel, done := m.cancel, m.done
+	m.cancel, m.done = nil, nil
+	m.runMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+		m.logger.Info("Mining stopped")
+	}
+}
+
+// Mining reports whether blocks are being sealed
+func (m *Miner) Mining() bool {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	return m.cancel != nil
+}
+
+// HashRate returns the number of seal hashes per second of the last
+// sealing attempt
+func (m *Miner) HashRate() float64 {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	return m.hashRate
+}
+
+// Coinbase returns the address the rewards of new blocks are paid to
+func (m *Miner) Coinbase() crypto.Address {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.coinbase
+}
+
+// SetCoinbase sets the address the rewards of new blocks are paid to. The
+// cached template is dropped, the block being sealed keeps its coinbase.
+func (m *Miner) SetCoinbase(addr crypto.Address) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.coinbase = addr
+	m.pending = nil
+}
+
+// SetSyncStatus sets the source Ready checks, so that a node that is behind
+// or isolated does not produce blocks nobody builds on
+func (m *Miner) SetSyncStatus(status SyncStatus) {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	m.status = status
+}
+
+// Ready returns nil if blocks should be produced, or why not
+func (m *Miner) Ready() error {
+	m.runMu.Lock()
+	status := m.status
+	m.runMu.Unlock()
+
+	if status == nil {
+		return nil
+	}
+	if status.Syncing() {
+		return ErrSyncing
+	}
+	if peers := status.PeerCount(); peers < m.config.MinPeers {
+		return fmt.Errorf("%w: have %d, want %d", ErrTooFewPeers, peers, m.config.MinPeers)
+	}
+	return nil
+}
+
+// SubscribeSealed registers fn to be called with every block sealed by the
+// miner, once it was added to the chain
+func (m *Miner) SubscribeSealed(fn func(*core.Block)) {
+	m.sealedMu.Lock()
+	defer m.sealedMu.Unlock()
+	m.sealed = append(m.sealed, fn)
+}
+
+// Pending returns a copy of the current block template, building a new one
+// if there is none yet, the head or the pending transactions changed or it
+// is older than the recommit interval
+func (m *Miner) Pending() (*core.Block, error) {
+	m.mu.Lock()
+	head := m.chain.GetCurrentBlock()
+	var failed map[crypto.Hash]error
+	if m.pending == nil || m.dirty || m.pending.Header.PreviousHash != head.Hash ||
+		time.Since(m.created) > m.config.Recommit {
+		block, dropped, err := m.buildTemplate(head, m.coinbase)
+		if err != nil {
+			m.mu.Unlock()
+			return nil, err
+		}
+		m.pending, m.created, m.dirty = block, time.Now(), false
+		failed = dropped
+	}
+	block := copyBlock(m.pending)
+	m.mu.Unlock()
+
+	// The pool notifies the miner of the removal, which takes m.mu
+	m.dropFailed(failed)
+	return block, nil
+}
+
+// NewTemplate builds a new block template on top of the head without
+// touching the cached one
+func (m *Miner) NewTemplate() (*core.Block, error) {
+	block, failed, err := m.buildTemplate(m.chain.GetCurrentBlock(), m.Coinbase())
+	if err != nil {
+		return nil, err
+	}
+	m.dropFailed(failed)
+	return block, nil
+}
+
+// dropFailed removes the transactions a template left out because they
+// failed from the pool, so that they do not end up in the next template
+// again
+func (m *Miner) dropFailed(failed map[crypto.Hash]error) {
+	if len(failed) == 0 {
+		return
+	}
+	hashes := make([]crypto.Hash, 0, len(failed))
+	for hash, reason := range failed {
+		m.logger.Debug("Dropping unexecutable transaction", "hash", hash.Hex(), "reason", reason)
+		m.pool.MarkRejected(hash, reason)
+		hashes = append(hashes, hash)
+	}
+	m.pool.RemoveTransactions(hashes)
+}
+
+// buildTemplate creates an unsealed block on top of head, filled with
+// pending transactions up to its gas limit and including recent competing
+// blocks as uncles, or as slashing evidence under proof-of-stake. It also
+// returns why pending transactions that failed were left out.
+func (m *Miner) buildTemplate(head *core.Block, coinbase crypto.Address) (*core.Block, map[crypto.Hash]error, error) {
+	header := &core.BlockHeader{
+		PreviousHash: head.Hash,
+		Number:       new(big.Int).Add(head.Header.Number, big.NewInt(1)),
+		GasLimit:     consensus.CalcGasLimit(head.Header.GasLimit, m.config.GasLimitTarget),
+		Timestamp:    uint64(time.Now().Unix()),
+		Coinbase:     coinbase,
+		BaseFee:      core.CalcBaseFee(head.Header),
+	}
+	txs := m.pool.GetPendingTransactionsForMining(maxTemplateTxs, header.GasLimit)
+	uncles := m.chain.UncleCandidates(head.Hash)
+	if m.pos != nil {
+		uncles = m.pos.Evidence(m.chain, head.Hash, uncles)
+	}
+
+	// Let the consensus engine fill in difficulty and timestamp
+	if err := m.engine.Prepare(m.chain, header); err != nil {
+		return nil, nil, fmt.Errorf("failed to prepare block: %v", err)
+	}
+
+	// The header commits to the transactions, their receipts, the gas used
+	// and the state after the block, which light nodes prove accounts
+	// against
+	block := core.NewBlockWithUncles(header, txs, uncles)
+	failed, err := m.chain.FillBlock(block)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to execute block: %v", err)
+	}
+	block.Hash = block.CalculateHash()
+	return block, failed, nil
+}
+
+// loop seals templates until ctx is cancelled
+func (m *Miner) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	paused := false
+	for ctx.Err() == nil {
+		// Wait until the node caught up with a connected network
+		if err := m.Ready(); err != nil {
+			if !paused {
+				m.logger.Warning("Mining paused", "reason", err)
+				paused = true
+				m.runMu.Lock()
+				m.hashRate = 0
+				m.runMu.Unlock()
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+		if paused {
+			m.logger.Info("Mining resumed")
+			paused = false
+		}
+
+		block, err := m.Pending()
+		if err != nil {
+			m.logger.Error("Failed to prepare block", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+		if m.config.Dev && !m.waitDevBlock(ctx, block) {
+			continue
+		}
+
+		sealCtx, cancel := m.beginSealing(ctx, block.Header.PreviousHash)
+
+		// Blocks must not be sealed ahead of the wall clock
+		if wait := time.Until(time.Unix(int64(block.Header.Timestamp), 0)); wait > 0 {
+			select {
+			case <-sealCtx.Done():
+			case <-time.After(wait):
+			}
+		}
+
+		// Mine the block, starting over once a block on top of the same
+		// parent arrives
+		start := time.Now()
+		err = m.pow.MineContext(sealCtx, block)
+		cancel()
+		elapsed := time.Since(start)
+		if elapsed > 0 {
+			m.runMu.Lock()
+			m.hashRate = float64(block.Header.Nonce) / elapsed.Seconds()
+			m.runMu.Unlock()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err == context.Canceled {
+			m.logger.Info("Sealing aborted, chain head changed", "number", block.Header.Number.String())
+			m.logger.Debug("Nonces tried before abort", "number", block.Header.Number.String(), "nonces", block.Header.Nonce)
+			continue
+		}
+		if err != nil {
+			m.logger.Error("Mining error", "error", err)
+			continue
+		}
+
+		if err := m.chain.AddBlock(block); err != nil {
+			m.logger.Error("Failed to add block", "number", block.Header.Number.String(), "error", err)
+			continue
+		}
+		m.logger.Info("New block mined", "number", block.Header.Number.String(), "hash", block.Hash.Hex(),
+			"transactions", len(block.Transactions), "elapsed", elapsed)
+
+		m.sealedMu.Lock()
+		subs := append([]func(*core.Block){}, m.sealed...)
+		m.sealedMu.Unlock()
+		for _, fn := range subs {
+			fn(block)
+		}
+	}
+}
+
+// waitDevBlock reports whether the development block template block is
+// due: timestamped DevPeriod after its parent, or with a zero period as soon
+// as it holds transactions. Otherwise it waits until that may have changed
+// and returns false.
+func (m *Miner) waitDevBlock(ctx context.Context, block *core.Block) bool {
+	var timer <-chan time.Time
+	if m.config.DevPeriod > 0 {
+		parent := m.chain.GetHeader(block.Header.PreviousHash)
+		if parent == nil {
+			return true
+		}
+		due := time.Unix(int64(parent.Timestamp), 0).Add(m.config.DevPeriod)
+		if !time.Unix(int64(block.Header.Timestamp), 0).Before(due) {
+			return true
+		}
+		// The template is built again with the time the block is due
+		m.mu.Lock()
+		m.pending = nil
+		m.mu.Unlock()
+		timer = time.After(time.Until(due))
+	} else if len(block.Transactions) > 0 {
+		return true
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-timer:
+	case <-m.wake:
+	}
+	return false
+}
+
+// beginSealing returns the context for sealing a block on top of parent,
+// cancelled as soon as the chain head moves away from parent
+func (m *Miner) beginSealing(ctx context.Context, parent crypto.Hash) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	m.sealMu.Lock()
+	m.sealParent, m.sealCancel = parent, cancel
+	m.sealMu.Unlock()
+
+	// The head may have moved while the block was prepared
+	if m.chain.GetCurrentBlock().Hash != parent {
+		cancel()
+	}
+	return ctx, cancel
+}
+
+// handleChainHead drops the cached template and stops sealing if the new
+// head is not the parent being sealed on
+func (m *Miner) handleChainHead(ev core.ChainHeadEvent) {
+	m.mu.Lock()
+	m.pending = nil
+	m.mu.Unlock()
+
+	m.sealMu.Lock()
+	defer m.sealMu.Unlock()
+	if m.sealCancel != nil && ev.Head.Hash != m.sealParent {
+		m.sealCancel()
+	}
+}
+
+// copyBlock returns a copy of a template that can be sealed without
+// changing the original
+func copyBlock(block *core.Block) *core.Block {
+	header := *block.Header
+	header.ExtraData = append([]byte(nil), block.Header.ExtraData...)
+	copied := core.NewBlock(&header, block.Transactions)
+	copied.Uncles = block.Uncles
+	return copied
+}
@@ -0,0 +1,56 @@
+package node
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"blockchain-node/storage"
+)
+
+// errBackupRunning is returned by Backup while an earlier backup is still
+// being written
+var errBackupRunning = errors.New("backup already running")
+
+// Backup snapshots the database and copies the snapshot to dir in the
+// background, so the node keeps importing blocks meanwhile. Only one backup
+// runs at a time, its outcome is logged.
+func (n *Node) Backup(dir string) error {
+	if !atomic.CompareAndSwapInt32(&n.backingUp, 0, 1) {
+		return errBackupRunning
+	}
+	if err := storage.CheckBackupDir(dir); err != nil {
+		atomic.StoreInt32(&n.backingUp, 0)
+		return err
+	}
+	snap, err := n.blockchain.NewSnapshot()
+	if err != nil {
+		atomic.StoreInt32(&n.backingUp, 0)
+		return err
+	}
+
+	n.logger.Info("Backup started", "dir", dir)
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		defer atomic.StoreInt32(&n.backingUp, 0)
+		defer snap.Release()
+
+		start := time.Now()
+		count, err := storage.Backup(n.ctx, snap, n.config.DB.Type, dir)
+		if err != nil {
+			n.logger.Error("Backup failed", "dir", dir, "error", err)
+			return
+		}
+		// Taken after the snapshot, the freezer copy holds every block the
+		// snapshot lacks
+		if n.freezer != nil {
+			if err := n.freezer.Backup(storage.FreezerDir(dir)); err != nil {
+				n.logger.Error("Backup failed", "dir", dir, "error", err)
+				return
+			}
+		}
+		n.logger.Info("Backup completed", "dir", dir, "entries", count, "elapsed", time.Since(start))
+	}()
+	return nil
+}
@@ -0,0 +1,56 @@
+package node
+
+import (
+	"blockchain-node/config"
+	"blockchain-node/consensus"
+	"blockchain-node/core"
+	"blockchain-node/logger"
+	"blockchain-node/storage"
+)
+
+// Chain is the blockchain of a data directory opened by an offline tool,
+// without the services of a node
+type Chain struct {
+	*core.Blockchain
+	db storage.Database
+}
+
+// OpenChain opens the chain of the data directory configured in cfg with
+// the consensus engine and settings the node would use. Blocks added to it
+// are validated and executed like on a running node. The node must not be
+// running.
+func OpenChain(cfg *config.Config) (*Chain, error) {
+	cfg.ApplyMode()
+	log := logger.NewLogger("node")
+	db, freezer, err := openDatabase(&cfg.DB, false, log)
+	if err != nil {
+		return nil, err
+	}
+	blockchain, err := openBlockchain(cfg, db, log)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	var engine consensus.Engine
+	if chainConfig := blockchain.Config(); chainConfig.PoS != nil {
+		engine = consensus.NewProofOfStake(chainConfig.PoS)
+	} else {
+		engine = newProofOfWork(&cfg.Mining)
+	}
+	configureBlockchain(blockchain, cfg, freezer, engine)
+	return &Chain{Blockchain: blockchain, db: db}, nil
+}
+
+// OpenDatabase opens the database configured in cfg with its encryption
+// and freezer like the node, for maintenance tools. The freezer is nil when
+// it is disabled and is closed with the database. The node must not be
+// running.
+func OpenDatabase(cfg *config.DBConfig, readOnly bool) (storage.Database, *storage.Freezer, error) {
+	return openDatabase(cfg, readOnly, logger.NewLogger("node"))
+}
+
+// Close closes the database of the chain
+func (c *Chain) Close() error {
+	return c.db.Close()
+}
@@ -0,0 +1,80 @@
+package node
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+
+	"blockchain-node/accounts"
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+	"blockchain-node/logger"
+)
+
+// DevMnemonic is the mnemonic the accounts of a development chain are
+// derived from. Hardhat and Anvil use the same one, so their well-known
+// test keys and addresses work unchanged.
+const DevMnemonic = "test test test test test test test test test test test junk"
+
+// devBalance is the genesis balance of every development account, 10000
+// ether
+var devBalance = new(big.Int).Mul(big.NewInt(10000), big.NewInt(1e18))
+
+// devWallets derives the first count development accounts
+func devWallets(count int) ([]*crypto.Wallet, error) {
+	wallets := make([]*crypto.Wallet, count)
+	for i := range wallets {
+		path := append(append(crypto.DerivationPath{}, crypto.DefaultBaseDerivationPath...), uint32(i))
+		wallet, err := crypto.WalletFromMnemonic(DevMnemonic, "", path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive development account %d: %v", i, err)
+		}
+		wallets[i] = wallet
+	}
+	return wallets, nil
+}
+
+// allocDevAccounts funds the first count development accounts in genesis
+func allocDevAccounts(genesis *core.Genesis, count int) error {
+	wallets, err := devWallets(count)
+	if err != nil {
+		return err
+	}
+	for _, wallet := range wallets {
+		genesis.Alloc[wallet.Address] = core.GenesisAccount{Balance: new(big.Int).Set(devBalance)}
+	}
+	return nil
+}
+
+// openDevAccounts imports the first count development accounts into a new
+// temporary keystore and unlocks them. It returns the keystore directory,
+// which the caller removes when the node stops.
+func openDevAccounts(count int, log *logger.Logger) (*accounts.Manager, string, error) {
+	wallets, err := devWallets(count)
+	if err != nil {
+		return nil, "", err
+	}
+	dir, err := os.MkdirTemp("", "lumina-dev-keystore-")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create development keystore: %v", err)
+	}
+
+	am := accounts.NewManager(dir)
+	am.SetLightKDF(true)
+	for _, wallet := range wallets {
+		if _, err := am.Import(wallet, ""); err != nil {
+			os.RemoveAll(dir)
+			return nil, "", fmt.Errorf("failed to import development account: %v", err)
+		}
+		if err := am.Unlock(wallet.Address, "", 0); err != nil {
+			os.RemoveAll(dir)
+			return nil, "", fmt.Errorf("failed to unlock development account: %v", err)
+		}
+	}
+
+	log.Info("Development accounts are derived from mnemonic", "mnemonic", DevMnemonic)
+	for i, wallet := range wallets {
+		log.Info("Development account", "index", i, "address", wallet.Address.Hex(), "balance", "10000 ETH")
+	}
+	return am, dir, nil
+}
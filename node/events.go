@@ -0,0 +1,64 @@
+package node
+
+import (
+	"fmt"
+
+	"blockchain-node/core"
+	"blockchain-node/event"
+	"blockchain-node/mempool"
+)
+
+// publishMinedBlock publishes a block produced by this node, once it was
+// added to the chain
+func (n *Node) publishMinedBlock(block *core.Block) {
+	n.events.Mined.Send(event.MinedBlockEvent{Block: block})
+}
+
+// subscribeRelay announces new pooled transactions and the blocks produced
+// by this node to peers. Transactions are held back while the node syncs,
+// as it can not tell yet which of them the network already mined, and the
+// pending ones are announced once it caught up.
+func (n *Node) subscribeRelay() {
+	n.events.Tx.Subscribe(func(ev mempool.TxEvent) {
+		switch ev.Kind {
+		case mempool.TxAdded, mempool.TxReplaced:
+			if !n.Syncing() {
+				n.announceTx(ev.Tx)
+			}
+		}
+	})
+	n.events.Sync.Subscribe(func(ev event.SyncEvent) {
+		if ev.Syncing {
+			return
+		}
+		for _, tx := range n.mempool.GetPendingTransactions() {
+			n.announceTx(tx)
+		}
+	})
+	n.events.ChainHead.Subscribe(func(core.ChainHeadEvent) {
+		n.rebroadcastLocals()
+	})
+	n.events.Mined.Subscribe(func(ev event.MinedBlockEvent) {
+		n.p2pServer.BroadcastMessage([]byte(fmt.Sprintf("NEW_BLOCK:%x", ev.Block.Hash)))
+	})
+}
+
+// subscribeMetrics keeps the mempool, block and sync metrics current
+func (n *Node) subscribeMetrics() {
+	n.events.Sync.Subscribe(func(ev event.SyncEvent) {
+		n.metrics.UpdateSyncStatus(ev.Syncing, ev.Highest)
+	})
+	n.events.Tx.Subscribe(func(mempool.TxEvent) {
+		n.metrics.UpdateMempoolSize(n.mempool.Size())
+	})
+	n.events.ChainHead.Subscribe(func(core.ChainHeadEvent) {
+		// Mined transactions leave the mempool without a transaction event
+		n.metrics.UpdateMempoolSize(n.mempool.Size())
+	})
+	n.events.Mined.Subscribe(func(ev event.MinedBlockEvent) {
+		for range ev.Block.Transactions {
+			n.metrics.IncrementTransactions()
+		}
+		n.metrics.UpdateBlockHeight(ev.Block.Header.Number.Uint64())
+	})
+}
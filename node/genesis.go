@@ -0,0 +1,19 @@
+package node
+
+import (
+	"blockchain-node/config"
+	"blockchain-node/core"
+	"blockchain-node/logger"
+)
+
+// InitGenesis writes the genesis block, state and chain configuration of
+// genesis to the database configured in cfg, see core.SetupGenesis. The
+// node must not be running.
+func InitGenesis(cfg *config.Config, genesis *core.Genesis) (*core.Block, error) {
+	db, _, err := openDatabase(&cfg.DB, false, logger.NewLogger("node"))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return core.SetupGenesis(db, genesis)
+}
@@ -3,23 +3,52 @@ package node
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"blockchain-node/accounts"
 	"blockchain-node/config"
 	"blockchain-node/consensus"
 	"blockchain-node/core"
+	"blockchain-node/crypto"
+	"blockchain-node/downloader"
+	"blockchain-node/event"
+	"blockchain-node/evm"
+	"blockchain-node/gasprice"
+	"blockchain-node/light"
 	"blockchain-node/logger"
 	"blockchain-node/mempool"
 	"blockchain-node/metrics"
+	"blockchain-node/miner"
 	"blockchain-node/p2p"
 	"blockchain-node/rpc"
+	"blockchain-node/signer"
 	"blockchain-node/storage"
+	"blockchain-node/stratum"
+)
+
+const (
+	// coldMoveInterval is how often completed freezer files are moved to
+	// the cold store
+	coldMoveInterval = 10 * time.Minute
+
+	// peerWait is how long a node with seed nodes waits for a peer to sync
+	// with before it produces blocks on its local chain
+	peerWait = 30 * time.Second
+
+	// peerFile is the file in the data directory the addresses of outbound
+	// peers are saved to
+	peerFile = "peers.json"
 )
 
 // Node represents the blockchain node
@@ -27,26 +56,46 @@ type Node struct {
 	config     *config.Config
 	blockchain *core.Blockchain
 	mempool    *mempool.Mempool
-	consensus  *consensus.ProofOfWork
+	consensus  *consensus.ProofOfWork  // nil under proof-of-stake
+	pos        *consensus.ProofOfStake // nil under proof-of-work
 	p2pServer  *p2p.Server
 	rpcServer  *rpc.Server
+	stratum    *stratum.Server        // nil unless enabled
+	light      *light.Client          // nil unless a light node
+	downloader *downloader.Downloader // nil for a light node
 	db         storage.Database
+	dbMeter    *storage.MeteredDB // measures the operations on db
+	freezer    *storage.Freezer   // nil unless enabled, closed with db
 	metrics    *metrics.Metrics
 	logger     *logger.Logger
+	miner      *miner.Miner
+	work       remoteWork // templates handed to external miners
+	backingUp  int32      // 1 while a backup is written
+	accounts   *accounts.Manager
+	devDir     string // temporary keystore of a development chain, removed on Stop
+	events     *event.Bus
+
+	// Configuration reload, see ReloadConfig
+	reloadMu   sync.Mutex
+	loadConfig ConfigLoader // nil until set, see SetConfigLoader
+	settings   reloadable   // the reloadable settings in effect
 	
 	// Graceful shutdown
 	ctx        context.Context
 	cancel     context.CancelFunc
 	wg         sync.WaitGroup
 	shutdownCh chan struct{}
+	signals    chan os.Signal // stop and reload signals, see waitForShutdown
 }
 
 // NewNode creates a new blockchain node
 func NewNode(cfg *config.Config) (*Node, error) {
 	// Validate configuration
+	cfg.ApplyDev()
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %v", err)
 	}
+	cfg.ApplyMode()
 
 	// Initialize logger
 	if err := logger.Init(logger.Config{
@@ -66,41 +115,133 @@ func NewNode(cfg *config.Config) (*Node, error) {
 	metricsInstance := metrics.Init(&cfg.Metrics)
 
 	// Initialize database with optimized settings
-	db, err := storage.NewLevelDB(cfg.DB.Path, &storage.LevelDBOptions{
-		CacheSize:    cfg.DB.CacheSize,
-		MaxOpenFiles: cfg.DB.MaxOpenFiles,
-		WriteBuffer:  cfg.DB.WriteBuffer,
-	})
+	db, freezer, err := openDatabase(&cfg.DB, false, nodeLogger)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize database: %v", err)
+		return nil, err
 	}
+	dbMeter := storage.NewMeteredDB(db)
+	db = dbMeter
 
 	// Initialize blockchain
-	genesis := core.DefaultGenesis()
-	genesis.Config.ChainID = big.NewInt(int64(cfg.EVM.ChainID))
-	genesis.GasLimit = cfg.EVM.BlockGasLimit
-
-	blockchain, err := core.NewBlockchain(db, genesis)
+	blockchain, err := openBlockchain(cfg, db, nodeLogger)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize blockchain: %v", err)
+		return nil, err
+	}
+
+	// Blocks move toward the configured gas limit target, without one
+	// toward the block gas limit
+	gasLimitTarget := cfg.EVM.GasLimitTarget
+	if gasLimitTarget == 0 {
+		gasLimitTarget = cfg.EVM.BlockGasLimit
 	}
 
 	// Initialize mempool with configuration
 	mempool := mempool.NewMempool(&mempool.Config{
-		MaxSize:     1000,
-		MinGasPrice: cfg.EVM.MinGasPrice,
+		MaxSize:        cfg.Mempool.MaxSize,
+		MaxBytes:       cfg.Mempool.MaxBytes,
+		AccountSlots:   cfg.Mempool.AccountSlots,
+		MinGasPrice:    cfg.EVM.MinGasPrice,
+		GasLimitTarget: gasLimitTarget,
+		PriceBump:      cfg.Mempool.PriceBump,
+		Timeout:        time.Duration(cfg.Mempool.Lifetime) * time.Second,
+		Journal:        dataFile(&cfg.DB, cfg.Mempool.Journal),
+		Rejournal:      time.Duration(cfg.Mempool.Rejournal) * time.Second,
 	})
+	mempool.SetStateReader(blockchain)
+
+	// Subsystems communicate through the event bus, the chain and the
+	// mempool publish their changes to it
+	events := event.NewBus()
+	blockchain.SubscribeChainHead(events.ChainHead.Send)
+	mempool.SubscribeTxEvents(events.Tx.Send)
+
+	// Mined, reorganized and invalidated transactions follow the chain head
+	events.ChainHead.Subscribe(mempool.HandleChainHead)
+
+	// Configured accounts are unlocked before the signers need them, a
+	// development chain has its own
+	var (
+		am          *accounts.Manager
+		devKeystore string
+	)
+	if cfg.Dev.Enabled {
+		if am, devKeystore, err = openDevAccounts(cfg.Dev.Accounts, nodeLogger); err != nil {
+			return nil, err
+		}
+		cfg.Wallet.Keystore = devKeystore
+	} else {
+		am = accounts.NewManager(cfg.Wallet.Keystore)
+		if err := unlockAccounts(am, &cfg.Wallet); err != nil {
+			return nil, err
+		}
+	}
 
 	// Initialize consensus
-	consensus := consensus.NewProofOfWork(big.NewInt(int64(cfg.Mining.Difficulty)))
+	var (
+		engine consensus.Engine
+		pow    *consensus.ProofOfWork
+		pos    *consensus.ProofOfStake
+	)
+	if chainConfig := blockchain.Config(); chainConfig.PoS != nil {
+		pos = consensus.NewProofOfStake(chainConfig.PoS)
+		switch {
+		case cfg.Staking.Signer != "":
+			remote := signer.NewRemote(cfg.Staking.Signer, crypto.HexToAddress(cfg.Staking.ValidatorAddress),
+				time.Duration(cfg.Staking.SignerTimeout)*time.Second)
+			pos.Authorize(remote.Address(), remote.SignHash)
+			nodeLogger.Info("Blocks are signed by remote signer", "endpoint", cfg.Staking.Signer, "address", remote.Address().Hex())
+		case cfg.Staking.ValidatorKey != "":
+			key, err := crypto.HexToECDSA(strings.TrimPrefix(cfg.Staking.ValidatorKey, "0x"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid validator key: %v", err)
+			}
+			pos.Authorize(crypto.PubkeyToAddress(crypto.FromECDSAPub(&key.PublicKey)), consensus.KeySigner(key))
+		case cfg.Staking.ValidatorAddress != "":
+			addr := crypto.HexToAddress(cfg.Staking.ValidatorAddress)
+			if !am.Unlocked(addr) {
+				return nil, fmt.Errorf("validator account %s is not unlocked, add it to wallet.unlock", addr.Hex())
+			}
+			pos.Authorize(addr, func(hash crypto.Hash) ([]byte, error) {
+				return am.SignHash(addr, hash)
+			})
+			nodeLogger.Info("Blocks are signed by keystore account", "address", addr.Hex())
+		}
+		if addr := pos.Signer(); addr != (crypto.Address{}) && !pos.IsValidator(addr) {
+			nodeLogger.Warning("Validator key is not in the validator set", "address", addr.Hex())
+		}
+		engine = pos
+	} else {
+		pow = newProofOfWork(&cfg.Mining)
+		engine = pow
+	}
+	configureBlockchain(blockchain, cfg, freezer, engine)
 
 	// Initialize P2P server
 	p2pServer := p2p.NewServer(&cfg.Network)
+	p2pServer.SetPeerFile(dataFile(&cfg.DB, peerFile))
+
+	// A light node follows the headers served by full nodes instead of
+	// importing blocks, other nodes download the blocks they miss
+	var (
+		lightClient *light.Client
+		dl          *downloader.Downloader
+	)
+	if cfg.Sync.Mode == config.ModeLight {
+		headers := light.NewHeaderChain(blockchain.Config(), blockchain.GetHeaderByNumber(0), engine)
+		lightClient = light.NewClient(headers, p2pServer)
+	} else {
+		dl = downloader.New(blockchain, p2pServer, events)
+		if cfg.Network.LightServe {
+			light.NewServer(blockchain, p2pServer)
+		}
+	}
 
 	// Initialize RPC server
 	var rpcServer *rpc.Server
 	if cfg.RPC.Enabled {
-		rpcServer = rpc.NewServer(&cfg.RPC, blockchain, mempool)
+		gpoConfig := gasprice.DefaultConfig()
+		gpoConfig.MinPrice = new(big.Int).SetUint64(cfg.EVM.MinGasPrice)
+		rpcServer = rpc.NewServer(&cfg.RPC, blockchain, mempool, gasprice.NewOracle(blockchain, mempool, gpoConfig))
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -109,15 +250,64 @@ func NewNode(cfg *config.Config) (*Node, error) {
 		config:     cfg,
 		blockchain: blockchain,
 		mempool:    mempool,
-		consensus:  consensus,
+		consensus:  pow,
+		pos:        pos,
 		p2pServer:  p2pServer,
 		rpcServer:  rpcServer,
+		light:      lightClient,
+		downloader: dl,
 		db:         db,
+		dbMeter:    dbMeter,
+		freezer:    freezer,
+		accounts:   am,
+		devDir:     devKeystore,
+		events:     events,
+		settings:   reloadableSettings(cfg),
 		metrics:    metricsInstance,
 		logger:     nodeLogger,
 		ctx:        ctx,
 		cancel:     cancel,
 		shutdownCh: make(chan struct{}),
+		signals:    make(chan os.Signal, 1),
+	}
+	node.subscribeRelay()
+	node.subscribeMetrics()
+
+	// The miner keeps a block template for the local sealer, external
+	// miners and the proposer
+	// Rewards go to the first account of the keystore unless configured
+	coinbase := crypto.HexToAddress(cfg.Mining.Address)
+	if cfg.Mining.Address == "" {
+		if addrs := am.Addresses(); len(addrs) > 0 {
+			coinbase = addrs[0]
+			nodeLogger.Info("Using first keystore account as coinbase", "address", coinbase.Hex())
+		}
+	}
+	node.miner = miner.New(&miner.Config{
+		Coinbase:       coinbase,
+		GasLimitTarget: gasLimitTarget,
+		MinPeers:       cfg.Mining.MinPeers,
+		Dev:            cfg.Dev.Enabled,
+		DevPeriod:      time.Duration(cfg.Dev.Period) * time.Second,
+	}, blockchain, mempool, engine)
+	node.miner.SetSyncStatus(node)
+	node.miner.SubscribeSealed(node.publishMinedBlock)
+
+	if rpcServer != nil {
+		rpcServer.SetBackupSource(node)
+		rpcServer.SetDatabaseStatsSource(node)
+		rpcServer.SetAccountSource(am)
+		rpcServer.SetStatusSource(node)
+		rpcServer.SetReloadSource(node)
+		if pow != nil {
+			rpcServer.SetWorkSource(node)
+		}
+		if lightClient != nil {
+			rpcServer.SetLightSource(lightClient)
+		}
+	}
+	if cfg.Stratum.Enabled && pow != nil {
+		node.stratum = stratum.NewServer(&cfg.Stratum, node)
 	}
 
 	nodeLogger.Info("Blockchain node initialized successfully")
@@ -128,12 +318,51 @@ func NewNode(cfg *config.Config) (*Node, error) {
 func (n *Node) Start() error {
 	n.logger.Info("Starting blockchain node...")
 
+	// A stop signal received while starting stops the node once it is up,
+	// instead of killing it halfway
+	signal.Notify(n.signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	// Verify the chain more deeply if the last run was killed or crashed,
+	// until Stop the database is marked as in use
+	if _, err := n.blockchain.MarkRunning(); err != nil {
+		if errors.Is(err, storage.ErrCorrupted) {
+			return corruptionError(n.logger, n.config.DB.Path, err)
+		}
+		return err
+	}
+
 	// Start P2P server
 	if err := n.p2pServer.Start(); err != nil {
 		return fmt.Errorf("failed to start P2P server: %v", err)
 	}
 	n.logger.Info("P2P server started on port %d", n.config.Network.Port)
 
+	// Start evicting expired transactions
+	n.mempool.Start()
+
+	// Start catching up with the peers. Mining waits until the node is in
+	// sync, see miner.Ready.
+	if n.downloader != nil {
+		wait := time.Duration(0)
+		if len(n.config.Network.SeedNodes) > 0 {
+			wait = peerWait
+		}
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			n.downloader.Run(n.ctx, wait)
+		}()
+	}
+
+	// Start following the headers of the peers
+	if n.light != nil {
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			n.light.Run(n.ctx)
+		}()
+	}
+
 	// Start RPC server
 	if n.rpcServer != nil {
 		n.wg.Add(1)
@@ -146,14 +375,45 @@ func (n *Node) Start() error {
 		n.logger.Info("RPC server started on %s:%d", n.config.RPC.Host, n.config.RPC.Port)
 	}
 
+	// Start stratum server
+	if n.stratum != nil {
+		if err := n.stratum.Start(); err != nil {
+			return fmt.Errorf("failed to start stratum server: %v", err)
+		}
+	}
+
 	// Start mining if enabled
 	if n.config.Mining.Enabled {
+		if err := n.miner.Start(); err != nil {
+			return fmt.Errorf("failed to start mining: %v", err)
+		}
+	}
+
+	// Start proposing blocks if this node is a validator
+	if n.pos != nil && n.pos.Signer() != (crypto.Address{}) {
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			n.startProposing()
+		}()
+	}
+
+	// An archive node drops the reference counts of an earlier pruned run
+	if n.config.DB.StateRetention == 0 {
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			n.dropStateReferences()
+		}()
+	}
+
+	// Move completed freezer files to the cold store
+	if n.freezer != nil && n.config.DB.FreezerColdStore != "" {
 		n.wg.Add(1)
 		go func() {
 			defer n.wg.Done()
-			n.startMining()
+			n.moveColdLoop()
 		}()
-		n.logger.Info("Mining started with %d threads", n.config.Mining.Threads)
 	}
 
 	// Start metrics updater
@@ -165,15 +425,33 @@ func (n *Node) Start() error {
 
 	n.logger.Info("Node started successfully!")
 	n.logger.Info("- Chain ID: %d", n.config.EVM.ChainID)
+	n.logger.Info("- Mode: %s", n.config.Sync.Mode)
+	if n.config.Dev.Enabled {
+		n.logger.Info("- Development chain, data is lost on exit")
+	}
 	n.logger.Info("- P2P listening on port %d", n.config.Network.Port)
 	if n.config.RPC.Enabled {
 		n.logger.Info("- RPC server on %s:%d", n.config.RPC.Host, n.config.RPC.Port)
 	}
 	n.logger.Info("- Mining enabled: %t", n.config.Mining.Enabled)
+	if n.config.Stratum.Enabled {
+		n.logger.Info("- Stratum server on %s:%d", n.config.Stratum.Host, n.config.Stratum.Port)
+	}
 	if n.config.Metrics.Enabled {
 		n.logger.Info("- Metrics server on port %d", n.config.Metrics.Port)
 	}
 
+	// Tell the service manager that the node is up, and keep telling it
+	// if it watches the node
+	n.notify(fmt.Sprintf("READY=1\nSTATUS=Running chain %d", n.config.EVM.ChainID))
+	if interval := watchdogInterval(); interval > 0 {
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			n.watchdogLoop(interval)
+		}()
+	}
+
 	// Wait for shutdown signal
 	n.waitForShutdown()
 
@@ -183,16 +461,29 @@ func (n *Node) Start() error {
 // Stop stops the blockchain node gracefully
 func (n *Node) Stop() error {
 	n.logger.Info("Stopping blockchain node...")
+	n.notify("STOPPING=1")
 
 	// Signal shutdown
 	close(n.shutdownCh)
 	n.cancel()
 
-	// Stop P2P server
+	// Stop taking transactions and blocks from clients and peers
+	if n.rpcServer != nil {
+		if err := n.rpcServer.Stop(); err != nil {
+			n.logger.Error("Error stopping RPC server: %v", err)
+		}
+	}
 	if err := n.p2pServer.Stop(); err != nil {
 		n.logger.Error("Error stopping P2P server: %v", err)
 	}
 
+	n.miner.Stop()
+	if n.stratum != nil {
+		if err := n.stratum.Stop(); err != nil {
+			n.logger.Error("Error stopping stratum server: %v", err)
+		}
+	}
+
 	// Wait for all goroutines to finish
 	done := make(chan struct{})
 	go func() {
@@ -208,6 +499,17 @@ func (n *Node) Stop() error {
 		n.logger.Warning("Shutdown timeout reached, forcing exit")
 	}
 
+	// Write the local transactions to the journal and mark the chain as
+	// shut down cleanly once nothing changes it anymore
+	n.mempool.Stop()
+	if err := n.blockchain.Close(); err != nil {
+		n.logger.Error("Error closing blockchain", "error", err)
+	}
+	n.accounts.LockAll()
+	if n.devDir != "" {
+		os.RemoveAll(n.devDir)
+	}
+
 	// Close database
 	if err := n.db.Close(); err != nil {
 		n.logger.Error("Error closing database: %v", err)
@@ -218,87 +520,139 @@ func (n *Node) Stop() error {
 		n.logger.Error("Error closing logger: %v", err)
 	}
 
+	signal.Stop(n.signals)
+	close(n.signals)
+
 	n.logger.Info("Node stopped successfully")
 	return nil
 }
 
-// startMining starts the mining process with enhanced logging
-func (n *Node) startMining() {
-	n.logger.Info("Starting mining with %d threads, difficulty %s", 
-		n.config.Mining.Threads, n.consensus.GetDifficulty().String())
-
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
-	hashCount := uint64(0)
-	lastTime := time.Now()
+// startProposing signs a block for every slot this node is the proposer of
+func (n *Node) startProposing() {
+	signer := n.pos.Signer()
+	n.logger.Info("Proposing blocks", "validator", signer.Hex(), "period", n.config.Staking.Period)
 
+	after := uint64(time.Now().Unix())
 	for {
+		head := n.blockchain.GetCurrentBlock()
+		slot, start, err := n.pos.NextSlot(n.blockchain, head.Header, after)
+		if err != nil {
+			n.logger.Error("Failed to schedule slot", "error", err)
+			return
+		}
+		after = start + 1
+
 		select {
 		case <-n.ctx.Done():
-			n.logger.Info("Mining stopped")
+			n.logger.Info("Proposing stopped")
 			return
-		case <-ticker.C:
-			// Calculate hash rate
-			now := time.Now()
-			elapsed := now.Sub(lastTime).Seconds()
-			if elapsed > 0 {
-				hashRate := float64(hashCount) / elapsed
-				n.metrics.UpdateMiningHashRate(hashRate)
-				n.logger.Debug("Current hash rate: %.2f H/s", hashRate)
-				hashCount = 0
-				lastTime = now
-			}
-		default:
-			// Get pending transactions
-			pendingTxs := n.mempool.GetPendingTransactionsForMining(1000)
-
-			// Create new block
-			currentBlock := n.blockchain.GetCurrentBlock()
-			newBlockNumber := new(big.Int).Add(currentBlock.Header.Number, big.NewInt(1))
-
-			header := &core.BlockHeader{
-				PreviousHash: currentBlock.Hash,
-				Number:       newBlockNumber,
-				GasLimit:     n.config.EVM.BlockGasLimit,
-				GasUsed:      0,
-				Timestamp:    uint64(time.Now().Unix()),
-				Difficulty:   n.consensus.GetDifficulty(),
-			}
+		case <-time.After(time.Until(time.Unix(int64(start), 0))):
+		}
 
-			newBlock := core.NewBlock(header, pendingTxs)
+		proposer, err := n.pos.Proposer(n.blockchain, slot)
+		if err != nil {
+			n.logger.Warning("No proposer for slot", "slot", slot, "error", err)
+			continue
+		}
+		if proposer != signer {
+			continue
+		}
+		if err := n.miner.Ready(); err != nil {
+			n.logger.Warning("Skipping slot", "slot", slot, "reason", err)
+			continue
+		}
 
-			// Mine the block
-			start := time.Now()
-			if err := n.consensus.Mine(newBlock); err != nil {
-				n.logger.Error("Mining error: %v", err)
-				continue
-			}
-			miningTime := time.Since(start)
+		newBlock, err := n.miner.NewTemplate()
+		if err != nil {
+			n.logger.Error("Failed to prepare block", "error", err)
+			continue
+		}
+		if err := n.pos.Seal(newBlock); err != nil {
+			n.logger.Error("Failed to sign block", "error", err)
+			continue
+		}
+		if err := n.blockchain.AddBlock(newBlock); err != nil {
+			n.logger.Error("Failed to add block", "slot", slot, "error", err)
+			continue
+		}
 
-			// Add block to blockchain
-			if err := n.blockchain.AddBlock(newBlock); err != nil {
-				n.logger.Error("Failed to add block: %v", err)
-				continue
-			}
+		n.logger.Info("New block proposed", "number", newBlock.Header.Number.String(), "slot", slot,
+			"hash", newBlock.Hash.Hex(), "transactions", len(newBlock.Transactions))
+		n.publishMinedBlock(newBlock)
+	}
+}
 
-			// Remove mined transactions from mempool
-			for _, tx := range pendingTxs {
-				n.mempool.RemoveTransaction(tx.Hash)
-				n.metrics.IncrementTransactions()
-			}
+// Syncing reports whether the node is catching up with its peers. A light
+// node never reports syncing, its headers are synced in the background.
+func (n *Node) Syncing() bool {
+	return n.downloader != nil && n.downloader.Syncing()
+}
 
-			n.logger.Info("New block mined: #%s, Hash: %x, Transactions: %d, Time: %v",
-				newBlock.Header.Number.String(), newBlock.Hash, len(newBlock.Transactions), miningTime)
+// SyncProgress returns the block numbers of the local head when the sync
+// started, the local head and the head of the peer synced with
+func (n *Node) SyncProgress() (starting, current, highest uint64) {
+	if n.downloader == nil {
+		current = n.blockchain.GetBlockNumber().Uint64()
+		return current, current, current
+	}
+	progress := n.downloader.Progress()
+	return progress.StartingBlock, progress.CurrentBlock, progress.HighestBlock
+}
 
-			// Update metrics
-			n.metrics.UpdateBlockHeight(newBlock.Header.Number.Uint64())
+// PeerCount returns the number of connected peers
+func (n *Node) PeerCount() int {
+	return n.p2pServer.GetPeerCount()
+}
 
-			// Broadcast block to peers
-			n.p2pServer.BroadcastMessage([]byte(fmt.Sprintf("NEW_BLOCK:%x", newBlock.Hash)))
+// Mining reports whether the node produces blocks, sealing them with
+// proof-of-work or proposing them as a validator
+func (n *Node) Mining() bool {
+	return n.miner.Mining() || (n.pos != nil && n.pos.Signer() != (crypto.Address{}))
+}
 
-			hashCount += newBlock.Header.Nonce
+// HashRate returns the seal hashes per second of the local miner
+func (n *Node) HashRate() float64 {
+	return n.miner.HashRate()
+}
+
+// Coinbase returns the address block rewards are paid to
+func (n *Node) Coinbase() crypto.Address {
+	return n.miner.Coinbase()
+}
+
+// moveColdLoop moves the completed freezer data files to the cold store
+// periodically, until the node stops
+func (n *Node) moveColdLoop() {
+	ticker := time.NewTicker(coldMoveInterval)
+	defer ticker.Stop()
+
+	for {
+		moved, err := n.freezer.MoveCold()
+		if err != nil {
+			n.logger.Warning("Failed to move freezer files to the cold store", "error", err)
+		} else if moved > 0 {
+			n.logger.Info("Moved freezer files to the cold store", "files", moved)
 		}
+		select {
+		case <-ticker.C:
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+// dropStateReferences deletes the state reference counts of an earlier
+// pruned run, see Blockchain.DropStateReferences
+func (n *Node) dropStateReferences() {
+	count, err := n.blockchain.DropStateReferences(n.ctx, n.config.DB.PruneRate)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			n.logger.Error("Failed to drop state references", "error", err)
+		}
+		return
+	}
+	if count > 0 {
+		n.logger.Info("Dropped state references of an earlier pruned run", "count", count)
 	}
 }
 
@@ -316,40 +670,390 @@ func (n *Node) updateMetrics() {
 			peerCount := n.p2pServer.GetPeerCount()
 			n.metrics.UpdatePeerCount(peerCount)
 
-			// Update mempool size
-			mempoolSize := n.mempool.Size()
-			n.metrics.UpdateMempoolSize(mempoolSize)
-
 			// Update block height
 			blockHeight := n.blockchain.GetBlockNumber().Uint64()
 			n.metrics.UpdateBlockHeight(blockHeight)
 
-			n.logger.Debug("Metrics updated - Peers: %d, Mempool: %d, Block: %d", 
-				peerCount, mempoolSize, blockHeight)
+			// Update state database counters
+			n.metrics.UpdateStateMetrics(stateMetrics(n.blockchain.StateStats()))
+
+			// Update database counters and size
+			dbStats := n.dbMeter.MeterStats()
+			n.metrics.UpdateDatabaseMetrics(databaseMetrics(dbStats))
+			if dbStats.Compaction != nil {
+				n.metrics.UpdateDatabaseSize(uint64(dbStats.Compaction.Size))
+			}
+
+			if n.miner.Mining() {
+				n.metrics.UpdateMiningHashRate(n.miner.HashRate())
+			}
+
+			n.logger.Debug("Metrics updated - Peers: %d, Block: %d", 
+				peerCount, blockHeight)
 		}
 	}
 }
 
+
+// rebroadcastLocals announces the local transactions that stayed unmined
+// for the configured number of blocks again
+func (n *Node) rebroadcastLocals() {
+	interval := n.config.Mempool.RebroadcastBlocks
+	if interval == 0 || n.Syncing() {
+		return
+	}
+	txs := n.mempool.Rebroadcast(interval)
+	for _, tx := range txs {
+		n.announceTx(tx)
+	}
+	if len(txs) > 0 {
+		n.logger.Debug("Rebroadcast local transactions", "count", len(txs))
+	}
+}
+
+// announceTx announces a pooled transaction to peers
+func (n *Node) announceTx(tx *core.Transaction) {
+	n.p2pServer.BroadcastMessage([]byte(fmt.Sprintf("NEW_TX:%x", tx.Hash.Bytes())))
+}
+
+// stateMetrics converts the state database counters for the metrics module
+func stateMetrics(s core.StateStats) metrics.StateMetrics {
+	return metrics.StateMetrics{
+		AccountCacheHits:   s.AccountCacheHits,
+		AccountCacheMisses: s.AccountCacheMisses,
+		StorageCacheHits:   s.StorageCacheHits,
+		StorageCacheMisses: s.StorageCacheMisses,
+		CodeCacheHits:      s.CodeCacheHits,
+		CodeCacheMisses:    s.CodeCacheMisses,
+		AccountReads:       s.AccountReads,
+		StorageReads:       s.StorageReads,
+		AccountWrites:      s.AccountWrites,
+		StorageWrites:      s.StorageWrites,
+		Commits:            s.Commits,
+		CommitTime:         s.CommitTime,
+		LastCommitTime:     s.LastCommitTime,
+		TrieNodesCommitted: s.TrieNodesCommitted,
+		TrieNodesPruned:    s.TrieNodesPruned,
+	}
+}
+
+// databaseMetrics converts the database counters for the metrics module
+func databaseMetrics(s storage.MeterStats) metrics.DatabaseMetrics {
+	m := metrics.DatabaseMetrics{
+		Get:        databaseOpMetrics(s.Get),
+		Put:        databaseOpMetrics(s.Put),
+		Delete:     databaseOpMetrics(s.Delete),
+		BatchWrite: databaseOpMetrics(s.BatchWrite),
+	}
+	if c := s.Compaction; c != nil {
+		m.Compactions = c.Compactions
+		m.CompactionTime = c.CompactionTime
+		m.CompactionRead = c.CompactionRead
+		m.CompactionWrite = c.CompactionWrite
+		m.WriteDelays = c.WriteDelays
+		m.WriteDelayTime = c.WriteDelayTime
+		m.LevelSizes = c.LevelSizes
+	}
+	return m
+}
+
+// databaseOpMetrics converts the counters of one kind of operation
+func databaseOpMetrics(s storage.OpStats) metrics.DatabaseOpMetrics {
+	return metrics.DatabaseOpMetrics{
+		Count:   s.Count,
+		Entries: s.Entries,
+		Bytes:   s.Bytes,
+		Latency: metrics.Histogram{
+			Bounds:  storage.LatencyBuckets[:],
+			Buckets: s.Latency.Buckets,
+			Count:   s.Latency.Count,
+			Sum:     s.Latency.Sum,
+		},
+	}
+}
+
+// DatabaseStats returns the database operation counters, see
+// rpc.DatabaseStatsSource
+func (n *Node) DatabaseStats() storage.MeterStats {
+	return n.dbMeter.MeterStats()
+}
+
 // waitForShutdown waits for shutdown signal
 func (n *Node) waitForShutdown() {
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	select {
-	case sig := <-sigChan:
-		n.logger.Info("Received signal: %v", sig)
-	case <-n.shutdownCh:
-		n.logger.Info("Shutdown requested")
+	for {
+		select {
+		case sig := <-n.signals:
+			// SIGHUP reloads the configuration instead of stopping
+			if sig == syscall.SIGHUP {
+				n.notify("RELOADING=1")
+				if _, err := n.ReloadConfig(); err != nil {
+					n.logger.Error("Failed to reload configuration", "error", err)
+				}
+				n.notify("READY=1")
+				continue
+			}
+			n.logger.Info("Received signal: %v", sig)
+		case <-n.shutdownCh:
+			n.logger.Info("Shutdown requested")
+		}
+		break
 	}
 
+	// Further signals do not interrupt the shutdown, a node killed now
+	// would have to verify its chain on the next start
+	go func() {
+		for sig := range n.signals {
+			n.logger.Warning("Already stopping, ignoring signal", "signal", sig)
+		}
+	}()
 	n.Stop()
 }
 
+// corruptionError logs how to recover a database that could not be
+// repaired automatically and returns the error to stop the node with
+func corruptionError(log *logger.Logger, path string, err error) error {
+	log.Error("Database is corrupted and could not be repaired", "path", path, "error", err)
+	log.Error("To recover: stop the node and move the data directory aside, keeping it for inspection")
+	log.Error("Then restore a backup taken with lumina_backup to the data directory, or start with an empty one to resync from peers")
+	return fmt.Errorf("database at %s needs manual recovery: %w", path, err)
+}
+
+// unlockAccounts unlocks the accounts listed in cfg until the node stops
+func unlockAccounts(am *accounts.Manager, cfg *config.WalletConfig) error {
+	if len(cfg.Unlock) == 0 {
+		return nil
+	}
+	if cfg.PasswordFile == "" {
+		return fmt.Errorf("wallet.password_file is required to unlock accounts")
+	}
+	data, err := os.ReadFile(cfg.PasswordFile)
+	if err != nil {
+		return fmt.Errorf("failed to read password file: %v", err)
+	}
+	passwords := strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")
+
+	for i, addrStr := range cfg.Unlock {
+		if !crypto.IsHexAddress(addrStr) {
+			return fmt.Errorf("invalid account to unlock: %s", addrStr)
+		}
+		password := passwords[len(passwords)-1]
+		if i < len(passwords) {
+			password = passwords[i]
+		}
+		addr := crypto.HexToAddress(addrStr)
+		if err := am.Unlock(addr, strings.TrimRight(password, "\r"), 0); err != nil {
+			return fmt.Errorf("failed to unlock account %s: %w", addr.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// openBlockchain opens the chain of db: the chain of the genesis file it
+// was set up with by init, or else the chain configured in cfg
+func openBlockchain(cfg *config.Config, db storage.Database, log *logger.Logger) (*core.Blockchain, error) {
+	genesis := core.DefaultGenesis()
+	genesis.Config.ChainID = big.NewInt(int64(cfg.EVM.ChainID))
+	genesis.GasLimit = cfg.EVM.BlockGasLimit
+	genesis.Config.Checkpoints = make(map[uint64]crypto.Hash)
+	for number, hash := range cfg.Sync.Checkpoints {
+		blockNumber, err := strconv.ParseUint(number, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid checkpoint block number %s: %v", number, err)
+		}
+		checkpoint, err := crypto.HashFromString(hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid checkpoint hash for block %s: %v", number, err)
+		}
+		genesis.Config.Checkpoints[blockNumber] = checkpoint
+	}
+	genesis.Config.SafeDepth = cfg.Sync.SafeDepth
+	genesis.Config.FinalityDepth = cfg.Sync.FinalizedDepth
+	genesis.Config.CoinbaseMaturity = cfg.EVM.CoinbaseMaturity
+	genesis.Config.GasLimitTarget = cfg.EVM.GasLimitTarget
+	if cfg.Dev.Enabled {
+		if err := allocDevAccounts(genesis, cfg.Dev.Accounts); err != nil {
+			return nil, err
+		}
+	}
+	genesis.Config.Emission = &core.EmissionConfig{
+		ReductionInterval: cfg.Emission.ReductionInterval,
+		ReductionPercent:  cfg.Emission.ReductionPercent,
+	}
+	genesis.Config.Emission.InitialReward, _ = new(big.Int).SetString(cfg.Emission.InitialReward, 10)
+	genesis.Config.Emission.TailReward, _ = new(big.Int).SetString(cfg.Emission.TailReward, 10)
+	if cfg.Staking.Enabled {
+		genesis.Config.PoS = &core.PoSConfig{
+			Period:     cfg.Staking.Period,
+			Validators: make(map[crypto.Address]*big.Int),
+		}
+		for addr, stake := range cfg.Staking.Validators {
+			amount, ok := new(big.Int).SetString(stake, 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid stake for validator %s: %s", addr, stake)
+			}
+			genesis.Config.PoS.Validators[crypto.HexToAddress(addr)] = amount
+		}
+	}
+
+	// A data directory set up with init runs the chain of its genesis file,
+	// the configuration only adds the settings of this node
+	if stored, err := core.ReadChainConfig(db); err == nil {
+		if stored.ChainID.Cmp(genesis.Config.ChainID) != 0 {
+			return nil, fmt.Errorf("%w: data directory holds chain %v, evm.chain_id is %v", core.ErrGenesisMismatch, stored.ChainID, genesis.Config.ChainID)
+		}
+		stored.Checkpoints = genesis.Config.Checkpoints
+		stored.SafeDepth = genesis.Config.SafeDepth
+		stored.FinalityDepth = genesis.Config.FinalityDepth
+		genesis.Config = stored
+	} else if !errors.Is(err, storage.ErrKeyNotFound) {
+		if errors.Is(err, storage.ErrCorrupted) {
+			return nil, corruptionError(log, cfg.DB.Path, err)
+		}
+		return nil, fmt.Errorf("failed to read chain config: %v", err)
+	}
+
+	blockchain, err := core.NewBlockchain(db, genesis)
+	if err != nil {
+		if errors.Is(err, storage.ErrCorrupted) {
+			return nil, corruptionError(log, cfg.DB.Path, err)
+		}
+		return nil, fmt.Errorf("failed to initialize blockchain: %v", err)
+	}
+	return blockchain, nil
+}
+
+// newProofOfWork returns the proof-of-work engine configured in cfg
+func newProofOfWork(cfg *config.MiningConfig) *consensus.ProofOfWork {
+	pow := consensus.NewProofOfWork(big.NewInt(int64(cfg.Difficulty)))
+	pow.SetTargetBlockTime(cfg.BlockTime)
+	return pow
+}
+
+// configureBlockchain applies the settings of cfg to a freshly opened chain
+func configureBlockchain(blockchain *core.Blockchain, cfg *config.Config, freezer *storage.Freezer, engine consensus.Engine) {
+	blockchain.SetEngine(engine)
+	blockchain.SetVM(evm.New)
+	blockchain.SetStateRetention(cfg.DB.StateRetention)
+	blockchain.SetPreimageRecording(cfg.EVM.RecordPreimages)
+	if freezer != nil {
+		blockchain.SetFreezer(freezer, cfg.DB.FreezerCutoff)
+	}
+	blockchain.SetStateBatchLimit(cfg.DB.BatchLimit * 1024 * 1024)
+	blockchain.SetTxIndexDepth(cfg.Sync.TxIndexDepth)
+}
+
+// openDatabase opens the database configured in cfg with its encryption and
+// freezer. The freezer is nil when it is disabled.
+func openDatabase(cfg *config.DBConfig, readOnly bool, log *logger.Logger) (storage.Database, *storage.Freezer, error) {
+	db, err := storage.Open(cfg.Type, cfg.Path, &storage.Options{
+		CacheSize:    cfg.CacheSize,
+		MaxOpenFiles: cfg.MaxOpenFiles,
+		WriteBuffer:  cfg.WriteBuffer,
+		ReadOnly:     readOnly,
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrCorrupted) {
+			return nil, nil, corruptionError(log, cfg.Path, err)
+		}
+		return nil, nil, fmt.Errorf("failed to initialize database: %v", err)
+	}
+	if db, err = encryptDatabase(db, cfg); err != nil {
+		return nil, nil, err
+	}
+	var freezer *storage.Freezer
+	if cfg.FreezerCutoff > 0 && cfg.Type != storage.BackendMemory {
+		freezer, err = storage.NewFreezer(storage.FreezerDir(cfg.Path), storage.FreezerTables, readOnly)
+		if err != nil {
+			db.Close()
+			return nil, nil, fmt.Errorf("failed to open freezer: %v", err)
+		}
+		if cfg.FreezerColdStore != "" {
+			cold, err := openColdStore(cfg)
+			if err != nil {
+				freezer.Close()
+				db.Close()
+				return nil, nil, fmt.Errorf("failed to open freezer cold store: %v", err)
+			}
+			freezer.SetColdStore(cold)
+		}
+		db = storage.NewFreezerDB(db, freezer)
+	}
+	return db, freezer, nil
+}
+
+// dataFile returns the path of a file in the data directory of cfg, empty
+// if name is empty or the database is kept in memory
+func dataFile(cfg *config.DBConfig, name string) string {
+	if name == "" || cfg.Type == storage.BackendMemory {
+		return ""
+	}
+	return filepath.Join(cfg.Path, name)
+}
+
+// openColdStore opens the cold store of the freezer configured in cfg
+func openColdStore(cfg *config.DBConfig) (storage.ColdStore, error) {
+	if !strings.HasPrefix(cfg.FreezerColdStore, "s3://") {
+		return storage.NewDirColdStore(cfg.FreezerColdStore)
+	}
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(cfg.FreezerColdStore, "s3://"), "/")
+	return storage.NewS3ColdStore(cfg.FreezerColdEndpoint, cfg.FreezerColdRegion, bucket, prefix,
+		os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"))
+}
+
+// encryptDatabase wraps db with the encryption configured for it and
+// refuses to start on an encrypted database without one. db is closed on
+// failure.
+func encryptDatabase(db storage.Database, cfg *config.DBConfig) (storage.Database, error) {
+	encrypted, err := openEncryption(db, cfg)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	return encrypted, nil
+}
+
+// openEncryption opens the encryption of db with the key or passphrase file
+// of cfg
+func openEncryption(db storage.Database, cfg *config.DBConfig) (storage.Database, error) {
+	switch {
+	case cfg.EncryptionKeyFile != "":
+		data, err := os.ReadFile(cfg.EncryptionKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key file: %v", err)
+		}
+		return storage.NewEncryptedDB(db, key)
+	case cfg.EncryptionPassphraseFile != "":
+		data, err := os.ReadFile(cfg.EncryptionPassphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		return storage.NewPassphraseEncryptedDB(db, strings.TrimRight(string(data), "\r\n"))
+	}
+
+	encrypted, err := storage.IsEncrypted(db)
+	if err != nil {
+		return nil, err
+	}
+	if encrypted {
+		return nil, fmt.Errorf("%w, set db.encryption_key_file or db.encryption_passphrase_file", storage.ErrEncrypted)
+	}
+	return db, nil
+}
+
 // GetBlockchain returns the blockchain instance
 func (n *Node) GetBlockchain() *core.Blockchain {
 	return n.blockchain
 }
 
+// Events returns the event bus of the node, for subsystems added to it
+func (n *Node) Events() *event.Bus {
+	return n.events
+}
+
 // GetMempool returns the mempool instance
 func (n *Node) GetMempool() *mempool.Mempool {
 	return n.mempool
@@ -364,3 +1068,8 @@ func (n *Node) GetP2PServer() *p2p.Server {
 func (n *Node) GetMetrics() *metrics.Metrics {
 	return n.metrics
 }
+
+// GetMiner returns the miner instance
+func (n *Node) GetMiner() *miner.Miner {
+	return n.miner
+}
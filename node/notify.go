@@ -0,0 +1,65 @@
+package node
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends a state change to the service manager that started the
+// node, see sd_notify(3). It does nothing unless NOTIFY_SOCKET is set.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to notify service manager: %v", err)
+	}
+	return nil
+}
+
+// watchdogInterval returns the interval within which the service manager
+// expects a keep-alive from the node, zero if it does not watch it
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseUint(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec == 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// notify sends a state change to the service manager. Failures are only
+// logged at debug level: the process that started a node with --daemon
+// stops listening once the node is up.
+func (n *Node) notify(state string) {
+	if err := sdNotify(state); err != nil {
+		n.logger.Debug("Service manager notification failed", "state", state, "error", err)
+	}
+}
+
+// watchdogLoop sends keep-alives to the service manager at half the
+// interval it expects them in, until the node stops
+func (n *Node) watchdogLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-ticker.C:
+			n.notify("WATCHDOG=1")
+		}
+	}
+}
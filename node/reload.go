@@ -0,0 +1,103 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"blockchain-node/config"
+	"blockchain-node/logger"
+)
+
+// ConfigLoader reads the configuration again for ReloadConfig, with the
+// command line overrides the node was started with
+type ConfigLoader func() (*config.Config, error)
+
+// reloadable holds the settings ReloadConfig changes while the node runs
+type reloadable struct {
+	logLevel    string
+	corsOrigins []string
+	maxPeers    int
+	minGasPrice uint64
+	mining      bool
+}
+
+// reloadableSettings returns the reloadable settings of cfg
+func reloadableSettings(cfg *config.Config) reloadable {
+	return reloadable{
+		logLevel:    cfg.Logging.Level,
+		corsOrigins: cfg.RPC.CORSOrigins,
+		maxPeers:    cfg.Network.MaxPeers,
+		minGasPrice: cfg.EVM.MinGasPrice,
+		mining:      cfg.Mining.Enabled,
+	}
+}
+
+// SetConfigLoader sets how ReloadConfig reads the configuration
+func (n *Node) SetConfigLoader(load ConfigLoader) {
+	n.reloadMu.Lock()
+	defer n.reloadMu.Unlock()
+	n.loadConfig = load
+}
+
+// ReloadConfig reads the configuration again and applies the log level, the
+// CORS origins of the RPC server, the peer limit, the minimum gas price of
+// the mempool and whether the node mines. Other settings only take effect
+// at the next start. It returns the names of the settings that changed.
+func (n *Node) ReloadConfig() ([]string, error) {
+	n.reloadMu.Lock()
+	defer n.reloadMu.Unlock()
+
+	if n.loadConfig == nil {
+		return nil, errors.New("configuration reload not available")
+	}
+	cfg, err := n.loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %v", err)
+	}
+	cfg.ApplyDev()
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+	next := reloadableSettings(cfg)
+	if next.mining && n.consensus == nil {
+		return nil, errors.New("mining requires proof-of-work")
+	}
+
+	var changed []string
+	if next.logLevel != n.settings.logLevel {
+		logger.SetLevel(next.logLevel)
+		changed = append(changed, "logging.level")
+	}
+	if !reflect.DeepEqual(next.corsOrigins, n.settings.corsOrigins) {
+		if n.rpcServer != nil {
+			n.rpcServer.SetCORSOrigins(next.corsOrigins)
+		}
+		changed = append(changed, "rpc.cors_origins")
+	}
+	if next.maxPeers != n.settings.maxPeers {
+		n.p2pServer.SetMaxPeers(next.maxPeers)
+		changed = append(changed, "network.max_peers")
+	}
+	if next.minGasPrice != n.settings.minGasPrice {
+		n.mempool.SetMinGasPrice(next.minGasPrice)
+		changed = append(changed, "evm.min_gas_price")
+	}
+	if next.mining != n.settings.mining {
+		if next.mining {
+			err = n.miner.Start()
+		} else {
+			n.miner.Stop()
+		}
+		if err != nil {
+			next.mining = n.settings.mining
+			err = fmt.Errorf("failed to start mining: %v", err)
+		} else {
+			changed = append(changed, "mining.enabled")
+		}
+	}
+	n.settings = next
+
+	n.logger.Info("Configuration reloaded", "changed", changed)
+	return changed, err
+}
@@ -0,0 +1,129 @@
+package node
+
+import (
+	"math/big"
+	"sync"
+
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+	"blockchain-node/stratum"
+)
+
+// maxWorkTemplates is the number of templates on top of the same head that
+// solutions are still accepted for
+const maxWorkTemplates = 16
+
+// remoteWork keeps the block templates handed to external miners by work
+// hash, so that submitted solutions can be matched to them
+type remoteWork struct {
+	mu        sync.Mutex
+	templates map[crypto.Hash]*core.Block
+	order     []crypto.Hash // work hashes of the templates, oldest first
+}
+
+// GetWork returns a work package for external miners: the work hash
+// identifying the template, the seal data, the target the seal hash must
+// stay below and the block number. The seal hash is the Keccak-256 of the
+// seal data followed by the nonce as 8 big-endian bytes.
+func (n *Node) GetWork() ([4]string, error) {
+	n.work.mu.Lock()
+	defer n.work.mu.Unlock()
+
+	block, err := n.currentWork()
+	if err != nil {
+		return [4]string{}, err
+	}
+
+	target := crypto.BytesToHash(n.consensus.Target(block.Header).Bytes())
+	return [4]string{
+		n.consensus.WorkHash(block.Header).Hex(),
+		crypto.Encode(n.consensus.SealData(block.Header)),
+		target.Hex(),
+		crypto.EncodeBig(block.Header.Number),
+	}, nil
+}
+
+// StratumJob returns the current block template as a job for the stratum
+// server
+func (n *Node) StratumJob() (*stratum.Job, error) {
+	n.work.mu.Lock()
+	defer n.work.mu.Unlock()
+
+	block, err := n.currentWork()
+	if err != nil {
+		return nil, err
+	}
+
+	return &stratum.Job{
+		WorkHash: n.consensus.WorkHash(block.Header),
+		SealData: n.consensus.SealData(block.Header),
+		Target:   n.consensus.Target(block.Header),
+		Number:   new(big.Int).Set(block.Header.Number),
+	}, nil
+}
+
+// currentWork returns the current block template of the miner and
+// remembers it, so that solutions for it can be submitted. The caller must
+// hold n.work.mu.
+func (n *Node) currentWork() (*core.Block, error) {
+	if err := n.miner.Ready(); err != nil {
+		return nil, err
+	}
+	block, err := n.miner.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	workHash := n.consensus.WorkHash(block.Header)
+	if template := n.work.templates[workHash]; template != nil {
+		return template, nil
+	}
+
+	// Templates of an old head can no longer be imported
+	if len(n.work.order) > 0 {
+		newest := n.work.templates[n.work.order[len(n.work.order)-1]]
+		if newest.Header.PreviousHash != block.Header.PreviousHash {
+			n.work.templates, n.work.order = nil, nil
+		}
+	}
+	if n.work.templates == nil {
+		n.work.templates = make(map[crypto.Hash]*core.Block)
+	}
+	if len(n.work.order) >= maxWorkTemplates {
+		delete(n.work.templates, n.work.order[0])
+		n.work.order = n.work.order[1:]
+	}
+	n.work.templates[workHash] = block
+	n.work.order = append(n.work.order, workHash)
+	return block, nil
+}
+
+// SubmitWork seals the template with the given work hash with nonce and
+// adds the block to the chain. It reports whether the block was accepted.
+func (n *Node) SubmitWork(nonce uint64, workHash crypto.Hash) bool {
+	n.work.mu.Lock()
+	template := n.work.templates[workHash]
+	n.work.mu.Unlock()
+	if template == nil {
+		n.logger.Warning("Work submitted for unknown template", "workHash", workHash.Hex())
+		return false
+	}
+
+	header := *template.Header
+	header.Nonce = nonce
+	if err := n.consensus.VerifySeal(n.blockchain, &header); err != nil {
+		n.logger.Warning("Invalid work submitted", "workHash", workHash.Hex(), "nonce", nonce, "error", err)
+		return false
+	}
+
+	block := core.NewBlockWithUncles(&header, template.Transactions, template.Uncles)
+	if err := n.blockchain.AddBlock(block); err != nil {
+		n.logger.Warning("Failed to add block sealed by external miner", "hash", block.Hash.Hex(), "error", err)
+		return false
+	}
+
+	n.logger.Info("Block sealed by external miner", "number", header.Number.String(), "hash", block.Hash.Hex(),
+		"transactions", len(block.Transactions))
+	n.publishMinedBlock(block)
+	return true
+}
@@ -0,0 +1,100 @@
+package p2p
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// maxSavedPeers is the number of peer addresses kept in the peer file
+const maxSavedPeers = 64
+
+// SetPeerFile sets the file the addresses of outbound peers are saved to,
+// from time to time and on Stop. The saved peers are dialed again on
+// Start, after the seed nodes. It must be called before Start.
+func (s *Server) SetPeerFile(path string) {
+	s.peerFile = path
+}
+
+// loadPeers reads the addresses saved in the peer file
+func (s *Server) loadPeers() ([]string, error) {
+	data, err := os.ReadFile(s.peerFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read peer file: %v", err)
+	}
+	var addresses []string
+	if err := json.Unmarshal(data, &addresses); err != nil {
+		return nil, fmt.Errorf("invalid peer file: %v", err)
+	}
+	return addresses, nil
+}
+
+// savePeers writes the addresses of the connected outbound peers to the
+// peer file, followed by the saved addresses that are not connected now.
+// Addresses of inbound peers are not saved, their port is not the one
+// they listen on.
+func (s *Server) savePeers() error {
+	if s.peerFile == "" {
+		return nil
+	}
+
+	s.mu.RLock()
+	addresses := make([]string, 0, len(s.peers)+len(s.saved))
+	seen := make(map[string]bool)
+	for _, peer := range s.peers {
+		if !peer.Inbound && !seen[peer.Address] {
+			seen[peer.Address] = true
+			addresses = append(addresses, peer.Address)
+		}
+	}
+	for _, addr := range s.saved {
+		if !seen[addr] {
+			seen[addr] = true
+			addresses = append(addresses, addr)
+		}
+	}
+	s.mu.RUnlock()
+	if len(addresses) > maxSavedPeers {
+		addresses = addresses[:maxSavedPeers]
+	}
+
+	data, err := json.MarshalIndent(addresses, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.peerFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write peer file: %v", err)
+	}
+	if err := os.Rename(tmp, s.peerFile); err != nil {
+		return fmt.Errorf("failed to write peer file: %v", err)
+	}
+
+	s.mu.Lock()
+	s.saved = addresses
+	s.mu.Unlock()
+	return nil
+}
+
+// dialAddresses returns the seed nodes followed by the saved peers that are
+// not seed nodes
+func (s *Server) dialAddresses() []string {
+	addresses := append([]string{}, s.config.SeedNodes...)
+	seeds := make(map[string]bool, len(s.config.SeedNodes))
+	for _, seed := range s.config.SeedNodes {
+		seeds[seed] = true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, addr := range s.saved {
+		if !seeds[addr] {
+			addresses = append(addresses, addr)
+		}
+	}
+	return addresses
+}
@@ -28,6 +28,18 @@ const (
 	MessageTypePong        MessageType = "pong"
 	MessageTypeAddr        MessageType = "addr"
 	MessageTypeGetAddr     MessageType = "getaddr"
+
+	// Light protocol, see package light
+	MessageTypeGetHeaders MessageType = "getheaders"
+	MessageTypeHeaders    MessageType = "headers"
+	MessageTypeGetProof   MessageType = "getproof"
+	MessageTypeProof      MessageType = "proof"
+
+	// Block sync protocol, see package downloader. Blocks are requested
+	// with MessageTypeGetBlocks.
+	MessageTypeGetStatus MessageType = "getstatus"
+	MessageTypeStatus    MessageType = "status"
+	MessageTypeBlocks    MessageType = "blocks"
 )
 
 // Message represents a P2P network message
@@ -54,6 +66,9 @@ type Peer struct {
 type Server struct {
 	config    *config.NetworkConfig
 	peers     map[string]*Peer
+	maxPeers  int      // see SetMaxPeers
+	peerFile  string   // saved peer addresses, see SetPeerFile
+	saved     []string // addresses read from or last written to peerFile
 	listener  net.Listener
 	logger    *logger.Logger
 	ctx       context.Context
@@ -77,6 +92,7 @@ func NewServer(config *config.NetworkConfig) *Server {
 	server := &Server{
 		config:          config,
 		peers:           make(map[string]*Peer),
+		maxPeers:        config.MaxPeers,
 		logger:          logger.NewLogger("p2p"),
 		ctx:             ctx,
 		cancel:          cancel,
@@ -100,11 +116,20 @@ func (s *Server) Start() error {
 	}
 	s.listener = listener
 
+	// Load the peers saved by the last run
+	if s.peerFile != "" {
+		saved, err := s.loadPeers()
+		if err != nil {
+			s.logger.Warning("Ignoring saved peers", "error", err)
+		}
+		s.saved = saved
+	}
+
 	// Start accepting connections
 	s.wg.Add(1)
 	go s.acceptConnections()
 
-	// Connect to seed nodes
+	// Connect to seed nodes and saved peers
 	s.wg.Add(1)
 	go s.connectToSeedNodes()
 
@@ -122,6 +147,14 @@ func (s *Server) Stop() error {
 
 	s.cancel()
 
+	// Save the peers before their connections are closed, unless the
+	// server never started and the saved ones were not loaded
+	if s.listener != nil {
+		if err := s.savePeers(); err != nil {
+			s.logger.Warning("Failed to save peers", "error", err)
+		}
+	}
+
 	// Close listener
 	if s.listener != nil {
 		s.listener.Close()
@@ -159,7 +192,7 @@ func (s *Server) acceptConnections() {
 			}
 
 			// Check peer limit
-			if s.GetPeerCount() >= s.config.MaxPeers {
+			if s.GetPeerCount() >= s.MaxPeers() {
 				s.logger.Warning("Rejecting connection, peer limit reached")
 				conn.Close()
 				continue
@@ -171,20 +204,21 @@ func (s *Server) acceptConnections() {
 	}
 }
 
-// connectToSeedNodes connects to configured seed nodes
+// connectToSeedNodes connects to configured seed nodes and the peers saved
+// by the last run
 func (s *Server) connectToSeedNodes() {
 	defer s.wg.Done()
 
-	for _, seedNode := range s.config.SeedNodes {
+	for _, seedNode := range s.dialAddresses() {
 		select {
 		case <-s.ctx.Done():
 			return
 		default:
-			s.logger.Info("Connecting to seed node", "address", seedNode)
+			s.logger.Info("Connecting to peer", "address", seedNode)
 			
 			conn, err := net.DialTimeout("tcp", seedNode, time.Duration(s.config.Timeout)*time.Second)
 			if err != nil {
-				s.logger.Warning("Failed to connect to seed node", "address", seedNode, "error", err)
+				s.logger.Warning("Failed to connect to peer", "address", seedNode, "error", err)
 				continue
 			}
 
@@ -442,6 +476,9 @@ func (s *Server) managePeers() {
 			return
 		case <-ticker.C:
 			s.performPeerMaintenance()
+			if err := s.savePeers(); err != nil {
+				s.logger.Warning("Failed to save peers", "error", err)
+			}
 		}
 	}
 }
@@ -475,6 +512,22 @@ func (s *Server) GetPeerCount() int {
 	return len(s.peers)
 }
 
+// MaxPeers returns the number of peers above which connections are refused
+func (s *Server) MaxPeers() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.maxPeers
+}
+
+// SetMaxPeers changes the peer limit. Lowering it refuses new connections
+// until enough peers left, connected peers are kept.
+func (s *Server) SetMaxPeers(maxPeers int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxPeers = maxPeers
+	s.logger.Info("Peer limit changed", "maxPeers", maxPeers)
+}
+
 // GetPeers returns a list of connected peers
 func (s *Server) GetPeers() []*Peer {
 	s.mu.RLock()
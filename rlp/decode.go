@@ -0,0 +1,123 @@
+package rlp
+
+import (
+	"errors"
+	"math/big"
+)
+
+var (
+	ErrUnexpectedEOF = errors.New("rlp: unexpected end of input")
+	ErrExpectedList  = errors.New("rlp: expected list")
+	ErrExpectedBytes = errors.New("rlp: expected string")
+	ErrCanonSize     = errors.New("rlp: non-canonical size information")
+	ErrCanonInt      = errors.New("rlp: non-canonical integer (leading zero bytes)")
+	ErrUintOverflow  = errors.New("rlp: uint overflow")
+)
+
+// Split returns the first item of b: whether it is a list, its payload and
+// the bytes following it
+func Split(b []byte) (isList bool, content, rest []byte, err error) {
+	if len(b) == 0 {
+		return false, nil, nil, ErrUnexpectedEOF
+	}
+
+	var offset, size uint64
+	prefix := b[0]
+	switch {
+	case prefix < 0x80:
+		// A single byte is its own encoding
+		return false, b[:1], b[1:], nil
+	case prefix < 0xb8:
+		offset, size = 1, uint64(prefix-0x80)
+		if size == 1 && len(b) > 1 && b[1] < 0x80 {
+			return false, nil, nil, ErrCanonSize
+		}
+	case prefix < 0xc0:
+		lenOfLen := uint64(prefix - 0xb7)
+		if size, err = readSize(b[1:], lenOfLen); err != nil {
+			return false, nil, nil, err
+		}
+		offset = 1 + lenOfLen
+	case prefix < 0xf8:
+		isList, offset, size = true, 1, uint64(prefix-0xc0)
+	default:
+		lenOfLen := uint64(prefix - 0xf7)
+		if size, err = readSize(b[1:], lenOfLen); err != nil {
+			return false, nil, nil, err
+		}
+		isList, offset = true, 1+lenOfLen
+	}
+
+	if size > uint64(len(b))-offset {
+		return false, nil, nil, ErrUnexpectedEOF
+	}
+	return isList, b[offset : offset+size], b[offset+size:], nil
+}
+
+// SplitList returns the payload of the list at the start of b and the bytes
+// following it
+func SplitList(b []byte) (content, rest []byte, err error) {
+	isList, content, rest, err := Split(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !isList {
+		return nil, nil, ErrExpectedList
+	}
+	return content, rest, nil
+}
+
+// SplitString returns the payload of the string at the start of b and the
+// bytes following it
+func SplitString(b []byte) (content, rest []byte, err error) {
+	isList, content, rest, err := Split(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if isList {
+		return nil, nil, ErrExpectedBytes
+	}
+	return content, rest, nil
+}
+
+// DecodeUint64 decodes the payload of a string holding an integer
+func DecodeUint64(content []byte) (uint64, error) {
+	if len(content) > 8 {
+		return 0, ErrUintOverflow
+	}
+	if len(content) > 0 && content[0] == 0 {
+		return 0, ErrCanonInt
+	}
+	var i uint64
+	for _, b := range content {
+		i = i<<8 | uint64(b)
+	}
+	return i, nil
+}
+
+// DecodeBig decodes the payload of a string holding a non-negative integer
+func DecodeBig(content []byte) (*big.Int, error) {
+	if len(content) > 0 && content[0] == 0 {
+		return nil, ErrCanonInt
+	}
+	return new(big.Int).SetBytes(content), nil
+}
+
+// readSize reads the big endian length of lenOfLen bytes at the start of b.
+// Lengths below 56 must use the short form.
+func readSize(b []byte, lenOfLen uint64) (uint64, error) {
+	if uint64(len(b)) < lenOfLen {
+		return 0, ErrUnexpectedEOF
+	}
+	if lenOfLen > 8 || b[0] == 0 {
+		return 0, ErrCanonSize
+	}
+	var size uint64
+	for _, c := range b[:lenOfLen] {
+		size = size<<8 | uint64(c)
+	}
+	if size < 56 {
+		return 0, ErrCanonSize
+	}
+	return size, nil
+}
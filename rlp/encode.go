@@ -0,0 +1,60 @@
+package rlp
+
+import (
+	"math/big"
+)
+
+// EncodeBytes encodes b as an RLP string
+func EncodeBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return []byte{b[0]}
+	}
+	return append(encodeLength(len(b), 0x80), b...)
+}
+
+// EncodeUint64 encodes i as an RLP string holding its minimal big endian
+// representation, zero is the empty string
+func EncodeUint64(i uint64) []byte {
+	return EncodeBytes(uintBytes(i))
+}
+
+// EncodeBig encodes a non-negative integer, nil encodes as zero
+func EncodeBig(i *big.Int) []byte {
+	if i == nil {
+		return EncodeBytes(nil)
+	}
+	return EncodeBytes(i.Bytes())
+}
+
+// EncodeList wraps already encoded items into an RLP list
+func EncodeList(items ...[]byte) []byte {
+	size := 0
+	for _, item := range items {
+		size += len(item)
+	}
+	out := encodeLength(size, 0xc0)
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+// encodeLength returns the header of a string (offset 0x80) or list
+// (offset 0xc0) with a payload of length bytes
+func encodeLength(length int, offset byte) []byte {
+	if length < 56 {
+		return []byte{offset + byte(length)}
+	}
+	lenBytes := uintBytes(uint64(length))
+	return append([]byte{offset + 55 + byte(len(lenBytes))}, lenBytes...)
+}
+
+// uintBytes returns the big endian representation of i without leading
+// zeros
+func uintBytes(i uint64) []byte {
+	var out []byte
+	for ; i > 0; i >>= 8 {
+		out = append([]byte{byte(i)}, out...)
+	}
+	return out
+}
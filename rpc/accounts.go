@@ -0,0 +1,248 @@
+package rpc
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+)
+
+// defaultUnlockDuration is how long personal_unlockAccount unlocks an
+// account without a duration parameter
+const defaultUnlockDuration = 300 * time.Second
+
+func (s *Server) ethAccounts(params interface{}) (interface{}, error) {
+	result := []string{}
+	if s.accounts == nil {
+		return result, nil
+	}
+	for _, addr := range s.accounts.Addresses() {
+		result = append(result, addr.Hex())
+	}
+	return result, nil
+}
+
+// ethSign signs a message with the prefix of eth_sign, so that a signed
+// message can not be a transaction
+func (s *Server) ethSign(params interface{}) (interface{}, error) {
+	paramList, ok := params.([]interface{})
+	if !ok || len(paramList) < 2 {
+		return nil, fmt.Errorf("invalid parameters")
+	}
+	if s.accounts == nil {
+		return nil, fmt.Errorf("no local accounts")
+	}
+
+	addrStr, ok := paramList[0].(string)
+	if !ok || !crypto.IsHexAddress(addrStr) {
+		return nil, fmt.Errorf("invalid address parameter")
+	}
+	dataStr, ok := paramList[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid data parameter")
+	}
+	data, err := crypto.Decode(dataStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data: %v", err)
+	}
+
+	hash := crypto.Keccak256Hash([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(data))), data)
+	sig, err := s.accounts.SignHash(crypto.HexToAddress(addrStr), hash)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27 // v of eth_sign is 27 or 28
+	return crypto.Encode(sig), nil
+}
+
+// ethSendTransaction signs a transaction with a local account and submits
+// it. The nonce, gas and fees are filled in unless given.
+func (s *Server) ethSendTransaction(params interface{}) (interface{}, error) {
+	paramList, ok := params.([]interface{})
+	if !ok || len(paramList) < 1 {
+		return nil, fmt.Errorf("invalid parameters")
+	}
+	if s.accounts == nil {
+		return nil, fmt.Errorf("no local accounts")
+	}
+	args, ok := paramList[0].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid transaction object")
+	}
+	fromStr, ok := args["from"].(string)
+	if !ok || !crypto.IsHexAddress(fromStr) {
+		return nil, fmt.Errorf("invalid from address")
+	}
+
+	tx, err := parseCallObject(args)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Value == nil {
+		tx.Value = new(big.Int)
+	}
+	if nonce, ok := args["nonce"].(string); ok {
+		if tx.Nonce, err = crypto.DecodeUint64(nonce); err != nil {
+			return nil, fmt.Errorf("invalid nonce: %v", err)
+		}
+	} else {
+		tx.Nonce = s.pendingNonce(tx.From)
+	}
+	if err := s.setFees(tx, args); err != nil {
+		return nil, err
+	}
+	if tx.GasLimit == 0 {
+		if tx.GasLimit, err = s.blockchain.EstimateGas(tx, nil); err != nil {
+			return nil, fmt.Errorf("failed to estimate gas: %v", err)
+		}
+	}
+
+	if err := s.accounts.SignTx(tx.From, tx, s.blockchain.ChainID()); err != nil {
+		return nil, err
+	}
+	if err := s.mempool.AddLocalTransaction(tx); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Transaction signed and submitted", "hash", tx.Hash.Hex(), "type", tx.Type, "from", tx.From.Hex(), "nonce", tx.Nonce)
+
+	return tx.Hash.Hex(), nil
+}
+
+// pendingNonce returns the nonce following the pooled transactions of from
+func (s *Server) pendingNonce(from crypto.Address) uint64 {
+	nonce := s.blockchain.GetNonce(from)
+	for _, tx := range s.mempool.GetTransactionsByFrom(from) {
+		if tx.Nonce == nonce {
+			nonce++
+		}
+	}
+	return nonce
+}
+
+// setFees sets the type and fees of tx. A gas price makes a legacy
+// transaction, otherwise it pays the base fee (EIP-1559) with the given or
+// suggested tip and a fee cap leaving room for the base fee to double.
+func (s *Server) setFees(tx *core.Transaction, args map[string]interface{}) error {
+	if tx.GasPrice != nil {
+		tx.Type = core.LegacyTxType
+		return nil
+	}
+
+	baseFee := s.blockchain.CurrentHeader().BaseFee
+	tip, err := optionalBig(args, "maxPriorityFeePerGas")
+	if err != nil {
+		return err
+	}
+	feeCap, err := optionalBig(args, "maxFeePerGas")
+	if err != nil {
+		return err
+	}
+	if baseFee == nil && tip == nil && feeCap == nil {
+		tx.Type = core.LegacyTxType
+		tx.GasPrice = s.gasOracle.SuggestGasPrice()
+		return nil
+	}
+
+	if tip == nil {
+		tip = s.gasOracle.SuggestTipCap()
+	}
+	if feeCap == nil {
+		feeCap = new(big.Int).Set(tip)
+		if baseFee != nil {
+			feeCap.Add(feeCap, new(big.Int).Lsh(baseFee, 1))
+		}
+	}
+	if tip.Cmp(feeCap) > 0 {
+		return core.ErrTipAboveFeeCap
+	}
+	tx.Type = core.DynamicFeeTxType
+	tx.GasTipCap = tip
+	tx.GasPrice = feeCap
+	return nil
+}
+
+// optionalBig decodes the quantity args[name], nil if it is missing
+func optionalBig(args map[string]interface{}, name string) (*big.Int, error) {
+	str, ok := args[name].(string)
+	if !ok {
+		return nil, nil
+	}
+	value, err := crypto.DecodeBig(str)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return value, nil
+}
+
+func (s *Server) personalNewAccount(params interface{}) (interface{}, error) {
+	paramList, ok := params.([]interface{})
+	if !ok || len(paramList) < 1 {
+		return nil, fmt.Errorf("invalid parameters")
+	}
+	if s.accounts == nil {
+		return nil, fmt.Errorf("no keystore")
+	}
+	passphrase, ok := paramList[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid passphrase parameter")
+	}
+
+	account, err := s.accounts.NewAccount(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return account.Address.Hex(), nil
+}
+
+func (s *Server) personalUnlockAccount(params interface{}) (interface{}, error) {
+	paramList, ok := params.([]interface{})
+	if !ok || len(paramList) < 2 {
+		return nil, fmt.Errorf("invalid parameters")
+	}
+	if s.accounts == nil {
+		return nil, fmt.Errorf("no local accounts")
+	}
+	addrStr, ok := paramList[0].(string)
+	if !ok || !crypto.IsHexAddress(addrStr) {
+		return nil, fmt.Errorf("invalid address parameter")
+	}
+	passphrase, ok := paramList[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid passphrase parameter")
+	}
+
+	// A duration of 0 keeps the account unlocked until it is locked
+	duration := defaultUnlockDuration
+	if len(paramList) > 2 && paramList[2] != nil {
+		seconds, ok := paramList[2].(float64)
+		if !ok || seconds < 0 {
+			return nil, fmt.Errorf("invalid duration parameter")
+		}
+		duration = time.Duration(seconds) * time.Second
+	}
+
+	if err := s.accounts.Unlock(crypto.HexToAddress(addrStr), passphrase, duration); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (s *Server) personalLockAccount(params interface{}) (interface{}, error) {
+	paramList, ok := params.([]interface{})
+	if !ok || len(paramList) < 1 {
+		return nil, fmt.Errorf("invalid parameters")
+	}
+	if s.accounts == nil {
+		return nil, fmt.Errorf("no local accounts")
+	}
+	addrStr, ok := paramList[0].(string)
+	if !ok || !crypto.IsHexAddress(addrStr) {
+		return nil, fmt.Errorf("invalid address parameter")
+	}
+
+	s.accounts.Lock(crypto.HexToAddress(addrStr))
+	return true, nil
+}
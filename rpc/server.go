@@ -4,18 +4,23 @@ package rpc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"blockchain-node/accounts"
 	"blockchain-node/config"
 	"blockchain-node/core"
 	"blockchain-node/crypto"
+	"blockchain-node/gasprice"
 	"blockchain-node/logger"
 	"blockchain-node/mempool"
+	"blockchain-node/storage"
 
 	"github.com/gorilla/mux"
 )
@@ -50,13 +55,80 @@ const (
 	RPCErrorCodeMethodNotFound = -32601
 	RPCErrorCodeInvalidParams  = -32602
 	RPCErrorCodeInternalError  = -32603
+
+	// RPCErrorCodeExecutionReverted is returned for reverted calls, the
+	// error data holds the revert payload
+	RPCErrorCodeExecutionReverted = 3
 )
 
+// WorkSource hands out proof-of-work packages to external miners and
+// accepts their solutions
+type WorkSource interface {
+	GetWork() ([4]string, error)
+	SubmitWork(nonce uint64, workHash crypto.Hash) bool
+}
+
+// BackupSource takes backups of the node database while the node runs
+type BackupSource interface {
+	Backup(dir string) error
+}
+
+// DatabaseStatsSource reports the database operation counters shown by the
+// /stats endpoint
+type DatabaseStatsSource interface {
+	DatabaseStats() storage.MeterStats
+}
+
+// AccountSource holds the local accounts eth_sendTransaction and eth_sign
+// sign with
+type AccountSource interface {
+	Addresses() []crypto.Address
+	NewAccount(passphrase string) (accounts.Account, error)
+	Unlock(addr crypto.Address, passphrase string, duration time.Duration) error
+	Lock(addr crypto.Address)
+	SignHash(addr crypto.Address, hash crypto.Hash) ([]byte, error)
+	SignTx(addr crypto.Address, tx *core.Transaction, chainID *big.Int) error
+}
+
+// StatusSource reports the peers, sync state and mining of the node for
+// net_peerCount, eth_syncing, eth_mining and the status endpoints
+type StatusSource interface {
+	PeerCount() int
+	Syncing() bool
+	SyncProgress() (starting, current, highest uint64)
+	Mining() bool
+	HashRate() float64
+	Coinbase() crypto.Address
+}
+
+// ReloadSource reads the node configuration again and applies the settings
+// that can change while the node runs
+type ReloadSource interface {
+	ReloadConfig() ([]string, error)
+}
+
+// LightSource is the header chain and the account access of a light node,
+// which answers the head and account queries instead of the local chain
+type LightSource interface {
+	CurrentHeader() *core.BlockHeader
+	GetAccount(addr crypto.Address) (*core.Account, error)
+}
+
 // Server represents the RPC server
 type Server struct {
 	config     *config.RPCConfig
 	blockchain *core.Blockchain
 	mempool    *mempool.Mempool
+	gasOracle  *gasprice.Oracle
+	work       WorkSource          // nil until set, see SetWorkSource
+	backup     BackupSource        // nil until set, see SetBackupSource
+	dbStats    DatabaseStatsSource // nil until set, see SetDatabaseStatsSource
+	accounts   AccountSource       // nil until set, see SetAccountSource
+	status     StatusSource        // nil until set, see SetStatusSource
+	light      LightSource         // nil unless a light node, see SetLightSource
+	reload     ReloadSource        // nil until set, see SetReloadSource
+	corsMu     sync.RWMutex
+	cors       []string            // allowed origins, see SetCORSOrigins
 	server     *http.Server
 	logger     *logger.Logger
 	
@@ -65,11 +137,13 @@ type Server struct {
 }
 
 // NewServer creates a new RPC server
-func NewServer(config *config.RPCConfig, blockchain *core.Blockchain, mempool *mempool.Mempool) *Server {
+func NewServer(config *config.RPCConfig, blockchain *core.Blockchain, mempool *mempool.Mempool, gasOracle *gasprice.Oracle) *Server {
 	server := &Server{
 		config:     config,
 		blockchain: blockchain,
 		mempool:    mempool,
+		gasOracle:  gasOracle,
+		cors:       config.CORSOrigins,
 		logger:     logger.NewLogger("rpc"),
 		methods:    make(map[string]func(params interface{}) (interface{}, error)),
 	}
@@ -80,6 +154,56 @@ func NewServer(config *config.RPCConfig, blockchain *core.Blockchain, mempool *m
 	return server
 }
 
+// SetWorkSource sets the source of mining work for eth_getWork and
+// eth_submitWork
+func (s *Server) SetWorkSource(work WorkSource) {
+	s.work = work
+}
+
+// SetBackupSource sets the source of database backups for lumina_backup
+func (s *Server) SetBackupSource(backup BackupSource) {
+	s.backup = backup
+}
+
+// SetDatabaseStatsSource sets the source of the database counters for the
+// /stats endpoint
+func (s *Server) SetDatabaseStatsSource(dbStats DatabaseStatsSource) {
+	s.dbStats = dbStats
+}
+
+// SetAccountSource sets the local accounts for eth_accounts, eth_sign,
+// eth_sendTransaction and the personal methods
+func (s *Server) SetAccountSource(accounts AccountSource) {
+	s.accounts = accounts
+}
+
+// SetStatusSource sets the source of the peer count, sync state and mining
+// status
+func (s *Server) SetStatusSource(status StatusSource) {
+	s.status = status
+}
+
+// SetReloadSource sets the source of configuration reloads for
+// lumina_reloadConfig
+func (s *Server) SetReloadSource(reload ReloadSource) {
+	s.reload = reload
+}
+
+// SetCORSOrigins replaces the origins allowed to call the server from a
+// browser, taking effect for the next request
+func (s *Server) SetCORSOrigins(origins []string) {
+	s.corsMu.Lock()
+	defer s.corsMu.Unlock()
+	s.cors = origins
+}
+
+// SetLightSource makes eth_blockNumber, eth_getBalance and
+// eth_getTransactionCount answer from the header chain and the peers of a
+// light node
+func (s *Server) SetLightSource(light LightSource) {
+	s.light = light
+}
+
 // Start starts the RPC server
 func (s *Server) Start() error {
 	s.logger.Info("Starting RPC server", "host", s.config.Host, "port", s.config.Port)
@@ -117,6 +241,9 @@ func (s *Server) Start() error {
 
 // Stop stops the RPC server
 func (s *Server) Stop() error {
+	if s.server == nil {
+		return nil
+	}
 	s.logger.Info("Stopping RPC server...")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -135,7 +262,10 @@ func (s *Server) Stop() error {
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers
-		for _, origin := range s.config.CORSOrigins {
+		s.corsMu.RLock()
+		origins := s.cors
+		s.corsMu.RUnlock()
+		for _, origin := range origins {
 			if origin == "*" || strings.Contains(r.Header.Get("Origin"), origin) {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 				break
@@ -181,6 +311,11 @@ func (s *Server) handleJSONRPC(w http.ResponseWriter, r *http.Request) {
 	// Execute method
 	result, err := handler(req.Params)
 	if err != nil {
+		var revertErr *core.RevertError
+		if errors.As(err, &revertErr) {
+			s.sendError(w, req.ID, RPCErrorCodeExecutionReverted, revertErr.Error(), crypto.Encode(revertErr.Data))
+			return
+		}
 		s.sendError(w, req.ID, RPCErrorCodeInternalError, "Internal error", err.Error())
 		return
 	}
@@ -221,9 +356,13 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		"status":      "healthy",
 		"timestamp":   time.Now().Unix(),
 		"block_height": s.blockchain.GetBlockNumber().Uint64(),
-		"peer_count":  0, // This would be updated with actual peer count
+		"peer_count":  0,
 		"mempool_size": s.mempool.Size(),
 	}
+	if s.status != nil {
+		health["peer_count"] = s.status.PeerCount()
+		health["syncing"] = s.status.Syncing()
+	}
 
 	json.NewEncoder(w).Encode(health)
 }
@@ -244,6 +383,11 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	s.addNodeStatus(stats)
+	if s.dbStats != nil {
+		stats["database"] = s.dbStats.DatabaseStats()
+	}
+
 	json.NewEncoder(w).Encode(stats)
 }
 
@@ -258,10 +402,26 @@ func (s *Server) registerMethods() {
 	s.methods["eth_getBlockByNumber"] = s.ethGetBlockByNumber
 	s.methods["eth_getTransactionByHash"] = s.ethGetTransactionByHash
 	s.methods["eth_getTransactionReceipt"] = s.ethGetTransactionReceipt
+	s.methods["eth_getCode"] = s.ethGetCode
+	s.methods["eth_getProof"] = s.ethGetProof
 	s.methods["eth_call"] = s.ethCall
 	s.methods["eth_estimateGas"] = s.ethEstimateGas
 	s.methods["eth_gasPrice"] = s.ethGasPrice
+	s.methods["eth_maxPriorityFeePerGas"] = s.ethMaxPriorityFeePerGas
 	s.methods["eth_chainId"] = s.ethChainId
+	s.methods["eth_getWork"] = s.ethGetWork
+	s.methods["eth_submitWork"] = s.ethSubmitWork
+	s.methods["eth_accounts"] = s.ethAccounts
+	s.methods["eth_sign"] = s.ethSign
+	s.methods["eth_sendTransaction"] = s.ethSendTransaction
+	s.methods["eth_syncing"] = s.ethSyncing
+	s.methods["eth_mining"] = s.ethMining
+	s.methods["eth_hashrate"] = s.ethHashrate
+	s.methods["eth_coinbase"] = s.ethCoinbase
+	
+	// Debug methods
+	s.methods["debug_getBadBlocks"] = s.debugGetBadBlocks
+	s.methods["debug_preimage"] = s.debugPreimage
 	
 	// Network methods
 	s.methods["net_version"] = s.netVersion
@@ -274,11 +434,32 @@ func (s *Server) registerMethods() {
 	s.methods["lumina_sendRawTransaction"] = s.ethSendRawTransaction
 	s.methods["lumina_getMempoolSize"] = s.luminaGetMempoolSize
 	s.methods["lumina_getStats"] = s.luminaGetStats
+
+	// Mempool administration
+	if s.config.Admin {
+		s.methods["lumina_mempoolEvict"] = s.luminaMempoolEvict
+		s.methods["lumina_mempoolFlushSender"] = s.luminaMempoolFlushSender
+		s.methods["lumina_mempoolPause"] = s.luminaMempoolPause
+		s.methods["lumina_mempoolResume"] = s.luminaMempoolResume
+		s.methods["lumina_mempoolSetMinGasPrice"] = s.luminaMempoolSetMinGasPrice
+		s.methods["lumina_backup"] = s.luminaBackup
+		s.methods["lumina_reloadConfig"] = s.luminaReloadConfig
+
+		// Unlocking over RPC sends passphrases, which only the operator
+		// should do
+		s.methods["personal_listAccounts"] = s.ethAccounts
+		s.methods["personal_newAccount"] = s.personalNewAccount
+		s.methods["personal_unlockAccount"] = s.personalUnlockAccount
+		s.methods["personal_lockAccount"] = s.personalLockAccount
+	}
 }
 
 // RPC method implementations
 
 func (s *Server) ethBlockNumber(params interface{}) (interface{}, error) {
+	if s.light != nil {
+		return crypto.EncodeBig(s.light.CurrentHeader().Number), nil
+	}
 	blockNumber := s.blockchain.GetBlockNumber()
 	return crypto.EncodeBig(blockNumber), nil
 }
@@ -293,13 +474,20 @@ func (s *Server) ethGetBalance(params interface{}) (interface{}, error) {
 	if !ok {
 		return nil, fmt.Errorf("invalid address parameter")
 	}
+	if len(paramList) > 1 {
+		if err := s.requireHeadState(paramList[1]); err != nil {
+			return nil, err
+		}
+	}
 
-	address := crypto.HexToAddress(addressStr)
-	
-	// For now, return zero balance (implement with state DB integration)
-	balance := big.NewInt(0)
-	
-	return crypto.EncodeBig(balance), nil
+	if s.light != nil {
+		account, err := s.light.GetAccount(crypto.HexToAddress(addressStr))
+		if err != nil {
+			return nil, err
+		}
+		return crypto.EncodeBig(account.Balance), nil
+	}
+	return crypto.EncodeBig(s.blockchain.GetBalance(crypto.HexToAddress(addressStr))), nil
 }
 
 func (s *Server) ethGetTransactionCount(params interface{}) (interface{}, error) {
@@ -314,15 +502,33 @@ func (s *Server) ethGetTransactionCount(params interface{}) (interface{}, error)
 	}
 
 	address := crypto.HexToAddress(addressStr)
-	
-	// For now, return zero nonce (implement with state DB integration)
-	nonce := uint64(0)
-	
-	// Check mempool for pending transactions
-	pendingTxs := s.mempool.GetTransactionsByFrom(address)
-	nonce += uint64(len(pendingTxs))
-	
-	return crypto.EncodeUint64(nonce), nil
+
+	// A light node has no pool of its own, the pending nonce is the one of
+	// the head state
+	if s.light != nil {
+		if len(paramList) > 1 {
+			if err := s.requireHeadState(paramList[1]); err != nil {
+				return nil, err
+			}
+		}
+		account, err := s.light.GetAccount(address)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.EncodeUint64(account.Nonce), nil
+	}
+
+	// The pending nonce counts the pooled transactions that follow the
+	// state nonce, the one the next transaction of address needs
+	if len(paramList) > 1 && paramList[1] == "pending" {
+		return crypto.EncodeUint64(s.pendingNonce(address)), nil
+	}
+	if len(paramList) > 1 {
+		if err := s.requireHeadState(paramList[1]); err != nil {
+			return nil, err
+		}
+	}
+	return crypto.EncodeUint64(s.blockchain.GetNonce(address)), nil
 }
 
 func (s *Server) ethSendRawTransaction(params interface{}) (interface{}, error) {
@@ -336,13 +542,44 @@ func (s *Server) ethSendRawTransaction(params interface{}) (interface{}, error)
 		return nil, fmt.Errorf("invalid transaction data parameter")
 	}
 
-	// For now, return a mock transaction hash
-	// In a real implementation, decode the transaction and add to mempool
-	txHash := crypto.HexToHash(fmt.Sprintf("0x%x", time.Now().UnixNano()))
-	
-	s.logger.Info("Raw transaction received", "data", txDataStr, "hash", txHash.Hex())
-	
-	return txHash.Hex(), nil
+	raw, err := crypto.Decode(txDataStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction data: %v", err)
+	}
+	tx, err := core.DecodeTransaction(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resubmitted invalid transactions are turned away before recovering
+	// their sender again
+	if err := s.mempool.Rejected(tx.Hash); err != nil {
+		return nil, err
+	}
+
+	// Reject transactions that were signed for another chain or that could
+	// be replayed on any chain (EIP-155)
+	if !tx.Protected() {
+		if !s.config.AllowUnprotectedTxs {
+			return nil, fmt.Errorf("only replay-protected (EIP-155) transactions allowed over RPC")
+		}
+	} else if tx.ChainIDOf().Cmp(s.blockchain.ChainID()) != 0 {
+		return nil, fmt.Errorf("%w: have %v, want %v", core.ErrInvalidChainID, tx.ChainIDOf(), s.blockchain.ChainID())
+	}
+	if tx.From, err = core.Sender(tx); err != nil {
+		err = fmt.Errorf("%v: %v", core.ErrInvalidSignature, err)
+		s.mempool.MarkRejected(tx.Hash, err)
+		return nil, err
+	}
+
+	// Transactions submitted to this node are local to it
+	if err := s.mempool.AddLocalTransaction(tx); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Raw transaction received", "hash", tx.Hash.Hex(), "type", tx.Type, "from", tx.From.Hex())
+
+	return tx.Hash.Hex(), nil
 }
 
 func (s *Server) ethGetBlockByHash(params interface{}) (interface{}, error) {
@@ -375,18 +612,10 @@ func (s *Server) ethGetBlockByNumber(params interface{}) (interface{}, error) {
 	
 	switch v := paramList[0].(type) {
 	case string:
-		if v == "latest" {
-			blockNumber = s.blockchain.GetBlockNumber()
-		} else if v == "earliest" {
-			blockNumber = big.NewInt(0)
-		} else if v == "pending" {
-			blockNumber = s.blockchain.GetBlockNumber()
-		} else {
-			var err error
-			blockNumber, err = crypto.DecodeBig(v)
-			if err != nil {
-				return nil, fmt.Errorf("invalid block number: %v", err)
-			}
+		var err error
+		blockNumber, err = s.resolveBlockTag(v)
+		if err != nil {
+			return nil, err
 		}
 	case float64:
 		blockNumber = big.NewInt(int64(v))
@@ -402,6 +631,33 @@ func (s *Server) ethGetBlockByNumber(params interface{}) (interface{}, error) {
 	return s.formatBlock(block), nil
 }
 
+// resolveBlockTag converts a block tag ("latest", "safe", ...) or a hex
+// encoded number into a block number
+func (s *Server) resolveBlockTag(tag string) (*big.Int, error) {
+	switch tag {
+	case "latest", "pending":
+		return s.blockchain.GetBlockNumber(), nil
+	case "earliest":
+		return big.NewInt(0), nil
+	case "safe":
+		if block := s.blockchain.SafeBlock(); block != nil {
+			return block.Header.Number, nil
+		}
+		return nil, fmt.Errorf("safe block not available")
+	case "finalized":
+		if block := s.blockchain.FinalizedBlock(); block != nil {
+			return block.Header.Number, nil
+		}
+		return nil, fmt.Errorf("finalized block not available")
+	}
+
+	blockNumber, err := crypto.DecodeBig(tag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block number: %v", err)
+	}
+	return blockNumber, nil
+}
+
 func (s *Server) ethGetTransactionByHash(params interface{}) (interface{}, error) {
 	paramList, ok := params.([]interface{})
 	if !ok || len(paramList) < 1 {
@@ -436,33 +692,240 @@ func (s *Server) ethGetTransactionReceipt(params interface{}) (interface{}, erro
 		return nil, fmt.Errorf("invalid hash parameter")
 	}
 
-	// TODO: Implement transaction receipt lookup
-	// For now, return null
-	return nil, nil
+	receipt := s.blockchain.GetTransactionReceipt(crypto.HexToHash(hashStr))
+	if receipt == nil {
+		return nil, nil // Pending or unknown transactions have no receipt
+	}
+	return formatReceipt(receipt), nil
+}
+
+func (s *Server) ethGetCode(params interface{}) (interface{}, error) {
+	paramList, ok := params.([]interface{})
+	if !ok || len(paramList) < 1 {
+		return nil, fmt.Errorf("invalid parameters")
+	}
+
+	addressStr, ok := paramList[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid address parameter")
+	}
+	if len(paramList) > 1 {
+		if err := s.requireHeadState(paramList[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return crypto.Encode(s.blockchain.GetCode(crypto.HexToAddress(addressStr))), nil
+}
+
+func (s *Server) ethGetProof(params interface{}) (interface{}, error) {
+	paramList, ok := params.([]interface{})
+	if !ok || len(paramList) < 2 {
+		return nil, fmt.Errorf("invalid parameters")
+	}
+
+	addressStr, ok := paramList[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid address parameter")
+	}
+	keyList, ok := paramList[1].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid storage keys parameter")
+	}
+	keys := make([]crypto.Hash, 0, len(keyList))
+	for _, key := range keyList {
+		keyStr, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid storage key %v", key)
+		}
+		keys = append(keys, crypto.HexToHash(keyStr))
+	}
+	if len(paramList) > 2 {
+		if err := s.requireHeadState(paramList[2]); err != nil {
+			return nil, err
+		}
+	}
+
+	proof, err := s.blockchain.GetProof(crypto.HexToAddress(addressStr), keys)
+	if err != nil {
+		return nil, err
+	}
+
+	storageProof := make([]map[string]interface{}, 0, len(proof.StorageProof))
+	for _, slot := range proof.StorageProof {
+		storageProof = append(storageProof, map[string]interface{}{
+			"key":   slot.Key.Hex(),
+			"value": crypto.EncodeBig(new(big.Int).SetBytes(slot.Value.Bytes())),
+			"proof": formatProof(slot.Proof),
+		})
+	}
+	return map[string]interface{}{
+		"address":      proof.Address.Hex(),
+		"accountProof": formatProof(proof.AccountProof),
+		"balance":      crypto.EncodeBig(proof.Balance),
+		"codeHash":     proof.CodeHash.Hex(),
+		"nonce":        crypto.EncodeUint64(proof.Nonce),
+		"storageHash":  proof.StorageHash.Hex(),
+		"storageProof": storageProof,
+	}, nil
+}
+
+// formatProof hex encodes the nodes of a Merkle proof
+func formatProof(proof [][]byte) []string {
+	result := make([]string, len(proof))
+	for i, node := range proof {
+		result[i] = crypto.Encode(node)
+	}
+	return result
 }
 
 func (s *Server) ethCall(params interface{}) (interface{}, error) {
-	// TODO: Implement contract call simulation
-	return "0x", nil
+	msg, overrides, err := s.parseCallParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := s.blockchain.Call(msg, overrides)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Encode(ret), nil
 }
 
 func (s *Server) ethEstimateGas(params interface{}) (interface{}, error) {
-	// Return default gas estimate
-	return crypto.EncodeUint64(21000), nil
+	msg, overrides, err := s.parseCallParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	gas, err := s.blockchain.EstimateGas(msg, overrides)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.EncodeUint64(gas), nil
+}
+
+// requireHeadState checks that a block parameter refers to the head block,
+// the only block whose state is available
+func (s *Server) requireHeadState(param interface{}) error {
+	tag, ok := param.(string)
+	if !ok {
+		return fmt.Errorf("invalid block number parameter")
+	}
+	if s.light != nil {
+		if tag != "latest" && tag != "pending" {
+			return fmt.Errorf("a light node only serves the latest state")
+		}
+		return nil
+	}
+	number, err := s.resolveBlockTag(tag)
+	if err != nil {
+		return err
+	}
+	if number.Cmp(s.blockchain.GetBlockNumber()) != 0 {
+		return fmt.Errorf("state of block %v is not available", number)
+	}
+	return nil
+}
+
+// parseCallParams converts the call object of eth_call and eth_estimateGas
+// into an unsigned message and parses the optional state override set.
+// Only the state of the latest block is available, so other block tags are
+// refused.
+func (s *Server) parseCallParams(params interface{}) (*core.Transaction, core.StateOverride, error) {
+	paramList, ok := params.([]interface{})
+	if !ok || len(paramList) < 1 {
+		return nil, nil, fmt.Errorf("invalid parameters")
+	}
+
+	args, ok := paramList[0].(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid call object")
+	}
+
+	if len(paramList) > 1 && paramList[1] != nil {
+		if err := s.requireHeadState(paramList[1]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var overrides core.StateOverride
+	if len(paramList) > 2 && paramList[2] != nil {
+		var err error
+		if overrides, err = parseStateOverride(paramList[2]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	msg, err := parseCallObject(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	return msg, overrides, nil
+}
+
+// parseCallObject converts a call object into an unsigned message
+func parseCallObject(args map[string]interface{}) (*core.Transaction, error) {
+
+	msg := &core.Transaction{}
+	if from, ok := args["from"].(string); ok {
+		msg.From = crypto.HexToAddress(from)
+	}
+	if to, ok := args["to"].(string); ok {
+		address := crypto.HexToAddress(to)
+		msg.To = &address
+	}
+	if gas, ok := args["gas"].(string); ok {
+		gasLimit, err := crypto.DecodeUint64(gas)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gas: %v", err)
+		}
+		msg.GasLimit = gasLimit
+	}
+	if gasPrice, ok := args["gasPrice"].(string); ok {
+		price, err := crypto.DecodeBig(gasPrice)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gasPrice: %v", err)
+		}
+		msg.GasPrice = price
+	}
+	if value, ok := args["value"].(string); ok {
+		amount, err := crypto.DecodeBig(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value: %v", err)
+		}
+		msg.Value = amount
+	}
+
+	// "input" is the current name of the field, "data" the legacy one
+	data, ok := args["input"].(string)
+	if !ok {
+		data, ok = args["data"].(string)
+	}
+	if ok {
+		input, err := crypto.Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input: %v", err)
+		}
+		msg.Data = input
+	}
+	return msg, nil
 }
 
 func (s *Server) ethGasPrice(params interface{}) (interface{}, error) {
-	gasPrice := big.NewInt(1000000000) // 1 Gwei
-	return crypto.EncodeBig(gasPrice), nil
+	return crypto.EncodeBig(s.gasOracle.SuggestGasPrice()), nil
+}
+
+func (s *Server) ethMaxPriorityFeePerGas(params interface{}) (interface{}, error) {
+	return crypto.EncodeBig(s.gasOracle.SuggestTipCap()), nil
 }
 
 func (s *Server) ethChainId(params interface{}) (interface{}, error) {
-	chainId := big.NewInt(1337) // Default chain ID
-	return crypto.EncodeBig(chainId), nil
+	return crypto.EncodeBig(s.blockchain.ChainID()), nil
 }
 
 func (s *Server) netVersion(params interface{}) (interface{}, error) {
-	return "1337", nil
+	return s.blockchain.ChainID().String(), nil
 }
 
 func (s *Server) netListening(params interface{}) (interface{}, error) {
@@ -470,7 +933,112 @@ func (s *Server) netListening(params interface{}) (interface{}, error) {
 }
 
 func (s *Server) netPeerCount(params interface{}) (interface{}, error) {
-	return crypto.EncodeUint64(0), nil // TODO: Get actual peer count
+	if s.status == nil {
+		return crypto.EncodeUint64(0), nil
+	}
+	return crypto.EncodeUint64(uint64(s.status.PeerCount())), nil
+}
+
+// ethSyncing returns false, or the sync progress while the node is behind
+// its peers
+func (s *Server) ethSyncing(params interface{}) (interface{}, error) {
+	if s.status == nil || !s.status.Syncing() {
+		return false, nil
+	}
+	starting, current, highest := s.status.SyncProgress()
+	return map[string]interface{}{
+		"startingBlock": crypto.EncodeUint64(starting),
+		"currentBlock":  crypto.EncodeUint64(current),
+		"highestBlock":  crypto.EncodeUint64(highest),
+	}, nil
+}
+
+func (s *Server) ethMining(params interface{}) (interface{}, error) {
+	return s.status != nil && s.status.Mining(), nil
+}
+
+func (s *Server) ethHashrate(params interface{}) (interface{}, error) {
+	if s.status == nil {
+		return crypto.EncodeUint64(0), nil
+	}
+	return crypto.EncodeUint64(uint64(s.status.HashRate())), nil
+}
+
+func (s *Server) ethCoinbase(params interface{}) (interface{}, error) {
+	if s.status == nil {
+		return nil, fmt.Errorf("coinbase not available")
+	}
+	return s.status.Coinbase().Hex(), nil
+}
+
+func (s *Server) debugGetBadBlocks(params interface{}) (interface{}, error) {
+	badBlocks := s.blockchain.GetBadBlocks()
+
+	result := make([]map[string]interface{}, 0, len(badBlocks))
+	for _, bad := range badBlocks {
+		result = append(result, map[string]interface{}{
+			"hash":   bad.Block.Hash.Hex(),
+			"number": crypto.EncodeBig(bad.Block.Header.Number),
+			"reason": bad.Reason,
+			"time":   bad.Time.Unix(),
+			"block":  s.formatBlock(bad.Block),
+		})
+	}
+	return result, nil
+}
+
+func (s *Server) debugPreimage(params interface{}) (interface{}, error) {
+	paramList, ok := params.([]interface{})
+	if !ok || len(paramList) < 1 {
+		return nil, fmt.Errorf("invalid parameters")
+	}
+
+	hashStr, ok := paramList[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid hash parameter")
+	}
+
+	preimage := s.blockchain.GetPreimage(crypto.HexToHash(hashStr))
+	if preimage == nil {
+		return nil, fmt.Errorf("preimage not found")
+	}
+	return crypto.Encode(preimage), nil
+}
+
+func (s *Server) ethGetWork(params interface{}) (interface{}, error) {
+	if s.work == nil {
+		return nil, fmt.Errorf("no mining work available")
+	}
+	work, err := s.work.GetWork()
+	if err != nil {
+		return nil, err
+	}
+	return work[:], nil
+}
+
+func (s *Server) ethSubmitWork(params interface{}) (interface{}, error) {
+	paramList, ok := params.([]interface{})
+	if !ok || len(paramList) < 2 {
+		return nil, fmt.Errorf("invalid parameters")
+	}
+	if s.work == nil {
+		return nil, fmt.Errorf("no mining work available")
+	}
+
+	nonceStr, ok := paramList[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid nonce parameter")
+	}
+	nonce, err := crypto.DecodeUint64(nonceStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %v", err)
+	}
+	hashStr, ok := paramList[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid work hash parameter")
+	}
+
+	return s.work.SubmitWork(nonce, crypto.HexToHash(hashStr)), nil
 }
 
 func (s *Server) luminaGetMempoolSize(params interface{}) (interface{}, error) {
@@ -483,34 +1051,157 @@ func (s *Server) luminaGetStats(params interface{}) (interface{}, error) {
 		"mempool_size":  s.mempool.Size(),
 		"mempool_stats": s.mempool.GetStats(),
 	}
+	s.addNodeStatus(stats)
 	return stats, nil
 }
 
+// addNodeStatus adds the peers, sync state and mining status of the node
+// to stats
+func (s *Server) addNodeStatus(stats map[string]interface{}) {
+	if s.status == nil {
+		return
+	}
+	stats["peer_count"] = s.status.PeerCount()
+	stats["syncing"] = s.status.Syncing()
+	stats["mining"] = s.status.Mining()
+	stats["hash_rate"] = s.status.HashRate()
+	stats["coinbase"] = s.status.Coinbase().Hex()
+}
+
+func (s *Server) luminaMempoolEvict(params interface{}) (interface{}, error) {
+	paramList, ok := params.([]interface{})
+	if !ok || len(paramList) < 1 {
+		return nil, fmt.Errorf("invalid parameters")
+	}
+
+	hashStr, ok := paramList[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid hash parameter")
+	}
+
+	return s.mempool.Evict(crypto.HexToHash(hashStr)), nil
+}
+
+func (s *Server) luminaMempoolFlushSender(params interface{}) (interface{}, error) {
+	paramList, ok := params.([]interface{})
+	if !ok || len(paramList) < 1 {
+		return nil, fmt.Errorf("invalid parameters")
+	}
+
+	addressStr, ok := paramList[0].(string)
+	if !ok || !crypto.IsHexAddress(addressStr) {
+		return nil, fmt.Errorf("invalid address parameter")
+	}
+
+	return s.mempool.FlushSender(crypto.HexToAddress(addressStr)), nil
+}
+
+func (s *Server) luminaMempoolPause(params interface{}) (interface{}, error) {
+	s.mempool.Pause()
+	return true, nil
+}
+
+func (s *Server) luminaMempoolResume(params interface{}) (interface{}, error) {
+	s.mempool.Resume()
+	return true, nil
+}
+
+func (s *Server) luminaBackup(params interface{}) (interface{}, error) {
+	paramList, ok := params.([]interface{})
+	if !ok || len(paramList) < 1 {
+		return nil, fmt.Errorf("invalid parameters")
+	}
+	if s.backup == nil {
+		return nil, fmt.Errorf("backups not available")
+	}
+
+	dir, ok := paramList[0].(string)
+	if !ok || dir == "" {
+		return nil, fmt.Errorf("invalid directory parameter")
+	}
+	if err := s.backup.Backup(dir); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (s *Server) luminaReloadConfig(params interface{}) (interface{}, error) {
+	if s.reload == nil {
+		return nil, fmt.Errorf("configuration reload not available")
+	}
+	changed, err := s.reload.ReloadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+func (s *Server) luminaMempoolSetMinGasPrice(params interface{}) (interface{}, error) {
+	paramList, ok := params.([]interface{})
+	if !ok || len(paramList) < 1 {
+		return nil, fmt.Errorf("invalid parameters")
+	}
+
+	priceStr, ok := paramList[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid gas price parameter")
+	}
+	price, err := crypto.DecodeUint64(priceStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gas price: %v", err)
+	}
+
+	s.mempool.SetMinGasPrice(price)
+	return true, nil
+}
+
 // Helper methods for formatting responses
 
 func (s *Server) formatBlock(block *core.Block) map[string]interface{} {
-	return map[string]interface{}{
+	// Blocks without uncles report the hash of an empty uncle list
+	uncleHash := "0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347"
+	if len(block.Uncles) > 0 {
+		uncleHash = block.Header.UncleHash.Hex()
+	}
+
+	result := map[string]interface{}{
 		"number":           crypto.EncodeBig(block.Header.Number),
 		"hash":             block.Hash.Hex(),
 		"parentHash":       block.Header.PreviousHash.Hex(),
 		"nonce":            crypto.EncodeUint64(block.Header.Nonce),
 		"mixHash":          "0x0000000000000000000000000000000000000000000000000000000000000000",
-		"sha3Uncles":       "0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347",
+		"sha3Uncles":       uncleHash,
 		"logsBloom":        "0x" + string(block.Header.LogsBloom[:]),
 		"transactionsRoot": block.Header.TransactionsRoot.Hex(),
 		"stateRoot":        block.Header.StateRoot.Hex(),
 		"receiptsRoot":     block.Header.ReceiptsRoot.Hex(),
 		"miner":            block.Header.Coinbase.Hex(),
 		"difficulty":       crypto.EncodeBig(block.Header.Difficulty),
-		"totalDifficulty":  crypto.EncodeBig(block.Header.Difficulty), // Simplified
 		"extraData":        crypto.Encode(block.Header.ExtraData),
 		"size":             crypto.EncodeUint64(1000), // Estimated
 		"gasLimit":         crypto.EncodeUint64(block.Header.GasLimit),
 		"gasUsed":          crypto.EncodeUint64(block.Header.GasUsed),
 		"timestamp":        crypto.EncodeUint64(block.Header.Timestamp),
 		"transactions":     s.formatTransactions(block.Transactions, &block.Hash),
-		"uncles":           []string{},
+		"uncles":           uncleHashes(block.Uncles),
+	}
+
+	if td := s.blockchain.GetTotalDifficulty(block.Hash); td != nil {
+		result["totalDifficulty"] = crypto.EncodeBig(td)
+	}
+	if block.Header.BaseFee != nil {
+		result["baseFeePerGas"] = crypto.EncodeBig(block.Header.BaseFee)
 	}
+
+	return result
+}
+
+func uncleHashes(uncles []*core.BlockHeader) []string {
+	hashes := make([]string, len(uncles))
+	for i, uncle := range uncles {
+		hashes[i] = uncle.Hash().Hex()
+	}
+	return hashes
 }
 
 func (s *Server) formatTransactions(txs []*core.Transaction, blockHash *crypto.Hash) []interface{} {
@@ -543,6 +1234,17 @@ func (s *Server) formatTransaction(tx *core.Transaction, blockHash *crypto.Hash,
 		result["to"] = tx.To.Hex()
 	}
 
+	result["type"] = crypto.EncodeUint64(uint64(tx.Type))
+	if tx.Type != core.LegacyTxType {
+		result["chainId"] = crypto.EncodeBig(tx.ChainID)
+		result["accessList"] = formatAccessList(tx.AccessList)
+		result["yParity"] = crypto.EncodeBig(tx.V)
+	}
+	if tx.Type == core.DynamicFeeTxType {
+		result["maxFeePerGas"] = crypto.EncodeBig(tx.FeeCap())
+		result["maxPriorityFeePerGas"] = crypto.EncodeBig(tx.TipCap())
+	}
+
 	if blockHash != nil {
 		result["blockHash"] = blockHash.Hex()
 		result["transactionIndex"] = crypto.EncodeUint64(index)
@@ -551,3 +1253,136 @@ func (s *Server) formatTransaction(tx *core.Transaction, blockHash *crypto.Hash,
 
 	return result
 }
+
+func formatReceipt(receipt *core.TransactionReceipt) map[string]interface{} {
+	result := map[string]interface{}{
+		"transactionHash":   receipt.TransactionHash.Hex(),
+		"transactionIndex":  crypto.EncodeUint64(receipt.TransactionIndex),
+		"blockHash":         receipt.BlockHash.Hex(),
+		"blockNumber":       crypto.EncodeBig(receipt.BlockNumber),
+		"from":              receipt.From.Hex(),
+		"to":                nil,
+		"gasUsed":           crypto.EncodeUint64(receipt.GasUsed),
+		"cumulativeGasUsed": crypto.EncodeUint64(receipt.CumulativeGasUsed),
+		"contractAddress":   nil,
+		"logs":              formatLogs(receipt.Logs),
+		"status":            crypto.EncodeUint64(receipt.Status),
+	}
+	if receipt.To != nil {
+		result["to"] = receipt.To.Hex()
+	}
+	if receipt.ContractAddress != nil {
+		result["contractAddress"] = receipt.ContractAddress.Hex()
+	}
+	return result
+}
+
+func formatLogs(logs []*core.Log) []interface{} {
+	result := make([]interface{}, len(logs))
+	for i, log := range logs {
+		topics := make([]string, len(log.Topics))
+		for j, topic := range log.Topics {
+			topics[j] = topic.Hex()
+		}
+		result[i] = map[string]interface{}{
+			"address":          log.Address.Hex(),
+			"topics":           topics,
+			"data":             crypto.Encode(log.Data),
+			"blockNumber":      crypto.EncodeUint64(log.BlockNumber),
+			"transactionHash":  log.TxHash.Hex(),
+			"transactionIndex": crypto.EncodeUint64(uint64(log.TxIndex)),
+			"blockHash":        log.BlockHash.Hex(),
+			"logIndex":         crypto.EncodeUint64(uint64(log.Index)),
+			"removed":          log.Removed,
+		}
+	}
+	return result
+}
+
+func formatAccessList(al core.AccessList) []interface{} {
+	result := make([]interface{}, len(al))
+	for i, tuple := range al {
+		keys := make([]string, len(tuple.StorageKeys))
+		for j, key := range tuple.StorageKeys {
+			keys[j] = key.Hex()
+		}
+		result[i] = map[string]interface{}{
+			"address":     tuple.Address.Hex(),
+			"storageKeys": keys,
+		}
+	}
+	return result
+}
+
+// parseStateOverride parses a state override set: a map from address to the
+// balance, nonce, code and storage ("state" or "stateDiff") to use instead
+// of the current ones
+func parseStateOverride(param interface{}) (core.StateOverride, error) {
+	accounts, ok := param.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid state override set")
+	}
+
+	overrides := make(core.StateOverride, len(accounts))
+	for addressStr, value := range accounts {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid state override for %s", addressStr)
+		}
+
+		var account core.OverrideAccount
+		if balance, ok := fields["balance"].(string); ok {
+			amount, err := crypto.DecodeBig(balance)
+			if err != nil {
+				return nil, fmt.Errorf("invalid balance override for %s: %v", addressStr, err)
+			}
+			account.Balance = amount
+		}
+		if nonce, ok := fields["nonce"].(string); ok {
+			n, err := crypto.DecodeUint64(nonce)
+			if err != nil {
+				return nil, fmt.Errorf("invalid nonce override for %s: %v", addressStr, err)
+			}
+			account.Nonce = &n
+		}
+		if code, ok := fields["code"].(string); ok {
+			c, err := crypto.Decode(code)
+			if err != nil {
+				return nil, fmt.Errorf("invalid code override for %s: %v", addressStr, err)
+			}
+			account.Code = &c
+		}
+		var err error
+		if account.State, err = parseStorageOverride(fields["state"]); err != nil {
+			return nil, fmt.Errorf("invalid state override for %s: %v", addressStr, err)
+		}
+		if account.StateDiff, err = parseStorageOverride(fields["stateDiff"]); err != nil {
+			return nil, fmt.Errorf("invalid stateDiff override for %s: %v", addressStr, err)
+		}
+
+		overrides[crypto.HexToAddress(addressStr)] = account
+	}
+	return overrides, nil
+}
+
+// parseStorageOverride parses a map of storage slots to values, nil if the
+// field is absent
+func parseStorageOverride(param interface{}) (map[crypto.Hash]crypto.Hash, error) {
+	if param == nil {
+		return nil, nil
+	}
+	slots, ok := param.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an object of storage slots")
+	}
+
+	storage := make(map[crypto.Hash]crypto.Hash, len(slots))
+	for key, value := range slots {
+		valueStr, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid value of slot %s", key)
+		}
+		storage[crypto.HexToHash(key)] = crypto.HexToHash(valueStr)
+	}
+	return storage, nil
+}
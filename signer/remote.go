@@ -0,0 +1,146 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"blockchain-node/crypto"
+)
+
+// DefaultTimeout bounds a signing request, a block that is not signed in
+// time misses its slot anyway
+const DefaultTimeout = 5 * time.Second
+
+// maxResponseSize limits the size of a signer response
+const maxResponseSize = 64 * 1024
+
+// ErrWrongSigner is returned when a signature does not recover to the
+// address the signer was configured with
+var ErrWrongSigner = errors.New("signature from wrong account")
+
+// Remote signs hashes with a key held by an external signing service, so
+// that validator keys can stay on a hardened host. The service is reached
+// over HTTP(S) or a Unix domain socket and speaks JSON-RPC 2.0:
+//
+//	{"method": "account_signHash", "params": ["<address>", "<32-byte hash>"]}
+//
+// must return the 65-byte [R || S || V] signature of the hash, hex encoded,
+// with V being 0 or 1.
+type Remote struct {
+	endpoint string
+	url      string
+	address  crypto.Address
+	client   *http.Client
+	id       uint64
+}
+
+// NewRemote creates a client for the signing service at endpoint, an
+// http:// or https:// URL or the path of a Unix domain socket, signing as
+// address
+func NewRemote(endpoint string, address crypto.Address, timeout time.Duration) *Remote {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	r := &Remote{
+		endpoint: endpoint,
+		url:      endpoint,
+		address:  address,
+		client:   &http.Client{Timeout: timeout},
+	}
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		// IPC: HTTP over the socket, the host of the URL is ignored
+		r.url = "http://signer/"
+		r.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", endpoint)
+			},
+		}
+	}
+	return r
+}
+
+// Address returns the account the signer signs as
+func (r *Remote) Address() crypto.Address {
+	return r.address
+}
+
+// SignHash asks the signing service to sign hash and checks that the
+// signature belongs to the configured account
+func (r *Remote) SignHash(hash crypto.Hash) ([]byte, error) {
+	var result string
+	if err := r.call("account_signHash", []interface{}{r.address.Hex(), hash.Hex()}, &result); err != nil {
+		return nil, err
+	}
+
+	signature, err := crypto.Decode(result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature from %s: %v", r.endpoint, err)
+	}
+	if len(signature) != 65 {
+		return nil, fmt.Errorf("invalid signature from %s: %d bytes", r.endpoint, len(signature))
+	}
+	signer, err := crypto.RecoverAddressFunc(hash, signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature from %s: %v", r.endpoint, err)
+	}
+	if signer != r.address {
+		return nil, fmt.Errorf("%w: have %s, want %s", ErrWrongSigner, signer.Hex(), r.address.Hex())
+	}
+	return signature, nil
+}
+
+// call performs a JSON-RPC request and decodes its result
+func (r *Remote) call(method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      atomic.AddUint64(&r.id, 1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.client.Post(r.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("signer %s unreachable: %v", r.endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read signer response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("signer %s returned status %d", r.endpoint, resp.StatusCode)
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return fmt.Errorf("invalid signer response: %v", err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("signer %s refused %s: %s (%d)", r.endpoint, method, response.Error.Message, response.Error.Code)
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("invalid signer result: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrBackupExists is returned when the backup directory is not empty
+var ErrBackupExists = errors.New("backup directory not empty")
+
+// backupBatchSize is the number of entries written to a backup per batch
+const backupBatchSize = 1000
+
+// backupOptions are the settings of the database a backup is written to,
+// which is only written once
+var backupOptions = &Options{CacheSize: 16, MaxOpenFiles: 256, WriteBuffer: 16}
+
+// CheckBackupDir returns an error if a backup cannot be written to dir
+func CheckBackupDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read backup directory: %v", err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%w: %s", ErrBackupExists, dir)
+	}
+	return nil
+}
+
+// Backup copies every entry of snap to a new database with the given
+// backend in dir and returns the number of entries copied. The memory
+// backend is backed up to LevelDB. The copy stops when ctx is cancelled.
+func Backup(ctx context.Context, snap Snapshot, backend, dir string) (int, error) {
+	if err := CheckBackupDir(dir); err != nil {
+		return 0, err
+	}
+	if backend == BackendMemory {
+		backend = BackendLevelDB
+	}
+	dst, err := Open(backend, dir, backupOptions)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := copyEntries(ctx, dst, snap.NewIterator(nil, nil))
+	if closeErr := dst.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return count, fmt.Errorf("backup to %s failed: %v", dir, err)
+	}
+	return count, nil
+}
+
+// copyEntries writes the entries of it to dst in batches and releases it
+func copyEntries(ctx context.Context, dst Database, it Iterator) (int, error) {
+	defer it.Release()
+
+	count := 0
+	batch := dst.NewBatch()
+	for it.Next() {
+		if err := batch.Put(it.Key(), it.Value()); err != nil {
+			return count, err
+		}
+		count++
+		if batch.Size() >= backupBatchSize {
+			if err := ctx.Err(); err != nil {
+				return count, err
+			}
+			if err := batch.Write(); err != nil {
+				return count, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return count, err
+	}
+	return count, batch.Write()
+}
@@ -0,0 +1,298 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Badger implementation, which keeps large values out of the LSM tree in a
+// value log so that compactions only rewrite keys
+type Badger struct {
+	db *badger.DB
+}
+
+// NewBadger creates a new Badger instance with options
+func NewBadger(path string, options *Options) (*Badger, error) {
+	opts := badger.DefaultOptions(path).
+		WithBlockCacheSize(int64(options.CacheSize) * 1024 * 1024).
+		WithLogger(nil).
+		WithReadOnly(options.ReadOnly)
+	if options.WriteBuffer > 0 {
+		opts = opts.WithMemTableSize(int64(options.WriteBuffer) * 1024 * 1024)
+	}
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open badger at %s: %v", path, err)
+	}
+
+	return &Badger{db: db}, nil
+}
+
+// Get retrieves a value by key
+func (b *Badger) Get(key []byte) ([]byte, error) {
+	var data []byte
+	err := b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		data, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, fmt.Errorf("badger get error: %v", err)
+	}
+	return data, nil
+}
+
+// Put stores a key-value pair
+func (b *Badger) Put(key []byte, value []byte) error {
+	err := b.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, value)
+	})
+	if err != nil {
+		return fmt.Errorf("badger put error: %v", err)
+	}
+	return nil
+}
+
+// Delete removes a key-value pair
+func (b *Badger) Delete(key []byte) error {
+	err := b.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	})
+	if err != nil {
+		return fmt.Errorf("badger delete error: %v", err)
+	}
+	return nil
+}
+
+// Has checks if a key exists
+func (b *Badger) Has(key []byte) (bool, error) {
+	err := b.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(key)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("badger has error: %v", err)
+	}
+	return true, nil
+}
+
+// Close closes the database
+func (b *Badger) Close() error {
+	if err := b.db.Close(); err != nil {
+		return fmt.Errorf("badger close error: %v", err)
+	}
+	return nil
+}
+
+// Compact merges the LSM tree into one level and rewrites the value log
+// files that are mostly garbage
+func (b *Badger) Compact() error {
+	if err := b.db.Flatten(runtime.NumCPU()); err != nil {
+		return fmt.Errorf("badger compaction error: %v", err)
+	}
+	// Each call rewrites at most one file, ErrNoRewrite ends the cleanup
+	for b.db.RunValueLogGC(0.5) == nil {
+	}
+	return nil
+}
+
+// NewBatch creates a new batch
+func (b *Badger) NewBatch() Batch {
+	return &BadgerBatch{db: b.db}
+}
+
+// NewIterator returns an iterator over the keys starting with prefix, from
+// prefix+start on
+func (b *Badger) NewIterator(prefix []byte, start []byte) Iterator {
+	it := newBadgerIterator(b.db.NewTransaction(false), prefix, start)
+	it.discard = true
+	return it
+}
+
+// NewSnapshot returns a read-only view of the current database contents
+func (b *Badger) NewSnapshot() (Snapshot, error) {
+	return &badgerSnapshot{txn: b.db.NewTransaction(false)}, nil
+}
+
+// Stats returns database statistics
+func (b *Badger) Stats() map[string]string {
+	lsm, vlog := b.db.Size()
+	return map[string]string{
+		"general":   b.db.LevelsToString(),
+		"lsm_size":  fmt.Sprintf("%d", lsm),
+		"vlog_size": fmt.Sprintf("%d", vlog),
+	}
+}
+
+// BadgerBatch implements batch operations for Badger. Operations are
+// buffered, Badger write batches cannot be reused once flushed.
+type BadgerBatch struct {
+	db    *badger.DB
+	ops   []badgerOp
+	bytes int
+}
+
+// badgerOp is a buffered batch operation
+type badgerOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// Put adds a key-value pair to the batch
+func (b *BadgerBatch) Put(key []byte, value []byte) error {
+	b.ops = append(b.ops, badgerOp{
+		key:   append([]byte(nil), key...),
+		value: append([]byte(nil), value...),
+	})
+	b.bytes += len(key) + len(value)
+	return nil
+}
+
+// Delete adds a delete operation to the batch
+func (b *BadgerBatch) Delete(key []byte) error {
+	b.ops = append(b.ops, badgerOp{key: append([]byte(nil), key...), delete: true})
+	b.bytes += len(key)
+	return nil
+}
+
+// Write commits the batch
+func (b *BadgerBatch) Write() error {
+	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, op := range b.ops {
+		var err error
+		if op.delete {
+			err = wb.Delete(op.key)
+		} else {
+			err = wb.Set(op.key, op.value)
+		}
+		if err != nil {
+			return fmt.Errorf("badger batch write error: %v", err)
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return fmt.Errorf("badger batch write error: %v", err)
+	}
+	return nil
+}
+
+// Reset resets the batch
+func (b *BadgerBatch) Reset() {
+	b.ops = b.ops[:0]
+	b.bytes = 0
+}
+
+// Size returns the number of operations in the batch
+func (b *BadgerBatch) Size() int {
+	return len(b.ops)
+}
+
+// ValueSize returns the bytes of the keys and values in the batch
+func (b *BadgerBatch) ValueSize() int {
+	return b.bytes
+}
+
+// badgerSnapshot implements Snapshot for Badger with a read-only
+// transaction, which sees the database as of its start
+type badgerSnapshot struct {
+	txn *badger.Txn
+}
+
+func (s *badgerSnapshot) Get(key []byte) ([]byte, error) {
+	item, err := s.txn.Get(key)
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, fmt.Errorf("badger get error: %v", err)
+	}
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, fmt.Errorf("badger get error: %v", err)
+	}
+	return data, nil
+}
+
+func (s *badgerSnapshot) NewIterator(prefix []byte, start []byte) Iterator {
+	return newBadgerIterator(s.txn, prefix, start)
+}
+
+func (s *badgerSnapshot) Release() {
+	s.txn.Discard()
+}
+
+// badgerIterator walks the keys with a prefix in a read-only transaction
+type badgerIterator struct {
+	txn     *badger.Txn
+	discard bool // the transaction belongs to the iterator
+	iter    *badger.Iterator
+	prefix  []byte
+	start   []byte // first key to seek to
+	value   []byte
+	err     error
+	started bool
+}
+
+func newBadgerIterator(txn *badger.Txn, prefix []byte, start []byte) *badgerIterator {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+
+	return &badgerIterator{
+		txn:    txn,
+		iter:   txn.NewIterator(opts),
+		prefix: prefix,
+		start:  append(append([]byte(nil), prefix...), start...),
+	}
+}
+
+func (it *badgerIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.iter.Seek(it.start)
+	} else {
+		it.iter.Next()
+	}
+	if !it.iter.ValidForPrefix(it.prefix) {
+		return false
+	}
+
+	it.value, it.err = it.iter.Item().ValueCopy(it.value[:0])
+	return it.err == nil
+}
+
+func (it *badgerIterator) Key() []byte {
+	return it.iter.Item().Key()
+}
+
+func (it *badgerIterator) Value() []byte {
+	return it.value
+}
+
+func (it *badgerIterator) Error() error {
+	return it.err
+}
+
+func (it *badgerIterator) Release() {
+	it.iter.Close()
+	if it.discard {
+		it.txn.Discard()
+	}
+}
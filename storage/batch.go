@@ -0,0 +1,46 @@
+package storage
+
+// flushingBatch writes itself out whenever its keys and values reach a
+// size limit
+type flushingBatch struct {
+	Batch
+	limit int
+}
+
+// NewFlushingBatch returns batch writing itself out and starting over each
+// time its keys and values reach limit bytes, so that large writes do not
+// pile up in memory. The writes are no longer atomic: a failure or a crash
+// can leave the parts flushed so far written. A limit of 0 returns batch
+// as it is.
+func NewFlushingBatch(batch Batch, limit int) Batch {
+	if limit <= 0 {
+		return batch
+	}
+	return &flushingBatch{Batch: batch, limit: limit}
+}
+
+func (b *flushingBatch) Put(key []byte, value []byte) error {
+	if err := b.Batch.Put(key, value); err != nil {
+		return err
+	}
+	return b.flush()
+}
+
+func (b *flushingBatch) Delete(key []byte) error {
+	if err := b.Batch.Delete(key); err != nil {
+		return err
+	}
+	return b.flush()
+}
+
+// flush writes the batch out once it reached the limit
+func (b *flushingBatch) flush() error {
+	if b.ValueSize() < b.limit {
+		return nil
+	}
+	if err := b.Batch.Write(); err != nil {
+		return err
+	}
+	b.Batch.Reset()
+	return nil
+}
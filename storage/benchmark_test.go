@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+const (
+	// benchmarkValueSize is the size of the values written, about that of
+	// a trie node
+	benchmarkValueSize = 128
+
+	// benchmarkBatchSize is the number of writes committed per batch, about
+	// what a block commit writes
+	benchmarkBatchSize = 1000
+)
+
+// benchmarkOptions are the default database settings of the node
+var benchmarkOptions = &Options{CacheSize: 64, MaxOpenFiles: 1000, WriteBuffer: 4}
+
+// BenchmarkWrite measures batched writes of hash-keyed entries
+func BenchmarkWrite(b *testing.B) {
+	for _, backend := range Backends {
+		b.Run(backend, func(b *testing.B) {
+			db := openBenchmarkDB(b, backend)
+			keys, value := benchmarkEntries(b.N)
+
+			b.ResetTimer()
+			if err := writeEntries(db, keys, value); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+// BenchmarkRead measures reads of hash-keyed entries in random order
+func BenchmarkRead(b *testing.B) {
+	for _, backend := range Backends {
+		b.Run(backend, func(b *testing.B) {
+			db := openBenchmarkDB(b, backend)
+			keys, value := benchmarkEntries(b.N)
+			if err := writeEntries(db, keys, value); err != nil {
+				b.Fatal(err)
+			}
+			rand.New(rand.NewSource(2)).Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+
+			b.ResetTimer()
+			for _, key := range keys {
+				if _, err := db.Get(key); err != nil {
+					b.Fatalf("failed to read %x: %v", key, err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkIterate measures iteration over entries in key order
+func BenchmarkIterate(b *testing.B) {
+	for _, backend := range Backends {
+		b.Run(backend, func(b *testing.B) {
+			db := openBenchmarkDB(b, backend)
+			keys, value := benchmarkEntries(b.N)
+			if err := writeEntries(db, keys, value); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			it := db.NewIterator(nil, nil)
+			count := 0
+			for it.Next() {
+				count++
+			}
+			err := it.Error()
+			it.Release()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if count != len(keys) {
+				b.Fatalf("iterated %d entries, want %d", count, len(keys))
+			}
+		})
+	}
+}
+
+// openBenchmarkDB opens an empty database of the backend in a temporary
+// directory, closed when the benchmark ends
+func openBenchmarkDB(b *testing.B, backend string) Database {
+	db, err := Open(backend, b.TempDir(), benchmarkOptions)
+	if err != nil {
+		b.Fatalf("failed to open %s: %v", backend, err)
+	}
+	b.Cleanup(func() { db.Close() })
+	return db
+}
+
+// benchmarkEntries returns n hash-like keys, so that writes and reads hit
+// the database in random order as trie nodes do, and the value to store
+func benchmarkEntries(n int) ([][]byte, []byte) {
+	rng := rand.New(rand.NewSource(1))
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = make([]byte, 32)
+		rng.Read(keys[i])
+		binary.BigEndian.PutUint64(keys[i][24:], uint64(i))
+	}
+	value := make([]byte, benchmarkValueSize)
+	rng.Read(value)
+	return keys, value
+}
+
+// writeEntries writes value under every key in batches
+func writeEntries(db Database, keys [][]byte, value []byte) error {
+	batch := db.NewBatch()
+	for _, key := range keys {
+		if err := batch.Put(key, value); err != nil {
+			return err
+		}
+		if batch.Size() >= benchmarkBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	return batch.Write()
+}
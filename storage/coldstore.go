@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColdStore keeps the completed data files of a freezer away from the local
+// disk, on a network path or in an object store. Stored files never change.
+type ColdStore interface {
+	// Put stores size bytes from r under name
+	Put(name string, r io.Reader, size int64) error
+
+	// ReadAt fills p from offset off of the file stored under name
+	ReadAt(name string, p []byte, off int64) error
+
+	// Size returns the size of the file stored under name, ErrKeyNotFound
+	// if there is none
+	Size(name string) (int64, error)
+}
+
+// DirColdStore is a cold store in a directory, usually a network mount
+type DirColdStore struct {
+	dir string
+}
+
+// NewDirColdStore returns the cold store in dir, creating it if needed
+func NewDirColdStore(dir string) (*DirColdStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cold store directory: %v", err)
+	}
+	return &DirColdStore{dir: dir}, nil
+}
+
+// Put writes the file to a temporary name first, so that an interrupted
+// copy is never taken for a complete one
+func (s *DirColdStore) Put(name string, r io.Reader, size int64) error {
+	tmp, err := os.CreateTemp(s.dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.CopyN(tmp, r, size); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+// ReadAt reads from the stored file
+func (s *DirColdStore) ReadAt(name string, p []byte, off int64) error {
+	file, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.ReadAt(p, off)
+	return err
+}
+
+// Size returns the size of the stored file
+func (s *DirColdStore) Size(name string) (int64, error) {
+	info, err := os.Stat(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return 0, ErrKeyNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// S3ColdStore is a cold store in a bucket of an S3-compatible object store,
+// addressed path-style so that it works with AWS as well as MinIO, Ceph and
+// other implementations. Requests are signed with AWS Signature Version 4.
+type S3ColdStore struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	prefix    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// NewS3ColdStore returns the cold store under prefix in bucket of the
+// object store at endpoint, an URL like https://s3.us-east-1.amazonaws.com
+func NewS3ColdStore(endpoint, region, bucket, prefix, accessKey, secretKey string) (*S3ColdStore, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid object store endpoint %q", endpoint)
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("object store bucket not set")
+	}
+	return &S3ColdStore{
+		endpoint:  u,
+		region:    region,
+		bucket:    bucket,
+		prefix:    strings.Trim(prefix, "/"),
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+// Put uploads the file in one request
+func (s *S3ColdStore) Put(name string, r io.Reader, size int64) error {
+	req, err := s.request(http.MethodPut, name, io.LimitReader(r, size))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	_, err = s.do(req, http.StatusOK)
+	return err
+}
+
+// ReadAt downloads the requested range of the file
+func (s *S3ColdStore) ReadAt(name string, p []byte, off int64) error {
+	if len(p) == 0 {
+		return nil
+	}
+	req, err := s.request(http.MethodGet, name, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+	resp, err := s.do(req, http.StatusPartialContent)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.ReadFull(resp.Body, p)
+	return err
+}
+
+// Size returns the size of the stored file
+func (s *S3ColdStore) Size(name string) (int64, error) {
+	req, err := s.request(http.MethodHead, name, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.do(req, http.StatusOK)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+}
+
+// request returns a request for the object of a file
+func (s *S3ColdStore) request(method, name string, body io.Reader) (*http.Request, error) {
+	u := *s.endpoint
+	u.Path = path.Join("/", u.Path, s.bucket, s.prefix, name)
+	return http.NewRequest(method, u.String(), body)
+}
+
+// do signs and sends req, failing unless the response has status want. A
+// missing object is ErrKeyNotFound.
+func (s *S3ColdStore) do(req *http.Request, want int) (*http.Response, error) {
+	s.sign(req, time.Now().UTC())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == want {
+		return resp, nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrKeyNotFound
+	}
+	return nil, fmt.Errorf("object store %s %s: %s", req.Method, req.URL.Path, resp.Status)
+}
+
+// sign adds an AWS Signature Version 4 to req. The payload is not hashed,
+// the transport protects it.
+func (s *S3ColdStore) sign(req *http.Request, now time.Time) {
+	const payload = "UNSIGNED-PAYLOAD"
+	date := now.Format("20060102")
+	stamp := now.Format("20060102T150405Z")
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		signed,
+		payload,
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signed, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,23 @@
+package storage
+
+import "fmt"
+
+// ErrCompactionUnsupported is returned by Compact for backends without
+// compaction
+var ErrCompactionUnsupported = fmt.Errorf("compaction not supported")
+
+// compacter is implemented by backends that can compact their files
+type compacter interface {
+	Compact() error
+}
+
+// Compact compacts the whole key space of db, reclaiming the space of
+// deleted and overwritten entries. It may take long on large databases and
+// competes with other writes, run it on a stopped node.
+func Compact(db Database) error {
+	backend, ok := unwrap(db).(compacter)
+	if !ok {
+		return fmt.Errorf("%w by %T", ErrCompactionUnsupported, unwrap(db))
+	}
+	return backend.Compact()
+}
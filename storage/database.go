@@ -4,8 +4,12 @@ package storage
 import (
 	"fmt"
 
+	"blockchain-node/logger"
+
 	"github.com/syndtr/goleveldb/leveldb"
+	lerrors "github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 // Database interface for blockchain storage
@@ -16,9 +20,19 @@ type Database interface {
 	Has(key []byte) (bool, error)
 	Close() error
 	NewBatch() Batch
+	NewIterator(prefix []byte, start []byte) Iterator
+	NewSnapshot() (Snapshot, error)
 	Stats() map[string]string
 }
 
+// Snapshot is a read-only view of a database at the time it was taken,
+// later writes are not seen. It must be released after use.
+type Snapshot interface {
+	Get(key []byte) ([]byte, error)
+	NewIterator(prefix []byte, start []byte) Iterator
+	Release()
+}
+
 // Batch interface for batch operations
 type Batch interface {
 	Put(key []byte, value []byte) error
@@ -26,13 +40,72 @@ type Batch interface {
 	Write() error
 	Reset()
 	Size() int
+	ValueSize() int // bytes of the keys and values in the batch
 }
 
-// LevelDBOptions holds configuration for LevelDB
-type LevelDBOptions struct {
+// Iterator walks over the key-value pairs of a database in key order.
+// NewIterator returns the keys starting with prefix, beginning at the first
+// key not below prefix+start, so that a scan can resume after the last key
+// it saw. The slices returned by Key and Value are only valid until the
+// next call to Next, and the iterator must be released after use.
+type Iterator interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Error() error
+	Release()
+}
+
+// Database backends
+const (
+	BackendLevelDB = "leveldb"
+	BackendPebble  = "pebble"
+	BackendBadger  = "badger"
+	BackendMemory  = "memory"
+)
+
+// Backends lists the persistent database backends Open supports
+var Backends = []string{BackendLevelDB, BackendPebble, BackendBadger}
+
+// Options holds the tuning settings of a database backend
+type Options struct {
 	CacheSize    int // Cache size in MB
-	MaxOpenFiles int // Maximum number of open files
+	MaxOpenFiles int // Maximum number of open files, ignored by Badger
 	WriteBuffer  int // Write buffer size in MB
+
+	// ReadOnly opens an existing database without writing to its files,
+	// not even to recover from a crash, so that the data directory of a
+	// stopped or crashed node can be inspected as it is. Several read-only
+	// processes may share it. Writes fail with ErrReadOnly.
+	ReadOnly bool
+}
+
+// Open opens the database at path with the given backend, LevelDB if
+// backend is empty. The memory backend ignores path and options.
+func Open(backend, path string, options *Options) (Database, error) {
+	db, err := open(backend, path, options)
+	if err != nil {
+		return nil, err
+	}
+	if options.ReadOnly {
+		return readOnlyDB{db}, nil
+	}
+	return db, nil
+}
+
+func open(backend, path string, options *Options) (Database, error) {
+	switch backend {
+	case BackendLevelDB, "":
+		return NewLevelDB(path, options)
+	case BackendPebble:
+		return NewPebble(path, options)
+	case BackendBadger:
+		return NewBadger(path, options)
+	case BackendMemory:
+		return NewMemoryDB(), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, backend)
+	}
 }
 
 // LevelDB implementation
@@ -41,17 +114,31 @@ type LevelDB struct {
 }
 
 // NewLevelDB creates a new LevelDB instance with options
-func NewLevelDB(path string, options *LevelDBOptions) (*LevelDB, error) {
+func NewLevelDB(path string, options *Options) (*LevelDB, error) {
 	opts := &opt.Options{
 		BlockCacheCapacity:     options.CacheSize * 1024 * 1024,  // Convert MB to bytes
 		OpenFilesCacheCapacity: options.MaxOpenFiles,
 		WriteBuffer:           options.WriteBuffer * 1024 * 1024, // Convert MB to bytes
 		CompactionTableSize:   4 * 1024 * 1024, // 4MB
 		CompactionTotalSize:   16 * 1024 * 1024, // 16MB
+		ReadOnly:              options.ReadOnly,
+		ErrorIfMissing:        options.ReadOnly,
 	}
 
 	db, err := leveldb.OpenFile(path, opts)
+	if err != nil && lerrors.IsCorrupted(err) && !options.ReadOnly {
+		// Recovery rebuilds the manifest from the table files, entries in
+		// damaged blocks are dropped
+		logger.Warning("LevelDB is corrupted, attempting recovery", "path", path, "error", err)
+		db, err = leveldb.RecoverFile(path, opts)
+		if err == nil {
+			logger.Warning("LevelDB recovered, some recent entries may be lost", "path", path)
+		}
+	}
 	if err != nil {
+		if lerrors.IsCorrupted(err) {
+			return nil, fmt.Errorf("%w: leveldb at %s: %v", ErrCorrupted, path, err)
+		}
 		return nil, fmt.Errorf("failed to open leveldb at %s: %v", path, err)
 	}
 
@@ -111,6 +198,21 @@ func (ldb *LevelDB) NewBatch() Batch {
 	}
 }
 
+// NewIterator returns an iterator over the keys starting with prefix, from
+// prefix+start on
+func (ldb *LevelDB) NewIterator(prefix []byte, start []byte) Iterator {
+	return ldb.db.NewIterator(levelRange(prefix, start), nil)
+}
+
+// NewSnapshot returns a read-only view of the current database contents
+func (ldb *LevelDB) NewSnapshot() (Snapshot, error) {
+	snap, err := ldb.db.GetSnapshot()
+	if err != nil {
+		return nil, fmt.Errorf("leveldb snapshot error: %v", err)
+	}
+	return &levelSnapshot{snap: snap}, nil
+}
+
 // Stats returns database statistics
 func (ldb *LevelDB) Stats() map[string]string {
 	stats := make(map[string]string)
@@ -130,17 +232,56 @@ func (ldb *LevelDB) Stats() map[string]string {
 	return stats
 }
 
+// Compact compacts every level of the database
+func (ldb *LevelDB) Compact() error {
+	if err := ldb.db.CompactRange(util.Range{}); err != nil {
+		return fmt.Errorf("leveldb compaction error: %v", err)
+	}
+	return nil
+}
+
+// CompactionStats returns the compaction and size statistics of the
+// database
+func (ldb *LevelDB) CompactionStats() (*CompactionStats, error) {
+	var s leveldb.DBStats
+	if err := ldb.db.Stats(&s); err != nil {
+		return nil, fmt.Errorf("leveldb stats error: %v", err)
+	}
+
+	stats := &CompactionStats{
+		LevelSizes:     s.LevelSizes,
+		LevelTables:    s.LevelTablesCounts,
+		Compactions:    uint64(s.MemComp) + uint64(s.Level0Comp) + uint64(s.NonLevel0Comp) + uint64(s.SeekComp),
+		WriteDelays:    uint64(s.WriteDelayCount),
+		WriteDelayTime: s.WriteDelayDuration,
+		WritePaused:    s.WritePaused,
+		DiskRead:       s.IORead,
+		DiskWrite:      s.IOWrite,
+	}
+	for _, size := range s.LevelSizes {
+		stats.Size += size
+	}
+	for i := range s.LevelDurations {
+		stats.CompactionTime += s.LevelDurations[i]
+		stats.CompactionRead += s.LevelRead[i]
+		stats.CompactionWrite += s.LevelWrite[i]
+	}
+	return stats, nil
+}
+
 // LevelDBBatch implements batch operations for LevelDB
 type LevelDBBatch struct {
 	batch *leveldb.Batch
 	db    *leveldb.DB
 	size  int
+	bytes int
 }
 
 // Put adds a key-value pair to the batch
 func (b *LevelDBBatch) Put(key []byte, value []byte) error {
 	b.batch.Put(key, value)
 	b.size++
+	b.bytes += len(key) + len(value)
 	return nil
 }
 
@@ -148,6 +289,7 @@ func (b *LevelDBBatch) Put(key []byte, value []byte) error {
 func (b *LevelDBBatch) Delete(key []byte) error {
 	b.batch.Delete(key)
 	b.size++
+	b.bytes += len(key)
 	return nil
 }
 
@@ -163,6 +305,7 @@ func (b *LevelDBBatch) Write() error {
 func (b *LevelDBBatch) Reset() {
 	b.batch.Reset()
 	b.size = 0
+	b.bytes = 0
 }
 
 // Size returns the number of operations in the batch
@@ -170,7 +313,51 @@ func (b *LevelDBBatch) Size() int {
 	return b.size
 }
 
+// ValueSize returns the bytes of the keys and values in the batch
+func (b *LevelDBBatch) ValueSize() int {
+	return b.bytes
+}
+
+// levelSnapshot implements Snapshot for LevelDB
+type levelSnapshot struct {
+	snap *leveldb.Snapshot
+}
+
+func (s *levelSnapshot) Get(key []byte) ([]byte, error) {
+	data, err := s.snap.Get(key, nil)
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return nil, ErrKeyNotFound
+		}
+		return nil, fmt.Errorf("leveldb get error: %v", err)
+	}
+	return data, nil
+}
+
+func (s *levelSnapshot) NewIterator(prefix []byte, start []byte) Iterator {
+	return s.snap.NewIterator(levelRange(prefix, start), nil)
+}
+
+func (s *levelSnapshot) Release() {
+	s.snap.Release()
+}
+
+// levelRange returns the range of the keys starting with prefix, from
+// prefix+start on
+func levelRange(prefix []byte, start []byte) *util.Range {
+	r := util.BytesPrefix(prefix)
+	r.Start = append(r.Start, start...)
+	return r
+}
+
 // Custom errors
 var (
-	ErrKeyNotFound = fmt.Errorf("key not found")
+	ErrKeyNotFound    = fmt.Errorf("key not found")
+	ErrUnknownBackend = fmt.Errorf("unknown database backend")
+	ErrDatabaseClosed = fmt.Errorf("database closed")
+	ErrReadOnly       = fmt.Errorf("database opened read-only")
+
+	// ErrCorrupted is returned when the database files or the chain data
+	// in them are damaged beyond automatic repair
+	ErrCorrupted = fmt.Errorf("database corrupted")
 )
@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encryption errors
+var (
+	ErrEncryptionKey = errors.New("wrong database encryption key")
+	ErrEncrypted     = errors.New("database is encrypted")
+	ErrNotEncrypted  = errors.New("database is not encrypted")
+)
+
+// EncryptionKeySize is the size of a raw encryption key, AES-256
+const EncryptionKeySize = 32
+
+// Key derivation of an encrypted database
+const (
+	kdfRaw    = "raw"
+	kdfScrypt = "scrypt"
+)
+
+// scrypt parameters of new databases, stored in their header
+const (
+	scryptN = 1 << 18
+	scryptR = 8
+	scryptP = 1
+)
+
+// encryptionHeaderKey stores the encryption header of a database in plain
+var encryptionHeaderKey = []byte("encryption-header")
+
+// encryptionCheck is sealed into the header to tell a wrong key early
+var encryptionCheck = []byte("lumina encrypted database")
+
+// encryptionHeader describes how the key of a database is derived
+type encryptionHeader struct {
+	KDF   string `json:"kdf"`
+	Salt  []byte `json:"salt,omitempty"`
+	N     int    `json:"n,omitempty"`
+	R     int    `json:"r,omitempty"`
+	P     int    `json:"p,omitempty"`
+	Check []byte `json:"check"`
+}
+
+// EncryptedDB encrypts the values of the database it wraps with AES-GCM,
+// each under a random nonce and bound to its key, so that values can not be
+// read or moved between keys on disk. Keys are stored in plain for ordered
+// iteration. Snapshots see the stored values, backups taken from them stay
+// encrypted and open with the same key. The freezer holds public chain data
+// and is not encrypted.
+type EncryptedDB struct {
+	Database
+	aead cipher.AEAD
+}
+
+// NewEncryptedDB returns db with its values encrypted under key, which is
+// EncryptionKeySize bytes. An empty db is set up for encryption, one with
+// unencrypted data fails with ErrNotEncrypted and one encrypted under
+// another key with ErrEncryptionKey.
+func NewEncryptedDB(db Database, key []byte) (*EncryptedDB, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("invalid encryption key length %d, want %d", len(key), EncryptionKeySize)
+	}
+	return openEncrypted(db, &encryptionHeader{KDF: kdfRaw}, func(*encryptionHeader) ([]byte, error) {
+		return key, nil
+	})
+}
+
+// NewPassphraseEncryptedDB is like NewEncryptedDB with the key derived from
+// passphrase with scrypt
+func NewPassphraseEncryptedDB(db Database, passphrase string) (*EncryptedDB, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	header := &encryptionHeader{KDF: kdfScrypt, Salt: salt, N: scryptN, R: scryptR, P: scryptP}
+	return openEncrypted(db, header, func(h *encryptionHeader) ([]byte, error) {
+		return scrypt.Key([]byte(passphrase), h.Salt, h.N, h.R, h.P, EncryptionKeySize)
+	})
+}
+
+// IsEncrypted reports whether db holds encrypted data
+func IsEncrypted(db Database) (bool, error) {
+	return db.Has(encryptionHeaderKey)
+}
+
+// openEncrypted derives the key of db from its header, or from fresh if db
+// is empty, and checks it
+func openEncrypted(db Database, fresh *encryptionHeader, derive func(*encryptionHeader) ([]byte, error)) (*EncryptedDB, error) {
+	header, err := readEncryptionHeader(db)
+	if err != nil {
+		return nil, err
+	}
+	create := header == nil
+	if create {
+		header = fresh
+	} else if header.KDF != fresh.KDF {
+		return nil, fmt.Errorf("%w: database key is derived with %s, not %s", ErrEncryptionKey, header.KDF, fresh.KDF)
+	}
+
+	key, err := derive(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive encryption key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	edb := &EncryptedDB{Database: db, aead: aead}
+
+	if !create {
+		if check, err := edb.open(encryptionHeaderKey, header.Check); err != nil || !bytes.Equal(check, encryptionCheck) {
+			return nil, ErrEncryptionKey
+		}
+		return edb, nil
+	}
+
+	// Unencrypted data can not be told from ciphertext later
+	it := db.NewIterator(nil, nil)
+	hasData := it.Next()
+	it.Release()
+	if hasData {
+		return nil, ErrNotEncrypted
+	}
+	if header.Check, err = edb.seal(encryptionHeaderKey, encryptionCheck); err != nil {
+		return nil, err
+	}
+	enc, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Put(encryptionHeaderKey, enc); err != nil {
+		return nil, fmt.Errorf("failed to write encryption header: %v", err)
+	}
+	return edb, nil
+}
+
+// readEncryptionHeader returns the header of db, nil if it has none
+func readEncryptionHeader(db Database) (*encryptionHeader, error) {
+	enc, err := db.Get(encryptionHeaderKey)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var header encryptionHeader
+	if err := json.Unmarshal(enc, &header); err != nil {
+		return nil, fmt.Errorf("%w: invalid encryption header: %v", ErrCorrupted, err)
+	}
+	return &header, nil
+}
+
+// Get retrieves and decrypts a value by key
+func (db *EncryptedDB) Get(key []byte) ([]byte, error) {
+	data, err := db.Database.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return db.open(key, data)
+}
+
+// Put encrypts and stores a key-value pair
+func (db *EncryptedDB) Put(key []byte, value []byte) error {
+	data, err := db.seal(key, value)
+	if err != nil {
+		return err
+	}
+	return db.Database.Put(key, data)
+}
+
+// NewBatch creates a batch encrypting the values put into it
+func (db *EncryptedDB) NewBatch() Batch {
+	return &encryptedBatch{Batch: db.Database.NewBatch(), db: db}
+}
+
+// NewIterator returns an iterator decrypting the values, see
+// Database.NewIterator
+func (db *EncryptedDB) NewIterator(prefix []byte, start []byte) Iterator {
+	return &encryptedIterator{Iterator: db.Database.NewIterator(prefix, start), db: db}
+}
+
+// seal encrypts value bound to key, the nonce goes first
+func (db *EncryptedDB) seal(key, value []byte) ([]byte, error) {
+	nonce := make([]byte, db.aead.NonceSize(), db.aead.NonceSize()+len(value)+db.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return db.aead.Seal(nonce, nonce, value, key), nil
+}
+
+// open decrypts a value sealed for key
+func (db *EncryptedDB) open(key, data []byte) ([]byte, error) {
+	if len(data) < db.aead.NonceSize() {
+		return nil, fmt.Errorf("%w: encrypted value of %x too short", ErrCorrupted, key)
+	}
+	nonce, ciphertext := data[:db.aead.NonceSize()], data[db.aead.NonceSize():]
+	value, err := db.aead.Open(nil, nonce, ciphertext, key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decrypt value of %x", ErrCorrupted, key)
+	}
+	return value, nil
+}
+
+// encryptedBatch encrypts the values of a batch
+type encryptedBatch struct {
+	Batch
+	db *EncryptedDB
+}
+
+func (b *encryptedBatch) Put(key []byte, value []byte) error {
+	data, err := b.db.seal(key, value)
+	if err != nil {
+		return err
+	}
+	return b.Batch.Put(key, data)
+}
+
+// encryptedIterator decrypts the values of an iterator and skips the
+// encryption header
+type encryptedIterator struct {
+	Iterator
+	db    *EncryptedDB
+	value []byte
+	err   error
+}
+
+func (it *encryptedIterator) Next() bool {
+	for it.err == nil && it.Iterator.Next() {
+		if bytes.Equal(it.Iterator.Key(), encryptionHeaderKey) {
+			continue
+		}
+		it.value, it.err = it.db.open(it.Iterator.Key(), it.Iterator.Value())
+		return it.err == nil
+	}
+	return false
+}
+
+func (it *encryptedIterator) Value() []byte {
+	return it.value
+}
+
+func (it *encryptedIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.Iterator.Error()
+}
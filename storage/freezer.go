@@ -0,0 +1,546 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Freezer tables
+const (
+	FreezerBlocks   = "blocks"
+	FreezerReceipts = "receipts"
+)
+
+// FreezerTables lists the tables of the chain freezer
+var FreezerTables = []string{FreezerBlocks, FreezerReceipts}
+
+// FreezerDir returns the directory of the freezer of the database at path
+func FreezerDir(path string) string {
+	return filepath.Join(path, "ancient")
+}
+
+// freezerIndexSize is the size of an index entry: the data file of an item
+// in the first 2 bytes, its end offset in that file in the other 6
+const freezerIndexSize = 8
+
+// freezerSegmentSize is the size a data file grows to before appends move
+// on to the next one
+const freezerSegmentSize = 1 << 30
+
+// Freezer is an append-only store for chain data that no longer changes.
+// Each table keeps its items in flat data files, numbered in the order
+// they were appended, next to an index file holding the data file and end
+// offset of every item. A read is two file reads and the data never goes
+// through LevelDB compactions again. All tables hold the same number of
+// items.
+//
+// Data files are filled one after the other. Completed ones never change
+// again and can be moved to a cold store, see SetColdStore.
+type Freezer struct {
+	readOnly bool
+	tables   map[string]*freezerTable
+	items    uint64
+	cold     ColdStore // nil unless set
+	mu       sync.RWMutex
+}
+
+// freezerTable is the index and data files of one table
+type freezerTable struct {
+	dir      string
+	name     string
+	flag     int
+	index    *os.File
+	head     *os.File            // data file appended to
+	headFile uint16              // number of the head data file
+	size     int64               // bytes of the head data file in use
+	files    map[uint16]*os.File // completed data files opened so far
+	filesMu  sync.Mutex          // protects files, opened under the read lock
+}
+
+// NewFreezer opens the freezer in dir with the given tables, creating it if
+// needed. Items left half written by a crash are dropped. A read-only
+// freezer leaves the files untouched and needs dir to exist.
+func NewFreezer(dir string, tables []string, readOnly bool) (*Freezer, error) {
+	flag := os.O_RDWR | os.O_CREATE
+	if readOnly {
+		flag = os.O_RDONLY
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create freezer directory: %v", err)
+	}
+
+	f := &Freezer{readOnly: readOnly, tables: make(map[string]*freezerTable)}
+	items := uint64(0)
+	for i, name := range tables {
+		t, count, err := openFreezerTable(dir, name, flag)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		f.tables[name] = t
+		if i == 0 || count < items {
+			items = count
+		}
+	}
+
+	// Appends interrupted between tables leave some tables ahead
+	for name, t := range f.tables {
+		if err := f.truncateTable(t, items); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to repair freezer table %s: %v", name, err)
+		}
+	}
+	f.items = items
+	return f, nil
+}
+
+// openFreezerTable opens the files of a table and returns the number of
+// complete items in it
+func openFreezerTable(dir, name string, flag int) (*freezerTable, uint64, error) {
+	index, err := os.OpenFile(filepath.Join(dir, name+".idx"), flag, 0644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open freezer index %s: %v", name, err)
+	}
+	t := &freezerTable{dir: dir, name: name, flag: flag, index: index, files: make(map[uint16]*os.File)}
+	info, err := index.Stat()
+	if err != nil {
+		t.close()
+		return nil, 0, err
+	}
+
+	// Appends go on in the data file of the last item
+	items := uint64(info.Size() / freezerIndexSize)
+	if items > 0 {
+		if t.headFile, _, err = t.entry(items - 1); err != nil {
+			t.close()
+			return nil, 0, err
+		}
+	}
+	if t.head, err = os.OpenFile(t.path(t.headFile), flag, 0644); err != nil {
+		t.close()
+		return nil, 0, fmt.Errorf("failed to open freezer data %s: %v", name, err)
+	}
+	if info, err = t.head.Stat(); err != nil {
+		t.close()
+		return nil, 0, err
+	}
+
+	// An item is complete once its data is written and indexed
+	for items > 0 {
+		file, end, err := t.entry(items - 1)
+		if err != nil {
+			t.close()
+			return nil, 0, err
+		}
+		if file != t.headFile {
+			break
+		}
+		if end <= info.Size() {
+			t.size = end
+			break
+		}
+		items--
+	}
+	return t, items, nil
+}
+
+// Items returns the number of items in every table
+func (f *Freezer) Items() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.items
+}
+
+// SetColdStore makes the freezer read the data files missing locally from
+// store, see MoveCold
+func (f *Freezer) SetColdStore(store ColdStore) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cold = store
+}
+
+// Retrieve returns item number of a table, ErrKeyNotFound if the freezer
+// holds fewer items
+func (f *Freezer) Retrieve(table string, number uint64) ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	t, ok := f.tables[table]
+	if !ok {
+		return nil, fmt.Errorf("unknown freezer table %s", table)
+	}
+	if number >= f.items {
+		return nil, ErrKeyNotFound
+	}
+	file, start, end, err := t.bounds(number)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, end-start)
+	if err := f.readData(t, file, data, start); err != nil {
+		return nil, fmt.Errorf("failed to read freezer item %d of %s: %v", number, table, err)
+	}
+	return data, nil
+}
+
+// readData reads p from offset off of a data file, from the cold store if
+// it is not on the local disk. The caller must hold f.mu.
+func (f *Freezer) readData(t *freezerTable, file uint16, p []byte, off int64) error {
+	if file == t.headFile {
+		_, err := t.head.ReadAt(p, off)
+		return err
+	}
+	data, err := t.file(file)
+	if errors.Is(err, os.ErrNotExist) && f.cold != nil {
+		return f.cold.ReadAt(t.fileName(file), p, off)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = data.ReadAt(p, off)
+	return err
+}
+
+// Append adds item number to every table, which must be the next one.
+// Tables missing from items get an empty item. The item is durable after
+// Sync.
+func (f *Freezer) Append(number uint64, items map[string][]byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	if number != f.items {
+		return fmt.Errorf("freezer append out of order: item %d, have %d", number, f.items)
+	}
+	for name, t := range f.tables {
+		if err := t.append(number, items[name]); err != nil {
+			// Leave no table ahead of the others
+			for _, t := range f.tables {
+				f.truncateTable(t, f.items)
+			}
+			return fmt.Errorf("failed to append to freezer table %s: %v", name, err)
+		}
+	}
+	f.items++
+	return nil
+}
+
+// Sync flushes the tables to disk
+func (f *Freezer) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for name, t := range f.tables {
+		if err := t.head.Sync(); err != nil {
+			return fmt.Errorf("failed to sync freezer data %s: %v", name, err)
+		}
+		if err := t.index.Sync(); err != nil {
+			return fmt.Errorf("failed to sync freezer index %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// MoveCold copies the completed data files still on the local disk to the
+// cold store and deletes the local copies, returning how many were moved.
+// Appends and reads go on during the copies.
+func (f *Freezer) MoveCold() (int, error) {
+	type dataFile struct {
+		table *freezerTable
+		file  uint16
+	}
+	f.mu.RLock()
+	cold := f.cold
+	var files []dataFile
+	for _, name := range f.tableNames() {
+		t := f.tables[name]
+		for file := uint16(0); file < t.headFile; file++ {
+			if _, err := os.Stat(t.path(file)); err == nil {
+				files = append(files, dataFile{t, file})
+			}
+		}
+	}
+	f.mu.RUnlock()
+	if cold == nil || f.readOnly {
+		return 0, nil
+	}
+
+	for i, data := range files {
+		t, file := data.table, data.file
+		if err := copyToColdStore(cold, t.fileName(file), t.path(file)); err != nil {
+			return i, fmt.Errorf("failed to move freezer data %s to cold store: %v", t.fileName(file), err)
+		}
+
+		f.mu.Lock()
+		t.filesMu.Lock()
+		if opened, ok := t.files[file]; ok {
+			opened.Close()
+			delete(t.files, file)
+		}
+		t.filesMu.Unlock()
+		err := os.Remove(t.path(file))
+		f.mu.Unlock()
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(files), nil
+}
+
+// copyToColdStore copies the file at path to store and checks the copy
+func copyToColdStore(store ColdStore, name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if err := store.Put(name, file, info.Size()); err != nil {
+		return err
+	}
+	size, err := store.Size(name)
+	if err != nil {
+		return err
+	}
+	if size != info.Size() {
+		return fmt.Errorf("cold store holds %d bytes, want %d", size, info.Size())
+	}
+	return nil
+}
+
+// Backup copies the items frozen so far to a new freezer in dir. Data files
+// moved to the cold store are not copied, the backup reads them from the
+// same store. Appends wait until the copy is done.
+func (f *Freezer) Backup(dir string) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create freezer backup directory: %v", err)
+	}
+	for name, t := range f.tables {
+		if err := copyFilePrefix(t.index, filepath.Join(dir, name+".idx"), int64(f.items)*freezerIndexSize); err != nil {
+			return fmt.Errorf("failed to back up freezer index %s: %v", name, err)
+		}
+		for file := uint16(0); file < t.headFile; file++ {
+			data, err := os.Open(t.path(file))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to back up freezer data %s: %v", t.fileName(file), err)
+			}
+			info, err := data.Stat()
+			if err == nil {
+				err = copyFilePrefix(data, filepath.Join(dir, t.fileName(file)), info.Size())
+			}
+			data.Close()
+			if err != nil {
+				return fmt.Errorf("failed to back up freezer data %s: %v", t.fileName(file), err)
+			}
+		}
+		if err := copyFilePrefix(t.head, filepath.Join(dir, t.fileName(t.headFile)), t.size); err != nil {
+			return fmt.Errorf("failed to back up freezer data %s: %v", t.fileName(t.headFile), err)
+		}
+	}
+	return nil
+}
+
+// Close closes the table files
+func (f *Freezer) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var firstErr error
+	for _, t := range f.tables {
+		if err := t.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// tableNames returns the names of the tables in order
+func (f *Freezer) tableNames() []string {
+	names := make([]string, 0, len(f.tables))
+	for name := range f.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// truncateTable drops the items of a table from number items on. Appends
+// go on in the head data file, even if the items left end in an earlier
+// one. A read-only freezer only stops using them.
+func (f *Freezer) truncateTable(t *freezerTable, items uint64) error {
+	size := int64(0)
+	if items > 0 {
+		file, end, err := t.entry(items - 1)
+		if err != nil {
+			return err
+		}
+		if file == t.headFile {
+			size = end
+		}
+	}
+	t.size = size
+	if f.readOnly {
+		return nil
+	}
+	if err := t.index.Truncate(int64(items) * freezerIndexSize); err != nil {
+		return err
+	}
+	return t.head.Truncate(size)
+}
+
+// path returns the path of a data file
+func (t *freezerTable) path(file uint16) string {
+	return filepath.Join(t.dir, t.fileName(file))
+}
+
+// fileName returns the name of a data file. The first one has no number,
+// it predates data files being split.
+func (t *freezerTable) fileName(file uint16) string {
+	if file == 0 {
+		return t.name + ".dat"
+	}
+	return fmt.Sprintf("%s.%04d.dat", t.name, file)
+}
+
+// file returns a completed data file on the local disk, opening it once
+func (t *freezerTable) file(file uint16) (*os.File, error) {
+	t.filesMu.Lock()
+	defer t.filesMu.Unlock()
+
+	if data, ok := t.files[file]; ok {
+		return data, nil
+	}
+	data, err := os.Open(t.path(file))
+	if err != nil {
+		return nil, err
+	}
+	t.files[file] = data
+	return data, nil
+}
+
+// entry returns the data file and end offset of an item
+func (t *freezerTable) entry(number uint64) (uint16, int64, error) {
+	var enc [freezerIndexSize]byte
+	if _, err := t.index.ReadAt(enc[:], int64(number)*freezerIndexSize); err != nil {
+		return 0, 0, fmt.Errorf("failed to read freezer index entry %d: %v", number, err)
+	}
+	file := binary.BigEndian.Uint16(enc[:2])
+	enc[0], enc[1] = 0, 0
+	return file, int64(binary.BigEndian.Uint64(enc[:])), nil
+}
+
+// bounds returns the data file and the start and end offset of an item
+func (t *freezerTable) bounds(number uint64) (uint16, int64, int64, error) {
+	file, end, err := t.entry(number)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	start := int64(0)
+	if number > 0 {
+		prevFile, prevEnd, err := t.entry(number - 1)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if prevFile == file {
+			start = prevEnd
+		}
+	}
+	if end < start {
+		return 0, 0, 0, errors.New("corrupted freezer index")
+	}
+	return file, start, end, nil
+}
+
+// append writes the data of an item, then its index entry. A full head
+// data file is completed and the next one started first.
+func (t *freezerTable) append(number uint64, item []byte) error {
+	if t.size > 0 && t.size+int64(len(item)) > freezerSegmentSize {
+		if err := t.nextFile(); err != nil {
+			return err
+		}
+	}
+	if _, err := t.head.WriteAt(item, t.size); err != nil {
+		return err
+	}
+	var enc [freezerIndexSize]byte
+	binary.BigEndian.PutUint64(enc[:], uint64(t.size)+uint64(len(item)))
+	binary.BigEndian.PutUint16(enc[:2], t.headFile)
+	if _, err := t.index.WriteAt(enc[:], int64(number)*freezerIndexSize); err != nil {
+		return err
+	}
+	t.size += int64(len(item))
+	return nil
+}
+
+// nextFile completes the head data file and starts the next one
+func (t *freezerTable) nextFile() error {
+	if t.headFile == 1<<16-1 {
+		return errors.New("freezer table is full")
+	}
+	if err := t.head.Truncate(t.size); err != nil {
+		return err
+	}
+	if err := t.head.Sync(); err != nil {
+		return err
+	}
+	next, err := os.OpenFile(t.path(t.headFile+1), t.flag|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	t.filesMu.Lock()
+	t.files[t.headFile] = t.head
+	t.filesMu.Unlock()
+	t.head, t.headFile, t.size = next, t.headFile+1, 0
+	return nil
+}
+
+func (t *freezerTable) close() error {
+	var firstErr error
+	for _, data := range t.files {
+		if err := data.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if t.head != nil {
+		if err := t.head.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := t.index.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// copyFilePrefix copies the first size bytes of src to a new file at path
+func copyFilePrefix(src *os.File, path string, size int64) error {
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, io.NewSectionReader(src, 0, size)); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// FreezerDB reads blocks and receipts that were moved to a freezer through
+// the database it wraps, so callers find them under their usual keys. Only
+// Get and Has see frozen data, iterators and snapshots do not.
+type FreezerDB struct {
+	Database
+	freezer *Freezer
+	tables  *Tables
+}
+
+// NewFreezerDB returns db reading through to freezer
+func NewFreezerDB(db Database, freezer *Freezer) *FreezerDB {
+	return &FreezerDB{Database: db, freezer: freezer, tables: NewTables(db)}
+}
+
+// Freezer returns the freezer read through to
+func (db *FreezerDB) Freezer() *Freezer {
+	return db.freezer
+}
+
+// Get retrieves a value by key, from the freezer if it was frozen
+func (db *FreezerDB) Get(key []byte) ([]byte, error) {
+	data, err := db.Database.Get(key)
+	if !errors.Is(err, ErrKeyNotFound) {
+		return data, err
+	}
+	return db.frozen(key)
+}
+
+// Has checks if a key exists in the database or the freezer
+func (db *FreezerDB) Has(key []byte) (bool, error) {
+	exists, err := db.Database.Has(key)
+	if err != nil || exists {
+		return exists, err
+	}
+	if _, err := db.frozen(key); err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Close closes the database and the freezer
+func (db *FreezerDB) Close() error {
+	err := db.Database.Close()
+	if freezerErr := db.freezer.Close(); err == nil {
+		err = freezerErr
+	}
+	return err
+}
+
+// frozen looks a block or receipts key up in the freezer
+func (db *FreezerDB) frozen(key []byte) ([]byte, error) {
+	table, hash := FreezerBlocks, []byte(nil)
+	if h, ok := db.tables.Blocks.TrimKey(key); ok {
+		hash = h
+	} else if h, ok := db.tables.Receipts.TrimKey(key); ok {
+		table, hash = FreezerReceipts, h
+	} else {
+		return nil, ErrKeyNotFound
+	}
+
+	enc, err := db.tables.Frozen.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	data, err := db.freezer.Retrieve(table, binary.BigEndian.Uint64(enc))
+	if err != nil {
+		return nil, err
+	}
+	// Blocks frozen without receipts have an empty item
+	if len(data) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	return data, nil
+}
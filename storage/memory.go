@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryDB is a database held in memory, for tests and throwaway nodes.
+// Everything is lost when it is closed.
+type MemoryDB struct {
+	mu     sync.RWMutex
+	data   map[string][]byte
+	closed bool
+}
+
+// NewMemoryDB creates an empty in-memory database
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{data: make(map[string][]byte)}
+}
+
+// Get retrieves a value by key
+func (db *MemoryDB) Get(key []byte) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDatabaseClosed
+	}
+	value, ok := db.data[string(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// Put stores a key-value pair
+func (db *MemoryDB) Put(key []byte, value []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrDatabaseClosed
+	}
+	db.data[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete removes a key-value pair
+func (db *MemoryDB) Delete(key []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrDatabaseClosed
+	}
+	delete(db.data, string(key))
+	return nil
+}
+
+// Has checks if a key exists
+func (db *MemoryDB) Has(key []byte) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return false, ErrDatabaseClosed
+	}
+	_, ok := db.data[string(key)]
+	return ok, nil
+}
+
+// Close drops the contents of the database
+func (db *MemoryDB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.data = nil
+	db.closed = true
+	return nil
+}
+
+// NewBatch creates a new batch
+func (db *MemoryDB) NewBatch() Batch {
+	return &MemoryBatch{db: db}
+}
+
+// NewIterator returns an iterator over the keys starting with prefix, from
+// prefix+start on. It iterates over a snapshot, later writes are not seen.
+func (db *MemoryDB) NewIterator(prefix []byte, start []byte) Iterator {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	first := string(prefix) + string(start)
+	it := &memoryIterator{index: -1}
+	for key, value := range db.data {
+		if strings.HasPrefix(key, string(prefix)) && key >= first {
+			it.keys = append(it.keys, key)
+			it.values = append(it.values, value)
+		}
+	}
+	sort.Sort(it)
+	return it
+}
+
+// NewSnapshot returns a copy of the current database contents
+func (db *MemoryDB) NewSnapshot() (Snapshot, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDatabaseClosed
+	}
+	snap := NewMemoryDB()
+	for key, value := range db.data {
+		snap.data[key] = value
+	}
+	return &memorySnapshot{snap}, nil
+}
+
+// Stats returns database statistics
+func (db *MemoryDB) Stats() map[string]string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	size := 0
+	for key, value := range db.data {
+		size += len(key) + len(value)
+	}
+	return map[string]string{
+		"entries": fmt.Sprintf("%d", len(db.data)),
+		"size":    fmt.Sprintf("%d", size),
+	}
+}
+
+// Len returns the number of entries in the database
+func (db *MemoryDB) Len() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.data)
+}
+
+// MemoryBatch implements batch operations for MemoryDB
+type MemoryBatch struct {
+	db    *MemoryDB
+	ops   []memoryOp
+	bytes int
+}
+
+// memoryOp is a buffered batch operation, a nil value deletes the key
+type memoryOp struct {
+	key   string
+	value []byte
+}
+
+// Put adds a key-value pair to the batch
+func (b *MemoryBatch) Put(key []byte, value []byte) error {
+	b.ops = append(b.ops, memoryOp{key: string(key), value: append([]byte{}, value...)})
+	b.bytes += len(key) + len(value)
+	return nil
+}
+
+// Delete adds a delete operation to the batch
+func (b *MemoryBatch) Delete(key []byte) error {
+	b.ops = append(b.ops, memoryOp{key: string(key)})
+	b.bytes += len(key)
+	return nil
+}
+
+// Write commits the batch
+func (b *MemoryBatch) Write() error {
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+
+	if b.db.closed {
+		return ErrDatabaseClosed
+	}
+	for _, op := range b.ops {
+		if op.value == nil {
+			delete(b.db.data, op.key)
+		} else {
+			b.db.data[op.key] = op.value
+		}
+	}
+	return nil
+}
+
+// Reset resets the batch
+func (b *MemoryBatch) Reset() {
+	b.ops = b.ops[:0]
+	b.bytes = 0
+}
+
+// Size returns the number of operations in the batch
+func (b *MemoryBatch) Size() int {
+	return len(b.ops)
+}
+
+// ValueSize returns the bytes of the keys and values in the batch
+func (b *MemoryBatch) ValueSize() int {
+	return b.bytes
+}
+
+// memorySnapshot implements Snapshot with a copy of a MemoryDB
+type memorySnapshot struct {
+	*MemoryDB
+}
+
+func (s *memorySnapshot) Release() {
+	s.Close()
+}
+
+// memoryIterator walks a sorted snapshot of a MemoryDB
+type memoryIterator struct {
+	keys   []string
+	values [][]byte
+	index  int
+}
+
+func (it *memoryIterator) Next() bool {
+	if it.index < len(it.keys) {
+		it.index++
+	}
+	return it.index < len(it.keys)
+}
+
+func (it *memoryIterator) Key() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return []byte(it.keys[it.index])
+}
+
+func (it *memoryIterator) Value() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.index]
+}
+
+func (it *memoryIterator) Error() error {
+	return nil
+}
+
+func (it *memoryIterator) Release() {
+	it.keys, it.values = nil, nil
+}
+
+func (it *memoryIterator) Len() int {
+	return len(it.keys)
+}
+
+func (it *memoryIterator) Less(i, j int) bool {
+	return it.keys[i] < it.keys[j]
+}
+
+func (it *memoryIterator) Swap(i, j int) {
+	it.keys[i], it.keys[j] = it.keys[j], it.keys[i]
+	it.values[i], it.values[j] = it.values[j], it.values[i]
+}
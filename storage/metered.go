@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the latency histogram buckets,
+// from cache hits to writes stalled by compaction
+var LatencyBuckets = [...]time.Duration{
+	10 * time.Microsecond,
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// MeteredDB measures the operations on the database it wraps: how many,
+// how many bytes and how long they took
+type MeteredDB struct {
+	Database
+	gets        opMeter
+	puts        opMeter
+	deletes     opMeter
+	batchWrites opMeter
+}
+
+// MeterStats are the operation counters of a MeteredDB, totals since it was
+// created
+type MeterStats struct {
+	Get        OpStats `json:"get"`
+	Put        OpStats `json:"put"`
+	Delete     OpStats `json:"delete"`
+	BatchWrite OpStats `json:"batch_write"`
+
+	// Compaction is nil unless the backend reports compactions
+	Compaction *CompactionStats `json:"compaction,omitempty"`
+}
+
+// OpStats are the counters of one kind of operation
+type OpStats struct {
+	Count   uint64           `json:"count"`
+	Entries uint64           `json:"entries"` // entries, more than Count for batch writes
+	Bytes   uint64           `json:"bytes"`   // keys and values read or written
+	Latency LatencyHistogram `json:"latency"`
+}
+
+// LatencyHistogram counts operations by duration. Buckets[i] counts those
+// that took at most LatencyBuckets[i], the rest only count in Count.
+type LatencyHistogram struct {
+	Buckets []uint64      `json:"buckets"`
+	Count   uint64        `json:"count"`
+	Sum     time.Duration `json:"sum_ns"`
+}
+
+// CompactionStats are the compaction and size statistics of a backend
+type CompactionStats struct {
+	Size            int64         `json:"size_bytes"`             // bytes in table files
+	LevelSizes      []int64       `json:"level_sizes_bytes"`      // bytes in table files per level
+	LevelTables     []int         `json:"level_tables"`           // table files per level
+	Compactions     uint64        `json:"compactions"`            // compactions of all kinds
+	CompactionTime  time.Duration `json:"compaction_time_ns"`     // total time spent compacting
+	CompactionRead  int64         `json:"compaction_read_bytes"`  // bytes read by compactions
+	CompactionWrite int64         `json:"compaction_write_bytes"` // bytes written by compactions
+	WriteDelays     uint64        `json:"write_delays"`           // writes delayed by compactions
+	WriteDelayTime  time.Duration `json:"write_delay_time_ns"`    // total time writes were delayed
+	WritePaused     bool          `json:"write_paused"`           // whether writes are paused for compaction
+	DiskRead        uint64        `json:"disk_read_bytes"`        // bytes read from disk
+	DiskWrite       uint64        `json:"disk_write_bytes"`       // bytes written to disk
+}
+
+// compactionStater is implemented by backends that report compactions
+type compactionStater interface {
+	CompactionStats() (*CompactionStats, error)
+}
+
+// NewMeteredDB returns db with its operations measured
+func NewMeteredDB(db Database) *MeteredDB {
+	return &MeteredDB{Database: db}
+}
+
+// Get retrieves a value by key
+func (db *MeteredDB) Get(key []byte) ([]byte, error) {
+	start := time.Now()
+	data, err := db.Database.Get(key)
+	db.gets.mark(start, 1, len(key)+len(data))
+	return data, err
+}
+
+// Put stores a key-value pair
+func (db *MeteredDB) Put(key []byte, value []byte) error {
+	start := time.Now()
+	err := db.Database.Put(key, value)
+	db.puts.mark(start, 1, len(key)+len(value))
+	return err
+}
+
+// Delete removes a key-value pair
+func (db *MeteredDB) Delete(key []byte) error {
+	start := time.Now()
+	err := db.Database.Delete(key)
+	db.deletes.mark(start, 1, len(key))
+	return err
+}
+
+// NewBatch creates a batch whose writes are measured
+func (db *MeteredDB) NewBatch() Batch {
+	return &meteredBatch{Batch: db.Database.NewBatch(), meter: &db.batchWrites}
+}
+
+// MeterStats returns the operation counters and, if the backend reports
+// them, its compaction statistics
+func (db *MeteredDB) MeterStats() MeterStats {
+	stats := MeterStats{
+		Get:        db.gets.snapshot(),
+		Put:        db.puts.snapshot(),
+		Delete:     db.deletes.snapshot(),
+		BatchWrite: db.batchWrites.snapshot(),
+	}
+	if backend, ok := unwrap(db.Database).(compactionStater); ok {
+		if compaction, err := backend.CompactionStats(); err == nil {
+			stats.Compaction = compaction
+		}
+	}
+	return stats
+}
+
+// unwrap returns the backend under the wrappers of db
+func unwrap(db Database) Database {
+	for {
+		switch wrapped := db.(type) {
+		case readOnlyDB:
+			db = wrapped.Database
+		case *FreezerDB:
+			db = wrapped.Database
+		case *EncryptedDB:
+			db = wrapped.Database
+		default:
+			return db
+		}
+	}
+}
+
+// meteredBatch measures the writes of a batch
+type meteredBatch struct {
+	Batch
+	meter *opMeter
+}
+
+func (b *meteredBatch) Write() error {
+	start := time.Now()
+	err := b.Batch.Write()
+	b.meter.mark(start, b.Size(), b.ValueSize())
+	return err
+}
+
+// opMeter counts one kind of operation
+type opMeter struct {
+	count   atomic.Uint64
+	entries atomic.Uint64
+	bytes   atomic.Uint64
+	sum     atomic.Int64
+	buckets [len(LatencyBuckets)]atomic.Uint64
+}
+
+// mark records an operation that started at start
+func (m *opMeter) mark(start time.Time, entries, bytes int) {
+	elapsed := time.Since(start)
+	m.count.Add(1)
+	m.entries.Add(uint64(entries))
+	m.bytes.Add(uint64(bytes))
+	m.sum.Add(int64(elapsed))
+	for i, bound := range LatencyBuckets {
+		if elapsed <= bound {
+			m.buckets[i].Add(1)
+			break
+		}
+	}
+}
+
+// snapshot returns the current counters with cumulative buckets
+func (m *opMeter) snapshot() OpStats {
+	stats := OpStats{
+		Count:   m.count.Load(),
+		Entries: m.entries.Load(),
+		Bytes:   m.bytes.Load(),
+		Latency: LatencyHistogram{
+			Buckets: make([]uint64, len(m.buckets)),
+			Count:   m.count.Load(),
+			Sum:     time.Duration(m.sum.Load()),
+		},
+	}
+	var total uint64
+	for i := range m.buckets {
+		total += m.buckets[i].Load()
+		stats.Latency.Buckets[i] = total
+	}
+	return stats
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// Pebble implementation, a LevelDB-compatible LSM store that keeps
+// compactions and reads fast on large databases
+type Pebble struct {
+	db *pebble.DB
+}
+
+// NewPebble creates a new Pebble instance with options
+func NewPebble(path string, options *Options) (*Pebble, error) {
+	cache := pebble.NewCache(int64(options.CacheSize) * 1024 * 1024)
+	defer cache.Unref()
+
+	db, err := pebble.Open(path, &pebble.Options{
+		Cache:        cache,
+		MaxOpenFiles: options.MaxOpenFiles,
+		MemTableSize: uint64(options.WriteBuffer) * 1024 * 1024,
+		ReadOnly:     options.ReadOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pebble at %s: %v", path, err)
+	}
+
+	return &Pebble{db: db}, nil
+}
+
+// Get retrieves a value by key
+func (p *Pebble) Get(key []byte) ([]byte, error) {
+	data, closer, err := p.db.Get(key)
+	if err != nil {
+		if errors.Is(err, pebble.ErrNotFound) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, fmt.Errorf("pebble get error: %v", err)
+	}
+	defer closer.Close()
+
+	// The value is only valid until the closer is closed
+	return append([]byte(nil), data...), nil
+}
+
+// Put stores a key-value pair
+func (p *Pebble) Put(key []byte, value []byte) error {
+	if err := p.db.Set(key, value, pebble.NoSync); err != nil {
+		return fmt.Errorf("pebble put error: %v", err)
+	}
+	return nil
+}
+
+// Delete removes a key-value pair
+func (p *Pebble) Delete(key []byte) error {
+	if err := p.db.Delete(key, pebble.NoSync); err != nil {
+		return fmt.Errorf("pebble delete error: %v", err)
+	}
+	return nil
+}
+
+// Has checks if a key exists
+func (p *Pebble) Has(key []byte) (bool, error) {
+	_, closer, err := p.db.Get(key)
+	if err != nil {
+		if errors.Is(err, pebble.ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("pebble has error: %v", err)
+	}
+	closer.Close()
+	return true, nil
+}
+
+// Close closes the database
+func (p *Pebble) Close() error {
+	if err := p.db.Close(); err != nil {
+		return fmt.Errorf("pebble close error: %v", err)
+	}
+	return nil
+}
+
+// NewBatch creates a new batch
+func (p *Pebble) NewBatch() Batch {
+	return &PebbleBatch{batch: p.db.NewBatch()}
+}
+
+// NewIterator returns an iterator over the keys starting with prefix, from
+// prefix+start on
+func (p *Pebble) NewIterator(prefix []byte, start []byte) Iterator {
+	iter, err := p.db.NewIter(pebbleRange(prefix, start))
+	return &pebbleIterator{iter: iter, err: err}
+}
+
+// NewSnapshot returns a read-only view of the current database contents
+func (p *Pebble) NewSnapshot() (Snapshot, error) {
+	return &pebbleSnapshot{snap: p.db.NewSnapshot()}, nil
+}
+
+// Stats returns database statistics
+func (p *Pebble) Stats() map[string]string {
+	metrics := p.db.Metrics()
+	return map[string]string{
+		"general":    metrics.String(),
+		"disk_usage": fmt.Sprintf("%d", metrics.DiskSpaceUsage()),
+	}
+}
+
+// PebbleBatch implements batch operations for Pebble
+type PebbleBatch struct {
+	batch *pebble.Batch
+	size  int
+	bytes int
+}
+
+// Put adds a key-value pair to the batch
+func (b *PebbleBatch) Put(key []byte, value []byte) error {
+	if err := b.batch.Set(key, value, nil); err != nil {
+		return fmt.Errorf("pebble batch put error: %v", err)
+	}
+	b.size++
+	b.bytes += len(key) + len(value)
+	return nil
+}
+
+// Delete adds a delete operation to the batch
+func (b *PebbleBatch) Delete(key []byte) error {
+	if err := b.batch.Delete(key, nil); err != nil {
+		return fmt.Errorf("pebble batch delete error: %v", err)
+	}
+	b.size++
+	b.bytes += len(key)
+	return nil
+}
+
+// Write commits the batch
+func (b *PebbleBatch) Write() error {
+	if err := b.batch.Commit(pebble.NoSync); err != nil {
+		return fmt.Errorf("pebble batch write error: %v", err)
+	}
+	return nil
+}
+
+// Reset resets the batch
+func (b *PebbleBatch) Reset() {
+	b.batch.Reset()
+	b.size = 0
+	b.bytes = 0
+}
+
+// Size returns the number of operations in the batch
+func (b *PebbleBatch) Size() int {
+	return b.size
+}
+
+// ValueSize returns the bytes of the keys and values in the batch
+func (b *PebbleBatch) ValueSize() int {
+	return b.bytes
+}
+
+// pebbleSnapshot implements Snapshot for Pebble
+type pebbleSnapshot struct {
+	snap *pebble.Snapshot
+}
+
+func (s *pebbleSnapshot) Get(key []byte) ([]byte, error) {
+	data, closer, err := s.snap.Get(key)
+	if err != nil {
+		if errors.Is(err, pebble.ErrNotFound) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, fmt.Errorf("pebble get error: %v", err)
+	}
+	defer closer.Close()
+	return append([]byte(nil), data...), nil
+}
+
+func (s *pebbleSnapshot) NewIterator(prefix []byte, start []byte) Iterator {
+	iter, err := s.snap.NewIter(pebbleRange(prefix, start))
+	return &pebbleIterator{iter: iter, err: err}
+}
+
+func (s *pebbleSnapshot) Release() {
+	s.snap.Close()
+}
+
+// Compact compacts the range between the first and the last key
+func (p *Pebble) Compact() error {
+	iter, err := p.db.NewIter(nil)
+	if err != nil {
+		return err
+	}
+	if !iter.First() {
+		return iter.Close()
+	}
+	first := append([]byte(nil), iter.Key()...)
+	iter.Last()
+	end := append(append([]byte(nil), iter.Key()...), 0)
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	if err := p.db.Compact(first, end, true); err != nil {
+		return fmt.Errorf("pebble compaction error: %v", err)
+	}
+	return nil
+}
+
+// pebbleRange returns the bounds of the keys starting with prefix, from
+// prefix+start on
+func pebbleRange(prefix []byte, start []byte) *pebble.IterOptions {
+	return &pebble.IterOptions{
+		LowerBound: append(append([]byte(nil), prefix...), start...),
+		UpperBound: prefixEnd(prefix),
+	}
+}
+
+// pebbleIterator adapts a Pebble iterator, which has to be positioned
+// before the first call to Next
+type pebbleIterator struct {
+	iter    *pebble.Iterator
+	err     error
+	started bool
+}
+
+func (it *pebbleIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		return it.iter.First()
+	}
+	return it.iter.Next()
+}
+
+func (it *pebbleIterator) Key() []byte {
+	return it.iter.Key()
+}
+
+func (it *pebbleIterator) Value() []byte {
+	return it.iter.Value()
+}
+
+func (it *pebbleIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.iter.Error()
+}
+
+func (it *pebbleIterator) Release() {
+	if it.iter != nil {
+		it.iter.Close()
+	}
+}
+
+// prefixEnd returns the smallest key greater than every key starting with
+// prefix, nil if there is none
+func prefixEnd(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] < 0xff {
+			end := append([]byte(nil), prefix[:i+1]...)
+			end[i]++
+			return end
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"time"
+)
+
+// pruneBatchSize is the number of keys deleted per batch by range deletions
+const pruneBatchSize = 1000
+
+// DeleteRange deletes the keys of db from start up to but not including
+// end, to the last key if end is nil, and returns how many were deleted.
+// The keys are deleted in batches paced to at most rate keys per second so
+// that long deletions leave room for foreground reads and writes, a rate of
+// 0 deletes as fast as possible. The deletion is not atomic, an interrupted
+// one leaves the keys it did not reach.
+func DeleteRange(ctx context.Context, db Database, start, end []byte, rate int) (int, error) {
+	it := db.NewIterator(nil, start)
+	return deleteKeys(ctx, db.NewBatch(), it, func(key []byte) bool {
+		return end == nil || bytes.Compare(key, end) < 0
+	}, rate)
+}
+
+// DeletePrefix deletes the keys of db starting with prefix like
+// DeleteRange
+func DeletePrefix(ctx context.Context, db Database, prefix []byte, rate int) (int, error) {
+	return DeleteRange(ctx, db, prefix, prefixEnd(prefix), rate)
+}
+
+// DeletePrefix deletes the keys of the table starting with prefix like
+// DeleteRange, the keys of nested tables are kept
+func (t *Table) DeletePrefix(ctx context.Context, prefix []byte, rate int) (int, error) {
+	it := t.NewIterator(prefix, nil)
+	return deleteKeys(ctx, t.NewBatch(), it, func([]byte) bool { return true }, rate)
+}
+
+// deleteKeys deletes the keys of it while inRange holds for them and
+// releases it
+func deleteKeys(ctx context.Context, batch Batch, it Iterator, inRange func(key []byte) bool, rate int) (int, error) {
+	defer it.Release()
+
+	count := 0
+	start := time.Now()
+	for it.Next() {
+		if !inRange(it.Key()) {
+			break
+		}
+		if err := batch.Delete(append([]byte(nil), it.Key()...)); err != nil {
+			return count, err
+		}
+		if batch.Size() < pruneBatchSize {
+			continue
+		}
+		if err := batch.Write(); err != nil {
+			return count, err
+		}
+		count += batch.Size()
+		batch.Reset()
+		if err := pace(ctx, start, count, rate); err != nil {
+			return count, err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return count, err
+	}
+	if err := batch.Write(); err != nil {
+		return count, err
+	}
+	return count + batch.Size(), nil
+}
+
+// pace waits until deleting count keys since start stays within rate keys
+// per second
+func pace(ctx context.Context, start time.Time, count, rate int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if rate <= 0 {
+		return nil
+	}
+	wait := time.Duration(count)*time.Second/time.Duration(rate) - time.Since(start)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
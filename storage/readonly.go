@@ -0,0 +1,58 @@
+package storage
+
+// readOnlyDB rejects every write to the database it wraps, on top of the
+// backend refusing them, so that no write can slip through to the files of
+// a database opened for inspection
+type readOnlyDB struct {
+	Database
+}
+
+// Put rejects the write
+func (db readOnlyDB) Put(key []byte, value []byte) error {
+	return ErrReadOnly
+}
+
+// Delete rejects the write
+func (db readOnlyDB) Delete(key []byte) error {
+	return ErrReadOnly
+}
+
+// NewBatch returns a batch that cannot be written
+func (db readOnlyDB) NewBatch() Batch {
+	return &readOnlyBatch{}
+}
+
+// readOnlyBatch collects operations but fails to write them
+type readOnlyBatch struct {
+	size  int
+	bytes int
+}
+
+func (b *readOnlyBatch) Put(key []byte, value []byte) error {
+	b.size++
+	b.bytes += len(key) + len(value)
+	return nil
+}
+
+func (b *readOnlyBatch) Delete(key []byte) error {
+	b.size++
+	b.bytes += len(key)
+	return nil
+}
+
+func (b *readOnlyBatch) Write() error {
+	return ErrReadOnly
+}
+
+func (b *readOnlyBatch) Reset() {
+	b.size = 0
+	b.bytes = 0
+}
+
+func (b *readOnlyBatch) Size() int {
+	return b.size
+}
+
+func (b *readOnlyBatch) ValueSize() int {
+	return b.bytes
+}
@@ -0,0 +1,176 @@
+package storage
+
+import "bytes"
+
+// Table is the keyspace of one kind of data in a database: every key is
+// stored under the table prefix, which callers never see. Tables nested in
+// the prefix of another, as canonical hashes are in the block prefix, are
+// left out of its iterations.
+type Table struct {
+	db      Database
+	name    string
+	prefix  []byte
+	exclude [][]byte // prefixes of nested tables, relative to prefix
+}
+
+// TableStats is the size of a table
+type TableStats struct {
+	Name    string
+	Prefix  string
+	Entries int
+	Size    int64 // bytes of keys and values
+}
+
+// NewTable returns the table of db under prefix
+func NewTable(db Database, name string, prefix []byte) *Table {
+	return &Table{db: db, name: name, prefix: prefix}
+}
+
+// Name returns the name of the table
+func (t *Table) Name() string {
+	return t.name
+}
+
+// Prefix returns the prefix of the keys of the table in the database
+func (t *Table) Prefix() []byte {
+	return t.prefix
+}
+
+// Key returns the database key of key
+func (t *Table) Key(key []byte) []byte {
+	return append(append(make([]byte, 0, len(t.prefix)+len(key)), t.prefix...), key...)
+}
+
+// Get retrieves a value by key
+func (t *Table) Get(key []byte) ([]byte, error) {
+	return t.db.Get(t.Key(key))
+}
+
+// Put stores a key-value pair
+func (t *Table) Put(key []byte, value []byte) error {
+	return t.db.Put(t.Key(key), value)
+}
+
+// Delete removes a key-value pair
+func (t *Table) Delete(key []byte) error {
+	return t.db.Delete(t.Key(key))
+}
+
+// Has checks if a key exists
+func (t *Table) Has(key []byte) (bool, error) {
+	return t.db.Has(t.Key(key))
+}
+
+// NewBatch creates a batch writing to the table only
+func (t *Table) NewBatch() Batch {
+	return t.Batch(t.db.NewBatch())
+}
+
+// Batch returns a view of batch that writes to the table, so that the
+// changes of several tables are written together
+func (t *Table) Batch(batch Batch) Batch {
+	return &tableBatch{table: t, batch: batch}
+}
+
+// NewIterator returns an iterator over the keys of the table starting with
+// prefix, from prefix+start on. The keys it returns lack the table prefix.
+func (t *Table) NewIterator(prefix []byte, start []byte) Iterator {
+	return &tableIterator{
+		table: t,
+		iter:  t.db.NewIterator(t.Key(prefix), start),
+	}
+}
+
+// Usage counts the entries of the table and their size by walking it
+func (t *Table) Usage() (TableStats, error) {
+	stats := TableStats{Name: t.name, Prefix: string(t.prefix)}
+
+	it := t.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		stats.Entries++
+		stats.Size += int64(len(t.prefix) + len(it.Key()) + len(it.Value()))
+	}
+	return stats, it.Error()
+}
+
+// TrimKey returns key without the table prefix, false if key is not in the
+// table
+func (t *Table) TrimKey(key []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(key, t.prefix) || t.nested(key[len(t.prefix):]) {
+		return nil, false
+	}
+	return key[len(t.prefix):], true
+}
+
+// nested reports whether key belongs to a table nested in this one
+func (t *Table) nested(key []byte) bool {
+	for _, prefix := range t.exclude {
+		if bytes.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// tableBatch prefixes the keys of a batch
+type tableBatch struct {
+	table *Table
+	batch Batch
+}
+
+func (b *tableBatch) Put(key []byte, value []byte) error {
+	return b.batch.Put(b.table.Key(key), value)
+}
+
+func (b *tableBatch) Delete(key []byte) error {
+	return b.batch.Delete(b.table.Key(key))
+}
+
+func (b *tableBatch) Write() error {
+	return b.batch.Write()
+}
+
+func (b *tableBatch) Reset() {
+	b.batch.Reset()
+}
+
+func (b *tableBatch) Size() int {
+	return b.batch.Size()
+}
+
+func (b *tableBatch) ValueSize() int {
+	return b.batch.ValueSize()
+}
+
+// tableIterator strips the table prefix from the keys of an iterator and
+// skips the keys of nested tables
+type tableIterator struct {
+	table *Table
+	iter  Iterator
+}
+
+func (it *tableIterator) Next() bool {
+	for it.iter.Next() {
+		if !it.table.nested(it.Key()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *tableIterator) Key() []byte {
+	return it.iter.Key()[len(it.table.prefix):]
+}
+
+func (it *tableIterator) Value() []byte {
+	return it.iter.Value()
+}
+
+func (it *tableIterator) Error() error {
+	return it.iter.Error()
+}
+
+func (it *tableIterator) Release() {
+	it.iter.Release()
+}
@@ -0,0 +1,86 @@
+package storage
+
+import "bytes"
+
+// Tables are the keyspaces of the node database. The prefixes are the ones
+// keys were stored under before tables existed, so existing data
+// directories stay readable.
+type Tables struct {
+	Blocks     *Table // encoded block by block hash
+	Canonical  *Table // canonical block hash by block number
+	Receipts   *Table // encoded receipts by block hash
+	TxLookup   *Table // hash of the block including a transaction by transaction hash
+	Difficulty *Table // total difficulty by block hash
+	Undo       *Table // state undo record by block hash
+	Accounts   *Table // encoded account by address
+	Storage    *Table // storage value by address and slot
+	Code       *Table // contract code by code hash
+	TrieNodes  *Table // encoded trie node by node hash
+	TrieRefs   *Table // trie node reference count by node hash
+	Preimages  *Table // preimage of a hashed trie key by hash
+	Frozen     *Table // freezer item number of a frozen block by block hash
+	Meta       *Table // single markers: chain head, finalized block, state root and history
+}
+
+// NewTables returns the tables of db
+func NewTables(db Database) *Tables {
+	t := &Tables{
+		Blocks:     NewTable(db, "blocks", []byte("block-")),
+		Canonical:  NewTable(db, "canonical", []byte("block-number-")),
+		Receipts:   NewTable(db, "receipts", []byte("receipts-")),
+		TxLookup:   NewTable(db, "txlookup", []byte("txlookup-")),
+		Difficulty: NewTable(db, "difficulty", []byte("td-")),
+		Undo:       NewTable(db, "undo", []byte("undo-")),
+		Accounts:   NewTable(db, "accounts", []byte("account-")),
+		Storage:    NewTable(db, "storage", []byte("storage-")),
+		Code:       NewTable(db, "code", []byte("code-")),
+		TrieNodes:  NewTable(db, "trie", []byte("trie-")),
+		TrieRefs:   NewTable(db, "trierefs", []byte("trieref-")),
+		Preimages:  NewTable(db, "preimages", []byte("preimage-")),
+		Frozen:     NewTable(db, "frozen", []byte("frozen-")),
+		Meta:       NewTable(db, "meta", nil),
+	}
+
+	// Iterations over a table skip the tables nested in its prefix
+	all := t.All()
+	for _, table := range all {
+		for _, other := range all {
+			if other != table && bytes.HasPrefix(other.prefix, table.prefix) {
+				table.exclude = append(table.exclude, other.prefix[len(table.prefix):])
+			}
+		}
+	}
+	return t
+}
+
+// All returns every table
+func (t *Tables) All() []*Table {
+	return []*Table{
+		t.Blocks, t.Canonical, t.Receipts, t.TxLookup, t.Difficulty, t.Undo,
+		t.Accounts, t.Storage, t.Code, t.TrieNodes, t.TrieRefs, t.Preimages,
+		t.Frozen, t.Meta,
+	}
+}
+
+// ByName returns the table called name, nil if there is none
+func (t *Tables) ByName(name string) *Table {
+	for _, table := range t.All() {
+		if table.name == name {
+			return table
+		}
+	}
+	return nil
+}
+
+// Usage returns the size of every table
+func (t *Tables) Usage() ([]TableStats, error) {
+	var stats []TableStats
+	for _, table := range t.All() {
+		usage, err := table.Usage()
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, usage)
+	}
+	return stats, nil
+}
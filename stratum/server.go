@@ -0,0 +1,517 @@
+package stratum
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"blockchain-node/config"
+	"blockchain-node/consensus"
+	"blockchain-node/crypto"
+	"blockchain-node/logger"
+)
+
+const (
+	// jobRefresh is how often the work source is polled for a new template
+	jobRefresh = time.Second
+
+	// maxJobs is the number of recent jobs on top of the same head that
+	// shares are still accepted for
+	maxJobs = 16
+
+	// maxExtranonce bounds the extranonce of a session, which fills the top
+	// two bytes of the nonce
+	maxExtranonce = 0xffff
+
+	// maxLineSize limits the length of a single stratum message
+	maxLineSize = 16 * 1024
+)
+
+// Stratum error codes
+const (
+	errCodeOther         = 20
+	errCodeJobNotFound   = 21
+	errCodeDuplicate     = 22
+	errCodeLowDiff       = 23
+	errCodeUnauthorized  = 24
+	errCodeNotSubscribed = 25
+)
+
+// Job is a block template to be sealed. A nonce solves it when the seal
+// hash of SealData and the nonce is below Target.
+type Job struct {
+	WorkHash crypto.Hash // identifies the template at the work source
+	SealData []byte      // header data the seal commits to
+	Target   *big.Int    // block target
+	Number   *big.Int    // block number
+}
+
+// WorkSource provides the block template to mine on and imports the blocks
+// solved by miners
+type WorkSource interface {
+	StratumJob() (*Job, error)
+	SubmitWork(nonce uint64, workHash crypto.Hash) bool
+}
+
+// job is a Job handed out to miners with the shares submitted for it
+type job struct {
+	*Job
+	id     string
+	shares map[uint64]bool
+}
+
+// request is a stratum message from a miner
+type request struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// response answers a request of a miner
+type response struct {
+	ID     interface{} `json:"id"`
+	Result interface{} `json:"result"`
+	Error  interface{} `json:"error"`
+}
+
+// notification is a message to a miner that is not answered
+type notification struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// Session is a miner connection
+type Session struct {
+	ID         string
+	Address    string
+	Worker     string
+	Extranonce uint16
+	Connected  time.Time
+	Accepted   uint64
+	Rejected   uint64
+
+	conn       net.Conn
+	subscribed bool
+	authorized bool
+	mu         sync.Mutex // serializes writes and guards the counters
+}
+
+// Server distributes jobs derived from the current block template to miner
+// clients over the stratum protocol and validates their shares. Shares
+// that also meet the block target are submitted to the work source.
+type Server struct {
+	config   *config.StratumConfig
+	work     WorkSource
+	listener net.Listener
+	logger   *logger.Logger
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	mu       sync.RWMutex
+
+	sessions   map[string]*Session
+	jobs       map[string]*job
+	order      []string // ids of the kept jobs, oldest first
+	current    *job
+	nextJob    uint64
+	extranonce uint16
+
+	shareDifficulty uint64
+	shareTarget     *big.Int // target of shares, before capping to the block target
+}
+
+// NewServer creates a new stratum server handing out work from source
+func NewServer(config *config.StratumConfig, source WorkSource) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	difficulty := config.ShareDifficulty
+	if difficulty == 0 || difficulty > 256 {
+		difficulty = 1
+	}
+
+	return &Server{
+		config:          config,
+		work:            source,
+		logger:          logger.NewLogger("stratum"),
+		ctx:             ctx,
+		cancel:          cancel,
+		sessions:        make(map[string]*Session),
+		jobs:            make(map[string]*job),
+		shareDifficulty: difficulty,
+		shareTarget:     new(big.Int).Lsh(big.NewInt(1), uint(256-difficulty)),
+	}
+}
+
+// Start starts the stratum server
+func (s *Server) Start() error {
+	s.logger.Info("Starting stratum server", "host", s.config.Host, "port", s.config.Port,
+		"shareDifficulty", s.shareDifficulty)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", s.config.Host, s.config.Port))
+	if err != nil {
+		return fmt.Errorf("failed to start stratum listener: %v", err)
+	}
+	s.listener = listener
+
+	s.wg.Add(1)
+	go s.acceptConnections()
+
+	s.wg.Add(1)
+	go s.refreshJobs()
+
+	s.logger.Info("Stratum server started successfully")
+	return nil
+}
+
+// Stop stops the stratum server and disconnects all miners
+func (s *Server) Stop() error {
+	s.logger.Info("Stopping stratum server...")
+
+	s.cancel()
+	if s.listener != nil {
+		s.listener.Close()
+	}
+
+	s.mu.Lock()
+	for _, session := range s.sessions {
+		session.conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	s.logger.Info("Stratum server stopped")
+	return nil
+}
+
+// GetSessionCount returns the number of connected miners
+func (s *Server) GetSessionCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.sessions)
+}
+
+// acceptConnections accepts incoming miner connections
+func (s *Server) acceptConnections() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+			s.logger.Error("Failed to accept connection", "error", err)
+			continue
+		}
+
+		if s.config.MaxConnections > 0 && s.GetSessionCount() >= s.config.MaxConnections {
+			s.logger.Warning("Rejecting miner connection, connection limit reached")
+			conn.Close()
+			continue
+		}
+
+		s.wg.Add(1)
+		go s.handleSession(conn)
+	}
+}
+
+// handleSession serves the messages of a miner until it disconnects
+func (s *Server) handleSession(conn net.Conn) {
+	defer s.wg.Done()
+
+	s.mu.Lock()
+	s.extranonce = s.extranonce%maxExtranonce + 1
+	session := &Session{
+		ID:         fmt.Sprintf("%s-%d", conn.RemoteAddr().String(), time.Now().UnixNano()),
+		Address:    conn.RemoteAddr().String(),
+		Extranonce: s.extranonce,
+		Connected:  time.Now(),
+		conn:       conn,
+	}
+	s.sessions[session.ID] = session
+	s.mu.Unlock()
+
+	s.logger.Info("Miner connected", "session", session.ID)
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, session.ID)
+		s.mu.Unlock()
+		conn.Close()
+
+		session.mu.Lock()
+		s.logger.Info("Miner disconnected", "session", session.ID, "worker", session.Worker,
+			"accepted", session.Accepted, "rejected", session.Rejected)
+		session.mu.Unlock()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 1024), maxLineSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			s.logger.Debug("Failed to decode message from miner", "session", session.ID, "error", err)
+			return
+		}
+		s.handleRequest(session, &req)
+	}
+}
+
+// handleRequest answers a single request of a miner
+func (s *Server) handleRequest(session *Session, req *request) {
+	switch req.Method {
+	case "mining.subscribe":
+		session.mu.Lock()
+		session.subscribed = true
+		session.mu.Unlock()
+		s.reply(session, req.ID, []interface{}{
+			[]interface{}{"mining.notify", session.ID},
+			fmt.Sprintf("%04x", session.Extranonce),
+		}, nil)
+
+	case "mining.authorize":
+		session.mu.Lock()
+		subscribed := session.subscribed
+		session.mu.Unlock()
+		if !subscribed {
+			s.reply(session, req.ID, nil, stratumError(errCodeNotSubscribed, "not subscribed"))
+			return
+		}
+		worker, _ := param(req.Params, 0)
+		session.mu.Lock()
+		session.Worker = worker
+		session.authorized = true
+		session.mu.Unlock()
+		s.reply(session, req.ID, true, nil)
+		s.logger.Info("Miner authorized", "session", session.ID, "worker", worker)
+
+		s.notify(session, "mining.set_difficulty", []interface{}{s.shareDifficulty})
+		s.mu.RLock()
+		current := s.current
+		s.mu.RUnlock()
+		if current != nil {
+			s.notify(session, "mining.notify", jobParams(current, true))
+		}
+
+	case "mining.submit":
+		result, err := s.submit(session, req.Params)
+		s.reply(session, req.ID, result, err)
+
+	case "mining.extranonce.subscribe":
+		s.reply(session, req.ID, false, nil)
+
+	default:
+		s.reply(session, req.ID, nil, stratumError(errCodeOther, fmt.Sprintf("unknown method %q", req.Method)))
+	}
+}
+
+// submit validates a share with params [worker, job id, nonce] and returns
+// the result and error to answer it with
+func (s *Server) submit(session *Session, params []interface{}) (interface{}, interface{}) {
+	session.mu.Lock()
+	authorized := session.authorized
+	session.mu.Unlock()
+	if !authorized {
+		return nil, stratumError(errCodeUnauthorized, "unauthorized worker")
+	}
+
+	jobID, _ := param(params, 1)
+	nonceStr, ok := param(params, 2)
+	if !ok {
+		return s.reject(session, errCodeOther, "invalid parameters")
+	}
+	nonce, err := crypto.DecodeUint64(nonceStr)
+	if err != nil {
+		return s.reject(session, errCodeOther, fmt.Sprintf("invalid nonce: %v", err))
+	}
+	if uint16(nonce>>48) != session.Extranonce {
+		return s.reject(session, errCodeOther, "nonce does not start with the extranonce")
+	}
+
+	s.mu.RLock()
+	j := s.jobs[jobID]
+	s.mu.RUnlock()
+	if j == nil {
+		return s.reject(session, errCodeJobNotFound, "job not found")
+	}
+
+	hash := consensus.SealHash(j.SealData, nonce)
+	hashInt := new(big.Int).SetBytes(hash[:])
+	if hashInt.Cmp(s.jobShareTarget(j)) >= 0 {
+		return s.reject(session, errCodeLowDiff, "low difficulty share")
+	}
+
+	// Only valid shares are remembered, so that a miner cannot grow the
+	// map with nonces that cost it nothing
+	s.mu.Lock()
+	if j.shares[nonce] {
+		s.mu.Unlock()
+		return s.reject(session, errCodeDuplicate, "duplicate share")
+	}
+	j.shares[nonce] = true
+	s.mu.Unlock()
+
+	session.mu.Lock()
+	session.Accepted++
+	worker := session.Worker
+	session.mu.Unlock()
+
+	if hashInt.Cmp(j.Target) < 0 {
+		if s.work.SubmitWork(nonce, j.WorkHash) {
+			s.logger.Info("Block found by stratum miner", "number", j.Number.String(), "worker", worker,
+				"nonce", nonce)
+		} else {
+			s.logger.Warning("Block solution rejected by the node", "number", j.Number.String(), "worker", worker)
+		}
+	}
+	return true, nil
+}
+
+// reject counts a rejected share and returns the error to answer it with
+func (s *Server) reject(session *Session, code int, message string) (interface{}, interface{}) {
+	session.mu.Lock()
+	session.Rejected++
+	session.mu.Unlock()
+	s.logger.Debug("Share rejected", "session", session.ID, "reason", message)
+	return nil, stratumError(code, message)
+}
+
+// jobShareTarget returns the target of shares for a job, never below the
+// block target
+func (s *Server) jobShareTarget(j *job) *big.Int {
+	if s.shareTarget.Cmp(j.Target) < 0 {
+		return j.Target
+	}
+	return s.shareTarget
+}
+
+// refreshJobs polls the work source and broadcasts new jobs
+func (s *Server) refreshJobs() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(jobRefresh)
+	defer ticker.Stop()
+
+	for {
+		s.updateJob()
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateJob fetches the current template and broadcasts it to the
+// authorized miners if it changed. Jobs of an old head are dropped.
+func (s *Server) updateJob() {
+	next, err := s.work.StratumJob()
+	if err != nil {
+		s.logger.Warning("Failed to get stratum job", "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	if s.current != nil && s.current.WorkHash == next.WorkHash {
+		s.mu.Unlock()
+		return
+	}
+
+	clean := s.current == nil || s.current.Number.Cmp(next.Number) != 0
+	if clean {
+		s.jobs = make(map[string]*job)
+		s.order = nil
+	} else if len(s.order) >= maxJobs {
+		delete(s.jobs, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	s.nextJob++
+	j := &job{Job: next, id: fmt.Sprintf("%x", s.nextJob), shares: make(map[uint64]bool)}
+	s.jobs[j.id] = j
+	s.order = append(s.order, j.id)
+	s.current = j
+
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+
+	params := jobParams(j, clean)
+	for _, session := range sessions {
+		session.mu.Lock()
+		authorized := session.authorized
+		session.mu.Unlock()
+		if authorized {
+			s.notify(session, "mining.notify", params)
+		}
+	}
+	s.logger.Debug("New stratum job", "job", j.id, "number", j.Number.String(), "clean", clean)
+}
+
+// reply answers a request of a miner
+func (s *Server) reply(session *Session, id interface{}, result interface{}, err interface{}) {
+	s.send(session, &response{ID: id, Result: result, Error: err})
+}
+
+// notify sends a notification to a miner
+func (s *Server) notify(session *Session, method string, params []interface{}) {
+	s.send(session, &notification{Method: method, Params: params})
+}
+
+// send writes a message to a miner, closing the connection on failure
+func (s *Server) send(session *Session, msg interface{}) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		s.logger.Error("Failed to encode stratum message", "error", err)
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := session.conn.Write(append(data, '\n')); err != nil {
+		s.logger.Debug("Failed to send message to miner", "session", session.ID, "error", err)
+		session.conn.Close()
+	}
+}
+
+// jobParams returns the parameters of the mining.notify of a job: the job
+// id, the seal data, the block target, the block number and whether older
+// jobs were dropped
+func jobParams(j *job, clean bool) []interface{} {
+	return []interface{}{
+		j.id,
+		crypto.Encode(j.SealData),
+		crypto.BytesToHash(j.Target.Bytes()).Hex(),
+		crypto.EncodeBig(j.Number),
+		clean,
+	}
+}
+
+// param returns the string parameter at index i
+func param(params []interface{}, i int) (string, bool) {
+	if i >= len(params) {
+		return "", false
+	}
+	s, ok := params[i].(string)
+	return s, ok
+}
+
+// stratumError returns a stratum error triple of code, message and
+// traceback
+func stratumError(code int, message string) []interface{} {
+	return []interface{}{code, message, nil}
+}
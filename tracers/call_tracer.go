@@ -0,0 +1,124 @@
+package tracers
+
+import (
+	"errors"
+	"math/big"
+
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+)
+
+// CallFrame is a call of the tree recorded by CallTracer. Values are hex
+// encoded the way the JSON-RPC API returns them.
+type CallFrame struct {
+	Type         core.CallType `json:"type"`
+	From         string        `json:"from"`
+	To           string        `json:"to,omitempty"`
+	Value        string        `json:"value,omitempty"`
+	Gas          string        `json:"gas"`
+	GasUsed      string        `json:"gasUsed"`
+	Input        string        `json:"input"`
+	Output       string        `json:"output,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	RevertReason string        `json:"revertReason,omitempty"`
+	Calls        []*CallFrame  `json:"calls,omitempty"`
+}
+
+// CallTracer records the tree of calls made by a transaction, including
+// the nested calls between contracts
+type CallTracer struct {
+	core.NoopTracer
+
+	root  *CallFrame
+	stack []*CallFrame // frames that have been entered but not exited
+}
+
+// NewCallTracer creates a call tracer for a single transaction
+func NewCallTracer() *CallTracer {
+	return &CallTracer{}
+}
+
+// Result returns the top level call, nil if no transaction was traced
+func (t *CallTracer) Result() *CallFrame {
+	return t.root
+}
+
+// CaptureStart records the top level call of the transaction
+func (t *CallTracer) CaptureStart(from, to crypto.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	typ := core.CallTypeCall
+	if create {
+		typ = core.CallTypeCreate
+	}
+	t.root = newCallFrame(typ, from, to, input, gas, value)
+	t.stack = []*CallFrame{t.root}
+}
+
+// CaptureEnd completes the top level call
+func (t *CallTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	if t.root == nil {
+		return
+	}
+	t.root.finish(output, gasUsed, err)
+	t.stack = nil
+}
+
+// CaptureEnter records a nested call below the current frame
+func (t *CallTracer) CaptureEnter(typ core.CallType, from, to crypto.Address, input []byte, gas uint64, value *big.Int) {
+	if len(t.stack) == 0 {
+		return
+	}
+	frame := newCallFrame(typ, from, to, input, gas, value)
+	parent := t.stack[len(t.stack)-1]
+	parent.Calls = append(parent.Calls, frame)
+	t.stack = append(t.stack, frame)
+}
+
+// CaptureExit completes the current nested call
+func (t *CallTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	if len(t.stack) <= 1 {
+		return
+	}
+	frame := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+	frame.finish(output, gasUsed, err)
+}
+
+// CaptureTxEnd reports the gas used by the whole transaction, including
+// the intrinsic gas and refunds, on the top level call
+func (t *CallTracer) CaptureTxEnd(result *core.ExecutionResult) {
+	if t.root != nil {
+		t.root.GasUsed = crypto.EncodeUint64(result.GasUsed)
+	}
+}
+
+// newCallFrame creates the frame of a call that has been entered
+func newCallFrame(typ core.CallType, from, to crypto.Address, input []byte, gas uint64, value *big.Int) *CallFrame {
+	frame := &CallFrame{
+		Type:  typ,
+		From:  from.Hex(),
+		To:    to.Hex(),
+		Gas:   crypto.EncodeUint64(gas),
+		Input: crypto.Encode(input),
+	}
+	if value != nil {
+		frame.Value = crypto.EncodeBig(value)
+	}
+	return frame
+}
+
+// finish records the outcome of the call
+func (f *CallFrame) finish(output []byte, gasUsed uint64, err error) {
+	f.GasUsed = crypto.EncodeUint64(gasUsed)
+	if len(output) > 0 {
+		f.Output = crypto.Encode(output)
+	}
+	if err == nil {
+		return
+	}
+	f.Error = err.Error()
+	if errors.Is(err, core.ErrExecutionReverted) {
+		if reason, unpackErr := core.UnpackRevert(output); unpackErr == nil {
+			f.RevertReason = reason
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package trie
+
+// Keys are handled in three encodings. KEYBYTES is the plain key. HEX holds
+// one nibble per byte and is terminated by 16 if the key ends in a value.
+// COMPACT (hex prefix encoding) is how HEX keys are stored in short nodes,
+// the first nibble holds the terminator flag and the parity of the length.
+
+// keybytesToHex converts a key to HEX encoding with a terminator
+func keybytesToHex(key []byte) []byte {
+	nibbles := make([]byte, len(key)*2+1)
+	for i, b := range key {
+		nibbles[i*2] = b / 16
+		nibbles[i*2+1] = b % 16
+	}
+	nibbles[len(nibbles)-1] = 16
+	return nibbles
+}
+
+// hexToCompact converts a HEX key to COMPACT encoding
+func hexToCompact(hex []byte) []byte {
+	terminator := byte(0)
+	if hasTerm(hex) {
+		terminator = 1
+		hex = hex[:len(hex)-1]
+	}
+	buf := make([]byte, len(hex)/2+1)
+	buf[0] = terminator << 5 // the flag byte
+	if len(hex)&1 == 1 {
+		buf[0] |= 1 << 4 // odd flag
+		buf[0] |= hex[0] // first nibble is contained in the first byte
+		hex = hex[1:]
+	}
+	for i := 0; i < len(hex); i += 2 {
+		buf[i/2+1] = hex[i]<<4 | hex[i+1]
+	}
+	return buf
+}
+
+// compactToHex converts a COMPACT key to HEX encoding
+func compactToHex(compact []byte) []byte {
+	if len(compact) == 0 {
+		return compact
+	}
+	base := make([]byte, len(compact)*2+1)
+	for i, b := range compact {
+		base[i*2] = b / 16
+		base[i*2+1] = b % 16
+	}
+	base[len(base)-1] = 16
+
+	// Drop the terminator if the flag is not set
+	if base[0] < 2 {
+		base = base[:len(base)-1]
+	}
+	// Skip the flag nibble, and the padding nibble for even lengths
+	chop := 2 - base[0]&1
+	return base[chop:]
+}
+
+// prefixLen returns the length of the common prefix of a and b
+func prefixLen(a, b []byte) int {
+	i := 0
+	for ; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			break
+		}
+	}
+	return i
+}
+
+// hasTerm returns whether a HEX key has the terminator flag
+func hasTerm(hex []byte) bool {
+	return len(hex) > 0 && hex[len(hex)-1] == 16
+}
@@ -0,0 +1,180 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+
+	"blockchain-node/crypto"
+	"blockchain-node/rlp"
+)
+
+// node is an element of the trie
+type node interface {
+	cache() (hashNode, bool)
+}
+
+type (
+	// fullNode branches on the next nibble of the key, the 17th child holds
+	// the value of a key ending at this node
+	fullNode struct {
+		Children [17]node
+		flags    nodeFlag
+	}
+	// shortNode holds a run of key nibbles shared by everything below it.
+	// Key is HEX encoded, a terminated key makes Val a valueNode.
+	shortNode struct {
+		Key   []byte
+		Val   node
+		flags nodeFlag
+	}
+	// hashNode refers to a node stored in the database by its hash
+	hashNode []byte
+	// valueNode is a value stored in the trie
+	valueNode []byte
+)
+
+// nodeFlag holds the cached hash of a node and whether it changed since it
+// was loaded or committed
+type nodeFlag struct {
+	hash  hashNode // nil until the node is hashed, and for nodes embedded in their parent
+	dirty bool
+}
+
+// newFlag returns the flag of a node created by a modification
+func newFlag() nodeFlag {
+	return nodeFlag{dirty: true}
+}
+
+func (n *fullNode) cache() (hashNode, bool)  { return n.flags.hash, n.flags.dirty }
+func (n *shortNode) cache() (hashNode, bool) { return n.flags.hash, n.flags.dirty }
+func (n hashNode) cache() (hashNode, bool)   { return nil, true }
+func (n valueNode) cache() (hashNode, bool)  { return nil, true }
+
+// copy returns a shallow copy of the branch for modification
+func (n *fullNode) copy() *fullNode {
+	c := *n
+	c.flags = newFlag()
+	return &c
+}
+
+// encodeNode returns the RLP encoding of a short or full node. Children
+// whose encoding is shorter than a hash are embedded, the others are
+// referred to by hash, which is cached in their flags.
+func encodeNode(n node) []byte {
+	switch n := n.(type) {
+	case *shortNode:
+		return rlp.EncodeList(rlp.EncodeBytes(hexToCompact(n.Key)), encodeRef(n.Val))
+	case *fullNode:
+		items := make([][]byte, len(n.Children))
+		for i, child := range n.Children {
+			items[i] = encodeRef(child)
+		}
+		return rlp.EncodeList(items...)
+	}
+	panic(fmt.Sprintf("trie: can not encode %T", n))
+}
+
+// encodeRef returns how a parent node refers to n
+func encodeRef(n node) []byte {
+	switch n := n.(type) {
+	case nil:
+		return rlp.EncodeBytes(nil)
+	case hashNode:
+		return rlp.EncodeBytes(n)
+	case valueNode:
+		return rlp.EncodeBytes(n)
+	}
+	if hash, _ := n.cache(); hash != nil {
+		return rlp.EncodeBytes(hash)
+	}
+
+	enc := encodeNode(n)
+	if len(enc) < 32 {
+		return enc
+	}
+	hash := hashNode(crypto.Keccak256(enc))
+	switch n := n.(type) {
+	case *shortNode:
+		n.flags.hash = hash
+	case *fullNode:
+		n.flags.hash = hash
+	}
+	return rlp.EncodeBytes(hash)
+}
+
+// decodeNode parses the encoding of a node loaded from the database under
+// hash, nil for embedded nodes
+func decodeNode(hash, buf []byte) (node, error) {
+	elems, rest, err := rlp.SplitList(buf)
+	if err != nil {
+		return nil, fmt.Errorf("decode error: %v", err)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("decode error: trailing bytes after node")
+	}
+
+	var items [][]byte
+	for len(elems) > 0 {
+		_, _, next, err := rlp.Split(elems)
+		if err != nil {
+			return nil, fmt.Errorf("decode error: %v", err)
+		}
+		items = append(items, elems[:len(elems)-len(next)])
+		elems = next
+	}
+
+	flags := nodeFlag{hash: hash}
+	switch len(items) {
+	case 2:
+		compact, _, err := rlp.SplitString(items[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid short node key: %v", err)
+		}
+		key := compactToHex(compact)
+		if hasTerm(key) {
+			value, _, err := rlp.SplitString(items[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value node: %v", err)
+			}
+			return &shortNode{Key: key, Val: valueNode(value), flags: flags}, nil
+		}
+		child, err := decodeRef(items[1])
+		if err != nil {
+			return nil, err
+		}
+		return &shortNode{Key: key, Val: child, flags: flags}, nil
+	case 17:
+		n := &fullNode{flags: flags}
+		for i := 0; i < 16; i++ {
+			if n.Children[i], err = decodeRef(items[i]); err != nil {
+				return nil, err
+			}
+		}
+		value, _, err := rlp.SplitString(items[16])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value node: %v", err)
+		}
+		if len(value) > 0 {
+			n.Children[16] = valueNode(value)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("invalid number of list elements: %d", len(items))
+}
+
+// decodeRef parses a child reference, either an embedded node or a hash
+func decodeRef(buf []byte) (node, error) {
+	isList, content, _, err := rlp.Split(buf)
+	if err != nil {
+		return nil, fmt.Errorf("decode error: %v", err)
+	}
+	switch {
+	case isList:
+		return decodeNode(nil, buf)
+	case len(content) == 0:
+		return nil, nil
+	case len(content) == crypto.HashLength:
+		return hashNode(content), nil
+	}
+	return nil, fmt.Errorf("invalid child reference of %d bytes", len(content))
+}
@@ -0,0 +1,109 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+
+	"blockchain-node/crypto"
+)
+
+// Prove returns a Merkle proof for key: the encodings of the nodes on the
+// path from the root to the value, or to the point where the path ends if
+// the key is not in the trie. Nodes embedded in their parent are part of
+// the parent's encoding. The trie must not have uncommitted changes.
+func (t *Trie) Prove(key []byte) ([][]byte, error) {
+	var path []node
+	n := t.root
+	hex := keybytesToHex(key)
+	for len(hex) > 0 && n != nil {
+		switch current := n.(type) {
+		case *shortNode:
+			if len(hex) < len(current.Key) || !bytes.Equal(current.Key, hex[:len(current.Key)]) {
+				n = nil
+			} else {
+				n, hex = current.Val, hex[len(current.Key):]
+			}
+			path = append(path, current)
+		case *fullNode:
+			n, hex = current.Children[hex[0]], hex[1:]
+			path = append(path, current)
+		case hashNode:
+			resolved, err := t.resolveHash(current)
+			if err != nil {
+				return nil, err
+			}
+			n = resolved
+		case valueNode:
+			n = nil
+		default:
+			panic(fmt.Sprintf("trie: invalid node %T", n))
+		}
+	}
+
+	proof := make([][]byte, 0, len(path))
+	for i, n := range path {
+		enc := encodeNode(n)
+		if i == 0 || len(enc) >= 32 {
+			proof = append(proof, enc)
+		}
+	}
+	return proof, nil
+}
+
+// VerifyProof checks a proof created by Prove against the root hash and
+// returns the value of key, nil if the proof shows that key is absent
+func VerifyProof(root crypto.Hash, key []byte, proof [][]byte) ([]byte, error) {
+	nodes := make(map[crypto.Hash][]byte, len(proof))
+	for _, enc := range proof {
+		nodes[crypto.Keccak256Hash(enc)] = enc
+	}
+
+	hex := keybytesToHex(key)
+	want := root
+	for i := 0; ; i++ {
+		enc, ok := nodes[want]
+		if !ok {
+			return nil, fmt.Errorf("proof node %d (hash %x) missing", i, want.Bytes())
+		}
+		n, err := decodeNode(want.Bytes(), enc)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node %d: %v", i, err)
+		}
+
+		var next node
+		hex, next = walkNode(n, hex)
+		switch next := next.(type) {
+		case nil:
+			return nil, nil
+		case valueNode:
+			return next, nil
+		case hashNode:
+			want = crypto.BytesToHash(next)
+		}
+	}
+}
+
+// walkNode follows the HEX key through n and the nodes embedded in it. It
+// returns the rest of the key and where the walk stopped: at a value, at a
+// hash node or at nil if the key is not in the trie.
+func walkNode(n node, hex []byte) ([]byte, node) {
+	for {
+		switch current := n.(type) {
+		case *shortNode:
+			if len(hex) < len(current.Key) || !bytes.Equal(current.Key, hex[:len(current.Key)]) {
+				return nil, nil
+			}
+			n, hex = current.Val, hex[len(current.Key):]
+		case *fullNode:
+			n, hex = current.Children[hex[0]], hex[1:]
+		case hashNode:
+			return hex, current
+		case nil:
+			return nil, nil
+		case valueNode:
+			return nil, current
+		default:
+			panic(fmt.Sprintf("trie: invalid node %T", n))
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package trie
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"blockchain-node/crypto"
+	"blockchain-node/storage"
+)
+
+// LeafRefs returns the roots of other tries referenced by a leaf value, like
+// the storage root held by an account
+type LeafRefs func(value []byte) []crypto.Hash
+
+// References counts how often each stored node is referenced, by parent
+// nodes and by retained roots, so that nodes that became unreachable can be
+// deleted. Changes are kept in memory until Flush. Nodes stored without a
+// count, before counting was enabled, are counted when they are referenced
+// again and are never deleted otherwise.
+type References struct {
+	stored  *storage.Table         // stored nodes by hash
+	refs    *storage.Table         // stored counts by node hash
+	counts  map[crypto.Hash]uint64 // counts changed since the last flush
+	nodes   map[crypto.Hash][]byte // nodes committed since the last flush
+	deleted map[crypto.Hash]bool   // nodes to delete on flush
+}
+
+// NewReferences creates a reference counter for the nodes in db
+func NewReferences(db storage.Database) *References {
+	tables := storage.NewTables(db)
+	return &References{
+		stored:  tables.TrieNodes,
+		refs:    tables.TrieRefs,
+		counts:  make(map[crypto.Hash]uint64),
+		nodes:   make(map[crypto.Hash][]byte),
+		deleted: make(map[crypto.Hash]bool),
+	}
+}
+
+// Reference adds a reference to the node with the given hash. The first
+// reference to a node also references its children and, through leafRefs,
+// the tries its leaves point to.
+func (r *References) Reference(hash crypto.Hash, leafRefs LeafRefs) error {
+	if hash == (crypto.Hash{}) || hash == EmptyRoot {
+		return nil
+	}
+	count := r.count(hash)
+	r.counts[hash] = count + 1
+	delete(r.deleted, hash)
+	if count > 0 {
+		return nil
+	}
+
+	n, err := r.node(hash)
+	if err != nil {
+		return err
+	}
+	return forEachRef(n, leafRefs, func(child crypto.Hash, leafRefs LeafRefs) error {
+		return r.Reference(child, leafRefs)
+	})
+}
+
+// Dereference removes a reference to the node with the given hash. A node
+// left without references is deleted and releases its own references.
+func (r *References) Dereference(hash crypto.Hash, leafRefs LeafRefs) error {
+	if hash == (crypto.Hash{}) || hash == EmptyRoot {
+		return nil
+	}
+	count := r.count(hash)
+	if count == 0 {
+		return nil
+	}
+	r.counts[hash] = count - 1
+	if count > 1 {
+		return nil
+	}
+
+	n, err := r.node(hash)
+	if err != nil {
+		return err
+	}
+	r.deleted[hash] = true
+	return forEachRef(n, leafRefs, func(child crypto.Hash, leafRefs LeafRefs) error {
+		return r.Dereference(child, leafRefs)
+	})
+}
+
+// Flush adds the changed counts and the deletion of unreachable nodes to
+// batch
+func (r *References) Flush(batch storage.Batch) error {
+	refBatch := r.refs.Batch(batch)
+	for hash, count := range r.counts {
+		key := hash.Bytes()
+		if count == 0 {
+			if err := refBatch.Delete(key); err != nil {
+				return fmt.Errorf("failed to delete trie node count: %v", err)
+			}
+			continue
+		}
+		var enc [8]byte
+		binary.BigEndian.PutUint64(enc[:], count)
+		if err := refBatch.Put(key, enc[:]); err != nil {
+			return fmt.Errorf("failed to store trie node count: %v", err)
+		}
+	}
+	for hash := range r.deleted {
+		if err := r.stored.Batch(batch).Delete(hash.Bytes()); err != nil {
+			return fmt.Errorf("failed to delete trie node: %v", err)
+		}
+	}
+
+	r.counts = make(map[crypto.Hash]uint64)
+	r.nodes = make(map[crypto.Hash][]byte)
+	r.deleted = make(map[crypto.Hash]bool)
+	return nil
+}
+
+// Deletions returns the number of nodes the next Flush deletes
+func (r *References) Deletions() int {
+	return len(r.deleted)
+}
+
+// committed records a node stored by Trie.Commit, which is not readable
+// from the database before the batch is written
+func (r *References) committed(hash []byte, enc []byte) {
+	r.nodes[crypto.BytesToHash(hash)] = enc
+}
+
+// count returns the number of references to a node
+func (r *References) count(hash crypto.Hash) uint64 {
+	if count, ok := r.counts[hash]; ok {
+		return count
+	}
+	enc, err := r.refs.Get(hash.Bytes())
+	if err != nil || len(enc) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(enc)
+}
+
+// node loads a node committed since the last flush or stored in the
+// database
+func (r *References) node(hash crypto.Hash) (node, error) {
+	enc, ok := r.nodes[hash]
+	if !ok {
+		var err error
+		if enc, err = r.stored.Get(hash.Bytes()); err != nil || len(enc) == 0 {
+			return nil, &MissingNodeError{Hash: hash}
+		}
+	}
+	n, err := decodeNode(hash.Bytes(), enc)
+	if err != nil {
+		return nil, fmt.Errorf("trie node %x: %v", hash.Bytes(), err)
+	}
+	return n, nil
+}
+
+// forEachRef calls fn for the hash children of n, including those of its
+// embedded children, and for the trie roots referenced by its leaves. The
+// roots found through leafRefs have no leaf references of their own.
+func forEachRef(n node, leafRefs LeafRefs, fn func(crypto.Hash, LeafRefs) error) error {
+	switch n := n.(type) {
+	case *shortNode:
+		return forEachRef(n.Val, leafRefs, fn)
+	case *fullNode:
+		for _, child := range n.Children {
+			if err := forEachRef(child, leafRefs, fn); err != nil {
+				return err
+			}
+		}
+	case hashNode:
+		return fn(crypto.BytesToHash(n), leafRefs)
+	case valueNode:
+		if leafRefs == nil {
+			return nil
+		}
+		for _, root := range leafRefs(n) {
+			if err := fn(root, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
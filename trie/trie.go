@@ -0,0 +1,342 @@
+// Package trie implements the Merkle Patricia Trie used for the world state.
+// Nodes are stored in the database by hash, so every committed root stays
+// readable until it is pruned, see References.
+package trie
+
+import (
+	"bytes"
+	"fmt"
+
+	"blockchain-node/crypto"
+	"blockchain-node/rlp"
+	"blockchain-node/storage"
+)
+
+// EmptyRoot is the root hash of an empty trie
+var EmptyRoot = crypto.Keccak256Hash(rlp.EncodeBytes(nil))
+
+// MissingNodeError is returned when a node referenced by the trie is not in
+// the database
+type MissingNodeError struct {
+	Hash crypto.Hash
+}
+
+func (err *MissingNodeError) Error() string {
+	return fmt.Sprintf("missing trie node %x", err.Hash.Bytes())
+}
+
+// Trie is a Merkle Patricia Trie. Changes are kept in memory until Commit.
+// A Trie is not safe for concurrent use.
+type Trie struct {
+	nodes     *storage.Table // stored nodes by hash
+	root      node
+	committed int // nodes stored by Commit so far
+}
+
+// New opens the trie with the given root. The zero hash and EmptyRoot both
+// open an empty trie.
+func New(root crypto.Hash, db storage.Database) (*Trie, error) {
+	t := &Trie{nodes: storage.NewTables(db).TrieNodes}
+	if root != (crypto.Hash{}) && root != EmptyRoot {
+		n, err := t.resolveHash(hashNode(root.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		t.root = n
+	}
+	return t, nil
+}
+
+// Get returns the value stored under key, nil if there is none
+func (t *Trie) Get(key []byte) ([]byte, error) {
+	n := t.root
+	hex := keybytesToHex(key)
+	for {
+		switch current := n.(type) {
+		case nil:
+			return nil, nil
+		case valueNode:
+			return current, nil
+		case *shortNode:
+			if len(hex) < len(current.Key) || !bytes.Equal(current.Key, hex[:len(current.Key)]) {
+				return nil, nil
+			}
+			n, hex = current.Val, hex[len(current.Key):]
+		case *fullNode:
+			n, hex = current.Children[hex[0]], hex[1:]
+		case hashNode:
+			resolved, err := t.resolveHash(current)
+			if err != nil {
+				return nil, err
+			}
+			n = resolved
+		default:
+			panic(fmt.Sprintf("trie: invalid node %T", n))
+		}
+	}
+}
+
+// Update stores value under key, an empty value deletes the key
+func (t *Trie) Update(key, value []byte) error {
+	if len(value) == 0 {
+		return t.Delete(key)
+	}
+	_, root, err := t.insert(t.root, keybytesToHex(key), valueNode(value))
+	if err != nil {
+		return err
+	}
+	t.root = root
+	return nil
+}
+
+// Delete removes key from the trie
+func (t *Trie) Delete(key []byte) error {
+	_, root, err := t.delete(t.root, keybytesToHex(key))
+	if err != nil {
+		return err
+	}
+	t.root = root
+	return nil
+}
+
+// Hash returns the root hash of the trie without writing anything
+func (t *Trie) Hash() crypto.Hash {
+	if t.root == nil {
+		return EmptyRoot
+	}
+	if hash, _ := t.root.cache(); hash != nil {
+		return crypto.BytesToHash(hash)
+	}
+	return crypto.Keccak256Hash(encodeNode(t.root))
+}
+
+// Commit adds the nodes changed since the trie was opened to batch and
+// returns the root hash. The root node is always stored, even if it is
+// small enough to be embedded. The stored nodes are recorded in refs, if
+// not nil, so that they can be referenced before the batch is written.
+func (t *Trie) Commit(batch storage.Batch, refs *References) (crypto.Hash, error) {
+	if t.root == nil {
+		return EmptyRoot, nil
+	}
+	root := t.Hash()
+	if err := t.commit(t.root, batch, refs, root.Bytes()); err != nil {
+		return crypto.Hash{}, err
+	}
+	return root, nil
+}
+
+// Committed returns the number of nodes stored by Commit so far
+func (t *Trie) Committed() int {
+	return t.committed
+}
+
+// commit stores the dirty nodes below and including n. rootHash is set for
+// the root node only.
+func (t *Trie) commit(n node, batch storage.Batch, refs *References, rootHash []byte) error {
+	var flags *nodeFlag
+	switch n := n.(type) {
+	case *shortNode:
+		if !n.flags.dirty {
+			return nil
+		}
+		if err := t.commit(n.Val, batch, refs, nil); err != nil {
+			return err
+		}
+		flags = &n.flags
+	case *fullNode:
+		if !n.flags.dirty {
+			return nil
+		}
+		for _, child := range n.Children {
+			if err := t.commit(child, batch, refs, nil); err != nil {
+				return err
+			}
+		}
+		flags = &n.flags
+	default:
+		// Values are part of their parent and hash nodes are already stored
+		return nil
+	}
+
+	hash := flags.hash
+	if rootHash != nil {
+		hash = rootHash
+	}
+	// Nodes without a hash are embedded in their parent
+	if hash != nil {
+		enc := encodeNode(n)
+		if err := t.nodes.Batch(batch).Put(hash, enc); err != nil {
+			return fmt.Errorf("failed to store trie node: %v", err)
+		}
+		t.committed++
+		if refs != nil {
+			refs.committed(hash, enc)
+		}
+	}
+	flags.dirty = false
+	return nil
+}
+
+// insert adds value under the HEX key below n and returns the new node and
+// whether anything changed
+func (t *Trie) insert(n node, key []byte, value node) (bool, node, error) {
+	if len(key) == 0 {
+		if v, ok := n.(valueNode); ok {
+			return !bytes.Equal(v, value.(valueNode)), value, nil
+		}
+		return true, value, nil
+	}
+
+	switch n := n.(type) {
+	case *shortNode:
+		matchlen := prefixLen(key, n.Key)
+		// The whole key of the short node matches, continue below it
+		if matchlen == len(n.Key) {
+			dirty, child, err := t.insert(n.Val, key[matchlen:], value)
+			if !dirty || err != nil {
+				return false, n, err
+			}
+			return true, &shortNode{Key: n.Key, Val: child, flags: newFlag()}, nil
+		}
+
+		// Otherwise branch out at the first differing nibble
+		branch := &fullNode{flags: newFlag()}
+		var err error
+		_, branch.Children[n.Key[matchlen]], err = t.insert(nil, n.Key[matchlen+1:], n.Val)
+		if err != nil {
+			return false, nil, err
+		}
+		_, branch.Children[key[matchlen]], err = t.insert(nil, key[matchlen+1:], value)
+		if err != nil {
+			return false, nil, err
+		}
+		if matchlen == 0 {
+			return true, branch, nil
+		}
+		return true, &shortNode{Key: key[:matchlen], Val: branch, flags: newFlag()}, nil
+
+	case *fullNode:
+		dirty, child, err := t.insert(n.Children[key[0]], key[1:], value)
+		if !dirty || err != nil {
+			return false, n, err
+		}
+		n = n.copy()
+		n.Children[key[0]] = child
+		return true, n, nil
+
+	case nil:
+		return true, &shortNode{Key: key, Val: value, flags: newFlag()}, nil
+
+	case hashNode:
+		resolved, err := t.resolveHash(n)
+		if err != nil {
+			return false, nil, err
+		}
+		dirty, child, err := t.insert(resolved, key, value)
+		if !dirty || err != nil {
+			return false, resolved, err
+		}
+		return true, child, nil
+	}
+	panic(fmt.Sprintf("trie: invalid node %T", n))
+}
+
+// delete removes the HEX key below n and returns the new node and whether
+// anything changed. Branches left with a single child are collapsed.
+func (t *Trie) delete(n node, key []byte) (bool, node, error) {
+	switch n := n.(type) {
+	case *shortNode:
+		matchlen := prefixLen(key, n.Key)
+		if matchlen < len(n.Key) {
+			return false, n, nil // key is not in the trie
+		}
+		if matchlen == len(key) {
+			return true, nil, nil // the whole node is removed
+		}
+
+		dirty, child, err := t.delete(n.Val, key[len(n.Key):])
+		if !dirty || err != nil {
+			return false, n, err
+		}
+		// Merge with a short node child so the trie stays canonical
+		if short, ok := child.(*shortNode); ok {
+			merged := append(append([]byte{}, n.Key...), short.Key...)
+			return true, &shortNode{Key: merged, Val: short.Val, flags: newFlag()}, nil
+		}
+		return true, &shortNode{Key: n.Key, Val: child, flags: newFlag()}, nil
+
+	case *fullNode:
+		dirty, child, err := t.delete(n.Children[key[0]], key[1:])
+		if !dirty || err != nil {
+			return false, n, err
+		}
+		n = n.copy()
+		n.Children[key[0]] = child
+		if child != nil {
+			return true, n, nil
+		}
+
+		// Find out whether a single child is left
+		pos := -1
+		for i, c := range n.Children {
+			if c == nil {
+				continue
+			}
+			if pos != -1 {
+				return true, n, nil
+			}
+			pos = i
+		}
+		if pos != 16 {
+			// The remaining child is merged into a short node if it is one
+			remaining, err := t.resolve(n.Children[pos])
+			if err != nil {
+				return false, nil, err
+			}
+			if short, ok := remaining.(*shortNode); ok {
+				merged := append([]byte{byte(pos)}, short.Key...)
+				return true, &shortNode{Key: merged, Val: short.Val, flags: newFlag()}, nil
+			}
+		}
+		return true, &shortNode{Key: []byte{byte(pos)}, Val: n.Children[pos], flags: newFlag()}, nil
+
+	case valueNode:
+		return true, nil, nil
+
+	case nil:
+		return false, nil, nil
+
+	case hashNode:
+		resolved, err := t.resolveHash(n)
+		if err != nil {
+			return false, nil, err
+		}
+		dirty, child, err := t.delete(resolved, key)
+		if !dirty || err != nil {
+			return false, resolved, err
+		}
+		return true, child, nil
+	}
+	panic(fmt.Sprintf("trie: invalid node %T", n))
+}
+
+// resolve loads n from the database if it is a hash node
+func (t *Trie) resolve(n node) (node, error) {
+	if hash, ok := n.(hashNode); ok {
+		return t.resolveHash(hash)
+	}
+	return n, nil
+}
+
+// resolveHash loads the node stored under hash
+func (t *Trie) resolveHash(hash hashNode) (node, error) {
+	enc, err := t.nodes.Get(hash)
+	if err != nil || len(enc) == 0 {
+		return nil, &MissingNodeError{Hash: crypto.BytesToHash(hash)}
+	}
+	n, err := decodeNode(hash, enc)
+	if err != nil {
+		return nil, fmt.Errorf("trie node %x: %v", []byte(hash), err)
+	}
+	return n, nil
+}